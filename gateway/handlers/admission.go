@@ -0,0 +1,186 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfaas/faas/gateway/metrics"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+const (
+	// maxAdmissionRejection is the largest fraction of requests rejected, so
+	// that the requests which are admitted keep the load signal up to date
+	maxAdmissionRejection = 0.9
+
+	// latencyLoadWeight is the weight of each new latency in the average
+	latencyLoadWeight = 0.1
+
+	// latencyLoadHalfLife is how long it takes for the average to halve
+	// without invocations, so that the load recovers once traffic stops
+	latencyLoadHalfLife = 10 * time.Second
+)
+
+// LoadSignal reports the load of the gateway, where 1 is the load it is
+// sized for
+type LoadSignal interface {
+	Load() float64
+}
+
+// InFlightLoad is a LoadSignal of the requests in flight through the
+// gateway, relative to the amount it is sized for. Requests are counted with
+// MakeInFlightLoadHandler.
+type InFlightLoad struct {
+	capacity int64
+	inFlight int64
+}
+
+// NewInFlightLoad creates an InFlightLoad which reports a load of 1 when
+// capacity requests are in flight
+func NewInFlightLoad(capacity int64) *InFlightLoad {
+	return &InFlightLoad{
+		capacity: capacity,
+	}
+}
+
+// Load returns the requests in flight divided by the capacity
+func (l *InFlightLoad) Load() float64 {
+	if l.capacity <= 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&l.inFlight)) / float64(l.capacity)
+}
+
+// MakeInFlightLoadHandler counts the requests in flight through next in load
+func MakeInFlightLoadHandler(next http.HandlerFunc, load *InFlightLoad) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&load.inFlight, 1)
+		defer atomic.AddInt64(&load.inFlight, -1)
+
+		next(w, r)
+	}
+}
+
+// LatencyLoad is a LoadSignal of the exponentially weighted moving average
+// of the latency of function invocations, relative to a target. The average
+// halves every latencyLoadHalfLife without invocations. It records
+// invocations as an HTTPNotifier.
+type LatencyLoad struct {
+	target  time.Duration
+	average float64
+	updated time.Time
+	lock    sync.Mutex
+	now     func() time.Time
+}
+
+// NewLatencyLoad creates a LatencyLoad which reports a load of 1 when the
+// average latency is target
+func NewLatencyLoad(target time.Duration) *LatencyLoad {
+	return &LatencyLoad{
+		target: target,
+		now:    time.Now,
+	}
+}
+
+// Notify records the duration of a completed invocation
+func (l *LatencyLoad) Notify(method string, URL string, originalURL string, statusCode int, event string, duration time.Duration) {
+	if event != "completed" {
+		return
+	}
+	l.Observe(duration)
+}
+
+// Observe adds a latency to the average
+func (l *LatencyLoad) Observe(duration time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	average := l.decayed(now)
+	l.updated = now
+
+	if average == 0 {
+		l.average = float64(duration)
+		return
+	}
+	l.average = average + latencyLoadWeight*(float64(duration)-average)
+}
+
+// Load returns the average latency divided by the target
+func (l *LatencyLoad) Load() float64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.target <= 0 {
+		return 0
+	}
+	return l.decayed(l.now()) / float64(l.target)
+}
+
+// decayed returns the average after the time since it was last updated
+func (l *LatencyLoad) decayed(now time.Time) float64 {
+	elapsed := now.Sub(l.updated)
+	if l.average == 0 || elapsed <= 0 {
+		return l.average
+	}
+	return l.average * math.Pow(0.5, float64(elapsed)/float64(latencyLoadHalfLife))
+}
+
+// MaxLoad is a LoadSignal of the highest load of several signals
+type MaxLoad []LoadSignal
+
+// Load returns the highest load of the signals
+func (m MaxLoad) Load() float64 {
+	max := 0.0
+	for _, signal := range m {
+		if load := signal.Load(); load > max {
+			max = load
+		}
+	}
+	return max
+}
+
+// MakeAdmissionHandler rejects a fraction of requests with 503 Service
+// Unavailable whilst signal reports a load above threshold, to protect the
+// gateway itself. The fraction grows with the load: at twice the threshold
+// half of the requests are rejected, up to maxAdmissionRejection. Rejected
+// requests are asked to retry after retryAfter, rounded up to a second.
+func MakeAdmissionHandler(next http.HandlerFunc, signal LoadSignal, threshold float64, retryAfter time.Duration, metricsOptions metrics.MetricOptions, defaultNamespace string) http.HandlerFunc {
+	retryAfterSeconds := strconv.Itoa(int(math.Max(1, math.Ceil(retryAfter.Seconds()))))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64() >= admissionRejection(signal.Load(), threshold) {
+			next(w, r)
+			return
+		}
+
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+		metricsOptions.GatewayAdmissionRejected.WithLabelValues(functionName + "." + namespace).Inc()
+
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		writeError(w, r, http.StatusServiceUnavailable, functionName+"."+namespace,
+			fmt.Sprintf("gateway is overloaded, request to function %s.%s rejected", functionName, namespace))
+	}
+}
+
+// admissionRejection returns the fraction of requests to reject at load
+func admissionRejection(load float64, threshold float64) float64 {
+	if threshold <= 0 || load <= threshold {
+		return 0
+	}
+
+	fraction := 1 - threshold/load
+	if fraction > maxAdmissionRejection {
+		return maxAdmissionRejection
+	}
+	return fraction
+}
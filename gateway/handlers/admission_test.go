@@ -0,0 +1,167 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/metrics"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type fixedLoad float64
+
+func (l fixedLoad) Load() float64 {
+	return float64(l)
+}
+
+func countAdmitted(handler http.HandlerFunc, requests int) int {
+	admitted := 0
+	for i := 0; i < requests; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+		if rec.Code == http.StatusOK {
+			admitted++
+		}
+	}
+	return admitted
+}
+
+func Test_MakeAdmissionHandler_AdmitsBelowThreshold(t *testing.T) {
+	metricsOptions := metrics.BuildMetricsOptions()
+	handler := MakeAdmissionHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, fixedLoad(0.9), 1, time.Second, metricsOptions, "openfaas-fn")
+
+	if got := countAdmitted(handler, 100); got != 100 {
+		t.Errorf("admitted want: %d, got: %d", 100, got)
+	}
+}
+
+func Test_MakeAdmissionHandler_RejectsFractionAboveThreshold(t *testing.T) {
+	metricsOptions := metrics.BuildMetricsOptions()
+	handler := MakeAdmissionHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, fixedLoad(2), 1, time.Second, metricsOptions, "openfaas-fn")
+
+	// At twice the threshold half of the requests are rejected
+	admitted := countAdmitted(handler, 1000)
+	if admitted < 400 || admitted > 600 {
+		t.Errorf("admitted want around: %d, got: %d", 500, admitted)
+	}
+
+	rejected := &dto.Metric{}
+	metricsOptions.GatewayAdmissionRejected.WithLabelValues("figlet.openfaas-fn").Write(rejected)
+	if got := int(rejected.GetCounter().GetValue()); got != 1000-admitted {
+		t.Errorf("rejected count want: %d, got: %d", 1000-admitted, got)
+	}
+}
+
+func Test_MakeAdmissionHandler_RejectionHasRetryAfter(t *testing.T) {
+	handler := MakeAdmissionHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, fixedLoad(1000), 1, time.Millisecond*2500, metrics.BuildMetricsOptions(), "openfaas-fn")
+
+	for i := 0; i < 100; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			continue
+		}
+
+		if got := rec.Header().Get("Retry-After"); got != "3" {
+			t.Errorf("Retry-After want: %q, got: %q", "3", got)
+		}
+		return
+	}
+	t.Errorf("want a request to be rejected")
+}
+
+func Test_admissionRejection(t *testing.T) {
+	cases := []struct {
+		load      float64
+		threshold float64
+		want      float64
+	}{
+		{load: 0.5, threshold: 1, want: 0},
+		{load: 1, threshold: 1, want: 0},
+		{load: 4, threshold: 2, want: 0.5},
+		{load: 4, threshold: 1, want: 0.75},
+		{load: 100, threshold: 1, want: maxAdmissionRejection},
+		{load: 100, threshold: 0, want: 0},
+	}
+
+	for _, c := range cases {
+		if got := admissionRejection(c.load, c.threshold); got != c.want {
+			t.Errorf("load %.1f threshold %.1f: want: %.2f, got: %.2f", c.load, c.threshold, c.want, got)
+		}
+	}
+}
+
+func Test_LatencyLoad_AveragesCompletedInvocations(t *testing.T) {
+	now := time.Now()
+	load := NewLatencyLoad(time.Second)
+	load.now = func() time.Time { return now }
+	if got := load.Load(); got != 0 {
+		t.Errorf("load want: 0 before any invocations, got: %f", got)
+	}
+
+	load.Notify(http.MethodGet, "/function/figlet", "/function/figlet", http.StatusOK, "completed", time.Second*2)
+	if got := load.Load(); got != 2 {
+		t.Errorf("load want: 2 after the first invocation, got: %f", got)
+	}
+
+	load.Notify(http.MethodGet, "/function/figlet", "/function/figlet", http.StatusOK, "started", time.Second*100)
+	if got := load.Load(); got != 2 {
+		t.Errorf("load want started invocations to be ignored, got: %f", got)
+	}
+
+	// Each invocation moves the average a tenth of the way to its latency
+	for i := 0; i < 100; i++ {
+		load.Observe(0)
+	}
+	if got := load.Load(); got > 0.01 {
+		t.Errorf("load want to fall towards 0, got: %f", got)
+	}
+}
+
+func Test_LatencyLoad_DecaysWithoutInvocations(t *testing.T) {
+	now := time.Now()
+	load := NewLatencyLoad(time.Second)
+	load.now = func() time.Time { return now }
+
+	load.Observe(time.Second * 4)
+	now = now.Add(latencyLoadHalfLife)
+	if got := load.Load(); got != 2 {
+		t.Errorf("load want: 2 after a half-life, got: %f", got)
+	}
+
+	now = now.Add(latencyLoadHalfLife * 10)
+	if got := load.Load(); got > 0.01 {
+		t.Errorf("load want to fall towards 0 without invocations, got: %f", got)
+	}
+}
+
+func Test_InFlightLoad_CountsRequests(t *testing.T) {
+	load := NewInFlightLoad(4)
+
+	var during float64
+	handler := MakeInFlightLoadHandler(func(w http.ResponseWriter, r *http.Request) {
+		during = load.Load()
+	}, load)
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if during != 0.25 {
+		t.Errorf("load want: 0.25 whilst a request is in flight, got: %f", during)
+	}
+	if got := load.Load(); got != 0 {
+		t.Errorf("load want: 0 once the request completes, got: %f", got)
+	}
+}
+
+func Test_MaxLoad(t *testing.T) {
+	if got := (MaxLoad{fixedLoad(0.5), fixedLoad(2), fixedLoad(1)}).Load(); got != 2 {
+		t.Errorf("want: 2, got: %f", got)
+	}
+}
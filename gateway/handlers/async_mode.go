@@ -0,0 +1,23 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+)
+
+// MakeAsyncModeHandler sends requests which carry header to async, i.e. the
+// queued proxy, all other requests are forwarded synchronously by next. It
+// is installed in place of the forwarding proxy so that both modes pass
+// through the same middleware, including scaling and authentication.
+func MakeAsyncModeHandler(next http.HandlerFunc, async http.HandlerFunc, header string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get(header)) > 0 && r.Method == http.MethodPost {
+			async(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
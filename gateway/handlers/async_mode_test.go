@@ -0,0 +1,42 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_MakeAsyncModeHandler(t *testing.T) {
+	handler := MakeAsyncModeHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}, "X-Callback-Url")
+
+	cases := []struct {
+		name        string
+		method      string
+		callbackURL string
+		wantStatus  int
+	}{
+		{name: "sync without the header", method: http.MethodPost, wantStatus: http.StatusOK},
+		{name: "async with the header", method: http.MethodPost, callbackURL: "http://receiver:8080", wantStatus: http.StatusAccepted},
+		{name: "GET is always sync", method: http.MethodGet, callbackURL: "http://receiver:8080", wantStatus: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/function/figlet", nil)
+		if len(c.callbackURL) > 0 {
+			req.Header.Set("X-Callback-Url", c.callbackURL)
+		}
+
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s want: %d, got: %d", c.name, c.wantStatus, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type notification struct {
+	method      string
+	URL         string
+	originalURL string
+	statusCode  int
+	event       string
+	duration    time.Duration
+}
+
+// AsyncNotifier calls notifiers from a bounded pool of workers so that a
+// slow notifier does not add latency to requests. Notifications for the
+// same URL go to the same worker, so "started" is always delivered before
+// "completed" for a request. When a worker's queue is full notifications
+// are dropped and counted, which means metrics may under-count.
+type AsyncNotifier struct {
+	notifiers []HTTPNotifier
+	queues    []chan notification
+	dropped   uint64
+	reported  uint64
+	wg        sync.WaitGroup
+}
+
+// NewAsyncNotifier creates an AsyncNotifier with workers each buffering up
+// to queueSize notifications
+func NewAsyncNotifier(notifiers []HTTPNotifier, workers, queueSize int) *AsyncNotifier {
+	a := &AsyncNotifier{
+		notifiers: notifiers,
+		queues:    make([]chan notification, workers),
+	}
+
+	for i := range a.queues {
+		a.queues[i] = make(chan notification, queueSize)
+		a.wg.Add(1)
+		go a.run(a.queues[i])
+	}
+	return a
+}
+
+// Notify queues the notification for the notifiers, or drops it when the
+// queue is full
+func (a *AsyncNotifier) Notify(method string, URL string, originalURL string, statusCode int, event string, duration time.Duration) {
+	h := fnv.New32a()
+	h.Write([]byte(originalURL))
+	queue := a.queues[h.Sum32()%uint32(len(a.queues))]
+
+	select {
+	case queue <- notification{method, URL, originalURL, statusCode, event, duration}:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+}
+
+// Dropped returns the amount of notifications dropped due to a full queue
+func (a *AsyncNotifier) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Close stops the workers once queued notifications are delivered,
+// Notify must not be called after Close
+func (a *AsyncNotifier) Close() {
+	for _, queue := range a.queues {
+		close(queue)
+	}
+	a.wg.Wait()
+}
+
+func (a *AsyncNotifier) run(queue chan notification) {
+	defer a.wg.Done()
+
+	for n := range queue {
+		for _, notifier := range a.notifiers {
+			notifier.Notify(n.method, n.URL, n.originalURL, n.statusCode, n.event, n.duration)
+		}
+
+		dropped := a.Dropped()
+		if reported := atomic.LoadUint64(&a.reported); dropped > reported &&
+			atomic.CompareAndSwapUint64(&a.reported, reported, dropped) {
+			log.Printf("Notifier: %d notification(s) dropped due to a full queue\n", dropped-reported)
+		}
+	}
+}
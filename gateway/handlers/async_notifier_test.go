@@ -0,0 +1,70 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier records events in the order they are received
+type recordingNotifier struct {
+	lock    sync.Mutex
+	events  map[string][]string
+	release chan struct{}
+}
+
+func (r *recordingNotifier) Notify(method string, URL string, originalURL string, statusCode int, event string, duration time.Duration) {
+	if r.release != nil {
+		<-r.release
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events[originalURL] = append(r.events[originalURL], event)
+}
+
+func Test_AsyncNotifier_PreservesOrderPerRequest(t *testing.T) {
+	recorder := &recordingNotifier{events: map[string][]string{}}
+	notifier := NewAsyncNotifier([]HTTPNotifier{recorder}, 4, 100)
+
+	for i := 0; i < 20; i++ {
+		url := fmt.Sprintf("/function/fn-%d", i)
+		notifier.Notify(http.MethodGet, url, url, http.StatusProcessing, "started", 0)
+		notifier.Notify(http.MethodGet, url, url, http.StatusOK, "completed", time.Millisecond)
+	}
+	notifier.Close()
+
+	for url, events := range recorder.events {
+		if len(events) != 2 || events[0] != "started" || events[1] != "completed" {
+			t.Errorf("%s want: [started completed], got: %v", url, events)
+		}
+	}
+	if len(recorder.events) != 20 {
+		t.Errorf("want events for 20 requests, got: %d", len(recorder.events))
+	}
+}
+
+func Test_AsyncNotifier_DropsWhenQueueIsFull(t *testing.T) {
+	recorder := &recordingNotifier{events: map[string][]string{}, release: make(chan struct{})}
+	notifier := NewAsyncNotifier([]HTTPNotifier{recorder}, 1, 1)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		notifier.Notify(http.MethodGet, "/function/figlet", "/function/figlet", http.StatusOK, "completed", 0)
+	}
+
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("want Notify not to block on a slow notifier, took: %s", took)
+	}
+	if notifier.Dropped() == 0 {
+		t.Errorf("want notifications to be dropped")
+	}
+
+	close(recorder.release)
+	notifier.Close()
+}
@@ -0,0 +1,120 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// AuditRecord is written to the audit log for every function invocation
+type AuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Function  string    `json:"function"`
+	Namespace string    `json:"namespace"`
+	ClientIP  string    `json:"clientIP"`
+	Method    string    `json:"method"`
+	Status    int       `json:"status"`
+	Duration  float64   `json:"durationSeconds"`
+	RequestID string    `json:"requestID"`
+}
+
+// AuditLogger records function invocations, implementations must not block
+type AuditLogger interface {
+	Log(record AuditRecord)
+}
+
+// NoopAuditLogger discards audit records
+type NoopAuditLogger struct {
+}
+
+// Log discards the record
+func (NoopAuditLogger) Log(record AuditRecord) {
+}
+
+// AsyncAuditLogger writes audit records as JSON lines from a background
+// goroutine. When the buffer is full, records are dropped and counted
+// so that the request path is never blocked.
+type AsyncAuditLogger struct {
+	records chan AuditRecord
+	dropped uint64
+}
+
+// NewAsyncAuditLogger creates an AsyncAuditLogger writing to writer, which
+// should be opened in append-only mode
+func NewAsyncAuditLogger(writer io.Writer, bufferSize int) *AsyncAuditLogger {
+	a := &AsyncAuditLogger{
+		records: make(chan AuditRecord, bufferSize),
+	}
+
+	go a.run(writer)
+	return a
+}
+
+// Log queues the record to be written, or drops it when the buffer is full
+func (a *AsyncAuditLogger) Log(record AuditRecord) {
+	select {
+	case a.records <- record:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+}
+
+// Dropped returns the amount of records dropped due to a full buffer
+func (a *AsyncAuditLogger) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Close stops the background writer once buffered records are written,
+// Log must not be called after Close
+func (a *AsyncAuditLogger) Close() {
+	close(a.records)
+}
+
+func (a *AsyncAuditLogger) run(writer io.Writer) {
+	encoder := json.NewEncoder(writer)
+	var reported uint64
+
+	for record := range a.records {
+		if err := encoder.Encode(record); err != nil {
+			log.Printf("Audit log: unable to write record: %s\n", err)
+		}
+
+		if dropped := a.Dropped(); dropped != reported {
+			log.Printf("Audit log: %d record(s) dropped due to a full buffer\n", dropped-reported)
+			reported = dropped
+		}
+	}
+}
+
+// MakeAuditHandler records every invocation with the AuditLogger once
+// next has completed, with the request ID from requestIDHeader
+func MakeAuditHandler(next http.HandlerFunc, auditLogger AuditLogger, requestIDHeader string, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		writer := httputil.NewHttpWriteInterceptor(w)
+		next(writer, r)
+
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		auditLogger.Log(AuditRecord{
+			Timestamp: start.UTC(),
+			Function:  functionName,
+			Namespace: namespace,
+			ClientIP:  getClientIP(r),
+			Method:    r.Method,
+			Status:    writer.Status(),
+			Duration:  time.Since(start).Seconds(),
+			RequestID: readRequestID(writer.Header(), r, requestIDHeader),
+		})
+	}
+}
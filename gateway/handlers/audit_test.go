@@ -0,0 +1,94 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testAuditLogger struct {
+	records []AuditRecord
+}
+
+func (t *testAuditLogger) Log(record AuditRecord) {
+	t.records = append(t.records, record)
+}
+
+func Test_MakeAuditHandler_RecordsInvocation(t *testing.T) {
+	auditLogger := &testAuditLogger{}
+
+	handler := MakeAuditHandler(MakeCallIDMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}), auditLogger, "", "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodPost, "/function/figlet.dev", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(auditLogger.records) != 1 {
+		t.Fatalf("want 1 record, got: %d", len(auditLogger.records))
+	}
+
+	record := auditLogger.records[0]
+	if record.Function != "figlet" || record.Namespace != "dev" {
+		t.Errorf("function want: %s, got: %s.%s", "figlet.dev", record.Function, record.Namespace)
+	}
+	if record.Status != http.StatusCreated {
+		t.Errorf("status want: %d, got: %d", http.StatusCreated, record.Status)
+	}
+	if record.ClientIP != "10.0.0.1" {
+		t.Errorf("client IP want: %s, got: %s", "10.0.0.1", record.ClientIP)
+	}
+	if len(record.RequestID) == 0 {
+		t.Errorf("want a request ID")
+	}
+}
+
+func Test_MakeAuditHandler_RecordsConfiguredRequestID(t *testing.T) {
+	auditLogger := &testAuditLogger{}
+
+	handler := MakeAuditHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Correlation-Id", "correlation-1")
+	}, auditLogger, "X-Correlation-Id", "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.Header.Set("X-Call-Id", "call-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := auditLogger.records[0].RequestID; got != "correlation-1" {
+		t.Errorf("request ID want: %s, got: %s", "correlation-1", got)
+	}
+}
+
+// blockingWriter never completes a write
+type blockingWriter struct {
+	block chan struct{}
+}
+
+func (b blockingWriter) Write(p []byte) (int, error) {
+	<-b.block
+	return len(p), nil
+}
+
+func Test_AsyncAuditLogger_DropsWhenFull(t *testing.T) {
+	writer := blockingWriter{block: make(chan struct{})}
+	auditLogger := NewAsyncAuditLogger(writer, 1)
+
+	defer func() {
+		auditLogger.Close()
+		close(writer.block)
+	}()
+
+	// The first record is held by the blocked writer, the second fills
+	// the buffer and the rest are dropped.
+	for i := 0; i < 5; i++ {
+		auditLogger.Log(AuditRecord{Function: "figlet"})
+	}
+
+	if auditLogger.Dropped() < 3 {
+		t.Errorf("want at least 3 dropped records, got: %d", auditLogger.Dropped())
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sync"
+)
+
+// BatchRequestItem is a single function invocation in a batch
+type BatchRequestItem struct {
+	Function string          `json:"function"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+}
+
+// BatchResponseItem is the result of a single function invocation in a batch,
+// Body is the function's response as JSON, or as a JSON string otherwise
+type BatchResponseItem struct {
+	Function string          `json:"function"`
+	Status   int             `json:"status"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+var batchFunctionName = regexp.MustCompile(`^[-a-zA-Z_0-9.]+$`)
+
+// MakeBatchHandler invokes every function in a JSON array of
+// BatchRequestItem through invoke, with at most maxConcurrency in flight,
+// and responds with an array of BatchResponseItem in the same order.
+// A failed invocation is reported in its item and does not fail the batch.
+// maxBodyBytes bounds the batch's request body and the response of each
+// item, with no limit when 0.
+func MakeBatchHandler(invoke http.HandlerFunc, maxConcurrency, maxItems int, maxBodyBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil {
+			http.Error(w, "a JSON array of {function, payload} is required", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		reader := r.Body
+		if maxBodyBytes > 0 {
+			reader = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		}
+		body, err := ioutil.ReadAll(reader)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("a batch can be at most %d bytes", maxBodyBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		var items []BatchRequestItem
+		if err := json.Unmarshal(body, &items); err != nil {
+			http.Error(w, fmt.Sprintf("a JSON array of {function, payload} is required: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if maxItems > 0 && len(items) > maxItems {
+			http.Error(w, fmt.Sprintf("a batch can have at most %d items", maxItems), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		results := make([]BatchResponseItem, len(items))
+		sem := make(chan struct{}, maxConcurrency)
+		wg := sync.WaitGroup{}
+
+		for i, item := range items {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, item BatchRequestItem) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				results[i] = invokeBatchItem(r.Context(), invoke, r, item, maxBodyBytes)
+			}(i, item)
+		}
+		wg.Wait()
+
+		jsonOut, err := json.Marshal(results)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonOut)
+	}
+}
+
+func invokeBatchItem(ctx context.Context, invoke http.HandlerFunc, original *http.Request, item BatchRequestItem, maxBodyBytes int64) BatchResponseItem {
+	res := BatchResponseItem{Function: item.Function}
+
+	if !batchFunctionName.MatchString(item.Function) {
+		res.Status = http.StatusBadRequest
+		res.Error = "invalid function name"
+		return res
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/function/"+item.Function, bytes.NewReader(item.Payload))
+	if err != nil {
+		res.Status = http.StatusBadRequest
+		res.Error = err.Error()
+		return res
+	}
+
+	req.Header = original.Header.Clone()
+	req.Header.Del("Content-Length")
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = original.RemoteAddr
+	req.Host = original.Host
+
+	writer := newMemoryResponseWriter()
+	writer.maxBodyBytes = maxBodyBytes
+	invoke(writer, req)
+
+	if writer.overflow {
+		res.Status = http.StatusBadGateway
+		res.Error = fmt.Sprintf("response is larger than %d bytes", maxBodyBytes)
+		return res
+	}
+
+	res.Status = writer.status
+	if writer.body.Len() > 0 {
+		if json.Valid(writer.body.Bytes()) {
+			res.Body = json.RawMessage(writer.body.Bytes())
+		} else {
+			res.Body, _ = json.Marshal(writer.body.String())
+		}
+	}
+	return res
+}
+
+// memoryResponseWriter buffers a response which is not written to a client,
+// such as a single batch item. A body larger than maxBodyBytes is discarded
+// and marked as an overflow, there is no limit when it is 0.
+type memoryResponseWriter struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+
+	maxBodyBytes int64
+	overflow     bool
+}
+
+func newMemoryResponseWriter() *memoryResponseWriter {
+	return &memoryResponseWriter{
+		header: http.Header{},
+		status: http.StatusOK,
+	}
+}
+
+func (b *memoryResponseWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *memoryResponseWriter) WriteHeader(status int) {
+	if b.wroteHeader || status < 200 {
+		return
+	}
+	b.wroteHeader = true
+	b.status = status
+}
+
+func (b *memoryResponseWriter) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	if b.overflow {
+		return len(p), nil
+	}
+	if b.maxBodyBytes > 0 && int64(b.body.Len()+len(p)) > b.maxBodyBytes {
+		b.overflow = true
+		b.body.Reset()
+		return len(p), nil
+	}
+	return b.body.Write(p)
+}
@@ -0,0 +1,155 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_MakeBatchHandler_ReportsPerItemStatus(t *testing.T) {
+	invoke := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/function/echo":
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(body)
+		case "/function/figlet":
+			w.Write([]byte("not json"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+
+	body := `[{"function":"echo","payload":{"a":1}},{"function":"missing"},{"function":"figlet","payload":"hi"},{"function":"../system"}]`
+	rr := httptest.NewRecorder()
+	MakeBatchHandler(invoke, 2, 10, 1024)(rr, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+
+	var got []BatchResponseItem
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("want 4 results, got: %d", len(got))
+	}
+
+	if got[0].Status != http.StatusOK || string(got[0].Body) != `{"a":1}` {
+		t.Errorf("echo want: 200 {\"a\":1}, got: %d %s", got[0].Status, got[0].Body)
+	}
+	if got[1].Status != http.StatusNotFound {
+		t.Errorf("missing want: %d, got: %d", http.StatusNotFound, got[1].Status)
+	}
+	if got[2].Status != http.StatusOK || string(got[2].Body) != `"not json"` {
+		t.Errorf("figlet want: 200 \"not json\", got: %d %s", got[2].Status, got[2].Body)
+	}
+	if got[3].Status != http.StatusBadRequest {
+		t.Errorf("invalid name want: %d, got: %d", http.StatusBadRequest, got[3].Status)
+	}
+}
+
+func Test_MakeBatchHandler_BoundsConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	invoke := func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 10)
+		atomic.AddInt32(&inFlight, -1)
+	}
+
+	body := `[` + strings.Repeat(`{"function":"echo"},`, 9) + `{"function":"echo"}]`
+	rr := httptest.NewRecorder()
+	MakeBatchHandler(invoke, 3, 10, 1024)(rr, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+
+	if got := atomic.LoadInt32(&maxInFlight); got > 3 {
+		t.Errorf("want at most 3 concurrent invocations, got: %d", got)
+	}
+}
+
+func Test_MakeBatchHandler_RejectsLargeBatch(t *testing.T) {
+	body := `[{"function":"a"},{"function":"b"},{"function":"c"}]`
+	rr := httptest.NewRecorder()
+	MakeBatchHandler(func(w http.ResponseWriter, r *http.Request) {}, 1, 2, 1024)(rr, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status want: %d, got: %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+}
+
+func Test_MakeBatchHandler_RejectsLargeBody(t *testing.T) {
+	body := `[{"function":"a","payload":"` + strings.Repeat("x", 64) + `"}]`
+	rr := httptest.NewRecorder()
+	MakeBatchHandler(func(w http.ResponseWriter, r *http.Request) {}, 1, 10, 32)(rr, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status want: %d, got: %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+}
+
+func Test_MakeBatchHandler_BoundsItemResponse(t *testing.T) {
+	invoke := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 16)))
+		w.Write([]byte(strings.Repeat("x", 16)))
+	}
+
+	body := `[{"function":"a"}]`
+	rr := httptest.NewRecorder()
+	MakeBatchHandler(invoke, 1, 10, 24)(rr, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+
+	var results []BatchResponseItem
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("want a JSON array, got: %s", rr.Body.String())
+	}
+	if results[0].Status != http.StatusBadGateway || len(results[0].Body) > 0 {
+		t.Errorf("want a 502 without a body for an oversized response, got: %+v", results[0])
+	}
+}
+
+func Test_MakeBatchHandler_ChecksNonceOnce(t *testing.T) {
+	config := ReplayConfig{NonceHeader: "X-Nonce", TimestampHeader: "X-Timestamp", Window: time.Minute}
+	store := NewMemoryNonceStore(100)
+
+	var invoked int32
+	invoke := MakeReplayProtectionHandler(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&invoked, 1)
+	}, store, config)
+
+	handler := MakeReplayProtectionHandler(MakeBatchHandler(invoke, 2, 10, 1024), store, config)
+
+	body := `[{"function":"a"},{"function":"b"},{"function":"c"}]`
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+	req.Header.Set("X-Nonce", "batch-1")
+	req.Header.Set("X-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusOK || invoked != 3 {
+		t.Errorf("want every item invoked, status: %d, invoked: %d", rr.Code, invoked)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+	req.Header.Set("X-Nonce", "batch-1")
+	req.Header.Set("X-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("replayed batch status want: %d, got: %d", http.StatusConflict, rr.Code)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// BodyChecksumAnnotation set to "true" verifies the request bodies sent
+	// to a function against the checksum headers sent by the client
+	BodyChecksumAnnotation = "com.openfaas.body-checksum"
+
+	// BodySHA256Header is the SHA-256 digest of a request body, in hex or
+	// base64
+	BodySHA256Header = "X-Body-SHA256"
+)
+
+var errBodyChecksumMismatch = errors.New("request body does not match its checksum")
+
+type bodyChecksumKey struct{}
+
+// MakeBodyChecksumHandler verifies the request bodies of functions with the
+// com.openfaas.body-checksum annotation against the Content-MD5 (base64,
+// RFC 1864) and X-Body-SHA256 headers, when the client sent either. A body
+// which does not match is rejected with 400.
+//
+// Bodies with a Content-Length of up to maxBufferBytes are buffered and
+// verified before they are sent. Larger bodies, and those of an unknown
+// length, are verified as they are streamed to the function: the last byte
+// is held back until the end of the body has been read, so a body which
+// does not match is never sent to the function in full and the upstream
+// request is cancelled. When the function responds before it has read the
+// whole body, its status has already been sent to the client by the time
+// the body is found not to match, so the mismatch can only be logged.
+func MakeBodyChecksumHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, maxBufferBytes int64, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next(w, r)
+			return
+		}
+
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+		function := functionName + "." + namespace
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil || !bodyChecksumEnabled(annotations) {
+			next(w, r)
+			return
+		}
+
+		digests, err := readBodyDigests(r.Header)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, function,
+				fmt.Sprintf("invalid checksum for function %s: %s", function, err))
+			return
+		}
+		if len(digests) == 0 {
+			next(w, r)
+			return
+		}
+
+		// Small bodies are verified before they are sent
+		if r.ContentLength >= 0 && r.ContentLength <= maxBufferBytes {
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBufferBytes+1))
+			r.Body.Close()
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, function,
+					fmt.Sprintf("unable to read the request body for function %s", function))
+				return
+			}
+
+			for _, digest := range digests {
+				digest.hash.Write(body)
+			}
+			if !bodyDigestsMatch(digests) {
+				writeError(w, r, http.StatusBadRequest, function, errBodyChecksumMismatch.Error())
+				return
+			}
+
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			next(w, r)
+			return
+		}
+
+		checksum := &checksumReader{ReadCloser: r.Body, digests: digests}
+		r.Body = checksum
+		next(w, r.WithContext(context.WithValue(r.Context(), bodyChecksumKey{}, checksum)))
+
+		if checksum.Mismatched() {
+			log.Printf("Body checksum: request body for %s did not match its checksum whilst streaming\n", function)
+		}
+	}
+}
+
+func bodyChecksumEnabled(annotations map[string]string) bool {
+	value, ok := annotations[BodyChecksumAnnotation]
+	if !ok {
+		return false
+	}
+	enabled, _ := strconv.ParseBool(strings.TrimSpace(value))
+	return enabled
+}
+
+// bodyDigest is a hash of the body and the digest the client sent for it
+type bodyDigest struct {
+	hash hash.Hash
+	want []byte
+}
+
+// readBodyDigests returns the digests sent by the client, none when it
+// sent no checksum headers
+func readBodyDigests(header http.Header) ([]bodyDigest, error) {
+	var digests []bodyDigest
+
+	if value := strings.TrimSpace(header.Get("Content-MD5")); len(value) > 0 {
+		want, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(want) != md5.Size {
+			return nil, fmt.Errorf("Content-MD5 must be a base64 MD5 digest")
+		}
+		digests = append(digests, bodyDigest{hash: md5.New(), want: want})
+	}
+
+	if value := strings.TrimSpace(header.Get(BodySHA256Header)); len(value) > 0 {
+		want, err := hex.DecodeString(value)
+		if err != nil {
+			want, err = base64.StdEncoding.DecodeString(value)
+		}
+		if err != nil || len(want) != sha256.Size {
+			return nil, fmt.Errorf("%s must be a hex or base64 SHA-256 digest", BodySHA256Header)
+		}
+		digests = append(digests, bodyDigest{hash: sha256.New(), want: want})
+	}
+
+	return digests, nil
+}
+
+func bodyDigestsMatch(digests []bodyDigest) bool {
+	for _, digest := range digests {
+		if !bytes.Equal(digest.hash.Sum(nil), digest.want) {
+			return false
+		}
+	}
+	return true
+}
+
+// checksumReader hashes a request body as it is streamed and holds back its
+// last byte until the end of the body, so that a body which does not match
+// is cancelled before the function has received all of it
+type checksumReader struct {
+	io.ReadCloser
+	digests    []bodyDigest
+	pending    byte
+	hasPending bool
+	mismatched int32
+	cancel     context.CancelFunc
+}
+
+// getChecksumReader returns the checksumReader of a request's body, if it is
+// being verified as it is streamed
+func getChecksumReader(r *http.Request) *checksumReader {
+	checksum, _ := r.Context().Value(bodyChecksumKey{}).(*checksumReader)
+	return checksum
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	n, err := c.ReadCloser.Read(p)
+	for _, digest := range c.digests {
+		digest.hash.Write(p[:n])
+	}
+
+	// The last byte read is held back in place of the one held before
+	if n > 0 {
+		last := p[n-1]
+		if c.hasPending {
+			copy(p[1:n], p[:n-1])
+			p[0] = c.pending
+		} else {
+			n--
+		}
+		c.pending, c.hasPending = last, true
+	}
+
+	if err != io.EOF {
+		return n, err
+	}
+
+	if !bodyDigestsMatch(c.digests) {
+		atomic.StoreInt32(&c.mismatched, 1)
+		if c.cancel != nil {
+			c.cancel()
+		}
+		return n, errBodyChecksumMismatch
+	}
+
+	if c.hasPending {
+		if n == len(p) {
+			// Sent by the next read
+			return n, nil
+		}
+		p[n] = c.pending
+		n++
+		c.hasPending = false
+	}
+	return n, io.EOF
+}
+
+// Mismatched reports whether the body did not match its checksum
+func (c *checksumReader) Mismatched() bool {
+	return atomic.LoadInt32(&c.mismatched) == 1
+}
@@ -0,0 +1,183 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func makeChecksumFunctionHandler(t *testing.T, annotations map[string]string, maxBufferBytes int64) (http.HandlerFunc, *testNotifier, *int64) {
+	var received int64
+	forwarding, _, notifier := makeFunctionProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		n, err := io.Copy(ioutil.Discard, r.Body)
+		if err != nil {
+			atomic.StoreInt64(&received, -1)
+			return
+		}
+		atomic.StoreInt64(&received, n)
+		w.WriteHeader(http.StatusOK)
+	}, time.Second*5)
+
+	handler := MakeBodyChecksumHandler(forwarding, fakeFunctionQuery{annotations: annotations}, maxBufferBytes, "openfaas-fn")
+	return handler, notifier, &received
+}
+
+func sha256Hex(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+func md5Base64(body string) string {
+	sum := md5.Sum([]byte(body))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func Test_BodyChecksum_VerifiesBufferedBody(t *testing.T) {
+	annotations := map[string]string{BodyChecksumAnnotation: "true"}
+	body := strings.Repeat("a", 512)
+
+	cases := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+		wantBytes  int64
+	}{
+		{name: "no checksum", wantStatus: http.StatusOK, wantBytes: 512},
+		{name: "matching SHA-256", header: BodySHA256Header, value: sha256Hex(body), wantStatus: http.StatusOK, wantBytes: 512},
+		{name: "matching MD5", header: "Content-MD5", value: md5Base64(body), wantStatus: http.StatusOK, wantBytes: 512},
+		{name: "mismatched SHA-256", header: BodySHA256Header, value: sha256Hex("b"), wantStatus: http.StatusBadRequest},
+		{name: "mismatched MD5", header: "Content-MD5", value: md5Base64("b"), wantStatus: http.StatusBadRequest},
+		{name: "invalid SHA-256", header: BodySHA256Header, value: "abc", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler, notifier, received := makeChecksumFunctionHandler(t, annotations, 1024)
+
+			req := httptest.NewRequest(http.MethodPost, "/function/upload", strings.NewReader(body))
+			if len(c.header) > 0 {
+				req.Header.Set(c.header, c.value)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != c.wantStatus {
+				t.Errorf("status want: %d, got: %d", c.wantStatus, rr.Code)
+			}
+			if c.wantStatus == http.StatusBadRequest && notifier.StatusReceived != 0 {
+				t.Errorf("want the request rejected before it was forwarded")
+			}
+			if got := atomic.LoadInt64(received); got != c.wantBytes {
+				t.Errorf("upstream want: %d bytes, got: %d", c.wantBytes, got)
+			}
+		})
+	}
+}
+
+func Test_BodyChecksum_IgnoredWithoutAnnotation(t *testing.T) {
+	handler, _, received := makeChecksumFunctionHandler(t, map[string]string{}, 1024)
+
+	req := httptest.NewRequest(http.MethodPost, "/function/upload", strings.NewReader("hello"))
+	req.Header.Set(BodySHA256Header, sha256Hex("goodbye"))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("status want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+	if got := atomic.LoadInt64(received); got != 5 {
+		t.Errorf("upstream want: %d bytes, got: %d", 5, got)
+	}
+}
+
+func Test_BodyChecksum_StreamsMatchingBody(t *testing.T) {
+	handler, _, received := makeChecksumFunctionHandler(t, map[string]string{BodyChecksumAnnotation: "true"}, 1024)
+
+	body := strings.Repeat("a", 64*1024)
+	req := httptest.NewRequest(http.MethodPost, "/function/upload", streamedBody{strings.NewReader(body)})
+	req.Header.Set(BodySHA256Header, sha256Hex(body))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("status want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+	if got := atomic.LoadInt64(received); got != int64(len(body)) {
+		t.Errorf("upstream want: %d bytes, got: %d", len(body), got)
+	}
+}
+
+func Test_BodyChecksum_AbortsStreamedMismatch(t *testing.T) {
+	handler, notifier, received := makeChecksumFunctionHandler(t, map[string]string{BodyChecksumAnnotation: "true"}, 1024)
+
+	body := strings.Repeat("a", 64*1024)
+	req := httptest.NewRequest(http.MethodPost, "/function/upload", streamedBody{strings.NewReader(body)})
+	req.Header.Set(BodySHA256Header, sha256Hex(body+"a"))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status want: %d, got: %d", http.StatusBadRequest, rr.Code)
+	}
+	if notifier.StatusReceived != http.StatusBadRequest {
+		t.Errorf("notifier status want: %d, got: %d", http.StatusBadRequest, notifier.StatusReceived)
+	}
+	if got := atomic.LoadInt64(received); got == int64(len(body)) {
+		t.Errorf("want the upstream not to receive the whole body")
+	}
+}
+
+func newTestChecksumReader(body, digestOf string) *checksumReader {
+	header := http.Header{}
+	header.Set(BodySHA256Header, sha256Hex(digestOf))
+	digests, _ := readBodyDigests(header)
+	return &checksumReader{ReadCloser: ioutil.NopCloser(strings.NewReader(body)), digests: digests}
+}
+
+func Test_checksumReader_HoldsBackLastByte(t *testing.T) {
+	body := "hello world"
+	checksum := newTestChecksumReader(body, body)
+	if len(checksum.digests) != 1 {
+		t.Fatalf("want a digest, got: %d", len(checksum.digests))
+	}
+
+	buf := make([]byte, len(body))
+	n, err := checksum.Read(buf)
+	if err != nil || n != len(body)-1 {
+		t.Fatalf("first read want: %d bytes, got: %d, %v", len(body)-1, n, err)
+	}
+
+	rest, err := ioutil.ReadAll(checksum)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+	if got := string(buf[:n]) + string(rest); got != body {
+		t.Errorf("body want: %q, got: %q", body, got)
+	}
+
+	checksum = newTestChecksumReader(body, "goodbye")
+
+	read, err := ioutil.ReadAll(checksum)
+	if err != errBodyChecksumMismatch {
+		t.Errorf("error want: %s, got: %v", errBodyChecksumMismatch, err)
+	}
+	if len(read) != len(body)-1 {
+		t.Errorf("want the last byte held back, read: %d bytes", len(read))
+	}
+	if !checksum.Mismatched() {
+		t.Errorf("want Mismatched")
+	}
+}
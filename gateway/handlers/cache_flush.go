@@ -0,0 +1,42 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// CacheFlusher is a cache which can be emptied at once
+type CacheFlusher interface {
+	// Flush removes every entry and returns how many were removed
+	Flush() int
+}
+
+// CacheFlushResult is the amount of entries evicted from each cache by name
+type CacheFlushResult struct {
+	Evicted map[string]int `json:"evicted"`
+}
+
+// MakeCacheFlushHandler empties each of the caches, i.e. after a broad
+// change to the provider's state. Every cache is flushed under its own lock
+// in turn, so lookups in flight are never blocked on more than one cache.
+func MakeCacheFlushHandler(caches map[string]CacheFlusher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		res := CacheFlushResult{Evicted: make(map[string]int, len(caches))}
+		for name, cache := range caches {
+			res.Evicted[name] = cache.Flush()
+		}
+		log.Printf("Cache flush: evicted %v\n", res.Evicted)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_MakeCacheFlushHandler_ReturnsEvictedCounts(t *testing.T) {
+	responses := NewResponseCache(10)
+	responses.Set("a", &CachedResponse{Status: http.StatusOK})
+	responses.Set("b", &CachedResponse{Status: http.StatusOK})
+
+	handler := MakeCacheFlushHandler(map[string]CacheFlusher{
+		"responses": responses,
+		"empty":     NewResponseCache(10),
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/system/cache/flush", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want: %d, got: %d", http.StatusOK, rec.Code)
+	}
+
+	res := CacheFlushResult{}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Evicted["responses"] != 2 || res.Evicted["empty"] != 0 || len(res.Evicted) != 2 {
+		t.Errorf("want 2 responses and 0 empty evicted, got: %v", res.Evicted)
+	}
+	if _, ok := responses.Get("a"); ok {
+		t.Errorf("want the response cache to be empty")
+	}
+}
+
+func Test_MakeCacheFlushHandler_RejectsGet(t *testing.T) {
+	handler := MakeCacheFlushHandler(map[string]CacheFlusher{})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/system/cache/flush", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("want: %d, got: %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
+
+func Test_MakeCacheFlushHandler_UnderLoad(t *testing.T) {
+	responses := NewResponseCache(100)
+	handler := MakeCacheFlushHandler(map[string]CacheFlusher{"responses": responses})
+
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := fmt.Sprintf("key-%d", i)
+				responses.Set(key, &CachedResponse{Status: http.StatusOK, Expires: time.Now().Add(time.Minute)})
+				responses.Get(key)
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/system/cache/flush", nil))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Errorf("want flushes to complete whilst lookups are in flight")
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,196 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// CircuitState is the state of a function's circuit breaker
+type CircuitState string
+
+const (
+	// CircuitClosed requests are forwarded to the function
+	CircuitClosed CircuitState = "closed"
+
+	// CircuitOpen requests are rejected without being forwarded
+	CircuitOpen CircuitState = "open"
+
+	// CircuitHalfOpen a single trial request is forwarded to the function
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitBreakerStatus is the externally visible state of a function's
+// circuit breaker
+type CircuitBreakerStatus struct {
+	Function            string       `json:"function"`
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	TotalFailures       uint64       `json:"totalFailures"`
+	LastStateChange     time.Time    `json:"lastStateChange"`
+}
+
+type circuit struct {
+	state               CircuitState
+	consecutiveFailures int
+	totalFailures       uint64
+	lastStateChange     time.Time
+	trialInFlight       bool
+}
+
+// CircuitBreaker tracks upstream failures per function and stops
+// forwarding requests to a function after FailureThreshold consecutive
+// failures. After OpenDuration a single trial request is let through
+// to decide whether to close the circuit again.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+
+	circuits map[string]*circuit
+	lock     sync.Mutex
+}
+
+// NewCircuitBreaker creates a CircuitBreaker
+func NewCircuitBreaker(failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		OpenDuration:     openDuration,
+		circuits:         make(map[string]*circuit),
+	}
+}
+
+// Allow returns true when a request may be forwarded to the function
+func (c *CircuitBreaker) Allow(function string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cb, ok := c.circuits[function]
+	if !ok {
+		return true
+	}
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.lastStateChange) < c.OpenDuration {
+			return false
+		}
+		cb.setState(CircuitHalfOpen)
+		cb.trialInFlight = true
+		return true
+	case CircuitHalfOpen:
+		if cb.trialInFlight {
+			return false
+		}
+		cb.trialInFlight = true
+		return true
+	}
+	return true
+}
+
+// Record records the outcome of a request forwarded to the function
+func (c *CircuitBreaker) Record(function string, success bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cb, ok := c.circuits[function]
+	if !ok {
+		if success {
+			return
+		}
+		cb = &circuit{state: CircuitClosed, lastStateChange: time.Now()}
+		c.circuits[function] = cb
+	}
+
+	cb.trialInFlight = false
+	if success {
+		cb.consecutiveFailures = 0
+		if cb.state != CircuitClosed {
+			cb.setState(CircuitClosed)
+		}
+		return
+	}
+
+	cb.consecutiveFailures++
+	cb.totalFailures++
+	if cb.state == CircuitHalfOpen ||
+		(cb.state == CircuitClosed && cb.consecutiveFailures >= c.FailureThreshold) {
+		cb.setState(CircuitOpen)
+		log.Printf("Circuit breaker: function=%s opened after %d consecutive failure(s)\n",
+			function, cb.consecutiveFailures)
+	}
+}
+
+// Status returns a snapshot of the circuit breaker for every function
+// that has seen a failure, sorted by function name
+func (c *CircuitBreaker) Status() []CircuitBreakerStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	status := make([]CircuitBreakerStatus, 0, len(c.circuits))
+	for function, cb := range c.circuits {
+		status = append(status, CircuitBreakerStatus{
+			Function:            function,
+			State:               cb.state,
+			ConsecutiveFailures: cb.consecutiveFailures,
+			TotalFailures:       cb.totalFailures,
+			LastStateChange:     cb.lastStateChange,
+		})
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Function < status[j].Function
+	})
+	return status
+}
+
+func (cb *circuit) setState(state CircuitState) {
+	cb.state = state
+	cb.lastStateChange = time.Now()
+}
+
+// MakeCircuitBreakerHandler rejects requests for a function with
+// http.StatusServiceUnavailable whilst its circuit is open. Any 5xx
+// status from next is counted as a failure.
+func MakeCircuitBreakerHandler(next http.HandlerFunc, breaker *CircuitBreaker, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+		key := fmt.Sprintf("%s.%s", functionName, namespace)
+
+		if !breaker.Allow(key) {
+			writeError(w, r, http.StatusServiceUnavailable, key, fmt.Sprintf("circuit open for function %s", key))
+			return
+		}
+
+		writer := httputil.NewHttpWriteInterceptor(w)
+		next(writer, r)
+
+		breaker.Record(key, writer.Status() < http.StatusInternalServerError)
+	}
+}
+
+// MakeCircuitBreakerStatusHandler returns the state of each function's
+// circuit breaker as JSON
+func MakeCircuitBreakerStatusHandler(breaker *CircuitBreaker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonOut, err := json.Marshal(breaker.Status())
+		if err != nil {
+			log.Printf("Error marshalling circuit breaker status: %s\n", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonOut)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_CircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	breaker := NewCircuitBreaker(2, time.Minute)
+
+	breaker.Record("figlet.openfaas-fn", false)
+	if !breaker.Allow("figlet.openfaas-fn") {
+		t.Fatalf("want circuit to be closed after a single failure")
+	}
+
+	breaker.Record("figlet.openfaas-fn", false)
+	if breaker.Allow("figlet.openfaas-fn") {
+		t.Fatalf("want circuit to be open after two failures")
+	}
+
+	status := breaker.Status()
+	if len(status) != 1 {
+		t.Fatalf("want 1 circuit, got %d", len(status))
+	}
+	if status[0].State != CircuitOpen {
+		t.Errorf("state want: %s, got: %s", CircuitOpen, status[0].State)
+	}
+	if status[0].TotalFailures != 2 {
+		t.Errorf("total failures want: %d, got: %d", 2, status[0].TotalFailures)
+	}
+}
+
+func Test_CircuitBreaker_HalfOpenClosesOnSuccess(t *testing.T) {
+	breaker := NewCircuitBreaker(1, time.Millisecond)
+
+	breaker.Record("figlet.openfaas-fn", false)
+	time.Sleep(time.Millisecond * 2)
+
+	if !breaker.Allow("figlet.openfaas-fn") {
+		t.Fatalf("want a trial request to be allowed after the open duration")
+	}
+	if breaker.Allow("figlet.openfaas-fn") {
+		t.Fatalf("want only one trial request whilst half-open")
+	}
+
+	breaker.Record("figlet.openfaas-fn", true)
+
+	status := breaker.Status()
+	if status[0].State != CircuitClosed {
+		t.Errorf("state want: %s, got: %s", CircuitClosed, status[0].State)
+	}
+}
+
+func Test_MakeCircuitBreakerHandler_RejectsWhenOpen(t *testing.T) {
+	breaker := NewCircuitBreaker(1, time.Minute)
+	calls := 0
+
+	handler := MakeCircuitBreakerHandler(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}, breaker, "openfaas-fn")
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+		handler.ServeHTTP(rec, req)
+	}
+
+	if calls != 1 {
+		t.Errorf("want upstream to be called once, got: %d", calls)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/system/circuit-breakers", nil)
+	MakeCircuitBreakerStatusHandler(breaker).ServeHTTP(rec, req)
+
+	status := []CircuitBreakerStatus{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 1 || status[0].Function != "figlet.openfaas-fn" {
+		t.Fatalf("want status for figlet.openfaas-fn, got: %v", status)
+	}
+}
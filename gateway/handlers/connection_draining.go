@@ -0,0 +1,60 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// MakeInFlightHandler counts the requests in-flight to each function with
+// the weight of their cost class, so that a DrainingFunctionCache can wait
+// for them to complete. The load shedding and slow start limits given the
+// same inFlight check this count rather than counting requests again.
+func MakeInFlightHandler(next http.HandlerFunc, inFlight *InFlightCounter, costWeights map[string]int64, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+		key := functionName + "." + namespace
+		weight := readCostWeight(r.Header.Get(CostClassHeader), costWeights)
+
+		inFlight.AcquireWeight(key, weight, 0)
+		defer inFlight.ReleaseWeight(key, weight)
+
+		counted := countedRequest{inFlight: inFlight, function: key, weight: weight}
+		next(w, r.WithContext(context.WithValue(r.Context(), countedKey{}, counted)))
+	}
+}
+
+// DrainingFunctionCache delays the eviction of a function, such as when it
+// is scaled to zero, until its in-flight requests have completed or Timeout
+// has passed. The caller of Delete is held for as long, so a scale to zero
+// is only sent to the provider once the function's replicas have drained.
+// A function which is still being sent requests may never drain, in which
+// case Delete waits the full Timeout.
+type DrainingFunctionCache struct {
+	scaling.FunctionCacher
+
+	InFlight *InFlightCounter
+	Timeout  time.Duration
+}
+
+// Delete evicts the function once it has drained
+func (d DrainingFunctionCache) Delete(functionName, namespace string) error {
+	key := functionName + "." + namespace
+
+	start := time.Now()
+	if !d.InFlight.WaitIdle(key, d.Timeout) {
+		log.Printf("Drain: function=%s still has %d request(s) in-flight after %s, evicting\n",
+			key, d.InFlight.InFlight(key), d.Timeout)
+	} else if waited := time.Since(start); waited >= time.Millisecond {
+		log.Printf("Drain: function=%s drained in %s\n", key, waited.Round(time.Millisecond))
+	}
+
+	return d.FunctionCacher.Delete(functionName, namespace)
+}
@@ -0,0 +1,116 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+func Test_InFlightCounter_WaitIdle(t *testing.T) {
+	c := NewInFlightCounter()
+	if !c.WaitIdle("figlet", time.Millisecond) {
+		t.Errorf("want an idle function not to wait")
+	}
+
+	c.Acquire("figlet", 0)
+	if c.WaitIdle("figlet", time.Millisecond*10) {
+		t.Errorf("want a timeout whilst a request is in-flight")
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		c.Release("figlet")
+	}()
+	if !c.WaitIdle("figlet", time.Second) {
+		t.Errorf("want the function to become idle once its request is released")
+	}
+}
+
+func Test_MakeForwardingProxyHandler_DrainsBeforeScaleToZero(t *testing.T) {
+	var scaledAt atomic.Value
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scaledAt.Store(time.Now())
+	}))
+	defer provider.Close()
+
+	providerURL, _ := url.Parse(provider.URL)
+	proxy := types.NewHTTPClientReverseProxy(providerURL, time.Second*5, 1, 1)
+
+	inFlight := NewInFlightCounter()
+	cache := scaling.NewFunctionCache(time.Minute)
+	cache.Set("figlet", "openfaas-fn", scaling.ServiceQueryResponse{Replicas: 1, AvailableReplicas: 1})
+
+	scaleHandler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: provider.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		DrainingFunctionCache{FunctionCacher: cache, InFlight: inFlight, Timeout: time.Second * 5})
+
+	// A request which is still running when the scale to zero arrives
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var completedAt time.Time
+	functionHandler := MakeInFlightHandler(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		completedAt = time.Now()
+	}, inFlight, nil, "openfaas-fn")
+
+	done := make(chan struct{})
+	go func() {
+		functionHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+		close(done)
+	}()
+	<-started
+
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		if _, hit := cache.Get("figlet", "openfaas-fn"); !hit {
+			t.Errorf("want the function cached whilst a request is in-flight")
+		}
+		close(release)
+	}()
+
+	body := `{"serviceName":"figlet","replicas":0}`
+	scaleHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/system/scale-function/figlet", strings.NewReader(body)))
+	<-done
+
+	if _, hit := cache.Get("figlet", "openfaas-fn"); hit {
+		t.Errorf("want the function evicted once drained")
+	}
+	at, _ := scaledAt.Load().(time.Time)
+	if at.IsZero() || at.Before(completedAt) {
+		t.Errorf("want the scale to zero sent after the in-flight request completed, sent: %s, completed: %s", at, completedAt)
+	}
+}
+
+func Test_DrainingFunctionCache_EvictsAfterTimeout(t *testing.T) {
+	inFlight := NewInFlightCounter()
+	inFlight.Acquire("figlet.openfaas-fn", 0)
+
+	cache := scaling.NewFunctionCache(time.Minute)
+	cache.Set("figlet", "openfaas-fn", scaling.ServiceQueryResponse{Replicas: 1})
+
+	draining := DrainingFunctionCache{FunctionCacher: cache, InFlight: inFlight, Timeout: time.Millisecond * 20}
+
+	start := time.Now()
+	draining.Delete("figlet", "openfaas-fn")
+	if waited := time.Since(start); waited < time.Millisecond*20 {
+		t.Errorf("want the eviction delayed by the timeout, waited: %s", waited)
+	}
+	if _, hit := cache.Get("figlet", "openfaas-fn"); hit {
+		t.Errorf("want the function evicted after the timeout")
+	}
+}
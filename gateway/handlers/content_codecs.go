@@ -0,0 +1,224 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentCodec converts a body of one content type to and from a tree of
+// map[string]interface{}, []interface{} and scalar values, so that a body
+// can be transformed between any two codecs
+type ContentCodec interface {
+	// ContentType is set on the bodies the codec encodes
+	ContentType() string
+
+	// Matches returns true for a Content-Type which the codec decodes
+	Matches(contentType string) bool
+
+	Decode(body []byte) (interface{}, error)
+	Encode(value interface{}) ([]byte, error)
+}
+
+// DefaultContentCodecs returns the codecs available to functions by name
+func DefaultContentCodecs() map[string]ContentCodec {
+	return map[string]ContentCodec{
+		"json": JSONCodec{},
+		"xml":  XMLCodec{Root: "root"},
+	}
+}
+
+// JSONCodec reads and writes application/json
+type JSONCodec struct{}
+
+// ContentType is application/json
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+// Matches application/json and +json types
+func (JSONCodec) Matches(contentType string) bool {
+	return isJSONContentType(contentType)
+}
+
+// Decode a JSON value, numbers are kept as json.Number
+func (JSONCodec) Decode(body []byte) (interface{}, error) {
+	return decodeJSON(body)
+}
+
+// Encode a value as JSON
+func (JSONCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+// XMLCodec reads and writes application/xml. Objects are elements named by
+// their keys, in order of the keys, and arrays are repeated elements, so an
+// array of one item reads back as the item alone. Scalars are written as
+// text and read back as strings. Attributes are read as keys prefixed by @.
+type XMLCodec struct {
+	// Root names the element which encloses an encoded value
+	Root string
+}
+
+// ContentType is application/xml
+func (XMLCodec) ContentType() string {
+	return "application/xml"
+}
+
+// Matches application/xml, text/xml and +xml types
+func (XMLCodec) Matches(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// Encode a value as an XML document with the Root element
+func (c XMLCodec) Encode(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := encodeXMLElement(&buf, c.Root, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeXMLElement(buf *bytes.Buffer, name string, value interface{}) error {
+	if !isXMLName(name) {
+		return fmt.Errorf("%q is not a valid XML element name", name)
+	}
+
+	// The items of an array are elements of the same name
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			if err := encodeXMLElement(buf, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	buf.WriteString("<" + name + ">")
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if err := encodeXMLElement(buf, key, v[key]); err != nil {
+				return err
+			}
+		}
+	case string:
+		xml.EscapeText(buf, []byte(v))
+	case json.Number:
+		buf.WriteString(v.String())
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	default:
+		return fmt.Errorf("unsupported value of type %T", value)
+	}
+	buf.WriteString("</" + name + ">")
+	return nil
+}
+
+// isXMLName returns true for the names which are written without escaping
+func isXMLName(name string) bool {
+	if len(name) == 0 || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		case i > 0 && (r == '-' || r == '.' || (r >= '0' && r <= '9')):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Decode an XML document, the root element is not part of the value
+func (XMLCodec) Decode(body []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no XML element found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return decodeXMLElement(decoder, start)
+		}
+	}
+}
+
+func decodeXMLElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	children := map[string]interface{}{}
+	for _, attr := range start.Attr {
+		children["@"+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	hasElements := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			hasElements = true
+			child, err := decodeXMLElement(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			addXMLChild(children, t.Name.Local, child)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if !hasElements && len(children) == 0 {
+				return strings.TrimSpace(text.String()), nil
+			}
+			if !hasElements {
+				if value := strings.TrimSpace(text.String()); len(value) > 0 {
+					children["#text"] = value
+				}
+			}
+			return children, nil
+		}
+	}
+}
+
+// addXMLChild adds a child element, repeated elements become an array
+func addXMLChild(children map[string]interface{}, name string, child interface{}) {
+	existing, ok := children[name]
+	if !ok {
+		children[name] = child
+		return
+	}
+	if items, ok := existing.([]interface{}); ok {
+		children[name] = append(items, child)
+		return
+	}
+	children[name] = []interface{}{existing, child}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// ContentTransformAnnotation names the content type clients use and the
+	// one the function uses, as client:function, i.e. "json:xml" for a
+	// function which only speaks XML to clients which speak JSON
+	ContentTransformAnnotation = "com.openfaas.content-transform"
+
+	// ContentTransformDirectionAnnotation is "request", "response" or
+	// "both" (default), the bodies which are transformed
+	ContentTransformDirectionAnnotation = "com.openfaas.content-transform.direction"
+)
+
+// MakeContentTransformHandler converts the request bodies of functions with
+// the com.openfaas.content-transform annotation from the client's content
+// type to the function's, and their responses back again, with the named
+// codecs. Bodies are buffered up to maxBodyBytes: a larger request is
+// rejected with 413, a larger response is passed on as it is. Bodies of
+// other content types are passed on as they are.
+func MakeContentTransformHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, codecs map[string]ContentCodec, maxBodyBytes int64, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+		function := functionName + "." + namespace
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil || len(strings.TrimSpace(annotations[ContentTransformAnnotation])) == 0 {
+			next(w, r)
+			return
+		}
+
+		client, upstream, err := parseContentTransform(annotations[ContentTransformAnnotation], codecs)
+		if err != nil {
+			log.Printf("Content transform: invalid annotation for %s: %s\n", function, err)
+			next(w, r)
+			return
+		}
+
+		direction := strings.TrimSpace(annotations[ContentTransformDirectionAnnotation])
+		transformRequest := direction != "response"
+		transformResponse := direction != "request"
+
+		if transformRequest && r.Body != nil && r.Body != http.NoBody && client.Matches(r.Header.Get("Content-Type")) {
+			if r.ContentLength > maxBodyBytes {
+				writeError(w, r, http.StatusRequestEntityTooLarge, function,
+					fmt.Sprintf("request body for function %s exceeds %d bytes and cannot be transformed", function, maxBodyBytes))
+				return
+			}
+
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+			r.Body.Close()
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, function,
+					fmt.Sprintf("unable to read the request body for function %s", function))
+				return
+			}
+			if int64(len(body)) > maxBodyBytes {
+				writeError(w, r, http.StatusRequestEntityTooLarge, function,
+					fmt.Sprintf("request body for function %s exceeds %d bytes and cannot be transformed", function, maxBodyBytes))
+				return
+			}
+
+			transformed, err := transformContent(body, client, upstream)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, function,
+					fmt.Sprintf("request body for function %s cannot be transformed: %s", function, err))
+				return
+			}
+
+			r.Body = ioutil.NopCloser(bytes.NewReader(transformed))
+			r.ContentLength = int64(len(transformed))
+			r.Header.Set("Content-Type", upstream.ContentType())
+			r.Header.Del("Content-Length")
+		}
+
+		if !transformResponse {
+			next(w, r)
+			return
+		}
+
+		if accept := r.Header.Get("Accept"); len(accept) > 0 && acceptQuality(accept, client.ContentType()) > 0 {
+			r.Header.Set("Accept", upstream.ContentType())
+		}
+
+		writer := &bufferedResponseWriter{
+			ResponseWriter:      w,
+			maxBodyBytes:        maxBodyBytes,
+			passThroughOverflow: true,
+			passThrough: func(header http.Header) bool {
+				return !upstream.Matches(header.Get("Content-Type"))
+			},
+		}
+		next(writer, r)
+
+		if writer.passingThrough {
+			return
+		}
+
+		body := writer.body.Bytes()
+		if len(bytes.TrimSpace(body)) > 0 {
+			transformed, err := transformContent(body, upstream, client)
+			if err != nil {
+				log.Printf("Content transform: unable to transform response for %s: %s\n", function, err)
+				writeError(w, r, http.StatusBadGateway, function,
+					fmt.Sprintf("response from function %s could not be transformed", function))
+				return
+			}
+			body = transformed
+			w.Header().Set("Content-Type", client.ContentType())
+		}
+
+		w.Header().Del("Content-Length")
+		w.WriteHeader(writer.Status())
+		w.Write(body)
+	}
+}
+
+// parseContentTransform returns the client's and the function's codecs
+func parseContentTransform(value string, codecs map[string]ContentCodec) (ContentCodec, ContentCodec, error) {
+	clientName, upstreamName, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok {
+		return nil, nil, fmt.Errorf("want client:function, got: %q", value)
+	}
+
+	client, ok := codecs[strings.TrimSpace(clientName)]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown content codec: %q", clientName)
+	}
+	upstream, ok := codecs[strings.TrimSpace(upstreamName)]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown content codec: %q", upstreamName)
+	}
+	return client, upstream, nil
+}
+
+func transformContent(body []byte, from, to ContentCodec) ([]byte, error) {
+	value, err := from.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+	return to.Encode(value)
+}
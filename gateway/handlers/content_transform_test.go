@@ -0,0 +1,145 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_XMLCodec_RoundTrip(t *testing.T) {
+	codecs := DefaultContentCodecs()
+	body := []byte(`{"customer":{"name":"Alex & Sam","tags":["a","b"]},"id":"12"}`)
+
+	xmlBody, err := transformContent(body, codecs["json"], codecs["xml"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantXML := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<root><customer><name>Alex &amp; Sam</name><tags>a</tags><tags>b</tags></customer><id>12</id></root>`
+	if string(xmlBody) != wantXML {
+		t.Errorf("XML want: %s, got: %s", wantXML, xmlBody)
+	}
+
+	jsonBody, err := transformContent(xmlBody, codecs["xml"], codecs["json"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	json.Unmarshal(jsonBody, &got)
+	json.Unmarshal(body, &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON want: %s, got: %s", body, jsonBody)
+	}
+}
+
+func Test_XMLCodec_RejectsInvalidNames(t *testing.T) {
+	if _, err := (XMLCodec{Root: "root"}).Encode(map[string]interface{}{"first name": "alex"}); err == nil {
+		t.Errorf("want an error for a key which is not an XML name")
+	}
+}
+
+func Test_MakeContentTransformHandler_RoundTrip(t *testing.T) {
+	functionQuery := fakeFunctionQuery{annotations: map[string]string{ContentTransformAnnotation: "json:xml"}}
+
+	var received, receivedType, receivedAccept string
+	handler := MakeContentTransformHandler(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received, receivedType, receivedAccept = string(body), r.Header.Get("Content-Type"), r.Header.Get("Accept")
+
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Header().Set("Content-Length", "58")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`<order status="new"><id>7</id><total>9.50</total></order>`))
+	}, functionQuery, DefaultContentCodecs(), 1024, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodPost, "/function/legacy", strings.NewReader(`{"sku":"abc"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<root><sku>abc</sku></root>`; received != want {
+		t.Errorf("request body want: %s, got: %s", want, received)
+	}
+	if receivedType != "application/xml" || receivedAccept != "application/xml" {
+		t.Errorf("function want XML, got Content-Type: %q, Accept: %q", receivedType, receivedAccept)
+	}
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("status want: %d, got: %d", http.StatusCreated, rr.Code)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type want: application/json, got: %q", got)
+	}
+	if want := `{"@status":"new","id":"7","total":"9.50"}`; rr.Body.String() != want {
+		t.Errorf("response body want: %s, got: %s", want, rr.Body.String())
+	}
+}
+
+func Test_MakeContentTransformHandler_SkipsOtherContent(t *testing.T) {
+	functionQuery := fakeFunctionQuery{annotations: map[string]string{ContentTransformAnnotation: "json:xml"}}
+
+	handler := MakeContentTransformHandler(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(body)
+	}, functionQuery, DefaultContentCodecs(), 1024, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodPost, "/function/legacy", strings.NewReader("hello"))
+	req.Header.Set("Content-Type", "text/plain")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Body.String() != "hello" {
+		t.Errorf("body want to be passed through: hello, got: %s", rr.Body.String())
+	}
+}
+
+func Test_MakeContentTransformHandler_BoundsBody(t *testing.T) {
+	functionQuery := fakeFunctionQuery{annotations: map[string]string{ContentTransformAnnotation: "json:xml"}}
+	large := `<root><data>` + strings.Repeat("x", 64) + `</data></root>`
+
+	handler := MakeContentTransformHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(large))
+	}, functionQuery, DefaultContentCodecs(), 32, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodPost, "/function/legacy", strings.NewReader(`{"data":"`+strings.Repeat("x", 64)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status for a large request want: %d, got: %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/legacy", nil))
+	if rr.Body.String() != large {
+		t.Errorf("a large response want to be passed through, got: %s", rr.Body.String())
+	}
+}
+
+func Test_MakeContentTransformHandler_RequestOnly(t *testing.T) {
+	functionQuery := fakeFunctionQuery{annotations: map[string]string{
+		ContentTransformAnnotation:          "json:xml",
+		ContentTransformDirectionAnnotation: "request",
+	}}
+
+	handler := MakeContentTransformHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<root><ok>true</ok></root>`))
+	}, functionQuery, DefaultContentCodecs(), 1024, "openfaas-fn")
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/legacy", nil))
+	if rr.Body.String() != `<root><ok>true</ok></root>` {
+		t.Errorf("response want not to be transformed, got: %s", rr.Body.String())
+	}
+}
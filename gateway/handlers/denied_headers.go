@@ -0,0 +1,25 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"log"
+	"net/http"
+)
+
+// MakeDeniedHeadersHandler removes gateway-controlled headers from incoming
+// requests so that any value seen by later middleware or forwarded upstream
+// was set by the gateway, rather than spoofed by the client.
+func MakeDeniedHeadersHandler(next http.HandlerFunc, headers []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, header := range headers {
+			if _, ok := r.Header[header]; ok {
+				log.Printf("Removing client-supplied %s header from request to %s\n", header, r.URL.Path)
+				r.Header.Del(header)
+			}
+		}
+
+		next(w, r)
+	}
+}
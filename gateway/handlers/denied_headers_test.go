@@ -0,0 +1,50 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+func Test_MakeDeniedHeadersHandler_RemovesSpoofedHeaders(t *testing.T) {
+	var gotTenant, gotRoles, gotOther string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTenant = r.Header.Get("X-Tenant-Id")
+		gotRoles = r.Header.Get("X-User-Roles")
+		gotOther = r.Header.Get("X-Request-Flag")
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second, 1, 1)
+
+	forwarding := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	handler := MakeDeniedHeadersHandler(forwarding, []string{"X-Tenant-Id", "X-User-Roles"})
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.Header.Set("X-Tenant-Id", "another-tenant")
+	req.Header.Add("X-User-Roles", "admin")
+	req.Header.Set("X-Request-Flag", "1")
+	handler(httptest.NewRecorder(), req)
+
+	if gotTenant != "" || gotRoles != "" {
+		t.Errorf("want spoofed headers to be removed, got tenant: %q, roles: %q", gotTenant, gotRoles)
+	}
+	if gotOther != "1" {
+		t.Errorf("want other headers to be forwarded, got: %q", gotOther)
+	}
+}
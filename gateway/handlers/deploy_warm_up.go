@@ -0,0 +1,101 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// DeployEvent is sent by a deployment pipeline after a function is deployed
+type DeployEvent struct {
+	Function    string `json:"function"`
+	Namespace   string `json:"namespace,omitempty"`
+	MinReplicas uint64 `json:"minReplicas,omitempty"`
+}
+
+// DeployWarmUpResult is the readiness of a function after a deploy event
+type DeployWarmUpResult struct {
+	Function          string `json:"function"`
+	Namespace         string `json:"namespace"`
+	Ready             bool   `json:"ready"`
+	Replicas          uint64 `json:"replicas"`
+	AvailableReplicas uint64 `json:"availableReplicas"`
+	Duration          string `json:"duration"`
+	Error             string `json:"error,omitempty"`
+}
+
+// MakeDeployWarmUpHandler consumes deploy events and scales the function to
+// at least minReplicas straight away, so that the first request after a
+// deployment doesn't wait for a cold start. The replica and annotation
+// caches are refreshed with the new deployment on the way. The response is
+// sent once the function is ready, or the scaler gives up.
+func MakeDeployWarmUpHandler(scaler scaling.FunctionScaler, functionQuery scaling.FunctionQuery, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var event DeployEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			http.Error(w, fmt.Sprintf("unable to parse deploy event: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		event.Function = strings.TrimSpace(event.Function)
+		if len(event.Function) == 0 {
+			http.Error(w, "function is required", http.StatusBadRequest)
+			return
+		}
+
+		namespace := event.Namespace
+		if len(namespace) == 0 {
+			namespace = defaultNamespace
+		}
+
+		// Replicas cached for a previous deployment would make the function
+		// look ready already
+		scaler.Cache.Delete(event.Function, namespace)
+
+		res := scaler.ScaleTo(event.Function, namespace, event.MinReplicas)
+
+		result := DeployWarmUpResult{
+			Function:  event.Function,
+			Namespace: namespace,
+			Ready:     res.Available,
+			Duration:  res.Duration.String(),
+		}
+		if cached, hit := scaler.Cache.Get(event.Function, namespace); hit {
+			result.Replicas = cached.Replicas
+			result.AvailableReplicas = cached.AvailableReplicas
+		}
+
+		status := http.StatusOK
+		switch {
+		case !res.Found:
+			status = http.StatusNotFound
+		case res.Error != nil:
+			status = http.StatusServiceUnavailable
+		default:
+			if _, err := functionQuery.GetAnnotations(event.Function, namespace); err != nil {
+				log.Printf("Deploy warm-up: unable to cache annotations for %s.%s: %s", event.Function, namespace, err)
+			}
+		}
+		if res.Error != nil {
+			result.Error = res.Error.Error()
+		}
+
+		log.Printf("Deploy warm-up: function=%s.%s ready=%v in %s", event.Function, namespace, result.Ready, result.Duration)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+type missingServiceQuery struct{}
+
+func (missingServiceQuery) GetReplicas(service, namespace string) (scaling.ServiceQueryResponse, error) {
+	return scaling.ServiceQueryResponse{}, fmt.Errorf("not found")
+}
+
+func (missingServiceQuery) SetReplicas(service, namespace string, count uint64) error {
+	return nil
+}
+
+func newDeployWarmUpScaler(query scaling.ServiceQuery) scaling.FunctionScaler {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         5,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Second,
+		ServiceQuery:         query,
+	}
+	return scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+}
+
+func Test_MakeDeployWarmUpHandler_ScalesToMinReplicas(t *testing.T) {
+	query := &coldServiceQuery{}
+	scaler := newDeployWarmUpScaler(query)
+	functionQuery := &countingFunctionQuery{}
+
+	handler := MakeDeployWarmUpHandler(scaler, functionQuery, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodPost, "/system/warm-up", strings.NewReader(`{"function":"echo","minReplicas":3}`))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if query.replicas != 3 {
+		t.Fatalf("want 3 replicas, got %d", query.replicas)
+	}
+
+	var res DeployWarmUpResult
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Ready || res.AvailableReplicas != 3 || res.Namespace != "openfaas-fn" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	if cached, hit := scaler.Cache.Get("echo", "openfaas-fn"); !hit || cached.AvailableReplicas != 3 {
+		t.Fatalf("want replicas cached, got %+v hit: %v", cached, hit)
+	}
+	if functionQuery.calls != 1 {
+		t.Fatalf("want annotations cached, got %d calls", functionQuery.calls)
+	}
+}
+
+func Test_MakeDeployWarmUpHandler_IgnoresStaleCache(t *testing.T) {
+	query := &coldServiceQuery{}
+	scaler := newDeployWarmUpScaler(query)
+	scaler.Cache.Set("echo", "dev", scaling.ServiceQueryResponse{Replicas: 1, AvailableReplicas: 1})
+
+	handler := MakeDeployWarmUpHandler(scaler, &fakeFunctionQuery{}, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodPost, "/system/warm-up", strings.NewReader(`{"function":"echo","namespace":"dev"}`))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if query.replicas != 1 {
+		t.Fatalf("want the function scaled from zero, got %d replicas", query.replicas)
+	}
+}
+
+func Test_MakeDeployWarmUpHandler_NotFound(t *testing.T) {
+	handler := MakeDeployWarmUpHandler(newDeployWarmUpScaler(missingServiceQuery{}), &fakeFunctionQuery{}, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodPost, "/system/warm-up", strings.NewReader(`{"function":"echo"}`))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("want status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	var res DeployWarmUpResult
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Ready || len(res.Error) == 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func Test_MakeDeployWarmUpHandler_RequiresFunction(t *testing.T) {
+	handler := MakeDeployWarmUpHandler(newDeployWarmUpScaler(&coldServiceQuery{}), &fakeFunctionQuery{}, "openfaas-fn")
+
+	for _, body := range []string{`{"namespace":"dev"}`, `{`} {
+		req := httptest.NewRequest(http.MethodPost, "/system/warm-up", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: want status %d, got %d", body, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
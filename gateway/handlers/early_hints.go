@@ -0,0 +1,61 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// EarlyHintsAnnotation set to "true" forwards 103 Early Hints responses
+// from a function to the client ahead of the final response, so that
+// browsers can start to preload the resources it links to
+const EarlyHintsAnnotation = "com.openfaas.early-hints"
+
+type earlyHintsKey struct{}
+
+// MakeEarlyHintsHandler enables forwarding of 103 Early Hints for functions
+// with the com.openfaas.early-hints annotation
+func MakeEarlyHintsHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil || strings.TrimSpace(annotations[EarlyHintsAnnotation]) != "true" {
+			next(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), earlyHintsKey{}, true)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// withEarlyHints returns a context which writes each 103 Early Hints
+// response received from the upstream to w when the function has opted-in.
+// The hints' headers remain set for the final response.
+func withEarlyHints(ctx context.Context, r *http.Request, w http.ResponseWriter) context.Context {
+	if enabled, _ := r.Context().Value(earlyHintsKey{}).(bool); !enabled {
+		return ctx
+	}
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code != http.StatusEarlyHints {
+				return nil
+			}
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(code)
+			return nil
+		},
+	})
+}
@@ -0,0 +1,94 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+func Test_MakeEarlyHintsHandler_ForwardsEarlyHints(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		wantHints   int
+	}{
+		{name: "opted-in", annotations: map[string]string{EarlyHintsAnnotation: "true"}, wantHints: 1},
+		{name: "not opted-in", annotations: map[string]string{}, wantHints: 0},
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("<html></html>"))
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			proxy := MakeForwardingProxyHandler(types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1),
+				[]HTTPNotifier{},
+				middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+				middleware.TransparentURLPathTransformer{},
+				nil,
+				nil)
+
+			gateway := httptest.NewServer(MakeEarlyHintsHandler(proxy, fakeFunctionQuery{annotations: c.annotations}, "openfaas-fn"))
+			defer gateway.Close()
+
+			var hints []textproto.MIMEHeader
+			trace := &httptrace.ClientTrace{
+				Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+					if code == http.StatusEarlyHints {
+						hints = append(hints, header)
+					}
+					return nil
+				},
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, gateway.URL+"/function/site", nil)
+			res, err := http.DefaultClient.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, _ := ioutil.ReadAll(res.Body)
+
+			if len(hints) != c.wantHints {
+				t.Fatalf("want %d early hints, got: %d", c.wantHints, len(hints))
+			}
+			if c.wantHints > 0 && hints[0].Get("Link") != "</style.css>; rel=preload; as=style" {
+				t.Errorf("want the Link header in the early hints, got: %v", hints[0])
+			}
+			if res.StatusCode != http.StatusOK || string(body) != "<html></html>" {
+				t.Errorf("want the final response after the hints, got: %d %q", res.StatusCode, string(body))
+			}
+		})
+	}
+}
+
+func Test_bufferedResponseWriter_PassesInformationalResponses(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writer := &bufferedResponseWriter{ResponseWriter: rec}
+
+	writer.WriteHeader(http.StatusEarlyHints)
+	writer.WriteHeader(http.StatusCreated)
+
+	if writer.Status() != http.StatusCreated {
+		t.Errorf("want the final status to be kept, got: %d", writer.Status())
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrorResponse is the body of an error written by the gateway when the
+// client accepts application/json. The fields are stable, function and
+// request_id are omitted when they are not known. elapsed and timeout are
+// only written for an upstream timeout of a function with the
+// com.openfaas.timeout.error-body annotation.
+type ErrorResponse struct {
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	Function  string `json:"function,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Elapsed   string `json:"elapsed,omitempty"`
+	Timeout   string `json:"timeout,omitempty"`
+}
+
+// Content types which an error can be written as, in order of preference
+// when the client accepts several of them equally
+var errorContentTypes = []string{"text/plain", "application/json", "text/html"}
+
+// writeError writes status with a body of message in the content type
+// negotiated from the Accept header: plain text, JSON or HTML. Plain text,
+// the message on its own, is written unless the client prefers another.
+// function is the name.namespace of the function, or empty.
+func writeError(w http.ResponseWriter, r *http.Request, status int, function string, message string) {
+	writeErrorResponse(w, r, ErrorResponse{
+		Code:     status,
+		Message:  message,
+		Function: function,
+	})
+}
+
+// writeErrorResponse writes body as writeError does, the request ID is
+// filled in when it is known
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, body ErrorResponse) {
+	status, message := body.Code, body.Message
+	if len(body.RequestID) == 0 {
+		body.RequestID = errorRequestID(w, r)
+	}
+
+	// The length of a response which was being copied no longer applies
+	w.Header().Del("Content-Length")
+
+	switch negotiateErrorContentType(r.Header.Get("Accept")) {
+	case "application/json":
+		out, _ := json.Marshal(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(out)
+	case "text/html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write([]byte(errorHTML(body)))
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write([]byte(message))
+	}
+}
+
+// errorRequestID returns the ID of the request from the response, when it
+// has been set already, or the request, in the header recorded by
+// MakeRequestIDHeaderHandler
+func errorRequestID(w http.ResponseWriter, r *http.Request) string {
+	return readRequestID(w.Header(), r, contextRequestIDHeader(r))
+}
+
+// negotiateErrorContentType returns the content type of errorContentTypes
+// with the highest quality in accept, text/plain when none is acceptable
+func negotiateErrorContentType(accept string) string {
+	best, bestQuality := errorContentTypes[0], 0.0
+	for _, contentType := range errorContentTypes {
+		if quality := acceptQuality(accept, contentType); quality > bestQuality {
+			best, bestQuality = contentType, quality
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q value given to contentType in accept by its
+// most specific matching range, or 0 when it is not matched
+func acceptQuality(accept string, contentType string) float64 {
+	mainType, _, _ := strings.Cut(contentType, "/")
+
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+
+		matched := -1
+		switch mediaRange {
+		case contentType:
+			matched = 2
+		case mainType + "/*":
+			matched = 1
+		case "*/*":
+			matched = 0
+		}
+		if matched <= specificity {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(strings.TrimSpace(name)) != "q" {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		quality, specificity = q, matched
+	}
+	return quality
+}
+
+func errorHTML(body ErrorResponse) string {
+	title := fmt.Sprintf("%d %s", body.Code, http.StatusText(body.Code))
+
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<head><title>")
+	sb.WriteString(html.EscapeString(title))
+	sb.WriteString("</title></head>\n<body>\n<h1>")
+	sb.WriteString(html.EscapeString(title))
+	sb.WriteString("</h1>\n<p>")
+	sb.WriteString(html.EscapeString(body.Message))
+	sb.WriteString("</p>\n")
+	if len(body.Function) > 0 {
+		sb.WriteString("<p>Function: ")
+		sb.WriteString(html.EscapeString(body.Function))
+		sb.WriteString("</p>\n")
+	}
+	if len(body.RequestID) > 0 {
+		sb.WriteString("<p>Request ID: ")
+		sb.WriteString(html.EscapeString(body.RequestID))
+		sb.WriteString("</p>\n")
+	}
+	sb.WriteString("</body>\n</html>\n")
+	return sb.String()
+}
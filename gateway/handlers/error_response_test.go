@@ -0,0 +1,149 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func writeTestError(accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	if len(accept) > 0 {
+		r.Header.Set("Accept", accept)
+	}
+	r.Header.Set("X-Call-Id", "call-1")
+
+	rr := httptest.NewRecorder()
+	writeError(rr, r, http.StatusServiceUnavailable, "figlet.openfaas-fn", "circuit open for function <figlet>")
+	return rr
+}
+
+func Test_WriteError_PlainTextByDefault(t *testing.T) {
+	for _, accept := range []string{"", "*/*", "text/plain", "text/*", "image/png"} {
+		rr := writeTestError(accept)
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("Accept %q: status want: %d, got: %d", accept, http.StatusServiceUnavailable, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+			t.Errorf("Accept %q: Content-Type want: text/plain, got: %q", accept, got)
+		}
+		if got := rr.Body.String(); got != "circuit open for function <figlet>" {
+			t.Errorf("Accept %q: body want the message, got: %q", accept, got)
+		}
+	}
+}
+
+func Test_WriteError_JSON(t *testing.T) {
+	rr := writeTestError("application/json")
+
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type want: application/json, got: %q", got)
+	}
+
+	body := ErrorResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unable to parse body %q: %s", rr.Body.String(), err)
+	}
+	want := ErrorResponse{
+		Code:      http.StatusServiceUnavailable,
+		Message:   "circuit open for function <figlet>",
+		Function:  "figlet.openfaas-fn",
+		RequestID: "call-1",
+	}
+	if body != want {
+		t.Errorf("body want: %+v, got: %+v", want, body)
+	}
+}
+
+func Test_WriteError_JSONOmitsUnknownFields(t *testing.T) {
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	r.Header.Set("Accept", "application/json")
+	writeError(rr, r, http.StatusBadGateway, "", "unable to reach the function")
+
+	want := `{"code":502,"message":"unable to reach the function"}`
+	if got := rr.Body.String(); got != want {
+		t.Errorf("body want: %s, got: %s", want, got)
+	}
+}
+
+func Test_WriteError_HTML(t *testing.T) {
+	rr := writeTestError("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+
+	if got := rr.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type want: text/html, got: %q", got)
+	}
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		"<title>503 Service Unavailable</title>",
+		"<p>circuit open for function &lt;figlet&gt;</p>",
+		"<p>Function: figlet.openfaas-fn</p>",
+		"<p>Request ID: call-1</p>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body want to contain %q, got: %q", want, body)
+		}
+	}
+}
+
+func Test_WriteError_QualityValues(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"application/json;q=0.5, text/html;q=0.9", "text/html"},
+		{"text/html;q=0.1, application/json", "application/json"},
+		{"text/plain;q=0.2, */*;q=0.5", "application/json"},
+		{"application/json;q=0, text/*", "text/plain"},
+		{"application/json, text/html", "application/json"},
+		{"APPLICATION/JSON", "application/json"},
+	}
+
+	for _, c := range cases {
+		if got := negotiateErrorContentType(c.accept); got != c.want {
+			t.Errorf("Accept %q: want: %s, got: %s", c.accept, c.want, got)
+		}
+	}
+}
+
+func Test_WriteError_RequestIDFromResponse(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set(DefaultRequestIDHeader, "request-1")
+
+	r := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("X-Call-Id", "call-1")
+	writeError(rr, r, http.StatusBadGateway, "figlet", "unable to reach the function")
+
+	body := ErrorResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.RequestID != "request-1" {
+		t.Errorf("request_id want: request-1, got: %q", body.RequestID)
+	}
+}
+
+func Test_WriteError_RequestIDFromConfiguredHeader(t *testing.T) {
+	var body ErrorResponse
+	handler := MakeRequestIDHeaderHandler(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusBadGateway, "figlet", "unable to reach the function")
+	}, "x-correlation-id")
+
+	r := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set(DefaultRequestIDHeader, "request-1")
+	r.Header.Set("X-Correlation-Id", "correlation-1")
+	rr := httptest.NewRecorder()
+	handler(rr, r)
+
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.RequestID != "correlation-1" {
+		t.Errorf("request_id want: correlation-1, got: %q", body.RequestID)
+	}
+}
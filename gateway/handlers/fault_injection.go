@@ -0,0 +1,116 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// FaultDelayAnnotation is a duration added to requests before they are
+	// forwarded to the function, i.e. "2s"
+	FaultDelayAnnotation = "com.openfaas.fault.delay"
+
+	// FaultDelayPercentAnnotation is the percentage of requests which are
+	// delayed, default 100
+	FaultDelayPercentAnnotation = "com.openfaas.fault.delay-percent"
+
+	// FaultAbortAnnotation is a status returned in place of forwarding
+	// requests to the function, i.e. "503"
+	FaultAbortAnnotation = "com.openfaas.fault.abort"
+
+	// FaultAbortPercentAnnotation is the percentage of requests which are
+	// aborted, default 100
+	FaultAbortPercentAnnotation = "com.openfaas.fault.abort-percent"
+)
+
+// faultRule is a fault read from a function's annotations
+type faultRule struct {
+	delay        time.Duration
+	delayPercent float64
+	abort        int
+	abortPercent float64
+}
+
+// MakeFaultInjectionHandler delays or aborts a percentage of the requests to
+// functions with the com.openfaas.fault annotations, for resilience testing.
+// A delayed request may also be aborted, in the same way as Istio's HTTP
+// fault injection. It must only be installed when fault injection has been
+// enabled explicitly.
+func MakeFaultInjectionHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		rule := readFaultRule(annotations)
+
+		if rule.delay > 0 && rand.Float64()*100 < rule.delayPercent {
+			log.Printf("Fault injection: function=%s.%s delayed %s\n", functionName, namespace, rule.delay)
+
+			timer := time.NewTimer(rule.delay)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		if rule.abort > 0 && rand.Float64()*100 < rule.abortPercent {
+			log.Printf("Fault injection: function=%s.%s aborted with %d\n", functionName, namespace, rule.abort)
+
+			writeError(w, r, rule.abort, functionName+"."+namespace,
+				fmt.Sprintf("fault injected for function %s.%s", functionName, namespace))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// readFaultRule reads the fault annotations, invalid values disable the
+// fault they belong to
+func readFaultRule(annotations map[string]string) faultRule {
+	rule := faultRule{}
+
+	if delay, err := time.ParseDuration(strings.TrimSpace(annotations[FaultDelayAnnotation])); err == nil && delay > 0 {
+		rule.delay = delay
+		rule.delayPercent = readFaultPercent(annotations, FaultDelayPercentAnnotation)
+	}
+
+	if status, err := strconv.Atoi(strings.TrimSpace(annotations[FaultAbortAnnotation])); err == nil &&
+		status >= http.StatusBadRequest && status <= 599 {
+		rule.abort = status
+		rule.abortPercent = readFaultPercent(annotations, FaultAbortPercentAnnotation)
+	}
+
+	return rule
+}
+
+func readFaultPercent(annotations map[string]string, name string) float64 {
+	value, ok := annotations[name]
+	if !ok {
+		return 100
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || percent < 0 {
+		return 0
+	}
+	return percent
+}
@@ -0,0 +1,145 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_FaultInjection_NoRules(t *testing.T) {
+	called := false
+	handler := MakeFaultInjectionHandler(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}, fakeFunctionQuery{annotations: map[string]string{}}, "openfaas-fn")
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if !called {
+		t.Errorf("want request forwarded")
+	}
+}
+
+func Test_FaultInjection_Delay(t *testing.T) {
+	called := false
+	handler := MakeFaultInjectionHandler(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}, fakeFunctionQuery{annotations: map[string]string{
+		FaultDelayAnnotation: "50ms",
+	}}, "openfaas-fn")
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if elapsed := time.Since(start); elapsed < time.Millisecond*50 {
+		t.Errorf("want a delay of at least 50ms, got %s", elapsed)
+	}
+	if !called {
+		t.Errorf("want the delayed request forwarded")
+	}
+}
+
+func Test_FaultInjection_DelayStopsWhenClientCancels(t *testing.T) {
+	called := false
+	handler := MakeFaultInjectionHandler(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}, fakeFunctionQuery{annotations: map[string]string{
+		FaultDelayAnnotation: "10s",
+	}}, "openfaas-fn")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	start := time.Now()
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil).WithContext(ctx))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("want the delay to stop when the client cancels, took %s", elapsed)
+	}
+	if called {
+		t.Errorf("want the request not forwarded")
+	}
+}
+
+func Test_FaultInjection_Abort(t *testing.T) {
+	called := false
+	handler := MakeFaultInjectionHandler(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}, fakeFunctionQuery{annotations: map[string]string{
+		FaultAbortAnnotation: "503",
+	}}, "openfaas-fn")
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status want: %d, got: %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if called {
+		t.Errorf("want the aborted request not forwarded")
+	}
+}
+
+func Test_FaultInjection_ZeroPercentNeverApplied(t *testing.T) {
+	called := 0
+	handler := MakeFaultInjectionHandler(func(w http.ResponseWriter, r *http.Request) {
+		called++
+	}, fakeFunctionQuery{annotations: map[string]string{
+		FaultDelayAnnotation:        "10s",
+		FaultDelayPercentAnnotation: "0",
+		FaultAbortAnnotation:        "503",
+		FaultAbortPercentAnnotation: "0",
+	}}, "openfaas-fn")
+
+	for i := 0; i < 100; i++ {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status want: %d, got: %d", http.StatusOK, rr.Code)
+		}
+	}
+	if called != 100 {
+		t.Errorf("want every request forwarded, got %d", called)
+	}
+}
+
+func Test_readFaultRule(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        faultRule
+	}{
+		{
+			name:        "delay for a percentage",
+			annotations: map[string]string{FaultDelayAnnotation: "2s", FaultDelayPercentAnnotation: "10"},
+			want:        faultRule{delay: time.Second * 2, delayPercent: 10},
+		},
+		{
+			name:        "abort for every request",
+			annotations: map[string]string{FaultAbortAnnotation: "503"},
+			want:        faultRule{abort: http.StatusServiceUnavailable, abortPercent: 100},
+		},
+		{
+			name:        "invalid status",
+			annotations: map[string]string{FaultAbortAnnotation: "200"},
+			want:        faultRule{},
+		},
+		{
+			name:        "invalid percentage",
+			annotations: map[string]string{FaultAbortAnnotation: "500", FaultAbortPercentAnnotation: "ten"},
+			want:        faultRule{abort: http.StatusInternalServerError, abortPercent: 0},
+		},
+	}
+
+	for _, c := range cases {
+		if got := readFaultRule(c.annotations); got != c.want {
+			t.Errorf("%s want: %+v, got: %+v", c.name, c.want, got)
+		}
+	}
+}
@@ -7,16 +7,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	provider_types "github.com/openfaas/faas-provider/types"
 	"github.com/openfaas/faas/gateway/pkg/middleware"
 	"github.com/openfaas/faas/gateway/requests"
 	"github.com/openfaas/faas/gateway/scaling"
@@ -41,6 +47,16 @@ func MakeForwardingProxyHandler(proxy *types.HTTPClientReverseProxy,
 		originalURL := r.URL.String()
 		requestURL := urlPathTransformer.Transform(r)
 
+		// A peer region's gateway is sent the path it would receive from
+		// the client, and the region the request was failed over from
+		failover, failingOver := middleware.GetFailover(r.Context())
+		if failingOver {
+			baseURL = strings.TrimSuffix(failover.URL, "/")
+			requestURL = r.URL.Path
+			r = r.Clone(r.Context())
+			r.Header.Set(middleware.FailoverHopHeader, failover.Region)
+		}
+
 		for _, notifier := range notifiers {
 			notifier.Notify(r.Method, requestURL, originalURL, http.StatusProcessing, "started", time.Second*0)
 		}
@@ -60,28 +76,42 @@ func MakeForwardingProxyHandler(proxy *types.HTTPClientReverseProxy,
 				}
 				// Create a copy of the request body and add it to the request
 				r.Body = ioutil.NopCloser(bytes.NewReader(body))
-			} else if r.Method == http.MethodPost && strings.HasPrefix(requestURL, "/system/scale-function/") {
+			} else if rule, ok := proxy.MatchScaleRule(r.Method, requestURL); ok {
 				defer r.Body.Close()
 				body, _ := ioutil.ReadAll(r.Body)
-				req := provider_types.ScaleServiceRequest{}
-				err := json.Unmarshal(body, &req)
-				// Delete the function from the funcCache using the default namespace
+				req, err := readScaleRequest(body, rule, requestURL, r.URL.Query(), scaleNamespace(proxy))
 				log.Println("Receieved a scale function request")
 				if err == nil && req.Replicas == 0 {
 					log.Println("Deleting from Cache")
-					funcCache.Delete(req.ServiceName, "openfaas-fn")
+					funcCache.Delete(req.ServiceName, req.Namespace)
+				}
+				if err == nil && req.Replicas > 0 {
+					body = clampScaleRequest(body, req, rule, funcCache, proxy)
 				}
 				// Create a copy of the request body and add it to the request
 				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+				r.ContentLength = int64(len(body))
 
 			}
 		}
 
+		authInjector := proxy.AuthInjector(r, serviceAuthInjector)
+		if failingOver {
+			authInjector = failover.Auth
+		} else {
+			r = proxy.WithServerName(r)
+		}
 		start := time.Now()
 
-		statusCode, err := forwardRequest(w, r, proxy.Client, baseURL, requestURL, proxy.Timeout, writeRequestURI, serviceAuthInjector)
+		statusCode, err := forwardRequest(w, r, proxy, baseURL, requestURL, writeRequestURI, authInjector)
 
 		seconds := time.Since(start)
+		if timings := middleware.GetRequestTimings(r.Context()); timings != nil {
+			timings.Upstream = seconds
+		}
+		if reporter, ok := baseURLResolver.(middleware.EndpointReporter); ok && !failingOver {
+			reporter.Report(r, baseURL, statusCode, seconds)
+		}
 		if err != nil {
 			log.Printf("error with upstream request to: %s, %s\n", requestURL, err.Error())
 		}
@@ -92,7 +122,137 @@ func MakeForwardingProxyHandler(proxy *types.HTTPClientReverseProxy,
 	}
 }
 
-func buildUpstreamRequest(r *http.Request, baseURL string, requestURL string) *http.Request {
+// scaleNamespace is the namespace of scale requests without one
+func scaleNamespace(proxy *types.HTTPClientReverseProxy) string {
+	if len(proxy.FunctionNamespace) > 0 {
+		return proxy.FunctionNamespace
+	}
+	return "openfaas-fn"
+}
+
+// readScaleRequest reads the function and replicas of a request matched by
+// rule. The function is the body's serviceName, or the path after the rule's
+// prefix, and is in the body's namespace, or the namespace query parameter,
+// otherwise defaultNamespace.
+func readScaleRequest(body []byte, rule types.ScaleRule, path string, query url.Values, defaultNamespace string) (scaleRequest, error) {
+	req := scaleRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return req, err
+	}
+
+	value, ok := scaleReplicaField(body, rule.ReplicaField)
+	if !ok {
+		return req, fmt.Errorf("no %s field in the scale request", rule.ReplicaField)
+	}
+	if err := json.Unmarshal(value, &req.Replicas); err != nil {
+		return req, err
+	}
+
+	if len(req.ServiceName) == 0 {
+		name := strings.TrimPrefix(path, rule.PathPrefix)
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i]
+		}
+		req.ServiceName = name
+	}
+	if len(req.ServiceName) == 0 {
+		return req, fmt.Errorf("no function in the scale request")
+	}
+
+	if len(req.Namespace) == 0 {
+		req.Namespace = query.Get("namespace")
+	}
+	if len(req.Namespace) == 0 {
+		req.Namespace = defaultNamespace
+	}
+	return req, nil
+}
+
+// scaleReplicaField returns the value of a dotted field of a JSON object
+func scaleReplicaField(body []byte, field string) (json.RawMessage, bool) {
+	value := json.RawMessage(body)
+	for _, name := range strings.Split(field, ".") {
+		fields := map[string]json.RawMessage{}
+		if err := json.Unmarshal(value, &fields); err != nil {
+			return nil, false
+		}
+		if value = fields[name]; value == nil {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// setScaleReplicaField returns body with a dotted field of a JSON object
+// replaced by value, the other fields are kept as they are
+func setScaleReplicaField(body []byte, field string, value json.RawMessage) ([]byte, error) {
+	name, rest, nested := strings.Cut(field, ".")
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+
+	if nested {
+		child, err := setScaleReplicaField(fields[name], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		value = child
+	}
+	fields[name] = value
+	return json.Marshal(fields)
+}
+
+// clampScaleRequest keeps the replicas requested for a function within the
+// minimum and maximum replicas cached for it, so that every provider behaves
+// the same. A function which is not cached is clamped to the replicas from
+// the FunctionReplicas of proxy. Scaling to zero is left alone, as is a
+// function whose replicas cannot be found. The body is returned with only
+// the rule's replica field changed.
+func clampScaleRequest(body []byte, req scaleRequest, rule types.ScaleRule, funcCache scaling.FunctionCacher, proxy *types.HTTPClientReverseProxy) []byte {
+	var minReplicas, maxReplicas uint64
+	if cached, hit := funcCache.Get(req.ServiceName, req.Namespace); hit {
+		minReplicas, maxReplicas = cached.MinReplicas, cached.MaxReplicas
+	} else if proxy.FunctionReplicas != nil {
+		var ok bool
+		if minReplicas, maxReplicas, ok = proxy.FunctionReplicas(req.ServiceName, req.Namespace); !ok {
+			return body
+		}
+	} else {
+		return body
+	}
+
+	replicas := req.Replicas
+	if minReplicas > 0 && replicas < minReplicas {
+		replicas = minReplicas
+	}
+	if maxReplicas > 0 && replicas > maxReplicas {
+		replicas = maxReplicas
+	}
+	if replicas == req.Replicas {
+		return body
+	}
+
+	log.Printf("Scale request for %s.%s clamped from %d to %d replicas (min: %d, max: %d)\n",
+		req.ServiceName, req.Namespace, req.Replicas, replicas, minReplicas, maxReplicas)
+
+	clamped, err := setScaleReplicaField(body, rule.ReplicaField, json.RawMessage(strconv.FormatUint(replicas, 10)))
+	if err != nil {
+		return body
+	}
+	return clamped
+}
+
+// buildUpstreamRequest copies the client's request without hop-by-hop
+// headers, including those named by the Connection header, the
+// ContextHeaders of proxy are copied even when they would be stripped and its
+// RestrictedHeaders are removed. The request is always given a request ID in
+// the RequestIDHeader of proxy and a traceparent header, new traces are
+// sampled at its TraceSampleRate, and its body is limited to any budget set
+// for the function. proxy may be nil for requests which are not sent to
+// functions, which are given the defaults.
+func buildUpstreamRequest(r *http.Request, baseURL string, requestURL string, proxy *types.HTTPClientReverseProxy) *http.Request {
 	url := baseURL + requestURL
 
 	if len(r.URL.RawQuery) > 0 {
@@ -102,7 +262,20 @@ func buildUpstreamRequest(r *http.Request, baseURL string, requestURL string) *h
 	upstreamReq, _ := http.NewRequest(r.Method, url, nil)
 
 	copyHeaders(upstreamReq.Header, &r.Header)
+	deleteConnectionHeaders(upstreamReq.Header)
 	deleteHeaders(&upstreamReq.Header, &hopHeaders)
+	var requestIDHeader string
+	var traceSampleRate float64
+	if proxy != nil {
+		for _, header := range proxy.ContextHeaders {
+			if values, ok := r.Header[header]; ok {
+				upstreamReq.Header[header] = values
+			}
+		}
+		proxy.RestrictHeaders(r, upstreamReq.Header)
+		requestIDHeader, traceSampleRate = proxy.RequestIDHeader, proxy.TraceSampleRate
+	}
+	setRequestIDs(upstreamReq.Header, requestIDHeader, traceSampleRate)
 
 	if len(r.Host) > 0 && upstreamReq.Header.Get("X-Forwarded-Host") == "" {
 		upstreamReq.Header["X-Forwarded-Host"] = []string{r.Host}
@@ -113,42 +286,188 @@ func buildUpstreamRequest(r *http.Request, baseURL string, requestURL string) *h
 	}
 
 	if r.Body != nil {
-		upstreamReq.Body = r.Body
+		upstreamReq.Body = newBudgetReader(r, r.Body)
 	}
 
 	return upstreamReq
 }
 
-func forwardRequest(w http.ResponseWriter,
-	r *http.Request,
-	proxyClient *http.Client,
-	baseURL string,
-	requestURL string,
-	timeout time.Duration,
-	writeRequestURI bool,
-	serviceAuthInjector middleware.AuthInjector) (int, error) {
+// setRawRequestURI sends the upstream request with the URI exactly as the
+// client sent it, after the path of baseURL, in place of the transformed
+// path. The path and query are written as they were received, so that
+// encodings such as %2F, or those which would otherwise be normalised, reach
+// the function unchanged.
+func setRawRequestURI(r *http.Request, baseURL string, upstreamReq *http.Request) {
+	rawURI := r.RequestURI
+	if !strings.HasPrefix(rawURI, "/") {
+		// Not received by a server, or in absolute-form
+		rawURI = r.URL.RequestURI()
+	}
+
+	var basePath string
+	if base, err := url.Parse(baseURL); err == nil {
+		basePath = strings.TrimSuffix(base.EscapedPath(), "/")
+	}
+
+	path, query, hasQuery := strings.Cut(rawURI, "?")
+	if strings.HasPrefix(basePath+path, "//") {
+		// Would be read as a host by the client, so the path is kept
+		return
+	}
+
+	upstreamReq.URL.Opaque = basePath + path
+	upstreamReq.URL.RawQuery = query
+	upstreamReq.URL.ForceQuery = hasQuery && len(query) == 0
+}
+
+// setExplicitEmptyBody sends a request without a body, or with an empty
+// one, to the upstream as an explicit zero-length body with Content-Length: 0
+// for the methods which expect a body: POST, PUT and PATCH. Other methods
+// are sent without a body or a Content-Length. Without this an empty body
+// which replaced the client's, such as by a middleware, is sent chunked.
+// A body of unknown length, which the client sent chunked, is left alone.
+func setExplicitEmptyBody(r *http.Request, upstreamReq *http.Request) {
+	if r.Body != nil && r.Body != http.NoBody {
+		if r.ContentLength != 0 {
+			return
+		}
+
+		// A body replaced without setting its length is checked for content
+		peek := make([]byte, 1)
+		if n, _ := io.ReadFull(r.Body, peek); n > 0 {
+			r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(peek), r.Body), Closer: r.Body}
+			upstreamReq.Body = newBudgetReader(r, r.Body)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		upstreamReq.Body = http.NoBody
+	default:
+		upstreamReq.Body = nil
+	}
+	upstreamReq.ContentLength = 0
+}
+
+// readCloser reads from Reader and closes Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// forwardRequest sends r to baseURL and requestURL with the settings of
+// proxy and copies the response to w, returning its status
+func forwardRequest(w http.ResponseWriter, r *http.Request, proxy *types.HTTPClientReverseProxy, baseURL string, requestURL string, writeRequestURI bool, serviceAuthInjector middleware.AuthInjector) (int, error) {
 	proxy_start := time.Now()
 
-	upstreamReq := buildUpstreamRequest(r, baseURL, requestURL)
+	upstreamReq := buildUpstreamRequest(r, baseURL, requestURL, proxy)
+	if proxy.RawRequestURI(r) {
+		setRawRequestURI(r, baseURL, upstreamReq)
+	}
+	if proxy.ExplicitEmptyBody {
+		setExplicitEmptyBody(r, upstreamReq)
+	}
 	if upstreamReq.Body != nil {
 		defer upstreamReq.Body.Close()
 	}
+	proxy.RewriteUserAgent(upstreamReq.Header)
 
 	if serviceAuthInjector != nil {
 		serviceAuthInjector.Inject(upstreamReq)
 	}
 
+	requestIDHeader := proxy.RequestIDHeader
+	if len(requestIDHeader) == 0 {
+		requestIDHeader = DefaultRequestIDHeader
+	}
+	function := middleware.GetServiceName(r.URL.String())
+	timeout := proxy.RequestTimeout(r)
+
+	if !setTimeBudgetHeader(r, upstreamReq.Header) {
+		proxy.ReportTimeout(w.Header(), r)
+		writeError(w, r, http.StatusGatewayTimeout, function, "time budget exhausted before the request was sent")
+		return http.StatusGatewayTimeout, context.DeadlineExceeded
+	}
+
 	if writeRequestURI {
 		log.Printf("forwardRequest: %s %s\n", upstreamReq.Host, upstreamReq.URL.String())
 	}
 
+	budget, _ := upstreamReq.Body.(*budgetReader)
+	checksum := getChecksumReader(r)
+
+	var body *timedBody
+	if upstreamReq.Body != nil && upstreamReq.Body != http.NoBody {
+		body = &timedBody{ReadCloser: upstreamReq.Body}
+		upstreamReq.Body = body
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), timeout)
 	defer cancel()
+	if budget != nil {
+		budget.cancel = cancel
+	}
+	if checksum != nil {
+		checksum.cancel = cancel
+	}
+
+	// The connection and first byte are timed for RequestTimings
+	timings := middleware.GetRequestTimings(r.Context())
+	var connection *connectionTimer
+	if timings != nil {
+		connection = &connectionTimer{}
+		ctx = httptrace.WithClientTrace(ctx, connection.Trace())
+	}
 
-	res, resErr := proxyClient.Do(upstreamReq.WithContext(ctx))
+	sent := time.Now()
+	upstreamReq = upstreamReq.WithContext(withEarlyHints(ctx, r, w))
+	res, resErr := proxy.Client.Do(upstreamReq)
+	if resErr == nil {
+		res, resErr = followRedirects(upstreamReq.Context(), r, proxy.Client, upstreamReq, res)
+	}
+	responded := time.Now()
+	if connection != nil {
+		connection.Record(timings, responded)
+	}
 	if resErr != nil {
+		w.Header().Set(requestIDHeader, upstreamReq.Header.Get(requestIDHeader))
+
+		if errors.Is(resErr, errRedirectLoop) {
+			writeError(w, r, http.StatusLoopDetected, function, resErr.Error())
+			return http.StatusLoopDetected, resErr
+		}
+		if budget != nil && budget.Exceeded() {
+			writeError(w, r, http.StatusRequestEntityTooLarge, function, errRequestBudgetExceeded.Error())
+			return http.StatusRequestEntityTooLarge, resErr
+		}
+		if checksum != nil && checksum.Mismatched() {
+			writeError(w, r, http.StatusBadRequest, function, errBodyChecksumMismatch.Error())
+			return http.StatusBadRequest, resErr
+		}
+		if timeBudgetExhausted(r.Context()) {
+			proxy.ReportTimeout(w.Header(), r)
+			writeError(w, r, http.StatusGatewayTimeout, function, "time budget exhausted waiting for the function")
+			return http.StatusGatewayTimeout, resErr
+		}
+		if ctx.Err() == context.DeadlineExceeded && r.Context().Err() == nil {
+			proxy.ReportTimeout(w.Header(), r)
+			writeTimeoutError(w, r, time.Since(proxy_start), timeout)
+			return http.StatusGatewayTimeout, resErr
+		}
+
+		// A connection which could not be established within the dial
+		// timeout is reported as a timeout, but without waiting the full
+		// upstream timeout
+		var netErr net.Error
+		if errors.As(resErr, &netErr) && netErr.Timeout() {
+			proxy.ReportTimeout(w.Header(), r)
+			writeError(w, r, http.StatusGatewayTimeout, function, "timed out connecting to the function")
+			return http.StatusGatewayTimeout, resErr
+		}
+
 		badStatus := http.StatusBadGateway
-		w.WriteHeader(badStatus)
+		writeError(w, r, badStatus, function, "unable to reach the function")
 		return badStatus, resErr
 	}
 
@@ -156,23 +475,219 @@ func forwardRequest(w http.ResponseWriter,
 		defer res.Body.Close()
 	}
 
+	// The Transport does not reuse a connection which the upstream asked to
+	// close, it is only reported so that such functions can be found
+	if res.Close {
+		proxy.ReportConnectionClose(r)
+	}
+
+	if dropped := proxy.LimitResponseHeaders(res.Header); dropped > 0 {
+		log.Printf("forwardRequest: dropped %d response header(s) from %s over the limit\n", dropped, upstreamReq.URL.Path)
+	}
 	copyHeaders(w.Header(), &res.Header)
+	proxy.RewriteServerHeader(w.Header())
+	if len(w.Header().Get(requestIDHeader)) == 0 {
+		w.Header().Set(requestIDHeader, upstreamReq.Header.Get(requestIDHeader))
+	}
+
+	// The body is sent until it is read to the end, unless the upstream
+	// responded before reading all of it
+	bodySent := sent
+	if body != nil {
+		bodySent = responded
+		if read := body.ReadAt(); !read.IsZero() && read.Before(responded) {
+			bodySent = read
+		}
+	}
+	proxy.ReportTimings(w.Header(), r, bodySent.Sub(sent), responded.Sub(bodySent))
 	proxy_end := time.Now()
 
 	// Add  start and end to the header with the gateway prefix
 	w.Header().Add("X-Gateway-Start", proxy_start.Format(time.RFC3339Nano))
 	w.Header().Add("X-Gateway-End", proxy_end.Format(time.RFC3339Nano))
+
+	var resBody io.Reader = res.Body
+	var stalled *chunkTimeoutReader
+	if res.Body != nil && proxy.ChunkTimeout > 0 {
+		stalled = newChunkTimeoutReader(res.Body, proxy.ChunkTimeout, cancel)
+		defer stalled.Stop()
+		resBody = stalled
+	}
+
+	// Small responses are read in full so that they are written at once
+	// with a Content-Length, anything larger is streamed after the part
+	// which was read. A failed read is reported by the stream below. Chatty
+	// responses of an unknown length are left to the flush interval.
+	var buffered []byte
+	if res.Body != nil && (proxy.FlushInterval == 0 || res.ContentLength >= 0) && bufferResponse(r, res, proxy.ResponseBufferBytes) {
+		var err error
+		buffered, err = io.ReadAll(io.LimitReader(resBody, proxy.ResponseBufferBytes+1))
+		if err == nil && int64(len(buffered)) <= proxy.ResponseBufferBytes {
+			w.Header().Set("Content-Length", strconv.Itoa(len(buffered)))
+			w.WriteHeader(res.StatusCode)
+			if _, err := w.Write(buffered); err != nil {
+				return StatusClientClosedRequest, fmt.Errorf("client disconnected: %s", err)
+			}
+			return res.StatusCode, nil
+		}
+	}
+
 	// Write status code
 	w.WriteHeader(res.StatusCode)
 
 	if res.Body != nil {
-		// Copy the body over
-		io.CopyBuffer(w, res.Body, nil)
+		if len(buffered) > 0 {
+			resBody = io.MultiReader(bytes.NewReader(buffered), resBody)
+		}
+
+		var dst io.Writer = w
+		var flushing *flushIntervalWriter
+		if flusher, ok := w.(http.Flusher); ok && proxy.FlushInterval > 0 {
+			flushing = &flushIntervalWriter{w: w, flusher: flusher, interval: proxy.FlushInterval}
+			dst = flushing
+		}
+
+		// Copy the body over, a failed write means the client went away and
+		// returning cancels the upstream request and closes its body.
+		writer := &clientWriter{w: dst}
+		_, err := io.CopyBuffer(writer, resBody, nil)
+		if flushing != nil {
+			flushing.Stop()
+		}
+		if err != nil {
+			if writer.err != nil || r.Context().Err() != nil {
+				return StatusClientClosedRequest, fmt.Errorf("client disconnected: %s", err)
+			}
+
+			// The upstream responded before the body was read to the end,
+			// so the status has already been sent
+			if budget != nil && budget.Exceeded() {
+				return http.StatusRequestEntityTooLarge, errRequestBudgetExceeded
+			}
+			if checksum != nil && checksum.Mismatched() {
+				return http.StatusBadRequest, errBodyChecksumMismatch
+			}
+
+			// Both timeouts truncate the response, which is marked as
+			// such for functions which have opted-in
+			if stalled != nil && stalled.TimedOut() {
+				proxy.ReportTimeout(nil, r)
+				writeTruncationMarker(w, r)
+				return http.StatusGatewayTimeout, fmt.Errorf("no data from upstream for %s, stream aborted", proxy.ChunkTimeout)
+			}
+			if ctx.Err() == context.DeadlineExceeded {
+				proxy.ReportTimeout(nil, r)
+				writeTruncationMarker(w, r)
+				return http.StatusGatewayTimeout, fmt.Errorf("upstream timeout of %s reached, stream aborted", timeout)
+			}
+			return res.StatusCode, fmt.Errorf("error reading response body: %s", err)
+		}
 	}
 
 	return res.StatusCode, nil
 }
 
+// connectionTimer times getting a connection to the upstream and waiting for
+// the first byte of its response. The dial may still be running when a
+// request times out, so the times are only read under the lock.
+type connectionTimer struct {
+	lock      sync.Mutex
+	getConn   time.Time
+	gotConn   time.Time
+	firstByte time.Time
+}
+
+// Trace records the first connection and response of a request
+func (c *connectionTimer) Trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			if c.getConn.IsZero() {
+				c.getConn = time.Now()
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			if c.gotConn.IsZero() {
+				c.gotConn = time.Now()
+			}
+		},
+		GotFirstResponseByte: func() {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			if c.firstByte.IsZero() {
+				c.firstByte = time.Now()
+			}
+		},
+	}
+}
+
+// Record sets the Connect and FirstByte timings, a phase which had not
+// completed by end, such as when the request timed out, lasted until end
+func (c *connectionTimer) Record(timings *middleware.RequestTimings, end time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.getConn.IsZero() {
+		return
+	}
+	if c.gotConn.IsZero() {
+		timings.Connect = end.Sub(c.getConn)
+		return
+	}
+	timings.Connect = c.gotConn.Sub(c.getConn)
+
+	if c.firstByte.IsZero() {
+		timings.FirstByte = end.Sub(c.gotConn)
+		return
+	}
+	timings.FirstByte = c.firstByte.Sub(c.gotConn)
+}
+
+// StatusClientClosedRequest is reported to notifiers when the client
+// disconnects before the response has been written
+const StatusClientClosedRequest = 499
+
+// clientWriter records errors writing to the client so that they can be
+// told apart from errors reading the upstream response
+type clientWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (c *clientWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// timedBody records when a request body has been read to the end by the
+// transport, the time is only taken once so that the copy is not slowed
+type timedBody struct {
+	io.ReadCloser
+	read int64
+}
+
+func (t *timedBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if err != nil {
+		atomic.CompareAndSwapInt64(&t.read, 0, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// ReadAt returns when the body was read to the end, or the zero time
+func (t *timedBody) ReadAt() time.Time {
+	if read := atomic.LoadInt64(&t.read); read != 0 {
+		return time.Unix(0, read)
+	}
+	return time.Time{}
+}
+
 func copyHeaders(destination http.Header, source *http.Header) {
 	for k, v := range *source {
 		vClone := make([]string, len(v))
@@ -187,6 +702,18 @@ func deleteHeaders(target *http.Header, exclude *[]string) {
 	}
 }
 
+// deleteConnectionHeaders removes the headers named by the Connection
+// header, which are hop-by-hop as of RFC 7230, section 6.1
+func deleteConnectionHeaders(header http.Header) {
+	for _, value := range header["Connection"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				header.Del(name)
+			}
+		}
+	}
+}
+
 // Hop-by-hop headers. These are removed when sent to the backend.
 // As of RFC 7230, hop-by-hop headers are required to appear in the
 // Connection header field. These are the headers defined by the
@@ -204,3 +731,111 @@ var hopHeaders = []string{
 	"Transfer-Encoding",
 	"Upgrade",
 }
+
+// chunkTimeoutReader cancels the upstream request when a single Read blocks
+// for longer than timeout. Time spent writing to the client is not counted
+// so that slow but steady streams are not aborted.
+type chunkTimeoutReader struct {
+	r        io.Reader
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut int32
+}
+
+func newChunkTimeoutReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *chunkTimeoutReader {
+	c := &chunkTimeoutReader{r: r, timeout: timeout}
+	c.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&c.timedOut, 1)
+		cancel()
+	})
+	c.timer.Stop()
+	return c
+}
+
+func (c *chunkTimeoutReader) Read(p []byte) (int, error) {
+	c.timer.Reset(c.timeout)
+	n, err := c.r.Read(p)
+	c.timer.Stop()
+	return n, err
+}
+
+// TimedOut reports whether the upstream request was cancelled by the timeout
+func (c *chunkTimeoutReader) TimedOut() bool {
+	return atomic.LoadInt32(&c.timedOut) == 1
+}
+
+// Stop releases the timer
+func (c *chunkTimeoutReader) Stop() {
+	c.timer.Stop()
+}
+
+// flushIntervalWriter flushes data written to the client within interval,
+// a flush is only scheduled once data is written, so that a response which
+// completes within the interval is not flushed early.
+type flushIntervalWriter struct {
+	w        io.Writer
+	flusher  http.Flusher
+	interval time.Duration
+
+	lock    sync.Mutex
+	timer   *time.Timer
+	pending bool
+	stopped bool
+}
+
+func (f *flushIntervalWriter) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	n, err := f.w.Write(p)
+	if err != nil || f.pending {
+		return n, err
+	}
+
+	f.pending = true
+	if f.timer == nil {
+		f.timer = time.AfterFunc(f.interval, f.flush)
+	} else {
+		f.timer.Reset(f.interval)
+	}
+	return n, err
+}
+
+func (f *flushIntervalWriter) flush() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if !f.pending || f.stopped {
+		return
+	}
+	f.flusher.Flush()
+	f.pending = false
+}
+
+// Stop cancels any pending flush, the client must not be written to by the
+// writer afterwards
+func (f *flushIntervalWriter) Stop() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.stopped = true
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+}
+
+// bufferResponse reports whether a response may be read in full before it is
+// written. Responses known to be larger than maxBytes, event streams and
+// responses without a body are always streamed.
+func bufferResponse(r *http.Request, res *http.Response, maxBytes int64) bool {
+	if maxBytes <= 0 || r.Method == http.MethodHead || res.Body == http.NoBody {
+		return false
+	}
+	if res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified {
+		return false
+	}
+	if res.ContentLength > maxBytes {
+		return false
+	}
+	return !strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream")
+}
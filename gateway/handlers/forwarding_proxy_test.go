@@ -5,13 +5,25 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/openfaas/faas-provider/auth"
 	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/types"
 )
 
 func Test_buildUpstreamRequest_Body_Method_Query(t *testing.T) {
@@ -26,7 +38,7 @@ func Test_buildUpstreamRequest_Body_Method_Query(t *testing.T) {
 		t.Fail()
 	}
 
-	upstream := buildUpstreamRequest(request, "/", "")
+	upstream := buildUpstreamRequest(request, "/", "", nil)
 
 	if request.Method != upstream.Method {
 		t.Errorf("Method - want: %s, got: %s", request.Method, upstream.Method)
@@ -55,7 +67,7 @@ func Test_buildUpstreamRequest_Body_Method_Query(t *testing.T) {
 func Test_buildUpstreamRequest_NoBody_GetMethod_NoQuery(t *testing.T) {
 	request, _ := http.NewRequest(http.MethodGet, "/", nil)
 
-	upstream := buildUpstreamRequest(request, "/", "")
+	upstream := buildUpstreamRequest(request, "/", "", nil)
 
 	if request.Method != upstream.Method {
 		t.Errorf("Method - want: %s, got: %s", request.Method, upstream.Method)
@@ -84,7 +96,7 @@ func Test_buildUpstreamRequest_HasXForwardedHostHeaderWhenSet(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	upstream := buildUpstreamRequest(request, "/", "/")
+	upstream := buildUpstreamRequest(request, "/", "/", nil)
 
 	if request.Host != upstream.Header.Get("X-Forwarded-Host") {
 		t.Errorf("Host - want: %s, got: %s", request.Host, upstream.Header.Get("X-Forwarded-Host"))
@@ -101,7 +113,7 @@ func Test_buildUpstreamRequest_XForwardedHostHeader_Empty_WhenNotSet(t *testing.
 		t.Fatal(err)
 	}
 
-	upstream := buildUpstreamRequest(request, "/", "/")
+	upstream := buildUpstreamRequest(request, "/", "/", nil)
 
 	if request.Host != upstream.Header.Get("X-Forwarded-Host") {
 		t.Errorf("Host - want: %s, got: %s", request.Host, upstream.Header.Get("X-Forwarded-Host"))
@@ -119,13 +131,106 @@ func Test_buildUpstreamRequest_XForwardedHostHeader_WhenAlreadyPresent(t *testin
 	}
 
 	request.Header.Set("X-Forwarded-Host", headerValue)
-	upstream := buildUpstreamRequest(request, "/", "/")
+	upstream := buildUpstreamRequest(request, "/", "/", nil)
 
 	if upstream.Header.Get("X-Forwarded-Host") != headerValue {
 		t.Errorf("X-Forwarded-Host - want: %s, got: %s", headerValue, upstream.Header.Get("X-Forwarded-Host"))
 	}
 }
 
+func Test_buildUpstreamRequest_KeepsContextHeaders(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/function/test", nil)
+	request.Header.Set("X-Locale", "en-GB")
+	request.Header.Set("Upgrade", "h2c")
+	request.Header.Set("Keep-Alive", "timeout=5")
+
+	upstream := buildUpstreamRequest(request, "/", "/", &types.HTTPClientReverseProxy{ContextHeaders: []string{"X-Locale", "Upgrade"}})
+
+	if got := upstream.Header.Get("X-Locale"); got != "en-GB" {
+		t.Errorf("X-Locale want: %s, got: %s", "en-GB", got)
+	}
+	if got := upstream.Header.Get("Upgrade"); got != "h2c" {
+		t.Errorf("Upgrade is a context header, want: %s, got: %s", "h2c", got)
+	}
+	if got := upstream.Header.Get("Keep-Alive"); got != "" {
+		t.Errorf("Keep-Alive want stripped, got: %s", got)
+	}
+}
+
+func Test_buildUpstreamRequest_RestrictedHeaders(t *testing.T) {
+	proxy := &types.HTTPClientReverseProxy{
+		RestrictedHeaders: map[string][]string{"X-Internal-Token": {"billing", "auth.internal"}},
+		FunctionNamespace: "openfaas-fn",
+	}
+
+	scenarios := []struct {
+		path string
+		want string
+	}{
+		{path: "/function/billing", want: "secret"},
+		{path: "/function/billing.openfaas-fn/invoices", want: "secret"},
+		{path: "/function/auth.internal", want: "secret"},
+		{path: "/function/auth", want: ""},
+		{path: "/function/figlet", want: ""},
+		{path: "/function/billing.dev", want: ""},
+		{path: "/system/functions", want: ""},
+	}
+
+	for _, s := range scenarios {
+		request, _ := http.NewRequest(http.MethodGet, s.path, nil)
+		request.Header.Set("X-Internal-Token", "secret")
+		request.Header.Set("X-Locale", "en-GB")
+
+		upstream := buildUpstreamRequest(request, "/", s.path, proxy)
+
+		if got := upstream.Header.Get("X-Internal-Token"); got != s.want {
+			t.Errorf("%s: X-Internal-Token want: %q, got: %q", s.path, s.want, got)
+		}
+		if got := upstream.Header.Get("X-Locale"); got != "en-GB" {
+			t.Errorf("%s: X-Locale is not restricted, want: %s, got: %s", s.path, "en-GB", got)
+		}
+	}
+}
+
+func Test_buildUpstreamRequest_RestrictedContextHeader(t *testing.T) {
+	proxy := &types.HTTPClientReverseProxy{
+		RestrictedHeaders: map[string][]string{"X-Tenant": {"billing"}},
+		FunctionNamespace: "openfaas-fn",
+		ContextHeaders:    []string{"X-Tenant"},
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, "/function/figlet", nil)
+	request.Header.Set("X-Tenant", "acme")
+
+	upstream := buildUpstreamRequest(request, "/", "/", proxy)
+	if got := upstream.Header.Get("X-Tenant"); got != "" {
+		t.Errorf("want a restricted context header to be stripped for an untrusted function, got: %q", got)
+	}
+}
+
+func Test_buildUpstreamRequest_StripsConnectionHeaders(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/function/test", nil)
+	request.Header.Add("Connection", "x-custom-hop, X-Other-Hop")
+	request.Header.Add("Connection", "close")
+	request.Header.Set("X-Custom-Hop", "1")
+	request.Header.Set("X-Other-Hop", "2")
+	request.Header.Set("X-End-To-End", "3")
+
+	upstream := buildUpstreamRequest(request, "/", "/", nil)
+
+	for _, header := range []string{"Connection", "X-Custom-Hop", "X-Other-Hop"} {
+		if got := upstream.Header.Get(header); got != "" {
+			t.Errorf("%s want stripped, got: %s", header, got)
+		}
+	}
+	if got := upstream.Header.Get("X-End-To-End"); got != "3" {
+		t.Errorf("X-End-To-End want: %s, got: %s", "3", got)
+	}
+	if got := request.Header.Get("X-Custom-Hop"); got != "1" {
+		t.Errorf("want the client's request unchanged, got: %s", got)
+	}
+}
+
 func Test_getServiceName(t *testing.T) {
 	scenarios := []struct {
 		name        string
@@ -205,7 +310,7 @@ func Test_buildUpstreamRequest_WithPathNoQuery(t *testing.T) {
 		t.Errorf("transformedPath want: %s, got %s", wantTransformedPath, transformedPath)
 	}
 
-	upstream := buildUpstreamRequest(request, "http://xyz:8080", transformedPath)
+	upstream := buildUpstreamRequest(request, "http://xyz:8080", transformedPath, nil)
 
 	if request.Method != upstream.Method {
 		t.Errorf("Method - want: %s, got: %s", request.Method, upstream.Method)
@@ -261,7 +366,7 @@ func Test_buildUpstreamRequest_WithNoPathNoQuery(t *testing.T) {
 		t.Errorf("transformedPath want: %s, got %s", wantTransformedPath, transformedPath)
 	}
 
-	upstream := buildUpstreamRequest(request, "http://xyz:8080", transformedPath)
+	upstream := buildUpstreamRequest(request, "http://xyz:8080", transformedPath, nil)
 
 	if request.Method != upstream.Method {
 		t.Errorf("Method - want: %s, got: %s", request.Method, upstream.Method)
@@ -315,7 +420,7 @@ func Test_buildUpstreamRequest_WithPathAndQuery(t *testing.T) {
 		t.Errorf("transformedPath want: %s, got %s", wantTransformedPath, transformedPath)
 	}
 
-	upstream := buildUpstreamRequest(request, "http://xyz:8080", transformedPath)
+	upstream := buildUpstreamRequest(request, "http://xyz:8080", transformedPath, nil)
 
 	if request.Method != upstream.Method {
 		t.Errorf("Method - want: %s, got: %s", request.Method, upstream.Method)
@@ -364,3 +469,1170 @@ func Test_deleteHeaders(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// disconnectedWriter fails writes as if the client had gone away
+type disconnectedWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (d disconnectedWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("write: broken pipe")
+}
+
+func Test_MakeForwardingProxyHandler_ClientDisconnect(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("hello world"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second, 1, 1)
+	notifier := &testNotifier{}
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{notifier},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	handler.ServeHTTP(disconnectedWriter{httptest.NewRecorder()}, req)
+
+	if notifier.StatusReceived != StatusClientClosedRequest {
+		t.Errorf("notifier status want: %d, got: %d", StatusClientClosedRequest, notifier.StatusReceived)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ChunkTimeout(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("first chunk"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+	proxy.ChunkTimeout = time.Millisecond * 50
+	notifier := &testNotifier{}
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{notifier},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("want stalled stream to be aborted early, took: %s", took)
+	}
+	if notifier.StatusReceived != http.StatusGatewayTimeout {
+		t.Errorf("notifier status want: %d, got: %d", http.StatusGatewayTimeout, notifier.StatusReceived)
+	}
+	if rr.Body.String() != "first chunk" {
+		t.Errorf("want first chunk to be written, got: %q", rr.Body.String())
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ChunkTimeoutAllowsSteadyStream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("."))
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond * 20)
+		}
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+	proxy.ChunkTimeout = time.Millisecond * 80
+	notifier := &testNotifier{}
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{notifier},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if notifier.StatusReceived != http.StatusOK {
+		t.Errorf("notifier status want: %d, got: %d", http.StatusOK, notifier.StatusReceived)
+	}
+	if rr.Body.String() != "....." {
+		t.Errorf("want full stream, got: %q", rr.Body.String())
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ServerHeader(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "Werkzeug/2.0.1 Python/3.9.5")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	cases := []struct {
+		name         string
+		serverHeader string
+		strip        bool
+		want         string
+	}{
+		{name: "untouched by default", want: "Werkzeug/2.0.1 Python/3.9.5"},
+		{name: "rewritten", serverHeader: "openfaas", want: "openfaas"},
+		{name: "stripped", strip: true, want: ""},
+	}
+
+	for _, c := range cases {
+		proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second, 1, 1)
+		proxy.ServerHeader = c.serverHeader
+		proxy.StripServerHeader = c.strip
+
+		handler := MakeForwardingProxyHandler(proxy,
+			[]HTTPNotifier{},
+			middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+			middleware.TransparentURLPathTransformer{},
+			nil,
+			nil)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+		if got := rr.Header().Get("Server"); got != c.want {
+			t.Errorf("%s want: %q, got: %q", c.name, c.want, got)
+		}
+	}
+}
+
+func Test_MakeForwardingProxyHandler_VersionHeader(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	for _, want := range []string{"", "0.26.2"} {
+		proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second, 1, 1)
+		proxy.VersionHeader = want
+
+		handler := MakeForwardingProxyHandler(proxy,
+			[]HTTPNotifier{},
+			middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+			middleware.TransparentURLPathTransformer{},
+			nil,
+			nil)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+		if got := rr.Header().Get("X-Gateway-Version"); got != want {
+			t.Errorf("X-Gateway-Version want: %q, got: %q", want, got)
+		}
+	}
+}
+
+func Test_MakeForwardingProxyHandler_UserAgent(t *testing.T) {
+	var gotUserAgent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserAgent = r.Header.Get("User-Agent")
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	cases := []struct {
+		name      string
+		userAgent string
+		append    bool
+		want      string
+	}{
+		{name: "client's by default", want: "curl/7.79.1"},
+		{name: "overridden", userAgent: "openfaas-gateway/1.2", want: "openfaas-gateway/1.2"},
+		{name: "appended", userAgent: "openfaas-gateway/1.2", append: true, want: "curl/7.79.1 openfaas-gateway/1.2"},
+	}
+
+	for _, c := range cases {
+		proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second, 1, 1)
+		proxy.UserAgent = c.userAgent
+		proxy.AppendUserAgent = c.append
+
+		handler := MakeForwardingProxyHandler(proxy,
+			[]HTTPNotifier{},
+			middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+			middleware.TransparentURLPathTransformer{},
+			nil,
+			nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+		req.Header.Set("User-Agent", "curl/7.79.1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if gotUserAgent != c.want {
+			t.Errorf("%s want: %q, got: %q", c.name, c.want, gotUserAgent)
+		}
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ExcessiveResponseHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 5000; i++ {
+			w.Header().Add(fmt.Sprintf("X-Bomb-%d", i), "boom")
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	cases := []struct {
+		name      string
+		maxCount  int
+		maxBytes  int
+		wantBombs int
+	}{
+		{name: "count limit", maxCount: 100, wantBombs: 100},
+		{name: "size limit", maxBytes: 200, wantBombs: 14},
+	}
+
+	for _, c := range cases {
+		proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+		proxy.MaxResponseHeaders = c.maxCount
+		proxy.MaxResponseHeaderBytes = c.maxBytes
+		proxy.MarkTruncatedHeaders = true
+
+		handler := MakeForwardingProxyHandler(proxy,
+			[]HTTPNotifier{},
+			middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+			middleware.TransparentURLPathTransformer{},
+			nil,
+			nil)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/bomb", nil))
+
+		if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+			t.Errorf("%s want the response to be delivered, got: %d %q", c.name, rr.Code, rr.Body.String())
+		}
+
+		bombs := 0
+		for name := range rr.Header() {
+			if strings.HasPrefix(name, "X-Bomb-") {
+				bombs++
+			}
+		}
+		if bombs > c.wantBombs {
+			t.Errorf("%s want at most %d headers copied, got: %d", c.name, c.wantBombs, bombs)
+		}
+		if got := rr.Header().Get("X-Headers-Truncated"); got != "true" {
+			t.Errorf("%s want X-Headers-Truncated: true, got: %q", c.name, got)
+		}
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ClientTimeoutHeader(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+	proxy.ClientTimeoutHeader = "X-Client-Timeout-Ms"
+	notifier := &testNotifier{}
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{notifier},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/function/slow", nil)
+	req.Header.Set("X-Client-Timeout-Ms", "50")
+
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("want the client's deadline to be honoured, took: %s", took)
+	}
+	if notifier.StatusReceived != http.StatusGatewayTimeout {
+		t.Errorf("notifier status want: %d, got: %d", http.StatusGatewayTimeout, notifier.StatusReceived)
+	}
+}
+
+type flushCountingWriter struct {
+	header  http.Header
+	lock    sync.Mutex
+	flushes int
+}
+
+func (f *flushCountingWriter) Header() http.Header {
+	return f.header
+}
+
+func (f *flushCountingWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (f *flushCountingWriter) WriteHeader(int) {}
+
+func (f *flushCountingWriter) Flush() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.flushes++
+}
+
+func (f *flushCountingWriter) Flushes() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.flushes
+}
+
+func Test_MakeForwardingProxyHandler_FlushInterval(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/function/small" {
+			w.Write([]byte("small"))
+			return
+		}
+
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+	proxy.FlushInterval = time.Millisecond * 10
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	small := &flushCountingWriter{header: http.Header{}}
+	handler.ServeHTTP(small, httptest.NewRequest(http.MethodGet, "/function/small", nil))
+	if got := small.Flushes(); got != 0 {
+		t.Errorf("want no flush for a small response, got: %d", got)
+	}
+
+	chatty := &flushCountingWriter{header: http.Header{}}
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(chatty, httptest.NewRequest(http.MethodGet, "/function/chatty", nil))
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for chatty.Flushes() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 5)
+	}
+	close(release)
+	<-done
+
+	if chatty.Flushes() == 0 {
+		t.Errorf("want the first chunk to be flushed whilst the upstream is busy")
+	}
+}
+
+func Test_MakeForwardingProxyHandler_DialTimeoutIsGatewayTimeout(t *testing.T) {
+	upstreamURL, _ := url.Parse("http://dead-host:8080")
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+	proxy.Client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}
+		},
+	}}
+	notifier := &testNotifier{}
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{notifier},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstreamURL.String()},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("status want: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+	if notifier.StatusReceived != http.StatusGatewayTimeout {
+		t.Errorf("notifier status want: %d, got: %d", http.StatusGatewayTimeout, notifier.StatusReceived)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ContextHeadersRoundTrip(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Feature-Flags", r.Header.Get("X-Feature-Flags")+",beta")
+		for i := 0; i < 10; i++ {
+			w.Header().Set(fmt.Sprintf("X-Bomb-%d", i), "x")
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+	proxy.MaxResponseHeaders = 2
+	proxy.ContextHeaders = []string{"X-Feature-Flags"}
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/function/flags", nil)
+	req.Header.Set("X-Feature-Flags", "dark-mode")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("X-Feature-Flags"); got != "dark-mode,beta" {
+		t.Errorf("want the context header to propagate back over the header limit, got: %q", got)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ReportsBodyAndUpstreamTimings(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		time.Sleep(time.Millisecond * 50)
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+	proxy.TimingHeaders = true
+
+	var requestBody, upstreamWait time.Duration
+	proxy.ObserveTimings = func(r *http.Request, body, wait time.Duration) {
+		requestBody, upstreamWait = body, wait
+	}
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	// A slow client sends the body in two parts
+	bodyReader, bodyWriter := io.Pipe()
+	go func() {
+		bodyWriter.Write([]byte("hello "))
+		time.Sleep(time.Millisecond * 100)
+		bodyWriter.Write([]byte("world"))
+		bodyWriter.Close()
+	}()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/function/echo", bodyReader))
+
+	if requestBody < time.Millisecond*100 {
+		t.Errorf("want the request body to take at least 100ms, got: %s", requestBody)
+	}
+	if upstreamWait < time.Millisecond*50 || upstreamWait > time.Second {
+		t.Errorf("want the upstream wait to be around 50ms, got: %s", upstreamWait)
+	}
+	if got := rr.Header().Get("Server-Timing"); !strings.HasPrefix(got, "body;dur=") || !strings.Contains(got, ", upstream;dur=") {
+		t.Errorf("want a Server-Timing header, got: %q", got)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ReportsConnectionClose(t *testing.T) {
+	var connections int32
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("close") == "true" {
+			w.Header().Set("Connection", "close")
+		}
+		w.Write([]byte("ok"))
+	}))
+	upstream.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+	proxy.Client = &http.Client{Transport: &http.Transport{}}
+
+	closed := []string{}
+	proxy.ObserveConnectionClose = func(r *http.Request) {
+		closed = append(closed, r.URL.String())
+	}
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	for _, path := range []string{"/function/echo", "/function/echo", "/function/slam?close=true", "/function/echo"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+			t.Errorf("%s: want: 200 ok, got: %d %q", path, rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("Connection"); got != "" {
+			t.Errorf("%s: want the Connection header stripped, got: %q", path, got)
+		}
+	}
+
+	if len(closed) != 1 || closed[0] != "/function/slam?close=true" {
+		t.Errorf("want one connection close reported for slam, got: %v", closed)
+	}
+
+	// The first connection is reused until the upstream closes it
+	if got := atomic.LoadInt32(&connections); got != 2 {
+		t.Errorf("upstream connections want: %d, got: %d", 2, got)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_NoBodyTiming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+
+	requestBody := time.Hour
+	proxy.ObserveTimings = func(r *http.Request, body, wait time.Duration) {
+		requestBody = body
+	}
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/echo", nil))
+
+	if requestBody != 0 {
+		t.Errorf("want no time for a request without a body, got: %s", requestBody)
+	}
+	if got := rr.Header().Get("Server-Timing"); got != "" {
+		t.Errorf("want no Server-Timing header when disabled, got: %q", got)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ResponseBuffer(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/function/events" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+
+		// Flushing sends the response chunked, without a Content-Length
+		w.Write([]byte(strings.Repeat("a", 100)))
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/function/large" {
+			w.Write([]byte(strings.Repeat("b", 1000)))
+		}
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+	proxy.ResponseBufferBytes = 512
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	cases := []struct {
+		path          string
+		contentLength string
+		bodyLength    int
+	}{
+		{path: "/function/small", contentLength: "100", bodyLength: 100},
+		{path: "/function/large", contentLength: "", bodyLength: 1100},
+		{path: "/function/events", contentLength: "", bodyLength: 100},
+	}
+
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, c.path, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s status want: %d, got: %d", c.path, http.StatusOK, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Length"); got != c.contentLength {
+			t.Errorf("%s Content-Length want: %q, got: %q", c.path, c.contentLength, got)
+		}
+		if rr.Body.Len() != c.bodyLength {
+			t.Errorf("%s body want: %d bytes, got: %d", c.path, c.bodyLength, rr.Body.Len())
+		}
+	}
+}
+
+func Test_bufferResponse(t *testing.T) {
+	get := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	head := httptest.NewRequest(http.MethodHead, "/function/figlet", nil)
+
+	cases := []struct {
+		name     string
+		r        *http.Request
+		res      *http.Response
+		maxBytes int64
+		want     bool
+	}{
+		{"disabled", get, &http.Response{StatusCode: http.StatusOK, ContentLength: 10, Body: io.NopCloser(strings.NewReader(""))}, 0, false},
+		{"known small", get, &http.Response{StatusCode: http.StatusOK, ContentLength: 10, Body: io.NopCloser(strings.NewReader(""))}, 64, true},
+		{"unknown length", get, &http.Response{StatusCode: http.StatusOK, ContentLength: -1, Body: io.NopCloser(strings.NewReader(""))}, 64, true},
+		{"known large", get, &http.Response{StatusCode: http.StatusOK, ContentLength: 65, Body: io.NopCloser(strings.NewReader(""))}, 64, false},
+		{"head", head, &http.Response{StatusCode: http.StatusOK, ContentLength: 10, Body: io.NopCloser(strings.NewReader(""))}, 64, false},
+		{"not modified", get, &http.Response{StatusCode: http.StatusNotModified, Body: http.NoBody}, 64, false},
+		{"event stream", get, &http.Response{StatusCode: http.StatusOK, ContentLength: -1,
+			Header: http.Header{"Content-Type": []string{"text/event-stream; charset=utf-8"}}, Body: io.NopCloser(strings.NewReader(""))}, 64, false},
+	}
+
+	for _, c := range cases {
+		if c.res.Header == nil {
+			c.res.Header = http.Header{}
+		}
+		if got := bufferResponse(c.r, c.res, c.maxBytes); got != c.want {
+			t.Errorf("%s want: %v, got: %v", c.name, c.want, got)
+		}
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ClampsScaleRequests(t *testing.T) {
+	var gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second, 1, 1)
+
+	cases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "below min", body: `{"serviceName":"figlet","replicas":1}`, want: `{"replicas":2,"serviceName":"figlet"}`},
+		{name: "above max", body: `{"serviceName":"figlet","replicas":9}`, want: `{"replicas":5,"serviceName":"figlet"}`},
+		{name: "in range", body: `{"serviceName":"figlet","replicas":3}`, want: `{"serviceName":"figlet","replicas":3}`},
+		{name: "scale to zero", body: `{"serviceName":"figlet","replicas":0}`, want: `{"serviceName":"figlet","replicas":0}`},
+		{name: "not cached", body: `{"serviceName":"env","replicas":9}`, want: `{"serviceName":"env","replicas":9}`},
+		{name: "namespace kept", body: `{"serviceName":"figlet","namespace":"dev","replicas":9}`, want: `{"namespace":"dev","replicas":4,"serviceName":"figlet"}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cache := scaling.NewFunctionCache(time.Minute)
+			cache.Set("figlet", "openfaas-fn", scaling.ServiceQueryResponse{Replicas: 2, MinReplicas: 2, MaxReplicas: 5})
+			cache.Set("figlet", "dev", scaling.ServiceQueryResponse{Replicas: 1, MinReplicas: 1, MaxReplicas: 4})
+
+			handler := MakeForwardingProxyHandler(proxy,
+				[]HTTPNotifier{},
+				middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+				middleware.TransparentURLPathTransformer{},
+				nil,
+				cache)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/system/scale-function/figlet", strings.NewReader(c.body)))
+
+			if gotBody != c.want {
+				t.Errorf("body want: %s, got: %s", c.want, gotBody)
+			}
+		})
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ClampsUncachedScaleRequests(t *testing.T) {
+	var gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second, 1, 1)
+	var queried string
+	proxy.FunctionReplicas = func(functionName, namespace string) (uint64, uint64, bool) {
+		queried = functionName + "." + namespace
+		return 2, 5, functionName == "figlet"
+	}
+
+	cases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "above max", body: `{"serviceName":"figlet","replicas":9}`, want: `{"replicas":5,"serviceName":"figlet"}`},
+		{name: "below min", body: `{"serviceName":"figlet","namespace":"dev","replicas":1}`, want: `{"namespace":"dev","replicas":2,"serviceName":"figlet"}`},
+		{name: "not found", body: `{"serviceName":"env","replicas":9}`, want: `{"serviceName":"env","replicas":9}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler := MakeForwardingProxyHandler(proxy,
+				[]HTTPNotifier{},
+				middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+				middleware.TransparentURLPathTransformer{},
+				nil,
+				scaling.NewFunctionCache(time.Minute))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/system/scale-function/figlet", strings.NewReader(c.body)))
+
+			if gotBody != c.want {
+				t.Errorf("body want: %s, got: %s", c.want, gotBody)
+			}
+		})
+	}
+
+	if queried != "env.openfaas-fn" {
+		t.Errorf("queried want: env.openfaas-fn, got: %s", queried)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_CustomScaleRules(t *testing.T) {
+	var gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second, 1, 1)
+	proxy.ScaleRules = []types.ScaleRule{
+		{Method: http.MethodPut, PathPrefix: "/apis/scale/", ReplicaField: "spec.replicas"},
+	}
+
+	cases := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		want      string
+		wantCache bool
+	}{
+		{name: "scale to zero", method: http.MethodPut, path: "/apis/scale/figlet", body: `{"spec":{"replicas":0}}`, want: `{"spec":{"replicas":0}}`, wantCache: false},
+		{name: "clamped to max", method: http.MethodPut, path: "/apis/scale/figlet", body: `{"kind":"Scale","spec":{"replicas":9}}`, want: `{"kind":"Scale","spec":{"replicas":5}}`, wantCache: true},
+		{name: "namespace from query", method: http.MethodPut, path: "/apis/scale/figlet?namespace=dev", body: `{"spec":{"replicas":0}}`, want: `{"spec":{"replicas":0}}`, wantCache: true},
+		{name: "other method", method: http.MethodPost, path: "/apis/scale/figlet", body: `{"spec":{"replicas":0}}`, want: `{"spec":{"replicas":0}}`, wantCache: true},
+		{name: "default rule replaced", method: http.MethodPost, path: "/system/scale-function/figlet", body: `{"serviceName":"figlet","replicas":0}`, want: `{"serviceName":"figlet","replicas":0}`, wantCache: true},
+		{name: "missing field", method: http.MethodPut, path: "/apis/scale/figlet", body: `{"replicas":0}`, want: `{"replicas":0}`, wantCache: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cache := scaling.NewFunctionCache(time.Minute)
+			cache.Set("figlet", "openfaas-fn", scaling.ServiceQueryResponse{Replicas: 2, MinReplicas: 2, MaxReplicas: 5})
+
+			handler := MakeForwardingProxyHandler(proxy,
+				[]HTTPNotifier{},
+				middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+				middleware.TransparentURLPathTransformer{},
+				nil,
+				cache)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+
+			if gotBody != c.want {
+				t.Errorf("body want: %s, got: %s", c.want, gotBody)
+			}
+			if _, hit := cache.Get("figlet", "openfaas-fn"); hit != c.wantCache {
+				t.Errorf("cached want: %v, got: %v", c.wantCache, hit)
+			}
+		})
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ExplicitEmptyBody(t *testing.T) {
+	type seen struct {
+		contentLength    []string
+		transferEncoding []string
+		body             string
+	}
+	var got seen
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got = seen{contentLength: r.Header["Content-Length"], transferEncoding: r.TransferEncoding, body: string(body)}
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	// replacedBody is a body replaced by a middleware, its length is not known
+	// to the transport
+	replacedBody := func(method, body string) *http.Request {
+		req := httptest.NewRequest(method, "/function/echo", nil)
+		req.Body = ioutil.NopCloser(strings.NewReader(body))
+		req.ContentLength = 0
+		return req
+	}
+
+	cases := []struct {
+		name     string
+		explicit bool
+		req      *http.Request
+		want     seen
+	}{
+		{"GET without a body", true, httptest.NewRequest(http.MethodGet, "/function/echo", nil), seen{}},
+		{"DELETE with an empty body", true, replacedBody(http.MethodDelete, ""), seen{}},
+		{"POST without a body", true, httptest.NewRequest(http.MethodPost, "/function/echo", nil), seen{contentLength: []string{"0"}}},
+		{"POST with an empty body", true, replacedBody(http.MethodPost, ""), seen{contentLength: []string{"0"}}},
+		{"POST with a body of unset length", true, replacedBody(http.MethodPost, "hello"), seen{transferEncoding: []string{"chunked"}, body: "hello"}},
+		{"POST with an empty body by default", false, replacedBody(http.MethodPost, ""), seen{transferEncoding: []string{"chunked"}}},
+	}
+
+	for _, c := range cases {
+		proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+		proxy.ExplicitEmptyBody = c.explicit
+
+		handler := MakeForwardingProxyHandler(proxy,
+			[]HTTPNotifier{},
+			middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+			middleware.TransparentURLPathTransformer{},
+			nil,
+			nil)
+
+		got = seen{}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, c.req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: status want: %d, got: %d", c.name, http.StatusOK, rr.Code)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: upstream want: %+v, got: %+v", c.name, c.want, got)
+		}
+	}
+}
+
+func Test_MakeForwardingProxyHandler_NamespaceAuthInjectors(t *testing.T) {
+	var gotUser string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _, _ = r.BasicAuth()
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	injector := func(user string) middleware.AuthInjector {
+		return &middleware.BasicAuthInjector{Credentials: &auth.BasicAuthCredentials{User: user, Password: "secret"}}
+	}
+
+	cases := []struct {
+		name     string
+		global   middleware.AuthInjector
+		path     string
+		wantUser string
+	}{
+		{"namespace with an injector", injector("global"), "/function/echo.team-a", "team-a"},
+		{"default namespace with an injector", injector("global"), "/function/echo", "openfaas"},
+		{"namespace without an injector falls back", injector("global"), "/function/echo.team-c", "global"},
+		{"namespace without an injector and no global injector", nil, "/function/echo.team-c", ""},
+		{"system route falls back", injector("global"), "/system/functions", "global"},
+	}
+
+	for _, c := range cases {
+		proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+		proxy.FunctionNamespace = "openfaas-fn"
+		proxy.NamespaceAuthInjectors = map[string]middleware.AuthInjector{
+			"team-a":      injector("team-a"),
+			"team-b":      injector("team-b"),
+			"openfaas-fn": injector("openfaas"),
+		}
+
+		handler := MakeForwardingProxyHandler(proxy,
+			[]HTTPNotifier{},
+			middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+			middleware.TransparentURLPathTransformer{},
+			c.global,
+			nil)
+
+		gotUser = ""
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, c.path, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: status want: %d, got: %d", c.name, http.StatusOK, rr.Code)
+		}
+		if gotUser != c.wantUser {
+			t.Errorf("%s: user want: %q, got: %q", c.name, c.wantUser, gotUser)
+		}
+	}
+}
+
+func Test_MakeForwardingProxyHandler_FunctionServerName(t *testing.T) {
+	var gotServerName string
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotServerName = r.TLS.ServerName
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+	transport := upstream.Client().Transport.(*http.Transport)
+	proxy.Transport = transport
+	proxy.Client = &http.Client{Transport: types.NewServerNameTransport(transport, types.DefaultMaxServerNames)}
+	proxy.FunctionServerName = func(r *http.Request) (string, bool) {
+		return "example.com", strings.HasPrefix(r.URL.Path, "/function/shared")
+	}
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	cases := []struct {
+		path           string
+		wantServerName string
+	}{
+		{"/function/shared", "example.com"},
+		{"/function/echo", ""},
+	}
+
+	for _, c := range cases {
+		gotServerName = ""
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, c.path, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: status want: %d, got: %d", c.path, http.StatusOK, rr.Code)
+		}
+		if gotServerName != c.wantServerName {
+			t.Errorf("%s: SNI want: %q, got: %q", c.path, c.wantServerName, gotServerName)
+		}
+	}
+}
+
+func Test_MakeForwardingProxyHandler_RawRequestURI(t *testing.T) {
+	var gotURI string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURI = r.RequestURI
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	cases := []struct {
+		name    string
+		raw     bool
+		baseURL string
+		uri     string
+		wantURI string
+	}{
+		{"transformed by default", false, upstream.URL, "/function/proxy/a%2Fb/c%20d?q=a%2Bb", "/a/b/c%20d?q=a%2Bb"},
+		{"raw", true, upstream.URL, "/function/proxy/a%2Fb/c%20d?q=a%2Bb", "/function/proxy/a%2Fb/c%20d?q=a%2Bb"},
+		{"raw keeps lower case encodings", true, upstream.URL, "/function/proxy/%7e/a%2fb", "/function/proxy/%7e/a%2fb"},
+		{"raw keeps an empty query", true, upstream.URL, "/function/proxy/x?", "/function/proxy/x?"},
+		{"raw after the base path", true, upstream.URL + "/prefix/", "/function/proxy/a%2Fb", "/prefix/function/proxy/a%2Fb"},
+	}
+
+	for _, c := range cases {
+		proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+		raw := c.raw
+		proxy.FunctionRawRequestURI = func(r *http.Request) bool {
+			return raw
+		}
+
+		handler := MakeForwardingProxyHandler(proxy,
+			[]HTTPNotifier{},
+			middleware.SingleHostBaseURLResolver{BaseURL: c.baseURL},
+			middleware.FunctionPrefixTrimmingURLPathTransformer{},
+			nil,
+			nil)
+
+		gotURI = ""
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, c.uri, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: status want: %d, got: %d", c.name, http.StatusOK, rr.Code)
+		}
+		if gotURI != c.wantURI {
+			t.Errorf("%s: upstream URI want: %q, got: %q", c.name, c.wantURI, gotURI)
+		}
+	}
+}
+
+func Test_setRawRequestURI_WithoutRequestURI(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodGet, "http://gateway:8080/function/proxy/a%2Fb?q=1", nil)
+	upstreamReq, _ := http.NewRequest(http.MethodGet, "http://proxy:8080/a/b?q=1", nil)
+
+	setRawRequestURI(r, "http://proxy:8080", upstreamReq)
+
+	if got := upstreamReq.URL.RequestURI(); got != "/function/proxy/a%2Fb?q=1" {
+		t.Errorf("upstream URI want: %q, got: %q", "/function/proxy/a%2Fb?q=1", got)
+	}
+	if upstreamReq.URL.Host != "proxy:8080" {
+		t.Errorf("upstream host want: %q, got: %q", "proxy:8080", upstreamReq.URL.Host)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_RecordsUpstreamTiming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 20)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	req := middleware.WithRequestTimings(httptest.NewRequest(http.MethodGet, "/function/echo", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := middleware.GetRequestTimings(req.Context()).Upstream; got < time.Millisecond*20 {
+		t.Errorf("upstream timing want at least %s, got: %s", time.Millisecond*20, got)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_FailsOverToPeerRegion(t *testing.T) {
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("want the request sent to the peer region, not the function")
+	}))
+	defer function.Close()
+
+	var path, hop string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		hop = r.Header.Get(middleware.FailoverHopHeader)
+	}))
+	defer peer.Close()
+
+	functionURL, _ := url.Parse(function.URL)
+	proxy := types.NewHTTPClientReverseProxy(functionURL, time.Second*5, 1, 1)
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: function.URL},
+		middleware.FunctionPrefixTrimmingURLPathTransformer{},
+		nil,
+		nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet.openfaas-fn/banner", nil)
+	req = middleware.WithFailover(req, middleware.Failover{Region: "eu-west", URL: peer.URL + "/"})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status want: %d, got: %d", http.StatusOK, rec.Code)
+	}
+	if path != "/function/figlet.openfaas-fn/banner" {
+		t.Errorf("peer path want: %s, got: %s", "/function/figlet.openfaas-fn/banner", path)
+	}
+	if hop != "eu-west" {
+		t.Errorf("%s want: %s, got: %q", middleware.FailoverHopHeader, "eu-west", hop)
+	}
+	if got := req.Header.Get(middleware.FailoverHopHeader); got != "" {
+		t.Errorf("want the client's request left alone, got: %q", got)
+	}
+}
+
+func Test_MakeForwardingProxyHandler_FailoverSendsPeerCredentials(t *testing.T) {
+	var user string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ = r.BasicAuth()
+	}))
+	defer peer.Close()
+
+	proxy := types.NewHTTPClientReverseProxy(&url.URL{Scheme: "http", Host: "127.0.0.1:1"}, time.Second*5, 1, 1)
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: "http://127.0.0.1:1"},
+		middleware.FunctionPrefixTrimmingURLPathTransformer{},
+		&middleware.BasicAuthInjector{Credentials: &auth.BasicAuthCredentials{User: "provider", Password: "secret"}},
+		nil)
+
+	for _, peerAuth := range []middleware.AuthInjector{
+		nil,
+		&middleware.BasicAuthInjector{Credentials: &auth.BasicAuthCredentials{User: "us-east", Password: "secret"}},
+	} {
+		user = ""
+		req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+		req = middleware.WithFailover(req, middleware.Failover{Region: "eu-west", URL: peer.URL, Auth: peerAuth})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		want := ""
+		if peerAuth != nil {
+			want = "us-east"
+		}
+		if user != want {
+			t.Errorf("peer credentials want: %q, got: %q", want, user)
+		}
+	}
+}
+
+// makeFunctionProxy starts upstream as a function behind a forwarding proxy
+// with the given timeout, the server is closed when the test completes
+func makeFunctionProxy(t *testing.T, upstream http.HandlerFunc, timeout time.Duration) (http.HandlerFunc, *types.HTTPClientReverseProxy, *testNotifier) {
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	serverURL, _ := url.Parse(server.URL)
+	proxy := types.NewHTTPClientReverseProxy(serverURL, timeout, 1, 1)
+	notifier := &testNotifier{}
+
+	handler := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{notifier},
+		middleware.SingleHostBaseURLResolver{BaseURL: server.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	return handler, proxy, notifier
+}
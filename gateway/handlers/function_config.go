@@ -0,0 +1,330 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// FunctionConfigSourceGateway is a setting from the gateway's config
+	FunctionConfigSourceGateway = "gateway"
+
+	// FunctionConfigSourceNamespace is a setting from the gateway's config
+	// for the function's namespace
+	FunctionConfigSourceNamespace = "namespace"
+
+	// FunctionConfigSourceAnnotation is a setting from the function's own
+	// annotations
+	FunctionConfigSourceAnnotation = "annotation"
+
+	// FunctionConfigSourceLabel is a setting from the function's own labels
+	FunctionConfigSourceLabel = "label"
+)
+
+// FunctionConfigDefaults are the gateway's settings for functions which do
+// not have annotations of their own
+type FunctionConfigDefaults struct {
+	// Timeout is the upstream timeout
+	Timeout time.Duration
+
+	// TimeBudget bounds each request in total, unbounded when 0
+	TimeBudget time.Duration
+
+	// MaxRequestBytes is the largest request body, unlimited when 0
+	MaxRequestBytes int64
+
+	// LoadShedding reports the concurrency limits of functions
+	LoadShedding bool
+
+	// ResponseCache reports the cache policy of functions
+	ResponseCache bool
+
+	// LoadBalancer is the policy used to balance requests over the
+	// endpoints of functions
+	LoadBalancer string
+
+	// OutlierConsecutiveFailures eject an endpoint, disabled when 0
+	OutlierConsecutiveFailures int
+
+	// OutlierEjectionTime is how long an endpoint is ejected for
+	OutlierEjectionTime time.Duration
+
+	// DefaultRegion is used for clients which send no region
+	DefaultRegion string
+
+	// ScaleFromZero reports the cold start and slow start settings
+	ScaleFromZero bool
+
+	// FaultInjection reports the faults injected into functions
+	FaultInjection bool
+
+	// UpstreamProxy is the proxy requests to functions are sent through,
+	// UpstreamProxyNamespaces replaces it for the functions of a namespace
+	UpstreamProxy           *url.URL
+	UpstreamProxyNamespaces map[string]*url.URL
+
+	// ColdStartQueue reports the share of queued cold starts and the limit
+	// of concurrent cold starts of each namespace
+	ColdStartQueue            bool
+	ColdStartNamespaceWeights map[string]int
+	ColdStartNamespaceLimits  map[string]int
+}
+
+// FunctionConfigSetting is a value in effect for a function and the source
+// it was resolved from
+type FunctionConfigSetting struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// FunctionConfig is the configuration the gateway uses for a function
+type FunctionConfig struct {
+	FunctionName string                           `json:"functionName"`
+	Namespace    string                           `json:"namespace"`
+	Settings     map[string]FunctionConfigSetting `json:"settings"`
+}
+
+// MakeFunctionConfigHandler returns the configuration in effect for the
+// function named in the path, with the namespace as a suffix of the name or
+// in the namespace query parameter. Each setting is resolved by the same
+// code as the middleware which applies it: the function's annotation or
+// label when it is valid, otherwise the gateway's setting for the function's
+// namespace, otherwise the gateway's default in defaults. Settings which only
+// describe the function, such as its warm-up request or redaction, are not
+// reported.
+func MakeFunctionConfigHandler(functionQuery scaling.FunctionQuery, timeouts scaling.FunctionTimeouts, defaults FunctionConfigDefaults, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, mux.Vars(r)["name"])
+		if value := r.URL.Query().Get("namespace"); len(value) > 0 {
+			namespace = value
+		}
+		if len(functionName) == 0 {
+			http.Error(w, "a function name is required", http.StatusBadRequest)
+			return
+		}
+
+		query, err := functionQuery.Get(functionName, namespace)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("function %s.%s not found", functionName, namespace), http.StatusNotFound)
+			return
+		}
+		annotations := map[string]string{}
+		if query.Annotations != nil {
+			annotations = *query.Annotations
+		}
+
+		settings := resolveFunctionConfig(annotations, timeouts, defaults, functionName+"."+namespace)
+		for name, setting := range resolveNamespaceConfig(defaults, namespace) {
+			settings[name] = setting
+		}
+		// The replicas are read from the labels by the provider, a response
+		// without a maximum did not report them
+		if query.MaxReplicas > 0 {
+			settings["scale.min"] = FunctionConfigSetting{Value: query.MinReplicas, Source: labelSource(query.MinReplicas != scaling.DefaultMinReplicas)}
+			settings["scale.max"] = FunctionConfigSetting{Value: query.MaxReplicas, Source: labelSource(query.MaxReplicas != scaling.DefaultMaxReplicas)}
+		}
+
+		res := FunctionConfig{
+			FunctionName: functionName,
+			Namespace:    namespace,
+			Settings:     settings,
+		}
+
+		bytesOut, err := json.Marshal(res)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(bytesOut)
+	}
+}
+
+// resolveFunctionConfig returns the settings in effect for a function by name
+func resolveFunctionConfig(annotations map[string]string, timeouts scaling.FunctionTimeouts, defaults FunctionConfigDefaults, function string) map[string]FunctionConfigSetting {
+	settings := map[string]FunctionConfigSetting{}
+	set := func(name string, value interface{}, annotated bool) {
+		source := FunctionConfigSourceGateway
+		if annotated {
+			source = FunctionConfigSourceAnnotation
+		}
+		settings[name] = FunctionConfigSetting{Value: value, Source: source}
+	}
+
+	timeout, annotated := timeouts.Resolve(annotations, function)
+	if !annotated {
+		timeout = defaults.Timeout
+	}
+	set("timeout", timeout.String(), annotated)
+
+	budget, annotated := readTimeBudget(annotations, defaults.TimeBudget)
+	set("timeBudget", budget.String(), annotated)
+
+	maxBytes, annotated := readMaxRequestBytes(annotations, defaults.MaxRequestBytes)
+	set("maxRequestBytes", maxBytes, annotated)
+
+	keepAlive, keepAliveMaxBytes := readKeepAlive(annotations, function)
+	set("keepAlive", keepAlive, validAnnotation(annotations, KeepAliveAnnotation, func(value string) bool {
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	}))
+	set("keepAliveMaxBytes", keepAliveMaxBytes, validAnnotation(annotations, KeepAliveMaxBytesAnnotation, func(value string) bool {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		return err == nil && parsed >= 0
+	}))
+
+	set("bodyChecksum", bodyChecksumEnabled(annotations), validAnnotation(annotations, BodyChecksumAnnotation, func(value string) bool {
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	}))
+
+	if defaults.LoadShedding {
+		maxConcurrency, highWater := readConcurrencyLimits(annotations)
+		set("concurrency.max", maxConcurrency, maxConcurrency > 0)
+		set("concurrency.highWater", highWater, maxConcurrency > 0)
+	}
+
+	if defaults.ResponseCache {
+		policy, annotated := readCachePolicy(annotations)
+		set("cache.ttl", policy.ttl.String(), annotated)
+		if annotated {
+			set("cache.staleWhileRevalidate", policy.grace.String(), true)
+			set("cache.staleIfError", policy.staleIfError.String(), true)
+			set("cache.revalidate", policy.revalidate, true)
+			keyHeaders := policy.keyHeaders
+			if keyHeaders == nil {
+				keyHeaders = []string{}
+			}
+			set("cache.keyHeaders", keyHeaders, true)
+			set("cache.authenticated", policy.authenticated, true)
+		}
+	}
+
+	if defaults.ScaleFromZero {
+		threshold := scaling.ColdStartThreshold(annotations)
+		set("scale.coldStartThreshold", threshold.String(), threshold > 0)
+
+		priority, annotated := scaling.ParsePriority(annotations[scaling.ScalePriorityAnnotation])
+		set("scale.priority", priorityName(priority), annotated)
+
+		window, initial, _ := readSlowStart(annotations)
+		set("slowStart.window", window.String(), window > 0)
+		set("slowStart.initial", initial, window > 0)
+	}
+
+	policy, annotated := scaling.LoadBalancerPolicy(annotations, defaults.LoadBalancer)
+	set("loadBalancer", policy, annotated)
+
+	failures, annotated := scaling.OutlierFailures(annotations, defaults.OutlierConsecutiveFailures)
+	set("outlier.consecutiveFailures", failures, annotated)
+	ejectionTime, annotated := scaling.OutlierEjectionTime(annotations, defaults.OutlierEjectionTime)
+	set("outlier.ejectionTime", ejectionTime.String(), annotated)
+
+	if regions, defaultRegion := scaling.FunctionRegions(annotations, defaults.DefaultRegion); len(regions) > 0 {
+		set("regions", regions, true)
+		_, annotated := annotations[scaling.DefaultRegionAnnotation]
+		set("regions.default", defaultRegion, annotated)
+	}
+
+	methods := allowedMethods(annotations)
+	set("methods", methods, len(strings.TrimSpace(annotations[MethodsAnnotation])) > 0)
+
+	// Functions without an allow-list accept requests from any address
+	if value, ok := annotations[AllowedSourcesAnnotation]; ok {
+		sources := []string{}
+		for _, network := range parseAllowedSources(value) {
+			sources = append(sources, network.String())
+		}
+		set("allowedSources", sources, true)
+	}
+
+	if inline := strings.TrimSpace(annotations[RequestSchemaAnnotation]); len(inline) > 0 {
+		set("requestSchema", "inline", true)
+	} else if ref := strings.TrimSpace(annotations[RequestSchemaRefAnnotation]); len(ref) > 0 {
+		set("requestSchema", ref, true)
+	}
+
+	if defaults.FaultInjection {
+		rule := readFaultRule(annotations)
+		set("fault.delay", rule.delay.String(), rule.delay > 0)
+		set("fault.delayPercent", rule.delayPercent, rule.delay > 0)
+		set("fault.abort", rule.abort, rule.abort > 0)
+		set("fault.abortPercent", rule.abortPercent, rule.abort > 0)
+	}
+
+	return settings
+}
+
+// resolveNamespaceConfig returns the settings the gateway has for the
+// functions of a namespace
+func resolveNamespaceConfig(defaults FunctionConfigDefaults, namespace string) map[string]FunctionConfigSetting {
+	settings := map[string]FunctionConfigSetting{}
+	set := func(name string, value interface{}, namespaced bool) {
+		source := FunctionConfigSourceGateway
+		if namespaced {
+			source = FunctionConfigSourceNamespace
+		}
+		settings[name] = FunctionConfigSetting{Value: value, Source: source}
+	}
+
+	proxy, namespaced := defaults.UpstreamProxyNamespaces[namespace]
+	if !namespaced {
+		proxy = defaults.UpstreamProxy
+	}
+	if proxy != nil {
+		set("upstreamProxy", proxy.Redacted(), namespaced)
+	}
+
+	if defaults.ColdStartQueue {
+		weight, namespaced := defaults.ColdStartNamespaceWeights[namespace]
+		if !namespaced || weight <= 0 {
+			weight, namespaced = 1, false
+		}
+		set("coldStart.weight", weight, namespaced)
+
+		limit, namespaced := defaults.ColdStartNamespaceLimits[namespace]
+		set("coldStart.limit", limit, namespaced && limit > 0)
+	}
+
+	return settings
+}
+
+// labelSource is the source of a setting read from a function's label
+func labelSource(labelled bool) string {
+	if labelled {
+		return FunctionConfigSourceLabel
+	}
+	return FunctionConfigSourceGateway
+}
+
+// priorityName is the name of a cold start priority, as it is annotated
+func priorityName(priority int) string {
+	switch priority {
+	case scaling.PriorityLow:
+		return "low"
+	case scaling.PriorityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+// validAnnotation returns true when a function has an annotation which
+// valid accepts, and so replaces the gateway's default
+func validAnnotation(annotations map[string]string, name string, valid func(value string) bool) bool {
+	value, ok := annotations[name]
+	return ok && valid(strings.TrimSpace(value))
+}
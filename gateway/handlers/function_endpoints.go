@@ -0,0 +1,109 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// FunctionEndpoints is the set of upstream endpoints for a function
+type FunctionEndpoints struct {
+	FunctionName string   `json:"functionName"`
+	Namespace    string   `json:"namespace,omitempty"`
+	Endpoints    []string `json:"endpoints"`
+}
+
+// MakeFunctionEndpointsHandler reads (GET) or replaces (PUT) the endpoints
+// of a function in the cache. A PUT is prepared by validating every
+// endpoint, then committed with a single swap so that all traffic moves
+// from the old to the new set at once, i.e. for a blue/green deployment.
+func MakeFunctionEndpointsHandler(cache scaling.FunctionCacher, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			getFunctionEndpoints(w, r, cache, defaultNamespace)
+		case http.MethodPut:
+			swapFunctionEndpoints(w, r, cache, defaultNamespace)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func getFunctionEndpoints(w http.ResponseWriter, r *http.Request, cache scaling.FunctionCacher, defaultNamespace string) {
+	q := r.URL.Query()
+	res := FunctionEndpoints{
+		FunctionName: q.Get("functionName"),
+		Namespace:    q.Get("namespace"),
+	}
+	if len(res.FunctionName) == 0 {
+		http.Error(w, "functionName is required", http.StatusBadRequest)
+		return
+	}
+	if len(res.Namespace) == 0 {
+		res.Namespace = defaultNamespace
+	}
+
+	endpoints, ok := cache.GetEndpoints(res.FunctionName, res.Namespace)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no endpoints for function %s.%s", res.FunctionName, res.Namespace), http.StatusNotFound)
+		return
+	}
+	res.Endpoints = endpoints
+
+	writeFunctionEndpoints(w, res)
+}
+
+func swapFunctionEndpoints(w http.ResponseWriter, r *http.Request, cache scaling.FunctionCacher, defaultNamespace string) {
+	defer r.Body.Close()
+	body, _ := ioutil.ReadAll(r.Body)
+
+	req := FunctionEndpoints{}
+	if err := json.Unmarshal(body, &req); err != nil || len(req.FunctionName) == 0 {
+		http.Error(w, "a JSON body with functionName and endpoints is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Namespace) == 0 {
+		req.Namespace = defaultNamespace
+	}
+
+	// Prepare the complete set before anything is changed
+	prepared := make([]string, 0, len(req.Endpoints))
+	for _, endpoint := range req.Endpoints {
+		u, err := url.Parse(strings.TrimSpace(endpoint))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			http.Error(w, fmt.Sprintf("invalid endpoint: %q", endpoint), http.StatusBadRequest)
+			return
+		}
+		prepared = append(prepared, strings.TrimSuffix(u.String(), "/"))
+	}
+
+	// Commit
+	cache.SwapEndpoints(req.FunctionName, req.Namespace, prepared)
+	log.Printf("Endpoints for function %s.%s set to: %v\n", req.FunctionName, req.Namespace, prepared)
+
+	req.Endpoints = prepared
+	writeFunctionEndpoints(w, req)
+}
+
+func writeFunctionEndpoints(w http.ResponseWriter, res FunctionEndpoints) {
+	jsonOut, err := json.Marshal(res)
+	if err != nil {
+		log.Printf("Error marshalling function endpoints: %s\n", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonOut)
+}
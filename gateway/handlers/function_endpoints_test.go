@@ -0,0 +1,58 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+func Test_MakeFunctionEndpointsHandler_SwapsEndpoints(t *testing.T) {
+	cache := scaling.NewFunctionCache(time.Second)
+	cache.SwapEndpoints("echo", "openfaas-fn", []string{"http://blue:8080"})
+	handler := MakeFunctionEndpointsHandler(cache, "openfaas-fn")
+
+	body := `{"functionName":"echo","endpoints":["http://green-1:8080/","http://green-2:8080"]}`
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPut, "/system/function-endpoints", strings.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+
+	endpoints, _ := cache.GetEndpoints("echo", "openfaas-fn")
+	if len(endpoints) != 2 || endpoints[0] != "http://green-1:8080" {
+		t.Errorf("want green endpoints, got: %v", endpoints)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/system/function-endpoints?functionName=echo", nil))
+	if !strings.Contains(rr.Body.String(), "green-2") {
+		t.Errorf("want endpoints in response, got: %s", rr.Body.String())
+	}
+}
+
+func Test_MakeFunctionEndpointsHandler_InvalidSetIsNotApplied(t *testing.T) {
+	cache := scaling.NewFunctionCache(time.Second)
+	cache.SwapEndpoints("echo", "openfaas-fn", []string{"http://blue:8080"})
+	handler := MakeFunctionEndpointsHandler(cache, "openfaas-fn")
+
+	body := `{"functionName":"echo","endpoints":["http://green-1:8080","green-2"]}`
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPut, "/system/function-endpoints", strings.NewReader(body)))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status want: %d, got: %d", http.StatusBadRequest, rr.Code)
+	}
+
+	endpoints, _ := cache.GetEndpoints("echo", "openfaas-fn")
+	if len(endpoints) != 1 || endpoints[0] != "http://blue:8080" {
+		t.Errorf("want blue endpoints to be kept, got: %v", endpoints)
+	}
+}
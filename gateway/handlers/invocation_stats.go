@@ -0,0 +1,188 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/requests"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// FunctionInvocationStats is the invocation count and last invocation
+// time of a function as seen by the gateway
+type FunctionInvocationStats struct {
+	Function    string    `json:"function"`
+	Invocations uint64    `json:"invocations"`
+	LastInvoked time.Time `json:"lastInvoked"`
+}
+
+// InvocationStats counts invocations per function, Record only takes a
+// read lock once a function has been seen. Up to MaxFunctions are counted at
+// once, with no limit when 0.
+type InvocationStats struct {
+	MaxFunctions int
+
+	functions map[string]*invocationCounter
+	lock      sync.RWMutex
+}
+
+type invocationCounter struct {
+	count       uint64
+	lastInvoked int64
+}
+
+// NewInvocationStats creates an InvocationStats for up to maxFunctions
+func NewInvocationStats(maxFunctions int) *InvocationStats {
+	return &InvocationStats{
+		MaxFunctions: maxFunctions,
+		functions:    make(map[string]*invocationCounter),
+	}
+}
+
+// Record counts an invocation of function, when MaxFunctions are already
+// counted the least recently invoked function is removed to make room
+func (s *InvocationStats) Record(function string) {
+	s.lock.RLock()
+	counter, ok := s.functions[function]
+	s.lock.RUnlock()
+
+	if !ok {
+		s.lock.Lock()
+		if counter, ok = s.functions[function]; !ok {
+			if s.MaxFunctions > 0 && len(s.functions) >= s.MaxFunctions {
+				s.evictLeastRecent()
+			}
+			counter = &invocationCounter{}
+			s.functions[function] = counter
+		}
+		s.lock.Unlock()
+	}
+
+	atomic.AddUint64(&counter.count, 1)
+	atomic.StoreInt64(&counter.lastInvoked, time.Now().UnixNano())
+}
+
+// evictLeastRecent removes the function invoked least recently, the write
+// lock must be held
+func (s *InvocationStats) evictLeastRecent() {
+	var oldest string
+	var oldestInvoked int64
+	for function, counter := range s.functions {
+		lastInvoked := atomic.LoadInt64(&counter.lastInvoked)
+		if len(oldest) == 0 || lastInvoked < oldestInvoked {
+			oldest, oldestInvoked = function, lastInvoked
+		}
+	}
+	delete(s.functions, oldest)
+}
+
+// Reset removes the counters for function
+func (s *InvocationStats) Reset(function string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.functions, function)
+}
+
+// Stats returns a snapshot of the counters sorted by function name
+func (s *InvocationStats) Stats() []FunctionInvocationStats {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	stats := make([]FunctionInvocationStats, 0, len(s.functions))
+	for function, counter := range s.functions {
+		stats = append(stats, FunctionInvocationStats{
+			Function:    function,
+			Invocations: atomic.LoadUint64(&counter.count),
+			LastInvoked: time.Unix(0, atomic.LoadInt64(&counter.lastInvoked)).UTC(),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Function < stats[j].Function
+	})
+	return stats
+}
+
+// InvocationStatsNotifier records completed invocations in InvocationStats
+type InvocationStatsNotifier struct {
+	Stats *InvocationStats
+
+	// FunctionQuery when set, only invocations of functions which it finds
+	// are counted, so that requests for any name cannot fill the stats
+	FunctionQuery scaling.FunctionQuery
+
+	// FunctionNamespace default namespace of the function
+	FunctionNamespace string
+}
+
+// Notify records a completed invocation
+func (n InvocationStatsNotifier) Notify(method string, URL string, originalURL string, statusCode int, event string, duration time.Duration) {
+	if event != "completed" {
+		return
+	}
+
+	functionName, namespace := middleware.GetNamespace(n.FunctionNamespace, middleware.GetServiceName(originalURL))
+	if len(functionName) == 0 {
+		return
+	}
+	if n.FunctionQuery != nil {
+		if _, err := n.FunctionQuery.Get(functionName, namespace); err != nil {
+			return
+		}
+	}
+	n.Stats.Record(functionName + "." + namespace)
+}
+
+// MakeInvocationStatsHandler returns the invocation stats of each function as JSON
+func MakeInvocationStatsHandler(stats *InvocationStats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonOut, err := json.Marshal(stats.Stats())
+		if err != nil {
+			log.Printf("Error marshalling invocation stats: %s\n", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonOut)
+	}
+}
+
+// MakeInvocationStatsResetHandler resets the invocation stats of a function
+// once next has deleted it, so that a re-created function starts from zero
+func MakeInvocationStatsResetHandler(next http.HandlerFunc, stats *InvocationStats, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req requests.DeleteFunctionRequest
+		if r.Body != nil {
+			body, _ := ioutil.ReadAll(r.Body)
+			r.Body.Close()
+			json.Unmarshal(body, &req)
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		writer := httputil.NewHttpWriteInterceptor(w)
+		next(writer, r)
+
+		if len(req.FunctionName) > 0 && writer.Status() >= http.StatusOK && writer.Status() < http.StatusMultipleChoices {
+			namespace := r.URL.Query().Get("namespace")
+			if len(namespace) == 0 {
+				namespace = defaultNamespace
+			}
+			stats.Reset(req.FunctionName + "." + namespace)
+		}
+	}
+}
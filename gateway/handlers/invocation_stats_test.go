@@ -0,0 +1,123 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_InvocationStatsNotifier_RecordsCompleted(t *testing.T) {
+	stats := NewInvocationStats(0)
+	notifier := InvocationStatsNotifier{Stats: stats, FunctionNamespace: "openfaas-fn"}
+
+	notifier.Notify(http.MethodGet, "/function/figlet", "/function/figlet", http.StatusProcessing, "started", 0)
+	notifier.Notify(http.MethodGet, "/function/figlet", "/function/figlet", http.StatusOK, "completed", time.Millisecond)
+	notifier.Notify(http.MethodGet, "/function/figlet.dev", "/function/figlet.dev", http.StatusOK, "completed", time.Millisecond)
+	notifier.Notify(http.MethodGet, "/function/figlet", "/function/figlet", http.StatusInternalServerError, "completed", time.Millisecond)
+
+	got := stats.Stats()
+	if len(got) != 2 {
+		t.Fatalf("want stats for 2 functions, got: %v", got)
+	}
+
+	if got[0].Function != "figlet.dev" || got[0].Invocations != 1 {
+		t.Errorf("want 1 invocation of figlet.dev, got: %+v", got[0])
+	}
+	if got[1].Function != "figlet.openfaas-fn" || got[1].Invocations != 2 {
+		t.Errorf("want 2 invocations of figlet.openfaas-fn, got: %+v", got[1])
+	}
+	if time.Since(got[1].LastInvoked) > time.Minute {
+		t.Errorf("want a recent LastInvoked, got: %s", got[1].LastInvoked)
+	}
+}
+
+func Test_InvocationStatsNotifier_OnlyFoundFunctions(t *testing.T) {
+	stats := NewInvocationStats(0)
+	notifier := InvocationStatsNotifier{
+		Stats:             stats,
+		FunctionQuery:     &namespacedFunctionQuery{err: fmt.Errorf("not found")},
+		FunctionNamespace: "openfaas-fn",
+	}
+
+	notifier.Notify(http.MethodGet, "/function/missing", "/function/missing", http.StatusNotFound, "completed", time.Millisecond)
+	if got := stats.Stats(); len(got) != 0 {
+		t.Errorf("want functions which are not found skipped, got: %v", got)
+	}
+}
+
+func Test_InvocationStats_MaxFunctions(t *testing.T) {
+	stats := NewInvocationStats(2)
+
+	stats.Record("a")
+	time.Sleep(time.Millisecond)
+	stats.Record("b")
+	time.Sleep(time.Millisecond)
+	stats.Record("a")
+	time.Sleep(time.Millisecond)
+	stats.Record("c")
+
+	got := stats.Stats()
+	if len(got) != 2 || got[0].Function != "a" || got[1].Function != "c" {
+		t.Errorf("want b evicted as the least recently invoked, got: %v", got)
+	}
+}
+
+func Test_InvocationStats_ConcurrentRecord(t *testing.T) {
+	stats := NewInvocationStats(0)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats.Record("figlet.openfaas-fn")
+		}()
+	}
+	wg.Wait()
+
+	if got := stats.Stats()[0].Invocations; got != 50 {
+		t.Errorf("want: %d, got: %d", 50, got)
+	}
+}
+
+func Test_MakeInvocationStatsResetHandler_ResetsOnDelete(t *testing.T) {
+	stats := NewInvocationStats(0)
+	stats.Record("figlet.openfaas-fn")
+	stats.Record("nodeinfo.openfaas-fn")
+
+	handler := MakeInvocationStatsResetHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}, stats, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodDelete, "/system/functions", strings.NewReader(`{"functionName":"figlet"}`))
+	handler(httptest.NewRecorder(), req)
+
+	got := stats.Stats()
+	if len(got) != 1 || got[0].Function != "nodeinfo.openfaas-fn" {
+		t.Errorf("want only nodeinfo to be kept, got: %v", got)
+	}
+}
+
+func Test_MakeInvocationStatsHandler(t *testing.T) {
+	stats := NewInvocationStats(0)
+	stats.Record("figlet.openfaas-fn")
+
+	rr := httptest.NewRecorder()
+	MakeInvocationStatsHandler(stats)(rr, httptest.NewRequest(http.MethodGet, "/system/function-stats", nil))
+
+	var got []FunctionInvocationStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Invocations != 1 {
+		t.Errorf("want 1 invocation, got: %v", got)
+	}
+}
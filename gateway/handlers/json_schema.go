@@ -0,0 +1,402 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaErrors is the most validation errors reported for a payload
+const maxSchemaErrors = 20
+
+// SchemaError is a part of a payload which does not match its JSON Schema,
+// Path is a JSON Pointer to the value, empty for the whole payload
+type SchemaError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// jsonSchema is the subset of JSON Schema used to validate request
+// payloads: type, enum, const, the numeric, string, array and object
+// keywords, and allOf, anyOf, oneOf and not. $ref and format are not
+// supported, unknown keywords are ignored.
+type jsonSchema struct {
+	// always is set for the boolean schemas true and false
+	always *bool
+
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Const                *json.RawMessage       `json:"const"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64               `json:"exclusiveMaximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	Items                *jsonSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	AllOf                []*jsonSchema          `json:"allOf"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	OneOf                []*jsonSchema          `json:"oneOf"`
+	Not                  *jsonSchema            `json:"not"`
+
+	pattern *regexp.Regexp
+	value   interface{}
+}
+
+// schemaTypes is the type keyword, a single type or a list of types
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	var always bool
+	if err := json.Unmarshal(data, &always); err == nil {
+		s.always = &always
+		return nil
+	}
+
+	// The alias has the same fields without this method
+	type schema jsonSchema
+	if err := json.Unmarshal(data, (*schema)(s)); err != nil {
+		return err
+	}
+
+	for _, name := range s.Type {
+		switch name {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return fmt.Errorf("unknown type: %q", name)
+		}
+	}
+
+	if len(s.Pattern) > 0 {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %s", s.Pattern, err)
+		}
+		s.pattern = pattern
+	}
+
+	if s.Const != nil {
+		value, err := decodeJSON(*s.Const)
+		if err != nil {
+			return err
+		}
+		s.value = value
+	}
+	for i, value := range s.Enum {
+		s.Enum[i] = normalizeJSONNumber(value)
+	}
+	return nil
+}
+
+// parseJSONSchema parses a JSON Schema
+func parseJSONSchema(data []byte) (*jsonSchema, error) {
+	schema := &jsonSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// decodeJSON decodes a single JSON value, numbers are kept as json.Number
+// so that large integers are compared exactly
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+// normalizeJSONNumber converts the float64 numbers of a schema's enum into
+// json.Number so that they compare with decoded payloads
+func normalizeJSONNumber(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64))
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeJSONNumber(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = normalizeJSONNumber(v[key])
+		}
+	}
+	return value
+}
+
+// Validate returns the errors of value, decoded by decodeJSON, up to
+// maxSchemaErrors
+func (s *jsonSchema) Validate(value interface{}) []SchemaError {
+	errors := []SchemaError{}
+	s.validate(value, "", &errors)
+	if len(errors) > maxSchemaErrors {
+		errors = errors[:maxSchemaErrors]
+	}
+	return errors
+}
+
+func (s *jsonSchema) validate(value interface{}, path string, errors *[]SchemaError) {
+	fail := func(format string, args ...interface{}) {
+		*errors = append(*errors, SchemaError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.always != nil {
+		if !*s.always {
+			fail("is not allowed")
+		}
+		return
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		if len(s.Type) == 1 {
+			fail("must be of type %s", s.Type[0])
+		} else {
+			fail("must be one of the types %s", strings.Join(s.Type, ", "))
+		}
+		return
+	}
+
+	if s.Enum != nil {
+		found := false
+		for _, allowed := range s.Enum {
+			if jsonEqual(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of the enumerated values")
+		}
+	}
+	if s.Const != nil && !jsonEqual(value, s.value) {
+		fail("must be %s", string(*s.Const))
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		s.validateNumber(v, fail)
+	case string:
+		s.validateString(v, fail)
+	case []interface{}:
+		s.validateArray(v, path, errors, fail)
+	case map[string]interface{}:
+		s.validateObject(v, path, errors, fail)
+	}
+
+	for _, sub := range s.AllOf {
+		sub.validate(value, path, errors)
+	}
+	if len(s.AnyOf) > 0 {
+		if matched := s.countMatches(s.AnyOf, value); matched == 0 {
+			fail("must match at least one schema of anyOf")
+		}
+	}
+	if len(s.OneOf) > 0 {
+		if matched := s.countMatches(s.OneOf, value); matched != 1 {
+			fail("must match exactly one schema of oneOf, matched %d", matched)
+		}
+	}
+	if s.Not != nil && s.countMatches([]*jsonSchema{s.Not}, value) == 1 {
+		fail("must not match the schema of not")
+	}
+}
+
+func (s *jsonSchema) countMatches(schemas []*jsonSchema, value interface{}) int {
+	matched := 0
+	for _, sub := range schemas {
+		errors := []SchemaError{}
+		sub.validate(value, "", &errors)
+		if len(errors) == 0 {
+			matched++
+		}
+	}
+	return matched
+}
+
+func (s *jsonSchema) validateNumber(v json.Number, fail func(string, ...interface{})) {
+	n, err := v.Float64()
+	if err != nil {
+		fail("is not a valid number")
+		return
+	}
+	if s.Minimum != nil && n < *s.Minimum {
+		fail("must be at least %v", *s.Minimum)
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		fail("must be at most %v", *s.Maximum)
+	}
+	if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+		fail("must be greater than %v", *s.ExclusiveMinimum)
+	}
+	if s.ExclusiveMaximum != nil && n >= *s.ExclusiveMaximum {
+		fail("must be less than %v", *s.ExclusiveMaximum)
+	}
+}
+
+func (s *jsonSchema) validateString(v string, fail func(string, ...interface{})) {
+	length := utf8.RuneCountInString(v)
+	if s.MinLength != nil && length < *s.MinLength {
+		fail("must be at least %d characters long", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		fail("must be at most %d characters long", *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(v) {
+		fail("must match the pattern %s", s.Pattern)
+	}
+}
+
+func (s *jsonSchema) validateArray(v []interface{}, path string, errors *[]SchemaError, fail func(string, ...interface{})) {
+	if s.MinItems != nil && len(v) < *s.MinItems {
+		fail("must have at least %d items", *s.MinItems)
+	}
+	if s.MaxItems != nil && len(v) > *s.MaxItems {
+		fail("must have at most %d items", *s.MaxItems)
+	}
+	if s.Items != nil {
+		for i, item := range v {
+			s.Items.validate(item, path+"/"+strconv.Itoa(i), errors)
+		}
+	}
+}
+
+func (s *jsonSchema) validateObject(v map[string]interface{}, path string, errors *[]SchemaError, fail func(string, ...interface{})) {
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			*errors = append(*errors, SchemaError{Path: path + "/" + escapeJSONPointer(name), Message: "is required"})
+		}
+	}
+
+	// Sorted so that the errors are in the same order for each request
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyPath := path + "/" + escapeJSONPointer(name)
+		if property, ok := s.Properties[name]; ok {
+			property.validate(v[name], propertyPath, errors)
+		} else if s.AdditionalProperties != nil {
+			s.AdditionalProperties.validate(v[name], propertyPath, errors)
+		}
+	}
+}
+
+// matches returns true when value is of one of the types
+func (t schemaTypes) matches(value interface{}) bool {
+	for _, name := range t {
+		switch v := value.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		case json.Number:
+			if name == "number" {
+				return true
+			}
+			if name == "integer" {
+				if n, err := v.Float64(); err == nil && n == math.Trunc(n) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// jsonEqual compares two decoded JSON values, numbers by their value
+func jsonEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, aErr := av.Float64()
+		bf, bErr := bv.Float64()
+		return aErr == nil && bErr == nil && af == bf
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			other, ok := bv[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// escapeJSONPointer escapes a key for a JSON Pointer
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
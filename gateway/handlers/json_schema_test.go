@@ -0,0 +1,95 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["id", "items"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "integer", "minimum": 1},
+		"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+		"status": {"enum": ["new", "paid"]},
+		"items": {
+			"type": "array",
+			"minItems": 1,
+			"items": {
+				"type": "object",
+				"required": ["sku"],
+				"properties": {
+					"sku": {"type": "string", "minLength": 3},
+					"quantity": {"type": "number", "exclusiveMinimum": 0}
+				}
+			}
+		}
+	}
+}`
+
+func validateTestPayload(t *testing.T, schema string, payload string) []SchemaError {
+	t.Helper()
+
+	parsed, err := parseJSONSchema([]byte(schema))
+	if err != nil {
+		t.Fatalf("unable to parse schema: %s", err)
+	}
+	value, err := decodeJSON([]byte(payload))
+	if err != nil {
+		t.Fatalf("unable to decode payload: %s", err)
+	}
+	return parsed.Validate(value)
+}
+
+func Test_jsonSchema_ValidPayload(t *testing.T) {
+	payload := `{"id": 12, "email": "a@b.com", "status": "paid", "items": [{"sku": "abc", "quantity": 2.5}]}`
+
+	if errors := validateTestPayload(t, orderSchema, payload); len(errors) > 0 {
+		t.Errorf("want no errors, got: %v", errors)
+	}
+}
+
+func Test_jsonSchema_InvalidPayload(t *testing.T) {
+	payload := `{"id": 1.5, "email": "nope", "status": "lost", "items": [{"quantity": 0}, {"sku": "ab"}], "extra": true}`
+
+	want := []SchemaError{
+		{Path: "/email", Message: "must match the pattern ^[^@]+@[^@]+$"},
+		{Path: "/extra", Message: "is not allowed"},
+		{Path: "/id", Message: "must be of type integer"},
+		{Path: "/items/0/sku", Message: "is required"},
+		{Path: "/items/0/quantity", Message: "must be greater than 0"},
+		{Path: "/items/1/sku", Message: "must be at least 3 characters long"},
+		{Path: "/status", Message: "must be one of the enumerated values"},
+	}
+	if got := validateTestPayload(t, orderSchema, payload); !reflect.DeepEqual(got, want) {
+		t.Errorf("errors want: %v, got: %v", want, got)
+	}
+}
+
+func Test_jsonSchema_Combinators(t *testing.T) {
+	schema := `{"oneOf": [{"type": "string"}, {"type": "integer"}], "not": {"const": 0}}`
+
+	for payload, valid := range map[string]bool{
+		`"text"`: true,
+		`7`:      true,
+		`0`:      false,
+		`1.5`:    false,
+		`null`:   false,
+	} {
+		if errors := validateTestPayload(t, schema, payload); (len(errors) == 0) != valid {
+			t.Errorf("payload %s valid want: %v, got errors: %v", payload, valid, errors)
+		}
+	}
+}
+
+func Test_parseJSONSchema_Invalid(t *testing.T) {
+	for _, schema := range []string{`{"type": "text"}`, `{"pattern": "("}`, `[1]`} {
+		if _, err := parseJSONSchema([]byte(schema)); err == nil {
+			t.Errorf("want an error for schema: %s", schema)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// KeepAliveAnnotation set to "false" closes the client's connection
+	// after each response from a function
+	KeepAliveAnnotation = "com.openfaas.keep-alive"
+
+	// KeepAliveMaxBytesAnnotation closes the client's connection after a
+	// response from a function with a Content-Length over this many bytes
+	KeepAliveMaxBytesAnnotation = "com.openfaas.keep-alive.max-bytes"
+)
+
+// MakeKeepAliveHandler sends Connection: close on the responses of
+// functions which have opted-out of keep-alive with the
+// com.openfaas.keep-alive annotation, or on those larger than their
+// com.openfaas.keep-alive.max-bytes annotation, so that the client's
+// connection is closed once the response has been written. The size of a
+// streamed response is not known when its headers are sent, so only a
+// Content-Length is compared. Client connections are kept alive by default.
+func MakeKeepAliveHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		keepAlive, maxBytes := readKeepAlive(annotations, functionName+"."+namespace)
+		if keepAlive && maxBytes <= 0 {
+			next(w, r)
+			return
+		}
+
+		next(&keepAliveResponseWriter{ResponseWriter: w, keepAlive: keepAlive, maxBytes: maxBytes}, r)
+	}
+}
+
+// readKeepAlive returns whether a function keeps its clients' connections
+// alive, and the largest response after which they are, 0 for any size
+func readKeepAlive(annotations map[string]string, function string) (bool, int64) {
+	keepAlive := true
+	if value, ok := annotations[KeepAliveAnnotation]; ok {
+		parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			log.Printf("Keep-alive: invalid %s annotation %q for %s, connections are kept alive\n",
+				KeepAliveAnnotation, value, function)
+		} else {
+			keepAlive = parsed
+		}
+	}
+
+	var maxBytes int64
+	if value, ok := annotations[KeepAliveMaxBytesAnnotation]; ok {
+		parsed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || parsed < 0 {
+			log.Printf("Keep-alive: invalid %s annotation %q for %s, ignored\n",
+				KeepAliveMaxBytesAnnotation, value, function)
+		} else {
+			maxBytes = parsed
+		}
+	}
+
+	return keepAlive, maxBytes
+}
+
+// keepAliveResponseWriter sets Connection: close as the final status is
+// written, after the function's own headers have been copied
+type keepAliveResponseWriter struct {
+	http.ResponseWriter
+	keepAlive   bool
+	maxBytes    int64
+	wroteHeader bool
+}
+
+func (k *keepAliveResponseWriter) WriteHeader(status int) {
+	// Informational responses such as 103 Early Hints are followed by the
+	// final status
+	if !k.wroteHeader && status >= http.StatusOK {
+		k.wroteHeader = true
+		if k.closeConnection() {
+			k.Header().Set("Connection", "close")
+		}
+	}
+	k.ResponseWriter.WriteHeader(status)
+}
+
+func (k *keepAliveResponseWriter) Write(data []byte) (int, error) {
+	if !k.wroteHeader {
+		k.WriteHeader(http.StatusOK)
+	}
+	return k.ResponseWriter.Write(data)
+}
+
+func (k *keepAliveResponseWriter) Flush() {
+	if flusher, ok := k.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (k *keepAliveResponseWriter) closeConnection() bool {
+	if !k.keepAlive {
+		return true
+	}
+
+	length, err := strconv.ParseInt(k.Header().Get("Content-Length"), 10, 64)
+	return err == nil && length > k.maxBytes
+}
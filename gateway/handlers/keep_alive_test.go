@@ -0,0 +1,81 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func Test_MakeKeepAliveHandler(t *testing.T) {
+	scenarios := []struct {
+		name        string
+		annotations map[string]string
+		length      int
+		streamed    bool
+		wantClose   bool
+	}{
+		{name: "kept alive by default", annotations: map[string]string{}, length: 1024},
+		{name: "opted-out", annotations: map[string]string{KeepAliveAnnotation: "false"}, length: 10, wantClose: true},
+		{name: "invalid annotation", annotations: map[string]string{KeepAliveAnnotation: "sometimes"}, length: 10},
+		{name: "within max-bytes", annotations: map[string]string{KeepAliveMaxBytesAnnotation: "1024"}, length: 1024},
+		{name: "over max-bytes", annotations: map[string]string{KeepAliveMaxBytesAnnotation: "1024"}, length: 1025, wantClose: true},
+		{name: "streamed over max-bytes", annotations: map[string]string{KeepAliveMaxBytesAnnotation: "1024"}, length: 2048, streamed: true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			handler := MakeKeepAliveHandler(func(w http.ResponseWriter, r *http.Request) {
+				if !s.streamed {
+					w.Header().Set("Content-Length", strconv.Itoa(s.length))
+				}
+				w.Write(make([]byte, s.length))
+			}, fakeFunctionQuery{annotations: s.annotations}, "openfaas-fn")
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+			got := rec.Header().Get("Connection") == "close"
+			if got != s.wantClose {
+				t.Errorf("Connection: close want: %v, got: %v", s.wantClose, got)
+			}
+		})
+	}
+}
+
+func Test_MakeKeepAliveHandler_AfterEarlyHints(t *testing.T) {
+	handler := MakeKeepAliveHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusNoContent)
+	}, fakeFunctionQuery{annotations: map[string]string{KeepAliveAnnotation: "false"}}, "openfaas-fn")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if got := rec.Header().Get("Connection"); got != "close" {
+		t.Errorf("Connection want: %s, got: %q", "close", got)
+	}
+}
+
+func Test_MakeKeepAliveHandler_ClosesServerConnection(t *testing.T) {
+	handler := MakeKeepAliveHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	}, fakeFunctionQuery{annotations: map[string]string{KeepAliveAnnotation: "false"}}, "openfaas-fn")
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/function/figlet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if !res.Close {
+		t.Errorf("want the server to close the connection")
+	}
+}
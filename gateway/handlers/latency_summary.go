@@ -0,0 +1,248 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// latencySlots is how many parts the window is split into, the oldest
+	// part is dropped as the window rolls forward
+	latencySlots = 6
+
+	// latencyBuckets with a growth of latencyGrowth from latencyMin cover
+	// latencies from 100µs to over 6 minutes
+	latencyBuckets = 160
+	latencyGrowth  = 1.1
+	latencyMin     = float64(100 * time.Microsecond)
+)
+
+// FunctionLatency is the latency of a function's invocations over the
+// window in milliseconds
+type FunctionLatency struct {
+	Function string  `json:"function"`
+	Count    uint64  `json:"count"`
+	P50      float64 `json:"p50"`
+	P90      float64 `json:"p90"`
+	P99      float64 `json:"p99"`
+}
+
+// LatencySummary estimates latency percentiles per function over a rolling
+// window. Each function has a fixed-size histogram of exponential buckets
+// for every slot of the window, so memory does not grow with traffic and a
+// percentile is at most 10% above the true value. Up to MaxFunctions are
+// summarised at once, with no limit when 0.
+type LatencySummary struct {
+	MaxFunctions int
+
+	slot      time.Duration
+	functions map[string]*latencyHistogram
+	lock      sync.Mutex
+	now       func() time.Time
+}
+
+type latencyHistogram struct {
+	slots [latencySlots]latencySlot
+}
+
+type latencySlot struct {
+	index  int64
+	total  uint64
+	counts [latencyBuckets]uint32
+}
+
+// NewLatencySummary creates a LatencySummary over window for up to
+// maxFunctions
+func NewLatencySummary(window time.Duration, maxFunctions int) *LatencySummary {
+	slot := window / latencySlots
+	if slot <= 0 {
+		slot = time.Second
+	}
+
+	return &LatencySummary{
+		MaxFunctions: maxFunctions,
+		slot:         slot,
+		functions:    make(map[string]*latencyHistogram),
+		now:          time.Now,
+	}
+}
+
+// Record adds an invocation of function which took duration. When
+// MaxFunctions are already summarised, functions which have not been invoked
+// within the window are removed to make room, otherwise the invocation of a
+// new function is dropped.
+func (s *LatencySummary) Record(function string, duration time.Duration) {
+	index := s.now().UnixNano() / int64(s.slot)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	histogram, ok := s.functions[function]
+	if !ok {
+		if s.MaxFunctions > 0 && len(s.functions) >= s.MaxFunctions {
+			s.prune(index - latencySlots + 1)
+			if len(s.functions) >= s.MaxFunctions {
+				return
+			}
+		}
+		histogram = &latencyHistogram{}
+		s.functions[function] = histogram
+	}
+
+	slot := &histogram.slots[index%latencySlots]
+	if slot.index != index {
+		*slot = latencySlot{index: index}
+	}
+	slot.counts[latencyBucket(duration)]++
+	slot.total++
+}
+
+// prune removes the functions without an invocation since the oldest slot
+func (s *LatencySummary) prune(oldest int64) {
+	for function, histogram := range s.functions {
+		if !histogram.invokedSince(oldest) {
+			delete(s.functions, function)
+		}
+	}
+}
+
+func (h *latencyHistogram) invokedSince(oldest int64) bool {
+	for _, slot := range h.slots {
+		if slot.index >= oldest && slot.total > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Latencies returns the percentiles of each function invoked within the
+// window sorted by function name, the others are removed
+func (s *LatencySummary) Latencies() []FunctionLatency {
+	oldest := s.now().UnixNano()/int64(s.slot) - latencySlots + 1
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	latencies := make([]FunctionLatency, 0, len(s.functions))
+	for function, histogram := range s.functions {
+		var counts [latencyBuckets]uint64
+		var total uint64
+		for _, slot := range histogram.slots {
+			if slot.index < oldest || slot.total == 0 {
+				continue
+			}
+			for i, count := range slot.counts {
+				counts[i] += uint64(count)
+			}
+			total += slot.total
+		}
+
+		if total == 0 {
+			delete(s.functions, function)
+			continue
+		}
+
+		latencies = append(latencies, FunctionLatency{
+			Function: function,
+			Count:    total,
+			P50:      latencyPercentile(counts, total, 0.5),
+			P90:      latencyPercentile(counts, total, 0.9),
+			P99:      latencyPercentile(counts, total, 0.99),
+		})
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i].Function < latencies[j].Function
+	})
+	return latencies
+}
+
+// latencyBucket returns the first bucket whose upper bound is at least d
+func latencyBucket(d time.Duration) int {
+	if float64(d) <= latencyMin {
+		return 0
+	}
+
+	bucket := int(math.Ceil(math.Log(float64(d)/latencyMin) / math.Log(latencyGrowth)))
+	if bucket >= latencyBuckets {
+		return latencyBuckets - 1
+	}
+	return bucket
+}
+
+// latencyPercentile returns the upper bound in milliseconds of the bucket
+// holding the q'th percentile
+func latencyPercentile(counts [latencyBuckets]uint64, total uint64, q float64) float64 {
+	rank := uint64(math.Ceil(q * float64(total)))
+
+	var seen uint64
+	bucket := 0
+	for i, count := range counts {
+		seen += count
+		if seen >= rank {
+			bucket = i
+			break
+		}
+	}
+
+	upper := latencyMin * math.Pow(latencyGrowth, float64(bucket))
+	return math.Round(upper/float64(time.Millisecond)*1000) / 1000
+}
+
+// LatencySummaryNotifier records the duration of completed invocations in
+// a LatencySummary
+type LatencySummaryNotifier struct {
+	Summary *LatencySummary
+
+	// FunctionQuery when set, only invocations of functions which it finds
+	// are recorded, so that requests for any name cannot fill the summary
+	FunctionQuery scaling.FunctionQuery
+
+	// FunctionNamespace default namespace of the function
+	FunctionNamespace string
+}
+
+// Notify records the duration of a completed invocation
+func (n LatencySummaryNotifier) Notify(method string, URL string, originalURL string, statusCode int, event string, duration time.Duration) {
+	if event != "completed" {
+		return
+	}
+
+	functionName, namespace := middleware.GetNamespace(n.FunctionNamespace, middleware.GetServiceName(originalURL))
+	if len(functionName) == 0 {
+		return
+	}
+	if n.FunctionQuery != nil {
+		if _, err := n.FunctionQuery.Get(functionName, namespace); err != nil {
+			return
+		}
+	}
+	n.Summary.Record(functionName+"."+namespace, duration)
+}
+
+// MakeLatencySummaryHandler returns the latency percentiles of each function as JSON
+func MakeLatencySummaryHandler(summary *LatencySummary) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonOut, err := json.Marshal(summary.Latencies())
+		if err != nil {
+			log.Printf("Error marshalling latency summary: %s\n", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonOut)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_LatencySummary_Percentiles(t *testing.T) {
+	summary := NewLatencySummary(time.Minute, 0)
+	for i := 1; i <= 100; i++ {
+		summary.Record("figlet.openfaas-fn", time.Duration(i)*time.Millisecond)
+	}
+
+	got := summary.Latencies()
+	if len(got) != 1 {
+		t.Fatalf("want latencies for 1 function, got: %v", got)
+	}
+
+	if got[0].Count != 100 {
+		t.Errorf("Count want: %d, got: %d", 100, got[0].Count)
+	}
+
+	for _, tc := range []struct {
+		name string
+		want float64
+		got  float64
+	}{
+		{name: "p50", want: 50, got: got[0].P50},
+		{name: "p90", want: 90, got: got[0].P90},
+		{name: "p99", want: 99, got: got[0].P99},
+	} {
+		if tc.got < tc.want || tc.got > tc.want*latencyGrowth {
+			t.Errorf("%s want: %.1fms to %.1fms, got: %.3fms", tc.name, tc.want, tc.want*latencyGrowth, tc.got)
+		}
+	}
+}
+
+func Test_LatencySummary_WindowRollsForward(t *testing.T) {
+	now := time.Now()
+	summary := NewLatencySummary(time.Minute, 0)
+	summary.now = func() time.Time { return now }
+
+	summary.Record("figlet.openfaas-fn", time.Second)
+	summary.Record("nodeinfo.openfaas-fn", time.Second)
+
+	now = now.Add(time.Second * 30)
+	summary.Record("figlet.openfaas-fn", time.Millisecond)
+
+	got := summary.Latencies()
+	if len(got) != 2 || got[0].Count != 2 {
+		t.Fatalf("want 2 invocations of figlet within the window, got: %v", got)
+	}
+
+	now = now.Add(time.Second * 45)
+	got = summary.Latencies()
+	if len(got) != 1 || got[0].Function != "figlet.openfaas-fn" || got[0].Count != 1 {
+		t.Fatalf("want only the latest invocation of figlet, got: %v", got)
+	}
+	if got[0].P99 > latencyGrowth {
+		t.Errorf("p99 want: about 1ms, got: %.3fms", got[0].P99)
+	}
+
+	if _, ok := summary.functions["nodeinfo.openfaas-fn"]; ok {
+		t.Errorf("want nodeinfo to be removed once outside the window")
+	}
+}
+
+func Test_LatencySummary_BucketsAreBounded(t *testing.T) {
+	if got := latencyBucket(0); got != 0 {
+		t.Errorf("want bucket 0 for no latency, got: %d", got)
+	}
+	if got := latencyBucket(time.Hour); got != latencyBuckets-1 {
+		t.Errorf("want the last bucket for an hour, got: %d", got)
+	}
+}
+
+func Test_LatencySummaryNotifier_RecordsCompleted(t *testing.T) {
+	summary := NewLatencySummary(time.Minute, 0)
+	notifier := LatencySummaryNotifier{Summary: summary, FunctionNamespace: "openfaas-fn"}
+
+	notifier.Notify(http.MethodGet, "/function/figlet", "/function/figlet", http.StatusProcessing, "started", 0)
+	notifier.Notify(http.MethodGet, "/function/figlet", "/function/figlet", http.StatusOK, "completed", time.Millisecond)
+	notifier.Notify(http.MethodGet, "/function/figlet.dev", "/function/figlet.dev", http.StatusOK, "completed", time.Millisecond)
+
+	got := summary.Latencies()
+	if len(got) != 2 || got[0].Function != "figlet.dev" || got[1].Function != "figlet.openfaas-fn" || got[1].Count != 1 {
+		t.Errorf("want 1 invocation of each function, got: %v", got)
+	}
+}
+
+func Test_LatencySummary_MaxFunctions(t *testing.T) {
+	now := time.Now()
+	summary := NewLatencySummary(time.Minute, 2)
+	summary.now = func() time.Time { return now }
+
+	summary.Record("a", time.Millisecond)
+	summary.Record("b", time.Millisecond)
+	summary.Record("c", time.Millisecond)
+	summary.Record("a", time.Millisecond)
+
+	if _, ok := summary.functions["c"]; ok || len(summary.functions) != 2 {
+		t.Fatalf("want c dropped whilst a and b are within the window, got: %v", summary.Latencies())
+	}
+
+	now = now.Add(time.Minute * 2)
+	summary.Record("c", time.Millisecond)
+
+	got := summary.Latencies()
+	if len(got) != 1 || got[0].Function != "c" {
+		t.Errorf("want a and b pruned to make room for c, got: %v", got)
+	}
+}
+
+func Test_LatencySummaryNotifier_OnlyFoundFunctions(t *testing.T) {
+	summary := NewLatencySummary(time.Minute, 0)
+	notifier := LatencySummaryNotifier{
+		Summary:           summary,
+		FunctionQuery:     &namespacedFunctionQuery{err: fmt.Errorf("not found")},
+		FunctionNamespace: "openfaas-fn",
+	}
+
+	notifier.Notify(http.MethodGet, "/function/missing", "/function/missing", http.StatusNotFound, "completed", time.Millisecond)
+	if got := summary.Latencies(); len(got) != 0 {
+		t.Errorf("want functions which are not found skipped, got: %v", got)
+	}
+
+	notifier.FunctionQuery = &namespacedFunctionQuery{}
+	notifier.Notify(http.MethodGet, "/function/figlet", "/function/figlet", http.StatusOK, "completed", time.Millisecond)
+	if got := summary.Latencies(); len(got) != 1 {
+		t.Errorf("want the found function recorded, got: %v", got)
+	}
+}
+
+func Test_MakeLatencySummaryHandler(t *testing.T) {
+	summary := NewLatencySummary(time.Minute, 0)
+	summary.Record("figlet.openfaas-fn", time.Millisecond*20)
+
+	rr := httptest.NewRecorder()
+	MakeLatencySummaryHandler(summary)(rr, httptest.NewRequest(http.MethodGet, "/system/functions/latency", nil))
+
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type want: application/json, got: %s", got)
+	}
+
+	var got []FunctionLatency
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Count != 1 || got[0].P50 < 20 {
+		t.Errorf("want 1 invocation of 20ms, got: %v", got)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/metrics"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// MaxConcurrencyAnnotation is the maximum amount of in-flight requests for a function
+	MaxConcurrencyAnnotation = "com.openfaas.concurrency.max"
+
+	// HighWaterAnnotation is the percentage of the maximum concurrency after which
+	// low priority requests are shed, default 80
+	HighWaterAnnotation = "com.openfaas.concurrency.high-water"
+
+	// CostClassHeader names the cost class of a request, i.e. "high", whose
+	// weight is counted against a function's concurrency
+	CostClassHeader = "X-Cost-Class"
+
+	defaultHighWaterPercent = 80
+
+	priorityLow    = "low"
+	priorityNormal = "normal"
+	priorityHigh   = "high"
+)
+
+// InFlightCounter tracks in-flight requests per function
+type InFlightCounter struct {
+	counts map[string]int64
+	idle   map[string]chan struct{}
+	lock   sync.Mutex
+}
+
+// NewInFlightCounter creates an InFlightCounter
+func NewInFlightCounter() *InFlightCounter {
+	return &InFlightCounter{
+		counts: make(map[string]int64),
+		idle:   make(map[string]chan struct{}),
+	}
+}
+
+// Acquire increments the in-flight count for a function when it is below
+// limit and returns true, a limit of 0 or less is unlimited
+func (c *InFlightCounter) Acquire(function string, limit int64) bool {
+	return c.AcquireWeight(function, 1, limit)
+}
+
+// AcquireWeight adds weight to the in-flight count for a function when the
+// count stays within limit and returns true, a limit of 0 or less is
+// unlimited. A weight over the limit is only admitted when nothing else is
+// in-flight, so that it is not rejected forever.
+func (c *InFlightCounter) AcquireWeight(function string, weight, limit int64) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	count := c.counts[function]
+	if limit > 0 && count > 0 && count+weight > limit {
+		return false
+	}
+	c.counts[function] = count + weight
+	return true
+}
+
+// Release decrements the in-flight count for a function
+func (c *InFlightCounter) Release(function string) {
+	c.ReleaseWeight(function, 1)
+}
+
+// ReleaseWeight removes the weight of a request from the in-flight count
+// for a function
+func (c *InFlightCounter) ReleaseWeight(function string, weight int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.counts[function] -= weight
+	if c.counts[function] <= 0 {
+		delete(c.counts, function)
+
+		if idle, ok := c.idle[function]; ok {
+			close(idle)
+			delete(c.idle, function)
+		}
+	}
+}
+
+// WaitIdle waits up to timeout for a function to have no requests in-flight
+// and returns false when some are still in-flight. A function which is sent
+// requests continuously may never be idle, so its callers wait the full
+// timeout.
+func (c *InFlightCounter) WaitIdle(function string, timeout time.Duration) bool {
+	c.lock.Lock()
+	if c.counts[function] <= 0 {
+		c.lock.Unlock()
+		return true
+	}
+	idle, ok := c.idle[function]
+	if !ok {
+		idle = make(chan struct{})
+		c.idle[function] = idle
+	}
+	c.lock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-idle:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// countedKey marks a request counted by MakeInFlightHandler
+type countedKey struct{}
+
+type countedRequest struct {
+	inFlight *InFlightCounter
+	function string
+	weight   int64
+}
+
+// admit returns true when r to function is within limit in the same way as
+// AcquireWeight. A request counted by MakeInFlightHandler with c is already
+// in the count, so it is checked rather than counted again, otherwise it is
+// counted with weight. release must be called once r has completed.
+func (c *InFlightCounter) admit(r *http.Request, function string, weight, limit int64) (func(), bool) {
+	counted, ok := r.Context().Value(countedKey{}).(countedRequest)
+	if !ok || counted.inFlight != c || counted.function != function {
+		if !c.AcquireWeight(function, weight, limit) {
+			return nil, false
+		}
+		return func() { c.ReleaseWeight(function, weight) }, true
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	count := c.counts[function]
+	if limit > 0 && count > counted.weight && count > limit {
+		return nil, false
+	}
+	return func() {}, true
+}
+
+// InFlight returns the in-flight count for a function, the sum of the
+// weights of its requests
+func (c *InFlightCounter) InFlight(function string) int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.counts[function]
+}
+
+// MakeLoadSheddingHandler sheds requests for functions with the
+// com.openfaas.concurrency.max annotation based upon the X-Priority header.
+// "low" priority requests are shed once in-flight requests reach the
+// high-water mark, "normal" (default) requests once they reach the maximum
+// and "high" priority requests are always admitted.
+//
+// Each request counts towards the in-flight requests with the weight of its
+// X-Cost-Class header in costWeights, so that fewer expensive requests run
+// at once. Requests without a class, or with one which is not listed, have
+// a weight of 1.
+func MakeLoadSheddingHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, inFlight *InFlightCounter, costWeights map[string]int64, metricsOptions metrics.MetricOptions, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		maxConcurrency, highWater := readConcurrencyLimits(annotations)
+		if maxConcurrency <= 0 {
+			next(w, r)
+			return
+		}
+
+		key := functionName + "." + namespace
+		priority := readPriority(r.Header.Get("X-Priority"))
+
+		var limit int64
+		switch priority {
+		case priorityLow:
+			limit = highWater
+		case priorityNormal:
+			limit = maxConcurrency
+		}
+
+		weight := readCostWeight(r.Header.Get(CostClassHeader), costWeights)
+		release, ok := inFlight.admit(r, key, weight, limit)
+		if !ok {
+			metricsOptions.GatewayFunctionShed.WithLabelValues(key, priority).Inc()
+
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, http.StatusServiceUnavailable, key,
+				fmt.Sprintf("function %s is overloaded, %s priority request shed", key, priority))
+			return
+		}
+		defer release()
+
+		next(w, r)
+	}
+}
+
+// readConcurrencyLimits returns the maximum concurrency and high-water mark
+// from a function's annotations, the maximum is 0 when not set
+func readConcurrencyLimits(annotations map[string]string) (int64, int64) {
+	maxConcurrency, err := strconv.ParseInt(strings.TrimSpace(annotations[MaxConcurrencyAnnotation]), 10, 64)
+	if err != nil || maxConcurrency <= 0 {
+		return 0, 0
+	}
+
+	percent := int64(defaultHighWaterPercent)
+	if value, ok := annotations[HighWaterAnnotation]; ok {
+		if parsed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil && parsed > 0 && parsed <= 100 {
+			percent = parsed
+		}
+	}
+
+	highWater := maxConcurrency * percent / 100
+	if highWater < 1 {
+		highWater = 1
+	}
+	return maxConcurrency, highWater
+}
+
+// readCostWeight returns the weight of a cost class, 1 when it has none
+func readCostWeight(value string, costWeights map[string]int64) int64 {
+	if weight, ok := costWeights[strings.ToLower(strings.TrimSpace(value))]; ok && weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+func readPriority(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case priorityLow:
+		return priorityLow
+	case priorityHigh:
+		return priorityHigh
+	}
+	return priorityNormal
+}
@@ -0,0 +1,177 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openfaas/faas/gateway/metrics"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func Test_MakeLoadSheddingHandler_ShedsByPriority(t *testing.T) {
+	query := fakeFunctionQuery{annotations: map[string]string{
+		MaxConcurrencyAnnotation: "2",
+		HighWaterAnnotation:      "50",
+	}}
+	inFlight := NewInFlightCounter()
+	metricsOptions := metrics.BuildMetricsOptions()
+
+	// One request is already in-flight, which is at the high-water mark
+	inFlight.Acquire("figlet.openfaas-fn", 0)
+
+	handler := MakeLoadSheddingHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, query, inFlight, nil, metricsOptions, "openfaas-fn")
+
+	scenarios := []struct {
+		priority   string
+		wantStatus int
+	}{
+		{priority: "low", wantStatus: http.StatusServiceUnavailable},
+		{priority: "", wantStatus: http.StatusOK},
+		{priority: "high", wantStatus: http.StatusOK},
+	}
+
+	for _, s := range scenarios {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+		req.Header.Set("X-Priority", s.priority)
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != s.wantStatus {
+			t.Errorf("priority %q status want: %d, got: %d", s.priority, s.wantStatus, rec.Code)
+		}
+	}
+
+	if got := inFlight.InFlight("figlet.openfaas-fn"); got != 1 {
+		t.Errorf("in-flight want: %d, got: %d", 1, got)
+	}
+
+	shed := &dto.Metric{}
+	metricsOptions.GatewayFunctionShed.WithLabelValues("figlet.openfaas-fn", "low").Write(shed)
+	if got := shed.GetCounter().GetValue(); got != 1 {
+		t.Errorf("shed count want: %d, got: %f", 1, got)
+	}
+}
+
+func Test_MakeLoadSheddingHandler_WeightsByCostClass(t *testing.T) {
+	query := fakeFunctionQuery{annotations: map[string]string{
+		MaxConcurrencyAnnotation: "4",
+		HighWaterAnnotation:      "50",
+	}}
+	costWeights := map[string]int64{"high": 3, "medium": 2}
+
+	scenarios := []struct {
+		name       string
+		inFlight   int64
+		costClass  string
+		priority   string
+		wantStatus int
+		wantCount  int64
+	}{
+		{name: "no class has a weight of 1", inFlight: 3, wantStatus: http.StatusOK, wantCount: 4},
+		{name: "unknown class has a weight of 1", inFlight: 3, costClass: "extreme", wantStatus: http.StatusOK, wantCount: 4},
+		{name: "high cost within the limit", inFlight: 1, costClass: "high", wantStatus: http.StatusOK, wantCount: 4},
+		{name: "high cost over the limit", inFlight: 2, costClass: "HIGH", wantStatus: http.StatusServiceUnavailable, wantCount: 2},
+		{name: "medium cost over the high-water mark", inFlight: 1, costClass: "medium", priority: "low", wantStatus: http.StatusServiceUnavailable, wantCount: 1},
+		{name: "high priority is always admitted", inFlight: 4, costClass: "high", priority: "high", wantStatus: http.StatusOK, wantCount: 7},
+	}
+
+	for _, s := range scenarios {
+		inFlight := NewInFlightCounter()
+		inFlight.AcquireWeight("figlet.openfaas-fn", s.inFlight, 0)
+
+		var count int64
+		handler := MakeLoadSheddingHandler(func(w http.ResponseWriter, r *http.Request) {
+			count = inFlight.InFlight("figlet.openfaas-fn")
+		}, query, inFlight, costWeights, metrics.BuildMetricsOptions(), "openfaas-fn")
+
+		count = s.inFlight
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+		req.Header.Set(CostClassHeader, s.costClass)
+		req.Header.Set("X-Priority", s.priority)
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != s.wantStatus {
+			t.Errorf("%s: status want: %d, got: %d", s.name, s.wantStatus, rec.Code)
+		}
+		if count != s.wantCount {
+			t.Errorf("%s: in-flight whilst running want: %d, got: %d", s.name, s.wantCount, count)
+		}
+		if got := inFlight.InFlight("figlet.openfaas-fn"); got != s.inFlight {
+			t.Errorf("%s: in-flight after want: %d, got: %d", s.name, s.inFlight, got)
+		}
+	}
+}
+
+func Test_InFlightCounter_AcquireWeight(t *testing.T) {
+	c := NewInFlightCounter()
+
+	// A request heavier than the limit is admitted whilst nothing else is
+	if !c.AcquireWeight("figlet", 5, 4) {
+		t.Fatalf("want a heavy request admitted when idle")
+	}
+	if c.AcquireWeight("figlet", 1, 4) {
+		t.Errorf("want a request rejected whilst over the limit")
+	}
+	c.ReleaseWeight("figlet", 5)
+
+	if !c.AcquireWeight("figlet", 3, 4) || !c.Acquire("figlet", 4) {
+		t.Fatalf("want requests admitted up to the limit")
+	}
+	if c.AcquireWeight("figlet", 2, 4) {
+		t.Errorf("want a weighted request rejected when it would exceed the limit")
+	}
+	if got := c.InFlight("figlet"); got != 4 {
+		t.Errorf("in-flight want: %d, got: %d", 4, got)
+	}
+}
+
+func Test_readConcurrencyLimits(t *testing.T) {
+	max, highWater := readConcurrencyLimits(map[string]string{MaxConcurrencyAnnotation: "10"})
+	if max != 10 || highWater != 8 {
+		t.Errorf("want: 10/8, got: %d/%d", max, highWater)
+	}
+
+	max, _ = readConcurrencyLimits(map[string]string{})
+	if max != 0 {
+		t.Errorf("want shedding to be disabled without the annotation, got: %d", max)
+	}
+}
+
+func Test_MakeLoadSheddingHandler_CountsOnceBehindInFlightHandler(t *testing.T) {
+	query := fakeFunctionQuery{annotations: map[string]string{
+		MaxConcurrencyAnnotation: "2",
+	}}
+	inFlight := NewInFlightCounter()
+	inFlight.Acquire("figlet.openfaas-fn", 0)
+
+	var count int64
+	handler := MakeInFlightHandler(MakeLoadSheddingHandler(func(w http.ResponseWriter, r *http.Request) {
+		count = inFlight.InFlight("figlet.openfaas-fn")
+	}, query, inFlight, nil, metrics.BuildMetricsOptions(), "openfaas-fn"), inFlight, nil, "openfaas-fn")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status want: %d, got: %d", http.StatusOK, rec.Code)
+	}
+	if count != 2 {
+		t.Errorf("in-flight whilst running want: %d, got: %d", 2, count)
+	}
+
+	// A third request is over the limit
+	inFlight.Acquire("figlet.openfaas-fn", 0)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status want: %d, got: %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if got := inFlight.InFlight("figlet.openfaas-fn"); got != 2 {
+		t.Errorf("in-flight after want: %d, got: %d", 2, got)
+	}
+}
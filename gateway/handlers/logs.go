@@ -32,7 +32,7 @@ func NewLogHandlerFunc(logProvider url.URL, timeout time.Duration) http.HandlerF
 			defer r.Body.Close()
 		}
 
-		logRequest := buildUpstreamRequest(r, upstreamLogProviderBase, upstreamLogsEndpoint)
+		logRequest := buildUpstreamRequest(r, upstreamLogProviderBase, upstreamLogsEndpoint, nil)
 		if logRequest.Body != nil {
 			defer logRequest.Body.Close()
 		}
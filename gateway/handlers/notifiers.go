@@ -69,5 +69,7 @@ type LoggingNotifier struct {
 func (LoggingNotifier) Notify(method string, URL string, originalURL string, statusCode int, event string, duration time.Duration) {
 	if event == "completed" {
 		log.Printf("Forwarded [%s] to %s - [%d] - %.4fs", method, originalURL, statusCode, duration.Seconds())
+	} else if event == "scaling" {
+		log.Printf("Scaling %s from zero", originalURL)
 	}
 }
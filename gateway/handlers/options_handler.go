@@ -0,0 +1,92 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// OptionsAnnotation decides how OPTIONS requests for a function are handled,
+	// either "forward" (default) or "gateway"
+	OptionsAnnotation = "com.openfaas.options"
+
+	// MethodsAnnotation is a comma-separated allow-list of HTTP methods for a function
+	MethodsAnnotation = "com.openfaas.methods"
+
+	optionsGateway = "gateway"
+)
+
+// defaultAllowedMethods is used for the Allow header when a function has
+// no method allow-list
+var defaultAllowedMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// MakeOptionsHandler answers OPTIONS requests in the gateway for functions
+// annotated with com.openfaas.options=gateway, all other requests are passed
+// to next. The Allow header is built from the com.openfaas.methods annotation.
+func MakeOptionsHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil {
+			log.Printf("Unable to query annotations for %s.%s: %s", functionName, namespace, err)
+			next(w, r)
+			return
+		}
+
+		if strings.TrimSpace(annotations[OptionsAnnotation]) != optionsGateway {
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("Allow", strings.Join(allowedMethods(annotations), ", "))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// allowedMethods parses the method allow-list from a function's annotations,
+// OPTIONS is always included.
+func allowedMethods(annotations map[string]string) []string {
+	value, ok := annotations[MethodsAnnotation]
+	if !ok || len(strings.TrimSpace(value)) == 0 {
+		return defaultAllowedMethods
+	}
+
+	methods := []string{}
+	hasOptions := false
+	for _, method := range strings.Split(value, ",") {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if len(method) == 0 {
+			continue
+		}
+		if method == http.MethodOptions {
+			hasOptions = true
+		}
+		methods = append(methods, method)
+	}
+
+	if !hasOptions {
+		methods = append(methods, http.MethodOptions)
+	}
+	return methods
+}
@@ -0,0 +1,68 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+type fakeFunctionQuery struct {
+	annotations map[string]string
+}
+
+func (f fakeFunctionQuery) Get(name string, namespace string) (scaling.ServiceQueryResponse, error) {
+	return scaling.ServiceQueryResponse{Annotations: &f.annotations}, nil
+}
+
+func (f fakeFunctionQuery) GetAnnotations(name string, namespace string) (map[string]string, error) {
+	return f.annotations, nil
+}
+
+func Test_MakeOptionsHandler_ForwardsByDefault(t *testing.T) {
+	visited := false
+	handler := MakeOptionsHandler(func(w http.ResponseWriter, r *http.Request) {
+		visited = true
+	}, fakeFunctionQuery{annotations: map[string]string{}}, "openfaas-fn")
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/function/figlet", nil)
+	handler.ServeHTTP(rec, req)
+
+	if !visited {
+		t.Errorf("want OPTIONS to be forwarded to the function")
+	}
+}
+
+func Test_MakeOptionsHandler_AnsweredByGateway(t *testing.T) {
+	visited := false
+	query := fakeFunctionQuery{annotations: map[string]string{
+		OptionsAnnotation: "gateway",
+		MethodsAnnotation: "get, post",
+	}}
+
+	handler := MakeOptionsHandler(func(w http.ResponseWriter, r *http.Request) {
+		visited = true
+	}, query, "openfaas-fn")
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/function/figlet", nil)
+	handler.ServeHTTP(rec, req)
+
+	if visited {
+		t.Errorf("want OPTIONS to be answered by the gateway")
+	}
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status want: %d, got: %d", http.StatusNoContent, rec.Code)
+	}
+
+	want := "GET, POST, OPTIONS"
+	if got := rec.Header().Get("Allow"); got != want {
+		t.Errorf("Allow want: %s, got: %s", want, got)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PublicURL finds the URL of the gateway as seen by its clients, for links
+// written into responses
+type PublicURL struct {
+	// URL when set is used for every request, in place of the request's
+	// Host header
+	URL *url.URL
+
+	// TrustedProxies is the amount of proxies in front of the gateway, the
+	// X-Forwarded-Proto and X-Forwarded-Host headers are only read when there
+	// is at least one, since a client can set them to anything
+	TrustedProxies int
+}
+
+// Base returns the scheme and host of the gateway for r, without a trailing
+// slash
+func (p PublicURL) Base(r *http.Request) string {
+	if p.URL != nil {
+		return strings.TrimSuffix(p.URL.String(), "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	if p.TrustedProxies > 0 {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if forwardedHost := strings.TrimSpace(r.Header.Get("X-Forwarded-Host")); len(forwardedHost) > 0 {
+			host = forwardedHost
+		}
+	}
+	return scheme + "://" + host
+}
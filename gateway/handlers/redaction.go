@@ -0,0 +1,245 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// RedactAnnotation is a comma-separated list of JSON paths to redact from a
+	// function's responses, i.e. "ssn,customer.cards.number". Arrays are
+	// traversed implicitly and "*" matches any key.
+	RedactAnnotation = "com.openfaas.redact"
+
+	// RedactModeAnnotation is either "mask" (default) or "remove"
+	RedactModeAnnotation = "com.openfaas.redact.mode"
+
+	redactModeRemove = "remove"
+
+	// redactedValue replaces masked fields
+	redactedValue = "[REDACTED]"
+)
+
+// MakeRedactionHandler removes or masks fields from JSON responses for
+// functions with the com.openfaas.redact annotation. Responses for these
+// functions are buffered up to maxBodyBytes whatever their Content-Type, so
+// that a JSON body sent with the wrong Content-Type is still redacted, and
+// larger responses are not passed on to the client since they cannot be
+// checked. A body which is neither declared nor sniffed as JSON is written
+// unchanged.
+//
+// Responses are buffered rather than redacted as they are streamed, as the
+// status code would already have been sent when a body turns out not to be
+// valid JSON part way through. The client would then receive a truncated
+// response with a success status rather than a 502 Bad Gateway.
+func MakeRedactionHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, defaultNamespace string, maxBodyBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil || len(strings.TrimSpace(annotations[RedactAnnotation])) == 0 {
+			next(w, r)
+			return
+		}
+
+		paths := parseRedactPaths(annotations[RedactAnnotation])
+		remove := strings.TrimSpace(annotations[RedactModeAnnotation]) == redactModeRemove
+
+		writer := &bufferedResponseWriter{
+			ResponseWriter: w,
+			maxBodyBytes:   maxBodyBytes,
+		}
+		next(writer, r)
+
+		if writer.overflow {
+			log.Printf("Redaction: response for %s.%s exceeds %d bytes\n", functionName, namespace, maxBodyBytes)
+			writeError(w, r, http.StatusBadGateway, functionName+"."+namespace,
+				fmt.Sprintf("response from function %s.%s is too large to redact", functionName, namespace))
+			return
+		}
+
+		body := writer.body.Bytes()
+		if len(bytes.TrimSpace(body)) > 0 && (isJSONContentType(w.Header().Get("Content-Type")) || looksLikeJSON(body)) {
+			redacted, err := redactJSON(body, paths, remove)
+			if err != nil {
+				log.Printf("Redaction: unable to parse response for %s.%s: %s\n", functionName, namespace, err)
+				writeError(w, r, http.StatusBadGateway, functionName+"."+namespace,
+					fmt.Sprintf("response from function %s.%s could not be redacted", functionName, namespace))
+				return
+			}
+			body = redacted
+		}
+
+		w.Header().Del("Content-Length")
+		w.WriteHeader(writer.Status())
+		w.Write(body)
+	}
+}
+
+// bufferedResponseWriter holds back the status code and body until the
+// wrapped handler has finished. When passThrough returns true for the
+// response headers the response is written directly to the client, as is
+// a body larger than maxBodyBytes when passThroughOverflow is set.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+
+	maxBodyBytes        int64
+	passThrough         func(header http.Header) bool
+	passThroughOverflow bool
+
+	statusCode     int
+	wroteHeader    bool
+	passingThrough bool
+	overflow       bool
+	body           bytes.Buffer
+}
+
+func (b *bufferedResponseWriter) Status() int {
+	if b.statusCode == 0 {
+		return http.StatusOK
+	}
+	return b.statusCode
+}
+
+func (b *bufferedResponseWriter) WriteHeader(code int) {
+	// Informational responses such as early hints go straight to the client
+	if code >= 100 && code <= 199 {
+		b.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if b.wroteHeader {
+		return
+	}
+	b.wroteHeader = true
+	b.statusCode = code
+
+	if b.passThrough != nil && b.passThrough(b.Header()) {
+		b.passingThrough = true
+		b.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	// A response which is known to overflow is not buffered at all
+	if b.passThroughOverflow && b.maxBodyBytes > 0 {
+		if length, err := strconv.ParseInt(b.Header().Get("Content-Length"), 10, 64); err == nil && length > b.maxBodyBytes {
+			b.passingThrough = true
+			b.ResponseWriter.WriteHeader(code)
+		}
+	}
+}
+
+func (b *bufferedResponseWriter) Write(data []byte) (int, error) {
+	if !b.wroteHeader {
+		b.WriteHeader(http.StatusOK)
+	}
+	if b.passingThrough {
+		return b.ResponseWriter.Write(data)
+	}
+	if b.overflow {
+		return len(data), nil
+	}
+	if b.maxBodyBytes > 0 && int64(b.body.Len()+len(data)) > b.maxBodyBytes {
+		if b.passThroughOverflow {
+			b.passingThrough = true
+			b.ResponseWriter.WriteHeader(b.Status())
+			if _, err := b.ResponseWriter.Write(b.body.Bytes()); err != nil {
+				return 0, err
+			}
+			b.body.Reset()
+			return b.ResponseWriter.Write(data)
+		}
+		b.overflow = true
+		b.body.Reset()
+		return len(data), nil
+	}
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponseWriter) Flush() {
+	if b.passingThrough {
+		if flusher, ok := b.ResponseWriter.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// looksLikeJSON returns true when body starts with a JSON object or array,
+// the only documents which can contain a path to redact
+func looksLikeJSON(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+func parseRedactPaths(value string) [][]string {
+	paths := [][]string{}
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if len(path) == 0 {
+			continue
+		}
+		paths = append(paths, strings.Split(path, "."))
+	}
+	return paths
+}
+
+func redactJSON(body []byte, paths [][]string, remove bool) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		redactPath(document, path, remove)
+	}
+
+	return json.Marshal(document)
+}
+
+func redactPath(value interface{}, path []string, remove bool) {
+	if len(path) == 0 {
+		return
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			redactPath(item, path, remove)
+		}
+	case map[string]interface{}:
+		for key, child := range v {
+			if key != path[0] && path[0] != "*" {
+				continue
+			}
+			if len(path) > 1 {
+				redactPath(child, path[1:], remove)
+			} else if remove {
+				delete(v, key)
+			} else {
+				v[key] = redactedValue
+			}
+		}
+	}
+}
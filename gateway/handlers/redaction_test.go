@@ -0,0 +1,140 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_redactJSON_MasksNestedFieldsInArrays(t *testing.T) {
+	body := []byte(`{"customers":[{"name":"alex","ssn":"123"},{"name":"sam","ssn":"456"}],"total":2}`)
+
+	got, err := redactJSON(body, parseRedactPaths("customers.ssn"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"customers":[{"name":"alex","ssn":"[REDACTED]"},{"name":"sam","ssn":"[REDACTED]"}],"total":2}`
+	if string(got) != want {
+		t.Errorf("want: %s, got: %s", want, string(got))
+	}
+}
+
+func Test_redactJSON_RemovesFields(t *testing.T) {
+	body := []byte(`{"name":"alex","ssn":"123"}`)
+
+	got, err := redactJSON(body, parseRedactPaths("ssn, missing.field"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"name":"alex"}`
+	if string(got) != want {
+		t.Errorf("want: %s, got: %s", want, string(got))
+	}
+}
+
+func Test_MakeRedactionHandler(t *testing.T) {
+	query := fakeFunctionQuery{annotations: map[string]string{RedactAnnotation: "ssn"}}
+
+	scenarios := []struct {
+		name        string
+		contentType string
+		body        string
+		maxBytes    int64
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			name:        "JSON is redacted",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"ssn":"123"}`,
+			maxBytes:    1024,
+			wantStatus:  http.StatusOK,
+			wantBody:    `{"ssn":"[REDACTED]"}`,
+		},
+		{
+			name:        "JSON sent as text is redacted",
+			contentType: "text/plain",
+			body:        ` {"ssn":"123"}`,
+			maxBytes:    1024,
+			wantStatus:  http.StatusOK,
+			wantBody:    `{"ssn":"[REDACTED]"}`,
+		},
+		{
+			name:       "JSON array without a Content-Type is redacted",
+			body:       `[{"ssn":"123"}]`,
+			maxBytes:   1024,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"ssn":"[REDACTED]"}]`,
+		},
+		{
+			name:        "text passes through",
+			contentType: "text/plain",
+			body:        `ssn: 123`,
+			maxBytes:    1024,
+			wantStatus:  http.StatusOK,
+			wantBody:    `ssn: 123`,
+		},
+		{
+			name:        "text over the size cap is rejected",
+			contentType: "text/plain",
+			body:        `{"ssn":"123"}`,
+			maxBytes:    4,
+			wantStatus:  http.StatusBadGateway,
+		},
+		{
+			name:        "invalid JSON is rejected",
+			contentType: "text/plain",
+			body:        `{"ssn":`,
+			maxBytes:    1024,
+			wantStatus:  http.StatusBadGateway,
+		},
+		{
+			name:        "JSON over the size cap is rejected",
+			contentType: "application/json",
+			body:        `{"ssn":"123"}`,
+			maxBytes:    4,
+			wantStatus:  http.StatusBadGateway,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			handler := MakeRedactionHandler(func(w http.ResponseWriter, r *http.Request) {
+				if len(s.contentType) > 0 {
+					w.Header().Set("Content-Type", s.contentType)
+				}
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(s.body))
+			}, query, "openfaas-fn", s.maxBytes)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != s.wantStatus {
+				t.Errorf("status want: %d, got: %d", s.wantStatus, rec.Code)
+			}
+			if len(s.wantBody) > 0 && rec.Body.String() != s.wantBody {
+				t.Errorf("body want: %s, got: %s", s.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func Test_bufferedResponseWriter_PassesThroughKnownOverflow(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writer := &bufferedResponseWriter{ResponseWriter: rec, maxBodyBytes: 4, passThroughOverflow: true}
+
+	writer.Header().Set("Content-Length", "5")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write([]byte("he"))
+
+	if rec.Body.String() != "he" {
+		t.Errorf("want the response passed through before it overflows, got: %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// MaxRedirectsAnnotation is how many redirects to the function itself are
+// followed by the gateway, so that the client receives the final response.
+// Redirects to other hosts are always passed to the client, as are all
+// redirects when the annotation is not set.
+const MaxRedirectsAnnotation = "com.openfaas.redirects.max"
+
+type maxRedirectsKey struct{}
+
+// MakeRedirectsHandler enables following internal redirects for functions
+// with the com.openfaas.redirects.max annotation
+func MakeRedirectsHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		maxRedirects, err := strconv.Atoi(strings.TrimSpace(annotations[MaxRedirectsAnnotation]))
+		if err != nil || maxRedirects <= 0 {
+			next(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), maxRedirectsKey{}, maxRedirects)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// errRedirectLoop is returned when a redirect leads back to a URL which was
+// already requested
+var errRedirectLoop = errors.New("redirect loop detected")
+
+// followRedirects follows redirects from res to the same host as req, up to
+// the maximum set for the function in r's context. The response which is not
+// followed is returned, the bodies of the others are closed. Only redirects
+// which can be repeated without a body are followed: those of a GET or HEAD
+// request, and 303 See Other.
+func followRedirects(ctx context.Context, r *http.Request, client *http.Client, req *http.Request, res *http.Response) (*http.Response, error) {
+	maxRedirects, _ := r.Context().Value(maxRedirectsKey{}).(int)
+	if maxRedirects <= 0 {
+		return res, nil
+	}
+
+	visited := map[string]bool{req.URL.String(): true}
+	for i := 0; i < maxRedirects; i++ {
+		next := redirectRequest(ctx, req, res)
+		if next == nil {
+			return res, nil
+		}
+
+		if visited[next.URL.String()] {
+			res.Body.Close()
+			return nil, errRedirectLoop
+		}
+		visited[next.URL.String()] = true
+
+		log.Printf("Following redirect %d/%d: %s => %s\n", i+1, maxRedirects, req.URL.Path, next.URL.Path)
+
+		// The redirect's body is drained so that its connection is re-used
+		io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+		res.Body.Close()
+
+		followed, err := client.Do(next)
+		if err != nil {
+			return nil, err
+		}
+		req, res = next, followed
+	}
+
+	return res, nil
+}
+
+// redirectRequest returns the request for a redirect to req's host, or nil
+// when res is not such a redirect
+func redirectRequest(ctx context.Context, req *http.Request, res *http.Response) *http.Request {
+	method := req.Method
+	switch res.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		if method != http.MethodGet && method != http.MethodHead {
+			return nil
+		}
+	case http.StatusSeeOther:
+		if method != http.MethodHead {
+			method = http.MethodGet
+		}
+	default:
+		return nil
+	}
+
+	location, err := req.URL.Parse(res.Header.Get("Location"))
+	if err != nil || len(res.Header.Get("Location")) == 0 {
+		return nil
+	}
+	if location.Scheme != req.URL.Scheme || location.Host != req.URL.Host {
+		return nil
+	}
+
+	next, err := http.NewRequestWithContext(ctx, method, location.String(), nil)
+	if err != nil {
+		return nil
+	}
+	next.Header = req.Header.Clone()
+	next.Header.Del("Content-Length")
+	next.Header.Del("Content-Type")
+	return next
+}
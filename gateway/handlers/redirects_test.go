@@ -0,0 +1,112 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func makeRedirectingFunctionHandler(t *testing.T, annotations map[string]string) (http.HandlerFunc, *testNotifier) {
+	forwarding, _, notifier := makeFunctionProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/function/figlet":
+			http.Redirect(w, r, "/function/figlet/v2", http.StatusFound)
+		case "/function/figlet/v2":
+			http.Redirect(w, r, "v3?q=1", http.StatusMovedPermanently)
+		case "/function/figlet/v3":
+			w.Write([]byte("final " + r.URL.RawQuery))
+		case "/function/figlet/loop":
+			http.Redirect(w, r, "/function/figlet/loop-back", http.StatusFound)
+		case "/function/figlet/loop-back":
+			http.Redirect(w, r, "/function/figlet/loop", http.StatusFound)
+		case "/function/figlet/external":
+			http.Redirect(w, r, "https://www.openfaas.com/", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}, time.Second)
+
+	return MakeRedirectsHandler(forwarding, fakeFunctionQuery{annotations: annotations}, "openfaas-fn"), notifier
+}
+
+func Test_Redirects_PassedThroughByDefault(t *testing.T) {
+	handler, _ := makeRedirectingFunctionHandler(t, map[string]string{})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if rr.Code != http.StatusFound {
+		t.Errorf("status want: %d, got: %d", http.StatusFound, rr.Code)
+	}
+	if got := rr.Header().Get("Location"); got != "/function/figlet/v2" {
+		t.Errorf("Location want: %s, got: %s", "/function/figlet/v2", got)
+	}
+}
+
+func Test_Redirects_FollowsInternalRedirects(t *testing.T) {
+	handler, _ := makeRedirectingFunctionHandler(t, map[string]string{MaxRedirectsAnnotation: "3"})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("status want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+	if rr.Body.String() != "final q=1" {
+		t.Errorf("body want: %q, got: %q", "final q=1", rr.Body.String())
+	}
+}
+
+func Test_Redirects_StopsAtMaxDepth(t *testing.T) {
+	handler, _ := makeRedirectingFunctionHandler(t, map[string]string{MaxRedirectsAnnotation: "1"})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if rr.Code != http.StatusMovedPermanently {
+		t.Errorf("status want: %d, got: %d", http.StatusMovedPermanently, rr.Code)
+	}
+}
+
+func Test_Redirects_PassesExternalRedirects(t *testing.T) {
+	handler, _ := makeRedirectingFunctionHandler(t, map[string]string{MaxRedirectsAnnotation: "3"})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet/external", nil))
+
+	if rr.Code != http.StatusFound {
+		t.Errorf("status want: %d, got: %d", http.StatusFound, rr.Code)
+	}
+	if got := rr.Header().Get("Location"); got != "https://www.openfaas.com/" {
+		t.Errorf("Location want: %s, got: %s", "https://www.openfaas.com/", got)
+	}
+}
+
+func Test_Redirects_NotFollowedForPost(t *testing.T) {
+	handler, _ := makeRedirectingFunctionHandler(t, map[string]string{MaxRedirectsAnnotation: "3"})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/function/figlet", nil))
+
+	if rr.Code != http.StatusFound {
+		t.Errorf("status want: %d, got: %d", http.StatusFound, rr.Code)
+	}
+}
+
+func Test_Redirects_DetectsLoops(t *testing.T) {
+	handler, notifier := makeRedirectingFunctionHandler(t, map[string]string{MaxRedirectsAnnotation: "10"})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet/loop", nil))
+
+	if rr.Code != http.StatusLoopDetected {
+		t.Errorf("status want: %d, got: %d", http.StatusLoopDetected, rr.Code)
+	}
+	if notifier.StatusReceived != http.StatusLoopDetected {
+		t.Errorf("notifier status want: %d, got: %d", http.StatusLoopDetected, notifier.StatusReceived)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisNonceStore is a NonceStore shared by all gateway replicas, nonces
+// are recorded with SET NX and expire through Redis
+type RedisNonceStore struct {
+	Address   string
+	Password  string
+	KeyPrefix string
+	Timeout   time.Duration
+
+	conn   net.Conn
+	reader *bufio.Reader
+	lock   sync.Mutex
+}
+
+// NewRedisNonceStore creates a RedisNonceStore for the Redis server at address
+func NewRedisNonceStore(address, password string) *RedisNonceStore {
+	return &RedisNonceStore{
+		Address:   address,
+		Password:  password,
+		KeyPrefix: "openfaas:nonce:",
+		Timeout:   time.Second * 2,
+	}
+}
+
+// Seen records nonce for ttl and returns true if it had already been recorded
+func (s *RedisNonceStore) Seen(nonce string, ttl time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	millis := strconv.FormatInt(ttl.Milliseconds(), 10)
+	reply, err := s.do("SET", s.KeyPrefix+nonce, "1", "NX", "PX", millis)
+	if err != nil {
+		s.close()
+		return false, err
+	}
+
+	// SET NX replies with a nil bulk string when the key already exists
+	return reply == "", nil
+}
+
+func (s *RedisNonceStore) do(args ...string) (string, error) {
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.Address, s.Timeout)
+		if err != nil {
+			return "", err
+		}
+		s.conn = conn
+		s.reader = bufio.NewReader(conn)
+
+		if len(s.Password) > 0 {
+			if _, err := s.command("AUTH", s.Password); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return s.command(args...)
+}
+
+// command writes a RESP array and reads a simple, integer or bulk string reply
+func (s *RedisNonceStore) command(args ...string) (string, error) {
+	s.conn.SetDeadline(time.Now().Add(s.Timeout))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := s.conn.Write([]byte(b.String())); err != nil {
+		return "", err
+	}
+
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return "", fmt.Errorf("empty reply from redis")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid reply from redis: %q", line)
+		}
+		if size < 0 {
+			return "", nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(s.reader, data); err != nil {
+			return "", err
+		}
+		return string(data[:size]), nil
+	}
+	return "", fmt.Errorf("unexpected reply from redis: %q", line)
+}
+
+func (s *RedisNonceStore) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+		s.reader = nil
+	}
+}
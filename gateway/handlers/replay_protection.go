@@ -0,0 +1,148 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NonceStore records nonces which have been used for a request
+type NonceStore interface {
+	// Seen records nonce for ttl and returns true if it had already been
+	// recorded, the check and record must be atomic
+	Seen(nonce string, ttl time.Duration) (bool, error)
+}
+
+// ErrNonceStoreFull is returned when a nonce cannot be recorded without
+// evicting one which has not expired, which would allow it to be replayed
+var ErrNonceStoreFull = errors.New("nonce store is full")
+
+// MemoryNonceStore is a NonceStore for a single gateway replica which keeps
+// up to MaxEntries nonces. Expired nonces are removed as new ones are
+// recorded, when every entry is still live new nonces are refused with
+// ErrNonceStoreFull.
+type MemoryNonceStore struct {
+	MaxEntries int
+
+	entries map[string]*list.Element
+	order   *list.List
+	lock    sync.Mutex
+}
+
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// NewMemoryNonceStore creates a MemoryNonceStore
+func NewMemoryNonceStore(maxEntries int) *MemoryNonceStore {
+	return &MemoryNonceStore{
+		MaxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Seen records nonce for ttl and returns true if it had already been recorded
+func (s *MemoryNonceStore) Seen(nonce string, ttl time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	if element, ok := s.entries[nonce]; ok {
+		if now.Before(element.Value.(*nonceEntry).expires) {
+			return true, nil
+		}
+		s.order.Remove(element)
+		delete(s.entries, nonce)
+	}
+
+	// Nonces are recorded in order and with the same ttl by the handler, so
+	// the oldest entries expire first
+	for oldest := s.order.Back(); oldest != nil && !now.Before(oldest.Value.(*nonceEntry).expires); oldest = s.order.Back() {
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*nonceEntry).nonce)
+	}
+
+	if s.MaxEntries > 0 && s.order.Len() >= s.MaxEntries {
+		return false, ErrNonceStoreFull
+	}
+
+	s.entries[nonce] = s.order.PushFront(&nonceEntry{nonce: nonce, expires: now.Add(ttl)})
+	return false, nil
+}
+
+// ReplayConfig configures MakeReplayProtectionHandler
+type ReplayConfig struct {
+	// NonceHeader carries a value unique to each request
+	NonceHeader string
+
+	// TimestampHeader carries the time the request was signed in Unix seconds
+	TimestampHeader string
+
+	// Window is how far the timestamp may be from the gateway's clock,
+	// nonces are remembered for twice the Window
+	Window time.Duration
+}
+
+// replayCheckedKey marks the context of a request whose nonce was accepted,
+// so that requests made on its behalf, such as the items of a batch, are not
+// rejected as replays of it
+type replayCheckedKey struct{}
+
+// MakeReplayProtectionHandler rejects requests which are missing a nonce or
+// timestamp, or have a timestamp outside of the window with 401 and requests
+// with a nonce which has already been used with 409. Requests made by the
+// gateway within a request which has already been checked are passed on.
+func MakeReplayProtectionHandler(next http.HandlerFunc, store NonceStore, config ReplayConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if checked, _ := r.Context().Value(replayCheckedKey{}).(bool); checked {
+			next(w, r)
+			return
+		}
+
+		nonce := strings.TrimSpace(r.Header.Get(config.NonceHeader))
+		timestamp := strings.TrimSpace(r.Header.Get(config.TimestampHeader))
+		if len(nonce) == 0 || len(timestamp) == 0 {
+			writeError(w, r, http.StatusUnauthorized, "", fmt.Sprintf("%s and %s headers are required", config.NonceHeader, config.TimestampHeader))
+			return
+		}
+
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusUnauthorized, "", fmt.Sprintf("invalid %s header", config.TimestampHeader))
+			return
+		}
+
+		// The times are compared rather than their difference, which
+		// saturates for timestamps far in the past or future
+		sent, now := time.Unix(seconds, 0), time.Now()
+		if sent.Before(now.Add(-config.Window)) || sent.After(now.Add(config.Window)) {
+			writeError(w, r, http.StatusUnauthorized, "", "request timestamp is outside of the allowed window")
+			return
+		}
+
+		seen, err := store.Seen(nonce, config.Window*2)
+		if err != nil {
+			log.Printf("Replay protection: unable to check nonce: %s\n", err)
+			writeError(w, r, http.StatusServiceUnavailable, "", "unable to check request nonce")
+			return
+		}
+		if seen {
+			writeError(w, r, http.StatusConflict, "", "request has already been received")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), replayCheckedKey{}, true)))
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_MemoryNonceStore_SeenAndExpiry(t *testing.T) {
+	store := NewMemoryNonceStore(10)
+
+	if seen, _ := store.Seen("a", time.Minute); seen {
+		t.Errorf("first use of nonce should not be seen")
+	}
+	if seen, _ := store.Seen("a", time.Minute); !seen {
+		t.Errorf("second use of nonce should be seen")
+	}
+
+	if seen, _ := store.Seen("b", time.Millisecond); seen {
+		t.Errorf("first use of nonce should not be seen")
+	}
+	time.Sleep(time.Millisecond * 5)
+	if seen, _ := store.Seen("b", time.Minute); seen {
+		t.Errorf("expired nonce should not be seen")
+	}
+}
+
+func Test_MemoryNonceStore_RefusesWhenFull(t *testing.T) {
+	store := NewMemoryNonceStore(2)
+
+	store.Seen("a", time.Minute)
+	store.Seen("b", time.Minute)
+
+	if _, err := store.Seen("c", time.Minute); err != ErrNonceStoreFull {
+		t.Errorf("want ErrNonceStoreFull, got: %v", err)
+	}
+	if seen, _ := store.Seen("a", time.Minute); !seen {
+		t.Errorf("live nonce should not be evicted")
+	}
+}
+
+func Test_MemoryNonceStore_PrunesExpired(t *testing.T) {
+	store := NewMemoryNonceStore(2)
+
+	store.Seen("a", time.Millisecond)
+	store.Seen("b", time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+
+	if seen, err := store.Seen("c", time.Minute); seen || err != nil {
+		t.Errorf("want expired nonces pruned, seen: %t, err: %v", seen, err)
+	}
+	if len(store.entries) != 1 {
+		t.Errorf("entries want: %d, got: %d", 1, len(store.entries))
+	}
+}
+
+func Test_MakeReplayProtectionHandler(t *testing.T) {
+	config := ReplayConfig{
+		NonceHeader:     "X-Nonce",
+		TimestampHeader: "X-Timestamp",
+		Window:          time.Minute,
+	}
+
+	handler := MakeReplayProtectionHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, NewMemoryNonceStore(10), config)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Minute*2).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(time.Minute*2).Unix(), 10)
+
+	cases := []struct {
+		name      string
+		nonce     string
+		timestamp string
+		want      int
+	}{
+		{name: "missing nonce", timestamp: now, want: http.StatusUnauthorized},
+		{name: "missing timestamp", nonce: "1", want: http.StatusUnauthorized},
+		{name: "invalid timestamp", nonce: "1", timestamp: "yesterday", want: http.StatusUnauthorized},
+		{name: "stale timestamp", nonce: "1", timestamp: stale, want: http.StatusUnauthorized},
+		{name: "future timestamp", nonce: "1", timestamp: future, want: http.StatusUnauthorized},
+		{name: "far future timestamp", nonce: "1", timestamp: strconv.FormatInt(1<<40, 10), want: http.StatusUnauthorized},
+		{name: "far past timestamp", nonce: "1", timestamp: strconv.FormatInt(-1<<40, 10), want: http.StatusUnauthorized},
+		{name: "fresh request", nonce: "1", timestamp: now, want: http.StatusOK},
+		{name: "replayed request", nonce: "1", timestamp: now, want: http.StatusConflict},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/function/figlet", nil)
+		if len(c.nonce) > 0 {
+			req.Header.Set("X-Nonce", c.nonce)
+		}
+		if len(c.timestamp) > 0 {
+			req.Header.Set("X-Timestamp", c.timestamp)
+		}
+
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if rr.Code != c.want {
+			t.Errorf("%s want: %d, got: %d", c.name, c.want, rr.Code)
+		}
+	}
+}
+
+func Test_MakeReplayProtectionHandler_FullStore(t *testing.T) {
+	config := ReplayConfig{NonceHeader: "X-Nonce", TimestampHeader: "X-Timestamp", Window: time.Minute}
+	handler := MakeReplayProtectionHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, NewMemoryNonceStore(1), config)
+
+	want := []int{http.StatusOK, http.StatusServiceUnavailable}
+	for i, nonce := range []string{"1", "2"} {
+		req := httptest.NewRequest(http.MethodPost, "/function/figlet", nil)
+		req.Header.Set("X-Nonce", nonce)
+		req.Header.Set("X-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if rr.Code != want[i] {
+			t.Errorf("nonce %s status want: %d, got: %d", nonce, want[i], rr.Code)
+		}
+	}
+}
+
+func Test_RedisNonceStore_UsesSetNX(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		keys := map[string]bool{}
+		reader := bufio.NewReader(conn)
+		for {
+			args, err := readRESPArray(reader)
+			if err != nil {
+				return
+			}
+			if strings.ToUpper(args[0]) != "SET" || keys[args[1]] {
+				conn.Write([]byte("$-1\r\n"))
+				continue
+			}
+			keys[args[1]] = true
+			conn.Write([]byte("+OK\r\n"))
+		}
+	}()
+
+	store := NewRedisNonceStore(listener.Addr().String(), "")
+
+	if seen, err := store.Seen("a", time.Minute); err != nil || seen {
+		t.Errorf("first use want: false, got: %v, err: %v", seen, err)
+	}
+	if seen, err := store.Seen("a", time.Minute); err != nil || !seen {
+		t.Errorf("second use want: true, got: %v, err: %v", seen, err)
+	}
+
+	store.close()
+	<-done
+}
+
+func readRESPArray(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+
+	args := []string{}
+	for i := 0; i < count; i++ {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strings.TrimSpace(arg))
+	}
+	return args, nil
+}
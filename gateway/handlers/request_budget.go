@@ -0,0 +1,102 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// MaxRequestBytesAnnotation is the largest request body in bytes which will
+// be streamed to a function, it replaces the gateway's default
+const MaxRequestBytesAnnotation = "com.openfaas.max-request-bytes"
+
+var errRequestBudgetExceeded = errors.New("request body exceeded the byte budget")
+
+type requestBudgetKey struct{}
+
+// MakeRequestBudgetHandler limits the request bodies streamed to a function
+// to the bytes in its com.openfaas.max-request-bytes annotation, or
+// defaultMaxBytes when not set. A limit of 0 streams bodies of any size.
+func MakeRequestBudgetHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, defaultMaxBytes int64, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		maxBytes := defaultMaxBytes
+		if annotations, err := functionQuery.GetAnnotations(functionName, namespace); err == nil {
+			maxBytes, _ = readMaxRequestBytes(annotations, defaultMaxBytes)
+		}
+
+		if maxBytes <= 0 {
+			next(w, r)
+			return
+		}
+
+		if r.ContentLength > maxBytes {
+			writeError(w, r, http.StatusRequestEntityTooLarge, functionName+"."+namespace,
+				fmt.Sprintf("request body for function %s.%s exceeds %d bytes", functionName, namespace, maxBytes))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), requestBudgetKey{}, maxBytes)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// readMaxRequestBytes returns the limit in a function's annotations, or
+// defaultMaxBytes when it has no valid limit, and whether it was annotated
+func readMaxRequestBytes(annotations map[string]string, defaultMaxBytes int64) (int64, bool) {
+	if value, ok := annotations[MaxRequestBytesAnnotation]; ok {
+		if parsed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil && parsed >= 0 {
+			return parsed, true
+		}
+	}
+	return defaultMaxBytes, false
+}
+
+// budgetReader streams a request body until more than remaining bytes are
+// read, then cancels the upstream request rather than handing the transport
+// a read error to report to the function
+type budgetReader struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  int32
+	cancel    context.CancelFunc
+}
+
+// newBudgetReader wraps body when a budget was set for the request
+func newBudgetReader(r *http.Request, body io.ReadCloser) io.ReadCloser {
+	maxBytes, ok := r.Context().Value(requestBudgetKey{}).(int64)
+	if !ok || body == nil || body == http.NoBody {
+		return body
+	}
+	return &budgetReader{ReadCloser: body, remaining: maxBytes}
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		atomic.StoreInt32(&b.exceeded, 1)
+		if b.cancel != nil {
+			b.cancel()
+		}
+		return 0, errRequestBudgetExceeded
+	}
+	return n, err
+}
+
+// Exceeded reports whether the body was larger than the budget
+func (b *budgetReader) Exceeded() bool {
+	return atomic.LoadInt32(&b.exceeded) == 1
+}
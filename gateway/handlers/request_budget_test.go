@@ -0,0 +1,107 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// streamedBody hides the length of a request body so that it is sent chunked
+type streamedBody struct {
+	io.Reader
+}
+
+func makeBudgetFunctionHandler(t *testing.T, annotations map[string]string, defaultMaxBytes int64) (http.HandlerFunc, *testNotifier, *int64) {
+	var received int64
+	forwarding, _, notifier := makeFunctionProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		n, err := io.Copy(ioutil.Discard, r.Body)
+		atomic.StoreInt64(&received, n)
+		if err != nil {
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}, time.Second*5)
+
+	handler := MakeRequestBudgetHandler(forwarding, fakeFunctionQuery{annotations: annotations}, defaultMaxBytes, "openfaas-fn")
+	return handler, notifier, &received
+}
+
+func Test_RequestBudget_StreamsBodyWithinBudget(t *testing.T) {
+	handler, _, received := makeBudgetFunctionHandler(t, map[string]string{}, 1024)
+
+	body := strings.Repeat("a", 1024)
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/function/upload", streamedBody{strings.NewReader(body)}))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("status want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+	if got := atomic.LoadInt64(received); got != int64(len(body)) {
+		t.Errorf("upstream want: %d bytes, got: %d", len(body), got)
+	}
+}
+
+func Test_RequestBudget_AbortsStreamOverBudget(t *testing.T) {
+	handler, notifier, _ := makeBudgetFunctionHandler(t, map[string]string{}, 1024)
+
+	body := strings.Repeat("a", 64*1024)
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/function/upload", streamedBody{strings.NewReader(body)}))
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status want: %d, got: %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	if notifier.StatusReceived != http.StatusRequestEntityTooLarge {
+		t.Errorf("notifier status want: %d, got: %d", http.StatusRequestEntityTooLarge, notifier.StatusReceived)
+	}
+}
+
+func Test_RequestBudget_RejectsContentLengthOverBudget(t *testing.T) {
+	handler, notifier, _ := makeBudgetFunctionHandler(t, map[string]string{}, 1024)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/function/upload", strings.NewReader(strings.Repeat("a", 1025))))
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status want: %d, got: %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+	if notifier.StatusReceived != 0 {
+		t.Errorf("want the request rejected before it was forwarded")
+	}
+}
+
+func Test_RequestBudget_AnnotationReplacesDefault(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		size        int
+		want        int
+	}{
+		{"lower limit", map[string]string{MaxRequestBytesAnnotation: "16"}, 512, http.StatusRequestEntityTooLarge},
+		{"higher limit", map[string]string{MaxRequestBytesAnnotation: "4096"}, 2048, http.StatusOK},
+		{"no limit", map[string]string{MaxRequestBytesAnnotation: "0"}, 2048, http.StatusOK},
+		{"invalid", map[string]string{MaxRequestBytesAnnotation: "2KB"}, 512, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler, _, _ := makeBudgetFunctionHandler(t, c.annotations, 1024)
+
+			body := strings.Repeat("a", c.size)
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest(http.MethodPost, "/function/upload", streamedBody{strings.NewReader(body)}))
+
+			if rr.Code != c.want {
+				t.Errorf("status want: %d, got: %d", c.want, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	mathrand "math/rand"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution/uuid"
+)
+
+const (
+	// DefaultRequestIDHeader carries an ID for the request which functions
+	// can add to their logs for correlation, unless another is configured
+	DefaultRequestIDHeader = "X-Request-Id"
+
+	// TraceParentHeader is the W3C Trace Context header
+	TraceParentHeader = "Traceparent"
+)
+
+type requestIDHeaderKey struct{}
+
+// MakeRequestIDHeaderHandler records requestIDHeader, or X-Request-Id when
+// blank, in the request's context so that the errors written by the gateway
+// report the ID from the same header which is forwarded to functions
+func MakeRequestIDHeaderHandler(next http.HandlerFunc, requestIDHeader string) http.HandlerFunc {
+	if len(requestIDHeader) == 0 {
+		requestIDHeader = DefaultRequestIDHeader
+	}
+	requestIDHeader = http.CanonicalHeaderKey(requestIDHeader)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), requestIDHeaderKey{}, requestIDHeader)))
+	}
+}
+
+// contextRequestIDHeader returns the header recorded by
+// MakeRequestIDHeaderHandler, X-Request-Id when there is none
+func contextRequestIDHeader(r *http.Request) string {
+	if requestIDHeader, ok := r.Context().Value(requestIDHeaderKey{}).(string); ok {
+		return requestIDHeader
+	}
+	return DefaultRequestIDHeader
+}
+
+// readRequestID returns the ID of a request in requestIDHeader, or
+// X-Request-Id when blank, from the response headers when it has been set
+// already, otherwise from the request, falling back to its X-Call-Id
+func readRequestID(responseHeader http.Header, r *http.Request, requestIDHeader string) string {
+	if len(requestIDHeader) == 0 {
+		requestIDHeader = DefaultRequestIDHeader
+	}
+
+	if id := responseHeader.Get(requestIDHeader); len(id) > 0 {
+		return id
+	}
+	if id := r.Header.Get(requestIDHeader); len(id) > 0 {
+		return id
+	}
+	return r.Header.Get("X-Call-Id")
+}
+
+// setRequestIDs makes sure a request has a request ID in requestIDHeader,
+// or X-Request-Id when blank, and a valid traceparent header. A missing
+// request ID is taken from X-Call-Id or generated, a missing or malformed
+// traceparent starts a new trace. The sampling decision of a valid
+// traceparent is kept, a new trace is sampled at sampleRate from 0 to 1.
+func setRequestIDs(header http.Header, requestIDHeader string, sampleRate float64) {
+	if len(requestIDHeader) == 0 {
+		requestIDHeader = DefaultRequestIDHeader
+	}
+
+	if len(header.Get(requestIDHeader)) == 0 {
+		requestID := header.Get("X-Call-Id")
+		if len(requestID) == 0 {
+			requestID = uuid.Generate().String()
+		}
+		header.Set(requestIDHeader, requestID)
+	}
+
+	if !validTraceParent(header.Get(TraceParentHeader)) {
+		flags := "00"
+		if sampleRate > 0 && mathrand.Float64() < sampleRate {
+			flags = "01"
+		}
+		header.Set(TraceParentHeader, "00-"+randomHex(16)+"-"+randomHex(8)+"-"+flags)
+	}
+}
+
+// validTraceParent checks the version 00 format of a traceparent header:
+// version-traceid-parentid-flags in lowercase hex, with non-zero IDs
+func validTraceParent(value string) bool {
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return false
+	}
+
+	for i, size := range []int{2, 32, 16, 2} {
+		if len(parts[i]) != size || strings.Trim(parts[i], "0123456789abcdef") != "" {
+			return false
+		}
+	}
+	return strings.Trim(parts[1], "0") != "" && strings.Trim(parts[2], "0") != ""
+}
+
+func randomHex(size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
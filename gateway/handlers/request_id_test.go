@@ -0,0 +1,165 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+func Test_buildUpstreamRequest_GeneratesRequestIDs(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/function/test", nil)
+
+	upstream := buildUpstreamRequest(request, "/", "/", nil)
+
+	if got := upstream.Header.Get(DefaultRequestIDHeader); len(got) != 36 {
+		t.Errorf("want a generated UUID, got: %q", got)
+	}
+	if got := upstream.Header.Get(TraceParentHeader); !validTraceParent(got) {
+		t.Errorf("want a generated traceparent, got: %q", got)
+	}
+
+	again := buildUpstreamRequest(request, "/", "/", nil)
+	if again.Header.Get(DefaultRequestIDHeader) == upstream.Header.Get(DefaultRequestIDHeader) {
+		t.Errorf("want a new ID per request")
+	}
+}
+
+func Test_buildUpstreamRequest_KeepsRequestIDs(t *testing.T) {
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	request, _ := http.NewRequest(http.MethodGet, "/function/test", nil)
+	request.Header.Set("X-Request-Id", "client-id")
+	request.Header.Set("traceparent", traceParent)
+
+	upstream := buildUpstreamRequest(request, "/", "/", nil)
+
+	if got := upstream.Header.Get(DefaultRequestIDHeader); got != "client-id" {
+		t.Errorf("want the client's request ID, got: %q", got)
+	}
+	if got := upstream.Header.Get(TraceParentHeader); got != traceParent {
+		t.Errorf("want the client's traceparent, got: %q", got)
+	}
+}
+
+func Test_buildUpstreamRequest_RequestIDFromCallID(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/function/test", nil)
+	request.Header.Set("X-Call-Id", "call-id")
+
+	upstream := buildUpstreamRequest(request, "/", "/", nil)
+
+	if got := upstream.Header.Get(DefaultRequestIDHeader); got != "call-id" {
+		t.Errorf("want the call ID to be used, got: %q", got)
+	}
+}
+
+func Test_buildUpstreamRequest_SamplesNewTraces(t *testing.T) {
+	cases := []struct {
+		rate float64
+		want string
+	}{
+		{rate: 0, want: "00"},
+		{rate: 1, want: "01"},
+	}
+
+	for _, c := range cases {
+		request, _ := http.NewRequest(http.MethodGet, "/function/test", nil)
+		upstream := buildUpstreamRequest(request, "/", "/", &types.HTTPClientReverseProxy{TraceSampleRate: c.rate})
+
+		traceParent := upstream.Header.Get(TraceParentHeader)
+		if !validTraceParent(traceParent) {
+			t.Fatalf("want a generated traceparent, got: %q", traceParent)
+		}
+		if got := traceParent[len(traceParent)-2:]; got != c.want {
+			t.Errorf("rate %v: flags want: %s, got: %s", c.rate, c.want, got)
+		}
+	}
+}
+
+func Test_buildUpstreamRequest_KeepsClientSamplingDecision(t *testing.T) {
+	for _, traceParent := range []string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		for _, rate := range []float64{0, 1} {
+			request, _ := http.NewRequest(http.MethodGet, "/function/test", nil)
+			request.Header.Set("traceparent", traceParent)
+
+			upstream := buildUpstreamRequest(request, "/", "/", &types.HTTPClientReverseProxy{TraceSampleRate: rate})
+			if got := upstream.Header.Get(TraceParentHeader); got != traceParent {
+				t.Errorf("rate %v: want the client's traceparent %q, got: %q", rate, traceParent, got)
+			}
+		}
+	}
+}
+
+func Test_validTraceParent(t *testing.T) {
+	cases := []struct {
+		value string
+		want  bool
+	}{
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", want: true},
+		{value: ""},
+		{value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01"},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+	}
+
+	for _, c := range cases {
+		if got := validTraceParent(c.value); got != c.want {
+			t.Errorf("%q want: %v, got: %v", c.value, c.want, got)
+		}
+	}
+}
+
+func Test_MakeForwardingProxyHandler_ReturnsRequestID(t *testing.T) {
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(DefaultRequestIDHeader)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	handler := MakeForwardingProxyHandler(types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1),
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/echo", nil))
+
+	if len(received) == 0 || rr.Header().Get(DefaultRequestIDHeader) != received {
+		t.Errorf("want the request ID sent to the function returned to the client, sent: %q, returned: %q", received, rr.Header().Get(DefaultRequestIDHeader))
+	}
+}
+
+func Test_buildUpstreamRequest_ConfiguredRequestIDHeader(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "/function/test", nil)
+
+	upstream := buildUpstreamRequest(request, "/", "/", &types.HTTPClientReverseProxy{RequestIDHeader: "X-Correlation-Id"})
+
+	if got := upstream.Header.Get("X-Correlation-Id"); len(got) != 36 {
+		t.Errorf("want a UUID generated in the configured header, got: %q", got)
+	}
+	if got := upstream.Header.Get(DefaultRequestIDHeader); got != "" {
+		t.Errorf("want no %s header, got: %q", DefaultRequestIDHeader, got)
+	}
+
+	request.Header.Set("X-Correlation-Id", "client-id")
+	upstream = buildUpstreamRequest(request, "/", "/", &types.HTTPClientReverseProxy{RequestIDHeader: "X-Correlation-Id"})
+	if got := upstream.Header.Get("X-Correlation-Id"); got != "client-id" {
+		t.Errorf("want the client's ID to be propagated, got: %q", got)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// RequestSchemaAnnotation is an inline JSON Schema which the JSON
+	// payloads of requests to a function must match
+	RequestSchemaAnnotation = "com.openfaas.request-schema"
+
+	// RequestSchemaRefAnnotation is the name of a file with the JSON Schema
+	// in the gateway's schema directory, such as a key of a mounted
+	// ConfigMap. RequestSchemaAnnotation takes precedence.
+	RequestSchemaRefAnnotation = "com.openfaas.request-schema-ref"
+)
+
+// SchemaValidationResponse is the body of a 400 Bad Request for a payload
+// which does not match its function's schema
+type SchemaValidationResponse struct {
+	Code     int           `json:"code"`
+	Message  string        `json:"message"`
+	Function string        `json:"function"`
+	Errors   []SchemaError `json:"errors"`
+}
+
+// RequestSchemas parses the schemas of functions once for each version of
+// the annotation or file
+type RequestSchemas struct {
+	// Dir has the files named by RequestSchemaRefAnnotation, refs are not
+	// resolved when empty
+	Dir string
+
+	inline map[string]*jsonSchema
+	files  map[string]schemaFile
+	lock   sync.Mutex
+}
+
+type schemaFile struct {
+	modTime time.Time
+	schema  *jsonSchema
+}
+
+// NewRequestSchemas creates a RequestSchemas which resolves refs in dir
+func NewRequestSchemas(dir string) *RequestSchemas {
+	return &RequestSchemas{
+		Dir:    dir,
+		inline: make(map[string]*jsonSchema),
+		files:  make(map[string]schemaFile),
+	}
+}
+
+// get returns the schema in annotations, or nil when there is none
+func (s *RequestSchemas) get(annotations map[string]string) (*jsonSchema, error) {
+	if inline := strings.TrimSpace(annotations[RequestSchemaAnnotation]); len(inline) > 0 {
+		return s.getInline(inline)
+	}
+	if ref := strings.TrimSpace(annotations[RequestSchemaRefAnnotation]); len(ref) > 0 {
+		return s.getFile(ref)
+	}
+	return nil, nil
+}
+
+func (s *RequestSchemas) getInline(inline string) (*jsonSchema, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if schema, ok := s.inline[inline]; ok {
+		return schema, nil
+	}
+
+	schema, err := parseJSONSchema([]byte(inline))
+	if err != nil {
+		return nil, err
+	}
+	s.inline[inline] = schema
+	return schema, nil
+}
+
+func (s *RequestSchemas) getFile(ref string) (*jsonSchema, error) {
+	if len(s.Dir) == 0 {
+		return nil, fmt.Errorf("%s is set but request_schema_dir is not", RequestSchemaRefAnnotation)
+	}
+	if ref != filepath.Base(ref) || strings.HasPrefix(ref, ".") {
+		return nil, fmt.Errorf("invalid schema ref: %q", ref)
+	}
+
+	path := filepath.Join(s.Dir, ref)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if cached, ok := s.files[path]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.schema, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := parseJSONSchema(data)
+	if err != nil {
+		return nil, err
+	}
+	s.files[path] = schemaFile{modTime: info.ModTime(), schema: schema}
+	return schema, nil
+}
+
+// MakeRequestSchemaHandler validates the JSON payloads of requests to
+// functions with a schema annotation before they are forwarded. Payloads
+// are buffered up to maxBodyBytes, larger ones are rejected with 413, and a
+// payload which does not match is rejected with 400 and the errors found.
+// Functions without a schema, and requests without a payload such as GET,
+// are passed on without buffering.
+func MakeRequestSchemaHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, schemas *RequestSchemas, maxBodyBytes int64, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next(w, r)
+			return
+		}
+
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+		function := functionName + "." + namespace
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		schema, err := schemas.get(annotations)
+		if err != nil {
+			log.Printf("Request schema: invalid schema for %s: %s\n", function, err)
+			writeError(w, r, http.StatusInternalServerError, function,
+				fmt.Sprintf("the request schema of function %s is invalid", function))
+			return
+		}
+		if schema == nil {
+			next(w, r)
+			return
+		}
+
+		if r.ContentLength > maxBodyBytes {
+			writeError(w, r, http.StatusRequestEntityTooLarge, function,
+				fmt.Sprintf("request body for function %s exceeds %d bytes and cannot be validated", function, maxBodyBytes))
+			return
+		}
+
+		var body []byte
+		if r.Body != nil {
+			body, err = ioutil.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+			r.Body.Close()
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, function,
+					fmt.Sprintf("unable to read the request body for function %s", function))
+				return
+			}
+		}
+		if int64(len(body)) > maxBodyBytes {
+			writeError(w, r, http.StatusRequestEntityTooLarge, function,
+				fmt.Sprintf("request body for function %s exceeds %d bytes and cannot be validated", function, maxBodyBytes))
+			return
+		}
+
+		var errors []SchemaError
+		if value, err := decodeJSON(body); err != nil {
+			errors = []SchemaError{{Path: "", Message: "is not valid JSON"}}
+		} else {
+			errors = schema.Validate(value)
+		}
+
+		if len(errors) > 0 {
+			writeSchemaErrors(w, function, errors)
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		next(w, r)
+	}
+}
+
+func writeSchemaErrors(w http.ResponseWriter, function string, errors []SchemaError) {
+	out, _ := json.Marshal(SchemaValidationResponse{
+		Code:     http.StatusBadRequest,
+		Message:  fmt.Sprintf("request body does not match the schema of function %s", function),
+		Function: function,
+		Errors:   errors,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(out)
+}
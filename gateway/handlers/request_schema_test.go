@@ -0,0 +1,122 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_MakeRequestSchemaHandler_ForwardsValidPayload(t *testing.T) {
+	var received string
+	handler := MakeRequestSchemaHandler(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+	}, fakeFunctionQuery{annotations: map[string]string{RequestSchemaAnnotation: orderSchema}},
+		NewRequestSchemas(""), 1024, "openfaas-fn")
+
+	payload := `{"id": 1, "items": [{"sku": "abc"}]}`
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/function/orders", strings.NewReader(payload)))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("status want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+	if received != payload {
+		t.Errorf("body want to be forwarded: %s, got: %s", payload, received)
+	}
+}
+
+func Test_MakeRequestSchemaHandler_RejectsInvalidPayload(t *testing.T) {
+	handler := MakeRequestSchemaHandler(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("want an invalid payload not to be forwarded")
+	}, fakeFunctionQuery{annotations: map[string]string{RequestSchemaAnnotation: orderSchema}},
+		NewRequestSchemas(""), 1024, "openfaas-fn")
+
+	for payload, want := range map[string]SchemaError{
+		`{"items": [{"sku": "abc"}]}`: {Path: "/id", Message: "is required"},
+		`{"id": `:                     {Path: "", Message: "is not valid JSON"},
+		``:                            {Path: "", Message: "is not valid JSON"},
+	} {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/function/orders", strings.NewReader(payload)))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("payload %q status want: %d, got: %d", payload, http.StatusBadRequest, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type want: application/json, got: %q", got)
+		}
+
+		body := SchemaValidationResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("unable to parse body %q: %s", rr.Body.String(), err)
+		}
+		if body.Function != "orders.openfaas-fn" || len(body.Errors) != 1 || body.Errors[0] != want {
+			t.Errorf("payload %q errors want: %v, got: %+v", payload, want, body)
+		}
+	}
+}
+
+func Test_MakeRequestSchemaHandler_BoundsBufferedBody(t *testing.T) {
+	handler := MakeRequestSchemaHandler(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("want a payload over the limit not to be forwarded")
+	}, fakeFunctionQuery{annotations: map[string]string{RequestSchemaAnnotation: `{"type": "string"}`}},
+		NewRequestSchemas(""), 8, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodPost, "/function/orders", strings.NewReader(`"0123456789"`))
+	req.ContentLength = -1
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status want: %d, got: %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+}
+
+func Test_MakeRequestSchemaHandler_SkipsWithoutSchema(t *testing.T) {
+	visited := false
+	handler := MakeRequestSchemaHandler(func(w http.ResponseWriter, r *http.Request) {
+		visited = true
+	}, fakeFunctionQuery{annotations: map[string]string{}}, NewRequestSchemas(""), 8, "openfaas-fn")
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/function/orders", strings.NewReader("not json at all")))
+	if !visited {
+		t.Errorf("want a request to a function without a schema to be forwarded")
+	}
+}
+
+func Test_MakeRequestSchemaHandler_SchemaRef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "request-schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "orders.json"), []byte(orderSchema), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	schemas := NewRequestSchemas(dir)
+	for ref, want := range map[string]int{
+		"orders.json":    http.StatusBadRequest,
+		"missing.json":   http.StatusInternalServerError,
+		"../orders.json": http.StatusInternalServerError,
+	} {
+		handler := MakeRequestSchemaHandler(func(w http.ResponseWriter, r *http.Request) {},
+			fakeFunctionQuery{annotations: map[string]string{RequestSchemaRefAnnotation: ref}}, schemas, 1024, "openfaas-fn")
+
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/function/orders", strings.NewReader(`{}`)))
+		if rr.Code != want {
+			t.Errorf("ref %s status want: %d, got: %d", ref, want, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// redactedHeaderValue replaces the values of sensitive headers in a
+// TappedRequest
+const redactedHeaderValue = "[REDACTED]"
+
+// TapReplayHeader is set on a replayed request to the ID of the request it
+// replays
+const TapReplayHeader = "X-Tap-Replay"
+
+// TappedRequest is a request to a function captured by a RequestTap
+type TappedRequest struct {
+	ID            uint64      `json:"id"`
+	Timestamp     time.Time   `json:"timestamp"`
+	Method        string      `json:"method"`
+	URI           string      `json:"uri"`
+	Header        http.Header `json:"header"`
+	Body          []byte      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"bodyTruncated,omitempty"`
+	Status        int         `json:"status"`
+	Duration      float64     `json:"durationSeconds"`
+}
+
+// RequestTap keeps the last requests to each tapped function for debugging.
+// Memory is bounded by the amount of functions, requests kept per function
+// and the body bytes kept per request. Sensitive headers are redacted before
+// a request is kept, so they are never held nor replayed.
+type RequestTap struct {
+	size          int
+	maxBodyBytes  int64
+	functions     map[string]*tapRing
+	redactHeaders map[string]bool
+	lock          sync.Mutex
+	nextID        uint64
+}
+
+type tapRing struct {
+	requests []TappedRequest
+	next     int
+}
+
+// NewRequestTap keeps the last size requests to each of functions, given as
+// name.namespace, with up to maxBodyBytes of each body. The values of
+// redactHeaders are replaced.
+func NewRequestTap(functions []string, size int, maxBodyBytes int64, redactHeaders []string) *RequestTap {
+	tap := &RequestTap{
+		size:          size,
+		maxBodyBytes:  maxBodyBytes,
+		functions:     make(map[string]*tapRing),
+		redactHeaders: make(map[string]bool),
+	}
+	for _, function := range functions {
+		tap.functions[function] = &tapRing{}
+	}
+	for _, header := range redactHeaders {
+		tap.redactHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+	return tap
+}
+
+// Tapped returns true when requests to function are kept
+func (t *RequestTap) Tapped(function string) bool {
+	_, ok := t.functions[function]
+	return ok && t.size > 0
+}
+
+// Add keeps a request to function, the oldest request is replaced once size
+// requests are kept
+func (t *RequestTap) Add(function string, request TappedRequest) {
+	ring, ok := t.functions[function]
+	if !ok || t.size <= 0 {
+		return
+	}
+
+	for name := range request.Header {
+		if t.redactHeaders[name] {
+			request.Header[name] = []string{redactedHeaderValue}
+		}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.nextID++
+	request.ID = t.nextID
+	if len(ring.requests) < t.size {
+		ring.requests = append(ring.requests, request)
+		return
+	}
+	ring.requests[ring.next] = request
+	ring.next = (ring.next + 1) % t.size
+}
+
+// Requests returns the requests kept for function, oldest first
+func (t *RequestTap) Requests(function string) []TappedRequest {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	ring, ok := t.functions[function]
+	if !ok {
+		return []TappedRequest{}
+	}
+
+	requests := make([]TappedRequest, 0, len(ring.requests))
+	requests = append(requests, ring.requests[ring.next:]...)
+	requests = append(requests, ring.requests[:ring.next]...)
+	return requests
+}
+
+// Get returns the request kept for function with id
+func (t *RequestTap) Get(function string, id uint64) (TappedRequest, bool) {
+	for _, request := range t.Requests(function) {
+		if request.ID == id {
+			return request, true
+		}
+	}
+	return TappedRequest{}, false
+}
+
+// MakeRequestTapHandler keeps the requests to tapped functions in tap
+func MakeRequestTapHandler(next http.HandlerFunc, tap *RequestTap, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+		function := functionName + "." + namespace
+		if !tap.Tapped(function) {
+			next(w, r)
+			return
+		}
+
+		request := TappedRequest{
+			Timestamp: time.Now(),
+			Method:    r.Method,
+			URI:       r.URL.RequestURI(),
+			Header:    r.Header.Clone(),
+		}
+
+		var body *tapBody
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &tapBody{ReadCloser: r.Body, remaining: tap.maxBodyBytes}
+			r.Body = body
+		}
+
+		writer := httputil.NewHttpWriteInterceptor(w)
+		next(writer, r)
+
+		if body != nil {
+			request.Body = body.captured.Bytes()
+			request.BodyTruncated = body.truncated || !body.eof
+		}
+		request.Status = writer.Status()
+		request.Duration = time.Since(request.Timestamp).Seconds()
+		tap.Add(function, request)
+	}
+}
+
+// tapBody keeps up to remaining bytes of a request body as it is read, so
+// that the body is still streamed to the function. A body which was not read
+// to the end is truncated too.
+type tapBody struct {
+	io.ReadCloser
+	captured  bytes.Buffer
+	remaining int64
+	truncated bool
+	eof       bool
+}
+
+func (b *tapBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		keep := int64(n)
+		if keep > b.remaining {
+			keep = b.remaining
+			b.truncated = true
+		}
+		b.captured.Write(p[:keep])
+		b.remaining -= keep
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// TapReplayRequest selects a tapped request to replay
+type TapReplayRequest struct {
+	FunctionName string `json:"functionName"`
+	Namespace    string `json:"namespace"`
+	ID           uint64 `json:"id"`
+}
+
+// MakeRequestTapAdminHandler lists the requests kept for a function on GET,
+// with the functionName and namespace query parameters. On POST the request
+// selected by a TapReplayRequest body is sent again through functionProxy,
+// and the function's response is returned. Redacted headers are not sent.
+func MakeRequestTapAdminHandler(tap *RequestTap, functionProxy http.HandlerFunc, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			listTappedRequests(w, r, tap, defaultNamespace)
+		case http.MethodPost:
+			replayTappedRequest(w, r, tap, functionProxy, defaultNamespace)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func listTappedRequests(w http.ResponseWriter, r *http.Request, tap *RequestTap, defaultNamespace string) {
+	q := r.URL.Query()
+	functionName, namespace := q.Get("functionName"), q.Get("namespace")
+	if len(functionName) == 0 {
+		http.Error(w, "functionName is required", http.StatusBadRequest)
+		return
+	}
+	if len(namespace) == 0 {
+		namespace = defaultNamespace
+	}
+
+	function := functionName + "." + namespace
+	if !tap.Tapped(function) {
+		http.Error(w, fmt.Sprintf("function %s is not tapped", function), http.StatusNotFound)
+		return
+	}
+
+	jsonOut, err := json.Marshal(tap.Requests(function))
+	if err != nil {
+		log.Printf("Error marshalling tapped requests: %s\n", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonOut)
+}
+
+func replayTappedRequest(w http.ResponseWriter, r *http.Request, tap *RequestTap, functionProxy http.HandlerFunc, defaultNamespace string) {
+	defer r.Body.Close()
+	body, _ := ioutil.ReadAll(r.Body)
+
+	req := TapReplayRequest{}
+	if err := json.Unmarshal(body, &req); err != nil || len(req.FunctionName) == 0 || req.ID == 0 {
+		http.Error(w, "a JSON body with functionName and id is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Namespace) == 0 {
+		req.Namespace = defaultNamespace
+	}
+
+	function := req.FunctionName + "." + req.Namespace
+	tapped, ok := tap.Get(function, req.ID)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no request %d for function %s", req.ID, function), http.StatusNotFound)
+		return
+	}
+	if tapped.BodyTruncated {
+		http.Error(w, fmt.Sprintf("request %d for function %s has a truncated body and cannot be replayed", req.ID, function), http.StatusConflict)
+		return
+	}
+
+	replay, err := http.NewRequestWithContext(r.Context(), tapped.Method, tapped.URI, bytes.NewReader(tapped.Body))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("request %d for function %s cannot be replayed: %s", req.ID, function, err), http.StatusInternalServerError)
+		return
+	}
+	replay.Host = r.Host
+	replay.RequestURI = tapped.URI
+	replay.RemoteAddr = r.RemoteAddr
+	for name, values := range tapped.Header {
+		if tap.redactHeaders[name] {
+			continue
+		}
+		replay.Header[name] = append([]string(nil), values...)
+	}
+	replay.Header.Set(TapReplayHeader, strconv.FormatUint(tapped.ID, 10))
+	replay.Header.Del("Content-Length")
+	replay.ContentLength = int64(len(tapped.Body))
+
+	log.Printf("Request tap: replaying request %d for function %s\n", tapped.ID, function)
+	functionProxy(w, replay)
+}
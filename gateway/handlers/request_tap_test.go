@@ -0,0 +1,170 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func echoFunction(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Header().Set("X-Replay", r.Header.Get(TapReplayHeader))
+	w.Header().Set("X-Authorization", r.Header.Get("Authorization"))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(body)
+}
+
+func Test_MakeRequestTapHandler_KeepsRequests(t *testing.T) {
+	tap := NewRequestTap([]string{"figlet.openfaas-fn"}, 2, 1024, []string{"Authorization"})
+	handler := MakeRequestTapHandler(echoFunction, tap, "openfaas-fn")
+
+	for _, body := range []string{"one", "two", "three"} {
+		r := httptest.NewRequest(http.MethodPost, "/function/figlet?q=1", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer secret")
+		r.Header.Set("X-Custom", "value")
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+
+		if rr.Body.String() != body {
+			t.Errorf("body want to be passed through: %q, got: %q", body, rr.Body.String())
+		}
+	}
+
+	requests := tap.Requests("figlet.openfaas-fn")
+	if len(requests) != 2 {
+		t.Fatalf("requests want: %d, got: %d", 2, len(requests))
+	}
+	if string(requests[0].Body) != "two" || string(requests[1].Body) != "three" {
+		t.Errorf("requests want the last two oldest first, got: %q, %q", requests[0].Body, requests[1].Body)
+	}
+	if requests[1].ID != 3 {
+		t.Errorf("ID want: %d, got: %d", 3, requests[1].ID)
+	}
+	if requests[1].URI != "/function/figlet?q=1" || requests[1].Method != http.MethodPost {
+		t.Errorf("request want method and URI, got: %s %s", requests[1].Method, requests[1].URI)
+	}
+	if requests[1].Status != http.StatusCreated {
+		t.Errorf("Status want: %d, got: %d", http.StatusCreated, requests[1].Status)
+	}
+	if got := requests[1].Header.Get("Authorization"); got != redactedHeaderValue {
+		t.Errorf("Authorization want to be redacted, got: %q", got)
+	}
+	if got := requests[1].Header.Get("X-Custom"); got != "value" {
+		t.Errorf("X-Custom want: value, got: %q", got)
+	}
+}
+
+func Test_MakeRequestTapHandler_IgnoresOtherFunctions(t *testing.T) {
+	tap := NewRequestTap([]string{"figlet.openfaas-fn"}, 2, 1024, nil)
+	handler := MakeRequestTapHandler(echoFunction, tap, "openfaas-fn")
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet.dev", nil))
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/env", nil))
+
+	if got := len(tap.Requests("figlet.openfaas-fn")); got != 0 {
+		t.Errorf("requests want: %d, got: %d", 0, got)
+	}
+}
+
+func Test_MakeRequestTapHandler_TruncatesBody(t *testing.T) {
+	tap := NewRequestTap([]string{"figlet.openfaas-fn"}, 2, 4, nil)
+	handler := MakeRequestTapHandler(echoFunction, tap, "openfaas-fn")
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/function/figlet", strings.NewReader("0123456789")))
+	if rr.Body.String() != "0123456789" {
+		t.Errorf("body want to be passed through whole, got: %q", rr.Body.String())
+	}
+
+	requests := tap.Requests("figlet.openfaas-fn")
+	if len(requests) != 1 {
+		t.Fatalf("requests want: %d, got: %d", 1, len(requests))
+	}
+	if string(requests[0].Body) != "0123" || !requests[0].BodyTruncated {
+		t.Errorf("body want truncated to 0123, got: %q, truncated: %v", requests[0].Body, requests[0].BodyTruncated)
+	}
+}
+
+func Test_MakeRequestTapAdminHandler_ListsRequests(t *testing.T) {
+	tap := NewRequestTap([]string{"figlet.openfaas-fn"}, 2, 1024, nil)
+	MakeRequestTapHandler(echoFunction, tap, "openfaas-fn")(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/function/figlet", strings.NewReader("hello")))
+
+	admin := MakeRequestTapAdminHandler(tap, echoFunction, "openfaas-fn")
+
+	rr := httptest.NewRecorder()
+	admin(rr, httptest.NewRequest(http.MethodGet, "/system/request-tap?functionName=figlet", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+
+	requests := []TappedRequest{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &requests); err != nil {
+		t.Fatalf("unable to parse body %q: %s", rr.Body.String(), err)
+	}
+	if len(requests) != 1 || string(requests[0].Body) != "hello" {
+		t.Errorf("requests want one with body hello, got: %+v", requests)
+	}
+
+	rr = httptest.NewRecorder()
+	admin(rr, httptest.NewRequest(http.MethodGet, "/system/request-tap?functionName=env", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("status for a function which is not tapped want: %d, got: %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func Test_MakeRequestTapAdminHandler_ReplaysRequest(t *testing.T) {
+	tap := NewRequestTap([]string{"figlet.openfaas-fn"}, 2, 1024, []string{"Authorization"})
+	functionProxy := MakeRequestTapHandler(echoFunction, tap, "openfaas-fn")
+
+	r := httptest.NewRequest(http.MethodPost, "/function/figlet", strings.NewReader("hello"))
+	r.Header.Set("Authorization", "Bearer secret")
+	functionProxy(httptest.NewRecorder(), r)
+
+	admin := MakeRequestTapAdminHandler(tap, functionProxy, "openfaas-fn")
+	replay, _ := json.Marshal(TapReplayRequest{FunctionName: "figlet", ID: 1})
+	rr := httptest.NewRecorder()
+	admin(rr, httptest.NewRequest(http.MethodPost, "/system/request-tap", bytes.NewReader(replay)))
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status want: %d, got: %d", http.StatusCreated, rr.Code)
+	}
+	if rr.Body.String() != "hello" {
+		t.Errorf("body want: hello, got: %q", rr.Body.String())
+	}
+	if got := rr.Header().Get("X-Replay"); got != "1" {
+		t.Errorf("%s want: 1, got: %q", TapReplayHeader, got)
+	}
+	if got := rr.Header().Get("X-Authorization"); got != "" {
+		t.Errorf("redacted Authorization want not to be replayed, got: %q", got)
+	}
+
+	// The replay went through the tap too
+	if got := len(tap.Requests("figlet.openfaas-fn")); got != 2 {
+		t.Errorf("requests want: %d, got: %d", 2, got)
+	}
+}
+
+func Test_MakeRequestTapAdminHandler_RefusesTruncatedReplay(t *testing.T) {
+	tap := NewRequestTap([]string{"figlet.openfaas-fn"}, 2, 2, nil)
+	functionProxy := MakeRequestTapHandler(echoFunction, tap, "openfaas-fn")
+	functionProxy(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/function/figlet", strings.NewReader("hello")))
+
+	admin := MakeRequestTapAdminHandler(tap, functionProxy, "openfaas-fn")
+
+	for id, want := range map[uint64]int{1: http.StatusConflict, 5: http.StatusNotFound} {
+		replay, _ := json.Marshal(TapReplayRequest{FunctionName: "figlet", ID: id})
+		rr := httptest.NewRecorder()
+		admin(rr, httptest.NewRequest(http.MethodPost, "/system/request-tap", bytes.NewReader(replay)))
+		if rr.Code != want {
+			t.Errorf("request %d status want: %d, got: %d", id, want, rr.Code)
+		}
+	}
+}
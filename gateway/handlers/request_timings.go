@@ -0,0 +1,19 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// MakeRequestTimingsHandler collects the time spent by later middleware, such
+// as scaling the function, for the Server-Timing header. It must wrap the
+// other function middleware so that the total time includes all of them.
+func MakeRequestTimingsHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, middleware.WithRequestTimings(r))
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+func Test_MakeRequestTimingsHandler_ServerTimingIncludesScale(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, time.Second*5, 1, 1)
+	proxy.TimingHeaders = true
+
+	config := scaling.ScalingConfig{
+		MaxPollCount:         5,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Second,
+		ServiceQuery:         &coldServiceQuery{},
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	forwarding := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: upstream.URL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+	handler := MakeRequestTimingsHandler(MakeScalingHandler(forwarding, scaler, config, "openfaas-fn", nil))
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	entry := `[0-9]+\.[0-9]{3}`
+	want := regexp.MustCompile(`^scale;dur=` + entry + `, body;dur=` + entry + `, upstream;dur=` + entry + `, total;dur=` + entry + `$`)
+	if got := rr.Header().Get("Server-Timing"); !want.MatchString(got) {
+		t.Errorf("want scale, body, upstream and total entries, got: %q", got)
+	}
+
+	// The function is warm now, so it is not scaled
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	want = regexp.MustCompile(`^body;dur=` + entry + `, upstream;dur=` + entry + `, total;dur=` + entry + `$`)
+	if got := rr.Header().Get("Server-Timing"); !want.MatchString(got) {
+		t.Errorf("want no scale entry for a warm function, got: %q", got)
+	}
+}
+
+var timeoutBreakdown = regexp.MustCompile(`^scale_ms=([0-9]+), connect_ms=([0-9]+), ttfb_ms=([0-9]+), total_ms=([0-9]+)$`)
+
+// parseTimeoutBreakdown returns the scale, connect, ttfb and total
+// milliseconds of a breakdown
+func parseTimeoutBreakdown(t *testing.T, value string) []int64 {
+	t.Helper()
+
+	match := timeoutBreakdown.FindStringSubmatch(value)
+	if match == nil {
+		t.Fatalf("want a timeout breakdown, got: %q", value)
+	}
+	values := []int64{}
+	for _, field := range match[1:] {
+		ms, _ := strconv.ParseInt(field, 10, 64)
+		values = append(values, ms)
+	}
+	return values
+}
+
+// makeTimeoutBreakdownHandler scales the function from zero before it is
+// forwarded, the timings of each request are sent to timings
+func makeTimeoutBreakdownHandler(proxy *types.HTTPClientReverseProxy, baseURL string, timings chan<- *middleware.RequestTimings) http.HandlerFunc {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         5,
+		SetScaleRetries:      2,
+		FunctionPollInterval: 5 * time.Millisecond,
+		CacheExpiry:          time.Second,
+		ServiceQuery:         &coldServiceQuery{},
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	forwarding := MakeForwardingProxyHandler(proxy,
+		[]HTTPNotifier{},
+		middleware.SingleHostBaseURLResolver{BaseURL: baseURL},
+		middleware.TransparentURLPathTransformer{},
+		nil,
+		nil)
+	recording := func(w http.ResponseWriter, r *http.Request) {
+		forwarding(w, r)
+		timings <- middleware.GetRequestTimings(r.Context())
+	}
+	return MakeRequestTimingsHandler(MakeScalingHandler(recording, scaler, config, "openfaas-fn", nil))
+}
+
+func Test_TimeoutBreakdown_UpstreamTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, 50*time.Millisecond, 1, 1)
+	proxy.TimeoutBreakdown = true
+
+	timings := make(chan *middleware.RequestTimings, 1)
+	handler := makeTimeoutBreakdownHandler(proxy, upstream.URL, timings)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status want: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+
+	got := <-timings
+	if got.Scale <= 0 {
+		t.Errorf("want the time spent scaling, got: %s", got.Scale)
+	}
+	if got.Connect <= 0 {
+		t.Errorf("want the time spent connecting, got: %s", got.Connect)
+	}
+	if got.FirstByte < 40*time.Millisecond {
+		t.Errorf("want the time waited for the first byte until the timeout, got: %s", got.FirstByte)
+	}
+
+	breakdown := parseTimeoutBreakdown(t, rr.Header().Get(types.TimeoutBreakdownHeader))
+	scaleMs, connectMs, ttfbMs, totalMs := breakdown[0], breakdown[1], breakdown[2], breakdown[3]
+	if scaleMs != got.Scale.Milliseconds() || connectMs != got.Connect.Milliseconds() || ttfbMs != got.FirstByte.Milliseconds() {
+		t.Errorf("breakdown want the request's timings %+v, got: %v", got, breakdown)
+	}
+	if totalMs < scaleMs+ttfbMs {
+		t.Errorf("total_ms want at least scale_ms and ttfb_ms, got: %v", breakdown)
+	}
+}
+
+func Test_TimeoutBreakdown_DialTimeout(t *testing.T) {
+	upstreamURL, _ := url.Parse("http://dead-host:8080")
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, 5*time.Second, 1, 1)
+	proxy.TimeoutBreakdown = true
+	proxy.Client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			time.Sleep(20 * time.Millisecond)
+			return nil, &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}
+		},
+	}}
+
+	timings := make(chan *middleware.RequestTimings, 1)
+	handler := makeTimeoutBreakdownHandler(proxy, upstreamURL.String(), timings)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status want: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+
+	got := <-timings
+	if got.Connect < 20*time.Millisecond {
+		t.Errorf("want the time spent dialling, got: %s", got.Connect)
+	}
+	if got.FirstByte != 0 {
+		t.Errorf("want no time waiting for a response without a connection, got: %s", got.FirstByte)
+	}
+
+	breakdown := parseTimeoutBreakdown(t, rr.Header().Get(types.TimeoutBreakdownHeader))
+	if breakdown[1] < 20 || breakdown[2] != 0 {
+		t.Errorf("breakdown want connect_ms of at least 20 and no ttfb_ms, got: %v", breakdown)
+	}
+}
+
+func Test_TimeoutBreakdown_OptIn(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, 50*time.Millisecond, 1, 1)
+
+	timings := make(chan *middleware.RequestTimings, 1)
+	handler := makeTimeoutBreakdownHandler(proxy, upstream.URL, timings)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	<-timings
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status want: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+	if got := rr.Header().Get(types.TimeoutBreakdownHeader); len(got) > 0 {
+		t.Errorf("want no breakdown unless enabled, got: %q", got)
+	}
+}
+
+func Test_TimeoutBreakdown_NotAddedToResponses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := types.NewHTTPClientReverseProxy(upstreamURL, 5*time.Second, 1, 1)
+	proxy.TimeoutBreakdown = true
+
+	timings := make(chan *middleware.RequestTimings, 1)
+	handler := makeTimeoutBreakdownHandler(proxy, upstream.URL, timings)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+	if got := rr.Header().Get(types.TimeoutBreakdownHeader); len(got) > 0 {
+		t.Errorf("want no breakdown for a response, got: %q", got)
+	}
+
+	got := <-timings
+	if got.Connect <= 0 || got.FirstByte < 10*time.Millisecond {
+		t.Errorf("want the connection and first byte timed, got: %+v", got)
+	}
+}
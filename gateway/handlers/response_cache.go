@@ -0,0 +1,504 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// CacheTTLAnnotation is how long a GET response from a function is cached
+	// for, responses are only cached for functions with this annotation
+	CacheTTLAnnotation = "com.openfaas.cache.ttl"
+
+	// CacheGraceAnnotation is how long after the TTL a stale response is
+	// served whilst it is revalidated in the background
+	CacheGraceAnnotation = "com.openfaas.cache.stale-while-revalidate"
+
+	// CacheRevalidateAnnotation is how a stale response is revalidated, either
+	// "head" (default) for a conditional HEAD request followed by a GET when the
+	// response has changed, or "get" to always fetch the response again
+	CacheRevalidateAnnotation = "com.openfaas.cache.revalidate"
+
+	// CacheStaleIfErrorAnnotation is how long after the TTL a stale response
+	// is served in place of a 5xx response, or when the function is unreachable
+	CacheStaleIfErrorAnnotation = "com.openfaas.cache.stale-if-error"
+
+	// CacheKeyHeadersAnnotation is a comma-separated list of request headers
+	// whose values are part of the cache key, for responses which vary by
+	// them, i.e. "X-Locale"
+	CacheKeyHeadersAnnotation = "com.openfaas.cache.key-headers"
+
+	// CacheAuthenticatedAnnotation set to "true" caches responses to requests
+	// with an Authorization or Cookie header, for functions whose responses do
+	// not vary by the caller or are partitioned by key-headers
+	CacheAuthenticatedAnnotation = "com.openfaas.cache.authenticated"
+
+	revalidateHead = "head"
+	revalidateGet  = "get"
+)
+
+// CachedResponse is a function response held in the ResponseCache
+type CachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Expires time.Time
+}
+
+// ResponseCache holds responses from functions by cache key
+type ResponseCache struct {
+	MaxEntries int
+
+	entries      map[string]*CachedResponse
+	revalidating map[string]bool
+	lock         sync.Mutex
+
+	// generation is incremented by Flush, so that revalidations started
+	// before a flush do not cache their response after it
+	generation uint64
+}
+
+// NewResponseCache creates a ResponseCache holding up to maxEntries responses
+func NewResponseCache(maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		MaxEntries:   maxEntries,
+		entries:      make(map[string]*CachedResponse),
+		revalidating: make(map[string]bool),
+	}
+}
+
+// Get returns the cached response for key
+func (c *ResponseCache) Get(key string) (*CachedResponse, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+// Set caches a response for key, when the cache is full the entry closest
+// to expiry is evicted
+func (c *ResponseCache) Set(key string, entry *CachedResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.set(key, entry)
+}
+
+// set caches a response, the caller must hold the lock
+func (c *ResponseCache) set(key string, entry *CachedResponse) {
+	if _, exists := c.entries[key]; !exists && c.MaxEntries > 0 && len(c.entries) >= c.MaxEntries {
+		var oldest string
+		for k, v := range c.entries {
+			if len(oldest) == 0 || v.Expires.Before(c.entries[oldest].Expires) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = entry
+}
+
+// Flush removes every cached response and returns how many were removed,
+// the responses of revalidations in flight are discarded
+func (c *ResponseCache) Flush() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	flushed := len(c.entries)
+	c.entries = make(map[string]*CachedResponse)
+	c.generation++
+	return flushed
+}
+
+// Extend updates the expiry of the response for key, entries are replaced
+// rather than modified so that readers never see a partial update
+func (c *ResponseCache) Extend(key string, expires time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.extend(key, expires)
+}
+
+// extend updates the expiry of a response, the caller must hold the lock
+func (c *ResponseCache) extend(key string, expires time.Time) {
+	if entry, ok := c.entries[key]; ok {
+		extended := *entry
+		extended.Expires = expires
+		c.entries[key] = &extended
+	}
+}
+
+// startRevalidation returns true when no other revalidation for key is
+// running, along with the generation to pass to setRevalidated and
+// extendRevalidated
+func (c *ResponseCache) startRevalidation(key string) (uint64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.revalidating[key] {
+		return 0, false
+	}
+	c.revalidating[key] = true
+	return c.generation, true
+}
+
+// setRevalidated caches the response of a revalidation, unless the cache
+// was flushed after the revalidation started
+func (c *ResponseCache) setRevalidated(generation uint64, key string, entry *CachedResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if generation == c.generation {
+		c.set(key, entry)
+	}
+}
+
+// extendRevalidated extends a response after a revalidation, unless the
+// cache was flushed after the revalidation started
+func (c *ResponseCache) extendRevalidated(generation uint64, key string, expires time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if generation == c.generation {
+		c.extend(key, expires)
+	}
+}
+
+func (c *ResponseCache) endRevalidation(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.revalidating, key)
+}
+
+// cachePolicy is read from a function's annotations
+type cachePolicy struct {
+	ttl          time.Duration
+	grace        time.Duration
+	staleIfError time.Duration
+	revalidate   string
+	keyHeaders   []string
+
+	authenticated bool
+}
+
+func readCachePolicy(annotations map[string]string) (cachePolicy, bool) {
+	ttl, err := time.ParseDuration(strings.TrimSpace(annotations[CacheTTLAnnotation]))
+	if err != nil || ttl <= 0 {
+		return cachePolicy{}, false
+	}
+
+	policy := cachePolicy{ttl: ttl, revalidate: revalidateHead}
+	if grace, err := time.ParseDuration(strings.TrimSpace(annotations[CacheGraceAnnotation])); err == nil && grace > 0 {
+		policy.grace = grace
+	}
+	if staleIfError, err := time.ParseDuration(strings.TrimSpace(annotations[CacheStaleIfErrorAnnotation])); err == nil && staleIfError > 0 {
+		policy.staleIfError = staleIfError
+	}
+	if strings.TrimSpace(annotations[CacheRevalidateAnnotation]) == revalidateGet {
+		policy.revalidate = revalidateGet
+	}
+	for _, name := range strings.Split(annotations[CacheKeyHeadersAnnotation], ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			policy.keyHeaders = append(policy.keyHeaders, http.CanonicalHeaderKey(name))
+		}
+	}
+	sort.Strings(policy.keyHeaders)
+	policy.authenticated, _ = strconv.ParseBool(strings.TrimSpace(annotations[CacheAuthenticatedAnnotation]))
+	return policy, true
+}
+
+// MakeResponseCacheHandler caches successful GET responses for functions
+// with the com.openfaas.cache.ttl annotation. A stale response within the
+// com.openfaas.cache.stale-while-revalidate window is served straight away
+// and revalidated in the background. Beyond that, a stale response within the
+// com.openfaas.cache.stale-if-error window replaces a 5xx response from the
+// function. The Cache-Control header of a response is respected, see
+// responseTTL. Responses are cached apart by the request headers in the
+// com.openfaas.cache.key-headers annotation. Requests with credentials bypass
+// the cache, unless the function has the com.openfaas.cache.authenticated
+// annotation, and a response's Set-Cookie header is never cached. Responses
+// are keyed by the path from pathTransformer, which the function is sent, so
+// that paths normalised to the same one share an entry.
+func MakeResponseCacheHandler(next http.HandlerFunc, cache *ResponseCache, functionQuery scaling.FunctionQuery, pathTransformer middleware.URLPathTransformer, defaultNamespace string, maxBodyBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		policy, ok := readCachePolicy(annotations)
+		if !ok || (!policy.authenticated && hasCredentials(r)) {
+			next(w, r)
+			return
+		}
+
+		key := cacheKey(functionName+"."+namespace, pathTransformer.Transform(r), r, policy.keyHeaders)
+
+		var stale *CachedResponse
+		if entry, ok := cache.Get(key); ok {
+			now := time.Now()
+			if now.Before(entry.Expires) {
+				writeCachedResponse(w, entry, "HIT")
+				return
+			}
+
+			if now.Before(entry.Expires.Add(policy.grace)) {
+				writeCachedResponse(w, entry, "STALE")
+
+				if generation, ok := cache.startRevalidation(key); ok {
+					go revalidateCachedResponse(next, cache, generation, key, entry, r.Clone(context.Background()), policy, maxBodyBytes)
+				}
+				return
+			}
+
+			if now.Before(entry.Expires.Add(policy.staleIfError)) {
+				stale = entry
+			}
+		}
+
+		writer := &cacheResponseWriter{ResponseWriter: w, maxBodyBytes: maxBodyBytes}
+		if stale != nil {
+			writer.header = http.Header{}
+		}
+		writer.Header().Set("X-Cache", "MISS")
+		next(writer, r)
+
+		if writer.failed {
+			log.Printf("Response cache: serving stale %s after status %d\n", key, writer.Status())
+			writeCachedResponse(w, stale, "STALE")
+			return
+		}
+
+		if writer.Status() == http.StatusOK && !writer.overflow {
+			if ttl, ok := responseTTL(writer.Header(), policy.ttl); ok {
+				cache.Set(key, newCachedResponse(writer.Header(), writer.body.Bytes(), ttl))
+			}
+		}
+	}
+}
+
+// cacheKey is the function, host, path and query, followed by the value of
+// each of keyHeaders, so that responses which vary by them are cached apart.
+// The host is part of the key as links in responses may be built from it.
+func cacheKey(function string, path string, r *http.Request, keyHeaders []string) string {
+	var key strings.Builder
+	key.WriteString(function + " " + r.Host + path)
+	if len(r.URL.RawQuery) > 0 {
+		key.WriteString("?" + r.URL.RawQuery)
+	}
+	for _, name := range keyHeaders {
+		// A header value cannot contain a newline
+		key.WriteString("\n" + name + ": " + strings.Join(r.Header.Values(name), ", "))
+	}
+	return key.String()
+}
+
+// hasCredentials returns true when a request identifies its caller, so that
+// its response may be for that caller alone
+func hasCredentials(r *http.Request) bool {
+	return len(r.Header.Get("Authorization")) > 0 || len(r.Header.Get("Cookie")) > 0
+}
+
+// newCachedResponse copies a response for the cache, without its Set-Cookie
+// header which is for the client the response was written to
+func newCachedResponse(header http.Header, body []byte, ttl time.Duration) *CachedResponse {
+	cached := header.Clone()
+	cached.Del("X-Cache")
+	cached.Del("Set-Cookie")
+
+	return &CachedResponse{
+		Status:  http.StatusOK,
+		Header:  cached,
+		Body:    append([]byte{}, body...),
+		Expires: time.Now().Add(ttl),
+	}
+}
+
+func writeCachedResponse(w http.ResponseWriter, entry *CachedResponse, status string) {
+	for k, v := range entry.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("X-Cache", status)
+	w.Header().Set("Content-Length", strconv.Itoa(len(entry.Body)))
+
+	w.WriteHeader(entry.Status)
+	w.Write(entry.Body)
+}
+
+// revalidateCachedResponse asks the function whether entry has changed with a
+// conditional HEAD request, extending it on 304 Not Modified, otherwise the
+// response is fetched again with a GET request.
+func revalidateCachedResponse(next http.HandlerFunc, cache *ResponseCache, generation uint64, key string, entry *CachedResponse, r *http.Request, policy cachePolicy, maxBodyBytes int64) {
+	defer cache.endRevalidation(key)
+
+	if policy.revalidate == revalidateHead {
+		head := r.Clone(r.Context())
+		head.Method = http.MethodHead
+		if etag := entry.Header.Get("ETag"); len(etag) > 0 {
+			head.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.Header.Get("Last-Modified"); len(lastModified) > 0 {
+			head.Header.Set("If-Modified-Since", lastModified)
+		}
+
+		writer := newMemoryResponseWriter()
+		next(writer, head)
+
+		if writer.status == http.StatusNotModified {
+			if ttl, ok := responseTTL(writer.header, policy.ttl); ok {
+				cache.extendRevalidated(generation, key, time.Now().Add(ttl))
+			}
+			return
+		}
+	}
+
+	writer := newMemoryResponseWriter()
+	next(writer, r)
+
+	if writer.status != http.StatusOK || (maxBodyBytes > 0 && int64(writer.body.Len()) > maxBodyBytes) {
+		log.Printf("Response cache: unable to revalidate %s, status: %d\n", key, writer.status)
+		return
+	}
+	if ttl, ok := responseTTL(writer.header, policy.ttl); ok {
+		cache.setRevalidated(generation, key, newCachedResponse(writer.header, writer.body.Bytes(), ttl))
+	}
+}
+
+// responseTTL returns how long a response may be held in the cache from its
+// Cache-Control header, or ttl when it has no lifetime of its own. As the
+// gateway is a shared cache s-maxage takes precedence over max-age, and
+// responses marked no-store or private are never stored. no-cache responses
+// are not stored either, since each use would need revalidating.
+func responseTTL(header http.Header, ttl time.Duration) (time.Duration, bool) {
+	var maxAge, sMaxAge time.Duration = -1, -1
+
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			arg = strings.Trim(strings.TrimSpace(arg), `"`)
+
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "no-store", "no-cache", "private":
+				return 0, false
+			case "max-age":
+				if seconds, err := strconv.ParseInt(arg, 10, 64); err == nil && seconds >= 0 {
+					maxAge = time.Duration(seconds) * time.Second
+				}
+			case "s-maxage":
+				if seconds, err := strconv.ParseInt(arg, 10, 64); err == nil && seconds >= 0 {
+					sMaxAge = time.Duration(seconds) * time.Second
+				}
+			}
+		}
+	}
+
+	if sMaxAge >= 0 {
+		ttl = sMaxAge
+	} else if maxAge >= 0 {
+		ttl = maxAge
+	}
+	return ttl, ttl > 0
+}
+
+// cacheResponseWriter writes the response to the client and keeps a copy of
+// the body of up to maxBodyBytes for the cache. When header is set, the
+// response is held back until its status is known, and a 5xx response is
+// discarded so that a stale response can be written in its place.
+type cacheResponseWriter struct {
+	http.ResponseWriter
+
+	maxBodyBytes int64
+	statusCode   int
+	overflow     bool
+	body         bytes.Buffer
+
+	header http.Header
+	failed bool
+}
+
+func (c *cacheResponseWriter) Header() http.Header {
+	if c.header != nil {
+		return c.header
+	}
+	return c.ResponseWriter.Header()
+}
+
+func (c *cacheResponseWriter) Status() int {
+	if c.statusCode == 0 {
+		return http.StatusOK
+	}
+	return c.statusCode
+}
+
+func (c *cacheResponseWriter) WriteHeader(code int) {
+	if c.statusCode == 0 && code >= 200 {
+		c.statusCode = code
+
+		if c.header != nil {
+			if code >= http.StatusInternalServerError {
+				c.failed = true
+				return
+			}
+			for k, v := range c.header {
+				c.ResponseWriter.Header()[k] = v
+			}
+			c.header = nil
+		}
+	}
+	// Informational responses are dropped whilst the status is unknown
+	if c.failed || c.header != nil {
+		return
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *cacheResponseWriter) Write(data []byte) (int, error) {
+	if c.statusCode == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.failed {
+		return len(data), nil
+	}
+
+	if !c.overflow {
+		if c.maxBodyBytes > 0 && int64(c.body.Len()+len(data)) > c.maxBodyBytes {
+			c.overflow = true
+			c.body.Reset()
+		} else {
+			c.body.Write(data)
+		}
+	}
+	return c.ResponseWriter.Write(data)
+}
+
+func (c *cacheResponseWriter) Flush() {
+	if c.failed || c.header != nil {
+		return
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
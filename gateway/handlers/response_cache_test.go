@@ -0,0 +1,568 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// waitForRevalidation waits for background revalidation of key to finish
+func waitForRevalidation(t *testing.T, cache *ResponseCache, key string) {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		cache.lock.Lock()
+		running := cache.revalidating[key]
+		cache.lock.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	t.Fatalf("revalidation of %s did not finish", key)
+}
+
+func Test_MakeResponseCacheHandler_CachesGet(t *testing.T) {
+	var calls int32
+	next := func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Write([]byte(fmt.Sprintf("response %d", n)))
+	}
+
+	cache := NewResponseCache(10)
+	query := fakeFunctionQuery{annotations: map[string]string{CacheTTLAnnotation: "1m"}}
+	handler := MakeResponseCacheHandler(next, cache, query, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+
+	for i, want := range []string{"MISS", "HIT"} {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet?q=1", nil))
+
+		if got := rr.Header().Get("X-Cache"); got != want {
+			t.Errorf("request %d X-Cache want: %s, got: %s", i, want, got)
+		}
+		if rr.Body.String() != "response 1" {
+			t.Errorf("request %d body want: %s, got: %s", i, "response 1", rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/function/figlet?q=1", nil))
+	if rr.Body.String() != "response 2" {
+		t.Errorf("want POST not to be cached, got: %s", rr.Body.String())
+	}
+}
+
+func Test_MakeResponseCacheHandler_PartitionsByKeyHeaders(t *testing.T) {
+	var calls int32
+	next := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte("locale " + r.Header.Get("X-Locale")))
+	}
+
+	cache := NewResponseCache(10)
+	query := fakeFunctionQuery{annotations: map[string]string{
+		CacheTTLAnnotation:        "1m",
+		CacheKeyHeadersAnnotation: "x-locale, X-Tenant",
+	}}
+	handler := MakeResponseCacheHandler(next, cache, query, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+
+	requests := []struct {
+		locale    string
+		tenant    string
+		wantCache string
+		wantBody  string
+	}{
+		{locale: "en", wantCache: "MISS", wantBody: "locale en"},
+		{locale: "fr", wantCache: "MISS", wantBody: "locale fr"},
+		{locale: "en", wantCache: "HIT", wantBody: "locale en"},
+		{locale: "fr", wantCache: "HIT", wantBody: "locale fr"},
+		{locale: "en", tenant: "acme", wantCache: "MISS", wantBody: "locale en"},
+		{wantCache: "MISS", wantBody: "locale "},
+		{wantCache: "HIT", wantBody: "locale "},
+	}
+
+	for i, req := range requests {
+		r := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+		if len(req.locale) > 0 {
+			r.Header.Set("X-Locale", req.locale)
+		}
+		if len(req.tenant) > 0 {
+			r.Header.Set("X-Tenant", req.tenant)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+
+		if got := rr.Header().Get("X-Cache"); got != req.wantCache {
+			t.Errorf("request %d X-Cache want: %s, got: %s", i, req.wantCache, got)
+		}
+		if rr.Body.String() != req.wantBody {
+			t.Errorf("request %d body want: %q, got: %q", i, req.wantBody, rr.Body.String())
+		}
+	}
+
+	if calls != 4 {
+		t.Errorf("want the function called once per partition, got: %d", calls)
+	}
+}
+
+func Test_MakeResponseCacheHandler_BypassedWithCredentials(t *testing.T) {
+	var calls int32
+	next := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte("for " + r.Header.Get("Authorization")))
+	}
+
+	cache := NewResponseCache(10)
+	handler := MakeResponseCacheHandler(next, cache, fakeFunctionQuery{annotations: map[string]string{CacheTTLAnnotation: "1m"}}, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+
+	for _, header := range []string{"Authorization", "Cookie"} {
+		for i := 0; i < 2; i++ {
+			r := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+			r.Header.Set(header, "alice")
+			rr := httptest.NewRecorder()
+			handler(rr, r)
+
+			if got := rr.Header().Get("X-Cache"); len(got) > 0 {
+				t.Errorf("%s request %d X-Cache want empty, got: %s", header, i, got)
+			}
+		}
+	}
+	if calls != 4 {
+		t.Errorf("want every request with credentials forwarded, got: %d calls", calls)
+	}
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if got := rr.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("anonymous X-Cache want: MISS, got: %s", got)
+	}
+}
+
+func Test_MakeResponseCacheHandler_AuthenticatedAnnotation(t *testing.T) {
+	var calls int32
+	next := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte("public"))
+	}
+
+	query := fakeFunctionQuery{annotations: map[string]string{
+		CacheTTLAnnotation:           "1m",
+		CacheAuthenticatedAnnotation: "true",
+	}}
+	handler := MakeResponseCacheHandler(next, NewResponseCache(10), query, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+
+	for i, want := range []string{"MISS", "HIT"} {
+		r := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+		r.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+
+		if got := rr.Header().Get("X-Cache"); got != want {
+			t.Errorf("request %d X-Cache want: %s, got: %s", i, want, got)
+		}
+	}
+}
+
+func Test_MakeResponseCacheHandler_SetCookieNotCached(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "alice"})
+		w.Write([]byte("response"))
+	}
+
+	handler := MakeResponseCacheHandler(next, NewResponseCache(10), fakeFunctionQuery{annotations: map[string]string{CacheTTLAnnotation: "1m"}}, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if len(rr.Header().Get("Set-Cookie")) == 0 {
+		t.Errorf("want Set-Cookie for the first client")
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if got := rr.Header().Get("X-Cache"); got != "HIT" {
+		t.Errorf("X-Cache want: HIT, got: %s", got)
+	}
+	if got := rr.Header().Get("Set-Cookie"); len(got) > 0 {
+		t.Errorf("want Set-Cookie not to be replayed, got: %s", got)
+	}
+}
+
+func Test_cacheKey(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/function/figlet?q=1", nil)
+	if got := cacheKey("figlet.openfaas-fn", r.URL.Path, r, nil); got != "figlet.openfaas-fn example.com/function/figlet?q=1" {
+		t.Errorf("key without headers want: %q, got: %q", "figlet.openfaas-fn example.com/function/figlet?q=1", got)
+	}
+
+	other := httptest.NewRequest(http.MethodGet, "http://evil.example.com/function/figlet?q=1", nil)
+	if cacheKey("figlet.openfaas-fn", r.URL.Path, r, nil) == cacheKey("figlet.openfaas-fn", other.URL.Path, other, nil) {
+		t.Errorf("want different keys for different hosts")
+	}
+
+	// A value cannot pass itself off as another header
+	a := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	a.Header.Set("X-A", "1, X-B: 2")
+	b := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	b.Header.Set("X-A", "1")
+	b.Header.Set("X-B", "2")
+	if cacheKey("figlet", a.URL.Path, a, []string{"X-A", "X-B"}) == cacheKey("figlet", b.URL.Path, b, []string{"X-A", "X-B"}) {
+		t.Errorf("want different keys for different headers")
+	}
+}
+
+func Test_MakeResponseCacheHandler_KeysByNormalisedPath(t *testing.T) {
+	var calls int32
+	next := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("cached"))
+	}
+
+	transformer := middleware.TrailingSlashURLPathTransformer{
+		Transformer: middleware.TransparentURLPathTransformer{},
+		Mode:        middleware.TrailingSlashStrip,
+	}
+	handler := MakeResponseCacheHandler(next, NewResponseCache(10), fakeFunctionQuery{annotations: map[string]string{CacheTTLAnnotation: "1m"}}, transformer, "openfaas-fn", 1024)
+
+	for _, path := range []string{"/function/figlet", "/function/figlet/"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if calls != 1 {
+		t.Errorf("want the normalised paths to share an entry, calls: %d", calls)
+	}
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet/?q=1", nil))
+	if calls != 2 {
+		t.Errorf("want a query to be cached apart, calls: %d", calls)
+	}
+}
+
+func Test_MakeResponseCacheHandler_NotCachedWithoutAnnotation(t *testing.T) {
+	var calls int32
+	next := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}
+
+	handler := MakeResponseCacheHandler(next, NewResponseCache(10), fakeFunctionQuery{annotations: map[string]string{}}, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if calls != 2 {
+		t.Errorf("want 2 calls, got: %d", calls)
+	}
+}
+
+func Test_MakeResponseCacheHandler_HeadRevalidationExtendsOnNotModified(t *testing.T) {
+	var heads, gets int32
+	next := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			atomic.AddInt32(&heads, 1)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		atomic.AddInt32(&gets, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("v1"))
+	}
+
+	cache := NewResponseCache(10)
+	query := fakeFunctionQuery{annotations: map[string]string{
+		CacheTTLAnnotation:   "1m",
+		CacheGraceAnnotation: "1m",
+	}}
+	handler := MakeResponseCacheHandler(next, cache, query, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+	key := "figlet.openfaas-fn example.com/function/figlet"
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	cache.Extend(key, time.Now().Add(-time.Second))
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if got := rr.Header().Get("X-Cache"); got != "STALE" {
+		t.Errorf("X-Cache want: %s, got: %s", "STALE", got)
+	}
+	waitForRevalidation(t, cache, key)
+
+	entry, _ := cache.Get(key)
+	if !time.Now().Before(entry.Expires) {
+		t.Errorf("want entry to be fresh after revalidation")
+	}
+	if heads != 1 || gets != 1 {
+		t.Errorf("want 1 HEAD and 1 GET, got: %d HEAD %d GET", heads, gets)
+	}
+}
+
+func Test_MakeResponseCacheHandler_RevalidationUpdatesChangedResponse(t *testing.T) {
+	var version int32 = 1
+	next := func(w http.ResponseWriter, r *http.Request) {
+		v := atomic.LoadInt32(&version)
+		w.Header().Set("ETag", fmt.Sprintf(`"v%d"`, v))
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write([]byte(fmt.Sprintf("v%d", v)))
+	}
+
+	cache := NewResponseCache(10)
+	query := fakeFunctionQuery{annotations: map[string]string{
+		CacheTTLAnnotation:   "1m",
+		CacheGraceAnnotation: "1m",
+	}}
+	handler := MakeResponseCacheHandler(next, cache, query, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+	key := "figlet.openfaas-fn example.com/function/figlet"
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	cache.Extend(key, time.Now().Add(-time.Second))
+	atomic.StoreInt32(&version, 2)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if rr.Body.String() != "v1" {
+		t.Errorf("want stale response to be served, got: %s", rr.Body.String())
+	}
+	waitForRevalidation(t, cache, key)
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if rr.Body.String() != "v2" || rr.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("want updated response from the cache, got: %s %s", rr.Header().Get("X-Cache"), rr.Body.String())
+	}
+}
+
+func Test_MakeResponseCacheHandler_FlushDiscardsRevalidation(t *testing.T) {
+	revalidating := make(chan struct{})
+	release := make(chan struct{})
+	var requests int32
+	next := func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			close(revalidating)
+			<-release
+		}
+		w.Write([]byte("before flush"))
+	}
+
+	cache := NewResponseCache(10)
+	query := fakeFunctionQuery{annotations: map[string]string{
+		CacheTTLAnnotation:        "1m",
+		CacheGraceAnnotation:      "1m",
+		CacheRevalidateAnnotation: revalidateGet,
+	}}
+	handler := MakeResponseCacheHandler(next, cache, query, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+	key := "figlet.openfaas-fn example.com/function/figlet"
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	cache.Extend(key, time.Now().Add(-time.Second))
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	<-revalidating
+	cache.Flush()
+	close(release)
+	waitForRevalidation(t, cache, key)
+
+	if entry, ok := cache.Get(key); ok {
+		t.Errorf("want the revalidated response to be discarded after a flush, got: %s", entry.Body)
+	}
+}
+
+func Test_responseTTL(t *testing.T) {
+	cases := []struct {
+		name         string
+		cacheControl []string
+		wantTTL      time.Duration
+		wantOK       bool
+	}{
+		{name: "no header uses the annotation", wantTTL: time.Minute, wantOK: true},
+		{name: "no-store", cacheControl: []string{"no-store"}},
+		{name: "no-cache", cacheControl: []string{"No-Cache"}},
+		{name: "private", cacheControl: []string{"private, max-age=60"}},
+		{name: "max-age", cacheControl: []string{"public, max-age=30"}, wantTTL: time.Second * 30, wantOK: true},
+		{name: "max-age=0", cacheControl: []string{"max-age=0"}},
+		{name: "s-maxage takes precedence", cacheControl: []string{"max-age=30, s-maxage=300"}, wantTTL: time.Minute * 5, wantOK: true},
+		{name: "s-maxage before max-age", cacheControl: []string{"s-maxage=10", "max-age=300"}, wantTTL: time.Second * 10, wantOK: true},
+		{name: "quoted value", cacheControl: []string{`max-age="15"`}, wantTTL: time.Second * 15, wantOK: true},
+		{name: "invalid max-age is ignored", cacheControl: []string{"max-age=soon"}, wantTTL: time.Minute, wantOK: true},
+	}
+
+	for _, c := range cases {
+		header := http.Header{}
+		for _, value := range c.cacheControl {
+			header.Add("Cache-Control", value)
+		}
+
+		ttl, ok := responseTTL(header, time.Minute)
+		if ttl != c.wantTTL || ok != c.wantOK {
+			t.Errorf("%s want: %s %v, got: %s %v", c.name, c.wantTTL, c.wantOK, ttl, ok)
+		}
+	}
+}
+
+func Test_MakeResponseCacheHandler_RespectsCacheControl(t *testing.T) {
+	cases := []struct {
+		cacheControl string
+		wantSecond   string
+	}{
+		{cacheControl: "no-store", wantSecond: "MISS"},
+		{cacheControl: "no-cache", wantSecond: "MISS"},
+		{cacheControl: "private", wantSecond: "MISS"},
+		{cacheControl: "max-age=0", wantSecond: "MISS"},
+		{cacheControl: "max-age=60", wantSecond: "HIT"},
+		{cacheControl: "max-age=60, s-maxage=0", wantSecond: "MISS"},
+	}
+
+	for _, c := range cases {
+		next := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", c.cacheControl)
+			w.Write([]byte("response"))
+		}
+
+		query := fakeFunctionQuery{annotations: map[string]string{CacheTTLAnnotation: "1m"}}
+		handler := MakeResponseCacheHandler(next, NewResponseCache(10), query, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+		if got := rr.Header().Get("X-Cache"); got != c.wantSecond {
+			t.Errorf("%s want: %s, got: %s", c.cacheControl, c.wantSecond, got)
+		}
+	}
+}
+
+func Test_MakeResponseCacheHandler_MaxAgeSetsExpiry(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=5")
+		w.Write([]byte("response"))
+	}
+
+	cache := NewResponseCache(10)
+	query := fakeFunctionQuery{annotations: map[string]string{CacheTTLAnnotation: "1h"}}
+	handler := MakeResponseCacheHandler(next, cache, query, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	entry, ok := cache.Get("figlet.openfaas-fn example.com/function/figlet")
+	if !ok {
+		t.Fatal("want the response to be cached")
+	}
+	if remaining := time.Until(entry.Expires); remaining > time.Second*5 || remaining < time.Second*4 {
+		t.Errorf("want the entry to expire after max-age, expires in: %s", remaining)
+	}
+}
+
+func Test_MakeResponseCacheHandler_StaleIfError(t *testing.T) {
+	var status int32 = http.StatusOK
+	next := func(w http.ResponseWriter, r *http.Request) {
+		code := int(atomic.LoadInt32(&status))
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(code)
+		w.Write([]byte(fmt.Sprintf("status %d", code)))
+	}
+
+	cache := NewResponseCache(10)
+	query := fakeFunctionQuery{annotations: map[string]string{
+		CacheTTLAnnotation:          "1m",
+		CacheStaleIfErrorAnnotation: "1h",
+	}}
+	handler := MakeResponseCacheHandler(next, cache, query, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+	key := "figlet.openfaas-fn example.com/function/figlet"
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	cache.Extend(key, time.Now().Add(-time.Minute))
+
+	for _, code := range []int32{http.StatusBadGateway, http.StatusInternalServerError, http.StatusGatewayTimeout} {
+		atomic.StoreInt32(&status, code)
+
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("status %d want: %d, got: %d", code, http.StatusOK, rr.Code)
+		}
+		if got := rr.Header().Get("X-Cache"); got != "STALE" {
+			t.Errorf("status %d X-Cache want: %s, got: %s", code, "STALE", got)
+		}
+		if rr.Body.String() != "status 200" {
+			t.Errorf("status %d body want: %s, got: %s", code, "status 200", rr.Body.String())
+		}
+	}
+
+	atomic.StoreInt32(&status, http.StatusNotFound)
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if rr.Code != http.StatusNotFound || rr.Header().Get("X-Upstream") != "yes" || rr.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("want a 4xx response to be passed on, got: %d %v", rr.Code, rr.Header())
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if got := rr.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("X-Cache want: %s, got: %s", "MISS", got)
+	}
+	if entry, _ := cache.Get(key); !time.Now().Before(entry.Expires) {
+		t.Errorf("want a successful response to replace the stale entry")
+	}
+}
+
+func Test_MakeResponseCacheHandler_StaleIfErrorWindow(t *testing.T) {
+	var status int32 = http.StatusOK
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expired     time.Duration
+		want        string
+	}{
+		{
+			name:        "disabled by default",
+			annotations: map[string]string{CacheTTLAnnotation: "1m"},
+			expired:     time.Second,
+			want:        "MISS",
+		},
+		{
+			name:        "within window",
+			annotations: map[string]string{CacheTTLAnnotation: "1m", CacheStaleIfErrorAnnotation: "5m"},
+			expired:     time.Minute * 4,
+			want:        "STALE",
+		},
+		{
+			name:        "past window",
+			annotations: map[string]string{CacheTTLAnnotation: "1m", CacheStaleIfErrorAnnotation: "5m"},
+			expired:     time.Minute * 6,
+			want:        "MISS",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&status, http.StatusOK)
+
+			cache := NewResponseCache(10)
+			handler := MakeResponseCacheHandler(next, cache, fakeFunctionQuery{annotations: tc.annotations}, middleware.TransparentURLPathTransformer{}, "openfaas-fn", 1024)
+
+			handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+			cache.Extend("figlet.openfaas-fn example.com/function/figlet", time.Now().Add(-tc.expired))
+
+			atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+			if got := rr.Header().Get("X-Cache"); got != tc.want {
+				t.Errorf("X-Cache want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+	provider_types "github.com/openfaas/faas-provider/types"
+	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+// MakeScaleEventsHandler sends a ScaleEvent to events for each successful
+// request to scale a function, such as the scale to zero which evicts the
+// function from the cache. Requests to scale a function are those matched by
+// scaleRules, or types.DefaultScaleRules when nil. The replicas before the
+// request are read from functionQuery, which is consulted before next
+// changes them.
+func MakeScaleEventsHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, events scaling.ScaleEventSink, scaleRules []types.ScaleRule, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := types.MatchScaleRule(scaleRules, r.Method, r.URL.Path)
+		if !ok || r.Body == nil {
+			next(w, r)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		req, err := readScaleRequest(body, rule, r.URL.Path, r.URL.Query(), defaultNamespace)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		var fromReplicas uint64
+		if current, err := functionQuery.Get(req.ServiceName, req.Namespace); err == nil {
+			fromReplicas = current.Replicas
+		}
+
+		start := time.Now()
+		writer := httputil.NewHttpWriteInterceptor(w)
+		next(writer, r)
+
+		if writer.Status() < http.StatusOK || writer.Status() >= http.StatusMultipleChoices {
+			return
+		}
+
+		trigger := scaling.ScaleTriggerAPI
+		if req.Replicas == 0 {
+			trigger = scaling.ScaleTriggerToZero
+		}
+		events.Send(scaling.ScaleEvent{
+			Function:     req.ServiceName,
+			Namespace:    req.Namespace,
+			FromReplicas: fromReplicas,
+			ToReplicas:   req.Replicas,
+			Trigger:      trigger,
+			Duration:     time.Since(start),
+			Timestamp:    time.Now(),
+		})
+	}
+}
+
+// scaleRequest is a ScaleServiceRequest with the namespace, which the
+// provider's type only carries in newer versions
+type scaleRequest struct {
+	provider_types.ScaleServiceRequest
+	Namespace string `json:"namespace"`
+}
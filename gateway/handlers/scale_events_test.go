@@ -0,0 +1,121 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/scaling"
+	"github.com/openfaas/faas/gateway/types"
+)
+
+type capturingScaleEventSink struct {
+	lock   sync.Mutex
+	events []scaling.ScaleEvent
+}
+
+func (c *capturingScaleEventSink) Send(event scaling.ScaleEvent) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.events = append(c.events, event)
+}
+
+func Test_MakeScalingHandler_SendsScaleFromZeroEvent(t *testing.T) {
+	sink := &capturingScaleEventSink{}
+	config := scaling.ScalingConfig{
+		MaxPollCount:         5,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Second,
+		ServiceQuery:         &coldServiceQuery{},
+		ScaleEvents:          sink,
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, scaler, config, "openfaas-fn", nil)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(sink.events) != 1 {
+		t.Fatalf("want a single scale event, got: %+v", sink.events)
+	}
+	event := sink.events[0]
+	if event.Function != "figlet" || event.Namespace != "openfaas-fn" {
+		t.Errorf("function want: figlet.openfaas-fn, got: %s.%s", event.Function, event.Namespace)
+	}
+	if event.Trigger != scaling.ScaleTriggerFromZero || event.FromReplicas != 0 || event.ToReplicas != 1 {
+		t.Errorf("event want %s from 0 to 1 replicas, got: %+v", scaling.ScaleTriggerFromZero, event)
+	}
+	if event.Timestamp.IsZero() {
+		t.Errorf("want a timestamp")
+	}
+}
+
+func Test_MakeScaleEventsHandler_SendsScaleToZeroEvent(t *testing.T) {
+	sink := &capturingScaleEventSink{}
+	functionQuery := fakeFunctionQuery{annotations: map[string]string{}}
+
+	var received string
+	handler := MakeScaleEventsHandler(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}, functionQuery, sink, nil, "openfaas-fn")
+
+	body := `{"serviceName": "figlet", "replicas": 0}`
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/system/scale-function/figlet", strings.NewReader(body)))
+
+	if received != body {
+		t.Errorf("body want to be forwarded: %s, got: %s", body, received)
+	}
+	if len(sink.events) != 1 {
+		t.Fatalf("want a single scale event, got: %+v", sink.events)
+	}
+	event := sink.events[0]
+	if event.Function != "figlet" || event.Namespace != "openfaas-fn" || event.Trigger != scaling.ScaleTriggerToZero || event.ToReplicas != 0 {
+		t.Errorf("event want %s of figlet.openfaas-fn, got: %+v", scaling.ScaleTriggerToZero, event)
+	}
+}
+
+func Test_MakeScaleEventsHandler_IgnoresFailedScale(t *testing.T) {
+	sink := &capturingScaleEventSink{}
+	handler := MakeScaleEventsHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}, fakeFunctionQuery{annotations: map[string]string{}}, sink, nil, "openfaas-fn")
+
+	body := `{"serviceName": "figlet", "namespace": "dev", "replicas": 3}`
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/system/scale-function/figlet", strings.NewReader(body)))
+
+	if len(sink.events) != 0 {
+		t.Errorf("want no events for a failed scale, got: %+v", sink.events)
+	}
+}
+
+func Test_MakeScaleEventsHandler_CustomScaleRule(t *testing.T) {
+	sink := &capturingScaleEventSink{}
+	rules := []types.ScaleRule{{Method: http.MethodPut, PathPrefix: "/apis/scale/", ReplicaField: "spec.replicas"}}
+	handler := MakeScaleEventsHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, fakeFunctionQuery{annotations: map[string]string{}}, sink, rules, "openfaas-fn")
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/apis/scale/figlet?namespace=dev", strings.NewReader(`{"spec":{"replicas":3}}`)))
+
+	if len(sink.events) != 1 {
+		t.Fatalf("want a single scale event, got: %+v", sink.events)
+	}
+	event := sink.events[0]
+	if event.Function != "figlet" || event.Namespace != "dev" || event.Trigger != scaling.ScaleTriggerAPI || event.ToReplicas != 3 {
+		t.Errorf("event want %s of figlet.dev to 3 replicas, got: %+v", scaling.ScaleTriggerAPI, event)
+	}
+}
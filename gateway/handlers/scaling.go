@@ -4,43 +4,154 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/openfaas/faas/gateway/pkg/middleware"
 	"github.com/openfaas/faas/gateway/scaling"
 )
 
+// FunctionReplicasHeader is set on responses to the replicas a function had
+// when the request was forwarded, when ScalingConfig.ReplicasHeader is set
+const FunctionReplicasHeader = "X-Function-Replicas"
+
 // MakeScalingHandler creates handler which can scale a function from
 // zero to N replica(s). After scaling the next http.HandlerFunc will
 // be called. If the function is not ready after the configured
 // amount of attempts / queries then next will not be invoked and a status
 // will be returned to the client.
-func MakeScalingHandler(next http.HandlerFunc, scaler scaling.FunctionScaler, config scaling.ScalingConfig, defaultNamespace string) http.HandlerFunc {
+//
+// Notifiers receive a "scaling" event when a function is scaled from zero,
+// and config.ScaleEvents a ScaleEvent once it is available. A function which
+// could not be scheduled is failed over to a peer region by config.Failover.
+func MakeScalingHandler(next http.HandlerFunc, scaler scaling.FunctionScaler, config scaling.ScalingConfig, defaultNamespace string, notifiers []HTTPNotifier) http.HandlerFunc {
+
+	if len(notifiers) > 0 {
+		scaler.OnScaleFromZero = func(functionName, namespace string, replicas uint64) {
+			url := fmt.Sprintf("/function/%s.%s", functionName, namespace)
+			for _, notifier := range notifiers {
+				notifier.Notify("", url, url, http.StatusProcessing, "scaling", time.Second*0)
+			}
+		}
+	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		// start_time := time.Now()
 
 		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
 
-		res := scaler.Scale(functionName, namespace)
+		backoff := config.NotFoundBackoff
+		var clientIP string
+		if backoff != nil {
+			// The first X-Forwarded-For entry is set by the client, so only
+			// the entries appended by trusted proxies are used
+			if ip := sourceIP(r, config.TrustedProxies); ip != nil {
+				clientIP = ip.String()
+			} else {
+				clientIP = r.RemoteAddr
+			}
+			if retryAfter, ok := backoff.Check(clientIP, functionName+"."+namespace); ok {
+				// Rounded up, as a Retry-After of 0 invites an immediate retry
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(retryAfter.Seconds())))))
+				writeError(w, r, notFoundStatus(r, config), functionName+"."+namespace,
+					fmt.Sprintf("error finding function %s.%s", functionName, namespace))
+				return
+			}
+		}
+
+		target := readScaleHint(r, config)
+
+		// Warm functions skip the scaler whilst the cache entry is fresh
+		if target == 0 {
+			if cached, hit := scaler.Cache.Get(functionName, namespace); hit && cached.AvailableReplicas > 0 {
+				if config.ReplicasHeader {
+					setReplicasHeader(w, scaler.Cache, functionName, namespace, cached.AvailableReplicas)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		priority := r.Header.Get("X-Priority")
+
+		// The scaler gives up on a function which cannot be placed only when
+		// the request can be failed over
+		ctx := r.Context()
+		if config.Failover != nil && config.Failover.CanFailOver(r) {
+			ctx = scaling.WithFailover(ctx)
+		}
+
+		var res scaling.FunctionScaleResult
+		if target > 0 {
+			log.Printf("[Scale] function=%s.%s scale hint: %d\n", functionName, namespace, target)
+			res = scaler.ScaleWithPriority(ctx, functionName, namespace, target, priority)
+		} else if threshold := coldStartThreshold(config, functionName, namespace); threshold > 0 {
+			var ready bool
+			if res, ready = scaler.ScaleWithin(ctx, functionName, namespace, threshold, priority); !ready {
+				log.Printf("[Scale] function=%s.%s not ready after %s, client told to poll\n", functionName, namespace, threshold)
+				writeColdStartResponse(w, r, config, functionName, namespace)
+				return
+			}
+		} else {
+			res = scaler.ScaleWithPriority(ctx, functionName, namespace, 0, priority)
+		}
+
+		if err := r.Context().Err(); err != nil {
+			if timeBudgetExhausted(r.Context()) {
+				log.Printf("[Scale] function=%s.%s time budget exhausted during scale after %.4fs\n",
+					functionName, namespace, res.Duration.Seconds())
+				return
+			}
+			log.Printf("[Scale] function=%s.%s client cancelled during scale after %.4fs\n",
+				functionName, namespace, res.Duration.Seconds())
+			return
+		}
 
 		if !res.Found {
+			if catchAll, ok := catchAllFunction(config, functionName, namespace); ok {
+				catchAllRes := scaler.ScaleWithPriority(r.Context(), catchAll, namespace, 0, priority)
+				if catchAllRes.Available && catchAllRes.Error == nil {
+					log.Printf("[Scale] function=%s.%s not found, forwarding to catch-all function %s.%s\n",
+						functionName, namespace, catchAll, namespace)
+
+					if config.ReplicasHeader {
+						setReplicasHeader(w, scaler.Cache, catchAll, namespace, catchAllRes.Replicas)
+					}
+					next.ServeHTTP(w, catchAllRequest(r, functionName, namespace, catchAll))
+					return
+				}
+				log.Printf("[Scale] catch-all function %s.%s is not available for %s.%s\n",
+					catchAll, namespace, functionName, namespace)
+			}
+
 			errStr := fmt.Sprintf("error finding function %s.%s: %s", functionName, namespace, res.Error.Error())
 			log.Printf("Scaling: %s\n", errStr)
 
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(errStr))
+			if backoff != nil {
+				backoff.Record(clientIP, functionName+"."+namespace)
+			}
+
+			writeError(w, r, notFoundStatus(r, config), functionName+"."+namespace, errStr)
 			return
 		}
 
+		if backoff != nil {
+			backoff.Reset(clientIP, functionName+"."+namespace)
+		}
+
 		if res.Error != nil {
 			errStr := fmt.Sprintf("error finding function %s.%s: %s", functionName, namespace, res.Error.Error())
 			log.Printf("Scaling: %s\n", errStr)
 
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(errStr))
+			writeError(w, r, http.StatusInternalServerError, functionName+"."+namespace, errStr)
 			return
 		}
 
@@ -49,6 +160,38 @@ func MakeScalingHandler(next http.HandlerFunc, scaler scaling.FunctionScaler, co
 		// log.Printf("[Scale] for function [%s] took %s\n", functionName, scale_end_time.Sub(start_time))
 
 		if res.Available {
+			if res.Unschedulable && config.Failover != nil {
+				if peer, ok := config.Failover.Peer(r); ok {
+					log.Printf("[Scale] function=%s.%s not scheduled after %.4fs, failing over to region %s\n",
+						functionName, namespace, res.Duration.Seconds(), peer.Name)
+
+					next.ServeHTTP(w, middleware.WithFailover(r, middleware.Failover{Region: config.Failover.Region, URL: peer.URL, Auth: peer.Auth}))
+					return
+				}
+			}
+
+			if res.ScaledFromZero && config.ScaleEvents != nil {
+				config.ScaleEvents.Send(scaling.ScaleEvent{
+					Function:     functionName,
+					Namespace:    namespace,
+					FromReplicas: 0,
+					ToReplicas:   res.Replicas,
+					Trigger:      scaling.ScaleTriggerFromZero,
+					Duration:     res.Duration,
+					Timestamp:    time.Now(),
+				})
+			}
+
+			scaler.ScaleForLatency(functionName, namespace, res.Duration)
+
+			if timings := middleware.GetRequestTimings(r.Context()); timings != nil {
+				timings.Scale = res.Duration
+			}
+
+			if config.ReplicasHeader {
+				setReplicasHeader(w, scaler.Cache, functionName, namespace, res.Replicas)
+			}
+
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -57,3 +200,168 @@ func MakeScalingHandler(next http.HandlerFunc, scaler scaling.FunctionScaler, co
 			functionName, namespace, res.Duration.Seconds())
 	}
 }
+
+// setReplicasHeader sets the FunctionReplicasHeader to replicas, or to the
+// function's cached available replicas when replicas is not known
+func setReplicasHeader(w http.ResponseWriter, cache scaling.FunctionCacher, functionName, namespace string, replicas uint64) {
+	if replicas == 0 {
+		cached, hit := cache.Get(functionName, namespace)
+		if !hit {
+			return
+		}
+		replicas = cached.AvailableReplicas
+	}
+	w.Header().Set(FunctionReplicasHeader, strconv.FormatUint(replicas, 10))
+}
+
+// catchAllFunction returns the catch-all function of namespace, unless
+// functionName is the catch-all function itself
+func catchAllFunction(config scaling.ScalingConfig, functionName, namespace string) (string, bool) {
+	catchAll, ok := config.CatchAllFunctions[namespace]
+	if !ok || len(catchAll) == 0 || catchAll == functionName {
+		return "", false
+	}
+	return catchAll, true
+}
+
+// catchAllRequest returns a copy of r for the catch-all function, the rest
+// of the path is kept and the name of the function which was not found is
+// sent in the X-Original-Function header
+func catchAllRequest(r *http.Request, functionName, namespace, catchAll string) *http.Request {
+	rest := strings.TrimPrefix(r.URL.Path, "/function/"+middleware.GetServiceName(r.URL.String()))
+
+	catchAllReq := r.Clone(r.Context())
+	catchAllReq.URL.Path = "/function/" + catchAll + "." + namespace + rest
+	catchAllReq.URL.RawPath = ""
+	catchAllReq.RequestURI = catchAllReq.URL.RequestURI()
+	catchAllReq.Header.Set("X-Original-Function", functionName+"."+namespace)
+	return catchAllReq
+}
+
+// coldStartThreshold returns the function's cold-start threshold, 0 when it
+// has not opted-in to being polled
+func coldStartThreshold(config scaling.ScalingConfig, functionName, namespace string) time.Duration {
+	if config.FunctionQuery == nil {
+		return 0
+	}
+
+	annotations, err := config.FunctionQuery.GetAnnotations(functionName, namespace)
+	if err != nil {
+		return 0
+	}
+	return scaling.ColdStartThreshold(annotations)
+}
+
+// writeColdStartResponse tells the client that the function is starting and
+// that the request was not processed. The client should repeat the request
+// against Location after Retry-After seconds.
+//
+// When config.ColdStartHistory is set, X-Queue-Position is the function's
+// place in the cold start queue, 1 when it is next, or 0 once it is being
+// scaled, and X-Estimated-Ready-Ms estimates the time left from the
+// function's recent cold starts. The estimate is left out until a cold start
+// of the function has been recorded.
+func writeColdStartResponse(w http.ResponseWriter, r *http.Request, config scaling.ScalingConfig, functionName, namespace string) {
+	retryAfter := int(math.Ceil(config.FunctionPollInterval.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	if config.ColdStartHistory != nil {
+		key := functionName + "." + namespace
+
+		position := 0
+		if config.ColdStarts != nil {
+			position, _ = config.ColdStarts.Position(key)
+		}
+		w.Header().Set("X-Queue-Position", strconv.Itoa(position))
+
+		if remaining, ok := config.ColdStartHistory.Remaining(key); ok {
+			w.Header().Set("X-Estimated-Ready-Ms", strconv.FormatInt(remaining.Milliseconds(), 10))
+		}
+	}
+
+	w.Header().Set("Location", r.URL.RequestURI())
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("X-Function-Status", "starting")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("function is starting, the request was not processed, retry it after Retry-After seconds"))
+}
+
+// notFoundStatus returns the status for a function which cannot be found,
+// the longest matching route prefix takes precedence over the default
+func notFoundStatus(r *http.Request, config scaling.ScalingConfig) int {
+	status := http.StatusNotFound
+	if config.NotFoundStatus > 0 {
+		status = config.NotFoundStatus
+	}
+
+	matched := ""
+	for prefix, code := range config.NotFoundStatusPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+			status = code
+		}
+	}
+	return status
+}
+
+// getClientIP returns the first address in X-Forwarded-For, or the host
+// part of RemoteAddr when the header is not present
+func getClientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); len(forwarded) > 0 {
+		client, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(client)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// scaleHintParam is the query parameter used to request a replica count
+const scaleHintParam = "_scale"
+
+// ScaleHintSecretHeader carries the secret which authorizes the _scale query
+// parameter, it is removed before the request is forwarded
+const ScaleHintSecretHeader = "X-Scale-Hint-Secret"
+
+// readScaleHint returns the replica count requested through the _scale query
+// parameter and strips the parameter and its secret from the request so that
+// neither is forwarded to the function. 0 is returned when the hint is absent,
+// invalid, disabled, when no secret is configured or the caller did not send
+// it.
+func readScaleHint(r *http.Request, config scaling.ScalingConfig) uint64 {
+	if !config.EnableScaleHint {
+		return 0
+	}
+
+	secret := r.Header.Get(ScaleHintSecretHeader)
+	r.Header.Del(ScaleHintSecretHeader)
+
+	// The query is decoded so that an escaped key such as %5Fscale is found,
+	// and is only re-encoded when it holds the parameter
+	query, _ := url.ParseQuery(r.URL.RawQuery)
+	if _, ok := query[scaleHintParam]; !ok {
+		return 0
+	}
+
+	value := query.Get(scaleHintParam)
+	query.Del(scaleHintParam)
+	r.URL.RawQuery = query.Encode()
+
+	if len(config.ScaleHintSecret) == 0 ||
+		subtle.ConstantTimeCompare([]byte(secret), []byte(config.ScaleHintSecret)) != 1 {
+		log.Printf("[Scale] ignoring %s for unauthorized request\n", scaleHintParam)
+		return 0
+	}
+
+	target, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		log.Printf("[Scale] invalid value for %s: %q\n", scaleHintParam, value)
+		return 0
+	}
+	return target
+}
@@ -0,0 +1,791 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+func Test_readScaleHint_DisabledLeavesQuery(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet?_scale=5&q=1", nil)
+
+	got := readScaleHint(req, scaling.ScalingConfig{})
+	if got != 0 {
+		t.Errorf("want: %d, got: %d", 0, got)
+	}
+
+	want := "_scale=5&q=1"
+	if req.URL.RawQuery != want {
+		t.Errorf("RawQuery want: %s, got: %s", want, req.URL.RawQuery)
+	}
+}
+
+func Test_readScaleHint_StripsParameter(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet?a=1&_scale=5&q=1", nil)
+	req.Header.Set(ScaleHintSecretHeader, "secret")
+
+	got := readScaleHint(req, scaling.ScalingConfig{EnableScaleHint: true, ScaleHintSecret: "secret"})
+	if got != 5 {
+		t.Errorf("want: %d, got: %d", 5, got)
+	}
+
+	want := "a=1&q=1"
+	if req.URL.RawQuery != want {
+		t.Errorf("RawQuery want: %s, got: %s", want, req.URL.RawQuery)
+	}
+	if value := req.Header.Get(ScaleHintSecretHeader); len(value) > 0 {
+		t.Errorf("want %s to be stripped, got: %s", ScaleHintSecretHeader, value)
+	}
+}
+
+func Test_readScaleHint_EscapedParameter(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet?%5Fscale=5&q=1", nil)
+	req.Header.Set(ScaleHintSecretHeader, "secret")
+
+	got := readScaleHint(req, scaling.ScalingConfig{EnableScaleHint: true, ScaleHintSecret: "secret"})
+	if got != 5 {
+		t.Errorf("want: %d, got: %d", 5, got)
+	}
+
+	want := "q=1"
+	if req.URL.RawQuery != want {
+		t.Errorf("RawQuery want: %s, got: %s", want, req.URL.RawQuery)
+	}
+}
+
+func Test_readScaleHint_LeavesSimilarParameters(t *testing.T) {
+	rawQuery := "q=a%20b&x_scale=5&_scale_to=2&name=_scale"
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet?"+rawQuery, nil)
+	req.Header.Set(ScaleHintSecretHeader, "secret")
+
+	if got := readScaleHint(req, scaling.ScalingConfig{EnableScaleHint: true, ScaleHintSecret: "secret"}); got != 0 {
+		t.Errorf("want: %d, got: %d", 0, got)
+	}
+	if req.URL.RawQuery != rawQuery {
+		t.Errorf("want the query to be left as sent: %s, got: %s", rawQuery, req.URL.RawQuery)
+	}
+}
+
+func Test_readScaleHint_RequiresSecret(t *testing.T) {
+	config := scaling.ScalingConfig{EnableScaleHint: true, ScaleHintSecret: "secret"}
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet?_scale=5", nil)
+	if got := readScaleHint(req, config); got != 0 {
+		t.Errorf("unauthorized want: %d, got: %d", 0, got)
+	}
+	if req.URL.RawQuery != "" {
+		t.Errorf("want _scale to be stripped, got: %s", req.URL.RawQuery)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/function/figlet?_scale=5", nil)
+	req.SetBasicAuth("admin", "secret")
+	if got := readScaleHint(req, config); got != 0 {
+		t.Errorf("basic auth want: %d, got: %d", 0, got)
+	}
+	if req.Header.Get("Authorization") == "" {
+		t.Errorf("want the Authorization header to be left for the function")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/function/figlet?_scale=5", nil)
+	req.Header.Set(ScaleHintSecretHeader, "wrong")
+	if got := readScaleHint(req, config); got != 0 {
+		t.Errorf("wrong secret want: %d, got: %d", 0, got)
+	}
+}
+
+func Test_readScaleHint_IgnoredWithoutSecretConfigured(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet?_scale=5", nil)
+	req.Header.Set(ScaleHintSecretHeader, "")
+
+	if got := readScaleHint(req, scaling.ScalingConfig{EnableScaleHint: true}); got != 0 {
+		t.Errorf("want: %d, got: %d", 0, got)
+	}
+	if req.URL.RawQuery != "" {
+		t.Errorf("want _scale to be stripped, got: %s", req.URL.RawQuery)
+	}
+}
+
+func Test_getClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.RemoteAddr = "10.0.0.2:31112"
+
+	if got := getClientIP(req); got != "10.0.0.2" {
+		t.Errorf("RemoteAddr want: %s, got: %s", "10.0.0.2", got)
+	}
+
+	req.Header.Set("X-Forwarded-For", "192.168.0.10, 10.0.0.1")
+	if got := getClientIP(req); got != "192.168.0.10" {
+		t.Errorf("X-Forwarded-For want: %s, got: %s", "192.168.0.10", got)
+	}
+}
+
+type coldServiceQuery struct {
+	replicas uint64
+}
+
+func (c *coldServiceQuery) GetReplicas(service, namespace string) (scaling.ServiceQueryResponse, error) {
+	return scaling.ServiceQueryResponse{Replicas: c.replicas, AvailableReplicas: c.replicas}, nil
+}
+
+func (c *coldServiceQuery) SetReplicas(service, namespace string, count uint64) error {
+	c.replicas = count
+	return nil
+}
+
+type eventNotifier struct {
+	events []string
+	urls   []string
+}
+
+func (e *eventNotifier) Notify(method string, URL string, originalURL string, statusCode int, event string, duration time.Duration) {
+	e.events = append(e.events, event)
+	e.urls = append(e.urls, URL)
+}
+
+func Test_MakeScalingHandler_NotifiesScalingOnColdStart(t *testing.T) {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         5,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Second,
+		ServiceQuery:         &coldServiceQuery{},
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+	notifier := &eventNotifier{}
+
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, scaler, config, "openfaas-fn", []HTTPNotifier{notifier})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(notifier.events) != 1 || notifier.events[0] != "scaling" {
+		t.Fatalf("want a single scaling event, got: %v", notifier.events)
+	}
+	if notifier.urls[0] != "/function/figlet.openfaas-fn" {
+		t.Errorf("URL want: %s, got: %s", "/function/figlet.openfaas-fn", notifier.urls[0])
+	}
+}
+
+// startingServiceQuery accepts a scale up, but never makes replicas available
+type startingServiceQuery struct {
+	lock     sync.Mutex
+	replicas uint64
+	queries  int
+
+	// unschedulable reports the replicas as ones the provider cannot place
+	unschedulable bool
+}
+
+func (s *startingServiceQuery) GetReplicas(service, namespace string) (scaling.ServiceQueryResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queries++
+	res := scaling.ServiceQueryResponse{Replicas: s.replicas}
+	if s.unschedulable {
+		res.UnschedulableReplicas = s.replicas
+	}
+	return res, nil
+}
+
+func (s *startingServiceQuery) SetReplicas(service, namespace string, count uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.replicas = count
+	return nil
+}
+
+func Test_MakeScalingHandler_ClientCancelledDuringScale(t *testing.T) {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         1000,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond * 10,
+		CacheExpiry:          time.Second,
+		ServiceQuery:         &startingServiceQuery{},
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	called := false
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}, scaler, config, "openfaas-fn", []HTTPNotifier{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil).WithContext(ctx)
+
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if called {
+		t.Errorf("want next not to be called once the client has gone away")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("want the scale wait to stop when the client cancelled, took %s", elapsed)
+	}
+}
+
+func Test_notFoundStatus(t *testing.T) {
+	config := scaling.ScalingConfig{
+		NotFoundStatus: http.StatusGone,
+		NotFoundStatusPrefixes: map[string]int{
+			"/function/":        http.StatusBadGateway,
+			"/function/legacy-": http.StatusServiceUnavailable,
+		},
+	}
+
+	cases := []struct {
+		path   string
+		config scaling.ScalingConfig
+		want   int
+	}{
+		{path: "/function/figlet", config: scaling.ScalingConfig{}, want: http.StatusNotFound},
+		{path: "/async-function/figlet", config: config, want: http.StatusGone},
+		{path: "/function/figlet", config: config, want: http.StatusBadGateway},
+		{path: "/function/legacy-figlet", config: config, want: http.StatusServiceUnavailable},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		if got := notFoundStatus(req, c.config); got != c.want {
+			t.Errorf("%s want: %d, got: %d", c.path, c.want, got)
+		}
+	}
+}
+
+type slowStartServiceQuery struct {
+	lock     sync.Mutex
+	replicas uint64
+	setCalls int
+	readyAt  time.Time
+	startup  time.Duration
+}
+
+func (s *slowStartServiceQuery) GetReplicas(service, namespace string) (scaling.ServiceQueryResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := scaling.ServiceQueryResponse{Replicas: s.replicas}
+	if s.replicas > 0 && time.Now().After(s.readyAt) {
+		res.AvailableReplicas = s.replicas
+	}
+	return res, nil
+}
+
+func (s *slowStartServiceQuery) SetReplicas(service, namespace string, count uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.setCalls++
+	s.replicas = count
+	s.readyAt = time.Now().Add(s.startup)
+	return nil
+}
+
+func Test_MakeScalingHandler_ColdStartTellsClientToPoll(t *testing.T) {
+	query := &slowStartServiceQuery{startup: time.Millisecond * 200}
+	config := scaling.ScalingConfig{
+		MaxPollCount:         100,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond * 10,
+		CacheExpiry:          time.Millisecond,
+		ServiceQuery:         query,
+		FunctionQuery: fakeFunctionQuery{annotations: map[string]string{
+			scaling.ColdStartThresholdAnnotation: "20ms",
+		}},
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	called := 0
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+		called++
+	}, scaler, config, "openfaas-fn", nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/figlet?q=1", nil))
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status want: %d, got: %d", http.StatusAccepted, rr.Code)
+	}
+	if got := rr.Header().Get("Location"); got != "/function/figlet?q=1" {
+		t.Errorf("Location want: %s, got: %s", "/function/figlet?q=1", got)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After want: 1, got: %s", got)
+	}
+	if called != 0 {
+		t.Errorf("want the request not to be processed")
+	}
+
+	// A poll during the cold start shares the background scale
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/figlet?q=1", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("poll status want: %d, got: %d", http.StatusAccepted, rr.Code)
+	}
+
+	time.Sleep(time.Millisecond * 300)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/figlet?q=1", nil))
+	if called != 1 {
+		t.Errorf("want the request to be processed once ready, status: %d", rr.Code)
+	}
+
+	query.lock.Lock()
+	defer query.lock.Unlock()
+	if query.setCalls != 1 {
+		t.Errorf("want a single scale up, got: %d", query.setCalls)
+	}
+}
+
+func Test_MakeScalingHandler_ColdStartProgress(t *testing.T) {
+	query := &slowStartServiceQuery{startup: time.Millisecond * 100}
+	config := scaling.ScalingConfig{
+		MaxPollCount:         100,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond * 10,
+		CacheExpiry:          time.Millisecond,
+		ServiceQuery:         query,
+		FunctionQuery: fakeFunctionQuery{annotations: map[string]string{
+			scaling.ColdStartThresholdAnnotation: "20ms",
+		}},
+		ColdStarts:       scaling.NewColdStartQueue(1, 0),
+		ColdStartHistory: scaling.NewColdStartHistory(5),
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {}, scaler, config, "openfaas-fn", nil)
+
+	// Another function's cold start holds the only place
+	config.ColdStarts.Acquire(context.Background(), "other.openfaas-fn", scaling.PriorityNormal)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status want: %d, got: %d", http.StatusAccepted, rr.Code)
+	}
+	if got := rr.Header().Get("X-Queue-Position"); got != "1" {
+		t.Errorf("X-Queue-Position want: 1, got: %q", got)
+	}
+	if _, ok := rr.Header()["X-Estimated-Ready-Ms"]; ok {
+		t.Errorf("want no estimate without history, got: %q", rr.Header().Get("X-Estimated-Ready-Ms"))
+	}
+
+	config.ColdStarts.Release("other.openfaas-fn")
+	time.Sleep(time.Millisecond * 300)
+
+	average, ok := config.ColdStartHistory.Average("figlet.openfaas-fn")
+	if !ok {
+		t.Fatalf("want the cold start to be recorded")
+	}
+
+	// Scale to zero, then the next cold start has an estimate
+	query.lock.Lock()
+	query.replicas = 0
+	query.lock.Unlock()
+	time.Sleep(config.CacheExpiry * 2)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status want: %d, got: %d", http.StatusAccepted, rr.Code)
+	}
+	if got := rr.Header().Get("X-Queue-Position"); got != "0" {
+		t.Errorf("X-Queue-Position want: 0, got: %q", got)
+	}
+	estimate, err := strconv.ParseInt(rr.Header().Get("X-Estimated-Ready-Ms"), 10, 64)
+	if err != nil {
+		t.Fatalf("X-Estimated-Ready-Ms want a number, got: %q", rr.Header().Get("X-Estimated-Ready-Ms"))
+	}
+	if estimate <= 0 || estimate > average.Milliseconds() {
+		t.Errorf("X-Estimated-Ready-Ms want between 0 and %d, got: %d", average.Milliseconds(), estimate)
+	}
+
+	time.Sleep(time.Millisecond * 200)
+}
+
+func Test_MakeScalingHandler_ColdStartWithoutProgress(t *testing.T) {
+	query := &slowStartServiceQuery{startup: time.Millisecond * 50}
+	config := scaling.ScalingConfig{
+		MaxPollCount:         100,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond * 10,
+		CacheExpiry:          time.Millisecond,
+		ServiceQuery:         query,
+		FunctionQuery: fakeFunctionQuery{annotations: map[string]string{
+			scaling.ColdStartThresholdAnnotation: "10ms",
+		}},
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {}, scaler, config, "openfaas-fn", nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status want: %d, got: %d", http.StatusAccepted, rr.Code)
+	}
+	for _, header := range []string{"X-Queue-Position", "X-Estimated-Ready-Ms"} {
+		if _, ok := rr.Header()[header]; ok {
+			t.Errorf("want no %s unless enabled", header)
+		}
+	}
+
+	time.Sleep(time.Millisecond * 100)
+}
+
+func Test_MakeScalingHandler_ColdStartBlocksWithoutAnnotation(t *testing.T) {
+	query := &slowStartServiceQuery{startup: time.Millisecond * 50}
+	config := scaling.ScalingConfig{
+		MaxPollCount:         100,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond * 10,
+		CacheExpiry:          time.Millisecond,
+		ServiceQuery:         query,
+		FunctionQuery:        fakeFunctionQuery{annotations: map[string]string{}},
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	called := 0
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+		called++
+	}, scaler, config, "openfaas-fn", nil)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if called != 1 {
+		t.Errorf("want the request to wait for the function")
+	}
+}
+
+type countingServiceQuery struct {
+	calls int
+}
+
+func (c *countingServiceQuery) GetReplicas(service, namespace string) (scaling.ServiceQueryResponse, error) {
+	c.calls++
+	return scaling.ServiceQueryResponse{Replicas: 1, AvailableReplicas: 1}, nil
+}
+
+func (c *countingServiceQuery) SetReplicas(service, namespace string, count uint64) error {
+	return nil
+}
+
+type countingFunctionQuery struct {
+	fakeFunctionQuery
+	calls int
+}
+
+func (c *countingFunctionQuery) GetAnnotations(name string, namespace string) (map[string]string, error) {
+	c.calls++
+	return c.fakeFunctionQuery.GetAnnotations(name, namespace)
+}
+
+func Test_MakeScalingHandler_WarmFunctionSkipsScaler(t *testing.T) {
+	query := &countingServiceQuery{}
+	functionQuery := &countingFunctionQuery{fakeFunctionQuery: fakeFunctionQuery{annotations: map[string]string{
+		scaling.ColdStartThresholdAnnotation: "1s",
+	}}}
+	config := scaling.ScalingConfig{
+		MaxPollCount:         5,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Minute,
+		ServiceQuery:         query,
+		FunctionQuery:        functionQuery,
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	called := 0
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+		called++
+	}, scaler, config, "openfaas-fn", nil)
+
+	for i := 0; i < 10; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	}
+
+	if called != 10 {
+		t.Errorf("want every request to be forwarded, got: %d", called)
+	}
+	if query.calls != 1 {
+		t.Errorf("want the provider to be queried once, got: %d", query.calls)
+	}
+	if functionQuery.calls != 1 {
+		t.Errorf("want warm requests to skip the scaler, annotations queried: %d", functionQuery.calls)
+	}
+}
+
+func Test_MakeScalingHandler_ReplicasHeader(t *testing.T) {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         5,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Minute,
+		ServiceQuery:         &coldServiceQuery{replicas: 3},
+		ReplicasHeader:       true,
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, scaler, config, "openfaas-fn", nil)
+
+	// The first request is given the replicas found by the scaler, the
+	// second those in the cache
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+		if got := rec.Header().Get(FunctionReplicasHeader); got != "3" {
+			t.Errorf("request %d: %s want: %s, got: %q", i, FunctionReplicasHeader, "3", got)
+		}
+	}
+}
+
+func Test_MakeScalingHandler_ReplicasHeaderDisabled(t *testing.T) {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         5,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Minute,
+		ServiceQuery:         &coldServiceQuery{replicas: 3},
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, scaler, config, "openfaas-fn", nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if got := rec.Header().Get(FunctionReplicasHeader); got != "" {
+		t.Errorf("%s want none by default, got: %q", FunctionReplicasHeader, got)
+	}
+}
+
+func Test_MakeScalingHandler_FailsOverUnschedulable(t *testing.T) {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         3,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Minute,
+		ServiceQuery:         &startingServiceQuery{unschedulable: true},
+		Failover: scaling.NewRegionFailover("eu-west", []scaling.PeerRegion{
+			{Name: "us-east", URL: "https://gw.us-east"},
+		}),
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	var failover middleware.Failover
+	var failingOver bool
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+		failover, failingOver = middleware.GetFailover(r.Context())
+	}, scaler, config, "openfaas-fn", nil)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if !failingOver || failover.URL != "https://gw.us-east" || failover.Region != "eu-west" {
+		t.Errorf("want a failover from eu-west to us-east, got: %+v (%v)", failover, failingOver)
+	}
+
+	// A request failed over by another region waits out the polls for the
+	// function before it is forwarded to it
+	query := config.ServiceQuery.(*startingServiceQuery)
+	query.queries = 0
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.Header.Set(middleware.FailoverHopHeader, "us-east")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if failingOver {
+		t.Errorf("want no failover for a request which was failed over, got: %+v", failover)
+	}
+	if query.queries < int(config.MaxPollCount) {
+		t.Errorf("want the function to be polled %d times, got: %d", config.MaxPollCount, query.queries)
+	}
+}
+
+func Test_MakeScalingHandler_WaitsForUnschedulableWithoutFailover(t *testing.T) {
+	query := &startingServiceQuery{unschedulable: true}
+	config := scaling.ScalingConfig{
+		MaxPollCount:         3,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Minute,
+		ServiceQuery:         query,
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, scaler, config, "openfaas-fn", nil)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if query.queries < int(config.MaxPollCount) {
+		t.Errorf("want the function to be polled %d times without failover, got: %d", config.MaxPollCount, query.queries)
+	}
+}
+
+// knownServiceQuery finds only the functions it was created with
+type knownServiceQuery struct {
+	functions map[string]bool
+}
+
+func (k *knownServiceQuery) GetReplicas(service, namespace string) (scaling.ServiceQueryResponse, error) {
+	if !k.functions[service+"."+namespace] {
+		return scaling.ServiceQueryResponse{}, fmt.Errorf("function %s.%s: %w", service, namespace, scaling.ErrFunctionNotFound)
+	}
+	return scaling.ServiceQueryResponse{Replicas: 1, AvailableReplicas: 1}, nil
+}
+
+func (k *knownServiceQuery) SetReplicas(service, namespace string, count uint64) error {
+	return nil
+}
+
+func Test_MakeScalingHandler_CatchAllFunction(t *testing.T) {
+	cases := []struct {
+		name          string
+		path          string
+		functions     []string
+		catchAll      map[string]string
+		wantStatus    int
+		wantPath      string
+		wantOriginal  string
+		wantForwarded bool
+	}{
+		{
+			name:          "matched function",
+			path:          "/function/figlet/render",
+			functions:     []string{"figlet.openfaas-fn", "not-found.openfaas-fn"},
+			catchAll:      map[string]string{"openfaas-fn": "not-found"},
+			wantStatus:    http.StatusOK,
+			wantPath:      "/function/figlet/render",
+			wantForwarded: true,
+		},
+		{
+			name:          "unmatched with catch-all",
+			path:          "/function/missing.dev/render?q=1",
+			functions:     []string{"not-found.dev"},
+			catchAll:      map[string]string{"dev": "not-found"},
+			wantStatus:    http.StatusOK,
+			wantPath:      "/function/not-found.dev/render",
+			wantOriginal:  "missing.dev",
+			wantForwarded: true,
+		},
+		{
+			name:       "unmatched without catch-all",
+			path:       "/function/missing",
+			functions:  []string{"not-found.dev"},
+			catchAll:   map[string]string{"dev": "not-found"},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "catch-all not found",
+			path:       "/function/missing",
+			functions:  []string{},
+			catchAll:   map[string]string{"openfaas-fn": "not-found"},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "catch-all requested and not found",
+			path:       "/function/not-found",
+			functions:  []string{},
+			catchAll:   map[string]string{"openfaas-fn": "not-found"},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			known := map[string]bool{}
+			for _, function := range tc.functions {
+				known[function] = true
+			}
+
+			config := scaling.ScalingConfig{
+				MaxPollCount:         5,
+				SetScaleRetries:      2,
+				FunctionPollInterval: time.Millisecond,
+				CacheExpiry:          time.Second,
+				ServiceQuery:         &knownServiceQuery{functions: known},
+				CatchAllFunctions:    tc.catchAll,
+			}
+			scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+			var forwarded *http.Request
+			handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = r
+			}, scaler, config, "openfaas-fn", nil)
+
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rr.Code != tc.wantStatus {
+				t.Errorf("status want: %d, got: %d", tc.wantStatus, rr.Code)
+			}
+			if (forwarded != nil) != tc.wantForwarded {
+				t.Fatalf("forwarded want: %t, got: %t", tc.wantForwarded, forwarded != nil)
+			}
+			if forwarded == nil {
+				return
+			}
+			if forwarded.URL.Path != tc.wantPath {
+				t.Errorf("path want: %s, got: %s", tc.wantPath, forwarded.URL.Path)
+			}
+			if got := forwarded.Header.Get("X-Original-Function"); got != tc.wantOriginal {
+				t.Errorf("X-Original-Function want: %q, got: %q", tc.wantOriginal, got)
+			}
+			if len(tc.wantOriginal) > 0 && forwarded.URL.RawQuery != "q=1" {
+				t.Errorf("want the query to be kept, got: %q", forwarded.URL.RawQuery)
+			}
+		})
+	}
+}
+
+func Test_MakeScalingHandler_NotFoundBackoffIgnoresSpoofedForwardedFor(t *testing.T) {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         5,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Second,
+		ServiceQuery:         &knownServiceQuery{functions: map[string]bool{}},
+		NotFoundBackoff:      scaling.NewNotFoundBackoff(1, time.Millisecond*500, 10),
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	handler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("want no request to be forwarded")
+	}, scaler, config, "openfaas-fn", nil)
+
+	for i, forwardedFor := range []string{"203.0.113.1", "203.0.113.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/function/missing", nil)
+		req.RemoteAddr = "192.0.2.10:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("request %d status want: %d, got: %d", i, http.StatusNotFound, rr.Code)
+		}
+
+		wantRetryAfter := ""
+		if i > 0 {
+			// A backoff below a second is rounded up rather than down to 0
+			wantRetryAfter = "1"
+		}
+		if got := rr.Header().Get("Retry-After"); got != wantRetryAfter {
+			t.Errorf("request %d Retry-After want: %q, got: %q", i, wantRetryAfter, got)
+		}
+	}
+}
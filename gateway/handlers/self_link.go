@@ -0,0 +1,100 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+var errNotJSONObject = errors.New("not a JSON object")
+
+// SelfLinkAnnotation is the key added to a function's JSON object responses
+// with a link to the request URL, i.e. "_self"
+const SelfLinkAnnotation = "com.openfaas.self-link"
+
+// MakeSelfLinkHandler adds a link to the request URL to successful JSON
+// object responses for functions with the com.openfaas.self-link annotation.
+// Arrays, other content types, non-2xx responses and responses larger than
+// maxBodyBytes are passed on unchanged, as are objects which already have
+// the key. The link's scheme and host are found with publicURL.
+func MakeSelfLinkHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, publicURL PublicURL, defaultNamespace string, maxBodyBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		key := strings.TrimSpace(annotations[SelfLinkAnnotation])
+		if err != nil || len(key) == 0 {
+			next(w, r)
+			return
+		}
+
+		writer := &bufferedResponseWriter{
+			ResponseWriter:      w,
+			maxBodyBytes:        maxBodyBytes,
+			passThroughOverflow: true,
+		}
+		writer.passThrough = func(header http.Header) bool {
+			return writer.Status() < 200 || writer.Status() > 299 || !isJSONContentType(header.Get("Content-Type"))
+		}
+		next(writer, r)
+
+		if writer.passingThrough {
+			return
+		}
+
+		body := writer.body.Bytes()
+		if linked, err := addSelfLink(body, key, selfLink(r, publicURL)); err == nil {
+			body = linked
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		} else if err != errNotJSONObject {
+			log.Printf("Self link: response for %s.%s left unchanged: %s\n", functionName, namespace, err)
+		}
+
+		w.WriteHeader(writer.Status())
+		w.Write(body)
+	}
+}
+
+// selfLink returns the absolute URL of the request as seen by the client
+func selfLink(r *http.Request, publicURL PublicURL) string {
+	return publicURL.Base(r) + r.URL.RequestURI()
+}
+
+// addSelfLink sets key to link in a JSON object, other JSON values are
+// returned as an error
+func addSelfLink(body []byte, key, link string) ([]byte, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, errNotJSONObject
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+
+	document := map[string]interface{}{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	if _, exists := document[key]; exists {
+		return body, nil
+	}
+	document[key] = link
+
+	out := &bytes.Buffer{}
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,123 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func Test_MakeSelfLinkHandler(t *testing.T) {
+	query := fakeFunctionQuery{annotations: map[string]string{SelfLinkAnnotation: "_self"}}
+
+	scenarios := []struct {
+		name        string
+		contentType string
+		status      int
+		body        string
+		maxBytes    int64
+		wantBody    string
+	}{
+		{
+			name:        "JSON object gets a link",
+			contentType: "application/json",
+			status:      http.StatusOK,
+			body:        `{"id":7,"name":"<alex>"}`,
+			maxBytes:    1024,
+			wantBody:    `{"_self":"http://gateway:8080/function/orders/7?expand=true","id":7,"name":"<alex>"}`,
+		},
+		{
+			name:        "existing key is kept",
+			contentType: "application/json",
+			status:      http.StatusOK,
+			body:        `{"_self":"/orders/7"}`,
+			maxBytes:    1024,
+			wantBody:    `{"_self":"/orders/7"}`,
+		},
+		{
+			name:        "array is unchanged",
+			contentType: "application/json",
+			status:      http.StatusOK,
+			body:        `[{"id":7}]`,
+			maxBytes:    1024,
+			wantBody:    `[{"id":7}]`,
+		},
+		{
+			name:        "text is unchanged",
+			contentType: "text/plain",
+			status:      http.StatusOK,
+			body:        `{"id":7}`,
+			maxBytes:    1024,
+			wantBody:    `{"id":7}`,
+		},
+		{
+			name:        "error is unchanged",
+			contentType: "application/json",
+			status:      http.StatusNotFound,
+			body:        `{"error":"not found"}`,
+			maxBytes:    1024,
+			wantBody:    `{"error":"not found"}`,
+		},
+		{
+			name:        "over the size cap is unchanged",
+			contentType: "application/json",
+			status:      http.StatusOK,
+			body:        `{"id":7,"name":"alex"}`,
+			maxBytes:    8,
+			wantBody:    `{"id":7,"name":"alex"}`,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			handler := MakeSelfLinkHandler(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", s.contentType)
+				w.Header().Set("Content-Length", strconv.Itoa(len(s.body)))
+				w.WriteHeader(s.status)
+				w.Write([]byte(s.body[:4]))
+				w.Write([]byte(s.body[4:]))
+			}, query, PublicURL{}, "openfaas-fn", s.maxBytes)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "http://gateway:8080/function/orders/7?expand=true", nil)
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != s.status {
+				t.Errorf("status want: %d, got: %d", s.status, rec.Code)
+			}
+			if rec.Body.String() != s.wantBody {
+				t.Errorf("body want: %s, got: %s", s.wantBody, rec.Body.String())
+			}
+			if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(rec.Body.Len()) {
+				t.Errorf("Content-Length want: %d, got: %s", rec.Body.Len(), got)
+			}
+		})
+	}
+}
+
+func Test_selfLink_ForwardedHeadersFromTrustedProxies(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://gateway:8080/function/orders", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "api.example.com")
+
+	if got := selfLink(req, PublicURL{}); got != "http://gateway:8080/function/orders" {
+		t.Errorf("want forwarded headers ignored without trusted proxies, got: %s", got)
+	}
+	if got := selfLink(req, PublicURL{TrustedProxies: 1}); got != "https://api.example.com/function/orders" {
+		t.Errorf("want forwarded headers from a trusted proxy, got: %s", got)
+	}
+}
+
+func Test_selfLink_PublicURL(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://evil.example.com/function/orders?id=7", nil)
+	req.Header.Set("X-Forwarded-Host", "evil.example.com")
+
+	publicURL, _ := url.Parse("https://api.example.com/")
+	if got := selfLink(req, PublicURL{URL: publicURL, TrustedProxies: 1}); got != "https://api.example.com/function/orders?id=7" {
+		t.Errorf("want the public URL, got: %s", got)
+	}
+}
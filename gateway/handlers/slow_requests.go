@@ -0,0 +1,75 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// MakeSlowRequestLogHandler logs the detail of requests to functions which
+// take longer than threshold in total: the function, the time spent scaling
+// it and forwarding to it, the status and the bytes of the response. Faster
+// requests are not logged, and only pay for a counting ResponseWriter. It
+// collects RequestTimings unless an outer middleware already does, so it
+// must wrap the function middleware whose time is to be included.
+func MakeSlowRequestLogHandler(next http.HandlerFunc, threshold time.Duration, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if middleware.GetRequestTimings(r.Context()) == nil {
+			r = middleware.WithRequestTimings(r)
+		}
+		timings := middleware.GetRequestTimings(r.Context())
+
+		writer := &slowRequestResponseWriter{ResponseWriter: w}
+		next(writer, r)
+
+		total := time.Since(timings.Start)
+		if total <= threshold {
+			return
+		}
+
+		status := writer.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+		log.Printf("Slow request: function=%s namespace=%s method=%s status=%d bytes=%d total=%.4fs scale=%.4fs upstream=%.4fs\n",
+			functionName, namespace, r.Method, status, writer.bytes,
+			total.Seconds(), timings.Scale.Seconds(), timings.Upstream.Seconds())
+	}
+}
+
+// slowRequestResponseWriter records the status and size of a response
+type slowRequestResponseWriter struct {
+	http.ResponseWriter
+
+	status int
+	bytes  int64
+}
+
+func (s *slowRequestResponseWriter) WriteHeader(code int) {
+	if s.status == 0 && code >= http.StatusOK {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *slowRequestResponseWriter) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(data)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *slowRequestResponseWriter) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
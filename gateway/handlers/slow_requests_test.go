@@ -0,0 +1,93 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+func captureLog(t *testing.T) *bytes.Buffer {
+	var b bytes.Buffer
+	log.SetOutput(&b)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+	})
+	return &b
+}
+
+func Test_MakeSlowRequestLogHandler_LogsSlowRequests(t *testing.T) {
+	logs := captureLog(t)
+
+	handler := MakeSlowRequestLogHandler(func(w http.ResponseWriter, r *http.Request) {
+		timings := middleware.GetRequestTimings(r.Context())
+		timings.Scale = time.Millisecond * 1500
+		timings.Upstream = time.Millisecond * 250
+		time.Sleep(time.Millisecond * 20)
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+		w.Write([]byte(" world"))
+	}, time.Millisecond*10, "openfaas-fn")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/function/figlet.team-a/path", nil))
+
+	if rr.Code != http.StatusCreated || rr.Body.String() != "hello world" {
+		t.Errorf("want the response passed on, got: %d %q", rr.Code, rr.Body.String())
+	}
+
+	got := logs.String()
+	for _, want := range []string{
+		"Slow request: function=figlet namespace=team-a method=POST status=201 bytes=11 ",
+		"scale=1.5000s upstream=0.2500s",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want log to contain %q, got: %q", want, got)
+		}
+	}
+}
+
+func Test_MakeSlowRequestLogHandler_FastRequestsNotLogged(t *testing.T) {
+	logs := captureLog(t)
+
+	handler := MakeSlowRequestLogHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}, time.Second, "openfaas-fn")
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if logs.Len() > 0 {
+		t.Errorf("want no log for a fast request, got: %q", logs.String())
+	}
+}
+
+func Test_MakeSlowRequestLogHandler_SharesRequestTimings(t *testing.T) {
+	captureLog(t)
+
+	slow := MakeSlowRequestLogHandler(func(w http.ResponseWriter, r *http.Request) {
+		middleware.GetRequestTimings(r.Context()).Scale = time.Second
+	}, 0, "openfaas-fn")
+
+	// An outer MakeRequestTimingsHandler's timings are used, not replaced
+	var outer *middleware.RequestTimings
+	handler := MakeRequestTimingsHandler(func(w http.ResponseWriter, r *http.Request) {
+		outer = middleware.GetRequestTimings(r.Context())
+		slow(w, r)
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if outer == nil || outer.Scale != time.Second {
+		t.Errorf("want the outer timings to be shared, got: %+v", outer)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas/gateway/metrics"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// SlowStartWindowAnnotation is the duration over which a function's
+	// concurrency is ramped up to com.openfaas.concurrency.max after it is
+	// scaled from zero, i.e. "30s"
+	SlowStartWindowAnnotation = "com.openfaas.slow-start.window"
+
+	// SlowStartInitialAnnotation is the concurrency allowed at the start of
+	// the ramp, default 1
+	SlowStartInitialAnnotation = "com.openfaas.slow-start.initial"
+)
+
+// SlowStart limits the concurrency of functions which have just been scaled
+// from zero, growing the limit linearly over the window from their
+// annotations. It receives the "scaling" event as an HTTPNotifier, the ramp
+// begins with the first request to reach the limiter afterwards, which is
+// once the scaling handler has found the function ready.
+type SlowStart struct {
+	inFlight *InFlightCounter
+
+	// ramps holds the start of each function's ramp, the zero time means a
+	// scale event was received and the ramp is yet to begin
+	ramps map[string]time.Time
+	lock  sync.Mutex
+}
+
+// NewSlowStart creates a SlowStart which limits the requests counted by
+// inFlight
+func NewSlowStart(inFlight *InFlightCounter) *SlowStart {
+	return &SlowStart{
+		inFlight: inFlight,
+		ramps:    make(map[string]time.Time),
+	}
+}
+
+// Notify marks a function for slow-start when it is scaled from zero
+func (s *SlowStart) Notify(method string, URL string, originalURL string, statusCode int, event string, duration time.Duration) {
+	if event != "scaling" {
+		return
+	}
+
+	key := strings.TrimPrefix(URL, "/function/")
+
+	s.lock.Lock()
+	s.ramps[key] = time.Time{}
+	s.lock.Unlock()
+}
+
+// limit returns the concurrency limit for a function and whether it is
+// ramping, the ramp is ended once the window has elapsed
+func (s *SlowStart) limit(key string, window time.Duration, initial, max int64, now time.Time) (int64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	started, ok := s.ramps[key]
+	if !ok {
+		return 0, false
+	}
+	if started.IsZero() {
+		started = now
+		s.ramps[key] = started
+	}
+
+	elapsed := now.Sub(started)
+	if elapsed >= window {
+		delete(s.ramps, key)
+		return 0, false
+	}
+
+	limit := initial + int64(float64(max-initial)*float64(elapsed)/float64(window))
+	if limit < 1 {
+		limit = 1
+	}
+	return limit, true
+}
+
+// MakeSlowStartHandler limits the concurrency of functions with the
+// com.openfaas.slow-start.window and com.openfaas.concurrency.max annotations
+// whilst they ramp up after a scale from zero. Requests over the limit are
+// rejected with a 503 and a Retry-After header. The current limit is
+// reported by the gateway_function_slow_start_limit gauge until the ramp ends.
+func MakeSlowStartHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, slowStart *SlowStart, metricsOptions metrics.MetricOptions, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+		key := functionName + "." + namespace
+
+		slowStart.lock.Lock()
+		_, pending := slowStart.ramps[key]
+		slowStart.lock.Unlock()
+		if !pending {
+			next(w, r)
+			return
+		}
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		window, initial, max := readSlowStart(annotations)
+		if window <= 0 || max <= 0 {
+			slowStart.lock.Lock()
+			delete(slowStart.ramps, key)
+			slowStart.lock.Unlock()
+
+			next(w, r)
+			return
+		}
+
+		limit, ramping := slowStart.limit(key, window, initial, max, time.Now())
+		if !ramping {
+			metricsOptions.GatewayFunctionSlowStartLimit.DeleteLabelValues(key)
+
+			next(w, r)
+			return
+		}
+		metricsOptions.GatewayFunctionSlowStartLimit.WithLabelValues(key).Set(float64(limit))
+
+		release, ok := slowStart.inFlight.admit(r, key, 1, limit)
+		if !ok {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, http.StatusServiceUnavailable, key,
+				fmt.Sprintf("function %s is starting, concurrency limited to %d", key, limit))
+			return
+		}
+		defer release()
+
+		next(w, r)
+	}
+}
+
+// readSlowStart returns the ramp window, initial concurrency and maximum
+// concurrency from a function's annotations, the window is 0 when not set
+func readSlowStart(annotations map[string]string) (time.Duration, int64, int64) {
+	window, err := time.ParseDuration(strings.TrimSpace(annotations[SlowStartWindowAnnotation]))
+	if err != nil || window <= 0 {
+		return 0, 0, 0
+	}
+
+	max, _ := readConcurrencyLimits(annotations)
+
+	initial := int64(1)
+	if value, ok := annotations[SlowStartInitialAnnotation]; ok {
+		if parsed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil && parsed > 0 {
+			initial = parsed
+		}
+	}
+	if initial > max {
+		initial = max
+	}
+
+	return window, initial, max
+}
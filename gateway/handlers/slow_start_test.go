@@ -0,0 +1,154 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/metrics"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func Test_MakeSlowStartHandler_LimitsAfterScaleEvent(t *testing.T) {
+	query := fakeFunctionQuery{annotations: map[string]string{
+		MaxConcurrencyAnnotation:  "10",
+		SlowStartWindowAnnotation: "1m",
+	}}
+	slowStart := NewSlowStart(NewInFlightCounter())
+	metricsOptions := metrics.BuildMetricsOptions()
+
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	handler := MakeSlowStartHandler(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}, query, slowStart, metricsOptions, "openfaas-fn")
+
+	// Without a scale event requests are not limited
+	go handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	<-entered
+
+	rec := httptest.NewRecorder()
+	go handler(rec, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	<-entered
+	release <- struct{}{}
+	release <- struct{}{}
+
+	slowStart.Notify("", "/function/figlet.openfaas-fn", "/function/figlet.openfaas-fn", http.StatusProcessing, "scaling", 0)
+
+	done := make(chan struct{})
+	go func() {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+		close(done)
+	}()
+	<-entered
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("want the second request to be limited with: %d, got: %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("want Retry-After: 1, got: %q", got)
+	}
+
+	release <- struct{}{}
+	<-done
+
+	metric := &dto.Metric{}
+	metricsOptions.GatewayFunctionSlowStartLimit.WithLabelValues("figlet.openfaas-fn").Write(metric)
+	if got := metric.GetGauge().GetValue(); got != 1 {
+		t.Errorf("want the slow start limit gauge to be 1, got: %f", got)
+	}
+}
+
+func Test_MakeSlowStartHandler_NoRampWithoutAnnotations(t *testing.T) {
+	query := fakeFunctionQuery{annotations: map[string]string{
+		MaxConcurrencyAnnotation: "10",
+	}}
+	slowStart := NewSlowStart(NewInFlightCounter())
+
+	handler := MakeSlowStartHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, query, slowStart, metrics.BuildMetricsOptions(), "openfaas-fn")
+
+	slowStart.Notify("", "/function/figlet.openfaas-fn", "/function/figlet.openfaas-fn", http.StatusProcessing, "scaling", 0)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("want: %d, got: %d", http.StatusOK, rec.Code)
+	}
+
+	slowStart.lock.Lock()
+	defer slowStart.lock.Unlock()
+	if len(slowStart.ramps) != 0 {
+		t.Errorf("want the pending ramp to be dropped, got: %v", slowStart.ramps)
+	}
+}
+
+func Test_SlowStart_limitGrowsOverWindow(t *testing.T) {
+	slowStart := NewSlowStart(NewInFlightCounter())
+	slowStart.Notify("", "/function/figlet.openfaas-fn", "", http.StatusProcessing, "scaling", 0)
+
+	start := time.Now()
+	cases := []struct {
+		elapsed     time.Duration
+		wantLimit   int64
+		wantRamping bool
+	}{
+		{elapsed: 0, wantLimit: 2, wantRamping: true},
+		{elapsed: time.Second * 5, wantLimit: 6, wantRamping: true},
+		{elapsed: time.Second * 9, wantLimit: 9, wantRamping: true},
+		{elapsed: time.Second * 10, wantLimit: 0, wantRamping: false},
+		{elapsed: time.Second * 11, wantLimit: 0, wantRamping: false},
+	}
+
+	for _, c := range cases {
+		limit, ramping := slowStart.limit("figlet.openfaas-fn", time.Second*10, 2, 10, start.Add(c.elapsed))
+		if limit != c.wantLimit || ramping != c.wantRamping {
+			t.Errorf("after %s want: %d %v, got: %d %v", c.elapsed, c.wantLimit, c.wantRamping, limit, ramping)
+		}
+	}
+}
+
+func Test_SlowStart_IgnoresOtherEvents(t *testing.T) {
+	slowStart := NewSlowStart(NewInFlightCounter())
+	slowStart.Notify("GET", "/function/figlet.openfaas-fn", "", http.StatusOK, "completed", time.Second)
+
+	if _, ramping := slowStart.limit("figlet.openfaas-fn", time.Second, 1, 10, time.Now()); ramping {
+		t.Errorf("want no ramp without a scaling event")
+	}
+}
+
+func Test_readSlowStart(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		window      time.Duration
+		initial     int64
+		max         int64
+	}{
+		{name: "not set", annotations: map[string]string{}},
+		{name: "invalid window", annotations: map[string]string{SlowStartWindowAnnotation: "soon"}},
+		{name: "defaults initial to 1", annotations: map[string]string{
+			SlowStartWindowAnnotation: "30s", MaxConcurrencyAnnotation: "20"},
+			window: time.Second * 30, initial: 1, max: 20},
+		{name: "initial", annotations: map[string]string{
+			SlowStartWindowAnnotation: "30s", SlowStartInitialAnnotation: "5", MaxConcurrencyAnnotation: "20"},
+			window: time.Second * 30, initial: 5, max: 20},
+		{name: "initial above max", annotations: map[string]string{
+			SlowStartWindowAnnotation: "30s", SlowStartInitialAnnotation: "50", MaxConcurrencyAnnotation: "20"},
+			window: time.Second * 30, initial: 20, max: 20},
+	}
+
+	for _, c := range cases {
+		window, initial, max := readSlowStart(c.annotations)
+		if window != c.window || initial != c.initial || max != c.max {
+			t.Errorf("%s want: %s %d %d, got: %s %d %d", c.name, c.window, c.initial, c.max, window, initial, max)
+		}
+	}
+}
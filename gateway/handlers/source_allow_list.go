@@ -0,0 +1,146 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// AllowedSourcesAnnotation is a comma-separated list of CIDRs or addresses
+// which may invoke a function, i.e. "10.0.0.0/8,fd00::/8,192.168.1.20"
+const AllowedSourcesAnnotation = "com.openfaas.allowed-sources"
+
+// MakeSourceAllowListHandler rejects requests with a 403 for functions with
+// the com.openfaas.allowed-sources annotation when the client's address is
+// not within one of the listed networks. The client's address is found with
+// trustedProxies, see sourceIP. Invalid entries in the annotation are
+// skipped, so an annotation without any valid entries denies all requests.
+// Requests are rejected with a 503 when the function's annotations cannot be
+// read, rather than being let through to a function which may restrict them.
+// A function which does not exist has nothing to restrict, so its requests
+// are passed on to be answered as not found.
+func MakeSourceAllowListHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, trustedProxies int, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, invokedFunction(r))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if errors.Is(err, scaling.ErrFunctionNotFound) {
+			next(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("Source allow-list: unable to read annotations for %s.%s: %s", functionName, namespace, err)
+
+			writeError(w, r, http.StatusServiceUnavailable, functionName+"."+namespace,
+				fmt.Sprintf("unable to check the allowed sources of function %s.%s", functionName, namespace))
+			return
+		}
+
+		value, ok := annotations[AllowedSourcesAnnotation]
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		source := sourceIP(r, trustedProxies)
+		if source == nil || !containsIP(parseAllowedSources(value), source) {
+			log.Printf("Source allow-list: denied %s for %s.%s", r.RemoteAddr, functionName, namespace)
+
+			writeError(w, r, http.StatusForbidden, functionName+"."+namespace,
+				fmt.Sprintf("requests to function %s.%s are not allowed from this address", functionName, namespace))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// invokedFunction returns the name of the function in a /function/ path, or
+// from the route's name variable, as for /async-function/
+func invokedFunction(r *http.Request) string {
+	if name := middleware.GetServiceName(r.URL.String()); len(name) > 0 {
+		return name
+	}
+	return mux.Vars(r)["name"]
+}
+
+// sourceIP returns the client's address, which is trustedProxies hops back
+// from the gateway in the chain of X-Forwarded-For addresses followed by the
+// RemoteAddr. With no trusted proxies X-Forwarded-For is ignored, since a
+// client can set it to anything. nil is returned for a malformed address.
+func sourceIP(r *http.Request, trustedProxies int) net.IP {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+
+	var chain []string
+	if trustedProxies > 0 {
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(value, ",") {
+				chain = append(chain, strings.TrimSpace(hop))
+			}
+		}
+	}
+	chain = append(chain, remote)
+
+	i := len(chain) - 1 - trustedProxies
+	if i < 0 {
+		i = 0
+	}
+
+	return net.ParseIP(strings.Trim(chain[i], "[]"))
+}
+
+// parseAllowedSources parses the networks of a com.openfaas.allowed-sources
+// annotation, a bare address is treated as a network of one address
+func parseAllowedSources(value string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				log.Printf("Source allow-list: ignoring invalid entry %q in %s\n", entry, AllowedSourcesAnnotation)
+				continue
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Source allow-list: ignoring invalid entry %q in %s\n", entry, AllowedSourcesAnnotation)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+func Test_MakeSourceAllowListHandler(t *testing.T) {
+	query := fakeFunctionQuery{annotations: map[string]string{
+		AllowedSourcesAnnotation: "10.0.0.0/8, fd00::/8, 192.168.1.20",
+	}}
+
+	cases := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   string
+		trustedProxies int
+		wantStatus     int
+	}{
+		{name: "IPv4 in network", remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusOK},
+		{name: "IPv4 address", remoteAddr: "192.168.1.20:1234", wantStatus: http.StatusOK},
+		{name: "IPv6 in network", remoteAddr: "[fd00::1]:1234", wantStatus: http.StatusOK},
+		{name: "IPv4 denied", remoteAddr: "192.168.1.21:1234", wantStatus: http.StatusForbidden},
+		{name: "IPv6 denied", remoteAddr: "[2001:db8::1]:1234", wantStatus: http.StatusForbidden},
+		{name: "X-Forwarded-For ignored without trusted proxies", remoteAddr: "172.16.0.1:1234", forwardedFor: "10.1.2.3", wantStatus: http.StatusForbidden},
+		{name: "X-Forwarded-For from a trusted proxy", remoteAddr: "172.16.0.1:1234", forwardedFor: "10.1.2.3", trustedProxies: 1, wantStatus: http.StatusOK},
+		{name: "spoofed X-Forwarded-For before the trusted proxy", remoteAddr: "172.16.0.1:1234", forwardedFor: "10.1.2.3, 8.8.8.8", trustedProxies: 1, wantStatus: http.StatusForbidden},
+		{name: "two trusted proxies", remoteAddr: "172.16.0.1:1234", forwardedFor: "10.1.2.3, 172.16.0.2", trustedProxies: 2, wantStatus: http.StatusOK},
+		{name: "more trusted proxies than hops", remoteAddr: "172.16.0.1:1234", forwardedFor: "10.1.2.3", trustedProxies: 5, wantStatus: http.StatusOK},
+		{name: "malformed remote address", remoteAddr: "not-an-ip", wantStatus: http.StatusForbidden},
+		{name: "malformed X-Forwarded-For", remoteAddr: "10.1.2.3:1234", forwardedFor: "unknown", trustedProxies: 1, wantStatus: http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler := MakeSourceAllowListHandler(func(w http.ResponseWriter, r *http.Request) {
+			}, query, c.trustedProxies, "openfaas-fn")
+
+			req := httptest.NewRequest(http.MethodGet, "/function/internal", nil)
+			req.RemoteAddr = c.remoteAddr
+			if len(c.forwardedFor) > 0 {
+				req.Header.Set("X-Forwarded-For", c.forwardedFor)
+			}
+
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != c.wantStatus {
+				t.Errorf("want: %d, got: %d", c.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func Test_MakeSourceAllowListHandler_UnrestrictedWithoutAnnotation(t *testing.T) {
+	handler := MakeSourceAllowListHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, fakeFunctionQuery{annotations: map[string]string{}}, 0, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.RemoteAddr = "8.8.8.8:1234"
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("want: %d, got: %d", http.StatusOK, rec.Code)
+	}
+}
+
+func Test_MakeSourceAllowListHandler_MalformedAnnotationDeniesAll(t *testing.T) {
+	handler := MakeSourceAllowListHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, fakeFunctionQuery{annotations: map[string]string{AllowedSourcesAnnotation: "10.0.0.0/33, nowhere"}}, 0, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("want: %d, got: %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func Test_MakeSourceAllowListHandler_AsyncFunction(t *testing.T) {
+	functionQuery := &namespacedFunctionQuery{}
+	handler := MakeSourceAllowListHandler(func(w http.ResponseWriter, r *http.Request) {
+	}, functionQuery, 0, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodPost, "/async-function/figlet", nil)
+	req = mux.SetURLVars(req, map[string]string{"name": "figlet"})
+	handler(httptest.NewRecorder(), req)
+
+	if functionQuery.queried != "figlet.openfaas-fn" {
+		t.Errorf("queried want: figlet.openfaas-fn, got: %s", functionQuery.queried)
+	}
+}
+
+func Test_MakeSourceAllowListHandler_FailsClosedWithoutAnnotations(t *testing.T) {
+	called := false
+	handler := MakeSourceAllowListHandler(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}, &namespacedFunctionQuery{err: errors.New("provider unavailable")}, 0, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("want: %d, got: %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if called {
+		t.Errorf("want the request to be rejected")
+	}
+}
+
+func Test_MakeSourceAllowListHandler_UnknownFunctionNotFound(t *testing.T) {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         5,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Second,
+		ServiceQuery:         &knownServiceQuery{functions: map[string]bool{"not-found.openfaas-fn": true}},
+		NotFoundStatus:       http.StatusGone,
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+	functionQuery := scaling.NewCachedFunctionQuery(scaling.NewFunctionCache(config.CacheExpiry), config.ServiceQuery)
+
+	var forwarded *http.Request
+	next := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r
+	}, scaler, config, "openfaas-fn", nil)
+	handler := MakeSourceAllowListHandler(next, functionQuery, 0, "openfaas-fn")
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/function/missing", nil))
+	if rec.Code != http.StatusGone {
+		t.Errorf("want the configured not found status: %d, got: %d", http.StatusGone, rec.Code)
+	}
+
+	// The catch-all function is reached through the allow-list
+	config.CatchAllFunctions = map[string]string{"openfaas-fn": "not-found"}
+	next = MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r
+	}, scaler, config, "openfaas-fn", nil)
+	handler = MakeSourceAllowListHandler(next, functionQuery, 0, "openfaas-fn")
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/function/missing", nil))
+	if rec.Code != http.StatusOK || forwarded == nil {
+		t.Fatalf("want the catch-all function to be forwarded to, status: %d", rec.Code)
+	}
+	if got := forwarded.Header.Get("X-Original-Function"); got != "missing.openfaas-fn" {
+		t.Errorf("X-Original-Function want: missing.openfaas-fn, got: %s", got)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// SSECompressionAnnotation set to "true" compresses the event streams of a
+// function with gzip for clients which accept it
+const SSECompressionAnnotation = "com.openfaas.sse.gzip"
+
+// sseEventBoundaries end an event, as a blank line after its fields
+var sseEventBoundaries = [][]byte{[]byte("\n\n"), []byte("\r\r"), []byte("\r\n\r\n")}
+
+// MakeSSECompressionHandler compresses the text/event-stream responses of
+// functions with the com.openfaas.sse.gzip annotation when the client sends
+// Accept-Encoding: gzip. The gzip stream is flushed to the client at the end
+// of each event, so that events arrive as they are sent rather than once the
+// compressor's buffer fills. Responses which are not event streams, or which
+// the function has encoded itself, are passed on as they are. When the
+// client's connection cannot be flushed, events are streamed uncompressed.
+func MakeSSECompressionHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next(w, r)
+			return
+		}
+
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil || !sseCompressionEnabled(annotations) {
+			next(w, r)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			log.Printf("SSE compression: response for %s.%s cannot be flushed, streaming uncompressed\n", functionName, namespace)
+			next(w, r)
+			return
+		}
+
+		writer := &sseGzipWriter{ResponseWriter: w, flusher: flusher}
+		next(writer, r)
+		writer.Close()
+	}
+}
+
+func sseCompressionEnabled(annotations map[string]string) bool {
+	enabled, _ := strconv.ParseBool(strings.TrimSpace(annotations[SSECompressionAnnotation]))
+	return enabled
+}
+
+// acceptsGzip returns true when an Accept-Encoding header accepts gzip,
+// either by name or with *, with a quality above 0
+func acceptsGzip(acceptEncoding string) bool {
+	accepted := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(strings.TrimSpace(name)) != "q" {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+
+		// gzip by name takes precedence over *
+		if coding == "gzip" {
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
+
+// sseGzipWriter compresses an event stream and flushes it at the end of
+// each event, other responses are written as they are
+type sseGzipWriter struct {
+	http.ResponseWriter
+	flusher     http.Flusher
+	gz          *gzip.Writer
+	wroteHeader bool
+
+	// tail is the end of the last write, so that a boundary split over
+	// two writes is found
+	tail []byte
+}
+
+func (s *sseGzipWriter) WriteHeader(status int) {
+	// Informational responses such as 103 Early Hints are followed by the
+	// final status
+	if !s.wroteHeader && status >= http.StatusOK {
+		s.wroteHeader = true
+		if s.compress(status) {
+			header := s.Header()
+			header.Set("Content-Encoding", "gzip")
+			header.Add("Vary", "Accept-Encoding")
+			header.Del("Content-Length")
+			s.gz = gzip.NewWriter(s.ResponseWriter)
+		}
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// compress returns true for an event stream the function has not encoded
+func (s *sseGzipWriter) compress(status int) bool {
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	header := s.Header()
+	if len(header.Get("Content-Encoding")) > 0 {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+func (s *sseGzipWriter) Write(data []byte) (int, error) {
+	if !s.wroteHeader {
+		s.WriteHeader(http.StatusOK)
+	}
+	if s.gz == nil {
+		return s.ResponseWriter.Write(data)
+	}
+
+	if _, err := s.gz.Write(data); err != nil {
+		return 0, err
+	}
+
+	if s.endsEvent(data) {
+		if err := s.gz.Flush(); err != nil {
+			return 0, err
+		}
+		s.flusher.Flush()
+	}
+	return len(data), nil
+}
+
+// endsEvent returns true when data, following the tail of the last write,
+// contains the end of an event
+func (s *sseGzipWriter) endsEvent(data []byte) bool {
+	window := append(s.tail, data...)
+
+	found := false
+	for _, boundary := range sseEventBoundaries {
+		if bytes.Contains(window, boundary) {
+			found = true
+			break
+		}
+	}
+
+	if len(window) > 3 {
+		window = window[len(window)-3:]
+	}
+	s.tail = append(s.tail[:0], window...)
+	return found
+}
+
+// Flush sends what has been compressed so far to the client
+func (s *sseGzipWriter) Flush() {
+	if s.gz != nil {
+		s.gz.Flush()
+	}
+	s.flusher.Flush()
+}
+
+// Close ends the gzip stream once the function has responded
+func (s *sseGzipWriter) Close() error {
+	if s.gz == nil {
+		return nil
+	}
+	return s.gz.Close()
+}
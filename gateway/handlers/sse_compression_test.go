@@ -0,0 +1,210 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_SSECompression_StreamsEventsIncrementally(t *testing.T) {
+	received := make(chan struct{})
+	done := make(chan struct{})
+
+	handler := MakeSSECompressionHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		// Each event is written in two parts, as a function might
+		w.Write([]byte("data: one\n"))
+		w.Write([]byte("\n"))
+
+		// The second event is only sent once the client has read the first
+		select {
+		case <-received:
+		case <-done:
+			return
+		}
+		w.Write([]byte("data: two\n\n"))
+	}, fakeFunctionQuery{annotations: map[string]string{SSECompressionAnnotation: "true"}}, "openfaas-fn")
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	// The handler is released before the server waits for it to return
+	defer close(done)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/function/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	client := &http.Client{Timeout: 5 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+	defer res.Body.Close()
+
+	if got := res.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding want: gzip, got: %q", got)
+	}
+
+	events := make(chan string)
+	errs := make(chan error, 1)
+	go func() {
+		gz, err := gzip.NewReader(res.Body)
+		if err != nil {
+			errs <- err
+			return
+		}
+		reader := bufio.NewReader(gz)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				errs <- err
+				return
+			}
+			if line = strings.TrimSpace(line); len(line) > 0 {
+				events <- line
+			}
+		}
+	}()
+
+	for i, want := range []string{"data: one", "data: two"} {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Errorf("event %d want: %q, got: %q", i, want, got)
+			}
+		case err := <-errs:
+			t.Fatalf("event %d want: %q, got error: %s", i, want, err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("event %d want: %q to arrive before the stream ends", i, want)
+		}
+
+		if i == 0 {
+			close(received)
+		}
+	}
+}
+
+func Test_SSECompression_PassesThrough(t *testing.T) {
+	enabled := map[string]string{SSECompressionAnnotation: "true"}
+
+	cases := []struct {
+		name            string
+		annotations     map[string]string
+		acceptEncoding  string
+		contentType     string
+		contentEncoding string
+		wantGzip        bool
+	}{
+		{name: "event stream", annotations: enabled, acceptEncoding: "gzip, deflate", contentType: "text/event-stream; charset=utf-8", wantGzip: true},
+		{name: "without annotation", annotations: map[string]string{}, acceptEncoding: "gzip", contentType: "text/event-stream"},
+		{name: "gzip not accepted", annotations: enabled, acceptEncoding: "gzip;q=0, br", contentType: "text/event-stream"},
+		{name: "not an event stream", annotations: enabled, acceptEncoding: "gzip", contentType: "application/json"},
+		{name: "encoded by the function", annotations: enabled, acceptEncoding: "gzip", contentType: "text/event-stream", contentEncoding: "br"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler := MakeSSECompressionHandler(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", c.contentType)
+				if len(c.contentEncoding) > 0 {
+					w.Header().Set("Content-Encoding", c.contentEncoding)
+				}
+				w.Write([]byte("data: one\n\n"))
+			}, fakeFunctionQuery{annotations: c.annotations}, "openfaas-fn")
+
+			req := httptest.NewRequest(http.MethodGet, "/function/events", nil)
+			req.Header.Set("Accept-Encoding", c.acceptEncoding)
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			body := rr.Body.String()
+			if c.wantGzip {
+				if rr.Header().Get("Content-Encoding") != "gzip" {
+					t.Fatalf("want Content-Encoding: gzip, got: %q", rr.Header().Get("Content-Encoding"))
+				}
+				gz, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatalf("want a gzip body, got: %s", err)
+				}
+				decoded, _ := ioutil.ReadAll(gz)
+				body = string(decoded)
+			} else if got := rr.Header().Get("Content-Encoding"); got != c.contentEncoding {
+				t.Errorf("Content-Encoding want: %q, got: %q", c.contentEncoding, got)
+			}
+
+			if body != "data: one\n\n" {
+				t.Errorf("body want: %q, got: %q", "data: one\n\n", body)
+			}
+		})
+	}
+}
+
+// unflushableWriter hides the Flusher of the ResponseWriter it wraps
+type unflushableWriter struct {
+	http.ResponseWriter
+}
+
+func Test_SSECompression_UncompressedWithoutFlusher(t *testing.T) {
+	handler := MakeSSECompressionHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: one\n\n"))
+	}, fakeFunctionQuery{annotations: map[string]string{SSECompressionAnnotation: "true"}}, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodGet, "/function/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler(unflushableWriter{rr}, req)
+
+	if got := rr.Header().Get("Content-Encoding"); len(got) > 0 {
+		t.Errorf("want no Content-Encoding, got: %q", got)
+	}
+	if got := rr.Body.String(); got != "data: one\n\n" {
+		t.Errorf("body want: %q, got: %q", "data: one\n\n", got)
+	}
+}
+
+func Test_acceptsGzip(t *testing.T) {
+	cases := map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"deflate, GZIP;q=0.5": true,
+		"gzip;q=0":            false,
+		"*":                   true,
+		"*;q=0":               false,
+		"gzip;q=0, *":         false,
+		"br, identity":        false,
+	}
+	for value, want := range cases {
+		if got := acceptsGzip(value); got != want {
+			t.Errorf("%q want: %v, got: %v", value, want, got)
+		}
+	}
+}
+
+func Test_sseGzipWriter_BoundarySplitAcrossWrites(t *testing.T) {
+	writer := &sseGzipWriter{}
+
+	for _, c := range []struct {
+		data string
+		want bool
+	}{
+		{"data: one\r\n", false},
+		{"\r", false},
+		{"\n", true},
+		{"data: two\n", false},
+		{"data: three", false},
+		{"\n\ndata: four", true},
+	} {
+		if got := writer.endsEvent([]byte(c.data)); got != c.want {
+			t.Errorf("%q want: %v, got: %v", c.data, c.want, got)
+		}
+	}
+}
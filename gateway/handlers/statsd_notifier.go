@@ -0,0 +1,150 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// statsdQueueSize is the most packets waiting to be sent, further packets
+// are dropped
+const statsdQueueSize = 1000
+
+// StatsDNotifier sends the metrics of function invocations to a StatsD
+// server over UDP, alongside those in Prometheus:
+//
+//	<prefix>.function.<name>.started, a counter for each request
+//	<prefix>.function.<name>.invocation.<code>, a counter for each response
+//	<prefix>.function.<name>.duration, the time taken in milliseconds
+//
+// The name is the function's name.namespace with dots as underscores. The
+// packets are sent from a single goroutine so that Notify never blocks, and
+// are dropped whilst its queue is full.
+type StatsDNotifier struct {
+	// Prefix is the first part of each metric's name, without a dot
+	Prefix string
+
+	// SampleRate is the fraction of requests sent, from 0 to 1
+	SampleRate float64
+
+	// FunctionNamespace is the namespace of functions without one
+	FunctionNamespace string
+
+	conn    net.Conn
+	packets chan string
+	dropped uint64
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewStatsDNotifier creates a StatsDNotifier which sends to address, a
+// host:port
+func NewStatsDNotifier(address, prefix string, sampleRate float64, functionNamespace string) (*StatsDNotifier, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach StatsD at %s: %s", address, err)
+	}
+
+	s := &StatsDNotifier{
+		Prefix:            strings.Trim(prefix, "."),
+		SampleRate:        sampleRate,
+		FunctionNamespace: functionNamespace,
+		conn:              conn,
+		packets:           make(chan string, statsdQueueSize),
+		done:              make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Notify queues the metrics for a started or completed request to a function
+func (s *StatsDNotifier) Notify(method string, URL string, originalURL string, statusCode int, event string, duration time.Duration) {
+	if event != "started" && event != "completed" {
+		return
+	}
+
+	serviceName := middleware.GetServiceName(originalURL)
+	if len(serviceName) == 0 {
+		return
+	}
+	if s.SampleRate < 1 && rand.Float64() >= s.SampleRate {
+		return
+	}
+
+	functionName, namespace := middleware.GetNamespace(s.FunctionNamespace, serviceName)
+	name := s.metricName(functionName + "_" + namespace)
+
+	var packet string
+	if event == "started" {
+		packet = s.metric(name+".started", "1", "c")
+	} else {
+		packet = s.metric(name+".invocation."+strconv.Itoa(statusCode), "1", "c") + "\n" +
+			s.metric(name+".duration", strconv.FormatFloat(float64(duration)/float64(time.Millisecond), 'f', 3, 64), "ms")
+	}
+
+	select {
+	case s.packets <- packet:
+	default:
+		if dropped := atomic.AddUint64(&s.dropped, 1); dropped == 1 || dropped%1000 == 0 {
+			log.Printf("StatsD: queue full, %d packets dropped\n", dropped)
+		}
+	}
+}
+
+// Dropped returns how many packets were dropped because the queue was full
+func (s *StatsDNotifier) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close sends the packets which are queued, then closes the connection.
+// Notify must not be called after Close.
+func (s *StatsDNotifier) Close() {
+	s.once.Do(func() {
+		close(s.packets)
+	})
+	<-s.done
+}
+
+func (s *StatsDNotifier) run() {
+	defer close(s.done)
+	defer s.conn.Close()
+
+	for packet := range s.packets {
+		// Errors are not reported, StatsD is best effort
+		s.conn.Write([]byte(packet))
+	}
+}
+
+func (s *StatsDNotifier) metricName(function string) string {
+	name := "function." + strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ':', '|', '@', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, function)
+
+	if len(s.Prefix) > 0 {
+		return s.Prefix + "." + name
+	}
+	return name
+}
+
+func (s *StatsDNotifier) metric(name, value, metricType string) string {
+	line := name + ":" + value + "|" + metricType
+	if s.SampleRate < 1 {
+		line += "|@" + strconv.FormatFloat(s.SampleRate, 'g', -1, 64)
+	}
+	return line
+}
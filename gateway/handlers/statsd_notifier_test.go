@@ -0,0 +1,132 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenStatsD captures the lines of the packets sent to a UDP listener
+func listenStatsD(t *testing.T) (*net.UDPConn, chan string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				close(lines)
+				return
+			}
+			for _, line := range strings.Split(string(buf[:n]), "\n") {
+				lines <- line
+			}
+		}
+	}()
+	return conn, lines
+}
+
+func readStatsD(t *testing.T, lines chan string, want int) []string {
+	got := []string{}
+	for len(got) < want {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-time.After(time.Second):
+			t.Fatalf("want %d lines, got: %v", want, got)
+		}
+	}
+	sort.Strings(got)
+	return got
+}
+
+func Test_StatsDNotifier_SendsMetrics(t *testing.T) {
+	listener, lines := listenStatsD(t)
+	defer listener.Close()
+
+	notifier, err := NewStatsDNotifier(listener.LocalAddr().String(), "openfaas.gateway.", 1, "openfaas-fn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notifier.Close()
+
+	notifier.Notify(http.MethodPost, "/function/figlet", "/function/figlet", http.StatusProcessing, "started", 0)
+	notifier.Notify(http.MethodPost, "/function/figlet", "/function/figlet.team-a", http.StatusOK, "completed", time.Millisecond*1500)
+
+	got := readStatsD(t, lines, 3)
+	want := []string{
+		"openfaas.gateway.function.figlet_openfaas-fn.started:1|c",
+		"openfaas.gateway.function.figlet_team-a.duration:1500.000|ms",
+		"openfaas.gateway.function.figlet_team-a.invocation.200:1|c",
+	}
+	sort.Strings(want)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d want: %q, got: %q", i, want[i], got[i])
+		}
+	}
+}
+
+func Test_StatsDNotifier_IgnoresOtherEvents(t *testing.T) {
+	listener, lines := listenStatsD(t)
+	defer listener.Close()
+
+	notifier, err := NewStatsDNotifier(listener.LocalAddr().String(), "gw", 1, "openfaas-fn")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier.Notify("", "/function/figlet", "/function/figlet", http.StatusProcessing, "scaling", 0)
+	notifier.Notify(http.MethodGet, "/system/functions", "/system/functions", http.StatusOK, "completed", time.Second)
+	notifier.Notify(http.MethodGet, "/function/env", "/function/env", http.StatusOK, "completed", time.Second)
+	notifier.Close()
+
+	got := readStatsD(t, lines, 2)
+	if got[0] != "gw.function.env_openfaas-fn.duration:1000.000|ms" || got[1] != "gw.function.env_openfaas-fn.invocation.200:1|c" {
+		t.Errorf("want only the metrics of the function request, got: %v", got)
+	}
+}
+
+func Test_StatsDNotifier_Sampling(t *testing.T) {
+	listener, lines := listenStatsD(t)
+	defer listener.Close()
+
+	notifier, err := NewStatsDNotifier(listener.LocalAddr().String(), "gw", 0.5, "openfaas-fn")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 400
+	for i := 0; i < requests; i++ {
+		notifier.Notify(http.MethodGet, "/function/env", "/function/env", http.StatusProcessing, "started", 0)
+	}
+	notifier.Close()
+
+	sent := 0
+	for {
+		select {
+		case line := <-lines:
+			if line != "gw.function.env_openfaas-fn.started:1|c|@0.5" {
+				t.Fatalf("want the sample rate in each line, got: %q", line)
+			}
+			sent++
+			continue
+		case <-time.After(time.Millisecond * 200):
+		}
+		break
+	}
+
+	if sent < requests/4 || sent > requests*3/4 {
+		t.Errorf("want about half of %d requests sent, got: %d", requests, sent)
+	}
+}
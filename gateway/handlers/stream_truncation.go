@@ -0,0 +1,79 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+const (
+	// TruncationAnnotation set to "true" marks a function's response as
+	// truncated when the upstream timeout or chunk timeout is reached
+	// mid-stream, instead of silently ending it
+	TruncationAnnotation = "com.openfaas.stream.truncation"
+
+	// TruncationMarkerAnnotation overrides the footer written after a truncated response
+	TruncationMarkerAnnotation = "com.openfaas.stream.truncation-marker"
+
+	// TruncatedTrailer is sent as an HTTP trailer when a response is truncated
+	TruncatedTrailer = "X-Stream-Truncated"
+
+	defaultTruncationMarker = "\n[response truncated]\n"
+)
+
+type truncationMarkerKey struct{}
+
+// withTruncationMarker returns a context which asks forwardRequest to write
+// marker when a response is truncated by a timeout
+func withTruncationMarker(ctx context.Context, marker string) context.Context {
+	return context.WithValue(ctx, truncationMarkerKey{}, marker)
+}
+
+// truncationMarker returns the marker for a request, false when truncation
+// has not been enabled for the function
+func truncationMarker(ctx context.Context) (string, bool) {
+	marker, ok := ctx.Value(truncationMarkerKey{}).(string)
+	return marker, ok
+}
+
+// MakeStreamTruncationHandler enables the truncation marker for functions
+// with the com.openfaas.stream.truncation annotation
+func MakeStreamTruncationHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil || strings.TrimSpace(annotations[TruncationAnnotation]) != "true" {
+			next(w, r)
+			return
+		}
+
+		marker := defaultTruncationMarker
+		if value, ok := annotations[TruncationMarkerAnnotation]; ok {
+			marker = value
+		}
+
+		next(w, r.WithContext(withTruncationMarker(r.Context(), marker)))
+	}
+}
+
+// writeTruncationMarker flushes the response with the marker and trailer
+// for functions which have enabled truncation markers
+func writeTruncationMarker(w http.ResponseWriter, r *http.Request) {
+	marker, ok := truncationMarker(r.Context())
+	if !ok {
+		return
+	}
+
+	w.Header().Set(http.TrailerPrefix+TruncatedTrailer, "true")
+	w.Write([]byte(marker))
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
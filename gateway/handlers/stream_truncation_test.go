@@ -0,0 +1,74 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func makeStalledStreamHandler(t *testing.T, annotations map[string]string, timeout, chunkTimeout time.Duration) (http.HandlerFunc, *testNotifier) {
+	release := make(chan struct{})
+	forwarding, proxy, notifier := makeFunctionProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("line 1\n"))
+		w.(http.Flusher).Flush()
+		<-release
+	}, timeout)
+	proxy.ChunkTimeout = chunkTimeout
+
+	// Cleanups run last first, so the upstream is released before it is closed
+	t.Cleanup(func() { close(release) })
+
+	return MakeStreamTruncationHandler(forwarding, fakeFunctionQuery{annotations: annotations}, "openfaas-fn"), notifier
+}
+
+func Test_StreamTruncation_MarksUpstreamTimeout(t *testing.T) {
+	handler, notifier := makeStalledStreamHandler(t, map[string]string{
+		TruncationAnnotation:       "true",
+		TruncationMarkerAnnotation: "--truncated--",
+	}, time.Millisecond*100, 0)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/logs", nil))
+
+	if want := "line 1\n--truncated--"; rr.Body.String() != want {
+		t.Errorf("body want: %q, got: %q", want, rr.Body.String())
+	}
+	if got := rr.Result().Trailer.Get(TruncatedTrailer); got != "true" {
+		t.Errorf("want %s trailer, got: %q", TruncatedTrailer, got)
+	}
+	if notifier.StatusReceived != http.StatusGatewayTimeout {
+		t.Errorf("notifier status want: %d, got: %d", http.StatusGatewayTimeout, notifier.StatusReceived)
+	}
+}
+
+func Test_StreamTruncation_MarksChunkTimeout(t *testing.T) {
+	handler, _ := makeStalledStreamHandler(t, map[string]string{
+		TruncationAnnotation: "true",
+	}, time.Second*5, time.Millisecond*50)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/logs", nil))
+
+	if want := "line 1\n" + defaultTruncationMarker; rr.Body.String() != want {
+		t.Errorf("body want: %q, got: %q", want, rr.Body.String())
+	}
+}
+
+func Test_StreamTruncation_DisabledByDefault(t *testing.T) {
+	handler, _ := makeStalledStreamHandler(t, map[string]string{}, time.Millisecond*100, 0)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/logs", nil))
+
+	if want := "line 1\n"; rr.Body.String() != want {
+		t.Errorf("body want: %q, got: %q", want, rr.Body.String())
+	}
+	if got := rr.Result().Trailer.Get(TruncatedTrailer); got != "" {
+		t.Errorf("want no trailer, got: %q", got)
+	}
+}
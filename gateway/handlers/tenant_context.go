@@ -0,0 +1,95 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// ClaimHeader maps a JWT claim to the header it is forwarded in
+type ClaimHeader struct {
+	Claim  string
+	Header string
+}
+
+// ParseClaimHeaders parses a comma-separated list of claim=Header pairs
+func ParseClaimHeaders(value string) ([]ClaimHeader, error) {
+	mappings := []ClaimHeader{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+
+		claim, header, ok := strings.Cut(pair, "=")
+		claim = strings.TrimSpace(claim)
+		header = strings.TrimSpace(header)
+		if !ok || len(claim) == 0 || len(header) == 0 {
+			return nil, fmt.Errorf("invalid claim mapping: %q, want claim=Header", pair)
+		}
+
+		mappings = append(mappings, ClaimHeader{Claim: claim, Header: http.CanonicalHeaderKey(header)})
+	}
+	return mappings, nil
+}
+
+// MakeTenantContextHandler validates the bearer token in the Authorization
+// header and forwards the mapped claims to the function as headers. Requests
+// without a valid token are rejected with http.StatusUnauthorized. Any value
+// sent by the client for a mapped header is removed so that functions can
+// trust the headers set by the gateway.
+func MakeTenantContextHandler(next http.HandlerFunc, validator *middleware.JWTValidator, mappings []ClaimHeader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, mapping := range mappings {
+			r.Header.Del(mapping.Header)
+		}
+
+		token := r.Header.Get("Authorization")
+		if !strings.HasPrefix(token, "Bearer ") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, r, http.StatusUnauthorized, "", "a bearer token is required")
+			return
+		}
+
+		claims, err := validator.Validate(strings.TrimPrefix(token, "Bearer "))
+		if err != nil {
+			log.Printf("Tenant context: rejected token for %s: %s\n", r.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, r, http.StatusUnauthorized, "", "invalid bearer token")
+			return
+		}
+
+		for _, mapping := range mappings {
+			if value, ok := claimValue(claims[mapping.Claim]); ok {
+				r.Header.Set(mapping.Header, value)
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// claimValue formats a claim as a header value, lists are comma-separated
+func claimValue(claim interface{}) (string, bool) {
+	switch v := claim.(type) {
+	case string:
+		return v, true
+	case float64, bool:
+		return fmt.Sprintf("%v", v), true
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			if value, ok := claimValue(item); ok {
+				values = append(values, value)
+			}
+		}
+		return strings.Join(values, ","), true
+	}
+	return "", false
+}
@@ -0,0 +1,59 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+func Test_MakeTenantContextHandler(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"tenant_id":"acme","roles":["admin","dev"]}`))
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(header + "." + payload))
+	token := header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	validator, _ := middleware.NewJWTValidator([]byte("secret"))
+	mappings, err := ParseClaimHeaders("tenant_id=X-Tenant-Id, roles=X-User-Roles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var upstreamHeader http.Header
+	handler := MakeTenantContextHandler(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeader = r.Header
+	}, validator, mappings)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.Header.Set("X-Tenant-Id", "spoofed")
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a token want: %d, got: %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.Header.Set("X-Tenant-Id", "spoofed")
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("with a token want: %d, got: %d", http.StatusOK, rec.Code)
+	}
+	if got := upstreamHeader.Get("X-Tenant-Id"); got != "acme" {
+		t.Errorf("X-Tenant-Id want: %s, got: %s", "acme", got)
+	}
+	if got := upstreamHeader.Get("X-User-Roles"); got != "admin,dev" {
+		t.Errorf("X-User-Roles want: %s, got: %s", "admin,dev", got)
+	}
+}
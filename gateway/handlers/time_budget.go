@@ -0,0 +1,126 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// TimeBudgetAnnotation is the total time a request to a function may take,
+// including scaling the function and streaming its response, i.e. "5s". It
+// replaces the gateway's default budget.
+const TimeBudgetAnnotation = "com.openfaas.time-budget"
+
+// TimeBudgetHeader tells the function how many milliseconds of its budget
+// remain when the request is forwarded
+const TimeBudgetHeader = "X-Budget-Remaining-Ms"
+
+type timeBudgetKey struct{}
+
+// MakeTimeBudgetHandler bounds requests to a function by the duration in its
+// com.openfaas.time-budget annotation, or defaultBudget when not set, with a
+// single deadline shared by all later middleware. A budget of 0 leaves the
+// request unbounded. When the budget runs out before a response was started
+// 504 Gateway Timeout is returned.
+func MakeTimeBudgetHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, defaultBudget time.Duration, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		budget := defaultBudget
+		if annotations, err := functionQuery.GetAnnotations(functionName, namespace); err == nil {
+			budget, _ = readTimeBudget(annotations, defaultBudget)
+		}
+
+		if budget <= 0 {
+			next(w, r)
+			return
+		}
+
+		deadline := time.Now().Add(budget)
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		ctx = context.WithValue(ctx, timeBudgetKey{}, deadline)
+
+		writer := &timeBudgetResponseWriter{ResponseWriter: w}
+		next(writer, r.WithContext(ctx))
+
+		if !writer.wroteHeader && timeBudgetExhausted(ctx) {
+			log.Printf("Time budget of %s exhausted for function %s.%s\n", budget, functionName, namespace)
+			writeError(w, r, http.StatusGatewayTimeout, functionName+"."+namespace,
+				fmt.Sprintf("time budget of %s exhausted for function %s.%s", budget, functionName, namespace))
+		}
+	}
+}
+
+// readTimeBudget returns the budget in a function's annotations, or
+// defaultBudget when it has no valid budget, and whether it was annotated
+func readTimeBudget(annotations map[string]string, defaultBudget time.Duration) (time.Duration, bool) {
+	if value, ok := annotations[TimeBudgetAnnotation]; ok {
+		if parsed, err := time.ParseDuration(strings.TrimSpace(value)); err == nil && parsed >= 0 {
+			return parsed, true
+		}
+	}
+	return defaultBudget, false
+}
+
+// timeBudgetExhausted returns true when the request's time budget ran out,
+// rather than the client going away
+func timeBudgetExhausted(ctx context.Context) bool {
+	_, ok := ctx.Value(timeBudgetKey{}).(time.Time)
+	return ok && errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// setTimeBudgetHeader sets the milliseconds remaining of the request's time
+// budget in header, and false when none remain. A value sent by the client
+// is always removed.
+func setTimeBudgetHeader(r *http.Request, header http.Header) bool {
+	header.Del(TimeBudgetHeader)
+
+	deadline, ok := r.Context().Value(timeBudgetKey{}).(time.Time)
+	if !ok {
+		return true
+	}
+
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining <= 0 {
+		return false
+	}
+	header.Set(TimeBudgetHeader, strconv.FormatInt(remaining, 10))
+	return true
+}
+
+// timeBudgetResponseWriter records whether a response was started
+type timeBudgetResponseWriter struct {
+	http.ResponseWriter
+
+	wroteHeader bool
+}
+
+func (t *timeBudgetResponseWriter) WriteHeader(code int) {
+	if code >= http.StatusOK {
+		t.wroteHeader = true
+	}
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *timeBudgetResponseWriter) Write(data []byte) (int, error) {
+	t.wroteHeader = true
+	return t.ResponseWriter.Write(data)
+}
+
+func (t *timeBudgetResponseWriter) Flush() {
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+func makeTimeBudgetProxy(t *testing.T, upstream http.HandlerFunc) http.HandlerFunc {
+	proxy, _, _ := makeFunctionProxy(t, upstream, time.Minute)
+	return proxy
+}
+
+func Test_MakeTimeBudgetHandler_SendsRemainingBudget(t *testing.T) {
+	proxy := makeTimeBudgetProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(TimeBudgetHeader)))
+	})
+
+	query := fakeFunctionQuery{annotations: map[string]string{TimeBudgetAnnotation: "5s"}}
+	handler := MakeTimeBudgetHandler(proxy, query, 0, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.Header.Set(TimeBudgetHeader, "999999")
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	remaining, err := strconv.Atoi(rr.Body.String())
+	if err != nil || remaining <= 0 || remaining > 5000 {
+		t.Errorf("want up to 5000ms remaining, got: %q", rr.Body.String())
+	}
+}
+
+func Test_MakeTimeBudgetHandler_NoBudgetRemovesHeader(t *testing.T) {
+	proxy := makeTimeBudgetProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(TimeBudgetHeader)))
+	})
+
+	handler := MakeTimeBudgetHandler(proxy, fakeFunctionQuery{annotations: map[string]string{}}, 0, "openfaas-fn")
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.Header.Set(TimeBudgetHeader, "999999")
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.Len() != 0 {
+		t.Errorf("want the client's %s removed, got: %d %q", TimeBudgetHeader, rr.Code, rr.Body.String())
+	}
+}
+
+func Test_MakeTimeBudgetHandler_ExhaustedWaitingForFunction(t *testing.T) {
+	proxy := makeTimeBudgetProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second * 5):
+		}
+	})
+
+	// The function's annotation replaces the default
+	query := fakeFunctionQuery{annotations: map[string]string{TimeBudgetAnnotation: "50ms"}}
+	handler := MakeTimeBudgetHandler(proxy, query, time.Minute, "openfaas-fn")
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("status want: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("want the request to end with its budget, took: %s", elapsed)
+	}
+}
+
+func Test_MakeTimeBudgetHandler_SharedWithScaling(t *testing.T) {
+	config := scaling.ScalingConfig{
+		MaxPollCount:         1000,
+		SetScaleRetries:      2,
+		FunctionPollInterval: time.Millisecond * 10,
+		CacheExpiry:          time.Second,
+		ServiceQuery:         &startingServiceQuery{},
+	}
+	scaler := scaling.NewFunctionScaler(config, scaling.NewFunctionCache(config.CacheExpiry))
+
+	called := false
+	scalingHandler := MakeScalingHandler(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}, scaler, config, "openfaas-fn", []HTTPNotifier{})
+
+	handler := MakeTimeBudgetHandler(scalingHandler, fakeFunctionQuery{annotations: map[string]string{}}, time.Millisecond*50, "openfaas-fn")
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("status want: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+	if called {
+		t.Errorf("want next not to be called once the budget is exhausted")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("want the scale wait to stop with the budget, took: %s", elapsed)
+	}
+}
+
+func Test_MakeTimeBudgetHandler_ExhaustedBeforeForwarding(t *testing.T) {
+	upstreamCalled := false
+	proxy := makeTimeBudgetProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+	})
+
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 20)
+		proxy(w, r)
+	}
+	handler := MakeTimeBudgetHandler(slow, fakeFunctionQuery{annotations: map[string]string{}}, time.Millisecond*10, "openfaas-fn")
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("status want: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+	if upstreamCalled {
+		t.Errorf("want the function not to be called without any budget left")
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// TimeoutErrorAnnotation set to "true" writes a body describing the timeout
+// when a function does not respond within the upstream timeout, including
+// its elapsed time and timeout, instead of the generic 504 error
+const TimeoutErrorAnnotation = "com.openfaas.timeout.error-body"
+
+type timeoutErrorKey struct{}
+
+// MakeTimeoutErrorHandler enables a descriptive 504 body for functions with
+// the com.openfaas.timeout.error-body annotation
+func MakeTimeoutErrorHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, defaultNamespace string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		if err != nil || strings.TrimSpace(annotations[TimeoutErrorAnnotation]) != "true" {
+			next(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), timeoutErrorKey{}, functionName+"."+namespace)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// writeTimeoutError writes the 504 status with writeError, the body
+// describes the function, its elapsed time and timeout for functions which
+// have opted-in
+func writeTimeoutError(w http.ResponseWriter, r *http.Request, elapsed, timeout time.Duration) {
+	function, ok := r.Context().Value(timeoutErrorKey{}).(string)
+	if !ok {
+		writeError(w, r, http.StatusGatewayTimeout, "", "function did not respond within the upstream timeout")
+		return
+	}
+
+	body := ErrorResponse{
+		Code:     http.StatusGatewayTimeout,
+		Function: function,
+		Elapsed:  elapsed.Round(time.Millisecond).String(),
+		Timeout:  timeout.String(),
+	}
+	body.Message = fmt.Sprintf("function %s did not respond within the upstream timeout, elapsed: %s, timeout: %s", function, body.Elapsed, body.Timeout)
+	writeErrorResponse(w, r, body)
+}
@@ -0,0 +1,90 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makeSlowFunctionHandler(t *testing.T, annotations map[string]string) (http.HandlerFunc, *testNotifier) {
+	release := make(chan struct{})
+	forwarding, _, notifier := makeFunctionProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}, time.Millisecond*50)
+
+	// Cleanups run last first, so the upstream is released before it is closed
+	t.Cleanup(func() { close(release) })
+
+	return MakeTimeoutErrorHandler(forwarding, fakeFunctionQuery{annotations: annotations}, "openfaas-fn"), notifier
+}
+
+func Test_TimeoutError_GenericBodyByDefault(t *testing.T) {
+	handler, notifier := makeSlowFunctionHandler(t, map[string]string{})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/slow", nil))
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("status want: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+	if notifier.StatusReceived != http.StatusGatewayTimeout {
+		t.Errorf("notifier status want: %d, got: %d", http.StatusGatewayTimeout, notifier.StatusReceived)
+	}
+	want := "function did not respond within the upstream timeout"
+	if rr.Body.String() != want {
+		t.Errorf("body want: %q, got: %q", want, rr.Body.String())
+	}
+}
+
+func Test_TimeoutError_JSONBody(t *testing.T) {
+	handler, _ := makeSlowFunctionHandler(t, map[string]string{TimeoutErrorAnnotation: "true"})
+
+	req := httptest.NewRequest(http.MethodGet, "/function/slow", nil)
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("status want: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type want: application/json, got: %q", got)
+	}
+
+	body := ErrorResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("want JSON body, got: %q", rr.Body.String())
+	}
+	if body.Function != "slow.openfaas-fn" {
+		t.Errorf("function want: slow.openfaas-fn, got: %q", body.Function)
+	}
+	if body.Timeout != "50ms" {
+		t.Errorf("timeout want: 50ms, got: %q", body.Timeout)
+	}
+	if len(body.Elapsed) == 0 {
+		t.Errorf("want elapsed time in body")
+	}
+}
+
+func Test_TimeoutError_PlainTextBody(t *testing.T) {
+	handler, _ := makeSlowFunctionHandler(t, map[string]string{TimeoutErrorAnnotation: "true"})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/function/slow", nil))
+
+	if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("Content-Type want: text/plain, got: %q", got)
+	}
+	if !strings.Contains(rr.Body.String(), "slow.openfaas-fn") {
+		t.Errorf("want function name in body, got: %q", rr.Body.String())
+	}
+}
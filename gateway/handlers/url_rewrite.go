@@ -0,0 +1,115 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+	"github.com/openfaas/faas/gateway/scaling"
+)
+
+// RewriteURLsAnnotation is a comma-separated list of internal URL prefixes
+// which are rewritten in a function's responses. A prefix on its own is
+// rewritten to the function's URL on the gateway, a mapping of
+// "prefix=replacement" rewrites to the replacement, i.e.
+// "http://figlet.openfaas-fn:8080,http://minio:9000=https://files.example.com"
+const RewriteURLsAnnotation = "com.openfaas.rewrite-urls"
+
+// MakeURLRewriteHandler rewrites internal URL prefixes from a function's
+// com.openfaas.rewrite-urls annotation in its text/html and JSON responses
+// and in the Location header. Other content types, encoded bodies and
+// responses larger than maxBodyBytes are passed on unchanged. The function's
+// URL on the gateway is found with publicURL.
+func MakeURLRewriteHandler(next http.HandlerFunc, functionQuery scaling.FunctionQuery, publicURL PublicURL, defaultNamespace string, maxBodyBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functionName, namespace := middleware.GetNamespace(defaultNamespace, middleware.GetServiceName(r.URL.String()))
+
+		annotations, err := functionQuery.GetAnnotations(functionName, namespace)
+		value := strings.TrimSpace(annotations[RewriteURLsAnnotation])
+		if err != nil || len(value) == 0 {
+			next(w, r)
+			return
+		}
+
+		replacer := newURLReplacer(value, functionURL(r, publicURL))
+
+		writer := &bufferedResponseWriter{
+			ResponseWriter:      w,
+			maxBodyBytes:        maxBodyBytes,
+			passThroughOverflow: true,
+		}
+		writer.passThrough = func(header http.Header) bool {
+			if location := header.Get("Location"); len(location) > 0 {
+				header.Set("Location", replacer.Replace(location))
+			}
+			return len(header.Get("Content-Encoding")) > 0 || !isRewritableContentType(header.Get("Content-Type"))
+		}
+		next(writer, r)
+
+		if writer.passingThrough {
+			return
+		}
+
+		body := []byte(replacer.Replace(writer.body.String()))
+		if len(w.Header().Get("Content-Length")) > 0 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+
+		w.WriteHeader(writer.Status())
+		w.Write(body)
+	}
+}
+
+// functionURL returns the URL of the function on the gateway as seen by the client
+func functionURL(r *http.Request, publicURL PublicURL) string {
+	return publicURL.Base(r) + "/function/" + middleware.GetServiceName(r.URL.Path)
+}
+
+// newURLReplacer builds a replacer for the prefixes of a
+// com.openfaas.rewrite-urls annotation, the longest prefix is preferred
+// when several match
+func newURLReplacer(value, defaultReplacement string) *strings.Replacer {
+	type rewrite struct {
+		prefix      string
+		replacement string
+	}
+
+	var rewrites []rewrite
+	for _, entry := range strings.Split(value, ",") {
+		prefix, replacement, ok := strings.Cut(entry, "=")
+		prefix = strings.TrimSuffix(strings.TrimSpace(prefix), "/")
+		if len(prefix) == 0 {
+			continue
+		}
+
+		replacement = strings.TrimSuffix(strings.TrimSpace(replacement), "/")
+		if !ok || len(replacement) == 0 {
+			replacement = defaultReplacement
+		}
+		rewrites = append(rewrites, rewrite{prefix: prefix, replacement: replacement})
+	}
+
+	sort.SliceStable(rewrites, func(i, j int) bool {
+		return len(rewrites[i].prefix) > len(rewrites[j].prefix)
+	})
+
+	oldnew := make([]string, 0, len(rewrites)*2)
+	for _, rw := range rewrites {
+		oldnew = append(oldnew, rw.prefix, rw.replacement)
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+func isRewritableContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || isJSONContentType(contentType)
+}
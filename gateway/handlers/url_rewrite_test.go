@@ -0,0 +1,134 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func Test_MakeURLRewriteHandler_HTML(t *testing.T) {
+	query := fakeFunctionQuery{annotations: map[string]string{
+		RewriteURLsAnnotation: "http://site.openfaas-fn:8080",
+	}}
+
+	handler := MakeURLRewriteHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<a href="http://site.openfaas-fn:8080/about">About</a>`))
+	}, query, PublicURL{TrustedProxies: 1}, "openfaas-fn", 1024)
+
+	req := httptest.NewRequest(http.MethodGet, "/function/site", nil)
+	req.Host = "gateway.example.com"
+	req.Header.Set("X-Forwarded-Proto", "https")
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	want := `<a href="https://gateway.example.com/function/site/about">About</a>`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func Test_MakeURLRewriteHandler_JSONMappings(t *testing.T) {
+	query := fakeFunctionQuery{annotations: map[string]string{
+		RewriteURLsAnnotation: "http://minio:9000=https://files.example.com, http://minio:9000/private=https://private.example.com/",
+	}}
+
+	body := `{"file":"http://minio:9000/a.png","secret":"http://minio:9000/private/b.png"}`
+	handler := MakeURLRewriteHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("Location", "http://minio:9000/a.png")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(body))
+	}, query, PublicURL{}, "openfaas-fn", 1024)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/function/upload", nil))
+
+	want := `{"file":"https://files.example.com/a.png","secret":"https://private.example.com/b.png"}`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+	if rec.Code != http.StatusCreated {
+		t.Errorf("want status: %d, got: %d", http.StatusCreated, rec.Code)
+	}
+	if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(want)) {
+		t.Errorf("want Content-Length: %d, got: %s", len(want), got)
+	}
+	if got := rec.Header().Get("Location"); got != "https://files.example.com/a.png" {
+		t.Errorf("want the Location header rewritten, got: %s", got)
+	}
+}
+
+func Test_MakeURLRewriteHandler_PassesThrough(t *testing.T) {
+	query := fakeFunctionQuery{annotations: map[string]string{
+		RewriteURLsAnnotation: "http://site.openfaas-fn:8080",
+	}}
+	body := "http://site.openfaas-fn:8080/a"
+
+	cases := []struct {
+		name            string
+		contentType     string
+		contentEncoding string
+		body            string
+	}{
+		{name: "binary", contentType: "application/octet-stream", body: body},
+		{name: "no content type", body: body},
+		{name: "encoded", contentType: "text/html", contentEncoding: "gzip", body: body},
+		{name: "over the limit", contentType: "text/html", body: body + strings.Repeat(" ", 64)},
+	}
+
+	for _, c := range cases {
+		handler := MakeURLRewriteHandler(func(w http.ResponseWriter, r *http.Request) {
+			if len(c.contentType) > 0 {
+				w.Header().Set("Content-Type", c.contentType)
+			}
+			if len(c.contentEncoding) > 0 {
+				w.Header().Set("Content-Encoding", c.contentEncoding)
+			}
+			w.Write([]byte(c.body))
+		}, query, PublicURL{}, "openfaas-fn", 64)
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/function/site", nil))
+		if got := rec.Body.String(); got != c.body {
+			t.Errorf("%s want the body unchanged, got: %s", c.name, got)
+		}
+	}
+}
+
+func Test_MakeURLRewriteHandler_NoAnnotation(t *testing.T) {
+	body := `{"url":"http://site.openfaas-fn:8080/a"}`
+	handler := MakeURLRewriteHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}, fakeFunctionQuery{annotations: map[string]string{}}, PublicURL{}, "openfaas-fn", 1024)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/function/site", nil))
+	if got := rec.Body.String(); got != body {
+		t.Errorf("want the body unchanged, got: %s", got)
+	}
+}
+
+func Test_functionURL_PublicURL(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/function/site/about", nil)
+	req.Host = "evil.example.com"
+	req.Header.Set("X-Forwarded-Proto", "https")
+
+	if got := functionURL(req, PublicURL{}); got != "http://evil.example.com/function/site" {
+		t.Errorf("want X-Forwarded-Proto ignored without trusted proxies, got: %s", got)
+	}
+
+	publicURL, _ := url.Parse("https://gateway.example.com")
+	if got := functionURL(req, PublicURL{URL: publicURL}); got != "https://gateway.example.com/function/site" {
+		t.Errorf("want the public URL, got: %s", got)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/openfaas/faas/gateway/version"
+)
+
+// VersionInfo describes the build of the gateway serving the request
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+}
+
+// MakeVersionHandler returns the version, commit and build date which were
+// set at link time
+func MakeVersionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info := VersionInfo{
+			Version:   version.BuildVersion(),
+			Commit:    version.GitCommitSHA,
+			BuildDate: version.BuildDate,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openfaas/faas/gateway/version"
+)
+
+func Test_MakeVersionHandler(t *testing.T) {
+	defer func(v, sha, date string) {
+		version.Version, version.GitCommitSHA, version.BuildDate = v, sha, date
+	}(version.Version, version.GitCommitSHA, version.BuildDate)
+
+	version.Version = "0.26.2"
+	version.GitCommitSHA = "f5eb9d1"
+	version.BuildDate = "2023-03-01T10:00:00Z"
+
+	rr := httptest.NewRecorder()
+	MakeVersionHandler()(rr, httptest.NewRequest(http.MethodGet, "/system/version", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status want: %d, got: %d", http.StatusOK, rr.Code)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type want: application/json, got: %q", got)
+	}
+
+	info := VersionInfo{}
+	if err := json.NewDecoder(rr.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	want := VersionInfo{Version: "0.26.2", Commit: "f5eb9d1", BuildDate: "2023-03-01T10:00:00Z"}
+	if info != want {
+		t.Errorf("want: %+v, got: %+v", want, info)
+	}
+}
+
+func Test_MakeVersionHandler_DevBuild(t *testing.T) {
+	defer func(v string) { version.Version = v }(version.Version)
+	version.Version = ""
+
+	rr := httptest.NewRecorder()
+	MakeVersionHandler()(rr, httptest.NewRequest(http.MethodGet, "/system/version", nil))
+
+	info := VersionInfo{}
+	if err := json.NewDecoder(rr.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != version.DevVersion {
+		t.Errorf("version want: %q, got: %q", version.DevVersion, info.Version)
+	}
+}
@@ -4,9 +4,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -76,6 +81,91 @@ func main() {
 		config.UpstreamTimeout,
 		config.MaxIdleConns,
 		config.MaxIdleConnsPerHost)
+	reverseProxy.ChunkTimeout = config.UpstreamChunkTimeout
+	reverseProxy.FlushInterval = config.UpstreamFlushInterval
+	reverseProxy.ResponseBufferBytes = config.UpstreamResponseBufferBytes
+	reverseProxy.UserAgent = config.UpstreamUserAgent
+	reverseProxy.AppendUserAgent = config.AppendUpstreamUserAgent
+	reverseProxy.ServerHeader = config.ServerHeader
+	reverseProxy.StripServerHeader = config.StripServerHeader
+	if config.VersionHeader {
+		reverseProxy.VersionHeader = version.BuildVersion()
+	}
+	reverseProxy.ContextHeaders = config.ContextHeaders
+	reverseProxy.RestrictedHeaders = config.RestrictedHeaders
+	reverseProxy.FunctionNamespace = config.Namespace
+	if len(config.NamespaceAuthSecrets) > 0 {
+		reverseProxy.NamespaceAuthInjectors = map[string]middleware.AuthInjector{}
+		for namespace, secretPath := range config.NamespaceAuthSecrets {
+			reader := auth.ReadBasicAuthFromDisk{
+				SecretMountPath: secretPath,
+			}
+			namespaceCredentials, readErr := reader.Read()
+			if readErr != nil {
+				log.Panicf("unable to read credentials for namespace %s: %s", namespace, readErr)
+			}
+			reverseProxy.NamespaceAuthInjectors[namespace] = &middleware.BasicAuthInjector{Credentials: namespaceCredentials}
+		}
+	}
+	reverseProxy.RequestIDHeader = config.RequestIDHeader
+	reverseProxy.TraceSampleRate = config.TraceSampleRate
+	reverseProxy.TimingHeaders = config.TimingHeaders
+	reverseProxy.TimeoutBreakdown = config.TimeoutBreakdown
+	reverseProxy.ObserveTimings = func(r *http.Request, requestBody, upstreamWait time.Duration) {
+		if !strings.HasPrefix(r.URL.Path, "/function/") {
+			return
+		}
+		functionName, namespace := middleware.GetNamespace(config.Namespace, middleware.GetServiceName(r.URL.Path))
+		metricsOptions.GatewayRequestBodySeconds.WithLabelValues(functionName + "." + namespace).Observe(requestBody.Seconds())
+		metricsOptions.GatewayUpstreamWaitSeconds.WithLabelValues(functionName + "." + namespace).Observe(upstreamWait.Seconds())
+	}
+	reverseProxy.ObserveConnectionClose = func(r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/function/") {
+			return
+		}
+		functionName, namespace := middleware.GetNamespace(config.Namespace, middleware.GetServiceName(r.URL.Path))
+		metricsOptions.GatewayUpstreamConnectionClose.WithLabelValues(functionName + "." + namespace).Inc()
+	}
+	reverseProxy.LogConnectionClose = config.LogUpstreamConnectionClose
+	reverseProxy.ExplicitEmptyBody = config.UpstreamExplicitEmptyBody
+	reverseProxy.MaxResponseHeaders = config.MaxResponseHeaders
+	reverseProxy.MaxResponseHeaderBytes = config.MaxResponseHeaderBytes
+	reverseProxy.MarkTruncatedHeaders = config.MarkTruncatedHeaders
+	reverseProxy.ClientTimeoutHeader = config.ClientTimeoutHeader
+	reverseProxy.ConfigureTLS(config.UpstreamTLSMinVersion, config.UpstreamTLSCipherSuites)
+	reverseProxy.DialTimeout = config.UpstreamDialTimeout
+	reverseProxy.ScaleRules = config.ScaleRules
+	reverseProxy.ConfigureDialer(config.UpstreamKeepAlive, config.UpstreamTCPNoDelay)
+
+	if config.UpstreamProxyURL != nil || len(config.UpstreamProxyNamespaces) > 0 {
+		selector := types.UpstreamProxySelector{
+			Default:          config.UpstreamProxyURL,
+			Namespaces:       config.UpstreamProxyNamespaces,
+			DefaultNamespace: config.Namespace,
+			Fallback:         http.ProxyFromEnvironment,
+		}
+		reverseProxy.Transport.Proxy = selector.Proxy
+	}
+
+	// Caches emptied by /system/cache/flush
+	flushableCaches := map[string]handlers.CacheFlusher{}
+
+	if config.DNSCacheTTL > 0 {
+		dnsCache := types.NewDNSCache(config.DNSCacheTTL)
+		reverseProxy.Transport.DialContext = dnsCache.DialContext(reverseProxy.Transport.DialContext)
+		flushableCaches["dns"] = dnsCache
+	}
+
+	// Functions can set the TLS server name used to dial them over HTTPS,
+	// which is sent through a clone of the Transport for each name
+	serverNameTransport := types.NewServerNameTransport(reverseProxy.Transport, types.DefaultMaxServerNames)
+	reverseProxy.Client.Transport = serverNameTransport
+
+	if config.ProxyTransportMetrics {
+		transportMetrics := metrics.NewTransportMetrics()
+		reverseProxy.Client.Transport = transportMetrics.Instrument(reverseProxy.Transport, serverNameTransport)
+		metrics.RegisterTransportMetrics(transportMetrics)
+	}
 
 	//loggingNotifier := handlers.LoggingNotifier{}
 
@@ -84,10 +174,6 @@ func main() {
 		FunctionNamespace: config.Namespace,
 	}*/
 
-	functionNotifiers := []handlers.HTTPNotifier{ /*loggingNotifier prometheusNotifier*/ }
-	forwardingNotifiers := []handlers.HTTPNotifier{ /*loggingNotifier*/ }
-	quietNotifier := []handlers.HTTPNotifier{}
-
 	urlResolver := middleware.SingleHostBaseURLResolver{BaseURL: config.FunctionsProviderURL.String()}
 	var functionURLResolver middleware.BaseURLResolver
 	var functionURLTransformer middleware.URLPathTransformer
@@ -106,17 +192,238 @@ func main() {
 	// externalServiceQuery is used to query metadata from the provider about a function
 	externalServiceQuery := plugin.NewExternalServiceQuery(*config.FunctionsProviderURL, serviceAuthInjector)
 
+	var scaleHintSecret string
+	if config.ScaleHint {
+		if len(config.ScaleHintSecretPath) == 0 {
+			log.Printf("scale_hint is enabled without scale_hint_secret_path, the _scale parameter will be ignored")
+		} else {
+			secret, err := os.ReadFile(config.ScaleHintSecretPath)
+			if err != nil {
+				log.Fatalf("Unable to read scale_hint_secret_path: %s", err)
+			}
+			scaleHintSecret = strings.TrimSpace(string(secret))
+		}
+	}
+
 	scalingConfig := scaling.ScalingConfig{
 		MaxPollCount:         uint(1000),
 		SetScaleRetries:      uint(20),
 		FunctionPollInterval: time.Millisecond * 100,
-		CacheExpiry:          time.Millisecond * 250, // freshness of replica values before going stale
+		CacheExpiry:          config.ScaleCacheExpiry, // freshness of replica values before going stale
 		ServiceQuery:         externalServiceQuery,
+		EnableScaleHint:      config.ScaleHint,
+		ScaleHintSecret:      scaleHintSecret,
+		ReplicasHeader:       config.ReplicasHeader,
+
+		NotFoundStatus:         config.ScaleNotFoundStatus,
+		NotFoundStatusPrefixes: config.ScaleNotFoundStatusPrefixes,
+		CatchAllFunctions:      config.CatchAllFunctions,
+		TrustedProxies:         config.TrustedProxies,
+
+		Warmer: &scaling.FunctionWarmer{
+			Client:   reverseProxy.Client,
+			Resolver: functionURLResolver,
+		},
+		WarmUpTimeout: time.Second * 10,
+
+		LatencyTarget:    config.ScaleLatencyTarget,
+		LatencyScaleStep: config.ScaleLatencyStep,
+		LatencyScaleUps:  metricsOptions.GatewayLatencyScaleUps,
+	}
+
+	// Scale events are published in the background, the no-op sink is used
+	// unless a destination is configured
+	var scaleEvents scaling.ScaleEventSink = scaling.NoopScaleEventSink{}
+	if config.ScaleEventsURL != nil {
+		scaleEvents = scaling.NewAsyncScaleEventSink(scaling.WebhookScaleEventSink{
+			URL:     config.ScaleEventsURL.String(),
+			Client:  &http.Client{},
+			Timeout: time.Second * 5,
+		}, config.ScaleEventsBuffer)
+	}
+	scalingConfig.ScaleEvents = scaleEvents
+
+	if len(config.FailoverPeers) > 0 {
+		peers := make([]scaling.PeerRegion, 0, len(config.FailoverPeers))
+		for _, peer := range config.FailoverPeers {
+			peerRegion := scaling.PeerRegion{Name: peer.Region, URL: peer.URL}
+			if len(peer.AuthSecretPath) > 0 {
+				reader := auth.ReadBasicAuthFromDisk{
+					SecretMountPath: peer.AuthSecretPath,
+				}
+				peerCredentials, readErr := reader.Read()
+				if readErr != nil {
+					log.Panicf("unable to read credentials for failover peer %s: %s", peer.Region, readErr)
+				}
+				peerRegion.Auth = &middleware.BasicAuthInjector{Credentials: peerCredentials}
+			}
+			peers = append(peers, peerRegion)
+		}
+		scalingConfig.Failover = scaling.NewRegionFailover(config.FailoverRegion, peers)
+	}
+
+	if config.NotFoundBackoffThreshold > 0 {
+		scalingConfig.NotFoundBackoff = scaling.NewNotFoundBackoff(config.NotFoundBackoffThreshold,
+			config.NotFoundBackoffCooldown,
+			config.NotFoundBackoffMaxEntries)
+		flushableCaches["not-found"] = scalingConfig.NotFoundBackoff
+	}
+
+	if config.MaxConcurrentColdStarts > 0 {
+		scalingConfig.ColdStarts = scaling.NewColdStartQueue(config.MaxConcurrentColdStarts, config.ColdStartPriorityAging)
+		scalingConfig.ColdStarts.NamespaceWeights = config.ColdStartNamespaceWeights
+		scalingConfig.ColdStarts.NamespaceLimits = config.ColdStartNamespaceLimits
+		scalingConfig.ColdStarts.QueueDepth = metricsOptions.GatewayColdStartQueueDepth
+	}
+
+	if config.ColdStartProgress {
+		scalingConfig.ColdStartHistory = scaling.NewColdStartHistory(config.ColdStartHistorySize)
 	}
 
 	// This cache can be used to query a function's annotations.
 	functionAnnotationCache := scaling.NewFunctionCache(scalingConfig.CacheExpiry)
 	cachedFunctionQuery := scaling.NewCachedFunctionQuery(functionAnnotationCache, externalServiceQuery)
+	flushableCaches["functions"] = functionAnnotationCache
+
+	functionNotifiers := []handlers.HTTPNotifier{ /*loggingNotifier prometheusNotifier*/ }
+	forwardingNotifiers := []handlers.HTTPNotifier{ /*loggingNotifier*/ }
+	quietNotifier := []handlers.HTTPNotifier{}
+
+	invocationStats := handlers.NewInvocationStats(config.InvocationStatsMaxFunctions)
+	functionNotifiers = append(functionNotifiers, handlers.InvocationStatsNotifier{
+		Stats:             invocationStats,
+		FunctionQuery:     cachedFunctionQuery,
+		FunctionNamespace: config.Namespace,
+	})
+
+	latencySummary := handlers.NewLatencySummary(config.LatencySummaryWindow, config.LatencySummaryMaxFunctions)
+	functionNotifiers = append(functionNotifiers, handlers.LatencySummaryNotifier{
+		Summary:           latencySummary,
+		FunctionQuery:     cachedFunctionQuery,
+		FunctionNamespace: config.Namespace,
+	})
+
+	var latencyLoad *handlers.LatencyLoad
+	if config.AdmissionControl && config.AdmissionLatencyTarget > 0 {
+		latencyLoad = handlers.NewLatencyLoad(config.AdmissionLatencyTarget)
+		functionNotifiers = append(functionNotifiers, latencyLoad)
+	}
+
+	if len(config.StatsDHost) > 0 {
+		statsdNotifier, err := handlers.NewStatsDNotifier(net.JoinHostPort(config.StatsDHost, strconv.Itoa(config.StatsDPort)),
+			config.StatsDPrefix, config.StatsDSampleRate, config.Namespace)
+		if err != nil {
+			log.Panicf(err.Error())
+		}
+		functionNotifiers = append(functionNotifiers, statsdNotifier)
+	}
+
+	if config.AsyncNotifiers {
+		functionNotifiers = []handlers.HTTPNotifier{
+			handlers.NewAsyncNotifier(functionNotifiers, config.AsyncNotifierWorkers, config.AsyncNotifierQueueSize),
+		}
+		if len(forwardingNotifiers) > 0 {
+			forwardingNotifiers = []handlers.HTTPNotifier{
+				handlers.NewAsyncNotifier(forwardingNotifiers, config.AsyncNotifierWorkers, config.AsyncNotifierQueueSize),
+			}
+		}
+	}
+
+	// Functions can set their own timeout, which is read from the cached annotations
+	functionTimeouts := scaling.FunctionTimeouts{
+		Cache:            functionAnnotationCache,
+		DefaultNamespace: config.Namespace,
+		MaxTimeout:       config.MaxFunctionTimeout,
+	}
+	reverseProxy.FunctionTimeout = functionTimeouts.Timeout
+
+	// Functions can set the TLS server name used to dial them over HTTPS
+	reverseProxy.FunctionServerName = scaling.FunctionServerNames{
+		Cache:            functionAnnotationCache,
+		DefaultNamespace: config.Namespace,
+	}.ServerName
+
+	// Scale requests for functions which are not cached are clamped to the
+	// replicas read from the provider
+	reverseProxy.FunctionReplicas = func(functionName, namespace string) (uint64, uint64, bool) {
+		query, err := cachedFunctionQuery.Get(functionName, namespace)
+		return query.MinReplicas, query.MaxReplicas, err == nil && query.MaxReplicas > 0
+	}
+
+	// Functions can ask for the URI as the client sent it
+	reverseProxy.FunctionRawRequestURI = scaling.FunctionRawRequestURIs{
+		Cache:            functionAnnotationCache,
+		DefaultNamespace: config.Namespace,
+	}.RawRequestURI
+
+	// Functions with endpoints in the cache are routed to them instead of the provider
+	if _, err := scaling.NewLoadBalancer(config.LoadBalancer); err != nil {
+		log.Fatalf("Invalid load_balancer: %s", err)
+	}
+	endpointResolver := scaling.NewEndpointBaseURLResolver(functionAnnotationCache, functionURLResolver, config.Namespace)
+	endpointResolver.DefaultPolicy = config.LoadBalancer
+	endpointResolver.SetBalancer(scaling.HealthScore, scaling.NewHealthScoreBalancer(scaling.HealthScoreConfig{
+		Decay:         config.HealthScoreDecay,
+		LatencyTarget: config.HealthScoreLatencyTarget,
+		MinScore:      config.HealthScoreMinScore,
+	}))
+	endpointResolver.Outliers = scaling.NewOutlierDetector(config.OutlierConsecutiveFailures,
+		config.OutlierEjectionTime,
+		metricsOptions.GatewayEndpointEjections)
+	functionURLResolver = endpointResolver
+
+	// Functions with deployments in several regions are routed to the client's region
+	functionURLResolver = scaling.NewRegionBaseURLResolver(cachedFunctionQuery, functionURLResolver, config.Namespace, config.RegionHeader, config.DefaultRegion)
+
+	// Feature variants route experiments to their own deployment of a function
+	functionURLResolver = scaling.NewFeatureFlagBaseURLResolver(cachedFunctionQuery, functionURLResolver, config.Namespace, config.FeatureFlagHeader, config.StripFeatureFlagHeader)
+	faasHandlers.FunctionEndpoints = handlers.MakeFunctionEndpointsHandler(functionAnnotationCache, config.Namespace)
+	faasHandlers.FunctionConfig = handlers.MakeFunctionConfigHandler(cachedFunctionQuery, functionTimeouts, handlers.FunctionConfigDefaults{
+		Timeout:         config.UpstreamTimeout,
+		TimeBudget:      config.TimeBudget,
+		MaxRequestBytes: config.MaxRequestBodyBytes,
+		LoadShedding:    config.LoadShedding,
+		ResponseCache:   config.ResponseCache,
+
+		LoadBalancer:               config.LoadBalancer,
+		OutlierConsecutiveFailures: config.OutlierConsecutiveFailures,
+		OutlierEjectionTime:        config.OutlierEjectionTime,
+		DefaultRegion:              config.DefaultRegion,
+		ScaleFromZero:              config.ScaleFromZero,
+		FaultInjection:             config.FaultInjection,
+		UpstreamProxy:              config.UpstreamProxyURL,
+		UpstreamProxyNamespaces:    config.UpstreamProxyNamespaces,
+		ColdStartQueue:             config.ScaleFromZero && config.MaxConcurrentColdStarts > 0,
+		ColdStartNamespaceWeights:  config.ColdStartNamespaceWeights,
+		ColdStartNamespaceLimits:   config.ColdStartNamespaceLimits,
+	}, config.Namespace)
+	faasHandlers.CacheFlush = handlers.MakeCacheFlushHandler(flushableCaches)
+	faasHandlers.Version = handlers.MakeVersionHandler()
+
+	var queuedProxy http.HandlerFunc
+	if config.UseNATS() {
+		log.Println("Async enabled: Using NATS Streaming")
+		log.Println("Deprecation Notice: NATS Streaming is no longer maintained and won't receive updates from June 2023")
+
+		maxReconnect := 60
+		interval := time.Second * 2
+
+		defaultNATSConfig := natsHandler.NewDefaultNATSConfig(maxReconnect, interval)
+
+		natsQueue, queueErr := natsHandler.CreateNATSQueue(*config.NATSAddress, *config.NATSPort, *config.NATSClusterName, *config.NATSChannel, defaultNATSConfig)
+		if queueErr != nil {
+			log.Fatalln(queueErr)
+		}
+
+		queuedProxy = handlers.MakeCallIDMiddleware(handlers.MakeQueuedProxy(metricsOptions, natsQueue, trimURLTransformer, config.Namespace, cachedFunctionQuery))
+	}
+
+	functionURLTransformer = middleware.TrailingSlashURLPathTransformer{
+		Transformer:      functionURLTransformer,
+		Mode:             config.TrailingSlash,
+		Annotations:      cachedFunctionQuery,
+		DefaultNamespace: config.Namespace,
+	}
 
 	faasHandlers.Proxy = handlers.MakeCallIDMiddleware(
 		handlers.MakeForwardingProxyHandler(reverseProxy, functionNotifiers, functionURLResolver, functionURLTransformer, nil, nil),
@@ -124,20 +431,227 @@ func main() {
 
 	functionProxy := faasHandlers.Proxy
 
+	// Requests with the async mode header are queued in place of being
+	// forwarded, after passing through the same middleware
+	if queuedProxy != nil && len(config.AsyncModeHeader) > 0 {
+		functionProxy = handlers.MakeAsyncModeHandler(functionProxy,
+			handlers.MakeNotifierWrapper(queuedProxy, functionNotifiers),
+			config.AsyncModeHeader)
+	}
+
+	if config.FaultInjection {
+		log.Println("Fault injection is enabled, requests to functions with fault annotations will be delayed or aborted")
+		functionProxy = handlers.MakeFaultInjectionHandler(functionProxy, cachedFunctionQuery, config.Namespace)
+	}
+
+	if config.UseCircuitBreaker() {
+		circuitBreaker := handlers.NewCircuitBreaker(config.CircuitBreakerThreshold, config.CircuitBreakerOpenDuration)
+		functionProxy = handlers.MakeCircuitBreakerHandler(functionProxy, circuitBreaker, config.Namespace)
+		faasHandlers.CircuitBreakerStatus = handlers.MakeCircuitBreakerStatusHandler(circuitBreaker)
+	}
+
+	functionProxy = handlers.MakeStreamTruncationHandler(functionProxy, cachedFunctionQuery, config.Namespace)
+	functionProxy = handlers.MakeTimeoutErrorHandler(functionProxy, cachedFunctionQuery, config.Namespace)
+	functionProxy = handlers.MakeEarlyHintsHandler(functionProxy, cachedFunctionQuery, config.Namespace)
+	functionProxy = handlers.MakeRedirectsHandler(functionProxy, cachedFunctionQuery, config.Namespace)
+	functionProxy = handlers.MakeContentTransformHandler(functionProxy, cachedFunctionQuery, handlers.DefaultContentCodecs(), config.ContentTransformMaxBodyBytes, config.Namespace)
+	functionProxy = handlers.MakeRequestSchemaHandler(functionProxy, cachedFunctionQuery, handlers.NewRequestSchemas(config.RequestSchemaDir), config.RequestSchemaMaxBodyBytes, config.Namespace)
+	functionProxy = handlers.MakeBodyChecksumHandler(functionProxy, cachedFunctionQuery, config.BodyChecksumMaxBodyBytes, config.Namespace)
+	functionProxy = handlers.MakeRequestBudgetHandler(functionProxy, cachedFunctionQuery, config.MaxRequestBodyBytes, config.Namespace)
+
+	if config.ResponseRedaction {
+		functionProxy = handlers.MakeRedactionHandler(functionProxy, cachedFunctionQuery, config.Namespace, config.ResponseRedactionMaxBodyBytes)
+	}
+	publicURL := handlers.PublicURL{URL: config.PublicURL, TrustedProxies: config.TrustedProxies}
+	functionProxy = handlers.MakeSelfLinkHandler(functionProxy, cachedFunctionQuery, publicURL, config.Namespace, config.SelfLinkMaxBodyBytes)
+	functionProxy = handlers.MakeURLRewriteHandler(functionProxy, cachedFunctionQuery, publicURL, config.Namespace, config.URLRewriteMaxBodyBytes)
+
+	// Requests to a function are counted once, by MakeInFlightHandler, for
+	// the slow start and load shedding limits and so that a scale to zero
+	// waits for them to complete
+	inFlight := handlers.NewInFlightCounter()
+
 	var functionCache scaling.FunctionCacher
 	if config.ScaleFromZero {
 		functionCache = scaling.NewFunctionCache(scalingConfig.CacheExpiry)
+		flushableCaches["replicas"] = functionCache
+		scalingConfig.FunctionQuery = cachedFunctionQuery
 		scaler := scaling.NewFunctionScaler(scalingConfig, functionCache)
-		functionProxy = handlers.MakeScalingHandler(functionProxy, scaler, scalingConfig, config.Namespace)
+
+		slowStart := handlers.NewSlowStart(inFlight)
+		functionProxy = handlers.MakeSlowStartHandler(functionProxy, cachedFunctionQuery, slowStart, metricsOptions, config.Namespace)
+
+		scalingNotifiers := append([]handlers.HTTPNotifier{slowStart}, functionNotifiers...)
+		functionProxy = handlers.MakeScalingHandler(functionProxy, scaler, scalingConfig, config.Namespace, scalingNotifiers)
+
+		faasHandlers.DeployWarmUp = handlers.MakeDeployWarmUpHandler(scaler, cachedFunctionQuery, config.Namespace)
+	}
+
+	if config.CacheWarming {
+		if lister, ok := externalServiceQuery.(scaling.FunctionLister); ok {
+			warmer := &scaling.CacheWarmer{
+				Lister:           lister,
+				Query:            externalServiceQuery,
+				Caches:           []scaling.FunctionCacher{functionAnnotationCache},
+				DefaultNamespace: config.Namespace,
+				Concurrency:      config.CacheWarmingConcurrency,
+				Rate:             config.CacheWarmingRate,
+			}
+			if functionCache != nil {
+				warmer.Caches = append(warmer.Caches, functionCache)
+			}
+
+			// Requests are served whilst the caches are warmed, they look
+			// up any function which has not been reached yet themselves
+			go func() {
+				start := time.Now()
+				warmed, err := warmer.Warm(context.Background())
+				if err != nil {
+					log.Printf("Cache warming: unable to list functions: %s\n", err)
+					return
+				}
+				log.Printf("Cache warming: %d function(s) cached in %s\n", warmed, time.Since(start).Round(time.Millisecond))
+			}()
+		}
+	}
+
+	if config.ResponseCache {
+		responseCache := handlers.NewResponseCache(config.ResponseCacheMaxEntries)
+		flushableCaches["responses"] = responseCache
+		functionProxy = handlers.MakeResponseCacheHandler(functionProxy, responseCache, cachedFunctionQuery, functionURLTransformer, config.Namespace, config.ResponseCacheMaxBodyBytes)
+	}
+
+	if config.LoadShedding {
+		functionProxy = handlers.MakeLoadSheddingHandler(functionProxy, cachedFunctionQuery, inFlight, config.CostClassWeights, metricsOptions, config.Namespace)
+	}
+
+	if config.LoadShedding || config.ScaleFromZero || config.ScaleDownDrainTimeout > 0 {
+		functionProxy = handlers.MakeInFlightHandler(functionProxy, inFlight, config.CostClassWeights, config.Namespace)
+	}
+
+	// guard applies the source allow-list, tenant context and replay
+	// protection, which queued invocations go through as well
+	guard := func(next http.HandlerFunc) http.HandlerFunc {
+		return handlers.MakeSourceAllowListHandler(next, cachedFunctionQuery, config.TrustedProxies, config.Namespace)
+	}
+
+	if len(config.TenantJWTKeyPath) > 0 {
+		key, err := os.ReadFile(config.TenantJWTKeyPath)
+		if err != nil {
+			log.Fatalf("Unable to read tenant_jwt_key_path: %s", err)
+		}
+		validator, err := middleware.NewJWTValidator(key)
+		if err != nil {
+			log.Fatalf("Unable to load tenant JWT key: %s", err)
+		}
+		claimHeaders, err := handlers.ParseClaimHeaders(config.TenantJWTClaims)
+		if err != nil {
+			log.Fatalf("Invalid tenant_jwt_claims: %s", err)
+		}
+		sourceAllowList := guard
+		guard = func(next http.HandlerFunc) http.HandlerFunc {
+			return handlers.MakeTenantContextHandler(sourceAllowList(next), validator, claimHeaders)
+		}
+	}
+
+	replayProtection := func(next http.HandlerFunc) http.HandlerFunc {
+		return next
+	}
+	if config.ReplayProtection {
+		var nonceStore handlers.NonceStore = handlers.NewMemoryNonceStore(config.ReplayNonceMaxEntries)
+		if len(config.ReplayRedisAddress) > 0 {
+			nonceStore = handlers.NewRedisNonceStore(config.ReplayRedisAddress, config.ReplayRedisPassword)
+		}
+		replayConfig := handlers.ReplayConfig{
+			NonceHeader:     config.ReplayNonceHeader,
+			TimestampHeader: config.ReplayTimestampHeader,
+			Window:          config.ReplayWindow,
+		}
+		tenantContext := guard
+		guard = func(next http.HandlerFunc) http.HandlerFunc {
+			return handlers.MakeReplayProtectionHandler(tenantContext(next), nonceStore, replayConfig)
+		}
+
+		// A batch's nonce is checked once, for all of its items
+		replayProtection = func(next http.HandlerFunc) http.HandlerFunc {
+			return handlers.MakeReplayProtectionHandler(next, nonceStore, replayConfig)
+		}
+	}
+
+	functionProxy = guard(functionProxy)
+
+	functionProxy = handlers.MakeOptionsHandler(functionProxy, cachedFunctionQuery, config.Namespace)
+	functionProxy = handlers.MakeKeepAliveHandler(functionProxy, cachedFunctionQuery, config.Namespace)
+	functionProxy = handlers.MakeSSECompressionHandler(functionProxy, cachedFunctionQuery, config.Namespace)
+
+	var auditLogger handlers.AuditLogger = handlers.NoopAuditLogger{}
+	if len(config.AuditLogPath) > 0 {
+		auditFile, err := os.OpenFile(config.AuditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatalf("Unable to open audit_log_path: %s", err)
+		}
+		auditLogger = handlers.NewAsyncAuditLogger(auditFile, config.AuditLogBufferSize)
+	}
+	functionProxy = handlers.MakeAuditHandler(functionProxy, auditLogger, config.RequestIDHeader, config.Namespace)
+
+	if len(config.GatewayControlledHeaders) > 0 {
+		functionProxy = handlers.MakeDeniedHeadersHandler(functionProxy, config.GatewayControlledHeaders)
+	}
+
+	var requestTap *handlers.RequestTap
+	if config.RequestTap {
+		tapFunctions := []string{}
+		for _, function := range config.RequestTapFunctions {
+			functionName, namespace := middleware.GetNamespace(config.Namespace, function)
+			tapFunctions = append(tapFunctions, functionName+"."+namespace)
+		}
+		requestTap = handlers.NewRequestTap(tapFunctions, config.RequestTapSize, config.RequestTapMaxBodyBytes, config.RequestTapRedactHeaders)
+		functionProxy = handlers.MakeRequestTapHandler(functionProxy, requestTap, config.Namespace)
+	}
+
+	// Requests are rejected before any work is done for them whilst the
+	// gateway is overloaded
+	if config.AdmissionControl {
+		inFlightLoad := handlers.NewInFlightLoad(config.AdmissionMaxInFlight)
+		loadSignal := handlers.MaxLoad{inFlightLoad}
+		if latencyLoad != nil {
+			loadSignal = append(loadSignal, latencyLoad)
+		}
+
+		functionProxy = handlers.MakeInFlightLoadHandler(functionProxy, inFlightLoad)
+		functionProxy = handlers.MakeAdmissionHandler(functionProxy, loadSignal, config.AdmissionThreshold, config.AdmissionRetryAfter, metricsOptions, config.Namespace)
+	}
+
+	// The time budget's deadline is created before any other middleware, so
+	// that it covers all of them
+	functionProxy = handlers.MakeTimeBudgetHandler(functionProxy, cachedFunctionQuery, config.TimeBudget, config.Namespace)
+
+	if config.SlowRequestThreshold > 0 {
+		functionProxy = handlers.MakeSlowRequestLogHandler(functionProxy, config.SlowRequestThreshold, config.Namespace)
+	}
+
+	if config.TimingHeaders || config.TimeoutBreakdown {
+		functionProxy = handlers.MakeRequestTimingsHandler(functionProxy)
 	}
 
+	// Replayed requests go through every middleware, as the original did
+	if requestTap != nil {
+		faasHandlers.RequestTap = handlers.MakeRequestTapAdminHandler(requestTap, functionProxy, config.Namespace)
+	}
+
+	faasHandlers.Batch = replayProtection(handlers.MakeBatchHandler(functionProxy, config.BatchMaxConcurrency, config.BatchMaxItems, config.BatchMaxBodyBytes))
+
 	faasHandlers.ListFunctions = handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector, functionCache)
 	faasHandlers.DeployFunction = handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector, functionCache)
-	faasHandlers.DeleteFunction = handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector, functionCache)
+	faasHandlers.DeleteFunction = handlers.MakeInvocationStatsResetHandler(
+		handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector, functionCache),
+		invocationStats, config.Namespace)
 	faasHandlers.UpdateFunction = handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector, functionCache)
 	faasHandlers.FunctionStatus = handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector, functionCache)
 
 	faasHandlers.InfoHandler = handlers.MakeInfoHandler(handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector, functionCache))
+	faasHandlers.FunctionStats = handlers.MakeInvocationStatsHandler(invocationStats)
+	faasHandlers.FunctionLatency = handlers.MakeLatencySummaryHandler(latencySummary)
 	faasHandlers.SecretHandler = handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector, functionCache)
 
 	faasHandlers.NamespaceListerHandler = handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector, functionCache)
@@ -149,29 +663,26 @@ func main() {
 
 	faasHandlers.LogProxyHandler = handlers.NewLogHandlerFunc(*config.LogsProviderURL, config.WriteTimeout)
 
-	if config.UseNATS() {
-		log.Println("Async enabled: Using NATS Streaming")
-		log.Println("Deprecation Notice: NATS Streaming is no longer maintained and won't receive updates from June 2023")
-
-		maxReconnect := 60
-		interval := time.Second * 2
+	if queuedProxy != nil {
+		faasHandlers.QueuedProxy = guard(handlers.MakeNotifierWrapper(queuedProxy, forwardingNotifiers))
 
-		defaultNATSConfig := natsHandler.NewDefaultNATSConfig(maxReconnect, interval)
-
-		natsQueue, queueErr := natsHandler.CreateNATSQueue(*config.NATSAddress, *config.NATSPort, *config.NATSClusterName, *config.NATSChannel, defaultNATSConfig)
-		if queueErr != nil {
-			log.Fatalln(queueErr)
+		if len(config.GatewayControlledHeaders) > 0 {
+			faasHandlers.QueuedProxy = handlers.MakeDeniedHeadersHandler(faasHandlers.QueuedProxy, config.GatewayControlledHeaders)
 		}
-
-		faasHandlers.QueuedProxy = handlers.MakeNotifierWrapper(
-			handlers.MakeCallIDMiddleware(handlers.MakeQueuedProxy(metricsOptions, natsQueue, trimURLTransformer, config.Namespace, cachedFunctionQuery)),
-			forwardingNotifiers,
-		)
 	}
 
 	prometheusQuery := metrics.NewPrometheusQuery(config.PrometheusHost, config.PrometheusPort, &http.Client{})
 	faasHandlers.ListFunctions = metrics.AddMetricsHandler(faasHandlers.ListFunctions, prometheusQuery)
-	faasHandlers.ScaleFunction = handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector, functionCache)
+	scaleFunctionCache := functionCache
+	if functionCache != nil && config.ScaleDownDrainTimeout > 0 {
+		scaleFunctionCache = handlers.DrainingFunctionCache{
+			FunctionCacher: functionCache,
+			InFlight:       inFlight,
+			Timeout:        config.ScaleDownDrainTimeout,
+		}
+	}
+	faasHandlers.ScaleFunction = handlers.MakeForwardingProxyHandler(reverseProxy, forwardingNotifiers, urlResolver, nilURLTransformer, serviceAuthInjector, scaleFunctionCache)
+	faasHandlers.ScaleFunction = handlers.MakeScaleEventsHandler(faasHandlers.ScaleFunction, cachedFunctionQuery, scaleEvents, config.ScaleRules, config.Namespace)
 
 	if credentials != nil {
 		faasHandlers.Alert =
@@ -196,6 +707,31 @@ func main() {
 			auth.DecorateWithBasicAuth(faasHandlers.LogProxyHandler, credentials)
 		faasHandlers.NamespaceListerHandler =
 			auth.DecorateWithBasicAuth(faasHandlers.NamespaceListerHandler, credentials)
+		faasHandlers.FunctionStats =
+			auth.DecorateWithBasicAuth(faasHandlers.FunctionStats, credentials)
+		faasHandlers.FunctionLatency =
+			auth.DecorateWithBasicAuth(faasHandlers.FunctionLatency, credentials)
+		faasHandlers.FunctionEndpoints =
+			auth.DecorateWithBasicAuth(faasHandlers.FunctionEndpoints, credentials)
+		faasHandlers.FunctionConfig =
+			auth.DecorateWithBasicAuth(faasHandlers.FunctionConfig, credentials)
+		faasHandlers.CacheFlush =
+			auth.DecorateWithBasicAuth(faasHandlers.CacheFlush, credentials)
+		faasHandlers.Version =
+			auth.DecorateWithBasicAuth(faasHandlers.Version, credentials)
+
+		if faasHandlers.CircuitBreakerStatus != nil {
+			faasHandlers.CircuitBreakerStatus =
+				auth.DecorateWithBasicAuth(faasHandlers.CircuitBreakerStatus, credentials)
+		}
+		if faasHandlers.DeployWarmUp != nil {
+			faasHandlers.DeployWarmUp =
+				auth.DecorateWithBasicAuth(faasHandlers.DeployWarmUp, credentials)
+		}
+		if faasHandlers.RequestTap != nil {
+			faasHandlers.RequestTap =
+				auth.DecorateWithBasicAuth(faasHandlers.RequestTap, credentials)
+		}
 	}
 
 	r := mux.NewRouter()
@@ -204,8 +740,10 @@ func main() {
 	r.HandleFunc("/function/{name:["+NameExpression+"]+}", functionProxy)
 	r.HandleFunc("/function/{name:["+NameExpression+"]+}/", functionProxy)
 	r.HandleFunc("/function/{name:["+NameExpression+"]+}/{params:.*}", functionProxy)
+	r.HandleFunc("/batch", faasHandlers.Batch).Methods(http.MethodPost)
 
 	r.HandleFunc("/system/info", faasHandlers.InfoHandler).Methods(http.MethodGet)
+	r.HandleFunc("/system/version", faasHandlers.Version).Methods(http.MethodGet)
 	r.HandleFunc("/system/alert", faasHandlers.Alert).Methods(http.MethodPost)
 
 	r.HandleFunc("/system/function/{name:["+NameExpression+"]+}", faasHandlers.FunctionStatus).Methods(http.MethodGet)
@@ -214,12 +752,35 @@ func main() {
 	r.HandleFunc("/system/functions", faasHandlers.DeleteFunction).Methods(http.MethodDelete)
 	r.HandleFunc("/system/functions", faasHandlers.UpdateFunction).Methods(http.MethodPut)
 	r.HandleFunc("/system/scale-function/{name:["+NameExpression+"]+}", faasHandlers.ScaleFunction).Methods(http.MethodPost)
+	for _, rule := range config.ScaleRules {
+		if rule != types.DefaultScaleRules[0] {
+			r.HandleFunc(rule.PathPrefix+"{name:["+NameExpression+"]+}", faasHandlers.ScaleFunction).Methods(rule.Method)
+		}
+	}
 
 	r.HandleFunc("/system/secrets", faasHandlers.SecretHandler).Methods(http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete)
 	r.HandleFunc("/system/logs", faasHandlers.LogProxyHandler).Methods(http.MethodGet)
 
 	r.HandleFunc("/system/namespaces", faasHandlers.NamespaceListerHandler).Methods(http.MethodGet)
 
+	r.HandleFunc("/system/function-stats", faasHandlers.FunctionStats).Methods(http.MethodGet)
+	r.HandleFunc("/system/functions/latency", faasHandlers.FunctionLatency).Methods(http.MethodGet)
+	r.HandleFunc("/system/functions/{name:["+NameExpression+"]+}/config", faasHandlers.FunctionConfig).Methods(http.MethodGet)
+	r.HandleFunc("/system/function-endpoints", faasHandlers.FunctionEndpoints).Methods(http.MethodGet, http.MethodPut)
+	r.HandleFunc("/system/cache/flush", faasHandlers.CacheFlush).Methods(http.MethodPost)
+
+	if faasHandlers.DeployWarmUp != nil {
+		r.HandleFunc("/system/warm-up", faasHandlers.DeployWarmUp).Methods(http.MethodPost)
+	}
+
+	if faasHandlers.RequestTap != nil {
+		r.HandleFunc("/system/request-tap", faasHandlers.RequestTap).Methods(http.MethodGet, http.MethodPost)
+	}
+
+	if faasHandlers.CircuitBreakerStatus != nil {
+		r.HandleFunc("/system/circuit-breakers", faasHandlers.CircuitBreakerStatus).Methods(http.MethodGet)
+	}
+
 	if faasHandlers.QueuedProxy != nil {
 		r.HandleFunc("/async-function/{name:["+NameExpression+"]+}/", faasHandlers.QueuedProxy).Methods(http.MethodPost)
 		r.HandleFunc("/async-function/{name:["+NameExpression+"]+}", faasHandlers.QueuedProxy).Methods(http.MethodPost)
@@ -264,8 +825,9 @@ func main() {
 		Addr:           fmt.Sprintf(":%d", tcpPort),
 		ReadTimeout:    config.ReadTimeout,
 		WriteTimeout:   config.WriteTimeout,
+		IdleTimeout:    config.ClientKeepAliveTimeout,
 		MaxHeaderBytes: http.DefaultMaxHeaderBytes, // 1MB - can be overridden by setting Server.MaxHeaderBytes.
-		Handler:        r,
+		Handler:        handlers.MakeRequestIDHeaderHandler(r.ServeHTTP, config.RequestIDHeader),
 	}
 
 	log.Fatal(s.ListenAndServe())
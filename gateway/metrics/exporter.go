@@ -46,6 +46,15 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	e.metricOptions.GatewayFunctionsHistogram.Describe(ch)
 	e.metricOptions.ServiceReplicasGauge.Describe(ch)
 	e.metricOptions.GatewayFunctionInvocationStarted.Describe(ch)
+	e.metricOptions.GatewayFunctionShed.Describe(ch)
+	e.metricOptions.GatewayLatencyScaleUps.Describe(ch)
+	e.metricOptions.GatewayEndpointEjections.Describe(ch)
+	e.metricOptions.GatewayFunctionSlowStartLimit.Describe(ch)
+	e.metricOptions.GatewayColdStartQueueDepth.Describe(ch)
+	e.metricOptions.GatewayAdmissionRejected.Describe(ch)
+	e.metricOptions.GatewayUpstreamConnectionClose.Describe(ch)
+	e.metricOptions.GatewayRequestBodySeconds.Describe(ch)
+	e.metricOptions.GatewayUpstreamWaitSeconds.Describe(ch)
 }
 
 // Collect collects data to be consumed by prometheus
@@ -54,6 +63,15 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	e.metricOptions.GatewayFunctionsHistogram.Collect(ch)
 
 	e.metricOptions.GatewayFunctionInvocationStarted.Collect(ch)
+	e.metricOptions.GatewayFunctionShed.Collect(ch)
+	e.metricOptions.GatewayLatencyScaleUps.Collect(ch)
+	e.metricOptions.GatewayEndpointEjections.Collect(ch)
+	e.metricOptions.GatewayFunctionSlowStartLimit.Collect(ch)
+	e.metricOptions.GatewayColdStartQueueDepth.Collect(ch)
+	e.metricOptions.GatewayAdmissionRejected.Collect(ch)
+	e.metricOptions.GatewayUpstreamConnectionClose.Collect(ch)
+	e.metricOptions.GatewayRequestBodySeconds.Collect(ch)
+	e.metricOptions.GatewayUpstreamWaitSeconds.Collect(ch)
 
 	e.metricOptions.ServiceReplicasGauge.Reset()
 
@@ -18,6 +18,23 @@ type MetricOptions struct {
 	GatewayFunctionInvocationStarted *prometheus.CounterVec
 
 	ServiceReplicasGauge *prometheus.GaugeVec
+
+	GatewayFunctionShed *prometheus.CounterVec
+
+	GatewayLatencyScaleUps *prometheus.CounterVec
+
+	GatewayEndpointEjections *prometheus.CounterVec
+
+	GatewayFunctionSlowStartLimit *prometheus.GaugeVec
+
+	GatewayColdStartQueueDepth *prometheus.GaugeVec
+
+	GatewayAdmissionRejected *prometheus.CounterVec
+
+	GatewayUpstreamConnectionClose *prometheus.CounterVec
+
+	GatewayRequestBodySeconds  *prometheus.HistogramVec
+	GatewayUpstreamWaitSeconds *prometheus.HistogramVec
 }
 
 // ServiceMetricOptions provides RED metrics
@@ -77,11 +94,104 @@ func BuildMetricsOptions() MetricOptions {
 		[]string{"function_name"},
 	)
 
+	gatewayFunctionShed := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gateway",
+			Subsystem: "function",
+			Name:      "shed_total",
+			Help:      "Function requests shed due to load, by priority",
+		},
+		[]string{"function_name", "priority"},
+	)
+
+	gatewayLatencyScaleUps := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gateway",
+			Subsystem: "function",
+			Name:      "latency_scale_ups_total",
+			Help:      "Scale ups requested because requests waited longer than the latency target",
+		},
+		[]string{"function_name"},
+	)
+
+	gatewayEndpointEjections := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gateway",
+			Subsystem: "function",
+			Name:      "endpoint_ejections_total",
+			Help:      "Function endpoints ejected after consecutive failures",
+		},
+		[]string{"function_name", "endpoint"},
+	)
+
+	gatewayFunctionSlowStartLimit := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "gateway",
+			Subsystem: "function",
+			Name:      "slow_start_limit",
+			Help:      "Concurrency limit of functions ramping up after a scale from zero",
+		},
+		[]string{"function_name"},
+	)
+
+	gatewayColdStartQueueDepth := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "gateway",
+			Subsystem: "cold_start",
+			Name:      "queue_depth",
+			Help:      "Cold starts waiting for the concurrent cold start limit, by namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	gatewayAdmissionRejected := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gateway",
+			Subsystem: "admission",
+			Name:      "rejected_total",
+			Help:      "Function requests rejected whilst the gateway's load was above the admission threshold",
+		},
+		[]string{"function_name"},
+	)
+
+	gatewayUpstreamConnectionClose := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gateway",
+			Subsystem: "function",
+			Name:      "upstream_connection_close_total",
+			Help:      "Function responses after which the upstream closed the connection instead of keeping it alive",
+		},
+		[]string{"function_name"},
+	)
+
+	gatewayRequestBodySeconds := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gateway",
+		Subsystem: "function",
+		Name:      "request_body_seconds",
+		Help:      "Time taken to read the request body from the client and send it to the function",
+	}, []string{"function_name"})
+
+	gatewayUpstreamWaitSeconds := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gateway",
+		Subsystem: "function",
+		Name:      "upstream_wait_seconds",
+		Help:      "Time taken for the function to respond once the request body was sent",
+	}, []string{"function_name"})
+
 	metricsOptions := MetricOptions{
 		GatewayFunctionsHistogram:        gatewayFunctionsHistogram,
 		GatewayFunctionInvocation:        gatewayFunctionInvocation,
 		ServiceReplicasGauge:             serviceReplicas,
 		GatewayFunctionInvocationStarted: gatewayFunctionInvocationStarted,
+		GatewayFunctionShed:              gatewayFunctionShed,
+		GatewayLatencyScaleUps:           gatewayLatencyScaleUps,
+		GatewayEndpointEjections:         gatewayEndpointEjections,
+		GatewayFunctionSlowStartLimit:    gatewayFunctionSlowStartLimit,
+		GatewayColdStartQueueDepth:       gatewayColdStartQueueDepth,
+		GatewayAdmissionRejected:         gatewayAdmissionRejected,
+		GatewayUpstreamConnectionClose:   gatewayUpstreamConnectionClose,
+		GatewayRequestBodySeconds:        gatewayRequestBodySeconds,
+		GatewayUpstreamWaitSeconds:       gatewayUpstreamWaitSeconds,
 	}
 
 	return metricsOptions
@@ -0,0 +1,191 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TransportMetrics instruments the HTTP transport used to proxy requests
+// to functions with connection-level metrics
+type TransportMetrics struct {
+	openConnections  int64
+	inUseConnections int64
+
+	dialDuration prometheus.Histogram
+	connections  *prometheus.CounterVec
+	open         prometheus.GaugeFunc
+	inUse        prometheus.GaugeFunc
+	idle         prometheus.GaugeFunc
+}
+
+// NewTransportMetrics creates TransportMetrics, which must be registered
+// with RegisterTransportMetrics
+func NewTransportMetrics() *TransportMetrics {
+	m := &TransportMetrics{}
+
+	m.dialDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "gateway",
+		Subsystem: "upstream",
+		Name:      "dial_seconds",
+		Help:      "Time taken to dial a new connection to the upstream",
+	})
+
+	m.connections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gateway",
+		Subsystem: "upstream",
+		Name:      "connections_total",
+		Help:      "Connections obtained for upstream requests, by whether they were reused",
+	}, []string{"reused"})
+
+	m.open = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Subsystem: "upstream",
+		Name:      "open_connections",
+		Help:      "Open connections to the upstream",
+	}, func() float64 {
+		return float64(atomic.LoadInt64(&m.openConnections))
+	})
+
+	m.inUse = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Subsystem: "upstream",
+		Name:      "in_use_connections",
+		Help:      "Connections to the upstream serving a request",
+	}, func() float64 {
+		return float64(atomic.LoadInt64(&m.inUseConnections))
+	})
+
+	m.idle = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "gateway",
+		Subsystem: "upstream",
+		Name:      "idle_connections",
+		Help:      "Open connections to the upstream which are not serving a request",
+	}, func() float64 {
+		idle := atomic.LoadInt64(&m.openConnections) - atomic.LoadInt64(&m.inUseConnections)
+		if idle < 0 {
+			return 0
+		}
+		return float64(idle)
+	})
+
+	return m
+}
+
+// Describe is to describe the metrics for Prometheus
+func (m *TransportMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.dialDuration.Describe(ch)
+	m.connections.Describe(ch)
+	m.open.Describe(ch)
+	m.inUse.Describe(ch)
+	m.idle.Describe(ch)
+}
+
+// Collect collects data to be consumed by prometheus
+func (m *TransportMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.dialDuration.Collect(ch)
+	m.connections.Collect(ch)
+	m.open.Collect(ch)
+	m.inUse.Collect(ch)
+	m.idle.Collect(ch)
+}
+
+// RegisterTransportMetrics registers with Prometheus for tracking
+func RegisterTransportMetrics(m *TransportMetrics) {
+	prometheus.MustRegister(m)
+}
+
+// Instrument wraps the dialer of transport to time dials and count open
+// connections, the returned http.RoundTripper sends requests through next,
+// which is transport or a RoundTripper which sends through it, and must be
+// used in place of next.
+func (m *TransportMetrics) Instrument(transport *http.Transport, next http.RoundTripper) http.RoundTripper {
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		start := time.Now()
+		conn, err := dial(ctx, network, addr)
+		m.dialDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			return nil, err
+		}
+
+		atomic.AddInt64(&m.openConnections, 1)
+		return &countedConn{Conn: conn, open: &m.openConnections}, nil
+	}
+
+	return &instrumentedRoundTripper{next: next, metrics: m}
+}
+
+type instrumentedRoundTripper struct {
+	next    http.RoundTripper
+	metrics *TransportMetrics
+}
+
+func (t *instrumentedRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	var gotConn int32
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			atomic.StoreInt32(&gotConn, 1)
+			atomic.AddInt64(&t.metrics.inUseConnections, 1)
+			t.metrics.connections.WithLabelValues(strconv.FormatBool(info.Reused)).Inc()
+		},
+	}
+
+	res, err := t.next.RoundTrip(r.WithContext(httptrace.WithClientTrace(r.Context(), trace)))
+
+	release := func() {
+		if atomic.CompareAndSwapInt32(&gotConn, 1, 0) {
+			atomic.AddInt64(&t.metrics.inUseConnections, -1)
+		}
+	}
+
+	if err != nil || res.Body == nil {
+		release()
+		return res, err
+	}
+
+	res.Body = &releasingBody{ReadCloser: res.Body, release: release}
+	return res, nil
+}
+
+// releasingBody marks the connection as no longer in use once the
+// response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// countedConn decrements the open connection count when closed
+type countedConn struct {
+	net.Conn
+	open   *int64
+	closed int32
+}
+
+func (c *countedConn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		atomic.AddInt64(c.open, -1)
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,59 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func Test_TransportMetrics_CountsConnections(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer upstream.Close()
+
+	m := NewTransportMetrics()
+	transport := &http.Transport{}
+	client := http.Client{Transport: m.Instrument(transport, transport)}
+
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(res.Body)
+		res.Body.Close()
+	}
+
+	newConns := &dto.Metric{}
+	m.connections.WithLabelValues("false").Write(newConns)
+	if got := newConns.GetCounter().GetValue(); got != 1 {
+		t.Errorf("new connections want: %d, got: %f", 1, got)
+	}
+
+	reusedConns := &dto.Metric{}
+	m.connections.WithLabelValues("true").Write(reusedConns)
+	if got := reusedConns.GetCounter().GetValue(); got != 2 {
+		t.Errorf("reused connections want: %d, got: %f", 2, got)
+	}
+
+	if got := readGauge(m.inUse).value; got != 0 {
+		t.Errorf("in use connections want: %d, got: %f", 0, got)
+	}
+
+	if got := readGauge(m.idle).value; got != 1 {
+		t.Errorf("idle connections want: %d, got: %f", 1, got)
+	}
+
+	dials := &dto.Metric{}
+	m.dialDuration.Write(dials)
+	if got := dials.GetHistogram().GetSampleCount(); got != 1 {
+		t.Errorf("dials want: %d, got: %d", 1, got)
+	}
+}
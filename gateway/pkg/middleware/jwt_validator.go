@@ -0,0 +1,111 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package middleware
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JWTValidator validates the signature and time-based claims of a JWT
+// signed with HS256 or RS256
+type JWTValidator struct {
+	hmacSecret []byte
+	publicKey  *rsa.PublicKey
+}
+
+// NewJWTValidator creates a JWTValidator from key, which is either a PEM
+// encoded RSA public key for RS256 or a shared secret for HS256
+func NewJWTValidator(key []byte) (*JWTValidator, error) {
+	if block, _ := pem.Decode(key); block != nil {
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse public key: %s", err)
+		}
+		publicKey, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key must be an RSA key")
+		}
+		return &JWTValidator{publicKey: publicKey}, nil
+	}
+
+	secret := []byte(strings.TrimSpace(string(key)))
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("key is empty")
+	}
+	return &JWTValidator{hmacSecret: secret}, nil
+}
+
+// Validate checks the token's signature, "exp" and "nbf" claims and returns
+// the token's claims
+func (v *JWTValidator) Validate(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header")
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("malformed token header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch {
+	case header.Alg == "HS256" && v.hmacSecret != nil:
+		mac := hmac.New(sha256.New, v.hmacSecret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, fmt.Errorf("invalid token signature")
+		}
+	case header.Alg == "RS256" && v.publicKey != nil:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(v.publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, fmt.Errorf("invalid token signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm: %q", header.Alg)
+	}
+
+	claimBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token claims")
+	}
+
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(claimBytes, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims")
+	}
+
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); ok && now >= exp {
+		return nil, fmt.Errorf("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+)
+
+func signHS256(claims string, secret string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func Test_JWTValidator_HS256(t *testing.T) {
+	validator, err := NewJWTValidator([]byte("secret\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := validator.Validate(signHS256(`{"tenant_id":"acme"}`, "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["tenant_id"] != "acme" {
+		t.Errorf("tenant_id want: %s, got: %v", "acme", claims["tenant_id"])
+	}
+}
+
+func Test_JWTValidator_Rejects(t *testing.T) {
+	validator, _ := NewJWTValidator([]byte("secret"))
+
+	scenarios := []struct {
+		name  string
+		token string
+	}{
+		{name: "wrong secret", token: signHS256(`{"tenant_id":"acme"}`, "other")},
+		{name: "expired", token: signHS256(`{"tenant_id":"acme","exp":1000}`, "secret")},
+		{name: "not yet valid", token: signHS256(`{"tenant_id":"acme","nbf":99999999999}`, "secret")},
+		{name: "malformed", token: "abc.def"},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if _, err := validator.Validate(s.token); err == nil {
+				t.Errorf("want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// FailoverHopHeader names the region a request was failed over from, a
+// request which carries it is not failed over again
+const FailoverHopHeader = "X-OpenFaaS-Failover-From"
+
+// Failover is the peer gateway a request is forwarded to in place of its
+// function
+type Failover struct {
+	// Region is the region the request is failed over from
+	Region string
+
+	// URL is the base URL of the peer region's gateway
+	URL string
+
+	// Auth adds the peer region's credentials to the request, the
+	// credentials of this region's provider are never sent to a peer
+	Auth AuthInjector
+}
+
+type failoverKey struct{}
+
+// WithFailover returns a copy of r which is forwarded to the gateway of a
+// peer region
+func WithFailover(r *http.Request, failover Failover) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), failoverKey{}, failover))
+}
+
+// GetFailover returns the peer gateway a request is to be forwarded to,
+// false when it is forwarded to its function
+func GetFailover(ctx context.Context) (Failover, bool) {
+	failover, ok := ctx.Value(failoverKey{}).(Failover)
+	return failover, ok
+}
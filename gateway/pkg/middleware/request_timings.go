@@ -0,0 +1,48 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// RequestTimings collects the time spent by the gateway on a request to a
+// function, for the Server-Timing header and the slow request log
+type RequestTimings struct {
+	// Start is when the gateway received the request
+	Start time.Time
+
+	// Scale is the time spent waiting for the function to be scaled
+	Scale time.Duration
+
+	// Connect is the time spent getting a connection to the function, which
+	// is close to 0 when an idle connection was reused
+	Connect time.Duration
+
+	// FirstByte is the time from getting a connection to the function until
+	// the first byte of its response, or until the request timed out
+	FirstByte time.Duration
+
+	// Upstream is the time spent forwarding the request to the function,
+	// until its response was written
+	Upstream time.Duration
+}
+
+type requestTimingsKey struct{}
+
+// WithRequestTimings returns a copy of r which collects RequestTimings from
+// now on
+func WithRequestTimings(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), requestTimingsKey{}, &RequestTimings{Start: time.Now()})
+	return r.WithContext(ctx)
+}
+
+// GetRequestTimings returns the RequestTimings of ctx, or nil when timings
+// are not being collected
+func GetRequestTimings(ctx context.Context) *RequestTimings {
+	timings, _ := ctx.Value(requestTimingsKey{}).(*RequestTimings)
+	return timings
+}
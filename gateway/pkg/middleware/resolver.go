@@ -7,6 +7,7 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // functionMatcher parses out the service name (group 1) and rest of path (group 2).
@@ -26,6 +27,13 @@ type BaseURLResolver interface {
 	BuildURL(function, namespace, healthPath string, directFunctions bool) string
 }
 
+// EndpointReporter is implemented by a BaseURLResolver which balances requests
+// over several endpoints, Report is called once the request sent to a base URL
+// returned by Resolve has completed, with its status code and duration
+type EndpointReporter interface {
+	Report(r *http.Request, baseURL string, statusCode int, duration time.Duration)
+}
+
 // URLPathTransformer Transform the incoming URL path for upstream requests
 type URLPathTransformer interface {
 	Transform(r *http.Request) string
@@ -0,0 +1,82 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TrailingSlashAnnotation normalizes the trailing slash of a function's
+// request paths, it replaces the gateway's mode for the function
+const TrailingSlashAnnotation = "com.openfaas.trailing-slash"
+
+// Trailing slash modes
+const (
+	// TrailingSlashPreserve passes the path through as it was requested
+	TrailingSlashPreserve = "preserve"
+
+	// TrailingSlashStrip removes trailing slashes, i.e. /function/foo/ is
+	// forwarded as /function/foo
+	TrailingSlashStrip = "strip"
+
+	// TrailingSlashAdd adds a trailing slash, i.e. /function/foo is
+	// forwarded as /function/foo/
+	TrailingSlashAdd = "add"
+)
+
+// AnnotationReader reads the annotations of a function
+type AnnotationReader interface {
+	GetAnnotations(name string, namespace string) (map[string]string, error)
+}
+
+// TrailingSlashURLPathTransformer normalizes the trailing slash of the path
+// returned by Transformer, so that functions see a single form of each path.
+type TrailingSlashURLPathTransformer struct {
+	Transformer URLPathTransformer
+
+	// Mode is used for functions without the com.openfaas.trailing-slash
+	// annotation, the path is preserved when empty
+	Mode string
+
+	// Annotations when set, reads the mode for each function
+	Annotations      AnnotationReader
+	DefaultNamespace string
+}
+
+// Transform returns the path from Transformer with its trailing slash
+// stripped or added. An empty path, or the root path, is left untouched.
+func (f TrailingSlashURLPathTransformer) Transform(r *http.Request) string {
+	p := f.Transformer.Transform(r)
+	if len(p) == 0 || p == "/" {
+		return p
+	}
+
+	switch f.mode(r) {
+	case TrailingSlashStrip:
+		if trimmed := strings.TrimRight(p, "/"); len(trimmed) > 0 {
+			return trimmed
+		}
+		return "/"
+	case TrailingSlashAdd:
+		if !strings.HasSuffix(p, "/") {
+			return p + "/"
+		}
+	}
+	return p
+}
+
+func (f TrailingSlashURLPathTransformer) mode(r *http.Request) string {
+	if f.Annotations != nil {
+		functionName, namespace := GetNamespace(f.DefaultNamespace, GetServiceName(r.URL.String()))
+		if len(functionName) > 0 {
+			if annotations, err := f.Annotations.GetAnnotations(functionName, namespace); err == nil {
+				if value, ok := annotations[TrailingSlashAnnotation]; ok {
+					return strings.TrimSpace(value)
+				}
+			}
+		}
+	}
+	return f.Mode
+}
@@ -0,0 +1,101 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type fakeAnnotationReader map[string]map[string]string
+
+func (f fakeAnnotationReader) GetAnnotations(name string, namespace string) (map[string]string, error) {
+	annotations, ok := f[name+"."+namespace]
+	if !ok {
+		return nil, fmt.Errorf("function %s.%s not found", name, namespace)
+	}
+	return annotations, nil
+}
+
+func Test_TrailingSlash_Strip(t *testing.T) {
+	transformer := TrailingSlashURLPathTransformer{
+		Transformer: TransparentURLPathTransformer{},
+		Mode:        TrailingSlashStrip,
+	}
+
+	cases := map[string]string{
+		"/function/figlet":             "/function/figlet",
+		"/function/figlet/":            "/function/figlet",
+		"/function/figlet/employees//": "/function/figlet/employees",
+		"/":                            "/",
+	}
+
+	for path, want := range cases {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		if got := transformer.Transform(req); got != want {
+			t.Errorf("%s want: %s, got: %s", path, want, got)
+		}
+	}
+}
+
+func Test_TrailingSlash_Add(t *testing.T) {
+	transformer := TrailingSlashURLPathTransformer{
+		Transformer: FunctionPrefixTrimmingURLPathTransformer{},
+		Mode:        TrailingSlashAdd,
+	}
+
+	cases := map[string]string{
+		"/function/figlet":            "",
+		"/function/figlet/employees":  "/employees/",
+		"/function/figlet/employees/": "/employees/",
+	}
+
+	for path, want := range cases {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		if got := transformer.Transform(req); got != want {
+			t.Errorf("%s want: %q, got: %q", path, want, got)
+		}
+	}
+}
+
+func Test_TrailingSlash_PreservedByDefault(t *testing.T) {
+	transformer := TrailingSlashURLPathTransformer{
+		Transformer: TransparentURLPathTransformer{},
+	}
+
+	for _, path := range []string{"/function/figlet", "/function/figlet/"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		if got := transformer.Transform(req); got != path {
+			t.Errorf("want: %s, got: %s", path, got)
+		}
+	}
+}
+
+func Test_TrailingSlash_AnnotationReplacesMode(t *testing.T) {
+	transformer := TrailingSlashURLPathTransformer{
+		Transformer: TransparentURLPathTransformer{},
+		Mode:        TrailingSlashStrip,
+		Annotations: fakeAnnotationReader{
+			"figlet.openfaas-fn":   {TrailingSlashAnnotation: "add"},
+			"env.dev":              {TrailingSlashAnnotation: "preserve"},
+			"nodeinfo.openfaas-fn": {},
+		},
+		DefaultNamespace: "openfaas-fn",
+	}
+
+	cases := map[string]string{
+		"/function/figlet/api":   "/function/figlet/api/",
+		"/function/env.dev/api/": "/function/env.dev/api/",
+		"/function/nodeinfo/":    "/function/nodeinfo",
+		"/function/missing/":     "/function/missing",
+	}
+
+	for path, want := range cases {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		if got := transformer.Transform(req); got != want {
+			t.Errorf("%s want: %s, got: %s", path, want, got)
+		}
+	}
+}
@@ -5,7 +5,9 @@ package plugin
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -63,7 +65,7 @@ func (s ExternalServiceQuery) GetReplicas(serviceName, serviceNamespace string)
 	var err error
 	var emptyServiceQueryResponse scaling.ServiceQueryResponse
 
-	function := types.FunctionStatus{}
+	function := functionStatus{}
 
 	urlPath := fmt.Sprintf("%ssystem/function/%s?namespace=%s&usage=%v",
 		s.URL.String(),
@@ -103,6 +105,9 @@ func (s ExternalServiceQuery) GetReplicas(serviceName, serviceNamespace string)
 
 	} else {
 		log.Printf("GetReplicas [%s.%s] took: %.4fs, code: %d\n", serviceName, serviceNamespace, time.Since(start).Seconds(), res.StatusCode)
+		if res.StatusCode == http.StatusNotFound {
+			return emptyServiceQueryResponse, fmt.Errorf("server returned non-200 status code (%d) for function, %s, body: %s: %w", res.StatusCode, serviceName, string(bytesOut), scaling.ErrFunctionNotFound)
+		}
 		return emptyServiceQueryResponse, fmt.Errorf("server returned non-200 status code (%d) for function, %s, body: %s", res.StatusCode, serviceName, string(bytesOut))
 	}
 
@@ -126,15 +131,28 @@ func (s ExternalServiceQuery) GetReplicas(serviceName, serviceNamespace string)
 	}
 
 	return scaling.ServiceQueryResponse{
-		Replicas:          function.Replicas,
-		MaxReplicas:       maxReplicas,
-		MinReplicas:       minReplicas,
-		ScalingFactor:     scalingFactor,
-		AvailableReplicas: availableReplicas,
-		Annotations:       function.Annotations,
+		Replicas:              function.Replicas,
+		MaxReplicas:           maxReplicas,
+		MinReplicas:           minReplicas,
+		ScalingFactor:         scalingFactor,
+		AvailableReplicas:     availableReplicas,
+		Annotations:           function.Annotations,
+		UnschedulableReplicas: function.UnschedulableReplicas,
 	}, err
 }
 
+// functionStatus is a function's status from the provider.
+// unschedulableReplicas is not part of the faas-provider API, it is an
+// optional extension which a provider may add to the status of
+// GET /system/function/{name} with the number of replicas it cannot place,
+// such as those pending for lack of capacity. Providers without it report 0
+// and their functions are never failed over to a peer region.
+type functionStatus struct {
+	types.FunctionStatus
+
+	UnschedulableReplicas uint64 `json:"unschedulableReplicas,omitempty"`
+}
+
 // SetReplicas update the replica count
 func (s ExternalServiceQuery) SetReplicas(serviceName, serviceNamespace string, count uint64) error {
 	var err error
@@ -178,6 +196,66 @@ func (s ExternalServiceQuery) SetReplicas(serviceName, serviceNamespace string,
 	return err
 }
 
+// ListFunctions lists the functions in every namespace from the provider, or
+// in its default namespace when it does not list namespaces
+func (s ExternalServiceQuery) ListFunctions(ctx context.Context) ([]scaling.FunctionRef, error) {
+	namespaces := []string{}
+	if err := s.getJSON(ctx, fmt.Sprintf("%ssystem/namespaces", s.URL.String()), &namespaces); err != nil && !errors.Is(err, errNotFound) {
+		return nil, err
+	}
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+
+	functions := []scaling.FunctionRef{}
+	for _, namespace := range namespaces {
+		statuses := []types.FunctionStatus{}
+		urlPath := fmt.Sprintf("%ssystem/functions?namespace=%s", s.URL.String(), url.QueryEscape(namespace))
+		if err := s.getJSON(ctx, urlPath, &statuses); err != nil {
+			return nil, err
+		}
+
+		for _, status := range statuses {
+			functions = append(functions, scaling.FunctionRef{Name: status.Name, Namespace: status.Namespace})
+		}
+	}
+	return functions, nil
+}
+
+// errNotFound is returned by getJSON for a 404 Not Found
+var errNotFound = errors.New("not found")
+
+// getJSON reads the JSON body of a GET request to urlPath into out
+func (s ExternalServiceQuery) getJSON(ctx context.Context, urlPath string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlPath, nil)
+	if err != nil {
+		return err
+	}
+
+	if s.AuthInjector != nil {
+		s.AuthInjector.Inject(req)
+	}
+
+	res, err := s.ProxyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	bytesOut, _ := io.ReadAll(res.Body)
+	if res.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned non-200 status code (%d) for %s, body: %s", res.StatusCode, urlPath, string(bytesOut))
+	}
+
+	if err := json.Unmarshal(bytesOut, out); err != nil {
+		return fmt.Errorf("unable to unmarshal: %q, %s", string(bytesOut), err)
+	}
+	return nil
+}
+
 // extractLabelValue will parse the provided raw label value and if it fails
 // it will return the provided fallback value and log an message
 func extractLabelValue(rawLabelValue string, fallback uint64) uint64 {
@@ -1,9 +1,12 @@
 package plugin
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -58,6 +61,9 @@ func TestGetReplicasNonExistentFn(t *testing.T) {
 		t.Logf("Error was nil, expected non-nil - the service query response value was %+v ", svcQryResp)
 		t.Fail()
 	}
+	if !errors.Is(err, scaling.ErrFunctionNotFound) {
+		t.Errorf("want ErrFunctionNotFound, got: %v", err)
+	}
 }
 
 func TestGetReplicasExistentFn(t *testing.T) {
@@ -136,3 +142,58 @@ func TestSetReplicasExistentFn(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestListFunctionsInEachNamespace(t *testing.T) {
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/system/namespaces":
+				res.Write([]byte(`["openfaas-fn","dev"]`))
+			case "/system/functions":
+				namespace := req.URL.Query().Get("namespace")
+				res.Write([]byte(`[{"name":"figlet","namespace":"` + namespace + `"}]`))
+			default:
+				res.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL + "/")
+	esq := NewExternalServiceQuery(*url, nil).(ExternalServiceQuery)
+
+	functions, err := esq.ListFunctions(context.Background())
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+
+	want := []scaling.FunctionRef{
+		{Name: "figlet", Namespace: "openfaas-fn"},
+		{Name: "figlet", Namespace: "dev"},
+	}
+	if !reflect.DeepEqual(functions, want) {
+		t.Errorf("want: %v, got: %v", want, functions)
+	}
+}
+
+func TestListFunctionsWithoutNamespaces(t *testing.T) {
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/system/functions" {
+				res.Write([]byte(`[{"name":"figlet"},{"name":"echo"}]`))
+				return
+			}
+			res.WriteHeader(http.StatusNotFound)
+		}))
+	defer testServer.Close()
+
+	url, _ := url.Parse(testServer.URL + "/")
+	esq := NewExternalServiceQuery(*url, nil).(ExternalServiceQuery)
+
+	functions, err := esq.ListFunctions(context.Background())
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+	if len(functions) != 2 || functions[0].Name != "figlet" || functions[1].Name != "echo" {
+		t.Errorf("want figlet and echo, got: %v", functions)
+	}
+}
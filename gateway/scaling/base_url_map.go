@@ -0,0 +1,64 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+// maxCachedBaseURLMaps bounds the cache of parsed annotations, which is
+// cleared when full
+const maxCachedBaseURLMaps = 1024
+
+// baseURLMap parses annotations which map keys to base URLs, i.e.
+// "eu-west=http://gw.eu:8080,us-east=http://gw.us:8080", and caches them by
+// their value
+type baseURLMap struct {
+	annotation string
+	parsed     map[string]map[string]string
+	lock       *sync.RWMutex
+}
+
+func newBaseURLMap(annotation string) baseURLMap {
+	return baseURLMap{
+		annotation: annotation,
+		parsed:     make(map[string]map[string]string),
+		lock:       &sync.RWMutex{},
+	}
+}
+
+// parse returns the key to base URL mapping of an annotation, entries
+// without a key or URL are skipped
+func (m baseURLMap) parse(value string) map[string]string {
+	m.lock.RLock()
+	baseURLs, ok := m.parsed[value]
+	m.lock.RUnlock()
+	if ok {
+		return baseURLs
+	}
+
+	baseURLs = map[string]string{}
+	for _, entry := range strings.Split(value, ",") {
+		key, baseURL, _ := strings.Cut(entry, "=")
+		key, baseURL = strings.TrimSpace(key), strings.TrimSpace(baseURL)
+		if len(key) == 0 || len(baseURL) == 0 {
+			log.Printf("Ignoring invalid entry %q in %s\n", entry, m.annotation)
+			continue
+		}
+		baseURLs[key] = strings.TrimSuffix(baseURL, "/")
+	}
+
+	m.lock.Lock()
+	if len(m.parsed) >= maxCachedBaseURLMaps {
+		for cached := range m.parsed {
+			delete(m.parsed, cached)
+		}
+	}
+	m.parsed[value] = baseURLs
+	m.lock.Unlock()
+
+	return baseURLs
+}
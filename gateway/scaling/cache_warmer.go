@@ -0,0 +1,142 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// FunctionRef is the name and namespace of a deployed function
+type FunctionRef struct {
+	Name      string
+	Namespace string
+}
+
+// FunctionLister lists the functions deployed by the provider
+type FunctionLister interface {
+	ListFunctions(ctx context.Context) ([]FunctionRef, error)
+}
+
+// CacheWarmer pre-populates function caches after the gateway starts, so
+// that the first request for each function does not wait for a lookup from
+// the provider. The lookups are spread out by Concurrency and Rate rather
+// than sent all at once.
+type CacheWarmer struct {
+	Lister FunctionLister
+	Query  ServiceQuery
+
+	// Caches are each set with the result of a function's lookup
+	Caches []FunctionCacher
+
+	// DefaultNamespace is used for functions listed without a namespace
+	DefaultNamespace string
+
+	// Concurrency is the most lookups in flight at once, 1 when not set
+	Concurrency int
+
+	// Rate is the most lookups started per second, unlimited when 0
+	Rate int
+}
+
+// Warm looks up every function which is not in all of the caches already
+// and returns how many were cached. A failed lookup is logged and skipped,
+// an error is only returned when the functions cannot be listed.
+func (w *CacheWarmer) Warm(ctx context.Context) (int, error) {
+	functions, err := w.Lister.ListFunctions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var throttle <-chan time.Time
+	if w.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(w.Rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	work := make(chan FunctionRef)
+	var warmed int
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for function := range work {
+				if w.warm(function) {
+					lock.Lock()
+					warmed++
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+
+	err = w.dispatch(ctx, functions, throttle, work)
+	close(work)
+	wg.Wait()
+
+	return warmed, err
+}
+
+// dispatch sends the functions which are not cached to work, at most one
+// for each tick of throttle when it is set
+func (w *CacheWarmer) dispatch(ctx context.Context, functions []FunctionRef, throttle <-chan time.Time, work chan<- FunctionRef) error {
+	first := true
+	for _, function := range functions {
+		if len(function.Namespace) == 0 {
+			function.Namespace = w.DefaultNamespace
+		}
+		if w.cached(function) {
+			continue
+		}
+
+		if throttle != nil && !first {
+			select {
+			case <-throttle:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		first = false
+
+		select {
+		case work <- function:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (w *CacheWarmer) cached(function FunctionRef) bool {
+	for _, cache := range w.Caches {
+		if _, hit := cache.Get(function.Name, function.Namespace); !hit {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *CacheWarmer) warm(function FunctionRef) bool {
+	res, err := w.Query.GetReplicas(function.Name, function.Namespace)
+	if err != nil {
+		log.Printf("Cache warming: unable to look up %s.%s: %s\n", function.Name, function.Namespace, err)
+		return false
+	}
+
+	for _, cache := range w.Caches {
+		cache.Set(function.Name, function.Namespace, res)
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeFunctionLister struct {
+	functions []FunctionRef
+	err       error
+}
+
+func (f fakeFunctionLister) ListFunctions(ctx context.Context) ([]FunctionRef, error) {
+	return f.functions, f.err
+}
+
+// countingServiceQuery counts lookups and the most which were in flight
+type countingServiceQuery struct {
+	lock        sync.Mutex
+	lookups     map[string]int
+	inFlight    int
+	maxInFlight int
+	delay       time.Duration
+	missing     string
+}
+
+func (q *countingServiceQuery) GetReplicas(service, namespace string) (ServiceQueryResponse, error) {
+	q.lock.Lock()
+	q.lookups[service+"."+namespace]++
+	q.inFlight++
+	if q.inFlight > q.maxInFlight {
+		q.maxInFlight = q.inFlight
+	}
+	q.lock.Unlock()
+
+	time.Sleep(q.delay)
+
+	q.lock.Lock()
+	q.inFlight--
+	q.lock.Unlock()
+
+	if service == q.missing {
+		return ServiceQueryResponse{}, fmt.Errorf("not found")
+	}
+	return ServiceQueryResponse{Replicas: 1, AvailableReplicas: 1}, nil
+}
+
+func (q *countingServiceQuery) SetReplicas(service, namespace string, count uint64) error {
+	return nil
+}
+
+func Test_CacheWarmer_CachesListedFunctions(t *testing.T) {
+	query := &countingServiceQuery{lookups: map[string]int{}, missing: "gone"}
+	annotations, replicas := NewFunctionCache(time.Minute), NewFunctionCache(time.Minute)
+
+	warmer := &CacheWarmer{
+		Lister: fakeFunctionLister{functions: []FunctionRef{
+			{Name: "figlet", Namespace: "openfaas-fn"},
+			{Name: "echo"},
+			{Name: "env", Namespace: "dev"},
+			{Name: "gone", Namespace: "openfaas-fn"},
+		}},
+		Query:            query,
+		Caches:           []FunctionCacher{annotations, replicas},
+		DefaultNamespace: "openfaas-fn",
+		Concurrency:      2,
+	}
+
+	warmed, err := warmer.Warm(context.Background())
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+	if warmed != 3 {
+		t.Errorf("warmed want: %d, got: %d", 3, warmed)
+	}
+
+	for _, function := range []FunctionRef{{"figlet", "openfaas-fn"}, {"echo", "openfaas-fn"}, {"env", "dev"}} {
+		for _, cache := range []FunctionCacher{annotations, replicas} {
+			if res, hit := cache.Get(function.Name, function.Namespace); !hit || res.AvailableReplicas != 1 {
+				t.Errorf("want %s.%s to be cached, hit: %t", function.Name, function.Namespace, hit)
+			}
+		}
+	}
+	if _, hit := annotations.Get("gone", "openfaas-fn"); hit {
+		t.Errorf("want a failed lookup not to be cached")
+	}
+}
+
+func Test_CacheWarmer_SkipsCachedFunctions(t *testing.T) {
+	query := &countingServiceQuery{lookups: map[string]int{}}
+	cache := NewFunctionCache(time.Minute)
+	cache.Set("figlet", "openfaas-fn", ServiceQueryResponse{Replicas: 2})
+
+	warmer := &CacheWarmer{
+		Lister: fakeFunctionLister{functions: []FunctionRef{
+			{Name: "figlet", Namespace: "openfaas-fn"},
+			{Name: "echo", Namespace: "openfaas-fn"},
+		}},
+		Query:  query,
+		Caches: []FunctionCacher{cache},
+	}
+
+	if warmed, _ := warmer.Warm(context.Background()); warmed != 1 {
+		t.Errorf("warmed want: %d, got: %d", 1, warmed)
+	}
+	if query.lookups["figlet.openfaas-fn"] != 0 {
+		t.Errorf("want a cached function not to be looked up")
+	}
+	if res, _ := cache.Get("figlet", "openfaas-fn"); res.Replicas != 2 {
+		t.Errorf("want the cached entry to be kept, got replicas: %d", res.Replicas)
+	}
+}
+
+func Test_CacheWarmer_LimitsConcurrencyAndRate(t *testing.T) {
+	query := &countingServiceQuery{lookups: map[string]int{}, delay: time.Millisecond * 20}
+
+	functions := []FunctionRef{}
+	for i := 0; i < 8; i++ {
+		functions = append(functions, FunctionRef{Name: fmt.Sprintf("fn-%d", i), Namespace: "openfaas-fn"})
+	}
+
+	warmer := &CacheWarmer{
+		Lister:      fakeFunctionLister{functions: functions},
+		Query:       query,
+		Caches:      []FunctionCacher{NewFunctionCache(time.Minute)},
+		Concurrency: 2,
+		Rate:        200,
+	}
+
+	start := time.Now()
+	if warmed, _ := warmer.Warm(context.Background()); warmed != 8 {
+		t.Errorf("warmed want: %d, got: %d", 8, warmed)
+	}
+
+	if query.maxInFlight > 2 {
+		t.Errorf("lookups in flight want at most: %d, got: %d", 2, query.maxInFlight)
+	}
+
+	// 8 lookups at 200 per second take at least 35ms to start
+	if elapsed := time.Since(start); elapsed < time.Millisecond*35 {
+		t.Errorf("want lookups to be rate limited, took: %s", elapsed)
+	}
+}
+
+func Test_CacheWarmer_ListError(t *testing.T) {
+	warmer := &CacheWarmer{
+		Lister: fakeFunctionLister{err: fmt.Errorf("provider unavailable")},
+		Query:  &countingServiceQuery{lookups: map[string]int{}},
+		Caches: []FunctionCacher{NewFunctionCache(time.Minute)},
+	}
+
+	if _, err := warmer.Warm(context.Background()); err == nil {
+		t.Errorf("want an error when functions cannot be listed")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ColdStartThresholdAnnotation is how long a request waits for a function to
+// become ready before the client is told to poll instead, whilst the function
+// continues to scale in the background. Requests block until the function is
+// ready when the annotation is not set.
+const ColdStartThresholdAnnotation = "com.openfaas.scale.cold-start-threshold"
+
+// ColdStartThreshold reads the threshold from a function's annotations, 0
+// when the function has not opted-in
+func ColdStartThreshold(annotations map[string]string) time.Duration {
+	threshold, err := time.ParseDuration(strings.TrimSpace(annotations[ColdStartThresholdAnnotation]))
+	if err != nil || threshold <= 0 {
+		return 0
+	}
+	return threshold
+}
+
+// ScaleWithin scales a function in the same way as ScaleWithPriority, but
+// gives up waiting after threshold and returns false. The scale carries on in
+// the background and is shared by every caller for the same function, so
+// polling clients do not start another one. When ctx is done first, its
+// error is returned without waiting for the scale.
+func (f *FunctionScaler) ScaleWithin(ctx context.Context, functionName, namespace string, threshold time.Duration, priority string) (FunctionScaleResult, bool) {
+	coldStartKey := fmt.Sprintf("ColdStart-%s.%s", functionName, namespace)
+	ch := f.SingleFlight.DoChan(coldStartKey, func() (interface{}, error) {
+		return f.ScaleWithPriority(context.Background(), functionName, namespace, 0, priority), nil
+	})
+
+	timer := time.NewTimer(threshold)
+	defer timer.Stop()
+
+	select {
+	case res := <-ch:
+		return res.Val.(FunctionScaleResult), true
+	case <-timer.C:
+		return FunctionScaleResult{}, false
+	case <-ctx.Done():
+		return FunctionScaleResult{Error: ctx.Err(), Found: true}, true
+	}
+}
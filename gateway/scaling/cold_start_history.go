@@ -0,0 +1,137 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"sync"
+	"time"
+)
+
+// ColdStartHistory keeps the durations of the recent cold starts of each
+// function, so that clients told to poll during a cold start can be given
+// an estimate of when the function will be ready
+type ColdStartHistory struct {
+	size int
+
+	lock      sync.Mutex
+	functions map[string]*coldStartRecord
+}
+
+type coldStartRecord struct {
+	// durations is a ring of the last size cold starts
+	durations []time.Duration
+	next      int
+
+	// started is when the cold start in progress began, shared by the
+	// inFlight callers waiting for it
+	started  time.Time
+	inFlight int
+}
+
+// NewColdStartHistory keeps the last size cold starts of each function, at
+// least one
+func NewColdStartHistory(size int) *ColdStartHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &ColdStartHistory{
+		size:      size,
+		functions: make(map[string]*coldStartRecord),
+	}
+}
+
+// Begin marks a caller waiting for the cold start of key, the function's
+// name.namespace. Every Begin must be followed by an End.
+func (h *ColdStartHistory) Begin(key string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	record := h.record(key)
+	if record.inFlight == 0 {
+		record.started = time.Now()
+	}
+	record.inFlight++
+}
+
+// End marks a caller which is no longer waiting for the cold start of key
+func (h *ColdStartHistory) End(key string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	record, ok := h.functions[key]
+	if !ok || record.inFlight == 0 {
+		return
+	}
+	record.inFlight--
+	if record.inFlight == 0 {
+		record.started = time.Time{}
+	}
+}
+
+// Record adds a completed cold start of key which took duration
+func (h *ColdStartHistory) Record(key string, duration time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	record := h.record(key)
+	if len(record.durations) < h.size {
+		record.durations = append(record.durations, duration)
+		return
+	}
+	record.durations[record.next] = duration
+	record.next = (record.next + 1) % h.size
+}
+
+// Average returns the average duration of the recent cold starts of key,
+// false when none have been recorded
+func (h *ColdStartHistory) Average(key string) (time.Duration, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	record, ok := h.functions[key]
+	if !ok || len(record.durations) == 0 {
+		return 0, false
+	}
+	return record.average(), true
+}
+
+// Remaining estimates how long the cold start of key in progress will take
+// to complete, from the average of its recent cold starts less the time it
+// has taken so far. It is 0 once the average has been passed, and false
+// when there is no history to estimate from.
+func (h *ColdStartHistory) Remaining(key string) (time.Duration, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	record, ok := h.functions[key]
+	if !ok || len(record.durations) == 0 {
+		return 0, false
+	}
+
+	remaining := record.average()
+	if record.inFlight > 0 {
+		remaining -= time.Since(record.started)
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+func (h *ColdStartHistory) record(key string) *coldStartRecord {
+	record, ok := h.functions[key]
+	if !ok {
+		record = &coldStartRecord{}
+		h.functions[key] = record
+	}
+	return record
+}
+
+func (r *coldStartRecord) average() time.Duration {
+	var total time.Duration
+	for _, duration := range r.durations {
+		total += duration
+	}
+	return total / time.Duration(len(r.durations))
+}
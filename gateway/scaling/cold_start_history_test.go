@@ -0,0 +1,63 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ColdStartHistory_NoHistory(t *testing.T) {
+	h := NewColdStartHistory(3)
+	h.Begin("figlet.openfaas-fn")
+	defer h.End("figlet.openfaas-fn")
+
+	if _, ok := h.Average("figlet.openfaas-fn"); ok {
+		t.Errorf("want no average without history")
+	}
+	if _, ok := h.Remaining("figlet.openfaas-fn"); ok {
+		t.Errorf("want no estimate without history")
+	}
+}
+
+func Test_ColdStartHistory_AverageOfRecent(t *testing.T) {
+	h := NewColdStartHistory(3)
+	for _, seconds := range []int{10, 1, 2, 3} {
+		h.Record("figlet.openfaas-fn", time.Duration(seconds)*time.Second)
+	}
+
+	got, ok := h.Average("figlet.openfaas-fn")
+	if !ok || got != time.Second*2 {
+		t.Errorf("average want: %s, got: %s", time.Second*2, got)
+	}
+	if _, ok := h.Average("env.openfaas-fn"); ok {
+		t.Errorf("want no average for another function")
+	}
+}
+
+func Test_ColdStartHistory_Remaining(t *testing.T) {
+	h := NewColdStartHistory(3)
+	h.Record("figlet.openfaas-fn", time.Second*2)
+
+	// Without a cold start in progress, the estimate is the average
+	if got, ok := h.Remaining("figlet.openfaas-fn"); !ok || got != time.Second*2 {
+		t.Errorf("remaining want: %s, got: %s", time.Second*2, got)
+	}
+
+	h.Begin("figlet.openfaas-fn")
+	time.Sleep(time.Millisecond * 20)
+	got, ok := h.Remaining("figlet.openfaas-fn")
+	if !ok || got > time.Second*2-time.Millisecond*20 || got < time.Second {
+		t.Errorf("remaining want just under %s, got: %s", time.Second*2, got)
+	}
+	h.End("figlet.openfaas-fn")
+
+	h.Record("slow.openfaas-fn", time.Millisecond)
+	h.Begin("slow.openfaas-fn")
+	defer h.End("slow.openfaas-fn")
+	time.Sleep(time.Millisecond * 5)
+	if got, _ := h.Remaining("slow.openfaas-fn"); got != 0 {
+		t.Errorf("remaining want: 0 once the average has passed, got: %s", got)
+	}
+}
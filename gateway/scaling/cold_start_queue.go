@@ -0,0 +1,290 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ScalePriorityAnnotation is the priority of a function's cold starts when
+// the concurrent cold start limit is reached: "low", "normal" or "high"
+const ScalePriorityAnnotation = "com.openfaas.scale.priority"
+
+// Cold start priorities, higher priorities are admitted first
+const (
+	PriorityLow = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+// ParsePriority reads "low", "normal" or "high", false for any other value
+func ParsePriority(value string) (int, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "low":
+		return PriorityLow, true
+	case "normal":
+		return PriorityNormal, true
+	case "high":
+		return PriorityHigh, true
+	}
+	return PriorityNormal, false
+}
+
+// ColdStartQueue limits how many functions are scaled from zero at once.
+// Functions over the limit wait in a queue which is shared fairly between
+// namespaces, by weighted fair queuing, so that a burst of cold starts in one
+// namespace cannot starve the functions of another. Within a namespace
+// functions are ordered by priority, then by arrival. A waiting function
+// gains one priority for every aging period it has waited, so that low
+// priority functions are not starved by a steady stream of high priority ones.
+type ColdStartQueue struct {
+	limit int
+	aging time.Duration
+
+	// NamespaceWeights is the share of the cold starts given to a namespace
+	// whilst others are waiting, a namespace without a weight has 1
+	NamespaceWeights map[string]int
+
+	// NamespaceLimits caps the concurrent cold starts of a namespace below
+	// the global limit
+	NamespaceLimits map[string]int
+
+	// QueueDepth when set, is the amount of callers waiting per namespace
+	QueueDepth *prometheus.GaugeVec
+
+	lock       sync.Mutex
+	active     map[string]int
+	namespaces map[string]*coldStartNamespace
+	waiting    []*coldStartWaiter
+
+	// virtual is the start tag of the last cold start admitted, a namespace
+	// with nothing waiting does not bank a share below it
+	virtual float64
+}
+
+type coldStartNamespace struct {
+	active  int
+	waiting int
+
+	// finish is the virtual finish tag of the namespace's last cold start
+	finish float64
+}
+
+type coldStartWaiter struct {
+	key       string
+	namespace string
+	priority  int
+	queued    time.Time
+	ready     chan struct{}
+}
+
+// NewColdStartQueue allows limit concurrent cold starts, aging of 0 disables
+// starvation avoidance
+func NewColdStartQueue(limit int, aging time.Duration) *ColdStartQueue {
+	return &ColdStartQueue{
+		limit:      limit,
+		aging:      aging,
+		active:     make(map[string]int),
+		namespaces: make(map[string]*coldStartNamespace),
+	}
+}
+
+// Acquire blocks until the cold start for key, the function's name.namespace,
+// may proceed, or ctx is done and its error is returned. Callers for a
+// function which is already being scaled share its place and are admitted
+// straight away. Every successful Acquire must be followed by a Release.
+func (q *ColdStartQueue) Acquire(ctx context.Context, key string, priority int) error {
+	q.lock.Lock()
+	if _, ok := q.active[key]; ok {
+		q.active[key]++
+		q.lock.Unlock()
+		return nil
+	}
+
+	_, namespace, _ := strings.Cut(key, ".")
+	waiter := &coldStartWaiter{
+		key:       key,
+		namespace: namespace,
+		priority:  priority,
+		queued:    time.Now(),
+		ready:     make(chan struct{}),
+	}
+	q.waiting = append(q.waiting, waiter)
+	q.namespace(namespace).waiting++
+	q.dispatch()
+	q.reportDepth(namespace)
+	q.lock.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.lock.Lock()
+	for i, queued := range q.waiting {
+		if queued == waiter {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			q.namespaces[namespace].waiting--
+			q.reportDepth(namespace)
+			q.removeIdle(namespace)
+			q.lock.Unlock()
+			return ctx.Err()
+		}
+	}
+	q.lock.Unlock()
+
+	// Admitted whilst ctx was done, so give the place to the next waiter
+	q.Release(key)
+	return ctx.Err()
+}
+
+// Release ends a cold start for key and admits the next function when the
+// last caller for key has released it
+func (q *ColdStartQueue) Release(key string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.active[key]--
+	if q.active[key] > 0 {
+		return
+	}
+	delete(q.active, key)
+
+	_, namespace, _ := strings.Cut(key, ".")
+	if ns, ok := q.namespaces[namespace]; ok {
+		ns.active--
+	}
+
+	q.dispatch()
+	q.removeIdle(namespace)
+}
+
+// Queued returns the amount of callers waiting to be admitted
+func (q *ColdStartQueue) Queued() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.waiting)
+}
+
+// Position returns the approximate place of key in the queue by arrival, 1
+// for the next function to be admitted, and true whilst key is waiting. It is
+// 0 and false once key has been admitted, or when it is not queued.
+func (q *ColdStartQueue) Position(key string) (int, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, ok := q.active[key]; ok {
+		return 0, false
+	}
+
+	ahead := map[string]bool{}
+	for _, waiter := range q.waiting {
+		if waiter.key == key {
+			return len(ahead) + 1, true
+		}
+		ahead[waiter.key] = true
+	}
+	return 0, false
+}
+
+// dispatch admits waiting functions until the limit is reached, or every
+// namespace with waiters is at its own limit
+func (q *ColdStartQueue) dispatch() {
+	now := time.Now()
+	for len(q.active) < q.limit {
+		next := q.next(now)
+		if next < 0 {
+			return
+		}
+		key, namespace := q.waiting[next].key, q.waiting[next].namespace
+
+		ns := q.namespaces[namespace]
+		start := math.Max(ns.finish, q.virtual)
+		q.virtual = start
+		ns.finish = start + 1/float64(q.weight(namespace))
+		ns.active++
+
+		remaining := q.waiting[:0]
+		for _, waiter := range q.waiting {
+			if waiter.key == key {
+				q.active[key]++
+				ns.waiting--
+				close(waiter.ready)
+				continue
+			}
+			remaining = append(remaining, waiter)
+		}
+		for i := len(remaining); i < len(q.waiting); i++ {
+			q.waiting[i] = nil
+		}
+		q.waiting = remaining
+		q.reportDepth(namespace)
+	}
+}
+
+// next returns the index of the waiter to admit, or -1 when none can be.
+// The namespace with the earliest virtual start tag goes first, then the
+// waiter with the highest priority after aging, then the earliest arrival.
+func (q *ColdStartQueue) next(now time.Time) int {
+	best, bestStart, bestPriority := -1, 0.0, 0
+	for i, waiter := range q.waiting {
+		ns := q.namespaces[waiter.namespace]
+		if limit := q.NamespaceLimits[waiter.namespace]; limit > 0 && ns.active >= limit {
+			continue
+		}
+
+		start := math.Max(ns.finish, q.virtual)
+		priority := waiter.priority
+		if q.aging > 0 {
+			priority += int(now.Sub(waiter.queued) / q.aging)
+		}
+
+		if best < 0 || start < bestStart || (start == bestStart && priority > bestPriority) {
+			best, bestStart, bestPriority = i, start, priority
+		}
+	}
+	return best
+}
+
+func (q *ColdStartQueue) namespace(namespace string) *coldStartNamespace {
+	ns, ok := q.namespaces[namespace]
+	if !ok {
+		ns = &coldStartNamespace{}
+		q.namespaces[namespace] = ns
+	}
+	return ns
+}
+
+func (q *ColdStartQueue) weight(namespace string) int {
+	if weight := q.NamespaceWeights[namespace]; weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+// removeIdle forgets a namespace with nothing active or waiting once its
+// finish tag has been passed, as it would start from virtual anyway
+func (q *ColdStartQueue) removeIdle(namespace string) {
+	ns, ok := q.namespaces[namespace]
+	if ok && ns.active <= 0 && ns.waiting <= 0 && ns.finish <= q.virtual {
+		delete(q.namespaces, namespace)
+	}
+}
+
+func (q *ColdStartQueue) reportDepth(namespace string) {
+	if q.QueueDepth == nil {
+		return
+	}
+	if ns, ok := q.namespaces[namespace]; ok {
+		q.QueueDepth.WithLabelValues(namespace).Set(float64(ns.waiting))
+	}
+}
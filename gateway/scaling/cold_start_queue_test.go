@@ -0,0 +1,379 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// queueWaiters starts a caller for each key in turn, waiting for it to be
+// queued before the next, and returns the order in which they are admitted
+func queueWaiters(t *testing.T, q *ColdStartQueue, keys []string, priorities []int) chan string {
+	admitted := make(chan string, len(keys))
+	for i, key := range keys {
+		go func(key string, priority int) {
+			q.Acquire(context.Background(), key, priority)
+			admitted <- key
+		}(key, priorities[i])
+
+		waitForQueued(t, q, i+1)
+	}
+	return admitted
+}
+
+func waitForQueued(t *testing.T, q *ColdStartQueue, want int) {
+	deadline := time.Now().Add(time.Second)
+	for q.Queued() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("want %d queued, got %d", want, q.Queued())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func nextAdmitted(t *testing.T, admitted chan string) string {
+	select {
+	case key := <-admitted:
+		return key
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a cold start to be admitted")
+	}
+	return ""
+}
+
+func Test_ColdStartQueue_AdmitsUpToLimit(t *testing.T) {
+	q := NewColdStartQueue(2, 0)
+
+	q.Acquire(context.Background(), "a.openfaas-fn", PriorityNormal)
+	q.Acquire(context.Background(), "b.openfaas-fn", PriorityNormal)
+
+	admitted := queueWaiters(t, q, []string{"c.openfaas-fn"}, []int{PriorityHigh})
+
+	q.Release("a.openfaas-fn")
+	if got := nextAdmitted(t, admitted); got != "c.openfaas-fn" {
+		t.Errorf("want c admitted, got %s", got)
+	}
+}
+
+func Test_ColdStartQueue_OrdersByPriorityUnderContention(t *testing.T) {
+	q := NewColdStartQueue(1, 0)
+	q.Acquire(context.Background(), "running.openfaas-fn", PriorityNormal)
+
+	keys := []string{"batch.openfaas-fn", "api.openfaas-fn", "report.openfaas-fn", "checkout.openfaas-fn"}
+	admitted := queueWaiters(t, q, keys, []int{PriorityLow, PriorityNormal, PriorityLow, PriorityHigh})
+
+	want := []string{"checkout.openfaas-fn", "api.openfaas-fn", "batch.openfaas-fn", "report.openfaas-fn"}
+
+	q.Release("running.openfaas-fn")
+	for _, key := range want {
+		got := nextAdmitted(t, admitted)
+		if got != key {
+			t.Fatalf("want %s admitted, got %s", key, got)
+		}
+		q.Release(got)
+	}
+}
+
+func Test_ColdStartQueue_AgingAvoidsStarvation(t *testing.T) {
+	q := NewColdStartQueue(1, time.Millisecond*20)
+	q.Acquire(context.Background(), "running.openfaas-fn", PriorityNormal)
+
+	admitted := queueWaiters(t, q, []string{"batch.openfaas-fn"}, []int{PriorityLow})
+	time.Sleep(time.Millisecond * 70)
+
+	go func() {
+		q.Acquire(context.Background(), "checkout.openfaas-fn", PriorityHigh)
+		admitted <- "checkout.openfaas-fn"
+	}()
+	waitForQueued(t, q, 2)
+
+	q.Release("running.openfaas-fn")
+	if got := nextAdmitted(t, admitted); got != "batch.openfaas-fn" {
+		t.Fatalf("want the aged low priority cold start admitted, got %s", got)
+	}
+	q.Release("batch.openfaas-fn")
+	if got := nextAdmitted(t, admitted); got != "checkout.openfaas-fn" {
+		t.Fatalf("want checkout admitted, got %s", got)
+	}
+}
+
+func Test_ColdStartQueue_SameFunctionSharesSlot(t *testing.T) {
+	q := NewColdStartQueue(1, 0)
+	q.Acquire(context.Background(), "figlet.openfaas-fn", PriorityNormal)
+
+	done := make(chan struct{})
+	go func() {
+		q.Acquire(context.Background(), "figlet.openfaas-fn", PriorityLow)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("want a second caller for the same function admitted straight away")
+	}
+
+	admitted := queueWaiters(t, q, []string{"env.openfaas-fn"}, []int{PriorityHigh})
+
+	q.Release("figlet.openfaas-fn")
+	select {
+	case key := <-admitted:
+		t.Fatalf("want %s queued until every figlet caller released", key)
+	case <-time.After(time.Millisecond * 20):
+	}
+
+	q.Release("figlet.openfaas-fn")
+	if got := nextAdmitted(t, admitted); got != "env.openfaas-fn" {
+		t.Fatalf("want env admitted, got %s", got)
+	}
+}
+
+func Test_ColdStartQueue_CancelledWhilstQueued(t *testing.T) {
+	q := NewColdStartQueue(1, 0)
+	q.Acquire(context.Background(), "running.openfaas-fn", PriorityNormal)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- q.Acquire(ctx, "figlet.openfaas-fn", PriorityHigh)
+	}()
+	waitForQueued(t, q, 1)
+
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("want %s, got %v", context.Canceled, err)
+	}
+	if queued := q.Queued(); queued != 0 {
+		t.Fatalf("want the cancelled cold start removed from the queue, got %d queued", queued)
+	}
+
+	admitted := queueWaiters(t, q, []string{"env.openfaas-fn"}, []int{PriorityLow})
+	q.Release("running.openfaas-fn")
+	if got := nextAdmitted(t, admitted); got != "env.openfaas-fn" {
+		t.Fatalf("want env admitted, got %s", got)
+	}
+}
+
+// admitInOrder releases each admitted cold start in turn and fails unless
+// they are admitted in the order of want
+func admitInOrder(t *testing.T, q *ColdStartQueue, admitted chan string, want []string) {
+	for _, key := range want {
+		got := nextAdmitted(t, admitted)
+		if got != key {
+			t.Fatalf("want %s admitted, got %s", key, got)
+		}
+		q.Release(got)
+	}
+}
+
+func Test_ColdStartQueue_FairBetweenNamespaces(t *testing.T) {
+	q := NewColdStartQueue(1, 0)
+	q.Acquire(context.Background(), "running.team-a", PriorityNormal)
+
+	keys := []string{"a1.team-a", "a2.team-a", "a3.team-a", "a4.team-a", "b1.team-b", "b2.team-b"}
+	admitted := queueWaiters(t, q, keys, []int{PriorityNormal, PriorityNormal, PriorityNormal, PriorityNormal, PriorityNormal, PriorityNormal})
+
+	q.Release("running.team-a")
+
+	// team-b is not made to wait behind team-a's burst
+	admitInOrder(t, q, admitted, []string{"b1.team-b", "a1.team-a", "b2.team-b", "a2.team-a", "a3.team-a", "a4.team-a"})
+}
+
+func Test_ColdStartQueue_WeightedNamespaces(t *testing.T) {
+	q := NewColdStartQueue(1, 0)
+	q.NamespaceWeights = map[string]int{"team-a": 2}
+	q.Acquire(context.Background(), "running.openfaas-fn", PriorityNormal)
+
+	keys := []string{"a1.team-a", "a2.team-a", "a3.team-a", "a4.team-a", "b1.team-b", "b2.team-b"}
+	admitted := queueWaiters(t, q, keys, []int{PriorityNormal, PriorityNormal, PriorityNormal, PriorityNormal, PriorityNormal, PriorityNormal})
+
+	q.Release("running.openfaas-fn")
+
+	admitInOrder(t, q, admitted, []string{"a1.team-a", "b1.team-b", "a2.team-a", "a3.team-a", "b2.team-b", "a4.team-a"})
+}
+
+func Test_ColdStartQueue_PriorityWithinNamespace(t *testing.T) {
+	q := NewColdStartQueue(1, 0)
+	q.Acquire(context.Background(), "running.openfaas-fn", PriorityNormal)
+
+	keys := []string{"a1.team-a", "a2.team-a", "b1.team-b"}
+	admitted := queueWaiters(t, q, keys, []int{PriorityLow, PriorityHigh, PriorityHigh})
+
+	q.Release("running.openfaas-fn")
+
+	admitInOrder(t, q, admitted, []string{"a2.team-a", "b1.team-b", "a1.team-a"})
+}
+
+func Test_ColdStartQueue_NamespaceLimit(t *testing.T) {
+	q := NewColdStartQueue(3, 0)
+	q.NamespaceLimits = map[string]int{"team-a": 1}
+	q.Acquire(context.Background(), "a1.team-a", PriorityNormal)
+
+	admitted := queueWaiters(t, q, []string{"a2.team-a"}, []int{PriorityHigh})
+
+	done := make(chan struct{})
+	go func() {
+		q.Acquire(context.Background(), "b1.team-b", PriorityLow)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("want team-b admitted whilst team-a is at its limit")
+	}
+
+	select {
+	case key := <-admitted:
+		t.Fatalf("want %s queued until team-a is under its limit", key)
+	case <-time.After(time.Millisecond * 20):
+	}
+
+	q.Release("a1.team-a")
+	if got := nextAdmitted(t, admitted); got != "a2.team-a" {
+		t.Fatalf("want a2 admitted, got %s", got)
+	}
+}
+
+func Test_ColdStartQueue_ReportsQueueDepth(t *testing.T) {
+	depth := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "queue_depth"}, []string{"namespace"})
+
+	q := NewColdStartQueue(1, 0)
+	q.QueueDepth = depth
+	q.Acquire(context.Background(), "running.openfaas-fn", PriorityNormal)
+
+	admitted := queueWaiters(t, q, []string{"a1.team-a", "a2.team-a", "b1.team-b"}, []int{PriorityNormal, PriorityNormal, PriorityNormal})
+
+	gauge := func(namespace string) float64 {
+		metric := &dto.Metric{}
+		depth.WithLabelValues(namespace).Write(metric)
+		return metric.GetGauge().GetValue()
+	}
+
+	if got := gauge("team-a"); got != 2 {
+		t.Errorf("team-a queue depth want: 2, got: %f", got)
+	}
+	if got := gauge("team-b"); got != 1 {
+		t.Errorf("team-b queue depth want: 1, got: %f", got)
+	}
+
+	q.Release("running.openfaas-fn")
+	q.Release(nextAdmitted(t, admitted))
+
+	if got := gauge("team-a") + gauge("team-b"); got != 1 {
+		t.Errorf("queue depth want: 1 in total, got: %f", got)
+	}
+}
+
+func Test_ScaleWithPriority_StopsWhenCancelled(t *testing.T) {
+	query := &fakeServiceQuery{}
+	scaler := newTestScaler(query)
+	scaler.Config.ColdStarts = NewColdStartQueue(1, 0)
+	scaler.Config.ColdStarts.Acquire(context.Background(), "other.openfaas-fn", PriorityNormal)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	res := scaler.ScaleWithPriority(ctx, "figlet", "openfaas-fn", 0, "")
+	if res.Available || res.Error != context.DeadlineExceeded {
+		t.Fatalf("want the scale to stop with %s, got: %+v", context.DeadlineExceeded, res)
+	}
+	if len(query.setCalls) != 0 {
+		t.Errorf("want no scale up requested, got: %v", query.setCalls)
+	}
+}
+
+func Test_ScaleWithPriority_QueuesColdStarts(t *testing.T) {
+	query := &fakeServiceQuery{response: ServiceQueryResponse{
+		Annotations: &map[string]string{ScalePriorityAnnotation: "low"},
+	}}
+	scaler := newTestScaler(query)
+	scaler.Config.ColdStarts = NewColdStartQueue(1, 0)
+	scaler.Config.ColdStarts.Acquire(context.Background(), "other.openfaas-fn", PriorityNormal)
+
+	results := make(chan FunctionScaleResult, 1)
+	go func() {
+		results <- scaler.ScaleWithPriority(context.Background(), "figlet", "openfaas-fn", 0, "")
+	}()
+	waitForQueued(t, scaler.Config.ColdStarts, 1)
+	time.Sleep(time.Millisecond * 20)
+
+	scaler.Config.ColdStarts.Release("other.openfaas-fn")
+
+	select {
+	case res := <-results:
+		if !res.Available {
+			t.Fatalf("want function to be available, got: %+v", res)
+		}
+		if res.Duration < time.Millisecond*20 {
+			t.Errorf("want the Duration to include the time queued, got: %s", res.Duration)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the scale")
+	}
+
+	admitted := make(chan struct{})
+	go func() {
+		scaler.Config.ColdStarts.Acquire(context.Background(), "next.openfaas-fn", PriorityNormal)
+		close(admitted)
+	}()
+	select {
+	case <-admitted:
+	case <-time.After(time.Second):
+		t.Fatal("want the cold start released once the function is ready")
+	}
+}
+
+func Test_coldStartPriority(t *testing.T) {
+	annotations := &map[string]string{ScalePriorityAnnotation: "high"}
+	low := &map[string]string{ScalePriorityAnnotation: "low"}
+
+	cases := []struct {
+		priority    string
+		annotations *map[string]string
+		want        int
+	}{
+		{"", nil, PriorityNormal},
+		{"", annotations, PriorityHigh},
+		{"low", annotations, PriorityLow},
+		{"urgent", annotations, PriorityHigh},
+		{"High", nil, PriorityNormal},
+		{"high", low, PriorityLow},
+		{"low", nil, PriorityLow},
+	}
+
+	for _, c := range cases {
+		if got := coldStartPriority(c.priority, c.annotations); got != c.want {
+			t.Errorf("priority %q: want %d, got %d", c.priority, c.want, got)
+		}
+	}
+}
+
+func Test_ColdStartQueue_Position(t *testing.T) {
+	q := NewColdStartQueue(1, 0)
+	q.Acquire(context.Background(), "running.openfaas-fn", PriorityNormal)
+
+	queueWaiters(t, q, []string{"a.openfaas-fn", "b.openfaas-fn"}, []int{PriorityNormal, PriorityNormal})
+
+	cases := []struct {
+		key        string
+		want       int
+		wantQueued bool
+	}{
+		{"running.openfaas-fn", 0, false},
+		{"a.openfaas-fn", 1, true},
+		{"b.openfaas-fn", 2, true},
+		{"unknown.openfaas-fn", 0, false},
+	}
+	for _, c := range cases {
+		got, queued := q.Position(c.key)
+		if got != c.want || queued != c.wantQueued {
+			t.Errorf("%s: position want: %d %v, got: %d %v", c.key, c.want, c.wantQueued, got, queued)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// EndpointBaseURLResolver resolves requests for functions which have
+// endpoints in the cache to one of those endpoints, picked by the function's
+// LoadBalancer, all other requests are resolved by Fallback
+type EndpointBaseURLResolver struct {
+	Cache            FunctionCacher
+	Fallback         middleware.BaseURLResolver
+	DefaultNamespace string
+
+	// DefaultPolicy is the LoadBalancer for functions without the
+	// com.openfaas.load-balancer annotation
+	DefaultPolicy string
+
+	// Outliers ejects failing endpoints when set
+	Outliers *OutlierDetector
+
+	balancers map[string]LoadBalancer
+}
+
+// NewEndpointBaseURLResolver creates an EndpointBaseURLResolver which
+// balances requests round-robin unless a function selects another policy
+func NewEndpointBaseURLResolver(cache FunctionCacher, fallback middleware.BaseURLResolver, defaultNamespace string) EndpointBaseURLResolver {
+	balancers := map[string]LoadBalancer{}
+	for _, policy := range LoadBalancerPolicies {
+		balancers[policy], _ = NewLoadBalancer(policy)
+	}
+
+	return EndpointBaseURLResolver{
+		Cache:            cache,
+		Fallback:         fallback,
+		DefaultNamespace: defaultNamespace,
+		DefaultPolicy:    RoundRobin,
+		balancers:        balancers,
+	}
+}
+
+// SetBalancer replaces the LoadBalancer used for policy
+func (e EndpointBaseURLResolver) SetBalancer(policy string, balancer LoadBalancer) {
+	e.balancers[policy] = balancer
+}
+
+// Resolve the base URL for a request
+func (e EndpointBaseURLResolver) Resolve(r *http.Request) string {
+	functionName, namespace := middleware.GetNamespace(e.DefaultNamespace, middleware.GetServiceName(r.URL.Path))
+
+	if endpoints, ok := e.Cache.GetEndpoints(functionName, namespace); ok && len(endpoints) > 0 {
+		annotations := e.annotations(functionName, namespace)
+		if e.Outliers != nil {
+			endpoints = e.Outliers.Available(endpoints, e.Outliers.policy(annotations))
+		}
+
+		picked := e.balancer(annotations).Pick(r, endpoints)
+		return strings.TrimSuffix(picked, "/")
+	}
+
+	return e.Fallback.Resolve(r)
+}
+
+// Report the outcome of a request to the LoadBalancer which picked baseURL
+// and to Outliers, a 5xx status code is a failure
+func (e EndpointBaseURLResolver) Report(r *http.Request, baseURL string, statusCode int, duration time.Duration) {
+	failed := statusCode >= http.StatusInternalServerError
+
+	functionName, namespace := middleware.GetNamespace(e.DefaultNamespace, middleware.GetServiceName(r.URL.Path))
+
+	endpoints, _ := e.Cache.GetEndpoints(functionName, namespace)
+	for _, endpoint := range endpoints {
+		if strings.TrimSuffix(endpoint, "/") == baseURL {
+			annotations := e.annotations(functionName, namespace)
+			balancer := e.balancer(annotations)
+			balancer.Release(endpoint, failed)
+			if observer, ok := balancer.(OutcomeObserver); ok {
+				observer.Observe(functionName+"."+namespace, endpoint, endpoints, statusCode, duration)
+			}
+			if e.Outliers != nil {
+				e.Outliers.Record(functionName+"."+namespace, endpoint, endpoints, failed, e.Outliers.policy(annotations))
+			}
+			return
+		}
+	}
+}
+
+func (e EndpointBaseURLResolver) annotations(functionName, namespace string) map[string]string {
+	if res, _ := e.Cache.Get(functionName, namespace); res.Annotations != nil {
+		return *res.Annotations
+	}
+	return nil
+}
+
+func (e EndpointBaseURLResolver) balancer(annotations map[string]string) LoadBalancer {
+	policy, _ := LoadBalancerPolicy(annotations, e.DefaultPolicy)
+	if balancer, ok := e.balancers[policy]; ok {
+		return balancer
+	}
+	return e.balancers[RoundRobin]
+}
+
+// BuildURL builds a URL with Fallback
+func (e EndpointBaseURLResolver) BuildURL(function, namespace, healthPath string, directFunctions bool) string {
+	return e.Fallback.BuildURL(function, namespace, healthPath, directFunctions)
+}
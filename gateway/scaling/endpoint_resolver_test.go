@@ -0,0 +1,62 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+func Test_EndpointBaseURLResolver(t *testing.T) {
+	cache := NewFunctionCache(time.Second)
+	fallback := middleware.SingleHostBaseURLResolver{BaseURL: "http://faas-provider:8080/"}
+	resolver := NewEndpointBaseURLResolver(cache, fallback, "openfaas-fn")
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	if got := resolver.Resolve(req); got != "http://faas-provider:8080" {
+		t.Errorf("want fallback, got: %s", got)
+	}
+
+	cache.SwapEndpoints("echo", "openfaas-fn", []string{"http://green-1:8080", "http://green-2:8080/"})
+
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[resolver.Resolve(req)] = true
+	}
+	if len(seen) != 2 || !seen["http://green-1:8080"] || !seen["http://green-2:8080"] {
+		t.Errorf("want both green endpoints, got: %v", seen)
+	}
+
+	other := httptest.NewRequest("GET", "/function/echo.dev", nil)
+	if got := resolver.Resolve(other); got != "http://faas-provider:8080" {
+		t.Errorf("want fallback for another namespace, got: %s", got)
+	}
+}
+
+func Test_EndpointBaseURLResolver_AnnotationSelectsPolicy(t *testing.T) {
+	cache := NewFunctionCache(time.Second)
+	fallback := middleware.SingleHostBaseURLResolver{BaseURL: "http://faas-provider:8080/"}
+	resolver := NewEndpointBaseURLResolver(cache, fallback, "openfaas-fn")
+
+	cache.Set("echo", "openfaas-fn", ServiceQueryResponse{
+		Annotations: &map[string]string{LoadBalancerAnnotation: LeastConnections},
+	})
+	cache.SwapEndpoints("echo", "openfaas-fn", []string{"http://green-1:8080/", "http://green-2:8080/"})
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	first := resolver.Resolve(req)
+	second := resolver.Resolve(req)
+	if first == second {
+		t.Fatalf("want requests in flight spread over both endpoints, got: %s twice", first)
+	}
+
+	resolver.Report(req, first, http.StatusOK, time.Millisecond)
+	if got := resolver.Resolve(req); got != first {
+		t.Errorf("want the endpoint with the fewest requests in flight: %s, got: %s", first, got)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// FeatureVariantsAnnotation maps values of the feature flag header to the
+// base URL of an experimental deployment of the function, i.e.
+// "B=http://figlet-b.openfaas-fn:8080,C=http://figlet-c.openfaas-fn:8080"
+const FeatureVariantsAnnotation = "com.openfaas.feature-variants"
+
+// FeatureFlagBaseURLResolver resolves requests for functions with the
+// com.openfaas.feature-variants annotation to the deployment for the variant
+// sent by the client in FlagHeader. Requests without a matching variant, and
+// for all other functions, are resolved by Fallback.
+type FeatureFlagBaseURLResolver struct {
+	FunctionQuery    FunctionQuery
+	Fallback         middleware.BaseURLResolver
+	DefaultNamespace string
+	FlagHeader       string
+
+	// StripHeader removes FlagHeader from requests to functions with the
+	// annotation, so that the function sees the same request for each variant
+	StripHeader bool
+
+	// variants caches the parsed annotation by its value
+	variants baseURLMap
+}
+
+// NewFeatureFlagBaseURLResolver creates a FeatureFlagBaseURLResolver
+func NewFeatureFlagBaseURLResolver(functionQuery FunctionQuery, fallback middleware.BaseURLResolver, defaultNamespace, flagHeader string, stripHeader bool) FeatureFlagBaseURLResolver {
+	return FeatureFlagBaseURLResolver{
+		FunctionQuery:    functionQuery,
+		Fallback:         fallback,
+		DefaultNamespace: defaultNamespace,
+		FlagHeader:       flagHeader,
+		StripHeader:      stripHeader,
+		variants:         newBaseURLMap(FeatureVariantsAnnotation),
+	}
+}
+
+// Resolve the base URL for a request
+func (f FeatureFlagBaseURLResolver) Resolve(r *http.Request) string {
+	functionName, namespace := middleware.GetNamespace(f.DefaultNamespace, middleware.GetServiceName(r.URL.Path))
+
+	annotations, err := f.FunctionQuery.GetAnnotations(functionName, namespace)
+	if err != nil || len(annotations[FeatureVariantsAnnotation]) == 0 {
+		return f.Fallback.Resolve(r)
+	}
+
+	variant := strings.TrimSpace(r.Header.Get(f.FlagHeader))
+	if f.StripHeader {
+		r.Header.Del(f.FlagHeader)
+	}
+
+	if len(variant) > 0 {
+		if baseURL, ok := f.variants.parse(annotations[FeatureVariantsAnnotation])[variant]; ok {
+			return baseURL
+		}
+	}
+
+	return f.Fallback.Resolve(r)
+}
+
+// Report passes the outcome of a request on to Fallback when it balances
+// requests over endpoints
+func (f FeatureFlagBaseURLResolver) Report(r *http.Request, baseURL string, statusCode int, duration time.Duration) {
+	if reporter, ok := f.Fallback.(middleware.EndpointReporter); ok {
+		reporter.Report(r, baseURL, statusCode, duration)
+	}
+}
+
+// BuildURL builds a URL with Fallback
+func (f FeatureFlagBaseURLResolver) BuildURL(function, namespace, healthPath string, directFunctions bool) string {
+	return f.Fallback.BuildURL(function, namespace, healthPath, directFunctions)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+func newTestFeatureFlagResolver(annotations map[string]string, stripHeader bool) FeatureFlagBaseURLResolver {
+	fallback := middleware.SingleHostBaseURLResolver{BaseURL: "http://faas-provider:8080"}
+	return NewFeatureFlagBaseURLResolver(annotationsQuery(annotations), fallback, "openfaas-fn", "X-Feature-Variant", stripHeader)
+}
+
+func Test_FeatureFlagBaseURLResolver_MatchingVariant(t *testing.T) {
+	resolver := newTestFeatureFlagResolver(map[string]string{
+		FeatureVariantsAnnotation: "B=http://figlet-b.openfaas-fn:8080/, C=http://figlet-c.openfaas-fn:8080",
+	}, false)
+
+	req := httptest.NewRequest("GET", "/function/figlet", nil)
+	req.Header.Set("X-Feature-Variant", "B")
+
+	if got := resolver.Resolve(req); got != "http://figlet-b.openfaas-fn:8080" {
+		t.Errorf("want the B deployment, got: %s", got)
+	}
+	if got := req.Header.Get("X-Feature-Variant"); got != "B" {
+		t.Errorf("want the header to be kept, got: %q", got)
+	}
+}
+
+func Test_FeatureFlagBaseURLResolver_NoMatchUsesFallback(t *testing.T) {
+	resolver := newTestFeatureFlagResolver(map[string]string{
+		FeatureVariantsAnnotation: "B=http://figlet-b.openfaas-fn:8080",
+	}, false)
+
+	for _, variant := range []string{"", "A"} {
+		req := httptest.NewRequest("GET", "/function/figlet", nil)
+		if len(variant) > 0 {
+			req.Header.Set("X-Feature-Variant", variant)
+		}
+
+		if got := resolver.Resolve(req); got != "http://faas-provider:8080" {
+			t.Errorf("variant %q want the default deployment, got: %s", variant, got)
+		}
+	}
+}
+
+func Test_FeatureFlagBaseURLResolver_WithoutAnnotationUsesFallback(t *testing.T) {
+	resolver := newTestFeatureFlagResolver(map[string]string{}, true)
+
+	req := httptest.NewRequest("GET", "/function/figlet", nil)
+	req.Header.Set("X-Feature-Variant", "B")
+
+	if got := resolver.Resolve(req); got != "http://faas-provider:8080" {
+		t.Errorf("want the default deployment, got: %s", got)
+	}
+	if got := req.Header.Get("X-Feature-Variant"); got != "B" {
+		t.Errorf("want the header to be kept for functions without variants, got: %q", got)
+	}
+}
+
+func Test_FeatureFlagBaseURLResolver_StripsHeader(t *testing.T) {
+	resolver := newTestFeatureFlagResolver(map[string]string{
+		FeatureVariantsAnnotation: "B=http://figlet-b.openfaas-fn:8080",
+	}, true)
+
+	for _, variant := range []string{"B", "A"} {
+		req := httptest.NewRequest("GET", "/function/figlet", nil)
+		req.Header.Set("X-Feature-Variant", variant)
+
+		resolver.Resolve(req)
+
+		if _, ok := req.Header["X-Feature-Variant"]; ok {
+			t.Errorf("variant %q want the header to be stripped", variant)
+		}
+	}
+}
@@ -13,6 +13,17 @@ type FunctionCacher interface {
 	Set(functionName, namespace string, serviceQueryResponse ServiceQueryResponse)
 	Get(functionName, namespace string) (ServiceQueryResponse, bool)
 	Delete(functionName, namespace string) error
+
+	// Flush removes every cached function and returns how many were removed
+	Flush() int
+
+	// GetEndpoints returns the upstream endpoints set for a function, the
+	// returned slice must not be modified
+	GetEndpoints(functionName, namespace string) ([]string, bool)
+
+	// SwapEndpoints replaces the upstream endpoints of a function in a single
+	// operation, an empty set removes them
+	SwapEndpoints(functionName, namespace string, endpoints []string)
 }
 
 // FunctionCache provides a cache of Function replica counts
@@ -20,13 +31,18 @@ type FunctionCache struct {
 	Cache  map[string]*FunctionMeta
 	Expiry time.Duration
 	Sync   sync.RWMutex
+
+	// Endpoints are kept apart from Cache so that they survive Delete,
+	// which happens when a function is scaled to zero
+	Endpoints map[string][]string
 }
 
 // NewFunctionCache creates a function cache to query function metadata
 func NewFunctionCache(cacheExpiry time.Duration) FunctionCacher {
 	return &FunctionCache{
-		Cache:  make(map[string]*FunctionMeta),
-		Expiry: cacheExpiry,
+		Cache:     make(map[string]*FunctionMeta),
+		Expiry:    cacheExpiry,
+		Endpoints: make(map[string][]string),
 	}
 }
 
@@ -69,3 +85,43 @@ func (fc *FunctionCache) Delete(functionName, namespace string) error {
 
 	return nil
 }
+
+// Flush removes every cached function and returns how many were removed.
+// Endpoints are kept since they are set through the API rather than cached.
+func (fc *FunctionCache) Flush() int {
+	fc.Sync.Lock()
+	defer fc.Sync.Unlock()
+
+	flushed := len(fc.Cache)
+	fc.Cache = make(map[string]*FunctionMeta)
+	return flushed
+}
+
+// GetEndpoints returns the upstream endpoints set for functionName
+func (fc *FunctionCache) GetEndpoints(functionName, namespace string) ([]string, bool) {
+	fc.Sync.RLock()
+	defer fc.Sync.RUnlock()
+
+	endpoints, exists := fc.Endpoints[functionName+"."+namespace]
+	return endpoints, exists
+}
+
+// SwapEndpoints replaces the upstream endpoints for functionName. The set is
+// copied before the lock is taken and never modified afterwards so readers
+// either see the previous or the new set, never a mix of both.
+func (fc *FunctionCache) SwapEndpoints(functionName, namespace string, endpoints []string) {
+	var next []string
+	if len(endpoints) > 0 {
+		next = make([]string, len(endpoints))
+		copy(next, endpoints)
+	}
+
+	fc.Sync.Lock()
+	defer fc.Sync.Unlock()
+
+	if len(next) == 0 {
+		delete(fc.Endpoints, functionName+"."+namespace)
+		return
+	}
+	fc.Endpoints[functionName+"."+namespace] = next
+}
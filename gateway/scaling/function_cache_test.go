@@ -4,6 +4,9 @@
 package scaling
 
 import (
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -137,3 +140,90 @@ func Test_CacheFunctionNotExist(t *testing.T) {
 		t.Errorf("hit, want: %v, got %v", wantHit, hit)
 	}
 }
+
+func Test_SwapEndpoints_NoMixedReads(t *testing.T) {
+	cache := NewFunctionCache(time.Second)
+	fnName, namespace := "echo", "openfaas-fn"
+
+	blue := []string{"http://blue-1:8080", "http://blue-2:8080", "http://blue-3:8080"}
+	green := []string{"http://green-1:8080", "http://green-2:8080", "http://green-3:8080"}
+	cache.SwapEndpoints(fnName, namespace, blue)
+
+	done := make(chan struct{})
+	errs := make(chan string, 8)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				endpoints, ok := cache.GetEndpoints(fnName, namespace)
+				if !ok || len(endpoints) != 3 {
+					errs <- fmt.Sprintf("want 3 endpoints, got: %v", endpoints)
+					return
+				}
+				colour := strings.Split(endpoints[0], "-")[0]
+				for _, endpoint := range endpoints {
+					if !strings.HasPrefix(endpoint, colour) {
+						errs <- fmt.Sprintf("mixed endpoint set: %v", endpoints)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 {
+			cache.SwapEndpoints(fnName, namespace, green)
+		} else {
+			cache.SwapEndpoints(fnName, namespace, blue)
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func Test_SwapEndpoints_SurvivesDelete(t *testing.T) {
+	cache := NewFunctionCache(time.Second)
+
+	cache.SwapEndpoints("echo", "openfaas-fn", []string{"http://green:8080"})
+	cache.Delete("echo", "openfaas-fn")
+
+	if _, ok := cache.GetEndpoints("echo", "openfaas-fn"); !ok {
+		t.Errorf("want endpoints to be kept after Delete")
+	}
+
+	cache.SwapEndpoints("echo", "openfaas-fn", nil)
+	if _, ok := cache.GetEndpoints("echo", "openfaas-fn"); ok {
+		t.Errorf("want endpoints to be removed by an empty swap")
+	}
+}
+
+func Test_Flush_KeepsEndpoints(t *testing.T) {
+	cache := NewFunctionCache(time.Minute)
+	cache.Set("echo", "openfaas-fn", ServiceQueryResponse{AvailableReplicas: 1})
+	cache.Set("figlet", "openfaas-fn", ServiceQueryResponse{AvailableReplicas: 1})
+	cache.SwapEndpoints("echo", "openfaas-fn", []string{"http://10.0.0.1:8080"})
+
+	if flushed := cache.Flush(); flushed != 2 {
+		t.Errorf("want 2 entries flushed, got: %d", flushed)
+	}
+	if _, hit := cache.Get("echo", "openfaas-fn"); hit {
+		t.Errorf("want a miss after a flush")
+	}
+	if _, ok := cache.GetEndpoints("echo", "openfaas-fn"); !ok {
+		t.Errorf("want the endpoints to survive a flush")
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// RawRequestURIAnnotation set to "true" forwards requests to a function with
+// the URI exactly as the client sent it, including the /function/ prefix,
+// in place of the transformed path, such as for a function which is itself
+// a proxy
+const RawRequestURIAnnotation = "com.openfaas.raw-request-uri"
+
+// FunctionRawRequestURIs reads whether a function wants the raw request URI
+// from the annotations held in Cache, in the same way as FunctionTimeouts
+type FunctionRawRequestURIs struct {
+	Cache            FunctionCacher
+	DefaultNamespace string
+}
+
+// RawRequestURI returns true when the function a request is for has opted-in
+func (f FunctionRawRequestURIs) RawRequestURI(r *http.Request) bool {
+	serviceName := middleware.GetServiceName(r.URL.Path)
+	if len(serviceName) == 0 {
+		return false
+	}
+
+	functionName, namespace := middleware.GetNamespace(f.DefaultNamespace, serviceName)
+	res, _ := f.Cache.Get(functionName, namespace)
+	if res.Annotations == nil {
+		return false
+	}
+
+	value, ok := (*res.Annotations)[RawRequestURIAnnotation]
+	if !ok {
+		return false
+	}
+
+	raw, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		log.Printf("Warning: invalid %s annotation %q for function %s.%s, the path is transformed\n",
+			RawRequestURIAnnotation, value, functionName, namespace)
+		return false
+	}
+	return raw
+}
@@ -0,0 +1,42 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_FunctionRawRequestURIs_ReadsCachedAnnotation(t *testing.T) {
+	cache := NewFunctionCache(time.Minute)
+	rawURIs := FunctionRawRequestURIs{Cache: cache, DefaultNamespace: "openfaas-fn"}
+
+	req := httptest.NewRequest("GET", "/function/proxy/a%2Fb", nil)
+	if rawURIs.RawRequestURI(req) {
+		t.Fatalf("want the path transformed without a cache entry")
+	}
+
+	cases := []struct {
+		value string
+		want  bool
+	}{
+		{"true", true},
+		{" TRUE ", true},
+		{"false", false},
+		{"yes please", false},
+	}
+	for _, c := range cases {
+		cache.Set("proxy", "openfaas-fn", ServiceQueryResponse{
+			Annotations: &map[string]string{RawRequestURIAnnotation: c.value},
+		})
+		if got := rawURIs.RawRequestURI(req); got != c.want {
+			t.Errorf("%q: want: %v, got: %v", c.value, c.want, got)
+		}
+	}
+
+	if rawURIs.RawRequestURI(httptest.NewRequest("GET", "/system/functions", nil)) {
+		t.Errorf("want false for a request which is not for a function")
+	}
+}
@@ -1,6 +1,7 @@
 package scaling
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
@@ -24,6 +25,10 @@ type FunctionScaler struct {
 	Cache        FunctionCacher
 	Config       ScalingConfig
 	SingleFlight *singleflight.Group
+
+	// OnScaleFromZero is called when a scale up from zero replicas is
+	// requested, before the function is ready
+	OnScaleFromZero func(functionName, namespace string, replicas uint64)
 }
 
 // FunctionScaleResult holds the result of scaling from zero
@@ -32,22 +37,58 @@ type FunctionScaleResult struct {
 	Error     error
 	Found     bool
 	Duration  time.Duration
+
+	// ScaledFromZero is true when this call requested the scale up from
+	// zero to Replicas
+	ScaledFromZero bool
+
+	// Replicas is the scale target after a scale up, otherwise the
+	// available replicas the function was found with, 0 when unknown
+	Replicas uint64
+
+	// Unschedulable is true when the function has no available replicas
+	// and the provider reports replicas it cannot place, such as when it
+	// has no capacity for the function. It is only reported for a context
+	// from WithFailover, otherwise the function is waited for as usual.
+	Unschedulable bool
 }
 
 // Scale scales a function from zero replicas to 1 or the value set in
 // the minimum replicas metadata
 func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResult {
+	return f.ScaleTo(functionName, namespace, 0)
+}
+
+// ScaleTo scales a function until at least target replicas are available,
+// the target is capped to the function's maximum replicas. When target is 0
+// the function is scaled from zero in the same way as Scale.
+func (f *FunctionScaler) ScaleTo(functionName, namespace string, target uint64) FunctionScaleResult {
+	return f.ScaleWithPriority(context.Background(), functionName, namespace, target, "")
+}
+
+// ScaleWithPriority scales a function in the same way as ScaleTo, a scale
+// from zero waits its turn in the ColdStarts queue by priority, i.e. the
+// request's X-Priority header. The function's com.openfaas.scale.priority
+// annotation is used when priority is blank. Waiting for the function stops
+// early with ctx's error when ctx is done, i.e. when the client has gone away.
+func (f *FunctionScaler) ScaleWithPriority(ctx context.Context, functionName, namespace string, target uint64, priority string) FunctionScaleResult {
 	start := time.Now()
 
+	wantAvailable := uint64(1)
+	if target > 0 {
+		wantAvailable = target
+	}
+
 	// First check the cache, if there are available replicas, then the
 	// request can be served.
 	if cachedResponse, hit := f.Cache.Get(functionName, namespace); hit &&
-		cachedResponse.AvailableReplicas > 0 {
+		cachedResponse.AvailableReplicas >= wantAvailable {
 		return FunctionScaleResult{
 			Error:     nil,
 			Available: true,
 			Found:     true,
 			Duration:  time.Since(start),
+			Replicas:  cachedResponse.AvailableReplicas,
 		}
 	}
 
@@ -79,23 +120,53 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 	queryResponse := res.(ServiceQueryResponse)
 	f.Cache.Set(functionName, namespace, queryResponse)
 
+	if target > 0 && queryResponse.MaxReplicas > 0 && target > queryResponse.MaxReplicas {
+		target = queryResponse.MaxReplicas
+		wantAvailable = target
+	}
+
 	// Check if there are available replicas in the live data
-	if queryResponse.AvailableReplicas > 0 {
+	if queryResponse.AvailableReplicas >= wantAvailable {
 		return FunctionScaleResult{
 			Error:     nil,
 			Available: true,
 			Found:     true,
 			Duration:  time.Since(start),
+			Replicas:  queryResponse.AvailableReplicas,
 		}
 	}
 
-	// If the desired replica count is 0, then a scale up event
-	// is required.
-	if queryResponse.Replicas == 0 {
-		minReplicas := uint64(1)
+	// If the desired replica count is 0, or below the target, then a
+	// scale up event is required.
+	scaledFromZero := false
+	notified := false
+	var minReplicas uint64
+	if queryResponse.Replicas == 0 || queryResponse.Replicas < target {
+		scaledFromZero = queryResponse.Replicas == 0
+		key := functionName + "." + namespace
+		if scaledFromZero && f.Config.ColdStartHistory != nil {
+			f.Config.ColdStartHistory.Begin(key)
+			defer f.Config.ColdStartHistory.End(key)
+		}
+		if scaledFromZero && f.Config.ColdStarts != nil {
+			if err := f.Config.ColdStarts.Acquire(ctx, key, coldStartPriority(priority, queryResponse.Annotations)); err != nil {
+				return FunctionScaleResult{
+					Error:     err,
+					Available: false,
+					Found:     true,
+					Duration:  time.Since(start),
+				}
+			}
+			defer f.Config.ColdStarts.Release(key)
+		}
+
+		minReplicas = 1
 		if queryResponse.MinReplicas > 0 {
 			minReplicas = queryResponse.MinReplicas
 		}
+		if target > minReplicas {
+			minReplicas = target
+		}
 
 		// In a retry-loop, first query desired replicas, then
 		// set them if the value is still at 0.
@@ -114,8 +185,8 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 			f.Cache.Set(functionName, namespace, queryResponse)
 
 			// The scale up is complete because the desired replica count
-			// has been set to 1 or more.
-			if queryResponse.Replicas > 0 {
+			// has been set to 1 or more, or to the target.
+			if queryResponse.Replicas >= wantAvailable {
 				return nil
 			}
 
@@ -124,8 +195,15 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 
 			if _, err, _ := f.SingleFlight.Do(setKey, func() (interface{}, error) {
 
-				log.Printf("[Scale %d/%d] function=%s 0 => %d requested",
-					attempt, int(f.Config.SetScaleRetries), functionName, minReplicas)
+				log.Printf("[Scale %d/%d] function=%s %d => %d requested",
+					attempt, int(f.Config.SetScaleRetries), functionName, queryResponse.Replicas, minReplicas)
+
+				if queryResponse.Replicas == 0 && !notified {
+					notified = true
+					if f.OnScaleFromZero != nil {
+						f.OnScaleFromZero(functionName, namespace, minReplicas)
+					}
+				}
 
 				if err := f.Config.ServiceQuery.SetReplicas(functionName, namespace, minReplicas); err != nil {
 					return nil, fmt.Errorf("unable to scale function [%s], err: %s", functionName, err)
@@ -152,6 +230,14 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 
 	// Holding pattern for at least one function replica to be available
 	for i := 0; i < int(f.Config.MaxPollCount); i++ {
+		if err := ctx.Err(); err != nil {
+			return FunctionScaleResult{
+				Error:     err,
+				Available: false,
+				Found:     true,
+				Duration:  time.Since(start),
+			}
+		}
 
 		res, err, _ := f.SingleFlight.Do(getKey, func() (interface{}, error) {
 			return f.Config.ServiceQuery.GetReplicas(functionName, namespace)
@@ -173,19 +259,58 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 			}
 		}
 
-		if queryResponse.AvailableReplicas > 0 {
+		// Waiting out the polls will not help a function the provider
+		// cannot place, when the request can be sent to another region
+		if canFailOver(ctx) && queryResponse.AvailableReplicas == 0 && queryResponse.UnschedulableReplicas > 0 {
+			log.Printf("[Unschedulable] function=%s replicas=%d", functionName, queryResponse.UnschedulableReplicas)
+			return FunctionScaleResult{
+				Error:         nil,
+				Available:     true,
+				Found:         true,
+				Duration:      totalTime,
+				Unschedulable: true,
+			}
+		}
+
+		if queryResponse.AvailableReplicas >= wantAvailable {
 
 			log.Printf("[Ready] function=%s waited for - %.4fs", functionName, totalTime.Seconds())
 
+			if scaledFromZero {
+				if err := f.warmUp(functionName, namespace, queryResponse.Annotations); err != nil {
+					return FunctionScaleResult{
+						Error:     err,
+						Available: false,
+						Found:     true,
+						Duration:  time.Since(start),
+					}
+				}
+			}
+
+			if notified && f.Config.ColdStartHistory != nil {
+				f.Config.ColdStartHistory.Record(functionName+"."+namespace, totalTime)
+			}
+
 			return FunctionScaleResult{
-				Error:     nil,
-				Available: true,
-				Found:     true,
-				Duration:  totalTime,
+				Error:          nil,
+				Available:      true,
+				Found:          true,
+				Duration:       totalTime,
+				ScaledFromZero: notified,
+				Replicas:       minReplicas,
 			}
 		}
 
-		time.Sleep(f.Config.FunctionPollInterval)
+		select {
+		case <-ctx.Done():
+			return FunctionScaleResult{
+				Error:     ctx.Err(),
+				Available: false,
+				Found:     true,
+				Duration:  time.Since(start),
+			}
+		case <-time.After(f.Config.FunctionPollInterval):
+		}
 	}
 
 	return FunctionScaleResult{
@@ -195,3 +320,49 @@ func (f *FunctionScaler) Scale(functionName, namespace string) FunctionScaleResu
 		Duration:  time.Since(start),
 	}
 }
+
+// warmUp sends the function's warm-up request, if any, once for concurrent
+// callers and bounded by the WarmUpTimeout
+func (f *FunctionScaler) warmUp(functionName, namespace string, annotations *map[string]string) error {
+	if f.Config.Warmer == nil || annotations == nil {
+		return nil
+	}
+
+	warmUpKey := fmt.Sprintf("WarmUp-%s.%s", functionName, namespace)
+	_, err, _ := f.SingleFlight.Do(warmUpKey, func() (interface{}, error) {
+		ctx := context.Background()
+		if f.Config.WarmUpTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, f.Config.WarmUpTimeout)
+			defer cancel()
+		}
+
+		start := time.Now()
+		warmed, err := f.Config.Warmer.WarmUp(ctx, functionName, namespace, *annotations)
+		if err != nil {
+			return nil, fmt.Errorf("unable to warm-up function [%s], err: %s", functionName, err)
+		}
+		if warmed {
+			log.Printf("[Warm-up] function=%s took %.4fs", functionName, time.Since(start).Seconds())
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// coldStartPriority reads the function's annotation, defaulting to
+// PriorityNormal. The request's priority can lower it, but never raise it
+// above the annotation, since any client can send it.
+func coldStartPriority(priority string, annotations *map[string]string) int {
+	limit := PriorityNormal
+	if annotations != nil {
+		if parsed, ok := ParsePriority((*annotations)[ScalePriorityAnnotation]); ok {
+			limit = parsed
+		}
+	}
+
+	if parsed, ok := ParsePriority(priority); ok && parsed < limit {
+		return parsed
+	}
+	return limit
+}
@@ -0,0 +1,115 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServiceQuery makes replicas available as soon as they are set
+type fakeServiceQuery struct {
+	lock     sync.Mutex
+	response ServiceQueryResponse
+	setCalls []uint64
+}
+
+func (f *fakeServiceQuery) GetReplicas(service, namespace string) (ServiceQueryResponse, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.response, nil
+}
+
+func (f *fakeServiceQuery) SetReplicas(service, namespace string, count uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.setCalls = append(f.setCalls, count)
+	f.response.Replicas = count
+	f.response.AvailableReplicas = count
+	return nil
+}
+
+func newTestScaler(query *fakeServiceQuery) FunctionScaler {
+	config := ScalingConfig{
+		MaxPollCount:         10,
+		SetScaleRetries:      3,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Millisecond * 250,
+		ServiceQuery:         query,
+	}
+	return NewFunctionScaler(config, NewFunctionCache(config.CacheExpiry))
+}
+
+func Test_Scale_FromZeroToMinReplicas(t *testing.T) {
+	query := &fakeServiceQuery{response: ServiceQueryResponse{MinReplicas: 2, MaxReplicas: 5}}
+	scaler := newTestScaler(query)
+
+	res := scaler.Scale("figlet", "openfaas-fn")
+	if !res.Available || !res.Found {
+		t.Fatalf("want function to be available, got: %+v", res)
+	}
+
+	if len(query.setCalls) != 1 || query.setCalls[0] != 2 {
+		t.Errorf("want a single scale to 2 replicas, got: %v", query.setCalls)
+	}
+}
+
+func Test_ScaleTo_TargetIsCappedToMaxReplicas(t *testing.T) {
+	query := &fakeServiceQuery{response: ServiceQueryResponse{Replicas: 1, AvailableReplicas: 1, MinReplicas: 1, MaxReplicas: 5}}
+	scaler := newTestScaler(query)
+
+	res := scaler.ScaleTo("figlet", "openfaas-fn", 10)
+	if !res.Available {
+		t.Fatalf("want function to be available, got: %+v", res)
+	}
+
+	if len(query.setCalls) != 1 || query.setCalls[0] != 5 {
+		t.Errorf("want a single scale to 5 replicas, got: %v", query.setCalls)
+	}
+}
+
+func Test_ScaleTo_NoScaleWhenTargetAvailable(t *testing.T) {
+	query := &fakeServiceQuery{response: ServiceQueryResponse{Replicas: 3, AvailableReplicas: 3, MinReplicas: 1, MaxReplicas: 5}}
+	scaler := newTestScaler(query)
+
+	res := scaler.ScaleTo("figlet", "openfaas-fn", 2)
+	if !res.Available {
+		t.Fatalf("want function to be available, got: %+v", res)
+	}
+
+	if len(query.setCalls) != 0 {
+		t.Errorf("want no scale calls, got: %v", query.setCalls)
+	}
+}
+
+func Test_Scale_ReportsAvailableReplicas(t *testing.T) {
+	query := &fakeServiceQuery{response: ServiceQueryResponse{Replicas: 3, AvailableReplicas: 3, MinReplicas: 1}}
+	scaler := newTestScaler(query)
+
+	if res := scaler.Scale("figlet", "openfaas-fn"); res.Replicas != 3 {
+		t.Errorf("live replicas want: %d, got: %d", 3, res.Replicas)
+	}
+	if res := scaler.Scale("figlet", "openfaas-fn"); res.Replicas != 3 {
+		t.Errorf("cached replicas want: %d, got: %d", 3, res.Replicas)
+	}
+}
+
+func Test_Scale_OnScaleFromZeroOnlyForColdStarts(t *testing.T) {
+	query := &fakeServiceQuery{response: ServiceQueryResponse{MinReplicas: 1, MaxReplicas: 5}}
+	scaler := newTestScaler(query)
+
+	events := 0
+	scaler.OnScaleFromZero = func(functionName, namespace string, replicas uint64) {
+		events++
+	}
+
+	scaler.Scale("figlet", "openfaas-fn")
+	scaler.Scale("figlet", "openfaas-fn")
+	scaler.ScaleTo("figlet", "openfaas-fn", 3)
+
+	if events != 1 {
+		t.Errorf("want 1 scale from zero event, got: %d", events)
+	}
+}
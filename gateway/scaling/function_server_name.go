@@ -0,0 +1,53 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// ServerNameAnnotation is the TLS server name (SNI) sent when dialing a
+// function over HTTPS in place of the URL's host, such as for functions
+// behind a shared TLS endpoint
+const ServerNameAnnotation = "com.openfaas.tls.server-name"
+
+// FunctionServerNames reads a function's TLS server name from the
+// annotations held in Cache, in the same way as FunctionTimeouts
+type FunctionServerNames struct {
+	Cache            FunctionCacher
+	DefaultNamespace string
+}
+
+// ServerName returns the server name for the function a request is for,
+// false when it is not a function request or the function has no valid
+// server name
+func (f FunctionServerNames) ServerName(r *http.Request) (string, bool) {
+	serviceName := middleware.GetServiceName(r.URL.Path)
+	if len(serviceName) == 0 {
+		return "", false
+	}
+
+	functionName, namespace := middleware.GetNamespace(f.DefaultNamespace, serviceName)
+	res, _ := f.Cache.Get(functionName, namespace)
+	if res.Annotations == nil {
+		return "", false
+	}
+
+	value, ok := (*res.Annotations)[ServerNameAnnotation]
+	if !ok {
+		return "", false
+	}
+
+	serverName := strings.TrimSpace(value)
+	if len(serverName) == 0 || strings.ContainsAny(serverName, " /:") {
+		log.Printf("Warning: invalid %s annotation %q for function %s.%s, using the URL's host\n",
+			ServerNameAnnotation, value, functionName, namespace)
+		return "", false
+	}
+	return serverName, true
+}
@@ -0,0 +1,46 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_FunctionServerNames_ReadsCachedAnnotation(t *testing.T) {
+	cache := NewFunctionCache(time.Minute)
+	serverNames := FunctionServerNames{Cache: cache, DefaultNamespace: "openfaas-fn"}
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	if _, ok := serverNames.ServerName(req); ok {
+		t.Fatalf("want no server name without a cache entry")
+	}
+
+	cache.Set("echo", "openfaas-fn", ServiceQueryResponse{
+		Annotations: &map[string]string{ServerNameAnnotation: " echo.functions.example.com "},
+	})
+	if got, ok := serverNames.ServerName(req); !ok || got != "echo.functions.example.com" {
+		t.Errorf("want: echo.functions.example.com, got: %q", got)
+	}
+
+	if _, ok := serverNames.ServerName(httptest.NewRequest("GET", "/system/functions", nil)); ok {
+		t.Errorf("want no server name for a request which is not for a function")
+	}
+}
+
+func Test_FunctionServerNames_IgnoresInvalid(t *testing.T) {
+	cache := NewFunctionCache(time.Minute)
+	serverNames := FunctionServerNames{Cache: cache, DefaultNamespace: "openfaas-fn"}
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+
+	for _, value := range []string{"", "example.com:443", "https://example.com", "two names"} {
+		cache.Set("echo", "openfaas-fn", ServiceQueryResponse{
+			Annotations: &map[string]string{ServerNameAnnotation: value},
+		})
+		if got, ok := serverNames.ServerName(req); ok {
+			t.Errorf("%q: want no server name, got: %q", value, got)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// TimeoutAnnotation replaces the gateway's upstream timeout for requests to
+// a function with a Go duration, i.e. "30s" or "2m"
+const TimeoutAnnotation = "com.openfaas.timeout"
+
+// FunctionTimeouts reads a function's timeout from the annotations held in
+// Cache. The provider is never queried, so the timeout follows the cache
+// entry as it is refreshed by other lookups, and the gateway's timeout is
+// used when there is no entry.
+type FunctionTimeouts struct {
+	Cache            FunctionCacher
+	DefaultNamespace string
+
+	// MaxTimeout when set, is the longest timeout a function may have, longer
+	// timeouts are clamped to it
+	MaxTimeout time.Duration
+}
+
+// Timeout returns the timeout for the function a request is for, false when
+// it is not a function request or the function has no valid timeout. An
+// invalid timeout is logged, so that the gateway's timeout is not used
+// without a trace.
+func (f FunctionTimeouts) Timeout(r *http.Request) (time.Duration, bool) {
+	serviceName := middleware.GetServiceName(r.URL.Path)
+	if len(serviceName) == 0 {
+		return 0, false
+	}
+
+	functionName, namespace := middleware.GetNamespace(f.DefaultNamespace, serviceName)
+	res, _ := f.Cache.Get(functionName, namespace)
+	if res.Annotations == nil {
+		return 0, false
+	}
+
+	return f.Resolve(*res.Annotations, functionName+"."+namespace)
+}
+
+// Resolve returns the timeout in a function's annotations, clamped to
+// MaxTimeout, false when the function has no valid timeout
+func (f FunctionTimeouts) Resolve(annotations map[string]string, function string) (time.Duration, bool) {
+	value, ok := annotations[TimeoutAnnotation]
+	if !ok {
+		return 0, false
+	}
+
+	timeout, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || timeout <= 0 {
+		log.Printf("Warning: invalid %s annotation %q for function %s, using the gateway's timeout\n",
+			TimeoutAnnotation, value, function)
+		return 0, false
+	}
+
+	if f.MaxTimeout > 0 && timeout > f.MaxTimeout {
+		log.Printf("Warning: %s annotation of %s for function %s exceeds the maximum, clamped to %s\n",
+			TimeoutAnnotation, timeout, function, f.MaxTimeout)
+		return f.MaxTimeout, true
+	}
+	return timeout, true
+}
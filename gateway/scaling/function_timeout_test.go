@@ -0,0 +1,119 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_FunctionTimeouts_ReadsCachedAnnotation(t *testing.T) {
+	cache := NewFunctionCache(time.Minute)
+	timeouts := FunctionTimeouts{Cache: cache, DefaultNamespace: "openfaas-fn"}
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	if _, ok := timeouts.Timeout(req); ok {
+		t.Fatalf("want no timeout without a cache entry")
+	}
+
+	cache.Set("echo", "openfaas-fn", ServiceQueryResponse{
+		Annotations: &map[string]string{TimeoutAnnotation: "90s"},
+	})
+	if got, ok := timeouts.Timeout(req); !ok || got != time.Second*90 {
+		t.Errorf("want: 90s, got: %s", got)
+	}
+
+	// A refreshed entry replaces the timeout
+	cache.Set("echo", "openfaas-fn", ServiceQueryResponse{
+		Annotations: &map[string]string{TimeoutAnnotation: "5s"},
+	})
+	if got, ok := timeouts.Timeout(req); !ok || got != time.Second*5 {
+		t.Errorf("want: 5s after refresh, got: %s", got)
+	}
+
+	cache.Delete("echo", "openfaas-fn")
+	if _, ok := timeouts.Timeout(req); ok {
+		t.Errorf("want no timeout once the entry is evicted")
+	}
+}
+
+func Test_FunctionTimeouts_IgnoresSystemPathsAndInvalidValues(t *testing.T) {
+	cache := NewFunctionCache(time.Minute)
+	timeouts := FunctionTimeouts{Cache: cache, DefaultNamespace: "openfaas-fn"}
+
+	cache.Set("echo", "openfaas-fn", ServiceQueryResponse{
+		Annotations: &map[string]string{TimeoutAnnotation: "soon"},
+	})
+
+	if _, ok := timeouts.Timeout(httptest.NewRequest("GET", "/function/echo", nil)); ok {
+		t.Errorf("want an invalid timeout to be ignored")
+	}
+	if _, ok := timeouts.Timeout(httptest.NewRequest("GET", "/system/functions", nil)); ok {
+		t.Errorf("want no timeout for a system path")
+	}
+}
+
+func Test_FunctionTimeouts_ParsesDurations(t *testing.T) {
+	cache := NewFunctionCache(time.Minute)
+	timeouts := FunctionTimeouts{Cache: cache, DefaultNamespace: "openfaas-fn"}
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+
+	cases := map[string]time.Duration{
+		"30s":    time.Second * 30,
+		"2m":     time.Minute * 2,
+		" 1m30s": time.Second * 90,
+		"500ms":  time.Millisecond * 500,
+	}
+	for value, want := range cases {
+		cache.Set("echo", "openfaas-fn", ServiceQueryResponse{
+			Annotations: &map[string]string{TimeoutAnnotation: value},
+		})
+		if got, ok := timeouts.Timeout(req); !ok || got != want {
+			t.Errorf("%q: want: %s, got: %s (ok: %t)", value, want, got, ok)
+		}
+	}
+}
+
+func Test_FunctionTimeouts_InvalidValuesFallBack(t *testing.T) {
+	cache := NewFunctionCache(time.Minute)
+	timeouts := FunctionTimeouts{Cache: cache, DefaultNamespace: "openfaas-fn"}
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+
+	for _, value := range []string{"", "30", "soon", "-5s", "0s", "2 minutes"} {
+		cache.Set("echo", "openfaas-fn", ServiceQueryResponse{
+			Annotations: &map[string]string{TimeoutAnnotation: value},
+		})
+		if got, ok := timeouts.Timeout(req); ok {
+			t.Errorf("%q: want the gateway's timeout, got: %s", value, got)
+		}
+	}
+}
+
+func Test_FunctionTimeouts_ClampedToMax(t *testing.T) {
+	cache := NewFunctionCache(time.Minute)
+	timeouts := FunctionTimeouts{Cache: cache, DefaultNamespace: "openfaas-fn", MaxTimeout: time.Minute * 5}
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+
+	cache.Set("echo", "openfaas-fn", ServiceQueryResponse{
+		Annotations: &map[string]string{TimeoutAnnotation: "1h"},
+	})
+	if got, ok := timeouts.Timeout(req); !ok || got != time.Minute*5 {
+		t.Errorf("want clamped to: %s, got: %s", time.Minute*5, got)
+	}
+
+	cache.Set("echo", "openfaas-fn", ServiceQueryResponse{
+		Annotations: &map[string]string{TimeoutAnnotation: "5m"},
+	})
+	if got, ok := timeouts.Timeout(req); !ok || got != time.Minute*5 {
+		t.Errorf("want a timeout at the max to be kept: %s, got: %s", time.Minute*5, got)
+	}
+
+	cache.Set("echo", "openfaas-fn", ServiceQueryResponse{
+		Annotations: &map[string]string{TimeoutAnnotation: "2m"},
+	})
+	if got, ok := timeouts.Timeout(req); !ok || got != time.Minute*2 {
+		t.Errorf("want: %s, got: %s", time.Minute*2, got)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthScore picks the healthier of two random endpoints, scored by their
+// recent response codes and latencies
+const HealthScore = "health-score"
+
+// OutcomeObserver is implemented by a LoadBalancer which picks endpoints by
+// the status code and latency of the requests sent to them
+type OutcomeObserver interface {
+	// Observe the outcome of a request to endpoint, which is one of the
+	// function's current endpoints
+	Observe(function, endpoint string, endpoints []string, statusCode int, duration time.Duration)
+}
+
+// HealthScoreConfig sets how endpoints are scored by a HealthScoreBalancer
+type HealthScoreConfig struct {
+	// Decay is the weight of each new outcome in the moving averages,
+	// between 0 and 1, a higher decay reacts faster
+	Decay float64
+
+	// LatencyTarget is the average latency at which an endpoint's score is
+	// halved
+	LatencyTarget time.Duration
+
+	// MinScore is the lowest score of an endpoint, so that a degraded
+	// endpoint still receives some requests and can recover
+	MinScore float64
+}
+
+// DefaultHealthScoreConfig is used by NewLoadBalancer
+var DefaultHealthScoreConfig = HealthScoreConfig{
+	Decay:         0.1,
+	LatencyTarget: time.Millisecond * 100,
+	MinScore:      0.05,
+}
+
+type endpointScore struct {
+	success float64
+	latency float64
+}
+
+// HealthScoreBalancer smooths requests away from degraded endpoints without
+// ejecting them. Each endpoint has an exponentially weighted moving average
+// of its success, where connection errors, 5xx and 429 responses fail, and
+// of its latency. Two endpoints are chosen at random and one of them is
+// picked in proportion to their scores. The scores of endpoints a function
+// no longer has are dropped once its endpoints change.
+type HealthScoreBalancer struct {
+	config    HealthScoreConfig
+	endpoints map[string]*endpointScore
+
+	// functions are the endpoints each function had when last observed
+	functions map[string][]string
+
+	lock sync.Mutex
+}
+
+// NewHealthScoreBalancer creates a HealthScoreBalancer
+func NewHealthScoreBalancer(config HealthScoreConfig) *HealthScoreBalancer {
+	return &HealthScoreBalancer{
+		config:    config,
+		endpoints: make(map[string]*endpointScore),
+		functions: make(map[string][]string),
+	}
+}
+
+// Pick one of two random endpoints in proportion to their scores
+func (b *HealthScoreBalancer) Pick(r *http.Request, endpoints []string) string {
+	if len(endpoints) == 1 {
+		return endpoints[0]
+	}
+
+	i := rand.Intn(len(endpoints))
+	j := rand.Intn(len(endpoints) - 1)
+	if j >= i {
+		j++
+	}
+
+	b.lock.Lock()
+	first, second := b.score(endpoints[i]), b.score(endpoints[j])
+	b.lock.Unlock()
+
+	if rand.Float64()*(first+second) < first {
+		return endpoints[i]
+	}
+	return endpoints[j]
+}
+
+// Release does nothing, outcomes are recorded by Observe
+func (b *HealthScoreBalancer) Release(endpoint string, failed bool) {}
+
+// Observe the outcome of a request to endpoint, which is one of the
+// function's current endpoints
+func (b *HealthScoreBalancer) Observe(function, endpoint string, endpoints []string, statusCode int, duration time.Duration) {
+	success := 1.0
+	if statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests {
+		success = 0
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.prune(function, endpoints)
+
+	score, ok := b.endpoints[endpoint]
+	if !ok {
+		b.endpoints[endpoint] = &endpointScore{success: success, latency: float64(duration)}
+		return
+	}
+	score.success += b.config.Decay * (success - score.success)
+	score.latency += b.config.Decay * (float64(duration) - score.latency)
+}
+
+// prune drops the scores of endpoints the function had when last observed,
+// but no longer has
+func (b *HealthScoreBalancer) prune(function string, endpoints []string) {
+	previous, ok := b.functions[function]
+	if ok && sameEndpoints(previous, endpoints) {
+		return
+	}
+
+	current := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		current[endpoint] = true
+	}
+	for _, endpoint := range previous {
+		if !current[endpoint] {
+			delete(b.endpoints, endpoint)
+		}
+	}
+
+	b.functions[function] = append([]string(nil), endpoints...)
+}
+
+func sameEndpoints(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Score returns the score of endpoint, 1 for an endpoint without outcomes
+func (b *HealthScoreBalancer) Score(endpoint string) float64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.score(endpoint)
+}
+
+func (b *HealthScoreBalancer) score(endpoint string) float64 {
+	score, ok := b.endpoints[endpoint]
+	if !ok {
+		return 1
+	}
+
+	value := score.success
+	if b.config.LatencyTarget > 0 {
+		target := float64(b.config.LatencyTarget)
+		value *= target / (target + score.latency)
+	}
+	if value < b.config.MinScore {
+		return b.config.MinScore
+	}
+	return value
+}
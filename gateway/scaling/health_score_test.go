@@ -0,0 +1,103 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_HealthScoreBalancer_SkewsTowardHealthierEndpoint(t *testing.T) {
+	balancer := NewHealthScoreBalancer(DefaultHealthScoreConfig)
+	endpoints := []string{"healthy", "degraded"}
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+
+	picks := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		endpoint := balancer.Pick(req, endpoints)
+		picks[endpoint]++
+
+		if endpoint == "healthy" {
+			balancer.Observe("echo", endpoint, endpoints, http.StatusOK, time.Millisecond*10)
+		} else if i%2 == 0 {
+			balancer.Observe("echo", endpoint, endpoints, http.StatusServiceUnavailable, time.Millisecond*200)
+		} else {
+			balancer.Observe("echo", endpoint, endpoints, http.StatusOK, time.Millisecond*200)
+		}
+	}
+
+	if picks["healthy"] < 1600 {
+		t.Errorf("want most requests sent to the healthy endpoint, got: %v", picks)
+	}
+	if picks["degraded"] == 0 {
+		t.Errorf("want the degraded endpoint to still receive requests, got: %v", picks)
+	}
+}
+
+func Test_HealthScoreBalancer_Score(t *testing.T) {
+	balancer := NewHealthScoreBalancer(HealthScoreConfig{
+		Decay:         0.5,
+		LatencyTarget: time.Millisecond * 100,
+		MinScore:      0.1,
+	})
+
+	endpoints := []string{"slow", "throttled"}
+	if got := balancer.Score("new"); got != 1 {
+		t.Errorf("score of an endpoint without outcomes want: 1, got: %f", got)
+	}
+
+	balancer.Observe("echo", "slow", endpoints, http.StatusOK, time.Millisecond*100)
+	if got := balancer.Score("slow"); got != 0.5 {
+		t.Errorf("score at the latency target want: 0.5, got: %f", got)
+	}
+
+	balancer.Observe("echo", "throttled", endpoints, http.StatusTooManyRequests, time.Millisecond)
+	if got := balancer.Score("throttled"); got != 0.1 {
+		t.Errorf("score want the minimum: 0.1, got: %f", got)
+	}
+
+	balancer.Observe("echo", "throttled", endpoints, http.StatusOK, 0)
+	if got := balancer.Score("throttled"); got <= 0.1 || got >= 0.5 {
+		t.Errorf("score want to recover to half its success, got: %f", got)
+	}
+}
+
+func Test_HealthScoreBalancer_DropsRemovedEndpoints(t *testing.T) {
+	balancer := NewHealthScoreBalancer(DefaultHealthScoreConfig)
+
+	balancer.Observe("echo", "blue-1", []string{"blue-1", "blue-2"}, http.StatusBadGateway, time.Millisecond)
+	balancer.Observe("echo", "blue-2", []string{"blue-1", "blue-2"}, http.StatusBadGateway, time.Millisecond)
+	balancer.Observe("env", "env-1", []string{"env-1"}, http.StatusBadGateway, time.Millisecond)
+
+	// blue-1 was replaced by green-1
+	balancer.Observe("echo", "green-1", []string{"green-1", "blue-2"}, http.StatusOK, time.Millisecond)
+
+	if _, ok := balancer.endpoints["blue-1"]; ok {
+		t.Errorf("want the score of a removed endpoint dropped")
+	}
+	for _, endpoint := range []string{"blue-2", "green-1", "env-1"} {
+		if _, ok := balancer.endpoints[endpoint]; !ok {
+			t.Errorf("want the score of %s kept", endpoint)
+		}
+	}
+}
+
+func Test_EndpointBaseURLResolver_ReportsOutcomes(t *testing.T) {
+	cache := NewFunctionCache(time.Second)
+	resolver := NewEndpointBaseURLResolver(cache, nil, "openfaas-fn")
+	balancer := NewHealthScoreBalancer(DefaultHealthScoreConfig)
+	resolver.SetBalancer(HealthScore, balancer)
+	resolver.DefaultPolicy = HealthScore
+
+	cache.SwapEndpoints("echo", "openfaas-fn", []string{"http://green-1:8080/", "http://green-2:8080/"})
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	resolver.Report(req, "http://green-1:8080", http.StatusBadGateway, time.Millisecond)
+
+	if got := balancer.Score("http://green-1:8080/"); got != DefaultHealthScoreConfig.MinScore {
+		t.Errorf("score want: %f, got: %f", DefaultHealthScoreConfig.MinScore, got)
+	}
+}
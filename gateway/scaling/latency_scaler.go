@@ -0,0 +1,45 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// ScaleForLatency requests LatencyScaleStep more replicas in the background
+// when a request waited longer than the LatencyTarget. Concurrent requests
+// for the same function share a single scale up. true is returned when a
+// scale up was requested.
+func (f *FunctionScaler) ScaleForLatency(functionName, namespace string, waited time.Duration) bool {
+	if f.Config.LatencyTarget <= 0 || waited <= f.Config.LatencyTarget {
+		return false
+	}
+
+	cached, _ := f.Cache.Get(functionName, namespace)
+	if cached.MaxReplicas > 0 && cached.Replicas >= cached.MaxReplicas {
+		return false
+	}
+
+	step := f.Config.LatencyScaleStep
+	if step == 0 {
+		step = 1
+	}
+	target := cached.Replicas + step
+
+	key := fmt.Sprintf("LatencyScale-%s.%s", functionName, namespace)
+	go f.SingleFlight.Do(key, func() (interface{}, error) {
+		log.Printf("[Scale] function=%s.%s waited %.4fs, over the latency target of %s, %d => %d requested",
+			functionName, namespace, waited.Seconds(), f.Config.LatencyTarget, cached.Replicas, target)
+
+		if f.Config.LatencyScaleUps != nil {
+			f.Config.LatencyScaleUps.WithLabelValues(functionName + "." + namespace).Inc()
+		}
+
+		res := f.ScaleTo(functionName, namespace, target)
+		return nil, res.Error
+	})
+	return true
+}
@@ -0,0 +1,68 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func Test_ScaleForLatency_UnderTargetDoesNothing(t *testing.T) {
+	query := &fakeServiceQuery{response: ServiceQueryResponse{Replicas: 1, AvailableReplicas: 1, MaxReplicas: 5}}
+	scaler := newTestScaler(query)
+	scaler.Config.LatencyTarget = time.Second
+
+	if scaler.ScaleForLatency("figlet", "openfaas-fn", time.Millisecond*10) {
+		t.Errorf("want no scale up under the latency target")
+	}
+}
+
+func Test_ScaleForLatency_OverTargetAddsStep(t *testing.T) {
+	query := &fakeServiceQuery{response: ServiceQueryResponse{Replicas: 2, AvailableReplicas: 2, MinReplicas: 1, MaxReplicas: 5}}
+	scaler := newTestScaler(query)
+	scaler.Config.LatencyTarget = time.Millisecond * 100
+	scaler.Config.LatencyScaleStep = 2
+	scaler.Config.LatencyScaleUps = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_latency_scale_ups"}, []string{"function_name"})
+	scaler.Cache.Set("figlet", "openfaas-fn", query.response)
+
+	if !scaler.ScaleForLatency("figlet", "openfaas-fn", time.Millisecond*200) {
+		t.Fatalf("want a scale up over the latency target")
+	}
+
+	for i := 0; i < 100; i++ {
+		query.lock.Lock()
+		calls := len(query.setCalls)
+		query.lock.Unlock()
+		if calls > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	query.lock.Lock()
+	defer query.lock.Unlock()
+	if len(query.setCalls) != 1 || query.setCalls[0] != 4 {
+		t.Errorf("want a scale to 4 replicas, got: %v", query.setCalls)
+	}
+
+	metric := &dto.Metric{}
+	scaler.Config.LatencyScaleUps.WithLabelValues("figlet.openfaas-fn").Write(metric)
+	if got := metric.GetCounter().GetValue(); got != 1 {
+		t.Errorf("want 1 latency scale up counted, got: %f", got)
+	}
+}
+
+func Test_ScaleForLatency_AtMaxReplicasDoesNothing(t *testing.T) {
+	query := &fakeServiceQuery{response: ServiceQueryResponse{Replicas: 5, AvailableReplicas: 5, MaxReplicas: 5}}
+	scaler := newTestScaler(query)
+	scaler.Config.LatencyTarget = time.Millisecond
+	scaler.Cache.Set("figlet", "openfaas-fn", query.response)
+
+	if scaler.ScaleForLatency("figlet", "openfaas-fn", time.Second) {
+		t.Errorf("want no scale up at the maximum replicas")
+	}
+}
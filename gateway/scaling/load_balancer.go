@@ -0,0 +1,177 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// LoadBalancerAnnotation selects the policy used to pick one of a
+	// function's endpoints, overriding the gateway's default
+	LoadBalancerAnnotation = "com.openfaas.load-balancer"
+
+	// RoundRobin picks each endpoint in turn
+	RoundRobin = "round-robin"
+	// LeastConnections picks the endpoint with the fewest requests in flight
+	LeastConnections = "least-connections"
+	// Random picks an endpoint at random
+	Random = "random"
+	// ConsistentHash picks the same endpoint for the same hash key
+	ConsistentHash = "consistent-hash"
+
+	// HashKeyHeader is the request header used as the key by ConsistentHash,
+	// when it is not set the client's address is used
+	HashKeyHeader = "X-Hash-Key"
+)
+
+// LoadBalancerPolicies are the policies a function can select
+var LoadBalancerPolicies = []string{RoundRobin, LeastConnections, Random, ConsistentHash, HealthScore}
+
+// LoadBalancerPolicy returns the policy in a function's annotation when it is
+// one of LoadBalancerPolicies, otherwise defaultPolicy and false
+func LoadBalancerPolicy(annotations map[string]string, defaultPolicy string) (string, bool) {
+	if value, ok := annotations[LoadBalancerAnnotation]; ok {
+		policy := strings.TrimSpace(value)
+		for _, known := range LoadBalancerPolicies {
+			if policy == known {
+				return policy, true
+			}
+		}
+	}
+	return defaultPolicy, false
+}
+
+// LoadBalancer picks one endpoint from a function's endpoints for a request
+type LoadBalancer interface {
+	// Pick returns one of endpoints, which is never empty
+	Pick(r *http.Request, endpoints []string) string
+
+	// Release is called once the request sent to an endpoint returned by
+	// Pick has completed, failed is true when the endpoint could not be
+	// reached or returned a server error
+	Release(endpoint string, failed bool)
+}
+
+// NewLoadBalancer creates a LoadBalancer for a policy
+func NewLoadBalancer(policy string) (LoadBalancer, error) {
+	switch policy {
+	case RoundRobin:
+		return &RoundRobinBalancer{}, nil
+	case LeastConnections:
+		return NewLeastConnectionsBalancer(), nil
+	case Random:
+		return RandomBalancer{}, nil
+	case ConsistentHash:
+		return ConsistentHashBalancer{}, nil
+	case HealthScore:
+		return NewHealthScoreBalancer(DefaultHealthScoreConfig), nil
+	}
+	return nil, fmt.Errorf("unknown load balancer: %q, use one of: %s, %s, %s, %s, %s",
+		policy, RoundRobin, LeastConnections, Random, ConsistentHash, HealthScore)
+}
+
+// RoundRobinBalancer picks each endpoint in turn
+type RoundRobinBalancer struct {
+	next uint64
+}
+
+// Pick the next endpoint
+func (b *RoundRobinBalancer) Pick(r *http.Request, endpoints []string) string {
+	i := atomic.AddUint64(&b.next, 1)
+	return endpoints[i%uint64(len(endpoints))]
+}
+
+// Release does nothing
+func (b *RoundRobinBalancer) Release(endpoint string, failed bool) {}
+
+// RandomBalancer picks an endpoint at random
+type RandomBalancer struct{}
+
+// Pick a random endpoint
+func (RandomBalancer) Pick(r *http.Request, endpoints []string) string {
+	return endpoints[rand.Intn(len(endpoints))]
+}
+
+// Release does nothing
+func (RandomBalancer) Release(endpoint string, failed bool) {}
+
+// ConsistentHashBalancer picks the same endpoint for requests with the same
+// X-Hash-Key header or client address. Rendezvous hashing is used so that
+// only the keys of an endpoint which is added or removed move elsewhere.
+type ConsistentHashBalancer struct{}
+
+// Pick the endpoint with the highest hash for the request's key
+func (ConsistentHashBalancer) Pick(r *http.Request, endpoints []string) string {
+	key := r.Header.Get(HashKeyHeader)
+	if len(key) == 0 {
+		key = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			key = host
+		}
+	}
+
+	var picked string
+	var highest uint64
+	for _, endpoint := range endpoints {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte(endpoint))
+		if sum := h.Sum64(); len(picked) == 0 || sum > highest {
+			picked, highest = endpoint, sum
+		}
+	}
+	return picked
+}
+
+// Release does nothing
+func (ConsistentHashBalancer) Release(endpoint string, failed bool) {}
+
+// LeastConnectionsBalancer picks the endpoint with the fewest requests in flight
+type LeastConnectionsBalancer struct {
+	inFlight map[string]int
+	lock     sync.Mutex
+}
+
+// NewLeastConnectionsBalancer creates a LeastConnectionsBalancer
+func NewLeastConnectionsBalancer() *LeastConnectionsBalancer {
+	return &LeastConnectionsBalancer{
+		inFlight: make(map[string]int),
+	}
+}
+
+// Pick the endpoint with the fewest requests in flight
+func (b *LeastConnectionsBalancer) Pick(r *http.Request, endpoints []string) string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	picked := endpoints[0]
+	for _, endpoint := range endpoints[1:] {
+		if b.inFlight[endpoint] < b.inFlight[picked] {
+			picked = endpoint
+		}
+	}
+
+	b.inFlight[picked]++
+	return picked
+}
+
+// Release the request in flight to endpoint
+func (b *LeastConnectionsBalancer) Release(endpoint string, failed bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.inFlight[endpoint] <= 1 {
+		delete(b.inFlight, endpoint)
+		return
+	}
+	b.inFlight[endpoint]--
+}
@@ -0,0 +1,74 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_NewLoadBalancer_UnknownPolicy(t *testing.T) {
+	if _, err := NewLoadBalancer("fastest"); err == nil {
+		t.Errorf("want an error for an unknown policy")
+	}
+}
+
+func Test_RoundRobinBalancer(t *testing.T) {
+	balancer := &RoundRobinBalancer{}
+	endpoints := []string{"a", "b", "c"}
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+
+	seen := map[string]int{}
+	for i := 0; i < 6; i++ {
+		seen[balancer.Pick(req, endpoints)]++
+	}
+	for _, endpoint := range endpoints {
+		if seen[endpoint] != 2 {
+			t.Errorf("want each endpoint picked twice, got: %v", seen)
+		}
+	}
+}
+
+func Test_ConsistentHashBalancer_SameKeySameEndpoint(t *testing.T) {
+	balancer := ConsistentHashBalancer{}
+	endpoints := []string{"a", "b", "c", "d"}
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	req.Header.Set(HashKeyHeader, "user-1")
+	want := balancer.Pick(req, endpoints)
+
+	for i := 0; i < 5; i++ {
+		if got := balancer.Pick(req, endpoints); got != want {
+			t.Fatalf("want %s for the same key, got: %s", want, got)
+		}
+	}
+
+	// Removing another endpoint must not move the key
+	var remaining []string
+	for _, endpoint := range endpoints {
+		if endpoint == want || len(remaining) < 2 {
+			remaining = append(remaining, endpoint)
+		}
+	}
+	if got := balancer.Pick(req, remaining); got != want {
+		t.Errorf("want %s after removing an endpoint, got: %s", want, got)
+	}
+}
+
+func Test_LeastConnectionsBalancer(t *testing.T) {
+	balancer := NewLeastConnectionsBalancer()
+	endpoints := []string{"a", "b"}
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+
+	first := balancer.Pick(req, endpoints)
+	second := balancer.Pick(req, endpoints)
+	if first == second {
+		t.Fatalf("want requests in flight spread over both endpoints, got: %s twice", first)
+	}
+
+	balancer.Release(second, false)
+	if got := balancer.Pick(req, endpoints); got != second {
+		t.Errorf("want the endpoint with the fewest requests in flight: %s, got: %s", second, got)
+	}
+}
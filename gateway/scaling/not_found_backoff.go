@@ -0,0 +1,151 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// NotFoundBackoff tracks not-found responses per client and function so that
+// repeated requests for a missing function can be rejected without querying
+// the provider. Entries are forgotten after Cooldown without a request and
+// at most MaxEntries are kept, evicting the least recently seen entry.
+type NotFoundBackoff struct {
+	// Threshold is the amount of not-found responses before backing off
+	Threshold int
+
+	// Cooldown is the time without requests before an entry is reset, it is
+	// also the maximum Retry-After returned to a client
+	Cooldown time.Duration
+
+	// MaxEntries bounds the amount of client/function pairs tracked
+	MaxEntries int
+
+	entries map[string]*list.Element
+	order   *list.List
+	lock    sync.Mutex
+}
+
+type notFoundEntry struct {
+	key      string
+	count    int
+	lastSeen time.Time
+}
+
+// NewNotFoundBackoff creates a NotFoundBackoff
+func NewNotFoundBackoff(threshold int, cooldown time.Duration, maxEntries int) *NotFoundBackoff {
+	return &NotFoundBackoff{
+		Threshold:  threshold,
+		Cooldown:   cooldown,
+		MaxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Check returns true and the duration a client should wait when it has
+// exceeded the threshold for a function. A rejected request extends the
+// backoff, so the Retry-After doubles up to the Cooldown.
+func (b *NotFoundBackoff) Check(client, function string) (time.Duration, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	element, ok := b.entries[client+"/"+function]
+	if !ok {
+		return 0, false
+	}
+
+	now := time.Now()
+	entry := element.Value.(*notFoundEntry)
+	if now.Sub(entry.lastSeen) > b.Cooldown {
+		b.remove(element)
+		return 0, false
+	}
+
+	if entry.count < b.Threshold {
+		return 0, false
+	}
+
+	entry.count++
+	entry.lastSeen = now
+	b.order.MoveToFront(element)
+
+	retryAfter := time.Second
+	for i := b.Threshold; i < entry.count-1 && retryAfter < b.Cooldown; i++ {
+		retryAfter = retryAfter * 2
+	}
+	if retryAfter > b.Cooldown {
+		retryAfter = b.Cooldown
+	}
+	return retryAfter, true
+}
+
+// Record records a not-found response for a client and function
+func (b *NotFoundBackoff) Record(client, function string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	key := client + "/" + function
+	now := time.Now()
+
+	element, ok := b.entries[key]
+	if ok && now.Sub(element.Value.(*notFoundEntry).lastSeen) > b.Cooldown {
+		b.remove(element)
+		ok = false
+	}
+
+	if !ok {
+		b.evict(now)
+		element = b.order.PushFront(&notFoundEntry{key: key})
+		b.entries[key] = element
+	}
+
+	entry := element.Value.(*notFoundEntry)
+	entry.count++
+	entry.lastSeen = now
+	b.order.MoveToFront(element)
+}
+
+// Reset forgets a client and function, i.e. when the function is found
+func (b *NotFoundBackoff) Reset(client, function string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if element, ok := b.entries[client+"/"+function]; ok {
+		b.remove(element)
+	}
+}
+
+// Flush forgets every client and function and returns how many were tracked
+func (b *NotFoundBackoff) Flush() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	flushed := len(b.entries)
+	b.entries = make(map[string]*list.Element)
+	b.order.Init()
+	return flushed
+}
+
+// evict removes expired entries, then the least recently seen entries until
+// there is room for a new one. Entries are kept in the order they were last
+// seen, so both are found at the back of the list. The caller must hold the
+// lock.
+func (b *NotFoundBackoff) evict(now time.Time) {
+	for oldest := b.order.Back(); oldest != nil && now.Sub(oldest.Value.(*notFoundEntry).lastSeen) > b.Cooldown; oldest = b.order.Back() {
+		b.remove(oldest)
+	}
+
+	for b.order.Len() > 0 && b.order.Len() >= b.MaxEntries {
+		b.remove(b.order.Back())
+	}
+}
+
+// remove forgets an entry, the caller must hold the lock
+func (b *NotFoundBackoff) remove(element *list.Element) {
+	b.order.Remove(element)
+	delete(b.entries, element.Value.(*notFoundEntry).key)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_NotFoundBackoff_RejectsAfterThreshold(t *testing.T) {
+	backoff := NewNotFoundBackoff(2, time.Minute, 10)
+
+	backoff.Record("10.0.0.1", "figlet.openfaas-fn")
+	if _, ok := backoff.Check("10.0.0.1", "figlet.openfaas-fn"); ok {
+		t.Fatalf("want no backoff below the threshold")
+	}
+
+	backoff.Record("10.0.0.1", "figlet.openfaas-fn")
+
+	retryAfter, ok := backoff.Check("10.0.0.1", "figlet.openfaas-fn")
+	if !ok || retryAfter != time.Second {
+		t.Fatalf("want backoff of 1s, got: %s %v", retryAfter, ok)
+	}
+
+	retryAfter, _ = backoff.Check("10.0.0.1", "figlet.openfaas-fn")
+	if retryAfter != time.Second*2 {
+		t.Errorf("want backoff to double to 2s, got: %s", retryAfter)
+	}
+
+	if _, ok := backoff.Check("10.0.0.2", "figlet.openfaas-fn"); ok {
+		t.Errorf("want other clients to be unaffected")
+	}
+}
+
+func Test_NotFoundBackoff_ResetsAfterCooldown(t *testing.T) {
+	backoff := NewNotFoundBackoff(1, time.Millisecond, 10)
+
+	backoff.Record("10.0.0.1", "figlet.openfaas-fn")
+	time.Sleep(time.Millisecond * 2)
+
+	if _, ok := backoff.Check("10.0.0.1", "figlet.openfaas-fn"); ok {
+		t.Errorf("want backoff to be reset after the cooldown")
+	}
+}
+
+func Test_NotFoundBackoff_EvictsOldestEntry(t *testing.T) {
+	backoff := NewNotFoundBackoff(1, time.Minute, 2)
+
+	backoff.Record("10.0.0.1", "figlet.openfaas-fn")
+	backoff.Record("10.0.0.2", "figlet.openfaas-fn")
+	backoff.Record("10.0.0.3", "figlet.openfaas-fn")
+
+	if len(backoff.entries) != 2 {
+		t.Fatalf("want 2 entries, got: %d", len(backoff.entries))
+	}
+	if _, ok := backoff.Check("10.0.0.1", "figlet.openfaas-fn"); ok {
+		t.Errorf("want oldest entry to have been evicted")
+	}
+}
+
+func Test_NotFoundBackoff_Flush(t *testing.T) {
+	backoff := NewNotFoundBackoff(1, time.Minute, 10)
+	backoff.Record("10.0.0.1", "missing.openfaas-fn")
+	backoff.Record("10.0.0.2", "missing.openfaas-fn")
+
+	if flushed := backoff.Flush(); flushed != 2 {
+		t.Errorf("want 2 entries flushed, got: %d", flushed)
+	}
+	if _, ok := backoff.Check("10.0.0.1", "missing.openfaas-fn"); ok {
+		t.Errorf("want no backoff after a flush")
+	}
+}
+
+func Test_NotFoundBackoff_EvictsLeastRecentlySeenEntry(t *testing.T) {
+	backoff := NewNotFoundBackoff(1, time.Minute, 2)
+
+	backoff.Record("10.0.0.1", "figlet.openfaas-fn")
+	backoff.Record("10.0.0.2", "figlet.openfaas-fn")
+	backoff.Check("10.0.0.1", "figlet.openfaas-fn")
+	backoff.Record("10.0.0.3", "figlet.openfaas-fn")
+
+	if _, ok := backoff.Check("10.0.0.1", "figlet.openfaas-fn"); !ok {
+		t.Errorf("want recently seen entry to be kept")
+	}
+	if _, ok := backoff.Check("10.0.0.2", "figlet.openfaas-fn"); ok {
+		t.Errorf("want least recently seen entry to have been evicted")
+	}
+	if len(backoff.entries) != backoff.order.Len() {
+		t.Errorf("want %d entries in order, got: %d", len(backoff.entries), backoff.order.Len())
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// OutlierFailuresAnnotation is the amount of consecutive failed requests
+	// after which an endpoint is ejected, 0 disables ejection for the function
+	OutlierFailuresAnnotation = "com.openfaas.outlier.consecutive-failures"
+
+	// OutlierEjectionTimeAnnotation is how long an endpoint stays ejected
+	// before a probe request is sent to it
+	OutlierEjectionTimeAnnotation = "com.openfaas.outlier.ejection-time"
+)
+
+type endpointHealth struct {
+	failures     int
+	ejectedUntil time.Time
+	probeUntil   time.Time
+}
+
+// OutlierDetector ejects endpoints which fail consecutive requests, with
+// connection errors or 5xx responses, from the endpoints a LoadBalancer
+// picks from. Once the ejection time has passed a single probe request is
+// sent to the endpoint, which re-admits it on success or ejects it again.
+// The last available endpoint of a function is never ejected.
+type OutlierDetector struct {
+	// ConsecutiveFailures is used for functions without the annotation
+	ConsecutiveFailures int
+
+	// EjectionTime is used for functions without the annotation
+	EjectionTime time.Duration
+
+	// Ejections is incremented for each ejection when set
+	Ejections *prometheus.CounterVec
+
+	endpoints map[string]*endpointHealth
+	lock      sync.Mutex
+}
+
+// NewOutlierDetector creates an OutlierDetector
+func NewOutlierDetector(consecutiveFailures int, ejectionTime time.Duration, ejections *prometheus.CounterVec) *OutlierDetector {
+	return &OutlierDetector{
+		ConsecutiveFailures: consecutiveFailures,
+		EjectionTime:        ejectionTime,
+		Ejections:           ejections,
+		endpoints:           make(map[string]*endpointHealth),
+	}
+}
+
+// outlierPolicy is read from a function's annotations
+type outlierPolicy struct {
+	failures     int
+	ejectionTime time.Duration
+}
+
+func (o *OutlierDetector) policy(annotations map[string]string) outlierPolicy {
+	failures, _ := OutlierFailures(annotations, o.ConsecutiveFailures)
+	ejectionTime, _ := OutlierEjectionTime(annotations, o.EjectionTime)
+	return outlierPolicy{failures: failures, ejectionTime: ejectionTime}
+}
+
+// OutlierFailures returns the consecutive failures which eject an endpoint
+// of a function from its annotation, otherwise defaultFailures and false
+func OutlierFailures(annotations map[string]string, defaultFailures int) (int, bool) {
+	if value, ok := annotations[OutlierFailuresAnnotation]; ok {
+		if failures, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && failures >= 0 {
+			return failures, true
+		}
+	}
+	return defaultFailures, false
+}
+
+// OutlierEjectionTime returns how long an endpoint of a function is ejected
+// for from its annotation, otherwise defaultEjectionTime and false
+func OutlierEjectionTime(annotations map[string]string, defaultEjectionTime time.Duration) (time.Duration, bool) {
+	if value, ok := annotations[OutlierEjectionTimeAnnotation]; ok {
+		if ejectionTime, err := time.ParseDuration(strings.TrimSpace(value)); err == nil && ejectionTime > 0 {
+			return ejectionTime, true
+		}
+	}
+	return defaultEjectionTime, false
+}
+
+// Available returns the endpoints which have not been ejected. When an
+// ejected endpoint is due a probe it is returned on its own, so that the
+// request is sent to it. Every endpoint is returned when all are ejected.
+func (o *OutlierDetector) Available(endpoints []string, policy outlierPolicy) []string {
+	if policy.failures == 0 {
+		return endpoints
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	now := time.Now()
+	available := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		health, ok := o.endpoints[endpoint]
+		if !ok || health.ejectedUntil.IsZero() {
+			available = append(available, endpoint)
+			continue
+		}
+
+		if now.After(health.ejectedUntil) && now.After(health.probeUntil) {
+			// Give up on a probe which was never reported after the ejection time
+			health.probeUntil = now.Add(policy.ejectionTime)
+			return []string{endpoint}
+		}
+	}
+
+	if len(available) == 0 {
+		return endpoints
+	}
+	return available
+}
+
+// Record the outcome of a request to endpoint, one of the function's endpoints
+func (o *OutlierDetector) Record(function, endpoint string, endpoints []string, failed bool, policy outlierPolicy) {
+	if policy.failures == 0 {
+		return
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	health, ok := o.endpoints[endpoint]
+	if !ok {
+		health = &endpointHealth{}
+		o.endpoints[endpoint] = health
+	}
+
+	if !failed {
+		if !health.ejectedUntil.IsZero() {
+			log.Printf("Outlier detection: %s re-admitted %s\n", function, endpoint)
+		}
+		*health = endpointHealth{}
+		return
+	}
+
+	health.failures++
+	probeFailed := !health.ejectedUntil.IsZero()
+	if !probeFailed && health.failures < policy.failures {
+		return
+	}
+
+	if !probeFailed && !o.othersAvailable(endpoint, endpoints) {
+		return
+	}
+
+	health.failures = 0
+	health.ejectedUntil = time.Now().Add(policy.ejectionTime)
+	health.probeUntil = time.Time{}
+
+	if !probeFailed {
+		log.Printf("Outlier detection: %s ejected %s for %s\n", function, endpoint, policy.ejectionTime)
+		if o.Ejections != nil {
+			o.Ejections.WithLabelValues(function, endpoint).Inc()
+		}
+	}
+}
+
+// othersAvailable returns true when an endpoint other than endpoint has not
+// been ejected
+func (o *OutlierDetector) othersAvailable(endpoint string, endpoints []string) bool {
+	for _, other := range endpoints {
+		if other == endpoint {
+			continue
+		}
+		if health, ok := o.endpoints[other]; !ok || health.ejectedUntil.IsZero() {
+			return true
+		}
+	}
+	return false
+}
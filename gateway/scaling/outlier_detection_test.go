@@ -0,0 +1,115 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func Test_OutlierDetector_EjectsAfterConsecutiveFailures(t *testing.T) {
+	ejections := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_ejections"}, []string{"function_name", "endpoint"})
+	detector := NewOutlierDetector(2, time.Minute, ejections)
+	policy := detector.policy(nil)
+	endpoints := []string{"a", "b"}
+
+	detector.Record("echo.openfaas-fn", "a", endpoints, true, policy)
+	if got := detector.Available(endpoints, policy); !reflect.DeepEqual(got, endpoints) {
+		t.Fatalf("want both endpoints after one failure, got: %v", got)
+	}
+
+	detector.Record("echo.openfaas-fn", "a", endpoints, true, policy)
+	if got := detector.Available(endpoints, policy); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("want a to be ejected, got: %v", got)
+	}
+
+	metric := &dto.Metric{}
+	ejections.WithLabelValues("echo.openfaas-fn", "a").Write(metric)
+	if got := metric.GetCounter().GetValue(); got != 1 {
+		t.Errorf("want 1 ejection counted, got: %f", got)
+	}
+}
+
+func Test_OutlierDetector_SuccessResetsFailures(t *testing.T) {
+	detector := NewOutlierDetector(2, time.Minute, nil)
+	policy := detector.policy(nil)
+	endpoints := []string{"a", "b"}
+
+	detector.Record("echo.openfaas-fn", "a", endpoints, true, policy)
+	detector.Record("echo.openfaas-fn", "a", endpoints, false, policy)
+	detector.Record("echo.openfaas-fn", "a", endpoints, true, policy)
+
+	if got := detector.Available(endpoints, policy); !reflect.DeepEqual(got, endpoints) {
+		t.Errorf("want failures which are not consecutive to be ignored, got: %v", got)
+	}
+}
+
+func Test_OutlierDetector_NeverEjectsLastEndpoint(t *testing.T) {
+	detector := NewOutlierDetector(1, time.Minute, nil)
+	policy := detector.policy(nil)
+	endpoints := []string{"a", "b"}
+
+	detector.Record("echo.openfaas-fn", "a", endpoints, true, policy)
+	detector.Record("echo.openfaas-fn", "b", endpoints, true, policy)
+
+	if got := detector.Available(endpoints, policy); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("want the last endpoint to stay available, got: %v", got)
+	}
+}
+
+func Test_OutlierDetector_ProbeReadmits(t *testing.T) {
+	detector := NewOutlierDetector(1, time.Millisecond*10, nil)
+	policy := detector.policy(nil)
+	endpoints := []string{"a", "b"}
+
+	detector.Record("echo.openfaas-fn", "a", endpoints, true, policy)
+	time.Sleep(time.Millisecond * 20)
+
+	if got := detector.Available(endpoints, policy); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Fatalf("want a probe to be sent to a, got: %v", got)
+	}
+	if got := detector.Available(endpoints, policy); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("want a single probe in flight, got: %v", got)
+	}
+
+	detector.Record("echo.openfaas-fn", "a", endpoints, false, policy)
+	if got := detector.Available(endpoints, policy); !reflect.DeepEqual(got, endpoints) {
+		t.Errorf("want a to be re-admitted after a successful probe, got: %v", got)
+	}
+}
+
+func Test_OutlierDetector_FailedProbeEjectsAgain(t *testing.T) {
+	detector := NewOutlierDetector(1, time.Millisecond*10, nil)
+	policy := detector.policy(nil)
+	endpoints := []string{"a", "b"}
+
+	detector.Record("echo.openfaas-fn", "a", endpoints, true, policy)
+	time.Sleep(time.Millisecond * 20)
+	detector.Available(endpoints, policy)
+
+	detector.Record("echo.openfaas-fn", "a", endpoints, true, policy)
+	if got := detector.Available(endpoints, policy); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("want a to be ejected again, got: %v", got)
+	}
+}
+
+func Test_OutlierDetector_AnnotationsOverrideDefaults(t *testing.T) {
+	detector := NewOutlierDetector(0, time.Minute, nil)
+
+	policy := detector.policy(map[string]string{
+		OutlierFailuresAnnotation:     "3",
+		OutlierEjectionTimeAnnotation: "5s",
+	})
+	if policy.failures != 3 || policy.ejectionTime != time.Second*5 {
+		t.Errorf("want 3 failures and 5s, got: %d and %s", policy.failures, policy.ejectionTime)
+	}
+
+	if disabled := detector.policy(nil); disabled.failures != 0 {
+		t.Errorf("want ejection disabled by default, got: %d", disabled.failures)
+	}
+}
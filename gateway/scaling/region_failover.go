@@ -0,0 +1,76 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// PeerRegion is the gateway of another region
+type PeerRegion struct {
+	Name string
+	URL  string
+
+	// Auth adds the credentials the peer's gateway expects, nil when it
+	// expects none
+	Auth middleware.AuthInjector
+}
+
+// RegionFailover picks the peer region a request is sent to when its
+// function cannot be scheduled in this region
+type RegionFailover struct {
+	// Region names this region in the FailoverHopHeader of the requests
+	// which are failed over
+	Region string
+
+	// Peers are used in turn
+	Peers []PeerRegion
+
+	next uint32
+}
+
+// NewRegionFailover creates a RegionFailover from region to peers
+func NewRegionFailover(region string, peers []PeerRegion) *RegionFailover {
+	return &RegionFailover{
+		Region: region,
+		Peers:  peers,
+	}
+}
+
+// CanFailOver returns true when r can be sent to a peer region, false when
+// there are none or r has already been failed over by another region, so
+// that a request is never sent back and forth between regions which are both
+// full
+func (f *RegionFailover) CanFailOver(r *http.Request) bool {
+	return len(f.Peers) > 0 && len(r.Header.Get(middleware.FailoverHopHeader)) == 0
+}
+
+// Peer returns the peer region to send r to, false when r cannot be failed
+// over, see CanFailOver
+func (f *RegionFailover) Peer(r *http.Request) (PeerRegion, bool) {
+	if !f.CanFailOver(r) {
+		return PeerRegion{}, false
+	}
+
+	i := atomic.AddUint32(&f.next, 1) - 1
+	return f.Peers[int(i%uint32(len(f.Peers)))], true
+}
+
+type failoverKey struct{}
+
+// WithFailover returns a copy of ctx for a request which can be failed over
+// to a peer region, so that the FunctionScaler stops waiting for a function
+// the provider cannot place rather than waiting out its polls
+func WithFailover(ctx context.Context) context.Context {
+	return context.WithValue(ctx, failoverKey{}, true)
+}
+
+func canFailOver(ctx context.Context) bool {
+	failover, _ := ctx.Value(failoverKey{}).(bool)
+	return failover
+}
@@ -0,0 +1,104 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+func Test_RegionFailover_PeersInTurn(t *testing.T) {
+	failover := NewRegionFailover("eu-west", []PeerRegion{
+		{Name: "us-east", URL: "https://gw.us-east"},
+		{Name: "ap-south", URL: "https://gw.ap-south"},
+	})
+
+	want := []string{"us-east", "ap-south", "us-east"}
+	for i, name := range want {
+		peer, ok := failover.Peer(httptest.NewRequest(http.MethodGet, "/function/figlet", nil))
+		if !ok || peer.Name != name {
+			t.Errorf("peer %d want: %s, got: %s (%v)", i, name, peer.Name, ok)
+		}
+	}
+}
+
+func Test_RegionFailover_NotFailedOverTwice(t *testing.T) {
+	failover := NewRegionFailover("eu-west", []PeerRegion{{Name: "us-east", URL: "https://gw.us-east"}})
+
+	req := httptest.NewRequest(http.MethodGet, "/function/figlet", nil)
+	req.Header.Set(middleware.FailoverHopHeader, "us-east")
+
+	if peer, ok := failover.Peer(req); ok {
+		t.Errorf("want no peer for a request which was failed over, got: %s", peer.Name)
+	}
+}
+
+// pendingServiceQuery accepts a scale up, but never has a replica available
+// for it, the provider reports the replicas it cannot place when
+// unschedulable is set
+type pendingServiceQuery struct {
+	fakeServiceQuery
+	unschedulable bool
+}
+
+func (p *pendingServiceQuery) SetReplicas(service, namespace string, count uint64) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.response.Replicas = count
+	if p.unschedulable {
+		p.response.UnschedulableReplicas = count
+	}
+	return nil
+}
+
+func Test_Scale_UnschedulableWhenProviderReportsIt(t *testing.T) {
+	config := ScalingConfig{
+		MaxPollCount:         1000,
+		SetScaleRetries:      3,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Millisecond * 250,
+		ServiceQuery:         &pendingServiceQuery{unschedulable: true},
+	}
+	scaler := NewFunctionScaler(config, NewFunctionCache(config.CacheExpiry))
+
+	res := scaler.ScaleWithPriority(WithFailover(context.Background()), "figlet", "openfaas-fn", 0, "")
+	if !res.Unschedulable {
+		t.Errorf("want an unschedulable function, got: %+v", res)
+	}
+	if res.Duration > time.Millisecond*500 {
+		t.Errorf("want the polls to stop once the provider reports it, took: %s", res.Duration)
+	}
+
+	// Without a peer region to fail over to the polls are waited out
+	config.MaxPollCount = 3
+	waiting := NewFunctionScaler(config, NewFunctionCache(config.CacheExpiry))
+	if res := waiting.Scale("figlet", "openfaas-fn"); res.Unschedulable {
+		t.Errorf("want the function to be waited for without failover, got: %+v", res)
+	}
+
+	available := newTestScaler(&fakeServiceQuery{})
+	if res := available.Scale("figlet", "openfaas-fn"); res.Unschedulable {
+		t.Errorf("want a function which became available, got: %+v", res)
+	}
+}
+
+func Test_Scale_SlowStartIsNotUnschedulable(t *testing.T) {
+	config := ScalingConfig{
+		MaxPollCount:         3,
+		SetScaleRetries:      3,
+		FunctionPollInterval: time.Millisecond,
+		CacheExpiry:          time.Millisecond * 250,
+		ServiceQuery:         &pendingServiceQuery{},
+	}
+	scaler := NewFunctionScaler(config, NewFunctionCache(config.CacheExpiry))
+
+	if res := scaler.Scale("figlet", "openfaas-fn"); res.Unschedulable {
+		t.Errorf("want a function which is still starting, got: %+v", res)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+const (
+	// RegionsAnnotation maps client regions to the base URL of the function's
+	// deployment in that region, i.e. "eu-west=http://gw.eu:8080,us-east=http://gw.us:8080"
+	RegionsAnnotation = "com.openfaas.regions"
+
+	// DefaultRegionAnnotation is the region used when the client's region is
+	// missing or has no deployment, overriding the resolver's DefaultRegion
+	DefaultRegionAnnotation = "com.openfaas.regions.default"
+)
+
+// RegionBaseURLResolver resolves requests for functions with the
+// com.openfaas.regions annotation to the deployment for the region sent by
+// the client in RegionHeader, all other requests are resolved by Fallback
+type RegionBaseURLResolver struct {
+	FunctionQuery    FunctionQuery
+	Fallback         middleware.BaseURLResolver
+	DefaultNamespace string
+	RegionHeader     string
+	DefaultRegion    string
+}
+
+// regionBaseURLs caches the parsed RegionsAnnotation by its value
+var regionBaseURLs = newBaseURLMap(RegionsAnnotation)
+
+// FunctionRegions returns the base URL of each region a function is
+// deployed to and the region used for clients which send none of them, which
+// is the function's DefaultRegionAnnotation or else defaultRegion. The
+// regions are empty when the function has no RegionsAnnotation.
+func FunctionRegions(annotations map[string]string, defaultRegion string) (map[string]string, string) {
+	if len(annotations[RegionsAnnotation]) == 0 {
+		return nil, defaultRegion
+	}
+
+	if value, ok := annotations[DefaultRegionAnnotation]; ok {
+		defaultRegion = strings.TrimSpace(value)
+	}
+	return regionBaseURLs.parse(annotations[RegionsAnnotation]), defaultRegion
+}
+
+// NewRegionBaseURLResolver creates a RegionBaseURLResolver
+func NewRegionBaseURLResolver(functionQuery FunctionQuery, fallback middleware.BaseURLResolver, defaultNamespace, regionHeader, defaultRegion string) RegionBaseURLResolver {
+	return RegionBaseURLResolver{
+		FunctionQuery:    functionQuery,
+		Fallback:         fallback,
+		DefaultNamespace: defaultNamespace,
+		RegionHeader:     regionHeader,
+		DefaultRegion:    defaultRegion,
+	}
+}
+
+// Resolve the base URL for a request
+func (g RegionBaseURLResolver) Resolve(r *http.Request) string {
+	functionName, namespace := middleware.GetNamespace(g.DefaultNamespace, middleware.GetServiceName(r.URL.Path))
+
+	annotations, err := g.FunctionQuery.GetAnnotations(functionName, namespace)
+	if err != nil {
+		return g.Fallback.Resolve(r)
+	}
+
+	regions, defaultRegion := FunctionRegions(annotations, g.DefaultRegion)
+	if baseURL, ok := regions[strings.TrimSpace(r.Header.Get(g.RegionHeader))]; ok {
+		return baseURL
+	}
+	if baseURL, ok := regions[defaultRegion]; ok {
+		return baseURL
+	}
+
+	return g.Fallback.Resolve(r)
+}
+
+// Report passes the outcome of a request on to Fallback when it balances
+// requests over endpoints
+func (g RegionBaseURLResolver) Report(r *http.Request, baseURL string, statusCode int, duration time.Duration) {
+	if reporter, ok := g.Fallback.(middleware.EndpointReporter); ok {
+		reporter.Report(r, baseURL, statusCode, duration)
+	}
+}
+
+// BuildURL builds a URL with Fallback
+func (g RegionBaseURLResolver) BuildURL(function, namespace, healthPath string, directFunctions bool) string {
+	return g.Fallback.BuildURL(function, namespace, healthPath, directFunctions)
+}
@@ -0,0 +1,90 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+type annotationsQuery map[string]string
+
+func (a annotationsQuery) Get(name string, namespace string) (ServiceQueryResponse, error) {
+	annotations := map[string]string(a)
+	return ServiceQueryResponse{Annotations: &annotations}, nil
+}
+
+func (a annotationsQuery) GetAnnotations(name string, namespace string) (map[string]string, error) {
+	return a, nil
+}
+
+func newTestRegionResolver(annotations map[string]string, defaultRegion string) RegionBaseURLResolver {
+	fallback := middleware.SingleHostBaseURLResolver{BaseURL: "http://faas-provider:8080"}
+	return NewRegionBaseURLResolver(annotationsQuery(annotations), fallback, "openfaas-fn", "X-Client-Region", defaultRegion)
+}
+
+func Test_RegionBaseURLResolver_KnownRegion(t *testing.T) {
+	resolver := newTestRegionResolver(map[string]string{
+		RegionsAnnotation: "eu-west=http://gw.eu:8080/, us-east=http://gw.us:8080",
+	}, "us-east")
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	req.Header.Set("X-Client-Region", "eu-west")
+
+	if got := resolver.Resolve(req); got != "http://gw.eu:8080" {
+		t.Errorf("want the eu-west deployment, got: %s", got)
+	}
+}
+
+func Test_RegionBaseURLResolver_UnknownRegionUsesDefault(t *testing.T) {
+	resolver := newTestRegionResolver(map[string]string{
+		RegionsAnnotation: "eu-west=http://gw.eu:8080,us-east=http://gw.us:8080",
+	}, "us-east")
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	req.Header.Set("X-Client-Region", "ap-south")
+
+	if got := resolver.Resolve(req); got != "http://gw.us:8080" {
+		t.Errorf("want the default region's deployment, got: %s", got)
+	}
+}
+
+func Test_RegionBaseURLResolver_MissingHeaderUsesFunctionDefault(t *testing.T) {
+	resolver := newTestRegionResolver(map[string]string{
+		RegionsAnnotation:       "eu-west=http://gw.eu:8080,us-east=http://gw.us:8080",
+		DefaultRegionAnnotation: "eu-west",
+	}, "us-east")
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+
+	if got := resolver.Resolve(req); got != "http://gw.eu:8080" {
+		t.Errorf("want the function's default region, got: %s", got)
+	}
+}
+
+func Test_RegionBaseURLResolver_NoDefaultUsesFallback(t *testing.T) {
+	resolver := newTestRegionResolver(map[string]string{
+		RegionsAnnotation: "eu-west=http://gw.eu:8080",
+	}, "")
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	req.Header.Set("X-Client-Region", "ap-south")
+
+	if got := resolver.Resolve(req); got != "http://faas-provider:8080" {
+		t.Errorf("want the fallback, got: %s", got)
+	}
+}
+
+func Test_RegionBaseURLResolver_WithoutAnnotationUsesFallback(t *testing.T) {
+	resolver := newTestRegionResolver(map[string]string{}, "us-east")
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	req.Header.Set("X-Client-Region", "eu-west")
+
+	if got := resolver.Resolve(req); got != "http://faas-provider:8080" {
+		t.Errorf("want the fallback, got: %s", got)
+	}
+}
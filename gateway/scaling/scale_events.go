@@ -0,0 +1,156 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ScaleTriggerFromZero is a scale up from zero replicas by an invocation
+	ScaleTriggerFromZero = "scale-from-zero"
+
+	// ScaleTriggerToZero is a request to scale a function to zero replicas
+	ScaleTriggerToZero = "scale-to-zero"
+
+	// ScaleTriggerAPI is a request to scale a function to other replicas
+	ScaleTriggerAPI = "scale-function"
+)
+
+// ScaleEvent describes a change to a function's replicas. Duration is how
+// long the change took to complete, it is in nanoseconds in JSON.
+type ScaleEvent struct {
+	Function     string        `json:"function"`
+	Namespace    string        `json:"namespace"`
+	FromReplicas uint64        `json:"fromReplicas"`
+	ToReplicas   uint64        `json:"toReplicas"`
+	Trigger      string        `json:"trigger"`
+	Duration     time.Duration `json:"duration"`
+	Timestamp    time.Time     `json:"timestamp"`
+}
+
+// ScaleEventSink receives scale events, such as to publish them to an event
+// bus. Send is called on the request path, so an implementation which may
+// block should be wrapped with NewAsyncScaleEventSink.
+type ScaleEventSink interface {
+	Send(event ScaleEvent)
+}
+
+// NoopScaleEventSink discards scale events
+type NoopScaleEventSink struct{}
+
+// Send does nothing
+func (NoopScaleEventSink) Send(event ScaleEvent) {}
+
+// AsyncScaleEventSink sends events to a sink from a single goroutine, so
+// that Send never blocks. Events are dropped whilst the buffer is full.
+type AsyncScaleEventSink struct {
+	sink    ScaleEventSink
+	events  chan ScaleEvent
+	dropped uint64
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewAsyncScaleEventSink creates an AsyncScaleEventSink which buffers up to
+// buffer events for sink
+func NewAsyncScaleEventSink(sink ScaleEventSink, buffer int) *AsyncScaleEventSink {
+	a := &AsyncScaleEventSink{
+		sink:   sink,
+		events: make(chan ScaleEvent, buffer),
+		done:   make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *AsyncScaleEventSink) run() {
+	defer close(a.done)
+	for event := range a.events {
+		a.sink.Send(event)
+	}
+}
+
+// Send queues event without blocking
+func (a *AsyncScaleEventSink) Send(event ScaleEvent) {
+	select {
+	case a.events <- event:
+	default:
+		if dropped := atomic.AddUint64(&a.dropped, 1); dropped == 1 || dropped%100 == 0 {
+			log.Printf("Scale events: buffer full, %d events dropped\n", dropped)
+		}
+	}
+}
+
+// Dropped returns how many events were dropped because the buffer was full
+func (a *AsyncScaleEventSink) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Close sends the events which are buffered, then stops. Send must not be
+// called after Close.
+func (a *AsyncScaleEventSink) Close() {
+	a.once.Do(func() {
+		close(a.events)
+	})
+	<-a.done
+}
+
+// WebhookScaleEventSink posts each event as JSON to a URL
+type WebhookScaleEventSink struct {
+	URL     string
+	Client  *http.Client
+	Timeout time.Duration
+}
+
+// Send posts event to the URL, failures are logged
+func (s WebhookScaleEventSink) Send(event ScaleEvent) {
+	if err := s.post(event); err != nil {
+		log.Printf("Scale events: unable to send %s event for %s.%s: %s\n",
+			event.Trigger, event.Function, event.Namespace, err)
+	}
+}
+
+func (s WebhookScaleEventSink) post(event ScaleEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status: %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type blockingScaleEventSink struct {
+	entered chan struct{}
+	release chan struct{}
+	lock    sync.Mutex
+	events  []ScaleEvent
+}
+
+func (b *blockingScaleEventSink) Send(event ScaleEvent) {
+	b.entered <- struct{}{}
+	<-b.release
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.events = append(b.events, event)
+}
+
+func Test_AsyncScaleEventSink_DoesNotBlock(t *testing.T) {
+	sink := &blockingScaleEventSink{entered: make(chan struct{}, 10), release: make(chan struct{})}
+	async := NewAsyncScaleEventSink(sink, 2)
+
+	// The first event is held by the blocked sink
+	async.Send(ScaleEvent{Function: "figlet"})
+	<-sink.entered
+
+	done := make(chan struct{})
+	go func() {
+		for i := 1; i < 10; i++ {
+			async.Send(ScaleEvent{Function: "figlet", ToReplicas: uint64(i)})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("want Send not to block whilst the sink is blocked")
+	}
+
+	close(sink.release)
+	async.Close()
+
+	// One event is held by the blocked sink and two are buffered
+	if got := len(sink.events); got != 3 {
+		t.Errorf("events sent want: %d, got: %d", 3, got)
+	}
+	if got := async.Dropped(); got != 7 {
+		t.Errorf("events dropped want: %d, got: %d", 7, got)
+	}
+}
+
+func Test_WebhookScaleEventSink_PostsJSON(t *testing.T) {
+	received := make(chan ScaleEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := ScaleEvent{}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type want: application/json, got: %s", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	defer srv.Close()
+
+	WebhookScaleEventSink{URL: srv.URL, Timeout: time.Second}.Send(ScaleEvent{
+		Function:   "figlet",
+		Namespace:  "openfaas-fn",
+		ToReplicas: 2,
+		Trigger:    ScaleTriggerAPI,
+	})
+
+	event := <-received
+	if event.Function != "figlet" || event.ToReplicas != 2 || event.Trigger != ScaleTriggerAPI {
+		t.Errorf("event want figlet scaled to 2, got: %+v", event)
+	}
+}
@@ -2,6 +2,8 @@ package scaling
 
 import (
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // ScalingConfig for scaling behaviours
@@ -22,4 +24,76 @@ type ScalingConfig struct {
 	// SetScaleRetries is the number of times to try scaling a function before
 	// giving up due to errors
 	SetScaleRetries uint
+
+	// EnableScaleHint allows callers to request a replica count with the
+	// _scale query parameter, intended for load-testing
+	EnableScaleHint bool
+
+	// ScaleHintSecret is the secret requests send in the X-Scale-Hint-Secret
+	// header to use the _scale query parameter, the parameter is ignored when
+	// it is empty
+	ScaleHintSecret string
+
+	// NotFoundBackoff when set, rejects clients which repeatedly request a
+	// function that cannot be found without querying the provider
+	NotFoundBackoff *NotFoundBackoff
+
+	// TrustedProxies is the amount of proxies in front of the gateway which
+	// append to X-Forwarded-For, used to find the client for NotFoundBackoff
+	TrustedProxies int
+
+	// NotFoundStatus is the HTTP status returned when a function cannot be
+	// found, http.StatusNotFound when 0
+	NotFoundStatus int
+
+	// NotFoundStatusPrefixes overrides NotFoundStatus for request paths with
+	// a given prefix
+	NotFoundStatusPrefixes map[string]int
+
+	// CatchAllFunctions maps a namespace to the function which receives the
+	// requests for functions which cannot be found in the namespace
+	CatchAllFunctions map[string]string
+
+	// Warmer when set, sends the warm-up request from a function's annotations
+	// after it is scaled from zero and before it is reported as available
+	Warmer *FunctionWarmer
+
+	// WarmUpTimeout bounds the time taken by a warm-up request
+	WarmUpTimeout time.Duration
+
+	// LatencyTarget when set, requests which wait longer than the target for
+	// a function to be available cause LatencyScaleStep more replicas to be
+	// requested
+	LatencyTarget time.Duration
+
+	// LatencyScaleStep is the amount of replicas added when the LatencyTarget
+	// is exceeded, 1 when 0
+	LatencyScaleStep uint64
+
+	// LatencyScaleUps counts scale ups due to the LatencyTarget by function_name
+	LatencyScaleUps *prometheus.CounterVec
+
+	// ColdStarts when set, limits how many functions are scaled from zero
+	// at once and admits the rest by priority
+	ColdStarts *ColdStartQueue
+
+	// ColdStartHistory when set, records the duration of each scale from
+	// zero, and clients told to poll during a cold start are given their
+	// place in the ColdStarts queue and an estimate of when it will be ready
+	ColdStartHistory *ColdStartHistory
+
+	// ReplicasHeader sets the X-Function-Replicas header on responses to
+	// the replicas a function had when the request was forwarded
+	ReplicasHeader bool
+
+	// Failover when set, sends requests for functions which could not be
+	// scheduled in this region to the gateway of a peer region
+	Failover *RegionFailover
+
+	// ScaleEvents when set, receives an event for each scale from zero
+	ScaleEvents ScaleEventSink
+
+	// FunctionQuery when set, reads a function's annotations to decide whether
+	// clients are told to poll rather than wait out a cold start
+	FunctionQuery FunctionQuery
 }
@@ -3,6 +3,12 @@
 
 package scaling
 
+import "errors"
+
+// ErrFunctionNotFound is wrapped by the errors a ServiceQuery returns for a
+// function which does not exist, rather than one which could not be queried
+var ErrFunctionNotFound = errors.New("function not found")
+
 // ServiceQuery provides interface for replica querying/setting
 type ServiceQuery interface {
 	GetReplicas(service, namespace string) (response ServiceQueryResponse, err error)
@@ -17,4 +23,8 @@ type ServiceQueryResponse struct {
 	ScalingFactor     uint64
 	AvailableReplicas uint64
 	Annotations       *map[string]string
+
+	// UnschedulableReplicas is the number of replicas the provider reports
+	// it cannot place, such as when it has no capacity for the function
+	UnschedulableReplicas uint64
 }
@@ -0,0 +1,70 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+const (
+	// WarmUpPathAnnotation is the path of a request sent to a function after
+	// it is scaled from zero, warm-up is skipped when not set
+	WarmUpPathAnnotation = "com.openfaas.warm-up.path"
+
+	// WarmUpMethodAnnotation is the HTTP method of the warm-up request, default GET
+	WarmUpMethodAnnotation = "com.openfaas.warm-up.method"
+
+	// WarmUpBodyAnnotation is the body of the warm-up request
+	WarmUpBodyAnnotation = "com.openfaas.warm-up.body"
+)
+
+// FunctionWarmer sends a warm-up request to a function so that lazy
+// initialization happens before the first request from a client
+type FunctionWarmer struct {
+	Client   *http.Client
+	Resolver middleware.BaseURLResolver
+}
+
+// WarmUp sends the request described by annotations to the function, true
+// is returned when the function has a warm-up request and it succeeded
+func (f *FunctionWarmer) WarmUp(ctx context.Context, functionName, namespace string, annotations map[string]string) (bool, error) {
+	warmUpPath, ok := annotations[WarmUpPathAnnotation]
+	if !ok || len(strings.TrimSpace(warmUpPath)) == 0 {
+		return false, nil
+	}
+
+	method := http.MethodGet
+	if value := strings.TrimSpace(annotations[WarmUpMethodAnnotation]); len(value) > 0 {
+		method = strings.ToUpper(value)
+	}
+
+	var body io.Reader
+	if value, ok := annotations[WarmUpBodyAnnotation]; ok {
+		body = strings.NewReader(value)
+	}
+
+	url := f.Resolver.BuildURL(functionName, namespace, strings.TrimSpace(warmUpPath), true)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := f.Client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("warm-up request failed: %s", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return false, fmt.Errorf("warm-up request failed with status: %d", res.StatusCode)
+	}
+	return true, nil
+}
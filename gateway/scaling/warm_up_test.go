@@ -0,0 +1,81 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package scaling
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+func Test_FunctionWarmer_SkipsWithoutAnnotation(t *testing.T) {
+	warmer := &FunctionWarmer{
+		Client:   http.DefaultClient,
+		Resolver: middleware.SingleHostBaseURLResolver{BaseURL: "http://127.0.0.1:1"},
+	}
+
+	warmed, err := warmer.WarmUp(context.Background(), "figlet", "openfaas-fn", map[string]string{})
+	if err != nil || warmed {
+		t.Errorf("want warm-up to be skipped, got: %v, err: %v", warmed, err)
+	}
+}
+
+func Test_FunctionWarmer_SendsRequestFromAnnotations(t *testing.T) {
+	var gotMethod, gotPath, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotPath = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+	}))
+	defer srv.Close()
+
+	warmer := &FunctionWarmer{
+		Client:   srv.Client(),
+		Resolver: middleware.SingleHostBaseURLResolver{BaseURL: srv.URL},
+	}
+
+	warmed, err := warmer.WarmUp(context.Background(), "figlet", "openfaas-fn", map[string]string{
+		WarmUpPathAnnotation:   "/_/warm",
+		WarmUpMethodAnnotation: "post",
+		WarmUpBodyAnnotation:   "hello",
+	})
+	if err != nil || !warmed {
+		t.Fatalf("want warm-up to succeed, got: %v, err: %v", warmed, err)
+	}
+
+	if gotMethod != http.MethodPost {
+		t.Errorf("method want: %s, got: %s", http.MethodPost, gotMethod)
+	}
+	if want := "/function/figlet.openfaas-fn/_/warm"; gotPath != want {
+		t.Errorf("path want: %s, got: %s", want, gotPath)
+	}
+	if gotBody != "hello" {
+		t.Errorf("body want: %s, got: %s", "hello", gotBody)
+	}
+}
+
+func Test_Scale_FailedWarmUpIsNotAvailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	annotations := map[string]string{WarmUpPathAnnotation: "/"}
+	query := &fakeServiceQuery{response: ServiceQueryResponse{MinReplicas: 1, MaxReplicas: 5, Annotations: &annotations}}
+	scaler := newTestScaler(query)
+	scaler.Config.Warmer = &FunctionWarmer{
+		Client:   srv.Client(),
+		Resolver: middleware.SingleHostBaseURLResolver{BaseURL: srv.URL},
+	}
+
+	res := scaler.Scale("figlet", "openfaas-fn")
+	if res.Available || res.Error == nil {
+		t.Errorf("want function to be unavailable with an error, got: %+v", res)
+	}
+}
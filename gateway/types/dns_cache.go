@@ -0,0 +1,116 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// DialContextFunc dials a network address, as used by http.Transport
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// DNSCache caches the addresses of upstream hosts for TTL to avoid a
+// DNS lookup for every new connection. When a lookup fails the last known
+// addresses are used until a lookup succeeds.
+type DNSCache struct {
+	TTL time.Duration
+
+	// LookupHost resolves a host to its addresses
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+
+	entries map[string]*dnsCacheEntry
+	lock    sync.Mutex
+}
+
+type dnsCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// NewDNSCache creates a DNSCache using the default resolver
+func NewDNSCache(ttl time.Duration) *DNSCache {
+	return &DNSCache{
+		TTL:        ttl,
+		LookupHost: net.DefaultResolver.LookupHost,
+		entries:    make(map[string]*dnsCacheEntry),
+	}
+}
+
+// DialContext wraps dial so that host names are resolved through the cache.
+// If none of the cached addresses can be dialed the entry is discarded so
+// that the next dial resolves the host again.
+func (c *DNSCache) DialContext(dial DialContextFunc) DialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		addrs, err := c.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var conn net.Conn
+		for _, ip := range addrs {
+			conn, err = dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+
+		c.invalidate(host)
+		return nil, err
+	}
+}
+
+func (c *DNSCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.lock.Lock()
+	entry, ok := c.entries[host]
+	c.lock.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.LookupHost(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		if ok {
+			log.Printf("DNS cache: lookup for %s failed, using stale addresses: %v\n", host, err)
+			return entry.addrs, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("no addresses found for %s", host)
+		}
+		return nil, err
+	}
+
+	c.lock.Lock()
+	c.entries[host] = &dnsCacheEntry{addrs: addrs, expires: time.Now().Add(c.TTL)}
+	c.lock.Unlock()
+
+	return addrs, nil
+}
+
+func (c *DNSCache) invalidate(host string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.entries, host)
+}
+
+// Flush removes every cached host and returns how many were removed
+func (c *DNSCache) Flush() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	flushed := len(c.entries)
+	c.entries = make(map[string]*dnsCacheEntry)
+	return flushed
+}
@@ -0,0 +1,77 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_DNSCache_CachesAndFallsBackToStale(t *testing.T) {
+	lookups := 0
+	fail := false
+
+	cache := NewDNSCache(time.Millisecond * 50)
+	cache.LookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		if fail {
+			return nil, fmt.Errorf("no such host")
+		}
+		return []string{"10.0.0.1"}, nil
+	}
+
+	dialed := []string{}
+	dial := cache.DialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		client, _ := net.Pipe()
+		return client, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := dial(context.Background(), "tcp", "figlet.openfaas-fn:8080"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if lookups != 1 {
+		t.Errorf("lookups want: %d, got: %d", 1, lookups)
+	}
+	if dialed[0] != "10.0.0.1:8080" {
+		t.Errorf("dialed want: %s, got: %s", "10.0.0.1:8080", dialed[0])
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	fail = true
+
+	if _, err := dial(context.Background(), "tcp", "figlet.openfaas-fn:8080"); err != nil {
+		t.Errorf("want stale addresses to be used when the lookup fails, got: %s", err)
+	}
+	if lookups != 2 {
+		t.Errorf("lookups want: %d, got: %d", 2, lookups)
+	}
+}
+
+func Test_DNSCache_InvalidatesWhenDialFails(t *testing.T) {
+	lookups := 0
+
+	cache := NewDNSCache(time.Minute)
+	cache.LookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		return []string{"10.0.0.1"}, nil
+	}
+
+	dial := cache.DialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, fmt.Errorf("connection refused")
+	})
+
+	dial(context.Background(), "tcp", "figlet.openfaas-fn:8080")
+	dial(context.Background(), "tcp", "figlet.openfaas-fn:8080")
+
+	if lookups != 2 {
+		t.Errorf("lookups want: %d, got: %d", 2, lookups)
+	}
+}
@@ -42,4 +42,34 @@ type HandlerSet struct {
 
 	// NamespaceListerHandler lists namespaces
 	NamespaceListerHandler http.HandlerFunc
+
+	// CircuitBreakerStatus returns the state of each function's circuit breaker
+	CircuitBreakerStatus http.HandlerFunc
+
+	// FunctionStats returns the invocation count and last invocation time of each function
+	FunctionStats http.HandlerFunc
+
+	// FunctionLatency returns the latency percentiles of each function over a rolling window
+	FunctionLatency http.HandlerFunc
+
+	// FunctionEndpoints reads or atomically replaces the upstream endpoints of a function
+	FunctionEndpoints http.HandlerFunc
+
+	// FunctionConfig returns the configuration in effect for a function
+	FunctionConfig http.HandlerFunc
+
+	// CacheFlush empties the gateway's caches
+	CacheFlush http.HandlerFunc
+
+	// DeployWarmUp scales a function up as soon as it has been deployed
+	DeployWarmUp http.HandlerFunc
+
+	// RequestTap lists or replays the last requests to tapped functions
+	RequestTap http.HandlerFunc
+
+	// Version returns the gateway's build information
+	Version http.HandlerFunc
+
+	// Batch invokes several functions from a single request
+	Batch http.HandlerFunc
 }
@@ -4,10 +4,19 @@
 package types
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
 )
 
 // NewHTTPClientReverseProxy proxies to an upstream host through the use of a http.Client
@@ -31,7 +40,7 @@ func NewHTTPClientReverseProxy(baseURL *url.URL, timeout time.Duration, maxIdleC
 	// https://github.com/minio/minio/pull/5860
 
 	// Taken from http.DefaultTransport in Go 1.11
-	h.Client.Transport = &http.Transport{
+	h.Transport = &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
 			Timeout:   timeout,
@@ -44,6 +53,7 @@ func NewHTTPClientReverseProxy(baseURL *url.URL, timeout time.Duration, maxIdleC
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 	}
+	h.Client.Transport = h.Transport
 
 	return &h
 }
@@ -53,4 +63,488 @@ type HTTPClientReverseProxy struct {
 	BaseURL *url.URL
 	Client  *http.Client
 	Timeout time.Duration
+
+	// DialTimeout bounds establishing a connection to the upstream, so that
+	// requests to a dead host fail fast, Timeout is used when 0. It is
+	// applied by ConfigureDialer.
+	DialTimeout time.Duration
+
+	// FunctionTimeout when set, returns a function's own timeout which
+	// replaces Timeout for requests to the function
+	FunctionTimeout func(r *http.Request) (time.Duration, bool)
+
+	// FunctionServerName when set, returns the TLS server name (SNI) which
+	// replaces the URL's host for requests to the function, it is applied
+	// when Client sends through a ServerNameTransport
+	FunctionServerName func(r *http.Request) (string, bool)
+
+	// FunctionRawRequestURI when set, returns true for requests to functions
+	// which are forwarded with the URI as the client sent it, rather than
+	// the path given by the URLPathTransformer
+	FunctionRawRequestURI func(r *http.Request) bool
+
+	// FunctionReplicas when set, returns the minimum and maximum replicas of
+	// a function from the provider, which its scale requests are clamped to
+	// when the function is not cached
+	FunctionReplicas func(functionName, namespace string) (uint64, uint64, bool)
+
+	// ClientTimeoutHeader lets clients shorten Timeout for a request with
+	// a value in milliseconds, disabled when blank
+	ClientTimeoutHeader string
+
+	// ChunkTimeout aborts a response when no data is read from the upstream
+	// for this duration, disabled when 0
+	ChunkTimeout time.Duration
+
+	// FlushInterval flushes a response to the client at most this long after
+	// data is read from the upstream, disabled when 0
+	FlushInterval time.Duration
+
+	// ServerHeader replaces the Server header of responses when set
+	ServerHeader string
+
+	// StripServerHeader removes the Server header from responses
+	StripServerHeader bool
+
+	// ResponseBufferBytes is the largest response read in full before it is
+	// written to the client, larger responses are streamed
+	ResponseBufferBytes int64
+
+	// TraceSampleRate is the fraction of new traces which are sampled, from 0
+	// to 1, the decision in a client's traceparent is always kept
+	TraceSampleRate float64
+
+	// VersionHeader is sent in the X-Gateway-Version header of responses
+	// when set
+	VersionHeader string
+
+	// UserAgent is sent to the upstream in place of, or appended to, the
+	// client's User-Agent as decided by AppendUserAgent
+	UserAgent string
+
+	// AppendUserAgent appends UserAgent to the client's User-Agent
+	AppendUserAgent bool
+
+	// MaxResponseHeaders is the most header values copied from a response,
+	// unlimited when 0
+	MaxResponseHeaders int
+
+	// MaxResponseHeaderBytes is the most bytes of header names and values
+	// copied from a response, unlimited when 0
+	MaxResponseHeaderBytes int
+
+	// MarkTruncatedHeaders sets X-Headers-Truncated when headers are dropped
+	MarkTruncatedHeaders bool
+
+	// TimingHeaders adds a Server-Timing header to responses with the time
+	// taken to send the request body and to wait for the upstream
+	TimingHeaders bool
+
+	// TimeoutBreakdown logs the time spent scaling the function, connecting
+	// to it, waiting for its first byte and in total for requests which time
+	// out, and adds it to their 504 responses in TimeoutBreakdownHeader. The
+	// request must collect RequestTimings.
+	TimeoutBreakdown bool
+
+	// ObserveTimings when set, receives the time taken to send the request
+	// body and to wait for the upstream once the response headers arrive
+	ObserveTimings func(r *http.Request, requestBody, upstreamWait time.Duration)
+
+	// ObserveConnectionClose when set, is called for each response for
+	// which the upstream closes the connection rather than keeping it alive
+	ObserveConnectionClose func(r *http.Request)
+
+	// LogConnectionClose logs each response for which the upstream closes
+	// the connection
+	LogConnectionClose bool
+
+	// ExplicitEmptyBody sends POST, PUT and PATCH requests without a body,
+	// or with an empty one, with a zero-length body and Content-Length: 0,
+	// and other methods without a body
+	ExplicitEmptyBody bool
+
+	// RequestIDHeader is the header read, generated and forwarded with an ID
+	// for each request, X-Request-Id when blank
+	RequestIDHeader string
+
+	// ContextHeaders are always forwarded to functions and back to clients,
+	// such as a tenant, locale or feature flags, they are never stripped as
+	// hop-by-hop headers nor dropped by MaxResponseHeaders
+	ContextHeaders []string
+
+	// RestrictedHeaders maps a request header to the only functions it is
+	// forwarded to, as name or name.namespace. Other requests have it
+	// removed, headers which are not listed are forwarded to every function.
+	RestrictedHeaders map[string][]string
+
+	// FunctionNamespace is the namespace of functions in RestrictedHeaders
+	// which do not have one, and of requests to functions without one
+	FunctionNamespace string
+
+	// NamespaceAuthInjectors replaces the AuthInjector of requests to
+	// functions in a namespace, such as with each team's credentials
+	NamespaceAuthInjectors map[string]middleware.AuthInjector
+
+	// ScaleRules are the requests to the provider which set the replicas of
+	// a function, DefaultScaleRules when nil
+	ScaleRules []ScaleRule
+
+	// Transport used by Client, which can be tuned before the first request
+	Transport *http.Transport
+}
+
+// ScaleRule matches a request which sets the replicas of a function, such
+// as the provider's scale API, so that the function's cached replicas can be
+// updated from it
+type ScaleRule struct {
+	// Method of the request, such as POST
+	Method string
+
+	// PathPrefix of the request, followed by the function's name
+	PathPrefix string
+
+	// ReplicaField is the JSON field of the request body with the replicas,
+	// fields of nested objects are separated by dots, i.e. spec.replicas
+	ReplicaField string
+}
+
+// DefaultScaleRules match the scale requests of the OpenFaaS provider API
+var DefaultScaleRules = []ScaleRule{
+	{Method: http.MethodPost, PathPrefix: "/system/scale-function/", ReplicaField: "replicas"},
+}
+
+// MatchScaleRule returns the first of ScaleRules which matches a request's
+// method and path
+func (h *HTTPClientReverseProxy) MatchScaleRule(method, path string) (ScaleRule, bool) {
+	return MatchScaleRule(h.ScaleRules, method, path)
+}
+
+// MatchScaleRule returns the first of rules which matches a request's method
+// and path, rules are DefaultScaleRules when nil
+func MatchScaleRule(rules []ScaleRule, method, path string) (ScaleRule, bool) {
+	if rules == nil {
+		rules = DefaultScaleRules
+	}
+
+	for _, rule := range rules {
+		if strings.EqualFold(rule.Method, method) && strings.HasPrefix(path, rule.PathPrefix) {
+			return rule, true
+		}
+	}
+	return ScaleRule{}, false
+}
+
+// RequestTimeout returns the timeout for a request, which is the function's
+// own timeout when it has one, otherwise Timeout. The deadline the client
+// sent in ClientTimeoutHeader is used when that is shorter. Values which
+// are not a positive amount of milliseconds are ignored.
+func (h *HTTPClientReverseProxy) RequestTimeout(r *http.Request) time.Duration {
+	timeout := h.Timeout
+	if h.FunctionTimeout != nil {
+		if functionTimeout, ok := h.FunctionTimeout(r); ok {
+			timeout = functionTimeout
+		}
+	}
+
+	if len(h.ClientTimeoutHeader) == 0 {
+		return timeout
+	}
+
+	value := r.Header.Get(h.ClientTimeoutHeader)
+	if len(value) == 0 {
+		return timeout
+	}
+
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return timeout
+	}
+
+	// Clamp before converting so that large values cannot overflow
+	if timeout > 0 && ms >= timeout.Milliseconds() {
+		return timeout
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// WithServerName returns r with the function's TLS server name in its
+// context, or r when the function does not have one
+func (h *HTTPClientReverseProxy) WithServerName(r *http.Request) *http.Request {
+	if h.FunctionServerName == nil {
+		return r
+	}
+	if serverName, ok := h.FunctionServerName(r); ok {
+		return r.WithContext(WithServerName(r.Context(), serverName))
+	}
+	return r
+}
+
+// RawRequestURI returns true when r is forwarded with its raw URI
+func (h *HTTPClientReverseProxy) RawRequestURI(r *http.Request) bool {
+	return h.FunctionRawRequestURI != nil && h.FunctionRawRequestURI(r)
+}
+
+// RewriteServerHeader removes or replaces the Server header of a response
+// as configured, otherwise the header is left untouched. The gateway's
+// version is added when VersionHeader is set.
+func (h *HTTPClientReverseProxy) RewriteServerHeader(header http.Header) {
+	if h.StripServerHeader {
+		header.Del("Server")
+	} else if len(h.ServerHeader) > 0 {
+		header.Set("Server", h.ServerHeader)
+	}
+
+	if len(h.VersionHeader) > 0 {
+		header.Set("X-Gateway-Version", h.VersionHeader)
+	}
+}
+
+// RewriteUserAgent overrides or appends to the User-Agent of an upstream
+// request as configured, otherwise the client's User-Agent is kept
+func (h *HTTPClientReverseProxy) RewriteUserAgent(header http.Header) {
+	if len(h.UserAgent) == 0 {
+		return
+	}
+
+	if clientAgent := header.Get("User-Agent"); h.AppendUserAgent && len(clientAgent) > 0 {
+		header.Set("User-Agent", clientAgent+" "+h.UserAgent)
+		return
+	}
+	header.Set("User-Agent", h.UserAgent)
+}
+
+// ReportConnectionClose records a response for r after which the upstream
+// closes the connection, such as with Connection: close. The connection is
+// never reused by the Transport, so the next request opens a new one.
+func (h *HTTPClientReverseProxy) ReportConnectionClose(r *http.Request) {
+	if h.ObserveConnectionClose != nil {
+		h.ObserveConnectionClose(r)
+	}
+	if h.LogConnectionClose {
+		log.Printf("Upstream closed the connection after responding to %s\n", r.URL.Path)
+	}
+}
+
+// ReportTimings passes the time taken to send the request body and to wait
+// for the upstream to ObserveTimings and adds them to the response headers
+// when TimingHeaders is set. When the request collects RequestTimings, the
+// time taken to scale the function and the gateway's total time until the
+// upstream responded are added too.
+func (h *HTTPClientReverseProxy) ReportTimings(header http.Header, r *http.Request, requestBody, upstreamWait time.Duration) {
+	if h.ObserveTimings != nil {
+		h.ObserveTimings(r, requestBody, upstreamWait)
+	}
+
+	if !h.TimingHeaders {
+		return
+	}
+
+	entries := []string{}
+	timings := middleware.GetRequestTimings(r.Context())
+	if timings != nil && timings.Scale > 0 {
+		entries = append(entries, serverTiming("scale", timings.Scale))
+	}
+	entries = append(entries, serverTiming("body", requestBody), serverTiming("upstream", upstreamWait))
+	if timings != nil {
+		entries = append(entries, serverTiming("total", time.Since(timings.Start)))
+	}
+
+	header.Add("Server-Timing", strings.Join(entries, ", "))
+}
+
+// TimeoutBreakdownHeader is added to 504 responses with the time spent on the
+// request when TimeoutBreakdown is set
+const TimeoutBreakdownHeader = "X-Timeout-Breakdown"
+
+// ReportTimeout logs the time spent on a request which timed out, and adds it
+// to header when TimeoutBreakdown is set. The header is nil when the status
+// has already been sent.
+func (h *HTTPClientReverseProxy) ReportTimeout(header http.Header, r *http.Request) {
+	if !h.TimeoutBreakdown {
+		return
+	}
+	timings := middleware.GetRequestTimings(r.Context())
+	if timings == nil {
+		return
+	}
+
+	breakdown := fmt.Sprintf("scale_ms=%d, connect_ms=%d, ttfb_ms=%d, total_ms=%d",
+		timings.Scale.Milliseconds(),
+		timings.Connect.Milliseconds(),
+		timings.FirstByte.Milliseconds(),
+		time.Since(timings.Start).Milliseconds())
+
+	if header != nil {
+		header.Set(TimeoutBreakdownHeader, breakdown)
+	}
+	log.Printf("Timeout breakdown for %s: %s\n", r.URL.Path, breakdown)
+}
+
+// serverTiming formats a Server-Timing entry with its duration in milliseconds
+func serverTiming(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.3f", name, float64(d)/float64(time.Millisecond))
+}
+
+// LimitResponseHeaders drops the headers of a response beyond
+// MaxResponseHeaders or MaxResponseHeaderBytes and returns how many values
+// were dropped. Headers are kept in name order so that the same response is
+// always truncated in the same way. ContextHeaders are always kept and do
+// not count towards the limits.
+func (h *HTTPClientReverseProxy) LimitResponseHeaders(header http.Header) int {
+	if h.MaxResponseHeaders <= 0 && h.MaxResponseHeaderBytes <= 0 {
+		return 0
+	}
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		if !h.isContextHeader(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	count, size, dropped := 0, 0, 0
+	for _, name := range names {
+		values := header[name]
+		kept := 0
+		for _, value := range values {
+			count++
+			size += len(name) + len(value)
+			if (h.MaxResponseHeaders > 0 && count > h.MaxResponseHeaders) ||
+				(h.MaxResponseHeaderBytes > 0 && size > h.MaxResponseHeaderBytes) {
+				dropped++
+				continue
+			}
+			values[kept] = value
+			kept++
+		}
+
+		if kept == 0 {
+			delete(header, name)
+		} else {
+			header[name] = values[:kept]
+		}
+	}
+
+	if dropped > 0 && h.MarkTruncatedHeaders {
+		header.Set("X-Headers-Truncated", "true")
+	}
+	return dropped
+}
+
+// RestrictHeaders removes each header in RestrictedHeaders from an upstream
+// request for r, unless r is for one of the functions it is forwarded to
+func (h *HTTPClientReverseProxy) RestrictHeaders(r *http.Request, header http.Header) {
+	if len(h.RestrictedHeaders) == 0 {
+		return
+	}
+
+	var function string
+	if serviceName := middleware.GetServiceName(r.URL.String()); len(serviceName) > 0 {
+		functionName, namespace := middleware.GetNamespace(h.FunctionNamespace, serviceName)
+		function = functionName + "." + namespace
+	}
+
+	for name, functions := range h.RestrictedHeaders {
+		if _, ok := header[name]; !ok {
+			continue
+		}
+		if !h.restrictedHeaderAllowed(function, functions) {
+			header.Del(name)
+		}
+	}
+}
+
+// AuthInjector returns the injector for the namespace of the function r is
+// for, or fallback when the namespace has none or r is not for a function
+func (h *HTTPClientReverseProxy) AuthInjector(r *http.Request, fallback middleware.AuthInjector) middleware.AuthInjector {
+	if len(h.NamespaceAuthInjectors) == 0 {
+		return fallback
+	}
+
+	serviceName := middleware.GetServiceName(r.URL.String())
+	if len(serviceName) == 0 {
+		return fallback
+	}
+
+	_, namespace := middleware.GetNamespace(h.FunctionNamespace, serviceName)
+	if injector, ok := h.NamespaceAuthInjectors[namespace]; ok {
+		return injector
+	}
+	return fallback
+}
+
+func (h *HTTPClientReverseProxy) restrictedHeaderAllowed(function string, functions []string) bool {
+	if len(function) == 0 {
+		return false
+	}
+	for _, allowed := range functions {
+		functionName, namespace := middleware.GetNamespace(h.FunctionNamespace, allowed)
+		if functionName+"."+namespace == function {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HTTPClientReverseProxy) isContextHeader(name string) bool {
+	for _, header := range h.ContextHeaders {
+		if header == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureTLS sets the minimum TLS version and cipher suites used for
+// https upstreams, Go's secure defaults are used when cipherSuites is empty.
+// Cipher suites are not configurable for TLS 1.3.
+func (h *HTTPClientReverseProxy) ConfigureTLS(minVersion uint16, cipherSuites []uint16) {
+	if h.Transport.TLSClientConfig == nil {
+		h.Transport.TLSClientConfig = &tls.Config{}
+	}
+
+	h.Transport.TLSClientConfig.MinVersion = minVersion
+	if len(cipherSuites) > 0 {
+		h.Transport.TLSClientConfig.CipherSuites = cipherSuites
+	}
+}
+
+// ConfigureDialer replaces the dialer of Transport, it must be called before
+// the dialer is wrapped i.e. by a DNSCache.
+//
+// keepAlive is the interval of TCP keep-alive probes, which detect upstream
+// connections broken without a FIN such as when a node is lost, at the cost of
+// a little traffic on idle connections. A negative value disables the probes.
+//
+// noDelay sets TCP_NODELAY, Go's default, so small writes are sent straight
+// away which favours latency. Disabling it enables Nagle's algorithm which
+// coalesces small writes into fewer packets at the cost of added latency.
+func (h *HTTPClientReverseProxy) ConfigureDialer(keepAlive time.Duration, noDelay bool) {
+	dialTimeout := h.Timeout
+	if h.DialTimeout > 0 {
+		dialTimeout = h.DialTimeout
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: keepAlive,
+		DualStack: true,
+	}
+
+	if noDelay {
+		h.Transport.DialContext = dialer.DialContext
+		return
+	}
+
+	h.Transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.SetNoDelay(false)
+		}
+		return conn, nil
+	}
 }
@@ -0,0 +1,232 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+func Test_ConfigureDialer_DialsUpstream(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	baseURL, _ := url.Parse("http://" + listener.Addr().String())
+	proxy := NewHTTPClientReverseProxy(baseURL, time.Second, 1, 1)
+
+	for _, noDelay := range []bool{true, false} {
+		proxy.ConfigureDialer(-1, noDelay)
+
+		conn, err := proxy.Transport.DialContext(context.Background(), "tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("noDelay %v: %s", noDelay, err)
+		}
+		if _, ok := conn.(*net.TCPConn); !ok {
+			t.Errorf("noDelay %v: want a *net.TCPConn, got: %T", noDelay, conn)
+		}
+		conn.Close()
+	}
+}
+
+func Test_ConfigureDialer_DialTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	baseURL, _ := url.Parse("http://" + listener.Addr().String())
+	proxy := NewHTTPClientReverseProxy(baseURL, time.Minute, 1, 1)
+	proxy.DialTimeout = time.Nanosecond
+	proxy.ConfigureDialer(-1, true)
+
+	_, err = proxy.Transport.DialContext(context.Background(), "tcp", listener.Addr().String())
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Errorf("want a timeout error from the dial timeout, got: %v", err)
+	}
+}
+
+func Test_RequestTimeout(t *testing.T) {
+	proxy := &HTTPClientReverseProxy{Timeout: time.Second * 10, ClientTimeoutHeader: "X-Client-Timeout-Ms"}
+
+	cases := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "absent uses the proxy timeout", want: time.Second * 10},
+		{name: "shorter deadline is used", value: "250", want: time.Millisecond * 250},
+		{name: "longer deadline is clamped", value: "60000", want: time.Second * 10},
+		{name: "equal deadline", value: "10000", want: time.Second * 10},
+		{name: "huge deadline is clamped", value: "9223372036854775807", want: time.Second * 10},
+		{name: "zero is ignored", value: "0", want: time.Second * 10},
+		{name: "negative is ignored", value: "-5", want: time.Second * 10},
+		{name: "non-numeric is ignored", value: "1s", want: time.Second * 10},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/function/echo", nil)
+		if len(c.value) > 0 {
+			req.Header.Set("X-Client-Timeout-Ms", c.value)
+		}
+
+		if got := proxy.RequestTimeout(req); got != c.want {
+			t.Errorf("%s want: %s, got: %s", c.name, c.want, got)
+		}
+	}
+}
+
+func Test_RequestTimeout_DisabledWithoutHeaderName(t *testing.T) {
+	proxy := &HTTPClientReverseProxy{Timeout: time.Second * 10}
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	req.Header.Set("X-Client-Timeout-Ms", "100")
+
+	if got := proxy.RequestTimeout(req); got != time.Second*10 {
+		t.Errorf("want the proxy timeout when disabled, got: %s", got)
+	}
+}
+
+func Test_RequestTimeout_FunctionTimeout(t *testing.T) {
+	proxy := &HTTPClientReverseProxy{
+		Timeout:             time.Second * 10,
+		ClientTimeoutHeader: "X-Client-Timeout-Ms",
+		FunctionTimeout: func(r *http.Request) (time.Duration, bool) {
+			return time.Minute, true
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/function/echo", nil)
+	if got := proxy.RequestTimeout(req); got != time.Minute {
+		t.Errorf("want the function's timeout: %s, got: %s", time.Minute, got)
+	}
+
+	req.Header.Set("X-Client-Timeout-Ms", "30000")
+	if got := proxy.RequestTimeout(req); got != time.Second*30 {
+		t.Errorf("want the client's shorter deadline: %s, got: %s", time.Second*30, got)
+	}
+}
+
+func Test_ReportTimings(t *testing.T) {
+	proxy := &HTTPClientReverseProxy{}
+
+	header := http.Header{}
+	proxy.ReportTimings(header, httptest.NewRequest("POST", "/function/echo", nil), time.Millisecond*1500, time.Microsecond*250)
+	if got := header.Get("Server-Timing"); got != "" {
+		t.Errorf("want no header when disabled, got: %q", got)
+	}
+
+	proxy.TimingHeaders = true
+	proxy.ReportTimings(header, httptest.NewRequest("POST", "/function/echo", nil), time.Millisecond*1500, time.Microsecond*250)
+	if got := header.Get("Server-Timing"); got != "body;dur=1500.000, upstream;dur=0.250" {
+		t.Errorf("want Server-Timing in milliseconds, got: %q", got)
+	}
+}
+
+func Test_ReportTimings_WithRequestTimings(t *testing.T) {
+	proxy := &HTTPClientReverseProxy{TimingHeaders: true}
+
+	req := middleware.WithRequestTimings(httptest.NewRequest("GET", "/function/echo", nil))
+	timings := middleware.GetRequestTimings(req.Context())
+	timings.Start = time.Now().Add(-time.Second * 3)
+
+	header := http.Header{}
+	proxy.ReportTimings(header, req, 0, time.Millisecond*10)
+
+	got := header.Get("Server-Timing")
+	if !strings.HasPrefix(got, "body;dur=0.000, upstream;dur=10.000, total;dur=3") {
+		t.Errorf("want a total entry without a scale entry, got: %q", got)
+	}
+
+	timings.Scale = time.Millisecond * 2500
+	header = http.Header{}
+	proxy.ReportTimings(header, req, 0, time.Millisecond*10)
+
+	got = header.Get("Server-Timing")
+	if !strings.HasPrefix(got, "scale;dur=2500.000, body;dur=0.000, upstream;dur=10.000, total;dur=3") {
+		t.Errorf("want scale, body, upstream and total entries, got: %q", got)
+	}
+}
+
+type namedInjector string
+
+func (namedInjector) Inject(r *http.Request) {}
+
+func Test_AuthInjector(t *testing.T) {
+	proxy := &HTTPClientReverseProxy{
+		FunctionNamespace: "openfaas-fn",
+		NamespaceAuthInjectors: map[string]middleware.AuthInjector{
+			"team-a": namedInjector("team-a"),
+		},
+	}
+	fallback := namedInjector("fallback")
+
+	cases := []struct {
+		path string
+		want middleware.AuthInjector
+	}{
+		{"/function/echo.team-a", namedInjector("team-a")},
+		{"/function/echo.team-a/sub/path", namedInjector("team-a")},
+		{"/function/echo.team-b", fallback},
+		{"/function/echo", fallback},
+		{"/system/functions", fallback},
+	}
+
+	for _, c := range cases {
+		got := proxy.AuthInjector(httptest.NewRequest(http.MethodGet, c.path, nil), fallback)
+		if got != c.want {
+			t.Errorf("%s: injector want: %v, got: %v", c.path, c.want, got)
+		}
+	}
+
+	empty := &HTTPClientReverseProxy{}
+	if got := empty.AuthInjector(httptest.NewRequest(http.MethodGet, "/function/echo.team-a", nil), nil); got != nil {
+		t.Errorf("want no injector without any configured, got: %v", got)
+	}
+}
+
+func Test_MatchScaleRule(t *testing.T) {
+	proxy := &HTTPClientReverseProxy{}
+	if rule, ok := proxy.MatchScaleRule(http.MethodPost, "/system/scale-function/figlet"); !ok || rule.ReplicaField != "replicas" {
+		t.Errorf("want the default rule to match, got: %v %v", rule, ok)
+	}
+	if _, ok := proxy.MatchScaleRule(http.MethodPut, "/system/scale-function/figlet"); ok {
+		t.Errorf("want PUT not to match the default rule")
+	}
+
+	proxy.ScaleRules = []ScaleRule{
+		{Method: http.MethodPut, PathPrefix: "/apis/scale/", ReplicaField: "spec.replicas"},
+		{Method: http.MethodPatch, PathPrefix: "/apis/", ReplicaField: "replicas"},
+	}
+	if rule, ok := proxy.MatchScaleRule("put", "/apis/scale/figlet"); !ok || rule.ReplicaField != "spec.replicas" {
+		t.Errorf("want the PUT rule to match, got: %v %v", rule, ok)
+	}
+	if rule, ok := proxy.MatchScaleRule(http.MethodPatch, "/apis/scale/figlet"); !ok || rule.ReplicaField != "replicas" {
+		t.Errorf("want the PATCH rule to match, got: %v %v", rule, ok)
+	}
+	if _, ok := proxy.MatchScaleRule(http.MethodPost, "/system/scale-function/figlet"); ok {
+		t.Errorf("want the default rule to be replaced by ScaleRules")
+	}
+}
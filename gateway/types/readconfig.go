@@ -4,10 +4,13 @@
 package types
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -51,6 +54,43 @@ func parseIntOrDurationValue(val string, fallback time.Duration) time.Duration {
 	return duration
 }
 
+// containsString returns true when values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parseErrorStatus parses a 4xx or 5xx HTTP status code
+func parseErrorStatus(val string) (int, error) {
+	status, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil || status < 400 || status > 599 {
+		return 0, fmt.Errorf("%q is not a 4xx or 5xx status code", val)
+	}
+	return status, nil
+}
+
+// parseNamespaceCounts reads "namespace=count,..." where each count is a
+// positive integer
+func parseNamespaceCounts(val string) (map[string]int, error) {
+	counts := map[string]int{}
+	for _, pair := range strings.Split(val, ",") {
+		namespace, count, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || len(namespace) == 0 {
+			return nil, fmt.Errorf("%q, want namespace=count", pair)
+		}
+		parsed, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("%q, want a positive count", pair)
+		}
+		counts[namespace] = parsed
+	}
+	return counts, nil
+}
+
 // Read fetches gateway server configuration from environmental variables
 func (ReadConfig) Read(hasEnv HasEnv) (*GatewayConfig, error) {
 	cfg := GatewayConfig{
@@ -62,7 +102,22 @@ func (ReadConfig) Read(hasEnv HasEnv) (*GatewayConfig, error) {
 
 	cfg.ReadTimeout = parseIntOrDurationValue(hasEnv.Getenv("read_timeout"), defaultDuration)
 	cfg.WriteTimeout = parseIntOrDurationValue(hasEnv.Getenv("write_timeout"), defaultDuration)
+	cfg.ClientKeepAliveTimeout = parseIntOrDurationValue(hasEnv.Getenv("client_keep_alive_timeout"), 0)
 	cfg.UpstreamTimeout = parseIntOrDurationValue(hasEnv.Getenv("upstream_timeout"), defaultDuration)
+	cfg.LogUpstreamConnectionClose = parseBoolValue(hasEnv.Getenv("log_upstream_connection_close"))
+	cfg.UpstreamExplicitEmptyBody = parseBoolValue(hasEnv.Getenv("upstream_explicit_empty_body"))
+	cfg.MaxFunctionTimeout = parseIntOrDurationValue(hasEnv.Getenv("max_function_timeout"), 0)
+	cfg.UpstreamChunkTimeout = parseIntOrDurationValue(hasEnv.Getenv("upstream_chunk_timeout"), 0)
+	cfg.UpstreamFlushInterval = parseIntOrDurationValue(hasEnv.Getenv("upstream_flush_interval"), 0)
+
+	responseBufferBytes := hasEnv.Getenv("upstream_response_buffer_bytes")
+	if len(responseBufferBytes) > 0 {
+		val, err := strconv.ParseInt(responseBufferBytes, 10, 64)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for upstream_response_buffer_bytes: %s", responseBufferBytes)
+		}
+		cfg.UpstreamResponseBufferBytes = val
+	}
 
 	if len(hasEnv.Getenv("functions_provider_url")) > 0 {
 		var err error
@@ -135,7 +190,149 @@ func (ReadConfig) Read(hasEnv HasEnv) (*GatewayConfig, error) {
 		secretPath = "/run/secrets/"
 	}
 	cfg.SecretMountPath = secretPath
+
+	if namespaceSecrets := strings.TrimSpace(hasEnv.Getenv("namespace_auth_secrets")); len(namespaceSecrets) > 0 {
+		secrets := map[string]string{}
+		for _, entry := range strings.Split(namespaceSecrets, ";") {
+			namespace, path, _ := strings.Cut(strings.TrimSpace(entry), "=")
+			namespace, path = strings.TrimSpace(namespace), strings.TrimSpace(path)
+			if len(namespace) == 0 || len(path) == 0 {
+				return nil, fmt.Errorf("invalid value for namespace_auth_secrets: %q, want namespace=path", entry)
+			}
+			secrets[namespace] = path
+		}
+		cfg.NamespaceAuthSecrets = secrets
+	}
 	cfg.ScaleFromZero = parseBoolValue(hasEnv.Getenv("scale_from_zero"))
+	cfg.ScaleHint = parseBoolValue(hasEnv.Getenv("scale_hint"))
+	cfg.ScaleHintSecretPath = hasEnv.Getenv("scale_hint_secret_path")
+	cfg.ReplicasHeader = parseBoolValue(hasEnv.Getenv("replicas_header"))
+
+	cfg.ScaleCacheExpiry = parseIntOrDurationValue(hasEnv.Getenv("scale_cache_expiry"), time.Millisecond*250)
+	cfg.ScaleDownDrainTimeout = parseIntOrDurationValue(hasEnv.Getenv("scale_down_drain_timeout"), 0)
+
+	cfg.ScaleLatencyTarget = parseIntOrDurationValue(hasEnv.Getenv("scale_latency_target"), 0)
+
+	cfg.ScaleLatencyStep = 1
+	scaleLatencyStep := hasEnv.Getenv("scale_latency_step")
+	if len(scaleLatencyStep) > 0 {
+		val, err := strconv.ParseUint(scaleLatencyStep, 10, 64)
+		if err != nil || val == 0 {
+			return nil, fmt.Errorf("invalid value for scale_latency_step: %s", scaleLatencyStep)
+		}
+		cfg.ScaleLatencyStep = val
+	}
+
+	if scaleEventsURL := strings.TrimSpace(hasEnv.Getenv("scale_events_url")); len(scaleEventsURL) > 0 {
+		u, err := url.Parse(scaleEventsURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return nil, fmt.Errorf("invalid value for scale_events_url: %s", scaleEventsURL)
+		}
+		cfg.ScaleEventsURL = u
+	}
+
+	cfg.FailoverRegion = strings.TrimSpace(hasEnv.Getenv("failover_region"))
+	if peers := strings.TrimSpace(hasEnv.Getenv("failover_peers")); len(peers) > 0 {
+		if len(cfg.FailoverRegion) == 0 {
+			return nil, fmt.Errorf("failover_region is required with failover_peers")
+		}
+		for _, pair := range strings.Split(peers, ",") {
+			name, peerURL, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			name = strings.TrimSpace(name)
+			u, err := url.Parse(strings.TrimSpace(peerURL))
+			if !ok || len(name) == 0 || err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+				return nil, fmt.Errorf("invalid value for failover_peers: %q, want region=url", pair)
+			}
+			cfg.FailoverPeers = append(cfg.FailoverPeers, FailoverPeer{Region: name, URL: u.String()})
+		}
+	}
+
+	if peerSecrets := strings.TrimSpace(hasEnv.Getenv("failover_peer_auth_secrets")); len(peerSecrets) > 0 {
+		for _, entry := range strings.Split(peerSecrets, ";") {
+			region, path, _ := strings.Cut(strings.TrimSpace(entry), "=")
+			region, path = strings.TrimSpace(region), strings.TrimSpace(path)
+			if len(region) == 0 || len(path) == 0 {
+				return nil, fmt.Errorf("invalid value for failover_peer_auth_secrets: %q, want region=path", entry)
+			}
+
+			found := false
+			for i := range cfg.FailoverPeers {
+				if cfg.FailoverPeers[i].Region == region {
+					cfg.FailoverPeers[i].AuthSecretPath = path
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("invalid value for failover_peer_auth_secrets: %q is not in failover_peers", region)
+			}
+		}
+	}
+
+	if rules := strings.TrimSpace(hasEnv.Getenv("scale_rules")); len(rules) > 0 {
+		cfg.ScaleRules = []ScaleRule{}
+		for _, value := range strings.Split(rules, ",") {
+			parts := strings.Fields(value)
+			if len(parts) != 3 || !strings.HasPrefix(parts[1], "/") {
+				return nil, fmt.Errorf("invalid value for scale_rules: %q, want method path-prefix replica-field", value)
+			}
+			rule := ScaleRule{
+				Method:       strings.ToUpper(parts[0]),
+				PathPrefix:   parts[1],
+				ReplicaField: parts[2],
+			}
+			if rule != DefaultScaleRules[0] && overlapsGatewayRoutes(rule.PathPrefix) {
+				return nil, fmt.Errorf("invalid value for scale_rules: %q overlaps the gateway's own routes", rule.PathPrefix)
+			}
+			cfg.ScaleRules = append(cfg.ScaleRules, rule)
+		}
+	}
+
+	cfg.ScaleEventsBuffer = 100
+	if buffer := hasEnv.Getenv("scale_events_buffer"); len(buffer) > 0 {
+		val, err := strconv.Atoi(buffer)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for scale_events_buffer: %s", buffer)
+		}
+		cfg.ScaleEventsBuffer = val
+	}
+
+	cfg.ScaleNotFoundStatus = http.StatusNotFound
+	if notFoundStatus := hasEnv.Getenv("scale_not_found_status"); len(notFoundStatus) > 0 {
+		val, err := parseErrorStatus(notFoundStatus)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for scale_not_found_status: %s", err)
+		}
+		cfg.ScaleNotFoundStatus = val
+	}
+
+	if notFoundPrefixes := hasEnv.Getenv("scale_not_found_status_prefixes"); len(notFoundPrefixes) > 0 {
+		prefixes := map[string]int{}
+		for _, pair := range strings.Split(notFoundPrefixes, ",") {
+			prefix, code, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || len(prefix) == 0 {
+				return nil, fmt.Errorf("invalid value for scale_not_found_status_prefixes: %q, want prefix=code", pair)
+			}
+			val, err := parseErrorStatus(code)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for scale_not_found_status_prefixes: %s", err)
+			}
+			prefixes[prefix] = val
+		}
+		cfg.ScaleNotFoundStatusPrefixes = prefixes
+	}
+
+	if catchAllFunctions := hasEnv.Getenv("catch_all_functions"); len(catchAllFunctions) > 0 {
+		functions := map[string]string{}
+		for _, pair := range strings.Split(catchAllFunctions, ",") {
+			namespace, function, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			namespace, function = strings.TrimSpace(namespace), strings.TrimSpace(function)
+			if len(namespace) == 0 || len(function) == 0 || strings.Contains(function, ".") {
+				return nil, fmt.Errorf("invalid value for catch_all_functions: %q, want namespace=function", pair)
+			}
+			functions[namespace] = function
+		}
+		cfg.CatchAllFunctions = functions
+	}
 
 	cfg.MaxIdleConns = 1024
 	cfg.MaxIdleConnsPerHost = 1024
@@ -160,14 +357,642 @@ func (ReadConfig) Read(hasEnv HasEnv) (*GatewayConfig, error) {
 
 	}
 
+	cfg.ProxyTransportMetrics = parseBoolValue(hasEnv.Getenv("proxy_transport_metrics"))
+	cfg.DNSCacheTTL = parseIntOrDurationValue(hasEnv.Getenv("dns_cache_ttl"), 0)
+
+	cfg.UpstreamTLSMinVersion = tls.VersionTLS12
+	if tlsMinVersion := hasEnv.Getenv("upstream_tls_min_version"); len(tlsMinVersion) > 0 {
+		val, err := ParseTLSVersion(tlsMinVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for upstream_tls_min_version: %s", err)
+		}
+		cfg.UpstreamTLSMinVersion = val
+	}
+
+	if cipherSuites := hasEnv.Getenv("upstream_tls_cipher_suites"); len(cipherSuites) > 0 {
+		val, err := ParseCipherSuites(cipherSuites)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for upstream_tls_cipher_suites: %s", err)
+		}
+		cfg.UpstreamTLSCipherSuites = val
+	}
+
+	cfg.UpstreamUserAgent = hasEnv.Getenv("upstream_user_agent")
+	cfg.AppendUpstreamUserAgent = parseBoolValue(hasEnv.Getenv("upstream_user_agent_append"))
+
+	cfg.ServerHeader = hasEnv.Getenv("server_header")
+	cfg.StripServerHeader = parseBoolValue(hasEnv.Getenv("strip_server_header"))
+	cfg.VersionHeader = parseBoolValue(hasEnv.Getenv("version_header"))
+	cfg.TimingHeaders = parseBoolValue(hasEnv.Getenv("timing_headers"))
+	cfg.TimeoutBreakdown = parseBoolValue(hasEnv.Getenv("timeout_breakdown"))
+
+	cfg.SlowRequestThreshold = parseIntOrDurationValue(hasEnv.Getenv("slow_request_threshold"), 0)
+
+	cfg.MaxResponseHeaders = 1000
+	if maxResponseHeaders := hasEnv.Getenv("max_response_headers"); len(maxResponseHeaders) > 0 {
+		val, err := strconv.Atoi(maxResponseHeaders)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for max_response_headers: %s", maxResponseHeaders)
+		}
+		cfg.MaxResponseHeaders = val
+	}
+
+	cfg.MaxResponseHeaderBytes = 1 << 20
+	if maxResponseHeaderBytes := hasEnv.Getenv("max_response_header_bytes"); len(maxResponseHeaderBytes) > 0 {
+		val, err := strconv.Atoi(maxResponseHeaderBytes)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for max_response_header_bytes: %s", maxResponseHeaderBytes)
+		}
+		cfg.MaxResponseHeaderBytes = val
+	}
+
+	cfg.MarkTruncatedHeaders = parseBoolValue(hasEnv.Getenv("mark_truncated_headers"))
+
+	cfg.ClientTimeoutHeader = http.CanonicalHeaderKey(strings.TrimSpace(hasEnv.Getenv("client_timeout_header")))
+
+	cfg.RegionHeader = "X-Client-Region"
+	if regionHeader := strings.TrimSpace(hasEnv.Getenv("region_header")); len(regionHeader) > 0 {
+		cfg.RegionHeader = http.CanonicalHeaderKey(regionHeader)
+	}
+	cfg.DefaultRegion = strings.TrimSpace(hasEnv.Getenv("default_region"))
+
+	cfg.FeatureFlagHeader = "X-Feature-Variant"
+	if featureFlagHeader := strings.TrimSpace(hasEnv.Getenv("feature_flag_header")); len(featureFlagHeader) > 0 {
+		cfg.FeatureFlagHeader = http.CanonicalHeaderKey(featureFlagHeader)
+	}
+	cfg.StripFeatureFlagHeader = parseBoolValue(hasEnv.Getenv("strip_feature_flag_header"))
+
+	cfg.UpstreamKeepAlive = parseIntOrDurationValue(hasEnv.Getenv("upstream_keep_alive"), cfg.UpstreamTimeout)
+	cfg.UpstreamDialTimeout = parseIntOrDurationValue(hasEnv.Getenv("upstream_dial_timeout"), cfg.UpstreamTimeout)
+
+	cfg.UpstreamTCPNoDelay = true
+	if noDelay := hasEnv.Getenv("upstream_tcp_nodelay"); len(noDelay) > 0 {
+		cfg.UpstreamTCPNoDelay = parseBoolValue(noDelay)
+	}
+
+	if upstreamProxy := hasEnv.Getenv("upstream_proxy_url"); len(upstreamProxy) > 0 {
+		proxyURL, err := ParseUpstreamProxyURL(upstreamProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for upstream_proxy_url: %s", err)
+		}
+		cfg.UpstreamProxyURL = proxyURL
+	}
+
+	if upstreamProxies := hasEnv.Getenv("upstream_proxy_namespaces"); len(upstreamProxies) > 0 {
+		proxies, err := ParseUpstreamProxies(upstreamProxies)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for upstream_proxy_namespaces: %s", err)
+		}
+		cfg.UpstreamProxyNamespaces = proxies
+	}
+
 	cfg.AuthProxyURL = hasEnv.Getenv("auth_proxy_url")
 	cfg.AuthProxyPassBody = parseBoolValue(hasEnv.Getenv("auth_proxy_pass_body"))
 
 	cfg.Namespace = hasEnv.Getenv("function_namespace")
 
+	circuitBreakerThreshold := hasEnv.Getenv("circuit_breaker_threshold")
+	if len(circuitBreakerThreshold) > 0 {
+		val, err := strconv.Atoi(circuitBreakerThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for circuit_breaker_threshold: %s", circuitBreakerThreshold)
+		}
+		cfg.CircuitBreakerThreshold = val
+	}
+
+	cfg.CircuitBreakerOpenDuration = parseIntOrDurationValue(hasEnv.Getenv("circuit_breaker_open_duration"), time.Second*30)
+
+	notFoundBackoffThreshold := hasEnv.Getenv("not_found_backoff_threshold")
+	if len(notFoundBackoffThreshold) > 0 {
+		val, err := strconv.Atoi(notFoundBackoffThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for not_found_backoff_threshold: %s", notFoundBackoffThreshold)
+		}
+		cfg.NotFoundBackoffThreshold = val
+	}
+
+	cfg.NotFoundBackoffCooldown = parseIntOrDurationValue(hasEnv.Getenv("not_found_backoff_cooldown"), time.Minute)
+
+	cfg.NotFoundBackoffMaxEntries = 10000
+	notFoundBackoffMaxEntries := hasEnv.Getenv("not_found_backoff_max_entries")
+	if len(notFoundBackoffMaxEntries) > 0 {
+		val, err := strconv.Atoi(notFoundBackoffMaxEntries)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for not_found_backoff_max_entries: %s", notFoundBackoffMaxEntries)
+		}
+		cfg.NotFoundBackoffMaxEntries = val
+	}
+
+	maxColdStarts := hasEnv.Getenv("max_concurrent_cold_starts")
+	if len(maxColdStarts) > 0 {
+		val, err := strconv.Atoi(maxColdStarts)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for max_concurrent_cold_starts: %s", maxColdStarts)
+		}
+		cfg.MaxConcurrentColdStarts = val
+	}
+
+	cfg.ColdStartPriorityAging = parseIntOrDurationValue(hasEnv.Getenv("cold_start_priority_aging"), time.Second*10)
+
+	if weights := hasEnv.Getenv("cold_start_namespace_weights"); len(weights) > 0 {
+		val, err := parseNamespaceCounts(weights)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for cold_start_namespace_weights: %s", err)
+		}
+		cfg.ColdStartNamespaceWeights = val
+	}
+
+	if limits := hasEnv.Getenv("cold_start_namespace_limits"); len(limits) > 0 {
+		val, err := parseNamespaceCounts(limits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for cold_start_namespace_limits: %s", err)
+		}
+		cfg.ColdStartNamespaceLimits = val
+	}
+
+	cfg.ColdStartProgress = parseBoolValue(hasEnv.Getenv("cold_start_progress"))
+
+	cfg.ColdStartHistorySize = 10
+	if size := hasEnv.Getenv("cold_start_history_size"); len(size) > 0 {
+		val, err := strconv.Atoi(size)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for cold_start_history_size: %s", size)
+		}
+		cfg.ColdStartHistorySize = val
+	}
+
+	cfg.LoadShedding = parseBoolValue(hasEnv.Getenv("load_shedding"))
+
+	if weights := strings.TrimSpace(hasEnv.Getenv("cost_class_weights")); len(weights) > 0 {
+		costWeights := map[string]int64{}
+		for _, pair := range strings.Split(weights, ",") {
+			class, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			class = strings.ToLower(strings.TrimSpace(class))
+			parsed, err := strconv.ParseInt(strings.TrimSpace(weight), 10, 64)
+			if !ok || len(class) == 0 || err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid value for cost_class_weights: %q, want class=weight", pair)
+			}
+			costWeights[class] = parsed
+		}
+		cfg.CostClassWeights = costWeights
+	}
+
+	cfg.CacheWarming = parseBoolValue(hasEnv.Getenv("cache_warming"))
+
+	cfg.CacheWarmingConcurrency = 4
+	if concurrency := hasEnv.Getenv("cache_warming_concurrency"); len(concurrency) > 0 {
+		val, err := strconv.Atoi(concurrency)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for cache_warming_concurrency: %s", concurrency)
+		}
+		cfg.CacheWarmingConcurrency = val
+	}
+
+	cfg.CacheWarmingRate = 20
+	if rate := hasEnv.Getenv("cache_warming_rate"); len(rate) > 0 {
+		val, err := strconv.Atoi(rate)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for cache_warming_rate: %s", rate)
+		}
+		cfg.CacheWarmingRate = val
+	}
+
+	cfg.AdmissionControl = parseBoolValue(hasEnv.Getenv("admission_control"))
+	cfg.AdmissionLatencyTarget = parseIntOrDurationValue(hasEnv.Getenv("admission_latency_target"), 0)
+	cfg.AdmissionRetryAfter = parseIntOrDurationValue(hasEnv.Getenv("admission_retry_after"), time.Second)
+
+	cfg.AdmissionMaxInFlight = 1000
+	if maxInFlight := strings.TrimSpace(hasEnv.Getenv("admission_max_in_flight")); len(maxInFlight) > 0 {
+		val, err := strconv.ParseInt(maxInFlight, 10, 64)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for admission_max_in_flight: %s, use a value above 0", maxInFlight)
+		}
+		cfg.AdmissionMaxInFlight = val
+	}
+
+	cfg.AdmissionThreshold = 1
+	if threshold := strings.TrimSpace(hasEnv.Getenv("admission_threshold")); len(threshold) > 0 {
+		val, err := strconv.ParseFloat(threshold, 64)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for admission_threshold: %s, use a value above 0", threshold)
+		}
+		cfg.AdmissionThreshold = val
+	}
+
+	cfg.FaultInjection = parseBoolValue(hasEnv.Getenv("fault_injection"))
+
+	cfg.ResponseRedaction = parseBoolValue(hasEnv.Getenv("response_redaction"))
+
+	cfg.ResponseRedactionMaxBodyBytes = 1024 * 1024
+	redactionMaxBodyBytes := hasEnv.Getenv("response_redaction_max_body_bytes")
+	if len(redactionMaxBodyBytes) > 0 {
+		val, err := strconv.ParseInt(redactionMaxBodyBytes, 10, 64)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for response_redaction_max_body_bytes: %s", redactionMaxBodyBytes)
+		}
+		cfg.ResponseRedactionMaxBodyBytes = val
+	}
+
+	cfg.SelfLinkMaxBodyBytes = 1024 * 1024
+	selfLinkMaxBodyBytes := hasEnv.Getenv("self_link_max_body_bytes")
+	if len(selfLinkMaxBodyBytes) > 0 {
+		val, err := strconv.ParseInt(selfLinkMaxBodyBytes, 10, 64)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for self_link_max_body_bytes: %s", selfLinkMaxBodyBytes)
+		}
+		cfg.SelfLinkMaxBodyBytes = val
+	}
+
+	cfg.URLRewriteMaxBodyBytes = 1024 * 1024
+	urlRewriteMaxBodyBytes := hasEnv.Getenv("url_rewrite_max_body_bytes")
+	if len(urlRewriteMaxBodyBytes) > 0 {
+		val, err := strconv.ParseInt(urlRewriteMaxBodyBytes, 10, 64)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for url_rewrite_max_body_bytes: %s", urlRewriteMaxBodyBytes)
+		}
+		cfg.URLRewriteMaxBodyBytes = val
+	}
+
+	cfg.ContentTransformMaxBodyBytes = 1024 * 1024
+	contentTransformMaxBodyBytes := hasEnv.Getenv("content_transform_max_body_bytes")
+	if len(contentTransformMaxBodyBytes) > 0 {
+		val, err := strconv.ParseInt(contentTransformMaxBodyBytes, 10, 64)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for content_transform_max_body_bytes: %s", contentTransformMaxBodyBytes)
+		}
+		cfg.ContentTransformMaxBodyBytes = val
+	}
+
+	cfg.BodyChecksumMaxBodyBytes = 1024 * 1024
+	bodyChecksumMaxBodyBytes := hasEnv.Getenv("body_checksum_max_body_bytes")
+	if len(bodyChecksumMaxBodyBytes) > 0 {
+		val, err := strconv.ParseInt(bodyChecksumMaxBodyBytes, 10, 64)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for body_checksum_max_body_bytes: %s", bodyChecksumMaxBodyBytes)
+		}
+		cfg.BodyChecksumMaxBodyBytes = val
+	}
+
+	cfg.RequestSchemaDir = strings.TrimSpace(hasEnv.Getenv("request_schema_dir"))
+
+	cfg.RequestSchemaMaxBodyBytes = 1024 * 1024
+	requestSchemaMaxBodyBytes := hasEnv.Getenv("request_schema_max_body_bytes")
+	if len(requestSchemaMaxBodyBytes) > 0 {
+		val, err := strconv.ParseInt(requestSchemaMaxBodyBytes, 10, 64)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for request_schema_max_body_bytes: %s", requestSchemaMaxBodyBytes)
+		}
+		cfg.RequestSchemaMaxBodyBytes = val
+	}
+
+	maxRequestBodyBytes := hasEnv.Getenv("max_request_body_bytes")
+	if len(maxRequestBodyBytes) > 0 {
+		val, err := strconv.ParseInt(maxRequestBodyBytes, 10, 64)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for max_request_body_bytes: %s", maxRequestBodyBytes)
+		}
+		cfg.MaxRequestBodyBytes = val
+	}
+
+	cfg.TimeBudget = parseIntOrDurationValue(hasEnv.Getenv("time_budget"), 0)
+
+	trustedProxies := hasEnv.Getenv("trusted_proxies")
+	if len(trustedProxies) > 0 {
+		val, err := strconv.Atoi(trustedProxies)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for trusted_proxies: %s", trustedProxies)
+		}
+		cfg.TrustedProxies = val
+	}
+
+	if publicURL := strings.TrimSpace(hasEnv.Getenv("public_url")); len(publicURL) > 0 {
+		u, err := url.Parse(publicURL)
+		if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return nil, fmt.Errorf("invalid value for public_url: %s", publicURL)
+		}
+		cfg.PublicURL = u
+	}
+
+	cfg.ResponseCache = parseBoolValue(hasEnv.Getenv("response_cache"))
+
+	cfg.RequestTap = parseBoolValue(hasEnv.Getenv("request_tap"))
+	for _, function := range strings.Split(hasEnv.Getenv("request_tap_functions"), ",") {
+		if function = strings.TrimSpace(function); len(function) > 0 {
+			cfg.RequestTapFunctions = append(cfg.RequestTapFunctions, function)
+		}
+	}
+
+	cfg.RequestTapSize = 20
+	if size := hasEnv.Getenv("request_tap_size"); len(size) > 0 {
+		val, err := strconv.Atoi(size)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for request_tap_size: %s", size)
+		}
+		cfg.RequestTapSize = val
+	}
+
+	cfg.RequestTapMaxBodyBytes = 4096
+	if maxBodyBytes := hasEnv.Getenv("request_tap_max_body_bytes"); len(maxBodyBytes) > 0 {
+		val, err := strconv.ParseInt(maxBodyBytes, 10, 64)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for request_tap_max_body_bytes: %s", maxBodyBytes)
+		}
+		cfg.RequestTapMaxBodyBytes = val
+	}
+
+	cfg.RequestTapRedactHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+	for _, header := range strings.Split(hasEnv.Getenv("request_tap_redact_headers"), ",") {
+		if header = strings.TrimSpace(header); len(header) > 0 && !containsString(cfg.RequestTapRedactHeaders, http.CanonicalHeaderKey(header)) {
+			cfg.RequestTapRedactHeaders = append(cfg.RequestTapRedactHeaders, http.CanonicalHeaderKey(header))
+		}
+	}
+
+	cfg.ResponseCacheMaxEntries = 1000
+	responseCacheMaxEntries := hasEnv.Getenv("response_cache_max_entries")
+	if len(responseCacheMaxEntries) > 0 {
+		val, err := strconv.Atoi(responseCacheMaxEntries)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for response_cache_max_entries: %s", responseCacheMaxEntries)
+		}
+		cfg.ResponseCacheMaxEntries = val
+	}
+
+	cfg.ResponseCacheMaxBodyBytes = 1024 * 1024
+	responseCacheMaxBodyBytes := hasEnv.Getenv("response_cache_max_body_bytes")
+	if len(responseCacheMaxBodyBytes) > 0 {
+		val, err := strconv.ParseInt(responseCacheMaxBodyBytes, 10, 64)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for response_cache_max_body_bytes: %s", responseCacheMaxBodyBytes)
+		}
+		cfg.ResponseCacheMaxBodyBytes = val
+	}
+
+	cfg.TenantJWTKeyPath = hasEnv.Getenv("tenant_jwt_key_path")
+
+	cfg.TenantJWTClaims = "tenant_id=X-Tenant-Id,roles=X-User-Roles"
+	if tenantJWTClaims := hasEnv.Getenv("tenant_jwt_claims"); len(tenantJWTClaims) > 0 {
+		cfg.TenantJWTClaims = tenantJWTClaims
+	}
+
+	cfg.RequestIDHeader = "X-Request-Id"
+	if requestIDHeader := strings.TrimSpace(hasEnv.Getenv("request_id_header")); len(requestIDHeader) > 0 {
+		cfg.RequestIDHeader = http.CanonicalHeaderKey(requestIDHeader)
+	}
+
+	if traceSampleRate := strings.TrimSpace(hasEnv.Getenv("trace_sample_rate")); len(traceSampleRate) > 0 {
+		val, err := strconv.ParseFloat(traceSampleRate, 64)
+		if err != nil || val < 0 || val > 1 {
+			return nil, fmt.Errorf("invalid value for trace_sample_rate: %s, use a value from 0 to 1", traceSampleRate)
+		}
+		cfg.TraceSampleRate = val
+	}
+
+	for _, header := range strings.Split(hasEnv.Getenv("context_headers"), ",") {
+		if header = strings.TrimSpace(header); len(header) > 0 {
+			cfg.ContextHeaders = append(cfg.ContextHeaders, http.CanonicalHeaderKey(header))
+		}
+	}
+
+	if restrictedHeaders := strings.TrimSpace(hasEnv.Getenv("restricted_headers")); len(restrictedHeaders) > 0 {
+		headers := map[string][]string{}
+		for _, entry := range strings.Split(restrictedHeaders, ";") {
+			header, functions, _ := strings.Cut(strings.TrimSpace(entry), "=")
+			header = strings.TrimSpace(header)
+
+			var allowed []string
+			for _, function := range strings.Split(functions, ",") {
+				if function = strings.TrimSpace(function); len(function) > 0 {
+					allowed = append(allowed, function)
+				}
+			}
+			if len(header) == 0 || len(allowed) == 0 {
+				return nil, fmt.Errorf("invalid value for restricted_headers: %q, want header=function,...", entry)
+			}
+			headers[http.CanonicalHeaderKey(header)] = allowed
+		}
+		cfg.RestrictedHeaders = headers
+	}
+
+	// Context headers are never stripped, so they take precedence over the
+	// gateway controlled headers
+	for _, header := range strings.Split(hasEnv.Getenv("gateway_controlled_headers"), ",") {
+		if header = strings.TrimSpace(header); len(header) > 0 && !containsString(cfg.ContextHeaders, http.CanonicalHeaderKey(header)) {
+			cfg.GatewayControlledHeaders = append(cfg.GatewayControlledHeaders, http.CanonicalHeaderKey(header))
+		}
+	}
+
+	cfg.AuditLogPath = hasEnv.Getenv("audit_log_path")
+
+	cfg.AuditLogBufferSize = 1000
+	auditLogBufferSize := hasEnv.Getenv("audit_log_buffer_size")
+	if len(auditLogBufferSize) > 0 {
+		val, err := strconv.Atoi(auditLogBufferSize)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for audit_log_buffer_size: %s", auditLogBufferSize)
+		}
+		cfg.AuditLogBufferSize = val
+	}
+
+	cfg.AsyncModeHeader = hasEnv.Getenv("async_mode_header")
+
+	cfg.AsyncNotifiers = parseBoolValue(hasEnv.Getenv("async_notifiers"))
+
+	cfg.AsyncNotifierWorkers = 4
+	asyncNotifierWorkers := hasEnv.Getenv("async_notifier_workers")
+	if len(asyncNotifierWorkers) > 0 {
+		val, err := strconv.Atoi(asyncNotifierWorkers)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for async_notifier_workers: %s", asyncNotifierWorkers)
+		}
+		cfg.AsyncNotifierWorkers = val
+	}
+
+	cfg.AsyncNotifierQueueSize = 1000
+	asyncNotifierQueueSize := hasEnv.Getenv("async_notifier_queue_size")
+	if len(asyncNotifierQueueSize) > 0 {
+		val, err := strconv.Atoi(asyncNotifierQueueSize)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for async_notifier_queue_size: %s", asyncNotifierQueueSize)
+		}
+		cfg.AsyncNotifierQueueSize = val
+	}
+
+	cfg.StatsDHost = strings.TrimSpace(hasEnv.Getenv("statsd_host"))
+
+	cfg.StatsDPort = 8125
+	if statsdPort := hasEnv.Getenv("statsd_port"); len(statsdPort) > 0 {
+		val, err := strconv.Atoi(statsdPort)
+		if err != nil || val <= 0 || val > 65535 {
+			return nil, fmt.Errorf("invalid value for statsd_port: %s", statsdPort)
+		}
+		cfg.StatsDPort = val
+	}
+
+	cfg.StatsDPrefix = "openfaas.gateway"
+	if statsdPrefix := strings.TrimSpace(hasEnv.Getenv("statsd_prefix")); len(statsdPrefix) > 0 {
+		cfg.StatsDPrefix = statsdPrefix
+	}
+
+	cfg.StatsDSampleRate = 1
+	if sampleRate := strings.TrimSpace(hasEnv.Getenv("statsd_sample_rate")); len(sampleRate) > 0 {
+		val, err := strconv.ParseFloat(sampleRate, 64)
+		if err != nil || val <= 0 || val > 1 {
+			return nil, fmt.Errorf("invalid value for statsd_sample_rate: %s, use a value above 0 up to 1", sampleRate)
+		}
+		cfg.StatsDSampleRate = val
+	}
+
+	cfg.LatencySummaryWindow = parseIntOrDurationValue(hasEnv.Getenv("latency_summary_window"), time.Minute)
+
+	cfg.InvocationStatsMaxFunctions = 1000
+	invocationStatsMaxFunctions := hasEnv.Getenv("invocation_stats_max_functions")
+	if len(invocationStatsMaxFunctions) > 0 {
+		val, err := strconv.Atoi(invocationStatsMaxFunctions)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for invocation_stats_max_functions: %s", invocationStatsMaxFunctions)
+		}
+		cfg.InvocationStatsMaxFunctions = val
+	}
+
+	cfg.LatencySummaryMaxFunctions = 1000
+	latencySummaryMaxFunctions := hasEnv.Getenv("latency_summary_max_functions")
+	if len(latencySummaryMaxFunctions) > 0 {
+		val, err := strconv.Atoi(latencySummaryMaxFunctions)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for latency_summary_max_functions: %s", latencySummaryMaxFunctions)
+		}
+		cfg.LatencySummaryMaxFunctions = val
+	}
+
+	cfg.BatchMaxConcurrency = 10
+	batchMaxConcurrency := hasEnv.Getenv("batch_max_concurrency")
+	if len(batchMaxConcurrency) > 0 {
+		val, err := strconv.Atoi(batchMaxConcurrency)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for batch_max_concurrency: %s", batchMaxConcurrency)
+		}
+		cfg.BatchMaxConcurrency = val
+	}
+
+	cfg.BatchMaxItems = 100
+	batchMaxItems := hasEnv.Getenv("batch_max_items")
+	if len(batchMaxItems) > 0 {
+		val, err := strconv.Atoi(batchMaxItems)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for batch_max_items: %s", batchMaxItems)
+		}
+		cfg.BatchMaxItems = val
+	}
+
+	cfg.BatchMaxBodyBytes = 1024 * 1024
+	batchMaxBodyBytes := hasEnv.Getenv("batch_max_body_bytes")
+	if len(batchMaxBodyBytes) > 0 {
+		val, err := strconv.ParseInt(batchMaxBodyBytes, 10, 64)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for batch_max_body_bytes: %s", batchMaxBodyBytes)
+		}
+		cfg.BatchMaxBodyBytes = val
+	}
+
+	cfg.ReplayProtection = parseBoolValue(hasEnv.Getenv("replay_protection"))
+
+	cfg.ReplayNonceHeader = "X-Nonce"
+	if nonceHeader := hasEnv.Getenv("replay_nonce_header"); len(nonceHeader) > 0 {
+		cfg.ReplayNonceHeader = nonceHeader
+	}
+
+	cfg.ReplayTimestampHeader = "X-Timestamp"
+	if timestampHeader := hasEnv.Getenv("replay_timestamp_header"); len(timestampHeader) > 0 {
+		cfg.ReplayTimestampHeader = timestampHeader
+	}
+
+	cfg.ReplayWindow = parseIntOrDurationValue(hasEnv.Getenv("replay_window"), time.Minute*5)
+
+	cfg.ReplayNonceMaxEntries = 100000
+	replayNonceMaxEntries := hasEnv.Getenv("replay_nonce_max_entries")
+	if len(replayNonceMaxEntries) > 0 {
+		val, err := strconv.Atoi(replayNonceMaxEntries)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for replay_nonce_max_entries: %s", replayNonceMaxEntries)
+		}
+		cfg.ReplayNonceMaxEntries = val
+	}
+
+	cfg.ReplayRedisAddress = hasEnv.Getenv("replay_redis_address")
+	cfg.ReplayRedisPassword = hasEnv.Getenv("replay_redis_password")
+
+	cfg.TrailingSlash = "preserve"
+	if trailingSlash := strings.TrimSpace(hasEnv.Getenv("trailing_slash")); len(trailingSlash) > 0 {
+		if !containsString([]string{"preserve", "strip", "add"}, trailingSlash) {
+			return nil, fmt.Errorf("invalid value for trailing_slash: %s, use preserve, strip or add", trailingSlash)
+		}
+		cfg.TrailingSlash = trailingSlash
+	}
+
+	cfg.LoadBalancer = "round-robin"
+	if loadBalancer := strings.TrimSpace(hasEnv.Getenv("load_balancer")); len(loadBalancer) > 0 {
+		cfg.LoadBalancer = loadBalancer
+	}
+
+	outlierFailures := hasEnv.Getenv("outlier_consecutive_failures")
+	if len(outlierFailures) > 0 {
+		val, err := strconv.Atoi(outlierFailures)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid value for outlier_consecutive_failures: %s", outlierFailures)
+		}
+		cfg.OutlierConsecutiveFailures = val
+	}
+
+	cfg.OutlierEjectionTime = parseIntOrDurationValue(hasEnv.Getenv("outlier_ejection_time"), time.Second*30)
+
+	cfg.HealthScoreDecay = 0.1
+	if decay := strings.TrimSpace(hasEnv.Getenv("health_score_decay")); len(decay) > 0 {
+		val, err := strconv.ParseFloat(decay, 64)
+		if err != nil || val <= 0 || val > 1 {
+			return nil, fmt.Errorf("invalid value for health_score_decay: %s, use a value above 0 and up to 1", decay)
+		}
+		cfg.HealthScoreDecay = val
+	}
+
+	cfg.HealthScoreLatencyTarget = parseIntOrDurationValue(hasEnv.Getenv("health_score_latency_target"), time.Millisecond*100)
+
+	cfg.HealthScoreMinScore = 0.05
+	if minScore := strings.TrimSpace(hasEnv.Getenv("health_score_min_score")); len(minScore) > 0 {
+		val, err := strconv.ParseFloat(minScore, 64)
+		if err != nil || val < 0 || val > 1 {
+			return nil, fmt.Errorf("invalid value for health_score_min_score: %s, use a value from 0 to 1", minScore)
+		}
+		cfg.HealthScoreMinScore = val
+	}
+
 	return &cfg, nil
 }
 
+// gatewayRoutePrefixes are served by the gateway itself, so cannot be the
+// path prefix of a custom scale rule
+var gatewayRoutePrefixes = []string{"/function/", "/async-function/", "/system/", "/batch", "/ui/", "/metrics", "/healthz", "/debug/"}
+
+// overlapsGatewayRoutes returns true when a path prefix could match one of
+// the gateway's own routes, or one of them could match it
+func overlapsGatewayRoutes(pathPrefix string) bool {
+	for _, route := range gatewayRoutePrefixes {
+		if strings.HasPrefix(pathPrefix, route) || strings.HasPrefix(route, pathPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// FailoverPeer is the gateway of another region
+type FailoverPeer struct {
+	Region string
+	URL    string
+
+	// AuthSecretPath is where the basic auth secrets for the peer's
+	// gateway are mounted, none are sent when empty
+	AuthSecretPath string
+}
+
 // GatewayConfig provides config for the API Gateway server process
 type GatewayConfig struct {
 
@@ -177,9 +1002,39 @@ type GatewayConfig struct {
 	// HTTP timeout for writing a response from functions.
 	WriteTimeout time.Duration
 
+	// ClientKeepAliveTimeout is how long an idle client connection is kept
+	// open for its next request, ReadTimeout is used when 0
+	ClientKeepAliveTimeout time.Duration
+
 	// UpstreamTimeout maximum duration of HTTP call to upstream URL
 	UpstreamTimeout time.Duration
 
+	// LogUpstreamConnectionClose logs each response after which a function
+	// closes the connection, they are always counted in a metric
+	LogUpstreamConnectionClose bool
+
+	// UpstreamExplicitEmptyBody sends an explicit zero-length body for POST,
+	// PUT and PATCH requests without a body
+	UpstreamExplicitEmptyBody bool
+
+	// MaxFunctionTimeout is the longest timeout a function may set with the
+	// com.openfaas.timeout annotation, no limit when 0
+	MaxFunctionTimeout time.Duration
+
+	// UpstreamChunkTimeout maximum duration to wait for the next chunk of a response
+	// body from the upstream URL, disabled when 0
+	UpstreamChunkTimeout time.Duration
+
+	// UpstreamFlushInterval flushes function responses to clients periodically
+	// whilst the body is copied, disabled when 0
+	UpstreamFlushInterval time.Duration
+
+	// UpstreamResponseBufferBytes is the largest function response read in full
+	// before it is written to the client, larger responses are streamed. Every
+	// response is streamed when 0, as it is by default, since a response of an
+	// unknown length may be an event stream the function flushes as it goes.
+	UpstreamResponseBufferBytes int64
+
 	// URL for alternate functions provider.
 	FunctionsProviderURL *url.URL
 
@@ -210,15 +1065,165 @@ type GatewayConfig struct {
 	// SecretMountPath specifies where to read secrets from for embedded basic auth
 	SecretMountPath string
 
+	// NamespaceAuthSecrets maps a namespace to where its basic auth secrets
+	// are mounted, requests to functions in it are sent with these
+	// credentials in place of those in SecretMountPath
+	NamespaceAuthSecrets map[string]string
+
 	// Enable the gateway to scale any service from 0 replicas to its configured "min replicas"
 	ScaleFromZero bool
 
+	// ScaleHint allows callers to request a replica count with the _scale query parameter
+	// when scaling from zero, it is only honoured with the secret from ScaleHintSecretPath
+	ScaleHint bool
+
+	// ScaleHintSecretPath is a file with the secret callers send in the
+	// X-Scale-Hint-Secret header to use the _scale query parameter
+	ScaleHintSecretPath string
+
+	// ReplicasHeader sets the X-Function-Replicas header on responses to the
+	// replicas a function had when the request was forwarded
+	ReplicasHeader bool
+
+	// ScaleCacheExpiry is how long a function's cached replica count is trusted,
+	// warm functions are invoked without querying the provider within this time
+	ScaleCacheExpiry time.Duration
+
+	// ScaleDownDrainTimeout is how long a scale to zero waits for the
+	// function's in-flight requests to complete, disabled when 0
+	ScaleDownDrainTimeout time.Duration
+
+	// ScaleLatencyTarget requests more replicas when requests wait longer than this
+	// for a function to be available, disabled when 0
+	ScaleLatencyTarget time.Duration
+
+	// ScaleLatencyStep is the amount of replicas added when ScaleLatencyTarget is exceeded
+	ScaleLatencyStep uint64
+
+	// ScaleEventsURL receives a JSON scale event for each scale from zero and
+	// each request to scale a function, when set
+	ScaleEventsURL *url.URL
+
+	// FailoverRegion names this gateway's region to the gateways of its
+	// FailoverPeers
+	FailoverRegion string
+
+	// FailoverPeers are the gateways of other regions, used in turn for
+	// requests to functions which cannot be scheduled in this region
+	FailoverPeers []FailoverPeer
+
+	// ScaleRules are the requests to the provider which set the replicas of
+	// a function, DefaultScaleRules when nil
+	ScaleRules []ScaleRule
+
+	// ScaleEventsBuffer is how many scale events are queued to be sent before
+	// further events are dropped
+	ScaleEventsBuffer int
+
+	// ScaleNotFoundStatus is returned when scaling a function which cannot be found
+	ScaleNotFoundStatus int
+
+	// ScaleNotFoundStatusPrefixes overrides ScaleNotFoundStatus by request path prefix
+	ScaleNotFoundStatusPrefixes map[string]int
+
+	// CatchAllFunctions maps a namespace to the function which receives the
+	// requests for functions which cannot be found in the namespace
+	CatchAllFunctions map[string]string
+
 	// MaxIdleConns with a default value of 1024, can be used for tuning HTTP proxy performance
 	MaxIdleConns int
 
 	// MaxIdleConnsPerHost with a default value of 1024, can be used for tuning HTTP proxy performance
 	MaxIdleConnsPerHost int
 
+	// ProxyTransportMetrics exports connection-level metrics for the HTTP proxy's transport
+	ProxyTransportMetrics bool
+
+	// DNSCacheTTL caches upstream DNS lookups made by the HTTP proxy for this duration,
+	// disabled when 0
+	DNSCacheTTL time.Duration
+
+	// UpstreamTLSMinVersion is the minimum TLS version for https upstreams, TLS 1.2 by default
+	UpstreamTLSMinVersion uint16
+
+	// UpstreamTLSCipherSuites are the cipher suites allowed for https upstreams,
+	// Go's secure defaults when empty
+	UpstreamTLSCipherSuites []uint16
+
+	// UpstreamUserAgent replaces the User-Agent of requests to functions when set
+	UpstreamUserAgent string
+
+	// AppendUpstreamUserAgent appends UpstreamUserAgent to the client's User-Agent instead
+	AppendUpstreamUserAgent bool
+
+	// ServerHeader replaces the Server header of function responses when set
+	ServerHeader string
+
+	// StripServerHeader removes the Server header from function responses
+	StripServerHeader bool
+
+	// VersionHeader adds the gateway's version to function responses in the
+	// X-Gateway-Version header
+	VersionHeader bool
+
+	// TimingHeaders adds a Server-Timing header to function responses with the
+	// time taken to scale the function, to send the request body, to wait for
+	// the function and by the gateway in total
+	TimingHeaders bool
+
+	// TimeoutBreakdown adds the time taken to scale the function, to connect
+	// to it, until its first byte and in total to 504 responses and logs it
+	TimeoutBreakdown bool
+
+	// SlowRequestThreshold logs the detail of function requests which take
+	// longer in total, disabled when 0
+	SlowRequestThreshold time.Duration
+
+	// MaxResponseHeaders is the most header values copied from a function response, unlimited when 0
+	MaxResponseHeaders int
+
+	// MaxResponseHeaderBytes is the most bytes of headers copied from a function response, unlimited when 0
+	MaxResponseHeaderBytes int
+
+	// MarkTruncatedHeaders sets X-Headers-Truncated: true when response headers are dropped
+	MarkTruncatedHeaders bool
+
+	// ClientTimeoutHeader carries a deadline in milliseconds from clients, which
+	// shortens UpstreamTimeout for the request, disabled when blank
+	ClientTimeoutHeader string
+
+	// RegionHeader carries the client's region, which selects the deployment
+	// of functions with the com.openfaas.regions annotation
+	RegionHeader string
+
+	// DefaultRegion is used when the client's region is missing or unknown
+	DefaultRegion string
+
+	// FeatureFlagHeader carries the client's feature variant, which selects
+	// the deployment of functions with the com.openfaas.feature-variants annotation
+	FeatureFlagHeader string
+
+	// StripFeatureFlagHeader removes FeatureFlagHeader from requests routed
+	// by their feature variant
+	StripFeatureFlagHeader bool
+
+	// UpstreamDialTimeout bounds establishing a connection to a function, so that
+	// dead hosts fail fast whilst slow functions get the full UpstreamTimeout
+	UpstreamDialTimeout time.Duration
+
+	// UpstreamKeepAlive is the TCP keep-alive interval for upstream connections,
+	// UpstreamTimeout by default and disabled when negative
+	UpstreamKeepAlive time.Duration
+
+	// UpstreamTCPNoDelay sets TCP_NODELAY on upstream connections, as Go does by default
+	UpstreamTCPNoDelay bool
+
+	// UpstreamProxyURL is an HTTP or SOCKS5 proxy used to reach functions
+	UpstreamProxyURL *url.URL
+
+	// UpstreamProxyNamespaces overrides UpstreamProxyURL for functions in a namespace
+	UpstreamProxyNamespaces map[string]*url.URL
+
 	// AuthProxyURL specifies URL for an authenticating proxy, disabled when blank, enabled when valid URL i.e. http://basic-auth.openfaas:8080/validate
 	AuthProxyURL string
 
@@ -227,6 +1232,296 @@ type GatewayConfig struct {
 
 	// Namespace for endpoints
 	Namespace string
+
+	// CircuitBreakerThreshold is the number of consecutive failures for a function
+	// before its circuit is opened, disabled when 0
+	CircuitBreakerThreshold int
+
+	// CircuitBreakerOpenDuration is how long a circuit stays open before a trial
+	// request is forwarded to the function
+	CircuitBreakerOpenDuration time.Duration
+
+	// NotFoundBackoffThreshold is the amount of not-found responses for a function
+	// before a client is backed off when scaling from zero, disabled when 0
+	NotFoundBackoffThreshold int
+
+	// NotFoundBackoffCooldown is the time without requests before a client's backoff is reset
+	NotFoundBackoffCooldown time.Duration
+
+	// NotFoundBackoffMaxEntries bounds the amount of client and function pairs tracked
+	NotFoundBackoffMaxEntries int
+
+	// MaxConcurrentColdStarts limits how many functions are scaled from zero at
+	// once, the rest are queued by priority, disabled when 0
+	MaxConcurrentColdStarts int
+
+	// ColdStartPriorityAging is how long a queued cold start waits before its
+	// priority is raised by one, so that low priority functions are not starved
+	ColdStartPriorityAging time.Duration
+
+	// ColdStartNamespaceWeights is the share of queued cold starts given to
+	// each namespace, namespaces which are not listed have a weight of 1
+	ColdStartNamespaceWeights map[string]int
+
+	// ColdStartNamespaceLimits caps the concurrent cold starts of a namespace
+	ColdStartNamespaceLimits map[string]int
+
+	// ColdStartProgress adds the function's place in the cold start queue
+	// and an estimate of when it will be ready to the responses which tell
+	// clients to poll during a cold start
+	ColdStartProgress bool
+
+	// ColdStartHistorySize is the amount of recent cold starts of each
+	// function averaged for the estimate
+	ColdStartHistorySize int
+
+	// LoadShedding enables shedding of requests by their X-Priority header for functions
+	// with the com.openfaas.concurrency.max annotation
+	LoadShedding bool
+
+	// CostClassWeights is the weight counted against a function's
+	// concurrency by requests of each X-Cost-Class, 1 for other requests
+	CostClassWeights map[string]int64
+
+	// CacheWarming looks up every function from the provider after the
+	// gateway starts, so that the first requests do not wait for lookups
+	CacheWarming bool
+
+	// CacheWarmingConcurrency is the most lookups in flight whilst warming
+	CacheWarmingConcurrency int
+
+	// CacheWarmingRate is the most lookups per second whilst warming,
+	// unlimited when 0
+	CacheWarmingRate int
+
+	// RequestTap keeps the last requests to RequestTapFunctions so that they
+	// can be inspected and replayed, for debugging only
+	RequestTap bool
+
+	// RequestTapFunctions are the functions whose requests are kept, as name
+	// or name.namespace
+	RequestTapFunctions []string
+
+	// RequestTapSize is how many requests are kept for each function
+	RequestTapSize int
+
+	// RequestTapMaxBodyBytes is the most bytes of each request body kept
+	RequestTapMaxBodyBytes int64
+
+	// RequestTapRedactHeaders are headers whose values are never kept
+	RequestTapRedactHeaders []string
+
+	// AdmissionControl rejects a fraction of requests to functions whilst the
+	// gateway's load is above AdmissionThreshold
+	AdmissionControl bool
+
+	// AdmissionMaxInFlight is the amount of requests in flight through the
+	// gateway at which its load is 1
+	AdmissionMaxInFlight int64
+
+	// AdmissionLatencyTarget is the average invocation latency at which the
+	// gateway's load is 1, 0 to leave latency out of the load
+	AdmissionLatencyTarget time.Duration
+
+	// AdmissionRetryAfter is sent in the Retry-After header of rejected requests
+	AdmissionRetryAfter time.Duration
+
+	// AdmissionThreshold is the load above which requests are rejected
+	AdmissionThreshold float64
+
+	// FaultInjection delays or aborts requests to functions with the
+	// com.openfaas.fault annotations, for resilience testing only
+	FaultInjection bool
+
+	// ResponseRedaction enables redaction of JSON fields from responses of functions
+	// with the com.openfaas.redact annotation
+	ResponseRedaction bool
+
+	// ResponseRedactionMaxBodyBytes is the largest response which will be buffered for redaction
+	ResponseRedactionMaxBodyBytes int64
+
+	// SelfLinkMaxBodyBytes is the largest response which will be buffered to add
+	// the link from a function's com.openfaas.self-link annotation
+	SelfLinkMaxBodyBytes int64
+
+	// URLRewriteMaxBodyBytes is the largest response which will be buffered to
+	// rewrite the URL prefixes in a function's com.openfaas.rewrite-urls annotation
+	URLRewriteMaxBodyBytes int64
+
+	// ContentTransformMaxBodyBytes is the largest request or response body
+	// buffered to convert it for a function's com.openfaas.content-transform
+	ContentTransformMaxBodyBytes int64
+
+	// BodyChecksumMaxBodyBytes is the largest request body buffered to verify
+	// its checksum before it is sent, larger bodies are verified as they are
+	// streamed to a function with the com.openfaas.body-checksum annotation
+	BodyChecksumMaxBodyBytes int64
+
+	// RequestSchemaDir has the JSON Schema files named by functions'
+	// com.openfaas.request-schema-ref annotation
+	RequestSchemaDir string
+
+	// RequestSchemaMaxBodyBytes is the largest request body buffered to
+	// validate it against a function's JSON Schema
+	RequestSchemaMaxBodyBytes int64
+
+	// MaxRequestBodyBytes is the largest request body streamed to a function
+	// without the com.openfaas.max-request-bytes annotation, 0 for no limit
+	MaxRequestBodyBytes int64
+
+	// TimeBudget is the total time a request may take, from scaling the function
+	// to streaming its response, for functions without the com.openfaas.time-budget
+	// annotation, 0 for no budget
+	TimeBudget time.Duration
+
+	// TrustedProxies is the amount of proxies in front of the gateway which append
+	// to X-Forwarded-For, used to find the client's address for a function's
+	// com.openfaas.allowed-sources annotation and the not-found backoff
+	TrustedProxies int
+
+	// PublicURL is the gateway's URL as seen by clients, used for links in
+	// responses in place of the request's Host header
+	PublicURL *url.URL
+
+	// ResponseCache caches GET responses for functions with the com.openfaas.cache.ttl annotation
+	ResponseCache bool
+
+	// ResponseCacheMaxEntries is the amount of responses held in the response cache
+	ResponseCacheMaxEntries int
+
+	// ResponseCacheMaxBodyBytes is the largest response body which will be cached
+	ResponseCacheMaxBodyBytes int64
+
+	// TenantJWTKeyPath is a file with an RSA public key (PEM) or HMAC secret used to validate
+	// JWTs for function invocations, when set the mapped claims are forwarded as headers
+	TenantJWTKeyPath string
+
+	// TenantJWTClaims maps JWT claims to headers as a comma-separated list of claim=Header
+	TenantJWTClaims string
+
+	// GatewayControlledHeaders are removed from requests before any middleware runs
+	// so that clients cannot spoof them
+	GatewayControlledHeaders []string
+
+	// RequestIDHeader is read, or generated when missing, and forwarded to
+	// functions with an ID for each request
+	RequestIDHeader string
+
+	// TraceSampleRate is the fraction of new traces which are sampled, a
+	// client's sampling decision is always kept
+	TraceSampleRate float64
+
+	// ContextHeaders are always forwarded to functions and back to clients, i.e.
+	// a tenant, locale or feature flags, and are never stripped by the gateway
+	ContextHeaders []string
+
+	// RestrictedHeaders maps a request header to the only functions it is
+	// forwarded to, other functions never receive it
+	RestrictedHeaders map[string][]string
+
+	// AuditLogPath is a file which an audit record is appended to for every function
+	// invocation, disabled when blank
+	AuditLogPath string
+
+	// AuditLogBufferSize is the amount of audit records buffered before records are dropped
+	AuditLogBufferSize int
+
+	// AsyncModeHeader when set, queues POST requests to /function/ which carry
+	// the header as if they were sent to /async-function/, requires NATS
+	AsyncModeHeader string
+
+	// AsyncNotifiers calls notifiers from a pool of workers instead of the request path,
+	// notifications are dropped when the workers cannot keep up
+	AsyncNotifiers bool
+
+	// AsyncNotifierWorkers is the amount of workers calling notifiers
+	AsyncNotifierWorkers int
+
+	// AsyncNotifierQueueSize is the amount of notifications queued per worker
+	AsyncNotifierQueueSize int
+
+	// StatsDHost when set, the metrics of function invocations are also sent
+	// to a StatsD server on this host
+	StatsDHost string
+
+	// StatsDPort is the UDP port of the StatsD server
+	StatsDPort int
+
+	// StatsDPrefix is the first part of the name of each StatsD metric
+	StatsDPrefix string
+
+	// StatsDSampleRate is the fraction of requests sent to StatsD
+	StatsDSampleRate float64
+
+	// LatencySummaryWindow is the rolling window over which latency
+	// percentiles are reported for each function
+	LatencySummaryWindow time.Duration
+
+	// InvocationStatsMaxFunctions is the most functions whose invocations are
+	// counted at once, 0 for no limit
+	InvocationStatsMaxFunctions int
+
+	// LatencySummaryMaxFunctions is the most functions whose latency is
+	// summarised at once, 0 for no limit
+	LatencySummaryMaxFunctions int
+
+	// BatchMaxConcurrency is the amount of functions invoked concurrently for a batch request
+	BatchMaxConcurrency int
+
+	// BatchMaxItems is the largest amount of function invocations in a batch request
+	BatchMaxItems int
+
+	// BatchMaxBodyBytes is the largest batch request body, and the largest
+	// response buffered for each of its items, 0 for no limit
+	BatchMaxBodyBytes int64
+
+	// ReplayProtection rejects function invocations without a fresh timestamp and unused nonce
+	ReplayProtection bool
+
+	// ReplayNonceHeader is the header carrying a unique value for each request
+	ReplayNonceHeader string
+
+	// ReplayTimestampHeader is the header carrying the request time in Unix seconds
+	ReplayTimestampHeader string
+
+	// ReplayWindow is the maximum difference between the request timestamp and the gateway's clock
+	ReplayWindow time.Duration
+
+	// ReplayNonceMaxEntries is the amount of nonces kept by the in-memory store
+	ReplayNonceMaxEntries int
+
+	// ReplayRedisAddress is a Redis server used to share nonces between replicas,
+	// nonces are kept in memory when blank
+	ReplayRedisAddress string
+
+	// ReplayRedisPassword is used to authenticate with ReplayRedisAddress
+	ReplayRedisPassword string
+
+	// TrailingSlash is "strip" or "add" to normalize the trailing slash of
+	// paths forwarded to functions, or "preserve" to forward them as requested
+	TrailingSlash string
+
+	// LoadBalancer picks one of a function's endpoints unless the function
+	// selects another with an annotation
+	LoadBalancer string
+
+	// OutlierConsecutiveFailures ejects an endpoint after this many failed
+	// requests in a row, disabled when 0 unless enabled by an annotation
+	OutlierConsecutiveFailures int
+
+	// OutlierEjectionTime is how long an endpoint stays ejected before it is probed
+	OutlierEjectionTime time.Duration
+
+	// HealthScoreDecay is the weight of each new outcome in the health-score
+	// load balancer's moving averages
+	HealthScoreDecay float64
+
+	// HealthScoreLatencyTarget is the average latency which halves an
+	// endpoint's health score
+	HealthScoreLatencyTarget time.Duration
+
+	// HealthScoreMinScore is the lowest health score of an endpoint
+	HealthScoreMinScore float64
 }
 
 // UseNATS Use NATSor not
@@ -239,3 +1534,8 @@ func (g *GatewayConfig) UseNATS() bool {
 func (g *GatewayConfig) UseExternalProvider() bool {
 	return g.FunctionsProviderURL != nil
 }
+
+// UseCircuitBreaker enables the per-function circuit breaker
+func (g *GatewayConfig) UseCircuitBreaker() bool {
+	return g.CircuitBreakerThreshold > 0
+}
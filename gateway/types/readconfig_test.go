@@ -4,7 +4,10 @@
 package types
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net/http"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -139,6 +142,22 @@ func TestRead_ReadAndWriteTimeoutConfig(t *testing.T) {
 	}
 }
 
+func TestRead_ClientKeepAliveTimeout(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.ClientKeepAliveTimeout != 0 {
+		t.Errorf("ClientKeepAliveTimeout want: %s, got: %s", time.Duration(0), config.ClientKeepAliveTimeout)
+	}
+
+	defaults.Setenv("client_keep_alive_timeout", "30s")
+	config, _ = readConfig.Read(defaults)
+	if config.ClientKeepAliveTimeout != time.Second*30 {
+		t.Errorf("ClientKeepAliveTimeout want: %s, got: %s", time.Second*30, config.ClientKeepAliveTimeout)
+	}
+}
+
 func TestRead_ReadAndWriteTimeoutDurationConfig(t *testing.T) {
 	defaults := NewEnvBucket()
 	defaults.Setenv("read_timeout", "20s")
@@ -436,3 +455,1219 @@ func TestRead_LogsProviderURL(t *testing.T) {
 		}
 	})
 }
+
+func TestRead_CircuitBreaker_Defaults(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+
+	if config.UseCircuitBreaker() {
+		t.Errorf("Default for UseCircuitBreaker should be false")
+	}
+
+	want := time.Second * 30
+	if config.CircuitBreakerOpenDuration != want {
+		t.Errorf("CircuitBreakerOpenDuration want: %s, got: %s", want, config.CircuitBreakerOpenDuration)
+	}
+}
+
+func TestRead_CircuitBreaker_Override(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	defaults.Setenv("circuit_breaker_threshold", "5")
+	defaults.Setenv("circuit_breaker_open_duration", "10s")
+
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !config.UseCircuitBreaker() || config.CircuitBreakerThreshold != 5 {
+		t.Errorf("CircuitBreakerThreshold want: %d, got: %d", 5, config.CircuitBreakerThreshold)
+	}
+
+	want := time.Second * 10
+	if config.CircuitBreakerOpenDuration != want {
+		t.Errorf("CircuitBreakerOpenDuration want: %s, got: %s", want, config.CircuitBreakerOpenDuration)
+	}
+}
+
+func TestRead_ScaleNotFoundStatus(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.ScaleNotFoundStatus != http.StatusNotFound {
+		t.Errorf("ScaleNotFoundStatus want: %d, got: %d", http.StatusNotFound, config.ScaleNotFoundStatus)
+	}
+
+	defaults.Setenv("scale_not_found_status", "410")
+	defaults.Setenv("scale_not_found_status_prefixes", "/function/legacy-=503, /async-function/=404")
+
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ScaleNotFoundStatus != http.StatusGone {
+		t.Errorf("ScaleNotFoundStatus want: %d, got: %d", http.StatusGone, config.ScaleNotFoundStatus)
+	}
+	if got := config.ScaleNotFoundStatusPrefixes["/function/legacy-"]; got != http.StatusServiceUnavailable {
+		t.Errorf("prefix status want: %d, got: %d", http.StatusServiceUnavailable, got)
+	}
+	if got := config.ScaleNotFoundStatusPrefixes["/async-function/"]; got != http.StatusNotFound {
+		t.Errorf("prefix status want: %d, got: %d", http.StatusNotFound, got)
+	}
+}
+
+func TestRead_ScaleNotFoundStatus_Invalid(t *testing.T) {
+	for _, value := range []string{"200", "302", "600", "gone"} {
+		defaults := NewEnvBucket()
+		readConfig := ReadConfig{}
+
+		defaults.Setenv("scale_not_found_status", value)
+		if _, err := readConfig.Read(defaults); err == nil {
+			t.Errorf("want error for status %q", value)
+		}
+
+		defaults = NewEnvBucket()
+		defaults.Setenv("scale_not_found_status_prefixes", "/function/="+value)
+		if _, err := readConfig.Read(defaults); err == nil {
+			t.Errorf("want error for prefix status %q", value)
+		}
+	}
+}
+
+func TestRead_CatchAllFunctions(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if len(config.CatchAllFunctions) != 0 {
+		t.Errorf("want no catch-all functions, got: %v", config.CatchAllFunctions)
+	}
+
+	defaults.Setenv("catch_all_functions", "openfaas-fn=not-found, dev = fallback")
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.CatchAllFunctions["openfaas-fn"] != "not-found" || config.CatchAllFunctions["dev"] != "fallback" {
+		t.Errorf("CatchAllFunctions want: openfaas-fn=not-found dev=fallback, got: %v", config.CatchAllFunctions)
+	}
+
+	for _, invalid := range []string{"openfaas-fn", "=not-found", "openfaas-fn=", "openfaas-fn=not-found.dev"} {
+		defaults.Setenv("catch_all_functions", invalid)
+		if _, err := readConfig.Read(defaults); err == nil {
+			t.Errorf("want an error for catch_all_functions: %q", invalid)
+		}
+	}
+}
+
+func TestRead_ReplayProtection_Defaults(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+
+	if config.ReplayProtection {
+		t.Errorf("Default for ReplayProtection should be false")
+	}
+	if config.ReplayNonceHeader != "X-Nonce" || config.ReplayTimestampHeader != "X-Timestamp" {
+		t.Errorf("unexpected default headers: %s, %s", config.ReplayNonceHeader, config.ReplayTimestampHeader)
+	}
+
+	want := time.Minute * 5
+	if config.ReplayWindow != want {
+		t.Errorf("ReplayWindow want: %s, got: %s", want, config.ReplayWindow)
+	}
+}
+
+func TestRead_UpstreamDialer(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if !config.UpstreamTCPNoDelay {
+		t.Errorf("Default for UpstreamTCPNoDelay should be true")
+	}
+	if config.UpstreamKeepAlive != config.UpstreamTimeout {
+		t.Errorf("UpstreamKeepAlive want: %s, got: %s", config.UpstreamTimeout, config.UpstreamKeepAlive)
+	}
+	if config.UpstreamDialTimeout != config.UpstreamTimeout {
+		t.Errorf("UpstreamDialTimeout want: %s, got: %s", config.UpstreamTimeout, config.UpstreamDialTimeout)
+	}
+
+	defaults.Setenv("upstream_tcp_nodelay", "false")
+	defaults.Setenv("upstream_keep_alive", "-1s")
+	defaults.Setenv("upstream_dial_timeout", "2s")
+
+	config, _ = readConfig.Read(defaults)
+	if config.UpstreamTCPNoDelay {
+		t.Errorf("UpstreamTCPNoDelay should be false")
+	}
+	if config.UpstreamKeepAlive != -time.Second {
+		t.Errorf("UpstreamKeepAlive want: %s, got: %s", -time.Second, config.UpstreamKeepAlive)
+	}
+	if config.UpstreamDialTimeout != time.Second*2 {
+		t.Errorf("UpstreamDialTimeout want: %s, got: %s", time.Second*2, config.UpstreamDialTimeout)
+	}
+}
+
+func TestRead_UpstreamTLS(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.UpstreamTLSMinVersion != tls.VersionTLS12 {
+		t.Errorf("UpstreamTLSMinVersion want: %d, got: %d", tls.VersionTLS12, config.UpstreamTLSMinVersion)
+	}
+
+	defaults.Setenv("upstream_tls_min_version", "1.0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want error for TLS 1.0")
+	}
+}
+
+func TestRead_GatewayControlledHeaders(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	defaults.Setenv("gateway_controlled_headers", "x-tenant-id, X-User-Roles,")
+	config, _ := readConfig.Read(defaults)
+
+	want := []string{"X-Tenant-Id", "X-User-Roles"}
+	if len(config.GatewayControlledHeaders) != len(want) {
+		t.Fatalf("want: %v, got: %v", want, config.GatewayControlledHeaders)
+	}
+	for i := range want {
+		if config.GatewayControlledHeaders[i] != want[i] {
+			t.Errorf("want: %v, got: %v", want, config.GatewayControlledHeaders)
+		}
+	}
+}
+
+func TestRead_ScaleCacheExpiry(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.ScaleCacheExpiry != time.Millisecond*250 {
+		t.Errorf("ScaleCacheExpiry want: %s, got: %s", time.Millisecond*250, config.ScaleCacheExpiry)
+	}
+
+	defaults.Setenv("scale_cache_expiry", "2s")
+	config, _ = readConfig.Read(defaults)
+	if config.ScaleCacheExpiry != time.Second*2 {
+		t.Errorf("ScaleCacheExpiry want: %s, got: %s", time.Second*2, config.ScaleCacheExpiry)
+	}
+}
+
+func TestRead_TrustedProxies(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.TrustedProxies != 0 {
+		t.Errorf("TrustedProxies want: %d, got: %d", 0, config.TrustedProxies)
+	}
+
+	defaults.Setenv("trusted_proxies", "2")
+	config, _ = readConfig.Read(defaults)
+	if config.TrustedProxies != 2 {
+		t.Errorf("TrustedProxies want: %d, got: %d", 2, config.TrustedProxies)
+	}
+
+	defaults.Setenv("trusted_proxies", "-1")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a negative trusted_proxies")
+	}
+}
+
+func TestRead_PublicURL(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.PublicURL != nil {
+		t.Errorf("PublicURL want nil by default, got: %s", config.PublicURL)
+	}
+
+	defaults.Setenv("public_url", "https://api.example.com")
+	config, _ = readConfig.Read(defaults)
+	if config.PublicURL == nil || config.PublicURL.String() != "https://api.example.com" {
+		t.Errorf("PublicURL want: https://api.example.com, got: %v", config.PublicURL)
+	}
+
+	defaults.Setenv("public_url", "api.example.com")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a public_url without a scheme")
+	}
+}
+
+func TestRead_FeatureFlagHeader(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.FeatureFlagHeader != "X-Feature-Variant" {
+		t.Errorf("FeatureFlagHeader want: %s, got: %s", "X-Feature-Variant", config.FeatureFlagHeader)
+	}
+	if config.StripFeatureFlagHeader {
+		t.Errorf("StripFeatureFlagHeader want: false, got: true")
+	}
+
+	defaults.Setenv("feature_flag_header", "x-experiment")
+	defaults.Setenv("strip_feature_flag_header", "true")
+	config, _ = readConfig.Read(defaults)
+	if config.FeatureFlagHeader != "X-Experiment" {
+		t.Errorf("FeatureFlagHeader want: %s, got: %s", "X-Experiment", config.FeatureFlagHeader)
+	}
+	if !config.StripFeatureFlagHeader {
+		t.Errorf("StripFeatureFlagHeader want: true, got: false")
+	}
+}
+
+func TestRead_LatencySummaryWindow(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.LatencySummaryWindow != time.Minute {
+		t.Errorf("LatencySummaryWindow want: %s, got: %s", time.Minute, config.LatencySummaryWindow)
+	}
+
+	defaults.Setenv("latency_summary_window", "5m")
+	config, _ = readConfig.Read(defaults)
+	if config.LatencySummaryWindow != time.Minute*5 {
+		t.Errorf("LatencySummaryWindow want: %s, got: %s", time.Minute*5, config.LatencySummaryWindow)
+	}
+}
+
+func TestRead_InvocationStatsMaxFunctions(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.InvocationStatsMaxFunctions != 1000 {
+		t.Errorf("InvocationStatsMaxFunctions want: %d, got: %d", 1000, config.InvocationStatsMaxFunctions)
+	}
+
+	defaults.Setenv("invocation_stats_max_functions", "-1")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a negative invocation_stats_max_functions")
+	}
+}
+
+func TestRead_LatencySummaryMaxFunctions(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.LatencySummaryMaxFunctions != 1000 {
+		t.Errorf("LatencySummaryMaxFunctions want: %d, got: %d", 1000, config.LatencySummaryMaxFunctions)
+	}
+
+	defaults.Setenv("latency_summary_max_functions", "50")
+	config, _ = readConfig.Read(defaults)
+	if config.LatencySummaryMaxFunctions != 50 {
+		t.Errorf("LatencySummaryMaxFunctions want: %d, got: %d", 50, config.LatencySummaryMaxFunctions)
+	}
+
+	defaults.Setenv("latency_summary_max_functions", "-1")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a negative latency_summary_max_functions")
+	}
+}
+
+func TestRead_MaxConcurrentColdStarts(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.MaxConcurrentColdStarts != 0 {
+		t.Errorf("MaxConcurrentColdStarts want: %d, got: %d", 0, config.MaxConcurrentColdStarts)
+	}
+	if config.ColdStartPriorityAging != time.Second*10 {
+		t.Errorf("ColdStartPriorityAging want: %s, got: %s", time.Second*10, config.ColdStartPriorityAging)
+	}
+
+	defaults.Setenv("max_concurrent_cold_starts", "4")
+	defaults.Setenv("cold_start_priority_aging", "30s")
+	config, _ = readConfig.Read(defaults)
+	if config.MaxConcurrentColdStarts != 4 {
+		t.Errorf("MaxConcurrentColdStarts want: %d, got: %d", 4, config.MaxConcurrentColdStarts)
+	}
+	if config.ColdStartPriorityAging != time.Second*30 {
+		t.Errorf("ColdStartPriorityAging want: %s, got: %s", time.Second*30, config.ColdStartPriorityAging)
+	}
+
+	defaults.Setenv("max_concurrent_cold_starts", "-1")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a negative max_concurrent_cold_starts")
+	}
+}
+
+func TestRead_ColdStartProgress(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.ColdStartProgress {
+		t.Errorf("ColdStartProgress want disabled by default")
+	}
+	if config.ColdStartHistorySize != 10 {
+		t.Errorf("ColdStartHistorySize want: %d, got: %d", 10, config.ColdStartHistorySize)
+	}
+
+	defaults.Setenv("cold_start_progress", "true")
+	defaults.Setenv("cold_start_history_size", "25")
+	config, _ = readConfig.Read(defaults)
+	if !config.ColdStartProgress {
+		t.Errorf("ColdStartProgress want enabled")
+	}
+	if config.ColdStartHistorySize != 25 {
+		t.Errorf("ColdStartHistorySize want: %d, got: %d", 25, config.ColdStartHistorySize)
+	}
+
+	defaults.Setenv("cold_start_history_size", "0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a cold_start_history_size of 0")
+	}
+}
+
+func TestRead_ColdStartNamespaces(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if len(config.ColdStartNamespaceWeights) != 0 || len(config.ColdStartNamespaceLimits) != 0 {
+		t.Errorf("want no namespace weights or limits, got: %v %v", config.ColdStartNamespaceWeights, config.ColdStartNamespaceLimits)
+	}
+
+	defaults.Setenv("cold_start_namespace_weights", "team-a=3, team-b=1")
+	defaults.Setenv("cold_start_namespace_limits", "team-a=2")
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ColdStartNamespaceWeights["team-a"] != 3 || config.ColdStartNamespaceWeights["team-b"] != 1 {
+		t.Errorf("ColdStartNamespaceWeights want: team-a=3 team-b=1, got: %v", config.ColdStartNamespaceWeights)
+	}
+	if config.ColdStartNamespaceLimits["team-a"] != 2 {
+		t.Errorf("ColdStartNamespaceLimits want: team-a=2, got: %v", config.ColdStartNamespaceLimits)
+	}
+
+	for _, invalid := range []string{"team-a", "team-a=0", "=2", "team-a=x"} {
+		defaults.Setenv("cold_start_namespace_weights", invalid)
+		if _, err := readConfig.Read(defaults); err == nil {
+			t.Errorf("want an error for cold_start_namespace_weights: %q", invalid)
+		}
+	}
+}
+
+func TestRead_TimeBudget(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.TimeBudget != 0 {
+		t.Errorf("TimeBudget want: %s, got: %s", time.Duration(0), config.TimeBudget)
+	}
+
+	defaults.Setenv("time_budget", "5s")
+	config, _ = readConfig.Read(defaults)
+	if config.TimeBudget != time.Second*5 {
+		t.Errorf("TimeBudget want: %s, got: %s", time.Second*5, config.TimeBudget)
+	}
+}
+
+func TestRead_MaxRequestBodyBytes(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.MaxRequestBodyBytes != 0 {
+		t.Errorf("MaxRequestBodyBytes want: %d, got: %d", 0, config.MaxRequestBodyBytes)
+	}
+
+	defaults.Setenv("max_request_body_bytes", "1048576")
+	config, _ = readConfig.Read(defaults)
+	if config.MaxRequestBodyBytes != 1048576 {
+		t.Errorf("MaxRequestBodyBytes want: %d, got: %d", 1048576, config.MaxRequestBodyBytes)
+	}
+
+	defaults.Setenv("max_request_body_bytes", "1MB")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for an invalid max_request_body_bytes")
+	}
+}
+
+func TestRead_ContextHeaders(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	defaults.Setenv("context_headers", "x-locale, X-Tenant-Id")
+	defaults.Setenv("gateway_controlled_headers", "X-Tenant-Id,X-User-Roles")
+	config, _ := readConfig.Read(defaults)
+
+	want := []string{"X-Locale", "X-Tenant-Id"}
+	if len(config.ContextHeaders) != len(want) || config.ContextHeaders[0] != want[0] || config.ContextHeaders[1] != want[1] {
+		t.Errorf("ContextHeaders want: %v, got: %v", want, config.ContextHeaders)
+	}
+
+	if len(config.GatewayControlledHeaders) != 1 || config.GatewayControlledHeaders[0] != "X-User-Roles" {
+		t.Errorf("want context headers removed from GatewayControlledHeaders, got: %v", config.GatewayControlledHeaders)
+	}
+}
+
+func TestRead_TraceSampleRate(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.TraceSampleRate != 0 {
+		t.Errorf("TraceSampleRate want: %v, got: %v", 0, config.TraceSampleRate)
+	}
+
+	defaults.Setenv("trace_sample_rate", "0.25")
+	config, _ = readConfig.Read(defaults)
+	if config.TraceSampleRate != 0.25 {
+		t.Errorf("TraceSampleRate want: %v, got: %v", 0.25, config.TraceSampleRate)
+	}
+
+	defaults.Setenv("trace_sample_rate", "25")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a trace_sample_rate over 1")
+	}
+}
+
+func TestRead_TrailingSlash(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.TrailingSlash != "preserve" {
+		t.Errorf("TrailingSlash want: %s, got: %s", "preserve", config.TrailingSlash)
+	}
+
+	defaults.Setenv("trailing_slash", "strip")
+	config, _ = readConfig.Read(defaults)
+	if config.TrailingSlash != "strip" {
+		t.Errorf("TrailingSlash want: %s, got: %s", "strip", config.TrailingSlash)
+	}
+
+	defaults.Setenv("trailing_slash", "remove")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for an invalid trailing_slash")
+	}
+}
+
+func TestRead_FaultInjectionDisabledByDefault(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.FaultInjection {
+		t.Errorf("FaultInjection want: false, got: true")
+	}
+
+	defaults.Setenv("fault_injection", "true")
+	config, _ = readConfig.Read(defaults)
+	if !config.FaultInjection {
+		t.Errorf("FaultInjection want: true, got: false")
+	}
+}
+
+func TestRead_AsyncModeHeader(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.AsyncModeHeader != "" {
+		t.Errorf("AsyncModeHeader want disabled by default, got: %q", config.AsyncModeHeader)
+	}
+
+	defaults.Setenv("async_mode_header", "X-Callback-Url")
+	config, _ = readConfig.Read(defaults)
+	if config.AsyncModeHeader != "X-Callback-Url" {
+		t.Errorf("AsyncModeHeader want: %q, got: %q", "X-Callback-Url", config.AsyncModeHeader)
+	}
+}
+
+func TestRead_RequestIDHeader(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.RequestIDHeader != "X-Request-Id" {
+		t.Errorf("RequestIDHeader want: %s, got: %s", "X-Request-Id", config.RequestIDHeader)
+	}
+
+	defaults.Setenv("request_id_header", "x-correlation-id")
+	config, _ = readConfig.Read(defaults)
+	if config.RequestIDHeader != "X-Correlation-Id" {
+		t.Errorf("RequestIDHeader want: %s, got: %s", "X-Correlation-Id", config.RequestIDHeader)
+	}
+}
+
+func TestRead_MaxFunctionTimeout(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.MaxFunctionTimeout != 0 {
+		t.Errorf("MaxFunctionTimeout want no limit by default, got: %s", config.MaxFunctionTimeout)
+	}
+
+	defaults.Setenv("max_function_timeout", "5m")
+	config, _ = readConfig.Read(defaults)
+	if config.MaxFunctionTimeout != time.Minute*5 {
+		t.Errorf("MaxFunctionTimeout want: %s, got: %s", time.Minute*5, config.MaxFunctionTimeout)
+	}
+}
+
+func TestRead_AdmissionControl(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.AdmissionControl {
+		t.Errorf("AdmissionControl want disabled by default")
+	}
+	if config.AdmissionLatencyTarget != 0 {
+		t.Errorf("AdmissionLatencyTarget want: %s, got: %s", time.Duration(0), config.AdmissionLatencyTarget)
+	}
+	if config.AdmissionMaxInFlight != 1000 {
+		t.Errorf("AdmissionMaxInFlight want: %d, got: %d", 1000, config.AdmissionMaxInFlight)
+	}
+	if config.AdmissionRetryAfter != time.Second {
+		t.Errorf("AdmissionRetryAfter want: %s, got: %s", time.Second, config.AdmissionRetryAfter)
+	}
+	if config.AdmissionThreshold != 1 {
+		t.Errorf("AdmissionThreshold want: %f, got: %f", 1.0, config.AdmissionThreshold)
+	}
+
+	defaults.Setenv("admission_control", "true")
+	defaults.Setenv("admission_latency_target", "250ms")
+	defaults.Setenv("admission_threshold", "1.5")
+	defaults.Setenv("admission_max_in_flight", "200")
+	defaults.Setenv("admission_retry_after", "5s")
+	config, _ = readConfig.Read(defaults)
+	if !config.AdmissionControl {
+		t.Errorf("AdmissionControl want enabled")
+	}
+	if config.AdmissionLatencyTarget != time.Millisecond*250 {
+		t.Errorf("AdmissionLatencyTarget want: %s, got: %s", time.Millisecond*250, config.AdmissionLatencyTarget)
+	}
+	if config.AdmissionThreshold != 1.5 {
+		t.Errorf("AdmissionThreshold want: %f, got: %f", 1.5, config.AdmissionThreshold)
+	}
+	if config.AdmissionMaxInFlight != 200 {
+		t.Errorf("AdmissionMaxInFlight want: %d, got: %d", 200, config.AdmissionMaxInFlight)
+	}
+	if config.AdmissionRetryAfter != time.Second*5 {
+		t.Errorf("AdmissionRetryAfter want: %s, got: %s", time.Second*5, config.AdmissionRetryAfter)
+	}
+
+	defaults.Setenv("admission_threshold", "0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for an admission_threshold of 0")
+	}
+
+	defaults.Setenv("admission_threshold", "1")
+	defaults.Setenv("admission_max_in_flight", "0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for an admission_max_in_flight of 0")
+	}
+}
+
+func TestRead_RestrictedHeaders(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if len(config.RestrictedHeaders) != 0 {
+		t.Errorf("RestrictedHeaders want none by default, got: %v", config.RestrictedHeaders)
+	}
+
+	defaults.Setenv("restricted_headers", "x-internal-token=billing, auth.internal; X-Admin-Key=admin")
+	config, _ = readConfig.Read(defaults)
+	want := map[string][]string{
+		"X-Internal-Token": {"billing", "auth.internal"},
+		"X-Admin-Key":      {"admin"},
+	}
+	if !reflect.DeepEqual(config.RestrictedHeaders, want) {
+		t.Errorf("RestrictedHeaders want: %v, got: %v", want, config.RestrictedHeaders)
+	}
+
+	defaults.Setenv("restricted_headers", "X-Internal-Token=")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a header without functions")
+	}
+}
+
+func TestRead_NamespaceAuthSecrets(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if len(config.NamespaceAuthSecrets) != 0 {
+		t.Errorf("NamespaceAuthSecrets want none by default, got: %v", config.NamespaceAuthSecrets)
+	}
+
+	defaults.Setenv("namespace_auth_secrets", "team-a=/var/secrets/team-a; team-b = /var/secrets/team-b")
+	config, _ = readConfig.Read(defaults)
+	want := map[string]string{
+		"team-a": "/var/secrets/team-a",
+		"team-b": "/var/secrets/team-b",
+	}
+	if !reflect.DeepEqual(config.NamespaceAuthSecrets, want) {
+		t.Errorf("NamespaceAuthSecrets want: %v, got: %v", want, config.NamespaceAuthSecrets)
+	}
+
+	defaults.Setenv("namespace_auth_secrets", "team-a")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a namespace without a path")
+	}
+}
+
+func TestRead_StatsD(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if len(config.StatsDHost) != 0 {
+		t.Errorf("StatsDHost want disabled by default, got: %s", config.StatsDHost)
+	}
+	if config.StatsDPort != 8125 {
+		t.Errorf("StatsDPort want: %d, got: %d", 8125, config.StatsDPort)
+	}
+	if config.StatsDPrefix != "openfaas.gateway" {
+		t.Errorf("StatsDPrefix want: %s, got: %s", "openfaas.gateway", config.StatsDPrefix)
+	}
+	if config.StatsDSampleRate != 1 {
+		t.Errorf("StatsDSampleRate want: %v, got: %v", 1, config.StatsDSampleRate)
+	}
+
+	defaults.Setenv("statsd_host", "statsd.monitoring")
+	defaults.Setenv("statsd_port", "9125")
+	defaults.Setenv("statsd_prefix", "edge")
+	defaults.Setenv("statsd_sample_rate", "0.25")
+	config, _ = readConfig.Read(defaults)
+	if config.StatsDHost != "statsd.monitoring" {
+		t.Errorf("StatsDHost want: %s, got: %s", "statsd.monitoring", config.StatsDHost)
+	}
+	if config.StatsDPort != 9125 {
+		t.Errorf("StatsDPort want: %d, got: %d", 9125, config.StatsDPort)
+	}
+	if config.StatsDPrefix != "edge" {
+		t.Errorf("StatsDPrefix want: %s, got: %s", "edge", config.StatsDPrefix)
+	}
+	if config.StatsDSampleRate != 0.25 {
+		t.Errorf("StatsDSampleRate want: %v, got: %v", 0.25, config.StatsDSampleRate)
+	}
+
+	defaults.Setenv("statsd_sample_rate", "0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a statsd_sample_rate of 0")
+	}
+	defaults.Setenv("statsd_sample_rate", "1")
+	defaults.Setenv("statsd_port", "70000")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for an invalid statsd_port")
+	}
+}
+
+func TestRead_ScaleDownDrainTimeout(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.ScaleDownDrainTimeout != 0 {
+		t.Errorf("ScaleDownDrainTimeout want: %s, got: %s", time.Duration(0), config.ScaleDownDrainTimeout)
+	}
+
+	defaults.Setenv("scale_down_drain_timeout", "30s")
+	config, _ = readConfig.Read(defaults)
+	if config.ScaleDownDrainTimeout != time.Second*30 {
+		t.Errorf("ScaleDownDrainTimeout want: %s, got: %s", time.Second*30, config.ScaleDownDrainTimeout)
+	}
+}
+
+func TestRead_FailoverPeers(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if len(config.FailoverPeers) != 0 {
+		t.Errorf("FailoverPeers want none by default, got: %v", config.FailoverPeers)
+	}
+
+	defaults.Setenv("failover_peers", "us-east=https://gw.us-east.example.com")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for failover_peers without failover_region")
+	}
+
+	defaults.Setenv("failover_region", "eu-west")
+	defaults.Setenv("failover_peers", "us-east=https://gw.us-east.example.com, ap-south=http://gw.ap-south:8080")
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+	want := []FailoverPeer{
+		{Region: "us-east", URL: "https://gw.us-east.example.com"},
+		{Region: "ap-south", URL: "http://gw.ap-south:8080"},
+	}
+	if config.FailoverRegion != "eu-west" || !reflect.DeepEqual(config.FailoverPeers, want) {
+		t.Errorf("FailoverPeers want: %v, got: %s %v", want, config.FailoverRegion, config.FailoverPeers)
+	}
+
+	defaults.Setenv("failover_peers", "us-east=gw.us-east")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a peer URL without a scheme")
+	}
+}
+
+func TestRead_FailoverPeerAuthSecrets(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	defaults.Setenv("failover_region", "eu-west")
+	defaults.Setenv("failover_peers", "us-east=https://gw.us-east.example.com,ap-south=https://gw.ap-south.example.com")
+	defaults.Setenv("failover_peer_auth_secrets", "us-east = /var/secrets/us-east")
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+	want := []FailoverPeer{
+		{Region: "us-east", URL: "https://gw.us-east.example.com", AuthSecretPath: "/var/secrets/us-east"},
+		{Region: "ap-south", URL: "https://gw.ap-south.example.com"},
+	}
+	if !reflect.DeepEqual(config.FailoverPeers, want) {
+		t.Errorf("FailoverPeers want: %v, got: %v", want, config.FailoverPeers)
+	}
+
+	defaults.Setenv("failover_peer_auth_secrets", "us-west=/var/secrets/us-west")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a region which is not a peer")
+	}
+
+	defaults.Setenv("failover_peer_auth_secrets", "us-east")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for an entry without a path")
+	}
+}
+
+func TestRead_TimeoutBreakdown(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.TimeoutBreakdown {
+		t.Errorf("TimeoutBreakdown want false by default")
+	}
+
+	defaults.Setenv("timeout_breakdown", "true")
+	config, _ = readConfig.Read(defaults)
+	if !config.TimeoutBreakdown {
+		t.Errorf("TimeoutBreakdown want true")
+	}
+}
+
+func TestRead_ScaleRules(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.ScaleRules != nil {
+		t.Errorf("ScaleRules want nil by default, got: %v", config.ScaleRules)
+	}
+
+	defaults.Setenv("scale_rules", "POST /system/scale-function/ replicas, put /apis/scale/ spec.replicas")
+	config, err := readConfig.Read(defaults)
+	if err != nil {
+		t.Fatalf("want no error, got: %s", err)
+	}
+	want := []ScaleRule{
+		{Method: "POST", PathPrefix: "/system/scale-function/", ReplicaField: "replicas"},
+		{Method: "PUT", PathPrefix: "/apis/scale/", ReplicaField: "spec.replicas"},
+	}
+	if !reflect.DeepEqual(config.ScaleRules, want) {
+		t.Errorf("ScaleRules want: %v, got: %v", want, config.ScaleRules)
+	}
+
+	for _, value := range []string{
+		"PUT /apis/scale/",
+		"PUT apis/scale/ replicas",
+		"PUT / replicas",
+		"POST /system/ replicas",
+		"PUT /system/scale-function/ replicas",
+		"POST /system/secrets/ replicas",
+		"POST /function/ replicas",
+	} {
+		defaults.Setenv("scale_rules", value)
+		if _, err := readConfig.Read(defaults); err == nil {
+			t.Errorf("want an error for scale_rules: %q", value)
+		}
+	}
+}
+
+func TestRead_ReplicasHeader(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.ReplicasHeader {
+		t.Errorf("ReplicasHeader want false by default")
+	}
+
+	defaults.Setenv("replicas_header", "true")
+	config, _ = readConfig.Read(defaults)
+	if !config.ReplicasHeader {
+		t.Errorf("ReplicasHeader want true")
+	}
+}
+
+func TestRead_CostClassWeights(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if len(config.CostClassWeights) != 0 {
+		t.Errorf("CostClassWeights want none by default, got: %v", config.CostClassWeights)
+	}
+
+	defaults.Setenv("cost_class_weights", "High=4, medium=2")
+	config, _ = readConfig.Read(defaults)
+	want := map[string]int64{"high": 4, "medium": 2}
+	if !reflect.DeepEqual(config.CostClassWeights, want) {
+		t.Errorf("CostClassWeights want: %v, got: %v", want, config.CostClassWeights)
+	}
+
+	defaults.Setenv("cost_class_weights", "high=0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a weight of 0")
+	}
+}
+
+func TestRead_CacheWarming(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.CacheWarming {
+		t.Errorf("CacheWarming want disabled by default")
+	}
+	if config.CacheWarmingConcurrency != 4 {
+		t.Errorf("CacheWarmingConcurrency want: %d, got: %d", 4, config.CacheWarmingConcurrency)
+	}
+	if config.CacheWarmingRate != 20 {
+		t.Errorf("CacheWarmingRate want: %d, got: %d", 20, config.CacheWarmingRate)
+	}
+
+	defaults.Setenv("cache_warming", "true")
+	defaults.Setenv("cache_warming_concurrency", "8")
+	defaults.Setenv("cache_warming_rate", "0")
+	config, _ = readConfig.Read(defaults)
+	if !config.CacheWarming {
+		t.Errorf("CacheWarming want enabled")
+	}
+	if config.CacheWarmingConcurrency != 8 {
+		t.Errorf("CacheWarmingConcurrency want: %d, got: %d", 8, config.CacheWarmingConcurrency)
+	}
+	if config.CacheWarmingRate != 0 {
+		t.Errorf("CacheWarmingRate want unlimited, got: %d", config.CacheWarmingRate)
+	}
+
+	defaults.Setenv("cache_warming_concurrency", "0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a cache_warming_concurrency of 0")
+	}
+}
+
+func TestRead_SlowRequestThreshold(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.SlowRequestThreshold != 0 {
+		t.Errorf("SlowRequestThreshold want disabled by default, got: %s", config.SlowRequestThreshold)
+	}
+
+	defaults.Setenv("slow_request_threshold", "2s")
+	config, _ = readConfig.Read(defaults)
+	if config.SlowRequestThreshold != time.Second*2 {
+		t.Errorf("SlowRequestThreshold want: %s, got: %s", time.Second*2, config.SlowRequestThreshold)
+	}
+}
+
+func TestRead_LogUpstreamConnectionClose(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.LogUpstreamConnectionClose {
+		t.Errorf("LogUpstreamConnectionClose want disabled by default")
+	}
+
+	defaults.Setenv("log_upstream_connection_close", "true")
+	config, _ = readConfig.Read(defaults)
+	if !config.LogUpstreamConnectionClose {
+		t.Errorf("LogUpstreamConnectionClose want enabled")
+	}
+}
+
+func TestRead_RequestTap(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.RequestTap {
+		t.Errorf("RequestTap want disabled by default")
+	}
+	if config.RequestTapSize != 20 {
+		t.Errorf("RequestTapSize want: %d, got: %d", 20, config.RequestTapSize)
+	}
+	if config.RequestTapMaxBodyBytes != 4096 {
+		t.Errorf("RequestTapMaxBodyBytes want: %d, got: %d", 4096, config.RequestTapMaxBodyBytes)
+	}
+
+	defaults.Setenv("request_tap", "true")
+	defaults.Setenv("request_tap_functions", "figlet, env.dev")
+	defaults.Setenv("request_tap_size", "5")
+	defaults.Setenv("request_tap_max_body_bytes", "100")
+	defaults.Setenv("request_tap_redact_headers", "x-api-key,cookie")
+	config, _ = readConfig.Read(defaults)
+	if !config.RequestTap {
+		t.Errorf("RequestTap want enabled")
+	}
+	if want := []string{"figlet", "env.dev"}; !reflect.DeepEqual(config.RequestTapFunctions, want) {
+		t.Errorf("RequestTapFunctions want: %v, got: %v", want, config.RequestTapFunctions)
+	}
+	if config.RequestTapSize != 5 {
+		t.Errorf("RequestTapSize want: %d, got: %d", 5, config.RequestTapSize)
+	}
+	if config.RequestTapMaxBodyBytes != 100 {
+		t.Errorf("RequestTapMaxBodyBytes want: %d, got: %d", 100, config.RequestTapMaxBodyBytes)
+	}
+	if want := []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Api-Key"}; !reflect.DeepEqual(config.RequestTapRedactHeaders, want) {
+		t.Errorf("RequestTapRedactHeaders want: %v, got: %v", want, config.RequestTapRedactHeaders)
+	}
+
+	defaults.Setenv("request_tap_size", "0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a request_tap_size of 0")
+	}
+}
+
+func TestRead_HealthScore(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.HealthScoreDecay != 0.1 {
+		t.Errorf("HealthScoreDecay want: %f, got: %f", 0.1, config.HealthScoreDecay)
+	}
+	if config.HealthScoreLatencyTarget != time.Millisecond*100 {
+		t.Errorf("HealthScoreLatencyTarget want: %s, got: %s", time.Millisecond*100, config.HealthScoreLatencyTarget)
+	}
+	if config.HealthScoreMinScore != 0.05 {
+		t.Errorf("HealthScoreMinScore want: %f, got: %f", 0.05, config.HealthScoreMinScore)
+	}
+
+	defaults.Setenv("health_score_decay", "0.5")
+	defaults.Setenv("health_score_latency_target", "1s")
+	defaults.Setenv("health_score_min_score", "0")
+	config, _ = readConfig.Read(defaults)
+	if config.HealthScoreDecay != 0.5 {
+		t.Errorf("HealthScoreDecay want: %f, got: %f", 0.5, config.HealthScoreDecay)
+	}
+	if config.HealthScoreLatencyTarget != time.Second {
+		t.Errorf("HealthScoreLatencyTarget want: %s, got: %s", time.Second, config.HealthScoreLatencyTarget)
+	}
+	if config.HealthScoreMinScore != 0 {
+		t.Errorf("HealthScoreMinScore want: %f, got: %f", 0.0, config.HealthScoreMinScore)
+	}
+
+	for _, decay := range []string{"0", "1.5", "fast"} {
+		defaults.Setenv("health_score_decay", decay)
+		if _, err := readConfig.Read(defaults); err == nil {
+			t.Errorf("want an error for a health_score_decay of %s", decay)
+		}
+	}
+}
+
+func TestRead_RequestSchema(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.RequestSchemaDir != "" {
+		t.Errorf("RequestSchemaDir want empty by default, got: %q", config.RequestSchemaDir)
+	}
+	if config.RequestSchemaMaxBodyBytes != 1024*1024 {
+		t.Errorf("RequestSchemaMaxBodyBytes want: %d, got: %d", 1024*1024, config.RequestSchemaMaxBodyBytes)
+	}
+
+	defaults.Setenv("request_schema_dir", "/var/openfaas/schemas")
+	defaults.Setenv("request_schema_max_body_bytes", "2048")
+	config, _ = readConfig.Read(defaults)
+	if config.RequestSchemaDir != "/var/openfaas/schemas" {
+		t.Errorf("RequestSchemaDir want: /var/openfaas/schemas, got: %q", config.RequestSchemaDir)
+	}
+	if config.RequestSchemaMaxBodyBytes != 2048 {
+		t.Errorf("RequestSchemaMaxBodyBytes want: %d, got: %d", 2048, config.RequestSchemaMaxBodyBytes)
+	}
+
+	defaults.Setenv("request_schema_max_body_bytes", "0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a request_schema_max_body_bytes of 0")
+	}
+}
+
+func TestRead_ScaleEvents(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.ScaleEventsURL != nil {
+		t.Errorf("ScaleEventsURL want nil by default, got: %s", config.ScaleEventsURL)
+	}
+	if config.ScaleEventsBuffer != 100 {
+		t.Errorf("ScaleEventsBuffer want: %d, got: %d", 100, config.ScaleEventsBuffer)
+	}
+
+	defaults.Setenv("scale_events_url", "http://events.openfaas:8080/scale")
+	defaults.Setenv("scale_events_buffer", "10")
+	config, _ = readConfig.Read(defaults)
+	if config.ScaleEventsURL == nil || config.ScaleEventsURL.String() != "http://events.openfaas:8080/scale" {
+		t.Errorf("ScaleEventsURL want: http://events.openfaas:8080/scale, got: %v", config.ScaleEventsURL)
+	}
+	if config.ScaleEventsBuffer != 10 {
+		t.Errorf("ScaleEventsBuffer want: %d, got: %d", 10, config.ScaleEventsBuffer)
+	}
+
+	defaults.Setenv("scale_events_url", "events.openfaas")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a scale_events_url without a scheme")
+	}
+}
+
+func TestRead_ContentTransformMaxBodyBytes(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.ContentTransformMaxBodyBytes != 1024*1024 {
+		t.Errorf("ContentTransformMaxBodyBytes want: %d, got: %d", 1024*1024, config.ContentTransformMaxBodyBytes)
+	}
+
+	defaults.Setenv("content_transform_max_body_bytes", "4096")
+	config, _ = readConfig.Read(defaults)
+	if config.ContentTransformMaxBodyBytes != 4096 {
+		t.Errorf("ContentTransformMaxBodyBytes want: %d, got: %d", 4096, config.ContentTransformMaxBodyBytes)
+	}
+
+	defaults.Setenv("content_transform_max_body_bytes", "-1")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a negative content_transform_max_body_bytes")
+	}
+}
+
+func TestRead_BodyChecksumMaxBodyBytes(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.BodyChecksumMaxBodyBytes != 1024*1024 {
+		t.Errorf("BodyChecksumMaxBodyBytes want: %d, got: %d", 1024*1024, config.BodyChecksumMaxBodyBytes)
+	}
+
+	defaults.Setenv("body_checksum_max_body_bytes", "4096")
+	config, _ = readConfig.Read(defaults)
+	if config.BodyChecksumMaxBodyBytes != 4096 {
+		t.Errorf("BodyChecksumMaxBodyBytes want: %d, got: %d", 4096, config.BodyChecksumMaxBodyBytes)
+	}
+
+	defaults.Setenv("body_checksum_max_body_bytes", "0")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a body_checksum_max_body_bytes of 0")
+	}
+}
+
+func TestRead_UpstreamExplicitEmptyBody(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.UpstreamExplicitEmptyBody {
+		t.Errorf("UpstreamExplicitEmptyBody want disabled by default")
+	}
+
+	defaults.Setenv("upstream_explicit_empty_body", "true")
+	config, _ = readConfig.Read(defaults)
+	if !config.UpstreamExplicitEmptyBody {
+		t.Errorf("UpstreamExplicitEmptyBody want enabled")
+	}
+}
+
+func TestRead_UpstreamResponseBufferBytes(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.UpstreamResponseBufferBytes != 0 {
+		t.Errorf("UpstreamResponseBufferBytes want 0 by default, got: %d", config.UpstreamResponseBufferBytes)
+	}
+
+	defaults.Setenv("upstream_response_buffer_bytes", "65536")
+	config, _ = readConfig.Read(defaults)
+	if config.UpstreamResponseBufferBytes != 65536 {
+		t.Errorf("UpstreamResponseBufferBytes want: 65536, got: %d", config.UpstreamResponseBufferBytes)
+	}
+
+	defaults.Setenv("upstream_response_buffer_bytes", "-1")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a negative upstream_response_buffer_bytes")
+	}
+}
+
+func TestRead_ScaleHintSecretPath(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if len(config.ScaleHintSecretPath) > 0 {
+		t.Errorf("ScaleHintSecretPath want empty by default, got: %s", config.ScaleHintSecretPath)
+	}
+
+	defaults.Setenv("scale_hint_secret_path", "/run/secrets/scale-hint")
+	config, _ = readConfig.Read(defaults)
+	if config.ScaleHintSecretPath != "/run/secrets/scale-hint" {
+		t.Errorf("ScaleHintSecretPath want: /run/secrets/scale-hint, got: %s", config.ScaleHintSecretPath)
+	}
+}
+
+func TestRead_BatchMaxBodyBytes(t *testing.T) {
+	defaults := NewEnvBucket()
+	readConfig := ReadConfig{}
+
+	config, _ := readConfig.Read(defaults)
+	if config.BatchMaxBodyBytes != 1024*1024 {
+		t.Errorf("BatchMaxBodyBytes want: %d, got: %d", 1024*1024, config.BatchMaxBodyBytes)
+	}
+
+	defaults.Setenv("batch_max_body_bytes", "0")
+	config, _ = readConfig.Read(defaults)
+	if config.BatchMaxBodyBytes != 0 {
+		t.Errorf("BatchMaxBodyBytes want: %d, got: %d", 0, config.BatchMaxBodyBytes)
+	}
+
+	defaults.Setenv("batch_max_body_bytes", "-1")
+	if _, err := readConfig.Read(defaults); err == nil {
+		t.Errorf("want an error for a negative batch_max_body_bytes")
+	}
+}
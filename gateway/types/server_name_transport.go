@@ -0,0 +1,126 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultMaxServerNames is how many server names a ServerNameTransport keeps
+// connections open for
+const DefaultMaxServerNames = 64
+
+type serverNameKey struct{}
+
+// WithServerName returns a copy of ctx in which requests are sent with the
+// TLS server name (SNI) by a ServerNameTransport
+func WithServerName(ctx context.Context, serverName string) context.Context {
+	return context.WithValue(ctx, serverNameKey{}, serverName)
+}
+
+// ServerName returns the TLS server name set by WithServerName, if any
+func ServerName(ctx context.Context) (string, bool) {
+	serverName, ok := ctx.Value(serverNameKey{}).(string)
+	return serverName, ok && len(serverName) > 0
+}
+
+// ServerNameTransport sends HTTPS requests with a server name in their
+// context through a clone of Transport which sets it as the SNI, so that a
+// function can be reached through a shared TLS endpoint which expects a name
+// other than the URL's host. Other requests are sent through Transport.
+//
+// A Transport pools connections by address rather than by server name, so
+// each name has a clone of its own and a connection opened for one name is
+// never reused for another. At most MaxServerNames clones are kept, the
+// least recently used is closed when another is needed. The clones share the
+// dialer of Transport, so a ServerNameTransport is wrapped by any
+// instrumentation rather than wrapping it.
+type ServerNameTransport struct {
+	Transport *http.Transport
+
+	// MaxServerNames bounds the clones of Transport
+	MaxServerNames int
+
+	lock       sync.Mutex
+	transports map[string]*serverNameClone
+}
+
+type serverNameClone struct {
+	transport *http.Transport
+	lastUsed  time.Time
+}
+
+// NewServerNameTransport creates a ServerNameTransport which clones
+// transport for up to maxServerNames names
+func NewServerNameTransport(transport *http.Transport, maxServerNames int) *ServerNameTransport {
+	return &ServerNameTransport{
+		Transport:      transport,
+		MaxServerNames: maxServerNames,
+		transports:     make(map[string]*serverNameClone),
+	}
+}
+
+// RoundTrip sends r with the server name in its context, if any
+func (s *ServerNameTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	serverName, ok := ServerName(r.Context())
+	if !ok || r.URL.Scheme != "https" {
+		return s.Transport.RoundTrip(r)
+	}
+	return s.transport(serverName).RoundTrip(r)
+}
+
+// CloseIdleConnections closes the idle connections of Transport and of its
+// clones
+func (s *ServerNameTransport) CloseIdleConnections() {
+	s.Transport.CloseIdleConnections()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, clone := range s.transports {
+		clone.transport.CloseIdleConnections()
+	}
+}
+
+func (s *ServerNameTransport) transport(serverName string) *http.Transport {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if clone, ok := s.transports[serverName]; ok {
+		clone.lastUsed = time.Now()
+		return clone.transport
+	}
+
+	if s.MaxServerNames > 0 && len(s.transports) >= s.MaxServerNames {
+		s.evictLeastRecent()
+	}
+
+	transport := s.Transport.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.ServerName = serverName
+	s.transports[serverName] = &serverNameClone{transport: transport, lastUsed: time.Now()}
+	return transport
+}
+
+// evictLeastRecent closes the clone used least recently, the connections of
+// requests in flight on it are closed by its IdleConnTimeout once idle
+func (s *ServerNameTransport) evictLeastRecent() {
+	var oldest string
+	var oldestUsed time.Time
+	for serverName, clone := range s.transports {
+		if len(oldest) == 0 || clone.lastUsed.Before(oldestUsed) {
+			oldest, oldestUsed = serverName, clone.lastUsed
+		}
+	}
+
+	if clone, ok := s.transports[oldest]; ok {
+		clone.transport.CloseIdleConnections()
+		delete(s.transports, oldest)
+	}
+}
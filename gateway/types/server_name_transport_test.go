@@ -0,0 +1,106 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serverNameServer records the SNI of each request, its certificate is valid
+// for example.com and 127.0.0.1
+func serverNameServer() (*httptest.Server, *string) {
+	var serverName string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverName = r.TLS.ServerName
+	}))
+	return server, &serverName
+}
+
+func Test_ServerNameTransport_OverridesSNI(t *testing.T) {
+	server, serverName := serverNameServer()
+	defer server.Close()
+
+	transport := server.Client().Transport.(*http.Transport)
+	client := &http.Client{Transport: NewServerNameTransport(transport, DefaultMaxServerNames)}
+
+	req, _ := http.NewRequestWithContext(WithServerName(context.Background(), "example.com"), http.MethodGet, server.URL, nil)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if *serverName != "example.com" {
+		t.Errorf("SNI want: %q, got: %q", "example.com", *serverName)
+	}
+	if transport.TLSClientConfig.ServerName != "" {
+		t.Errorf("want the shared transport to be left unchanged, got: %q", transport.TLSClientConfig.ServerName)
+	}
+}
+
+func Test_ServerNameTransport_DefaultsToURLHost(t *testing.T) {
+	server, serverName := serverNameServer()
+	defer server.Close()
+
+	transport := server.Client().Transport.(*http.Transport)
+	client := &http.Client{Transport: NewServerNameTransport(transport, DefaultMaxServerNames)}
+
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	// No SNI is sent for the IP address of the URL's host
+	if *serverName != "" {
+		t.Errorf("SNI want none for the URL's host, got: %q", *serverName)
+	}
+}
+
+func Test_ServerNameTransport_BoundsServerNames(t *testing.T) {
+	server, serverName := serverNameServer()
+	defer server.Close()
+
+	transport := server.Client().Transport.(*http.Transport)
+	serverNames := NewServerNameTransport(transport, 2)
+	client := &http.Client{Transport: serverNames}
+
+	for _, name := range []string{"a.example.com", "b.example.com", "a.example.com", "c.example.com"} {
+		req, _ := http.NewRequestWithContext(WithServerName(context.Background(), name), http.MethodGet, server.URL, nil)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if *serverName != name {
+			t.Errorf("SNI want: %q, got: %q", name, *serverName)
+		}
+	}
+
+	// b.example.com was used least recently
+	if len(serverNames.transports) != 2 || serverNames.transports["b.example.com"] != nil {
+		t.Errorf("server names want: a.example.com and c.example.com, got: %v", serverNames.transports)
+	}
+}
+
+func Test_WithServerName(t *testing.T) {
+	proxy := &HTTPClientReverseProxy{
+		FunctionServerName: func(r *http.Request) (string, bool) {
+			return "echo.example.com", r.URL.Path == "/function/echo"
+		},
+	}
+
+	got, ok := ServerName(proxy.WithServerName(httptest.NewRequest(http.MethodGet, "/function/echo", nil)).Context())
+	if !ok || got != "echo.example.com" {
+		t.Errorf("server name want: %q, got: %q", "echo.example.com", got)
+	}
+
+	if _, ok := ServerName(proxy.WithServerName(httptest.NewRequest(http.MethodGet, "/function/env", nil)).Context()); ok {
+		t.Errorf("want no server name for a function without one")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/openfaas/faas/gateway/pkg/middleware"
+)
+
+// UpstreamProxySelector picks an egress proxy for upstream requests by the
+// namespace of the function being invoked. Requests for namespaces without
+// a proxy use Default, or Fallback when Default is nil.
+type UpstreamProxySelector struct {
+	Default          *url.URL
+	Namespaces       map[string]*url.URL
+	DefaultNamespace string
+	Fallback         func(*http.Request) (*url.URL, error)
+}
+
+// Proxy can be used as http.Transport.Proxy, HTTPS requests are tunnelled
+// with CONNECT so TLS is verified end-to-end with the function.
+func (s UpstreamProxySelector) Proxy(r *http.Request) (*url.URL, error) {
+	if len(s.Namespaces) > 0 {
+		_, namespace := middleware.GetNamespace(s.DefaultNamespace, middleware.GetServiceName(r.URL.Path))
+		if proxyURL, ok := s.Namespaces[namespace]; ok {
+			return proxyURL, nil
+		}
+	}
+
+	if s.Default != nil {
+		return s.Default, nil
+	}
+
+	if s.Fallback != nil {
+		return s.Fallback(r)
+	}
+	return nil, nil
+}
+
+// ParseUpstreamProxyURL parses a proxy URL with the http, https or socks5 scheme
+func ParseUpstreamProxyURL(value string) (*url.URL, error) {
+	proxyURL, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return nil, err
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+		return proxyURL, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme: %q, use http, https or socks5", proxyURL.Scheme)
+}
+
+// ParseUpstreamProxies parses a comma-separated list of namespace=URL pairs
+func ParseUpstreamProxies(value string) (map[string]*url.URL, error) {
+	proxies := map[string]*url.URL{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+
+		namespace, rawURL, ok := strings.Cut(pair, "=")
+		if !ok || len(strings.TrimSpace(namespace)) == 0 {
+			return nil, fmt.Errorf("invalid proxy mapping: %q, want namespace=URL", pair)
+		}
+
+		proxyURL, err := ParseUpstreamProxyURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		proxies[strings.TrimSpace(namespace)] = proxyURL
+	}
+	return proxies, nil
+}
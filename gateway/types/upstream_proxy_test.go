@@ -0,0 +1,60 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func Test_UpstreamProxySelector_ByNamespace(t *testing.T) {
+	proxies, err := ParseUpstreamProxies("isolated=socks5://egress:1080, dev=http://squid:3128")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaultProxy, _ := url.Parse("http://default:3128")
+	selector := UpstreamProxySelector{
+		Default:          defaultProxy,
+		Namespaces:       proxies,
+		DefaultNamespace: "openfaas-fn",
+	}
+
+	scenarios := []struct {
+		path string
+		want string
+	}{
+		{path: "/function/figlet.isolated", want: "socks5://egress:1080"},
+		{path: "/function/figlet.dev/path", want: "http://squid:3128"},
+		{path: "/function/figlet", want: "http://default:3128"},
+	}
+
+	for _, s := range scenarios {
+		req, _ := http.NewRequest(http.MethodGet, "http://gateway:8080"+s.path, nil)
+		got, err := selector.Proxy(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != s.want {
+			t.Errorf("%s want: %s, got: %s", s.path, s.want, got)
+		}
+	}
+}
+
+func Test_UpstreamProxySelector_DirectByDefault(t *testing.T) {
+	selector := UpstreamProxySelector{}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://gateway:8080/function/figlet", nil)
+	got, err := selector.Proxy(req)
+	if err != nil || got != nil {
+		t.Errorf("want a direct connection, got: %v %v", got, err)
+	}
+}
+
+func Test_ParseUpstreamProxyURL_RejectsUnknownScheme(t *testing.T) {
+	if _, err := ParseUpstreamProxyURL("ftp://proxy:21"); err == nil {
+		t.Errorf("want an error for the ftp scheme")
+	}
+}
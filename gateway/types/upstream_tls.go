@@ -0,0 +1,46 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// ParseTLSVersion parses a minimum TLS version of 1.2 or 1.3, older versions
+// are rejected
+func ParseTLSVersion(value string) (uint16, error) {
+	switch strings.TrimSpace(value) {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version: %q, use 1.2 or 1.3", value)
+}
+
+// ParseCipherSuites parses a comma-separated list of cipher suite names as
+// given by tls.CipherSuites, suites with known security issues are rejected
+func ParseCipherSuites(value string) ([]uint16, error) {
+	secure := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+
+	suites := []uint16{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+
+		id, ok := secure[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure cipher suite: %q", name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) OpenFaaS Author(s). All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package types
+
+import (
+	"crypto/tls"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func Test_ParseTLSVersion(t *testing.T) {
+	if got, err := ParseTLSVersion("1.3"); err != nil || got != tls.VersionTLS13 {
+		t.Errorf("want TLS 1.3, got: %d, err: %v", got, err)
+	}
+
+	for _, value := range []string{"1.0", "1.1", "ssl3", ""} {
+		if _, err := ParseTLSVersion(value); err == nil {
+			t.Errorf("want error for %q", value)
+		}
+	}
+}
+
+func Test_ParseCipherSuites(t *testing.T) {
+	got, err := ParseCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected cipher suites: %v", got)
+	}
+
+	for _, value := range []string{"TLS_RSA_WITH_RC4_128_SHA", "TLS_FAKE"} {
+		if _, err := ParseCipherSuites(value); err == nil {
+			t.Errorf("want error for %q", value)
+		}
+	}
+}
+
+func Test_ConfigureTLS_SetsTransport(t *testing.T) {
+	baseURL, _ := url.Parse("https://faas-provider:8080")
+	proxy := NewHTTPClientReverseProxy(baseURL, time.Second, 1, 1)
+
+	suites := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+	proxy.ConfigureTLS(tls.VersionTLS12, suites)
+
+	config := proxy.Transport.TLSClientConfig
+	if config == nil {
+		t.Fatal("want TLSClientConfig to be set")
+	}
+	if config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion want: %d, got: %d", tls.VersionTLS12, config.MinVersion)
+	}
+	if len(config.CipherSuites) != 1 || config.CipherSuites[0] != suites[0] {
+		t.Errorf("CipherSuites want: %v, got: %v", suites, config.CipherSuites)
+	}
+}
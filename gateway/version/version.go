@@ -10,6 +10,9 @@ var (
 	// GitCommitMessage as read from the latest tag/release
 	GitCommitMessage = "See GitHub for latest changes"
 
+	// BuildDate is when the binary was built, in RFC3339 format
+	BuildDate string
+
 	// DevVersion string for the development version
 	DevVersion = "dev"
 )